@@ -1,6 +1,7 @@
 package catalog
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -33,8 +34,48 @@ type Directory struct {
 	/*
 		datafile[Key]: Key is the fully specified path to the datafile, including rootPath and filename
 	*/
+	timezone string
+	/*
+		timezone: name of the timezone recorded for the bucket of the datafiles, see SetTimezone
+	*/
+	stringDict *io.StringDictionary
+	/*
+		stringDict: dictionary of the string columns of the bucket, loaded on first use
+	*/
+	scales map[string]int
+	/*
+		scales: decimal places of the DECIMAL columns of the bucket by name, see SetScales
+	*/
+	metadata map[string]string
+	/*
+		metadata: user metadata of the bucket, such as its description or its source feed, see SetMetadata
+	*/
+	sequenced bool
+	/*
+		sequenced: set if the records of the bucket are keyed by their time and their Sequence, see SetSequenced
+	*/
 }
 
+// timezoneFileName is the file recording the timezone of a bucket in its
+// directory, along with its year files
+const timezoneFileName = "timezone"
+
+// stringsFileName is the file of the dictionary of the string columns of a
+// bucket in its directory
+const stringsFileName = "strings"
+
+// scalesFileName is the file recording the scales of the DECIMAL columns of
+// a bucket in its directory, as a JSON object
+const scalesFileName = "scales"
+
+// metadataFileName is the file recording the user metadata of a bucket in
+// its directory, as a JSON object
+const metadataFileName = "metadata"
+
+// sequencedFileName is the empty file marking a bucket whose records are
+// keyed by their time and their Sequence in its directory
+const sequencedFileName = "sequenced"
+
 func NewDirectory(rootpath string) *Directory {
 	d := &Directory{
 		// Directmap will point to each directory node using a composite key
@@ -175,6 +216,36 @@ func (dRoot *Directory) RemoveTimeBucket(tbk *io.TimeBucketKey) (err error) {
 	return nil
 }
 
+func (dRoot *Directory) RenameSubDir(from, to string) (err error) {
+	/*
+		Renames an item of the top level, e.g. a symbol, along with all of the
+		items below it. The directory is renamed in a single step, so the item
+		is found either under the old or the new name on disk.
+	*/
+	dRoot.Lock()
+	defer dRoot.Unlock()
+	subDir, ok := dRoot.subDirs[from]
+	if !ok {
+		return fmt.Errorf("Unable to find level item: " + from + " in directory")
+	}
+	if _, ok := dRoot.subDirs[to]; ok {
+		return FileAlreadyExists("Can not overwrite item " + to)
+	}
+	oldPath := subDir.pathToItemName
+	newPath := filepath.Join(dRoot.GetPath(), to)
+	if err = os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+	}
+	for key := range dRoot.directMap {
+		if key == oldPath || strings.HasPrefix(key, oldPath+"/") {
+			delete(dRoot.directMap, key)
+		}
+	}
+	delete(dRoot.subDirs, from)
+	dRoot.addSubdir(NewDirectory(newPath), to)
+	return nil
+}
+
 func (d *Directory) GetTimeBucketInfoSlice() (tbinfolist []*io.TimeBucketInfo) {
 	// Returns a list of fileinfo for all datafiles in this directory or nil if there are none
 	d.RLock()
@@ -251,6 +322,237 @@ func (d *Directory) PathToTimeBucketInfo(path string) (*io.TimeBucketInfo, error
 	}
 }
 
+// GetTimezone returns the name of the timezone recorded for the bucket, or
+// an empty string if none is
+func (d *Directory) GetTimezone(key *io.TimeBucketKey) (string, error) {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return "", err
+	}
+	subDir.RLock()
+	defer subDir.RUnlock()
+	return subDir.timezone, nil
+}
+
+// SetTimezone records the name of the timezone of the bucket in its
+// directory, or removes the record if the name is empty
+func (d *Directory) SetTimezone(key *io.TimeBucketKey, name string) error {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return err
+	}
+	subDir.Lock()
+	defer subDir.Unlock()
+	tzFile := filepath.Join(subDir.pathToItemName, timezoneFileName)
+	if name == "" {
+		err = os.Remove(tzFile)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = ioutil.WriteFile(tzFile, []byte(name), 0770)
+	}
+	if err != nil {
+		return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+	}
+	subDir.timezone = name
+	return nil
+}
+
+// GetStringDictionary returns the dictionary of the string columns of the
+// bucket, loading it from its directory on first use
+func (d *Directory) GetStringDictionary(key *io.TimeBucketKey) (*io.StringDictionary, error) {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return nil, err
+	}
+	subDir.Lock()
+	defer subDir.Unlock()
+	if subDir.stringDict == nil {
+		sd, err := io.OpenStringDictionary(filepath.Join(subDir.pathToItemName, stringsFileName))
+		if err != nil {
+			return nil, fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+		}
+		subDir.stringDict = sd
+	}
+	return subDir.stringDict, nil
+}
+
+// GetScales returns the decimal places of the DECIMAL columns of the
+// bucket by name, recorded by SetScales, 0 for the others
+func (d *Directory) GetScales(key *io.TimeBucketKey) (map[string]int, error) {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return nil, err
+	}
+	subDir.RLock()
+	defer subDir.RUnlock()
+	scales := make(map[string]int, len(subDir.scales))
+	for name, scale := range subDir.scales {
+		scales[name] = scale
+	}
+	return scales, nil
+}
+
+// SetScales records the decimal places of the DECIMAL columns of the bucket
+// in its directory, set when it is created as they cannot change
+func (d *Directory) SetScales(key *io.TimeBucketKey, scales map[string]int) error {
+	for _, scale := range scales {
+		if err := io.ValidScale(scale); err != nil {
+			return err
+		}
+	}
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return err
+	}
+	subDir.Lock()
+	defer subDir.Unlock()
+	data, err := json.Marshal(scales)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(subDir.pathToItemName, scalesFileName), data, 0770); err != nil {
+		return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+	}
+	subDir.scales = make(map[string]int, len(scales))
+	for name, scale := range scales {
+		subDir.scales[name] = scale
+	}
+	return nil
+}
+
+// GetSequenced returns true if the records of the bucket are keyed by their
+// time and their Sequence, recorded by SetSequenced
+func (d *Directory) GetSequenced(key *io.TimeBucketKey) (bool, error) {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return false, err
+	}
+	subDir.RLock()
+	defer subDir.RUnlock()
+	return subDir.sequenced, nil
+}
+
+// SetSequenced records in the directory of the bucket that its records are
+// keyed by their time and their Sequence, set when it is created as it
+// cannot change
+func (d *Directory) SetSequenced(key *io.TimeBucketKey) error {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return err
+	}
+	subDir.Lock()
+	defer subDir.Unlock()
+	if err = ioutil.WriteFile(filepath.Join(subDir.pathToItemName, sequencedFileName), nil, 0770); err != nil {
+		return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+	}
+	subDir.sequenced = true
+	return nil
+}
+
+// GetMetadata returns the user metadata of the bucket, recorded by
+// SetMetadata
+func (d *Directory) GetMetadata(key *io.TimeBucketKey) (map[string]string, error) {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return nil, err
+	}
+	subDir.RLock()
+	defer subDir.RUnlock()
+	metadata := make(map[string]string, len(subDir.metadata))
+	for name, value := range subDir.metadata {
+		metadata[name] = value
+	}
+	return metadata, nil
+}
+
+// SetMetadata records the user metadata of the bucket in its directory,
+// replacing the previous one, or removes the record if it is empty
+func (d *Directory) SetMetadata(key *io.TimeBucketKey, metadata map[string]string) error {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return err
+	}
+	subDir.Lock()
+	defer subDir.Unlock()
+	mdFile := filepath.Join(subDir.pathToItemName, metadataFileName)
+	if len(metadata) == 0 {
+		err = os.Remove(mdFile)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		var data []byte
+		if data, err = json.Marshal(metadata); err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(mdFile, data, 0770)
+	}
+	if err != nil {
+		return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+	}
+	subDir.metadata = make(map[string]string, len(metadata))
+	for name, value := range metadata {
+		subDir.metadata[name] = value
+	}
+	return nil
+}
+
+// RenameColumn renames a column of the bucket in the header of every one of
+// its year files, along with its scale if it is a DECIMAL column.  If a
+// header fails to be written, the ones already written are restored.
+func (d *Directory) RenameColumn(key *io.TimeBucketKey, from, to string) error {
+	subDir, err := d.GetOwningSubDirectory(key.GetPathToYearFiles(d.pathToItemName) + "/1970.bin")
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(to, "Epoch") {
+		return fmt.Errorf("column Epoch already exists in %s", key.String())
+	}
+	subDir.Lock()
+	index := -1
+	for _, fi := range subDir.datafile {
+		for i, name := range fi.GetElementNames() {
+			if name == from {
+				index = i
+			} else if strings.EqualFold(name, to) {
+				subDir.Unlock()
+				return fmt.Errorf("column %s already exists in %s", to, key.String())
+			}
+		}
+		break
+	}
+	if index < 0 {
+		subDir.Unlock()
+		return fmt.Errorf("no column %s in %s", from, key.String())
+	}
+	renamed := []*io.TimeBucketInfo{}
+	for _, fi := range subDir.datafile {
+		if err = fi.SetElementName(index, to); err != nil {
+			for _, done := range renamed {
+				done.SetElementName(index, from)
+			}
+			subDir.Unlock()
+			return fmt.Errorf("failed to rename column %s of %s: %v", from, fi.Path, err)
+		}
+		renamed = append(renamed, fi)
+	}
+	scale, decimal := subDir.scales[from]
+	subDir.Unlock()
+
+	if decimal {
+		scales, err := d.GetScales(key)
+		if err != nil {
+			return err
+		}
+		delete(scales, from)
+		scales[strings.Title(to)] = scale
+		return d.SetScales(key, scales)
+	}
+	return nil
+}
+
 func (d *Directory) GetDataShapes(key *io.TimeBucketKey) (dsv []io.DataShape, err error) {
 	fi, err := d.GetLatestTimeBucketInfoFromKey(key)
 	if err != nil {
@@ -304,6 +606,32 @@ func (subDir *Directory) AddFile(newYear int16) (finfo_p *io.TimeBucketInfo, err
 	return newFileInfo, nil
 }
 
+func (subDir *Directory) RemoveFile(year int16) (err error) {
+	// Must be thread-safe for WRITE access
+	/*
+	 Removes the primary storage file for the provided year from this directory
+	 Returns:
+	  - error if the directory has no file for the year, or only this one
+	    as the time bucket needs one to stay initialized
+
+	 !!! NOTE !!! This should be called from the subdirectory that "owns" the file
+	*/
+	subDir.Lock()
+	defer subDir.Unlock()
+	filePath := path.Join(subDir.pathToItemName, strconv.Itoa(int(year))+".bin")
+	if _, ok := subDir.datafile[filePath]; !ok {
+		return NotFoundError(filePath)
+	}
+	if len(subDir.datafile) == 1 {
+		return fmt.Errorf("Can not remove the only year file %s", filePath)
+	}
+	if err = os.Remove(filePath); err != nil {
+		return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+	}
+	delete(subDir.datafile, filePath)
+	return nil
+}
+
 func (d *Directory) DirHasDataFiles() bool {
 	d.RLock()
 	defer d.RUnlock()
@@ -576,6 +904,22 @@ func (d *Directory) load(rootPath string) error {
 			return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
 		}
 		d.category = string(catname)
+		if tz, err := ioutil.ReadFile(filepath.Join(subPath, timezoneFileName)); err == nil {
+			d.timezone = strings.TrimSpace(string(tz))
+		}
+		if scales, err := ioutil.ReadFile(filepath.Join(subPath, scalesFileName)); err == nil {
+			if err = json.Unmarshal(scales, &d.scales); err != nil {
+				return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+			}
+		}
+		if metadata, err := ioutil.ReadFile(filepath.Join(subPath, metadataFileName)); err == nil {
+			if err = json.Unmarshal(metadata, &d.metadata); err != nil {
+				return fmt.Errorf(io.GetCallerFileContext(0) + err.Error())
+			}
+		}
+		if _, err := os.Stat(filepath.Join(subPath, sequencedFileName)); err == nil {
+			d.sequenced = true
+		}
 
 		// Load up the child directories
 		d.subDirs = make(DMap)
@@ -288,6 +288,136 @@ func (s *TestSuite) TestCreateNewDirectory(c *C) {
 	c.Assert(err == nil, Equals, true)
 }
 
+func (s *TestSuite) TestRenameSubDirAndRemoveFile(c *C) {
+	rootDir := c.MkDir()
+	MakeDummyCurrencyDir(rootDir, false, false)
+	d := NewDirectory(rootDir)
+
+	err := d.RenameSubDir("EURUSD", "USDJPY")
+	c.Assert(err, NotNil)
+	err = d.RenameSubDir("NOSUCH", "TEST")
+	c.Assert(err, NotNil)
+
+	err = d.RenameSubDir("EURUSD", "TEST")
+	c.Assert(err, IsNil)
+	c.Assert(d.GetSubDirWithItemName("EURUSD"), IsNil)
+	c.Assert(d.GetSubDirWithItemName("TEST"), NotNil)
+	c.Assert(exists(path.Join(rootDir, "EURUSD")), Equals, false)
+	c.Assert(len(d.directMap), Equals, 18)
+	filePath := path.Join(rootDir, "TEST", "1Min", "OHLC", "2001.bin")
+	fileInfo, err := d.PathToTimeBucketInfo(filePath)
+	c.Assert(err, IsNil)
+	c.Assert(fileInfo.Path, Equals, filePath)
+	_, err = d.GetOwningSubDirectory(path.Join(rootDir, "EURUSD", "1Min", "OHLC", "2001.bin"))
+	c.Assert(err, NotNil)
+
+	subDir, err := d.GetOwningSubDirectory(filePath)
+	c.Assert(err, IsNil)
+	c.Assert(subDir.RemoveFile(2001), IsNil)
+	c.Assert(exists(filePath), Equals, false)
+	c.Assert(subDir.RemoveFile(2001), NotNil)
+	c.Assert(subDir.RemoveFile(2000), IsNil)
+	// the last year file is kept
+	c.Assert(subDir.RemoveFile(2002), NotNil)
+	c.Assert(subDir.GetTimeBucketInfoSlice(), HasLen, 1)
+}
+
+func (s *TestSuite) TestTimezone(c *C) {
+	rootDir := c.MkDir()
+	MakeDummyCurrencyDir(rootDir, false, false)
+	d := NewDirectory(rootDir)
+	tbk := io.NewTimeBucketKey("USDJPY/1Min/OHLC")
+
+	name, err := d.GetTimezone(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, "")
+	c.Assert(d.SetTimezone(tbk, "Asia/Tokyo"), IsNil)
+	name, _ = d.GetTimezone(tbk)
+	c.Assert(name, Equals, "Asia/Tokyo")
+	_, err = d.GetTimezone(io.NewTimeBucketKey("NOSUCH/1Min/OHLC"))
+	c.Assert(err, NotNil)
+
+	// recorded along with the year files
+	name, _ = NewDirectory(rootDir).GetTimezone(tbk)
+	c.Assert(name, Equals, "Asia/Tokyo")
+	c.Assert(d.SetTimezone(tbk, ""), IsNil)
+	c.Assert(d.SetTimezone(tbk, ""), IsNil)
+	name, _ = NewDirectory(rootDir).GetTimezone(tbk)
+	c.Assert(name, Equals, "")
+}
+
+func (s *TestSuite) TestMetadata(c *C) {
+	rootDir := c.MkDir()
+	MakeDummyCurrencyDir(rootDir, false, false)
+	d := NewDirectory(rootDir)
+	tbk := io.NewTimeBucketKey("USDJPY/1Min/OHLC")
+
+	metadata, err := d.GetMetadata(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(metadata, HasLen, 0)
+	c.Assert(d.SetMetadata(tbk, map[string]string{"source": "oanda", "units": "JPY"}), IsNil)
+	metadata, _ = d.GetMetadata(tbk)
+	c.Assert(metadata, DeepEquals, map[string]string{"source": "oanda", "units": "JPY"})
+
+	// recorded along with the year files
+	metadata, _ = NewDirectory(rootDir).GetMetadata(tbk)
+	c.Assert(metadata["source"], Equals, "oanda")
+	c.Assert(d.SetMetadata(tbk, nil), IsNil)
+	c.Assert(d.SetMetadata(tbk, nil), IsNil)
+	metadata, _ = NewDirectory(rootDir).GetMetadata(tbk)
+	c.Assert(metadata, HasLen, 0)
+}
+
+func (s *TestSuite) TestSequenced(c *C) {
+	rootDir := c.MkDir()
+	MakeDummyCurrencyDir(rootDir, false, false)
+	d := NewDirectory(rootDir)
+	tbk := io.NewTimeBucketKey("USDJPY/1Min/OHLC")
+	sequenced, err := d.GetSequenced(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(sequenced, Equals, false)
+	c.Assert(d.SetSequenced(tbk), IsNil)
+	sequenced, _ = d.GetSequenced(tbk)
+	c.Assert(sequenced, Equals, true)
+
+	// recorded along with the year files
+	sequenced, _ = NewDirectory(rootDir).GetSequenced(tbk)
+	c.Assert(sequenced, Equals, true)
+	sequenced, _ = NewDirectory(rootDir).GetSequenced(io.NewTimeBucketKey("EURUSD/1Min/OHLC"))
+	c.Assert(sequenced, Equals, false)
+}
+
+func (s *TestSuite) TestRenameColumn(c *C) {
+	rootDir := c.MkDir()
+	MakeDummyCurrencyDir(rootDir, false, false)
+	d := NewDirectory(rootDir)
+	tbk := io.NewTimeBucketKey("USDJPY/1Min/OHLC")
+	c.Assert(d.SetScales(tbk, map[string]int{"Close": 3}), IsNil)
+
+	c.Assert(d.RenameColumn(tbk, "Close", "last"), IsNil)
+	tbi, err := d.GetLatestTimeBucketInfoFromKey(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(tbi.GetElementNames(), DeepEquals, []string{"Open", "High", "Low", "Last"})
+	scales, _ := d.GetScales(tbk)
+	c.Assert(scales, DeepEquals, map[string]int{"Last": 3})
+
+	// in the headers of every year file
+	reloaded := NewDirectory(rootDir)
+	for _, tbi := range reloaded.GetSubDirWithItemName("USDJPY").GetSubDirWithItemName("1Min").
+		GetSubDirWithItemName("OHLC").GetTimeBucketInfoSlice() {
+		c.Assert(tbi.GetElementNames(), DeepEquals, []string{"Open", "High", "Low", "Last"})
+	}
+	scales, _ = reloaded.GetScales(tbk)
+	c.Assert(scales, DeepEquals, map[string]int{"Last": 3})
+
+	c.Assert(d.RenameColumn(tbk, "Close", "Final"), NotNil)
+	c.Assert(d.RenameColumn(tbk, "Last", "open"), NotNil)
+	c.Assert(d.RenameColumn(tbk, "Last", "Epoch"), NotNil)
+	c.Assert(d.RenameColumn(tbk, "Last", "ThisColumnNameIsLongerThan32Bytes"), NotNil)
+	tbi, _ = d.GetLatestTimeBucketInfoFromKey(tbk)
+	c.Assert(tbi.GetElementNames(), DeepEquals, []string{"Open", "High", "Low", "Last"})
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	if err == nil {
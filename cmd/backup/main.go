@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Command
+	// -------------
+	usage   = "backup <dest>"
+	short   = "Back up a running marketstore database"
+	long    = "This command copies the files of a database into a directory as of a single point in time while the instance keeps running, holding its writes meanwhile, with a manifest verified on restore. The directory is on the host of the instance and must not exist or be empty."
+	example = "marketstore backup --url localhost:5993 /backup/mktsdb-2019-06-01"
+
+	// Flags.
+	// -------------
+	// Network Address.
+	urlFlag    = "url"
+	defaultURL = "localhost:5993"
+	urlDesc    = "network address to database instance at \"hostname:port\""
+	// API key.
+	apiKeyFlag    = "api_key"
+	defaultAPIKey = ""
+	apiKeyDesc    = "API key sent to the database instance"
+	// Local directory.
+	dirFlag    = "dir"
+	defaultDir = ""
+	dirDesc    = "filesystem path of the directory containing database files of a stopped instance, instead of the instance at url"
+)
+
+var (
+	// Cmd is the backup command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    cobra.ExactArgs(1),
+		RunE:    executeBackup,
+	}
+
+	// url set via flag for remote db address.
+	url string
+	// apiKey set via flag for remote db authentication.
+	apiKey string
+	// dir set via flag for local directory location.
+	dir string
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&url, urlFlag, "u", defaultURL, urlDesc)
+	Cmd.Flags().StringVarP(&apiKey, apiKeyFlag, "k", defaultAPIKey, apiKeyDesc)
+	Cmd.Flags().StringVarP(&dir, dirFlag, "d", defaultDir, dirDesc)
+}
+
+// executeBackup implements the backup command.
+func executeBackup(cmd *cobra.Command, args []string) error {
+	dest := args[0]
+	if strings.Contains(dest, "://") {
+		return errors.New("the backup must be a directory path, upload it to object storage afterwards")
+	}
+	location := url
+	if dir != "" {
+		location = dir
+		// the destination is relative to this process rather than the instance
+		if abs, err := filepath.Abs(dest); err == nil {
+			dest = abs
+		}
+	}
+	var response frontend.BackupResponse
+	if err := endpoint.New(location, apiKey).Call("Backup", &frontend.BackupArgs{Dest: dest}, &response); err != nil {
+		return err
+	}
+	fmt.Printf("%d files, %d bytes backed up to %s as of %s\n", response.Files, response.Bytes, dest,
+		time.Unix(response.Created, 0).UTC().Format(time.RFC3339))
+	return nil
+}
@@ -1,9 +1,13 @@
 package loader
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/alpacahq/marketstore/utils/io"
 	. "gopkg.in/check.v1"
 )
 
@@ -46,3 +50,64 @@ func (s *LoaderTests) TestParseTimestamp(c *C) {
 	c.Assert(err == nil, Equals, true)
 	c.Assert(tt1 == tTest, Equals, true)
 }
+
+func (s *LoaderTests) TestBucketKey(c *C) {
+	conf := &CSVConfig{Bucket: "{symbol}/1Min/OHLCV"}
+	tbk, err := conf.BucketKey("/data/aapl.csv")
+	c.Assert(err, IsNil)
+	c.Assert(tbk.GetItemKey(), Equals, "AAPL/1Min/OHLCV")
+
+	conf.SymbolPattern = "^([A-Za-z]+)_"
+	tbk, err = conf.BucketKey("TSLA_2017.csv")
+	c.Assert(err, IsNil)
+	c.Assert(tbk.GetItemKey(), Equals, "TSLA/1Min/OHLCV")
+	_, err = conf.BucketKey("2017.csv")
+	c.Assert(err, NotNil)
+
+	_, err = (&CSVConfig{}).BucketKey("TSLA.csv")
+	c.Assert(err, NotNil)
+}
+
+func (s *LoaderTests) TestMapping(c *C) {
+	dataFile := filepath.Join(c.MkDir(), "TSLA.csv")
+	err := ioutil.WriteFile(dataFile, []byte(
+		"Date,Last,Vol,Halted\n"+
+			"2017-01-03 09:30,216.5,\"1,200\",n\n"+
+			"2017-01-03 09:31,217,,yes\n"), 0600)
+	c.Assert(err, IsNil)
+	dataFD, err := os.Open(dataFile)
+	c.Assert(err, IsNil)
+	defer dataFD.Close()
+
+	conf := &CSVConfig{
+		FirstRowHasColumnNames: true,
+		TimeFormat:             "2006-01-02 15:04",
+		Rename:                 map[string]string{"last": "Close", "Vol": "Volume"},
+		TimeColumn:             "Date",
+		Coerce:                 map[string]string{"Volume": NumberCoercion, "Halted": BoolCoercion},
+	}
+	dsv := []io.DataShape{
+		{Name: "Epoch", Type: io.INT64},
+		{Name: "Close", Type: io.FLOAT32},
+		{Name: "Volume", Type: io.INT32},
+		{Name: "Halted", Type: io.BYTE},
+	}
+	csvReader, cvm, err := ReadMetadata(dataFD, conf, dsv)
+	c.Assert(err, IsNil)
+
+	tbk := io.NewTimeBucketKey("TSLA/1Min/OHLCV")
+	npm, _, err := CSVtoNumpyMulti(csvReader, *tbk, cvm, 10, false)
+	c.Assert(err, IsNil)
+	csm, err := npm.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	cs := csm[*tbk]
+	c.Assert(cs.GetEpoch(), DeepEquals, []int64{1483435800, 1483435860})
+	c.Assert(cs.GetByName("Close"), DeepEquals, []float32{216.5, 217})
+	c.Assert(cs.GetByName("Volume"), DeepEquals, []int32{1200, 0})
+	c.Assert(cs.GetByName("Halted"), DeepEquals, []int8{0, 1})
+
+	conf.Coerce["Close"] = "percent"
+	dataFD.Seek(0, 0)
+	_, _, err = ReadMetadata(dataFD, conf, dsv)
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,149 @@
+package loader
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// Coercions of the values of a column before they are parsed as its type
+const (
+	// NumberCoercion parses the values as decimal numbers, without their
+	// thousands separators, truncating them for the integer columns.  Empty
+	// values are zeros.
+	NumberCoercion = "number"
+	// BoolCoercion parses yes/no, y/n and on/off as well, empty values being
+	// false, as 1 or 0 for the numeric columns.
+	BoolCoercion = "bool"
+)
+
+// BucketKey returns the key of the bucket the file is loaded into, the
+// symbol of the bucket template being extracted from the file name.
+func (cf *CSVConfig) BucketKey(fileName string) (*io.TimeBucketKey, error) {
+	if cf.Bucket == "" {
+		return nil, fmt.Errorf("no bucket set in the loader control file")
+	}
+	base := filepath.Base(fileName)
+	symbol := strings.TrimSuffix(base, filepath.Ext(base))
+	if cf.SymbolPattern != "" {
+		re, err := regexp.Compile(cf.SymbolPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symbol pattern (%v)", err)
+		}
+		match := re.FindStringSubmatch(base)
+		if len(match) < 2 || match[1] == "" {
+			return nil, fmt.Errorf("no symbol matching %s in %s", cf.SymbolPattern, base)
+		}
+		symbol = match[1]
+	}
+	key := strings.Replace(cf.Bucket, "{symbol}", strings.ToUpper(symbol), -1)
+	if len(strings.Split(key, "/")) != 3 {
+		return nil, fmt.Errorf("bucket %s is not a Symbol/Timeframe/RecordFormat key", key)
+	}
+	return io.NewTimeBucketKey(key), nil
+}
+
+// renameColumns renames the input columns to the DB columns they hold
+func renameColumns(inputColNames []string, conf *CSVConfig) {
+	for i, name := range inputColNames {
+		if conf.TimeColumn != "" && strings.EqualFold(name, conf.TimeColumn) {
+			inputColNames[i] = "Epoch"
+			continue
+		}
+		for from, to := range conf.Rename {
+			if strings.EqualFold(name, from) {
+				inputColNames[i] = to
+			}
+		}
+	}
+}
+
+// checkCoercions returns an error if a coercion is unknown, or not of a
+// loaded column
+func checkCoercions(cvm *CSVMetadata) error {
+	for name, coercion := range cvm.Config.Coerce {
+		if coercion != NumberCoercion && coercion != BoolCoercion {
+			return fmt.Errorf("unknown coercion %s of column %s", coercion, name)
+		}
+		found := false
+		for _, ds := range cvm.DSV {
+			found = found || strings.EqualFold(ds.Name, name)
+		}
+		if !found {
+			return fmt.Errorf("coerced column %s is not a DB column", name)
+		}
+	}
+	return nil
+}
+
+// coerceColumns rewrites the values of the coerced columns of the rows in
+// the format parsed for their type
+func coerceColumns(cvm *CSVMetadata, csvRows [][]string) error {
+	for i, ds := range cvm.DSV {
+		var coercion string
+		for name, c := range cvm.Config.Coerce {
+			if strings.EqualFold(ds.Name, name) {
+				coercion = c
+			}
+		}
+		if coercion == "" {
+			continue
+		}
+		index := cvm.ColumnIndex[i+2]
+		for _, row := range csvRows {
+			value, err := coerce(row[index], coercion, ds.Type)
+			if err != nil {
+				return fmt.Errorf("failed to coerce %q of column %s (%v)", row[index], ds.Name, err)
+			}
+			row[index] = value
+		}
+	}
+	return nil
+}
+
+func coerce(value, coercion string, typ io.EnumElementType) (string, error) {
+	value = strings.TrimSpace(value)
+	switch coercion {
+	case NumberCoercion:
+		value = strings.Replace(value, ",", "", -1)
+		if value == "" {
+			return "0", nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", err
+		}
+		switch typ {
+		case io.FLOAT32, io.FLOAT64, io.DECIMAL:
+			return value, nil
+		case io.BOOL, io.BIT:
+			return strconv.FormatBool(f != 0), nil
+		}
+		return strconv.FormatFloat(math.Trunc(f), 'f', -1, 64), nil
+	case BoolCoercion:
+		var b bool
+		switch strings.ToLower(value) {
+		case "", "n", "no", "off":
+		case "y", "yes", "on":
+			b = true
+		default:
+			var err error
+			if b, err = strconv.ParseBool(value); err != nil {
+				return "", err
+			}
+		}
+		if typ == io.BOOL || typ == io.BIT {
+			return strconv.FormatBool(b), nil
+		}
+		if b {
+			return "1", nil
+		}
+		return "0", nil
+	}
+	return value, nil
+}
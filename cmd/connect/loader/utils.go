@@ -18,6 +18,14 @@ type CSVConfig struct {
 	TimeFormat             string   `yaml:"timeFormat"`
 	Timezone               string   `yaml:"timeZone"`
 	ColumnNameMap          []string `yaml:"columnNameMap"`
+	// Mapping of the columns of vendor files to the DB columns
+	Rename     map[string]string `yaml:"rename"`     // input column name to DB column name
+	TimeColumn string            `yaml:"timeColumn"` // input column holding the Epoch
+	Coerce     map[string]string `yaml:"coerce"`     // DB column name to coercion
+	// Bucket key template of the files loaded without a key, {symbol} being
+	// replaced by the symbol extracted from the file name
+	Bucket        string `yaml:"bucket"`
+	SymbolPattern string `yaml:"symbolPattern"` // regexp with a group matching the symbol
 }
 
 type CSVMetadata struct {
@@ -66,8 +74,9 @@ func CSVtoNumpyMulti(csvReader *csv.Reader, tbk io.TimeBucketKey, cvm *CSVMetada
 }
 
 // ReadMetadata returns formatting info about the csv file containing
-// the data to be loaded into the database.
-func ReadMetadata(dataFD, controlFD *os.File, dbDataShapes []io.DataShape) (csvReader *csv.Reader, cvm *CSVMetadata, err error) {
+// the data to be loaded into the database, read as described by the
+// configuration of the loader control file if not nil.
+func ReadMetadata(dataFD *os.File, conf *CSVConfig, dbDataShapes []io.DataShape) (csvReader *csv.Reader, cvm *CSVMetadata, err error) {
 	fmt.Println("DB Data Shapes: ", dbDataShapes)
 
 	cvm = &CSVMetadata{}
@@ -89,12 +98,8 @@ func ReadMetadata(dataFD, controlFD *os.File, dbDataShapes []io.DataShape) (csvR
 		return nil, nil, err
 	}
 
-	if controlFD != nil {
-		// We have a loader control file, read the contents
-		cvm.Config, err = readControlFile(controlFD)
-		if err != nil {
-			return nil, nil, err
-		}
+	if conf != nil {
+		cvm.Config = conf
 	} else {
 		// Defaults.
 		cvm.Config = &CSVConfig{
@@ -170,6 +175,8 @@ func ReadMetadata(dataFD, controlFD *os.File, dbDataShapes []io.DataShape) (csvR
 		}
 	}
 
+	renameColumns(inputColNames, cvm.Config)
+
 	/*
 		Look for the columns needed in the input file by name (case independent)
 	*/
@@ -205,15 +212,20 @@ func ReadMetadata(dataFD, controlFD *os.File, dbDataShapes []io.DataShape) (csvR
 	if fail {
 		return nil, nil, fmt.Errorf("Unable to match all csv file columns to DB columns")
 	}
+	if err = checkCoercions(cvm); err != nil {
+		return nil, nil, err
+	}
 
 	return csvReader, cvm, nil
 }
 
 func convertCSVtoCSM(tbk io.TimeBucketKey, cvm *CSVMetadata, csvDataChunk [][]string) (csm io.ColumnSeriesMap, err error) {
+	if err = coerceColumns(cvm, csvDataChunk); err != nil {
+		return nil, err
+	}
 	epochCol, nanosCol := readTimeColumns(csvDataChunk, cvm.ColumnIndex, cvm.Config)
 	if epochCol == nil {
-		fmt.Println("Error building time columns from csv data")
-		return
+		return nil, fmt.Errorf("Error building time columns from csv data")
 	}
 
 	csmInit := io.NewColumnSeriesMap()
@@ -224,7 +236,8 @@ func convertCSVtoCSM(tbk io.TimeBucketKey, cvm *CSVMetadata, csvDataChunk [][]st
 	return csm, err
 }
 
-func readControlFile(controlFD *os.File) (cf *CSVConfig, err error) {
+// ReadControlFile returns the configuration of the loader control file.
+func ReadControlFile(controlFD *os.File) (cf *CSVConfig, err error) {
 	if controlFD == nil {
 		return
 	}
@@ -3,6 +3,7 @@ package loader
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/alpacahq/marketstore/utils/io"
 )
@@ -88,12 +89,19 @@ func columnSeriesMapFromCSVData(csmInit io.ColumnSeriesMap, key io.TimeBucketKey
 					return nil
 				}
 				csm.AddColumn(key, shape.Name, col)
-			case io.BOOL:
+			case io.BOOL, io.BIT:
 				col, err := getBoolColumnFromCSVRows(csvRows, index)
 				if columnError(err, shape.Name) {
 					return nil
 				}
 				csm.AddColumn(key, shape.Name, col)
+			case io.DECIMAL:
+				col, scale, err := getDecimalColumnFromCSVRows(csvRows, index)
+				if columnError(err, shape.Name) {
+					return nil
+				}
+				csm.AddColumn(key, shape.Name, col)
+				csm[key].SetScale(shape.Name, scale)
 
 			}
 
@@ -153,6 +161,27 @@ func getFloat64ColumnFromCSVRows(csvRows [][]string, index int) (col []float64,
 	return col, nil
 }
 
+// getDecimalColumnFromCSVRows parses the decimals of the column at the most
+// decimal places of its values, which are rounded to the scale of the bucket
+// by the write
+func getDecimalColumnFromCSVRows(csvRows [][]string, index int) (col []int64, scale int, err error) {
+	for _, row := range csvRows {
+		if dot := strings.IndexByte(row[index], '.'); dot >= 0 && len(row[index])-dot-1 > scale {
+			scale = len(row[index]) - dot - 1
+		}
+	}
+	if err = io.ValidScale(scale); err != nil {
+		return nil, 0, err
+	}
+	col = make([]int64, len(csvRows))
+	for i, row := range csvRows {
+		if col[i], err = io.ParseDecimal(row[index], scale); err != nil {
+			return nil, 0, err
+		}
+	}
+	return col, scale, nil
+}
+
 func getInt8ColumnFromCSVRows(csvRows [][]string, index int) (col []int8, err error) {
 	col = make([]int8, len(csvRows))
 	for i, row := range csvRows {
@@ -2,6 +2,7 @@ package connect
 
 import (
 	"errors"
+	"os"
 
 	"github.com/alpacahq/marketstore/cmd/connect/session"
 	"github.com/alpacahq/marketstore/utils"
@@ -15,7 +16,7 @@ const (
 	usage   = "connect"
 	short   = "Open an interactive session with an existing marketstore database"
 	long    = "This command opens an interactive session with an existing marketstore database"
-	example = "marketstore connect --url <address>"
+	example = "marketstore connect --url <address> [--file <script.sql>]"
 
 	// Flags.
 	// -------------
@@ -23,12 +24,29 @@ const (
 	urlFlag    = "url"
 	defaultURL = ""
 	urlDesc    = "network address to database instance at \"hostname:port\" when used in remote mode"
+	// API key.
+	apiKeyFlag    = "api_key"
+	defaultAPIKey = ""
+	apiKeyDesc    = "API key sent to the database instance when used in remote mode"
 	// Local directory.
 	dirFlag           = "dir"
 	defaultDir        = ""
 	dirDesc           = "filesystem path of the directory containing database files when used in local mode"
 	defaultVarCompOff = false
 	varCompOffDesc    = "disables the compression of variable data (on by default, uses snappy)"
+	// Output.
+	formatFlag    = "format"
+	defaultFormat = ""
+	formatDesc    = "format of the query results, table, csv or json (table to the terminal and csv to a file by default)"
+	outputFlag    = "output"
+	defaultOutput = ""
+	outputDesc    = "file the query results are written to instead of the terminal"
+	// Script.
+	fileFlag            = "file"
+	defaultFile         = ""
+	fileDesc            = "script of sql statements and backslash commands executed instead of opening an interactive session, - for the standard input"
+	continueOnErrorFlag = "continue_on_error"
+	continueOnErrorDesc = "execute the rest of the script after a statement fails, the exit status being an error still"
 )
 
 var (
@@ -45,16 +63,28 @@ var (
 
 	// url set via flag for remote db address.
 	url string
+	// apiKey set via flag for remote db authentication.
+	apiKey string
 	// dir set via flag for local directory location.
 	dir string
 	// turns compression of variable data off
 	varCompOff bool
+	// format and output file of the query results
+	format, output string
+	// script executed instead of the interactive session
+	file            string
+	continueOnError bool
 )
 
 func init() {
 	Cmd.Flags().StringVarP(&url, urlFlag, "u", defaultURL, urlDesc)
+	Cmd.Flags().StringVarP(&apiKey, apiKeyFlag, "k", defaultAPIKey, apiKeyDesc)
 	Cmd.Flags().StringVarP(&dir, dirFlag, "d", defaultDir, dirDesc)
 	Cmd.Flags().BoolVarP(&varCompOff, "disable_variable_compression", "c", defaultVarCompOff, varCompOffDesc)
+	Cmd.Flags().StringVarP(&format, formatFlag, "f", defaultFormat, formatDesc)
+	Cmd.Flags().StringVarP(&output, outputFlag, "o", defaultOutput, outputDesc)
+	Cmd.Flags().StringVar(&file, fileFlag, defaultFile, fileDesc)
+	Cmd.Flags().BoolVar(&continueOnError, continueOnErrorFlag, false, continueOnErrorDesc)
 }
 
 // validateArgs returns an error that prevents cmd execution if
@@ -85,18 +115,29 @@ func executeConnect(cmd *cobra.Command, args []string) error {
 
 	// Attempt remote mode.
 	if len(url) != 0 {
-		c, err = session.NewRemoteClient(url)
+		c, err = session.NewRemoteClient(url, apiKey)
 		if err != nil {
 			return err
 		}
 	}
 
+	if err = c.SetOutput(format, output); err != nil {
+		return err
+	}
+
 	// Initialize connection.
 	err = c.Connect()
 	if err != nil {
 		return err
 	}
 
+	// Execute the script.
+	if file != "" {
+		// the errors are those of the statements, rather than of the usage
+		cmd.SilenceUsage = true
+		return runScript(c)
+	}
+
 	// Enter command loop
 	err = c.Read()
 	if err != nil {
@@ -106,3 +147,16 @@ func executeConnect(cmd *cobra.Command, args []string) error {
 	log.Info("closed connection")
 	return nil
 }
+
+// runScript executes the script file, or the standard input.
+func runScript(c *session.Client) error {
+	if file == "-" {
+		return c.RunScript(os.Stdin, "stdin", continueOnError)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.RunScript(f, file, continueOnError)
+}
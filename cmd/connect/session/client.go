@@ -5,11 +5,14 @@
 package session
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -17,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/alpacahq/marketstore/executor"
 	"github.com/alpacahq/marketstore/frontend/client"
@@ -34,6 +38,14 @@ const (
 	remote
 )
 
+// Output formats of the query results.
+const (
+	TableFormat    = "table"
+	CSVFormat      = "csv"
+	JSONFormat     = "json"
+	VerticalFormat = "vertical"
+)
+
 // Client represents an agent that manages a database
 // connection and parses/executes the statements specified by a
 // user in a command-line buffer.
@@ -42,10 +54,21 @@ type Client struct {
 	timing bool
 	// output target - if empty, output to terminal, filename to output to file
 	target string
+	// format of the query results, see SetOutput
+	format string
+	// width of the columns of the tables, fit to their values if 0
+	width int
+	// digits after the point of the floats displayed, the fewest
+	// representing them if negative
+	precision int
+	// pager determines to page the results written to the terminal.
+	pager bool
 	// mode determines local or remote.
 	mode mode
 	// url is the optional address of a db instance on a different machine.
 	url string
+	// apiKey is the optional key sent to a remote instance.
+	apiKey string
 	// rc is the optional remote client.
 	rc *client.Client
 	// dir is the optional filesystem location of a local db instance.
@@ -58,11 +81,11 @@ func NewLocalClient(dir string) (c *Client, err error) {
 	initCatalog, initWALCache, backgroundSync, WALBypass := true, true, false, true
 	utils.InstanceConfig.WALRotateInterval = 5
 	executor.NewInstanceSetup(dir, initCatalog, initWALCache, backgroundSync, WALBypass)
-	return &Client{dir: dir, mode: local}, nil
+	return &Client{dir: dir, mode: local, precision: -1}, nil
 }
 
 // NewRemoteClient generates a new client struct.
-func NewRemoteClient(url string) (c *Client, err error) {
+func NewRemoteClient(url, apiKey string) (c *Client, err error) {
 	// TODO: validate url using go core packages.
 	splits := strings.Split(url, ":")
 	if len(splits) != 2 {
@@ -71,7 +94,7 @@ func NewRemoteClient(url string) (c *Client, err error) {
 	}
 	// build url.
 	url = "http://" + url
-	return &Client{url: url, mode: remote}, nil
+	return &Client{url: url, apiKey: apiKey, mode: remote, precision: -1}, nil
 }
 
 // Connect initializes a client connection.
@@ -86,17 +109,33 @@ func (c *Client) Connect() error {
 	if err != nil {
 		return err
 	}
+	client.APIKey = c.apiKey
 	c.rc = client
 
 	// Success.
 	return nil
 }
 
+// SetOutput sets the format of the query results, one of table, csv, json or
+// vertical, and the file they are written to, the terminal if empty.
+func (c *Client) SetOutput(format, target string) error {
+	switch strings.ToLower(format) {
+	case "", TableFormat, CSVFormat, JSONFormat, VerticalFormat:
+	case "parquet":
+		return errors.New("parquet output is not supported, use csv or json")
+	default:
+		return fmt.Errorf("unknown output format %s, must be one of table, csv, json or vertical", format)
+	}
+	c.format = strings.ToLower(format)
+	c.target = target
+	return nil
+}
+
 // Read kicks off the buffer reading process.
 func (c *Client) Read() error {
 
 	// Build reader.
-	r, err := newReader()
+	r, err := newReader(&completer{c: c})
 	if err != nil {
 		return err
 	}
@@ -110,6 +149,9 @@ func (c *Client) Read() error {
 	}
 	fmt.Fprintf(os.Stderr, "Type `\\help` to see command options\n")
 
+	// Page the long results written to the terminal.
+	c.pager = readline.IsTerminal(int(os.Stdout.Fd()))
+
 	// User input evaluation loop.
 EVAL:
 	for {
@@ -132,53 +174,67 @@ EVAL:
 			continue
 		}
 
-		// Remove leading/trailing spaces.
-		line = strings.Trim(line, " ")
-
-		// Evaulate.
-		switch {
-		// Flip timing flag.
-		case strings.HasPrefix(line, "\\o"):
-			args := strings.Split(line, " ")
-			if len(args) > 1 {
-				c.target = args[1]
-			} else {
-				c.target = ""
-			}
-		case strings.HasPrefix(line, "\\timing"):
-			c.timing = !c.timing
-		case strings.HasPrefix(line, "\\show"):
-			c.show(line)
-		case strings.HasPrefix(line, "\\trim"):
-			c.trim(line)
-		case strings.HasPrefix(line, "\\load"):
-			c.load(line)
-		case strings.HasPrefix(line, "\\create"):
-			c.create(line)
-		case strings.HasPrefix(line, "\\destroy"):
-			c.destroy(line)
-		case strings.HasPrefix(line, "\\getinfo"):
-			c.getinfo(line)
-		case strings.HasPrefix(line, "\\help") || strings.HasPrefix(line, "\\?"):
-			c.functionHelp(line)
-		case line == "help":
-			c.functionHelp("\\help")
-		// Quit.
-		case line == "\\stop", line == "\\quit", line == "\\q", line == "exit":
+		// Evaluate.
+		quit, err := c.execute(strings.Trim(line, " "))
+		if err != nil {
+			fmt.Println(err)
+		}
+		if quit {
 			break EVAL
-			// Nothing to do.
-		case line == "":
-			continue EVAL
-		// It was a sql stmt.
-		default:
-			c.sql(line)
 		}
 	}
 
 	return nil
 }
 
-func newReader() (*readline.Instance, error) {
+// execute evaluates a line, a backslash command or a sql statement, and
+// returns whether it quits the session.  Only the errors of the sql
+// statements and display settings are returned, the other commands printing
+// theirs.
+func (c *Client) execute(line string) (quit bool, err error) {
+	switch {
+	case strings.HasPrefix(line, "\\o"):
+		args := strings.Split(line, " ")
+		if len(args) > 1 {
+			c.target = args[1]
+		} else {
+			c.target = ""
+		}
+	// Flip timing flag.
+	case strings.HasPrefix(line, "\\timing"):
+		c.timing = !c.timing
+	case strings.HasPrefix(line, "\\show"):
+		c.show(line)
+	case strings.HasPrefix(line, "\\trim"):
+		c.trim(line)
+	case strings.HasPrefix(line, "\\load"):
+		c.load(line)
+	case strings.HasPrefix(line, "\\create"):
+		c.create(line)
+	case strings.HasPrefix(line, "\\destroy"):
+		c.destroy(line)
+	case strings.HasPrefix(line, "\\getinfo"):
+		c.getinfo(line)
+	case strings.HasPrefix(line, "\\format"), strings.HasPrefix(line, "\\width"),
+		strings.HasPrefix(line, "\\precision"), strings.HasPrefix(line, "\\pager"):
+		return false, c.setDisplay(line)
+	case strings.HasPrefix(line, "\\help") || strings.HasPrefix(line, "\\?"):
+		c.functionHelp(line)
+	case line == "help":
+		c.functionHelp("\\help")
+	// Quit.
+	case line == "\\stop", line == "\\quit", line == "\\q", line == "exit":
+		return true, nil
+	// Nothing to do.
+	case line == "":
+	// It was a sql stmt.
+	default:
+		return false, c.Query(line)
+	}
+	return false, nil
+}
+
+func newReader(autoComplete readline.AutoCompleter) (*readline.Instance, error) {
 	// Determine history file path.
 	usr, err := user.Current()
 	if err != nil {
@@ -186,69 +242,25 @@ func newReader() (*readline.Instance, error) {
 	}
 	history := filepath.Join(usr.HomeDir, ".marketstoreReaderHistory")
 
-	// Register commands with autocompletion.
-	autoComplete := readline.NewPrefixCompleter(
-		readline.PcItem("\\show"),
-		readline.PcItem("\\load"),
-		readline.PcItem("\\create"),
-		readline.PcItem("\\trim"),
-		readline.PcItem("\\help"),
-		readline.PcItem("\\exit"),
-		readline.PcItem("\\quit"),
-		readline.PcItem("\\q"),
-		readline.PcItem("\\?"),
-		readline.PcItem("\\stop"),
-	)
-
 	// Build config.
 	config := &readline.Config{
-		Prompt:          "\033[31m»\033[0m ",
-		HistoryFile:     history,
-		AutoComplete:    autoComplete,
-		InterruptPrompt: "\nInterrupt, Press Ctrl+D to exit",
-		EOFPrompt:       "exit",
+		Prompt:            "\033[31m»\033[0m ",
+		HistoryFile:       history,
+		HistorySearchFold: true,
+		AutoComplete:      autoComplete,
+		InterruptPrompt:   "\nInterrupt, Press Ctrl+D to exit",
+		EOFPrompt:         "exit",
 	}
 
 	// return reader.
 	return readline.NewEx(config)
 }
 
-func printHeaderLine(cs *dbio.ColumnSeries) {
-	fmt.Printf(formatHeader(cs, "="))
-	fmt.Printf("\n")
-}
-
-func printColumnNames(colNames []string) {
-	for i, name := range colNames {
-		switch i {
-		case 0:
-			fmt.Printf("%29s  ", name)
-		default:
-			fmt.Printf("%-10s  ", name)
-		}
-	}
-	fmt.Printf("\n")
-}
-
-//func printResult(queryText string, cs *dbio.ColumnSeries, optional_writer ...*csv.Writer) (err error) {
-func printResult(queryText string, cs *dbio.ColumnSeries, optionalFile ...string) (err error) {
-
-	var oFile string
-	if len(optionalFile) != 0 {
-		// Might be a real filename
-		oFile = optionalFile[0]
-	}
-	var writer *csv.Writer
-	if len(oFile) != 0 {
-		var file *os.File
-		file, err = os.OpenFile(oFile, os.O_CREATE|os.O_RDWR, 0755)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		writer = csv.NewWriter(file)
-	}
-
+// printResult writes the result of a query in the output format, to the
+// target file or the terminal if empty, through the pager if on.  The
+// results are written as a table to the terminal and as CSV to a file unless
+// a format is given.
+func (c *Client) printResult(queryText string, cs *dbio.ColumnSeries) (err error) {
 	if cs == nil {
 		fmt.Println("No results returned from query")
 		return
@@ -272,125 +284,251 @@ func printResult(queryText string, cs *dbio.ColumnSeries, optionalFile ...string
 		return fmt.Errorf("Unable to convert Epoch column")
 	}
 
-	if writer == nil {
-		printHeaderLine(cs)
-		printColumnNames(cs.GetColumnNames())
-		printHeaderLine(cs)
+	format := c.format
+	if format == "" {
+		format = TableFormat
+		if c.target != "" {
+			format = CSVFormat
+		}
+	}
+	var out io.Writer = os.Stdout
+	if c.target != "" {
+		file, err := os.OpenFile(c.target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	} else if c.pager {
+		pager, err := startPager()
+		if err == nil {
+			defer pager.close()
+			out = pager
+		}
+	}
+
+	switch format {
+	case CSVFormat:
+		return writeCSV(out, cs, epoch)
+	case JSONFormat:
+		return writeJSON(out, cs, epoch)
+	}
+	names, rows := formatCells(cs, epoch, c.precision)
+	if format == VerticalFormat {
+		writeVertical(out, names, rows, c.width)
+		return nil
 	}
+	writeTable(out, names, rows, c.width)
+	return nil
+}
+
+// formatCells returns the names of the columns and the values of the rows
+// formatted for display, the floats with the precision unless negative
+func formatCells(cs *dbio.ColumnSeries, epoch []int64, precision int) (names []string, rows [][]string) {
+	names = cs.GetColumnNames()
+	rows = make([][]string, len(epoch))
 	for i, ts := range epoch {
-		row := []string{}
-		var element string
-		for _, name := range cs.GetColumnNames() {
+		rows[i] = make([]string, len(names))
+		for j, name := range names {
 			if strings.EqualFold(name, "Epoch") {
-				element = fmt.Sprintf("%29s  ", dbio.ToSystemTimezone(time.Unix(ts, 0)).String()) // Epoch
+				rows[i][j] = formatEpoch(ts)
 			} else {
-				col := cs.GetByName(name)
-				colType := reflect.TypeOf(col).Elem().Kind()
-				switch colType {
-				case reflect.Float32:
-					val := col.([]float32)[i]
-					element = strconv.FormatFloat(float64(val), 'f', -1, 32)
-				case reflect.Float64:
-					val := col.([]float64)[i]
-					element = strconv.FormatFloat(val, 'f', -1, 32)
-				case reflect.Int8:
-					val := col.([]int8)[i]
-					element = strconv.FormatInt(int64(val), 10)
-				case reflect.Int16:
-					val := col.([]int16)[i]
-					element = strconv.FormatInt(int64(val), 10)
-				case reflect.Int32:
-					val := col.([]int32)[i]
-					element = strconv.FormatInt(int64(val), 10)
-				case reflect.Int64:
-					val := col.([]int64)[i]
-					element = strconv.FormatInt(val, 10)
-				case reflect.Uint8:
-					val := col.([]uint8)[i]
-					element = strconv.FormatUint(uint64(val), 10)
-				case reflect.Uint16:
-					val := col.([]uint16)[i]
-					element = strconv.FormatUint(uint64(val), 10)
-				case reflect.Uint32:
-					val := col.([]uint32)[i]
-					element = strconv.FormatUint(uint64(val), 10)
-				case reflect.Uint64:
-					val := col.([]uint64)[i]
-					element = strconv.FormatUint(val, 10)
-				case reflect.Bool:
-					val := col.([]bool)[i]
-					if val {
-						element = "TRUE"
-					} else {
-						element = "FALSE"
-					}
+				rows[i][j] = formatElement(cs.GetByName(name), i, precision)
+			}
+		}
+	}
+	return names, rows
+}
 
-				}
-				element = fmt.Sprintf("%-10s", element)
+// writeTable writes the rows as a table whose columns are as wide as their
+// values, or the width if set, the longer values but the epochs being cut
+func writeTable(out io.Writer, names []string, rows [][]string, width int) {
+	widths := make([]int, len(names))
+	for j, name := range names {
+		widths[j] = width
+		if width > 0 && !strings.EqualFold(name, "Epoch") {
+			continue
+		}
+		widths[j] = utf8.RuneCountInString(name)
+		for _, row := range rows {
+			if n := utf8.RuneCountInString(row[j]); n > widths[j] {
+				widths[j] = n
 			}
+		}
+	}
+	var rule bytes.Buffer
+	for _, w := range widths {
+		rule.WriteString(strings.Repeat("=", w))
+		rule.WriteString("  ")
+	}
 
-			if writer != nil {
-				row = append(row, strings.TrimSpace(element))
+	w := bufio.NewWriter(out)
+	writeRow := func(cells []string) {
+		for j, cell := range cells {
+			cell = fitCell(cell, widths[j])
+			// the epochs are aligned to the right
+			if strings.EqualFold(names[j], "Epoch") {
+				fmt.Fprintf(w, "%*s  ", widths[j], cell)
 			} else {
-				fmt.Printf("%s  ", element)
+				fmt.Fprintf(w, "%-*s  ", widths[j], cell)
 			}
 		}
-		if writer == nil {
-			fmt.Printf("\n")
-		} else {
-			writer.Write(row)
-			row = []string{}
+		w.WriteString("\n")
+	}
+	fmt.Fprintf(w, "%s\n", rule.String())
+	writeRow(names)
+	fmt.Fprintf(w, "%s\n", rule.String())
+	for _, row := range rows {
+		writeRow(row)
+	}
+	fmt.Fprintf(w, "%s\n", rule.String())
+	w.Flush()
+}
+
+// writeVertical writes each row as a record of its column names and values
+// on their own lines, for the results too wide for a table
+func writeVertical(out io.Writer, names []string, rows [][]string, width int) {
+	nameWidth := 0
+	for _, name := range names {
+		if n := utf8.RuneCountInString(name); n > nameWidth {
+			nameWidth = n
 		}
 	}
-	if writer == nil {
-		printHeaderLine(cs)
-	} else {
-		writer.Flush()
+	w := bufio.NewWriter(out)
+	for i, row := range rows {
+		fmt.Fprintf(w, "-[ RECORD %d ]%s\n", i+1, strings.Repeat("-", nameWidth+10))
+		for j, name := range names {
+			value := row[j]
+			if width > 0 && !strings.EqualFold(name, "Epoch") {
+				value = fitCell(value, width)
+			}
+			fmt.Fprintf(w, "%-*s | %s\n", nameWidth, name, value)
+		}
+	}
+	w.Flush()
+}
+
+// fitCell cuts the value to the width, marking it cut with a trailing ~
+func fitCell(value string, width int) string {
+	if utf8.RuneCountInString(value) <= width {
+		return value
+	}
+	runes := []rune(value)
+	if width < 1 {
+		return ""
 	}
-	return err
+	return string(runes[:width-1]) + "~"
 }
 
-func formatHeader(cs *dbio.ColumnSeries, printChar string) string {
-	var buffer bytes.Buffer
-	appendChars := func(count int) {
-		for i := 0; i < count; i++ {
-			buffer.WriteString(printChar)
+func writeCSV(out io.Writer, cs *dbio.ColumnSeries, epoch []int64) error {
+	writer := csv.NewWriter(out)
+	writer.Write(cs.GetColumnNames())
+	for i, ts := range epoch {
+		row := []string{}
+		for _, name := range cs.GetColumnNames() {
+			if strings.EqualFold(name, "Epoch") {
+				row = append(row, formatEpoch(ts))
+			} else {
+				row = append(row, formatElement(cs.GetByName(name), i, -1))
+			}
 		}
-		buffer.WriteString("  ")
+		writer.Write(row)
 	}
-	for _, name := range cs.GetColumnNames() {
-		if strings.EqualFold(name, "Epoch") {
-			appendChars(29)
-			continue
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSON writes the rows as an array of objects with the columns in
+// order, the Epoch in RFC 3339 and the NaN values as null
+func writeJSON(out io.Writer, cs *dbio.ColumnSeries, epoch []int64) error {
+	w := bufio.NewWriter(out)
+	w.WriteString("[")
+	for i, ts := range epoch {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n{")
+		for j, name := range cs.GetColumnNames() {
+			if j > 0 {
+				w.WriteString(",")
+			}
+			key, _ := json.Marshal(name)
+			w.Write(key)
+			w.WriteString(":")
+			var value interface{}
+			if strings.EqualFold(name, "Epoch") {
+				value = dbio.ToSystemTimezone(time.Unix(ts, 0)).Format(time.RFC3339)
+			} else {
+				value = reflect.ValueOf(cs.GetByName(name)).Index(i).Interface()
+				switch v := value.(type) {
+				case float32:
+					if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+						value = nil
+					}
+				case float64:
+					if math.IsNaN(v) || math.IsInf(v, 0) {
+						value = nil
+					}
+				}
+			}
+			buf, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			w.Write(buf)
 		}
-		col := cs.GetByName(name)
-		colType := reflect.TypeOf(col).Elem().Kind()
-		switch colType {
-		case reflect.Float32:
-			appendChars(10)
-		case reflect.Float64:
-			appendChars(10)
-		case reflect.Int8:
-			appendChars(10)
-		case reflect.Int16:
-			appendChars(10)
-		case reflect.Int32:
-			appendChars(10)
-		case reflect.Int64:
-			appendChars(10)
-		case reflect.Uint8:
-			appendChars(10)
-		case reflect.Uint16:
-			appendChars(10)
-		case reflect.Uint32:
-			appendChars(10)
-		case reflect.Uint64:
-			appendChars(10)
-		case reflect.String:
-			appendChars(10)
-		case reflect.Bool:
-			appendChars(10)
+		w.WriteString("}")
+	}
+	w.WriteString("\n]\n")
+	return w.Flush()
+}
+
+func formatEpoch(ts int64) string {
+	return dbio.ToSystemTimezone(time.Unix(ts, 0)).String()
+}
+
+// formatElement formats the element of the column at the index, the floats
+// with the precision, or the fewest digits representing them if negative
+func formatElement(col interface{}, i int, precision int) (element string) {
+	colType := reflect.TypeOf(col).Elem().Kind()
+	switch colType {
+	case reflect.Float32:
+		val := col.([]float32)[i]
+		element = strconv.FormatFloat(float64(val), 'f', precision, 32)
+	case reflect.Float64:
+		val := col.([]float64)[i]
+		element = strconv.FormatFloat(val, 'f', precision, 64)
+	case reflect.Int8:
+		val := col.([]int8)[i]
+		element = strconv.FormatInt(int64(val), 10)
+	case reflect.Int16:
+		val := col.([]int16)[i]
+		element = strconv.FormatInt(int64(val), 10)
+	case reflect.Int32:
+		val := col.([]int32)[i]
+		element = strconv.FormatInt(int64(val), 10)
+	case reflect.Int64:
+		val := col.([]int64)[i]
+		element = strconv.FormatInt(val, 10)
+	case reflect.Uint8:
+		val := col.([]uint8)[i]
+		element = strconv.FormatUint(uint64(val), 10)
+	case reflect.Uint16:
+		val := col.([]uint16)[i]
+		element = strconv.FormatUint(uint64(val), 10)
+	case reflect.Uint32:
+		val := col.([]uint32)[i]
+		element = strconv.FormatUint(uint64(val), 10)
+	case reflect.Uint64:
+		val := col.([]uint64)[i]
+		element = strconv.FormatUint(val, 10)
+	case reflect.Bool:
+		val := col.([]bool)[i]
+		if val {
+			element = "TRUE"
+		} else {
+			element = "FALSE"
 		}
 	}
-	return buffer.String()
+	return element
 }
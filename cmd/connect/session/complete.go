@@ -0,0 +1,152 @@
+package session
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+)
+
+// commands are the commands completed at the start of a line
+var commands = []string{
+	"\\show", "\\trim", "\\load", "\\create", "\\destroy", "\\getinfo", "\\o", "\\timing",
+	"\\format", "\\width", "\\precision", "\\pager",
+	"\\help", "\\?", "\\stop", "\\quit", "\\q",
+}
+
+const (
+	// wordSeparators end the word completed, such as the backquotes of
+	// the bucket keys of SQL statements
+	wordSeparators = " \t,()`'\""
+	// catalogTTL is how long the catalog listed is completed from
+	catalogTTL = 30 * time.Second
+)
+
+// completer completes the commands, the symbols, timeframes and attribute
+// groups of the bucket keys and the column names of the catalog of the
+// client
+type completer struct {
+	c      *Client
+	listed time.Time
+	// the column names by bucket key
+	buckets map[string][]string
+}
+
+// Do returns the completions of the word before the cursor: a command at the
+// start of the line, a bucket key as the first argument of a command, after
+// FROM or INTO, or once it has a slash, and otherwise a column name of the
+// buckets of the statement, or of any bucket if it has none.
+func (cp *completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	text := string(line[:pos])
+	start := strings.LastIndexAny(text, wordSeparators) + 1
+	word := text[start:]
+
+	var candidates []string
+	before := strings.Fields(text[:start])
+	switch {
+	case start == 0 && strings.HasPrefix(word, "\\"):
+		candidates = commands
+	case strings.HasPrefix(text, "\\"):
+		if len(before) == 1 {
+			candidates = cp.keyParts(word)
+		}
+	case strings.Contains(word, "/") || len(before) > 0 &&
+		(strings.EqualFold(before[len(before)-1], "FROM") || strings.EqualFold(before[len(before)-1], "INTO")):
+		candidates = cp.keyParts(word)
+	default:
+		candidates = cp.columns(text)
+	}
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && candidate != word {
+			newLine = append(newLine, []rune(candidate[len(word):]))
+		}
+	}
+	return newLine, len([]rune(word))
+}
+
+// keyParts returns the keys, up to the next slash, which complete the
+// Symbol/Timeframe/AttributeGroup key of the word
+func (cp *completer) keyParts(word string) []string {
+	parts := strings.Split(word, "/")
+	prefix := strings.Join(parts[:len(parts)-1], "/")
+	level := len(parts) - 1
+	if level > 2 {
+		return nil
+	}
+	unique := map[string]bool{}
+	for key := range cp.catalog() {
+		elements := strings.Split(key, "/")
+		if strings.Join(elements[:level], "/") != prefix {
+			continue
+		}
+		candidate := strings.Join(elements[:level+1], "/")
+		if level < 2 {
+			candidate += "/"
+		}
+		unique[candidate] = true
+	}
+	return sortedKeys(unique)
+}
+
+// columns returns the column names of the buckets of the statement, of all
+// buckets if it has none
+func (cp *completer) columns(text string) []string {
+	buckets := cp.catalog()
+	unique := map[string]bool{}
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return strings.ContainsRune(wordSeparators, r) }) {
+		for _, name := range buckets[field] {
+			unique[name] = true
+		}
+	}
+	if len(unique) == 0 {
+		for _, names := range buckets {
+			for _, name := range names {
+				unique[name] = true
+			}
+		}
+	}
+	return sortedKeys(unique)
+}
+
+// catalog returns the column names by bucket key, listed again once older
+// than catalogTTL.  The catalog is empty if it cannot be listed.
+func (cp *completer) catalog() map[string][]string {
+	if cp.buckets != nil && time.Since(cp.listed) < catalogTTL {
+		return cp.buckets
+	}
+	cp.buckets, cp.listed = map[string][]string{}, time.Now()
+	if cp.c.mode == local {
+		for _, info := range executor.ThisInstance.CatalogDir.GatherTimeBucketInfo() {
+			// <root>/<Symbol>/<Timeframe>/<AttributeGroup>/<Year>.bin
+			elements := strings.Split(filepath.ToSlash(filepath.Dir(info.Path)), "/")
+			if len(elements) < 3 {
+				continue
+			}
+			key := strings.Join(elements[len(elements)-3:], "/")
+			if _, ok := cp.buckets[key]; ok {
+				continue
+			}
+			for _, ds := range info.GetDataShapesWithEpoch() {
+				cp.buckets[key] = append(cp.buckets[key], ds.Name)
+			}
+		}
+	} else if cp.c.rc != nil {
+		buckets, _ := cp.c.rc.ListBuckets("")
+		for _, md := range buckets {
+			cp.buckets[md.Key] = md.ColumnNames
+		}
+	}
+	return cp.buckets
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// setDisplay sets the format, column width, float precision or paging of
+// the query results from a backslash command:
+//
+//	\format table|csv|json|vertical
+//	\width <columns>|auto
+//	\precision <digits>|auto
+//	\pager on|off
+func (c *Client) setDisplay(line string) error {
+	args := strings.Fields(line)
+	if len(args) != 2 {
+		return fmt.Errorf("%s needs a single value, see \\help %s", args[0], strings.TrimPrefix(args[0], "\\"))
+	}
+	value := strings.ToLower(args[1])
+	switch args[0] {
+	case "\\format":
+		return c.SetOutput(value, c.target)
+	case "\\width":
+		n, err := parseCount(value, 0)
+		if err != nil {
+			return err
+		}
+		c.width = n
+	case "\\precision":
+		n, err := parseCount(value, -1)
+		if err != nil {
+			return err
+		}
+		c.precision = n
+	case "\\pager":
+		switch value {
+		case "on":
+			c.pager = true
+		case "off":
+			c.pager = false
+		default:
+			return fmt.Errorf("invalid pager setting %s, must be on or off", args[1])
+		}
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+	return nil
+}
+
+// parseCount returns the count of a setting, or the auto value
+func parseCount(value string, auto int) (int, error) {
+	if value == "auto" {
+		return auto, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid setting %s, must be a number or auto", value)
+	}
+	return n, nil
+}
+
+// pager writes to the standard input of the $PAGER command, less by default,
+// which quits at once if the output fits the screen
+type pager struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func startPager() (*pager, error) {
+	command := os.Getenv("PAGER")
+	if command == "" {
+		command = "less -FRX"
+	}
+	fields := strings.Fields(command)
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &pager{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+// close waits for the pager to quit once the output is written
+func (p *pager) close() {
+	p.WriteCloser.Close()
+	p.cmd.Wait()
+}
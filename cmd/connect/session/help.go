@@ -21,7 +21,11 @@ func (c *Client) functionHelp(line string) {
 		fmt.Println(`
 		Usage: \help command_name
 
-		Available commands: o, timing, show, trim, gaps, load, create, destroy, feed`)
+		Available commands: o, timing, format, width, precision, pager, show, trim, gaps,
+		load, create, destroy, feed
+
+		Tab completes the commands, the bucket keys of the catalog and the column
+		names of the buckets of a statement.  Ctrl+R searches the history.`)
 
 	case "o":
 		fmt.Println(`
@@ -31,6 +35,24 @@ func (c *Client) functionHelp(line string) {
 		fmt.Println(`
 		Toggles timing for commands`)
 
+	case "format", "width", "precision", "pager":
+		fmt.Println(`
+		Sets the display of the query results:
+
+			>> \format table|csv|json|vertical
+			>> \width <characters>|auto
+			>> \precision <digits>|auto
+			>> \pager on|off
+
+	format: table by default, vertical writes each row as a record of a line per
+	        column, for the results too wide for a table
+	width: of the table columns, the longer values being cut, by default as wide
+	       as their values
+	precision: digits after the point of the floats, by default the fewest
+	           representing them
+	pager: pages the results written to the terminal with $PAGER, less by
+	       default, on in an interactive session`)
+
 	case "show", "trim", "gaps":
 		fmt.Println(`
 		Syntax: (same for show/trim/gaps):
@@ -73,6 +95,24 @@ func (c *Client) functionHelp(line string) {
 		Note: "Epoch" is a special name, as is "Epoch-date" and "Epoch-time"
 		If the input file has the time index epoch in separate date and time columns, you will
 		specify the epoch-date and epoch-time columns in the columnNameMap
+
+		Vendor files are mapped to the DB columns with the optional entries:
+			rename: {Last: Close, Vol: Volume}
+			timeColumn: Date
+			coerce: {Volume: number, Halted: bool}
+			rename: input column names renamed to DB column names
+			timeColumn: input column holding the Epoch
+			coerce: "number" parses decimals with thousands separators, truncated
+				for integer columns, and empty values as zeros, "bool" parses
+				yes/no, y/n, on/off and empty values as well, as 1/0 for numeric columns
+
+		Without a key, each csv file is loaded into the bucket of the template of the
+		loader control file, the last argument, its symbol extracted from the file name:
+
+			>> \load AAPL_2017.csv TSLA_2017.csv vendor.yaml
+
+			bucket: "{symbol}/1Min/OHLCV"
+			symbolPattern: "^([A-Za-z]+)_" # the file name without extension by default
 	`)
 
 	case "create", "destroy":
@@ -31,6 +31,15 @@ func (c *Client) load(line string) {
 		return
 	}
 
+	/*
+		Without a key, the csv files are loaded into the buckets of the
+		template of the loader control file
+	*/
+	if fi, err := os.Stat(args[0]); err == nil && !fi.IsDir() {
+		c.loadFiles(args)
+		return
+	}
+
 	tbk_p, dataFD, loaderFD, err := parseLoadArgs(args)
 	if err != nil {
 		fmt.Printf("Error while parsing arguments: %v\n", err)
@@ -39,25 +48,72 @@ func (c *Client) load(line string) {
 	if dataFD != nil {
 		defer dataFD.Close()
 	}
-	tbk := *tbk_p
+	var conf *loader.CSVConfig
+	if loaderFD != nil {
+		if conf, err = loader.ReadControlFile(loaderFD); err != nil {
+			fmt.Println("Error: ", err.Error())
+			return
+		}
+	}
+	c.loadFile(*tbk_p, dataFD, conf)
+}
+
+// loadFiles loads each of the csv files into the bucket of the template
+// of the loader control file, the last argument
+func (c *Client) loadFiles(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Not enough arguments, see \"\\help load\"")
+		return
+	}
+	loaderFD, err := os.Open(args[len(args)-1])
+	if err != nil {
+		fmt.Printf("Error while parsing arguments: %v\n", err)
+		return
+	}
+	conf, err := loader.ReadControlFile(loaderFD)
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		return
+	}
+	for _, fileName := range args[:len(args)-1] {
+		tbk, err := conf.BucketKey(fileName)
+		if err != nil {
+			fmt.Println("Error: ", err.Error())
+			return
+		}
+		dataFD, err := os.Open(fileName)
+		if err != nil {
+			fmt.Println("Error: ", err.Error())
+			return
+		}
+		fmt.Printf("Loading %s into %s\n", fileName, tbk.GetItemKey())
+		ok := c.loadFile(*tbk, dataFD, conf)
+		dataFD.Close()
+		if !ok {
+			return
+		}
+	}
+}
 
+// loadFile loads the csv file into the bucket, returning false on failure
+func (c *Client) loadFile(tbk io.TimeBucketKey, dataFD *os.File, conf *loader.CSVConfig) bool {
 	/*
 		Verify the presence of a bucket with the input key
 	*/
 	resp, err := c.GetBucketInfo(tbk)
 	if err != nil {
 		fmt.Printf("Error finding existing bucket: %v\n", err)
-		return
+		return false
 	}
 	fmt.Printf("Latest Year: %v\n", resp.LatestYear)
 
 	/*
 		Read the metadata about the CSV file
 	*/
-	csvReader, cvm, err := loader.ReadMetadata(dataFD, loaderFD, resp.DSV)
+	csvReader, cvm, err := loader.ReadMetadata(dataFD, conf, resp.DSV)
 	if err != nil {
 		fmt.Println("Error: ", err.Error())
-		return
+		return false
 	}
 
 	/*
@@ -70,39 +126,21 @@ func (c *Client) load(line string) {
 		npm, endReached, err := loader.CSVtoNumpyMulti(csvReader, tbk, cvm, chunkSize, resp.RecordType == io.VARIABLE)
 		if err != nil {
 			fmt.Println("Error: ", err.Error())
-			return
+			return false
 		}
 		if npm != nil { // npm will be empty if we've read the whole file in the last pass
-			// LAL ================= DEBUG
-			/*
-				//fmt.Println("LAL: npm:", npm)
-				csmT, err := npm.ToColumnSeriesMap()
-				if err != nil {
-					fmt.Println("LAL Error: ", err)
-					return
-				}
-				fmt.Println("LAL: csm:", csmT)
-				fmt.Println("LAL: cs:", csmT[tbk])
-			*/
-			// LAL ^^^^^^^^^^^^^^^^^^ DEBUG
-
 			err = writeNumpy(c, npm, resp.RecordType == io.VARIABLE)
 			if err != nil {
 				fmt.Println("Error: ", err.Error())
-				return
+				return false
 			}
-			// LAL ================= DEBUG
-			/*
-				return
-			*/
-			// LAL ^^^^^^^^^^^^^^^^^^ DEBUG
 		}
 		if endReached {
 			break
 		}
 	}
 
-	return
+	return true
 }
 
 func writeNumpy(c *Client, npm *io.NumpyMultiDataset, isVariable bool) (err error) {
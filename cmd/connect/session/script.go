@@ -0,0 +1,78 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// statement is a backslash command or sql statement of a script, with the
+// line it starts on
+type statement struct {
+	line int
+	text string
+}
+
+// RunScript executes the backslash commands and sql statements of a script
+// in order, reporting the errors of the statements with their line.  The
+// script stops at the first error unless continueOnError, and an error is
+// returned if a statement failed.
+func (c *Client) RunScript(r io.Reader, name string, continueOnError bool) error {
+	statements, err := splitScript(r)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, stmt := range statements {
+		quit, err := c.execute(stmt.text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: ERROR: %v\n", name, stmt.line, err)
+			failed++
+			if !continueOnError {
+				return fmt.Errorf("%s:%d: statement failed", name, stmt.line)
+			}
+		}
+		if quit {
+			break
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d statements failed", failed, len(statements))
+	}
+	return nil
+}
+
+// splitScript returns the statements of a script.  A backslash command is a
+// single line, while a sql statement runs until a line ending with a
+// semicolon or the end of the script.  The blank lines and the comment lines
+// starting with "--" between the statements are skipped.
+func splitScript(r io.Reader) (statements []statement, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var pending []string
+	start := 0
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(pending) == 0 {
+			if line == "" || strings.HasPrefix(line, "--") {
+				continue
+			}
+			if strings.HasPrefix(line, "\\") {
+				statements = append(statements, statement{line: n, text: line})
+				continue
+			}
+			start = n
+		}
+		pending = append(pending, line)
+		if strings.HasSuffix(line, ";") {
+			statements = append(statements, statement{line: start, text: strings.Join(pending, " ")})
+			pending = nil
+		}
+	}
+	if len(pending) > 0 {
+		statements = append(statements, statement{line: start, text: strings.Join(pending, " ")})
+	}
+	return statements, scanner.Err()
+}
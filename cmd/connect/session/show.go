@@ -66,7 +66,7 @@ func (c *Client) show(line string) {
 		fmt.Printf("Elapsed query time: %5.3f ms\n", 1000*elapsedTime.Seconds())
 	}
 
-	if err = printResult(line, csm[key], c.target); err != nil {
+	if err = c.printResult(line, csm[key]); err != nil {
 		fmt.Println(err.Error())
 	}
 
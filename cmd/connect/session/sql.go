@@ -11,6 +11,14 @@ import (
 
 // sql executes a sql statement against the current db.
 func (c *Client) sql(line string) {
+	if err := c.Query(line); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Query executes a sql statement against the current db and writes its
+// result in the output format to the output target.
+func (c *Client) Query(line string) error {
 	timeStart := time.Now()
 	var err error
 	var cs *io.ColumnSeries
@@ -21,20 +29,20 @@ func (c *Client) sql(line string) {
 	}
 
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
 	runTime := time.Since(timeStart)
 
-	err = printResult(line, cs, c.target)
+	err = c.printResult(line, cs)
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
 	}
 
 	if c.timing {
 		fmt.Printf("Elapsed query time: %5.3f ms\n", 1000*runTime.Seconds())
 	}
+	return nil
 }
 
 func localSQL(line string) (cs *io.ColumnSeries, err error) {
@@ -68,7 +68,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _defaultYml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x54\x4d\x6f\xdc\x46\x0c\xbd\xeb\x57\x10\xd2\xa5\x35\x20\xaf\xdc\xc6\x2d\x3c\x37\x27\x4d\xea\x83\x53\x1b\x70\x1b\x34\x27\x81\x92\x28\xed\x60\x47\x43\x85\x43\x79\xbd\x45\x7e\x7c\x31\x5a\xaf\xbd\x5f\x0e\x6c\x9d\x24\xbe\xa7\xf7\xf8\x31\x9c\x0c\xf2\xd7\x3e\x49\x06\x97\xa3\x72\xde\x91\x27\x41\xa5\x06\x7a\x94\x05\x69\x50\x16\x82\x9a\x7d\x6b\xbb\x51\x50\x2d\xfb\xd3\xe4\x6d\xba\xc2\xac\xd0\x58\xa1\x5a\x59\x56\xc0\x2d\xe8\x9c\xa0\x41\xc5\x0a\x03\x25\x11\x2e\x9f\x60\x33\x01\x49\x06\xce\x06\x25\x0f\x03\x8b\x42\x3e\xfd\x31\xbd\xd2\xc3\xc0\x81\x1a\xa8\x56\x3b\x2a\x10\x48\xee\x49\x92\xf5\x5f\x65\xa4\x1a\x38\xbf\xb8\xf8\x35\x2a\x71\x07\x8e\xee\xc9\xc1\x4f\xd6\xb7\xfc\x7d\x89\xe2\xbf\x93\x08\xcb\xcf\x89\xe3\xae\x9c\x30\x03\x11\x4b\x32\xf8\x36\x92\xac\xb0\x72\x04\x39\xa0\x73\xbc\x0c\xbb\x46\xca\x50\xd1\xc4\xb2\xd4\x80\xce\x85\xc7\x6e\x0e\x08\xb5\xb3\xe4\x35\x76\xca\x53\x1d\xdb\x94\x3c\x29\x19\x50\x19\x29\xc9\x92\xa0\x3c\x94\x9d\x60\x4d\xe5\x40\x62\xb9\x31\x50\x24\x59\xb2\x44\x57\x0a\x2b\x2a\x95\xd6\x2b\xc9\x3d\x3a\x03\xe7\x49\x96\x90\x8f\xbf\x97\xd8\x34\x4f\x12\x8f\x21\xa1\x9e\xef\xc9\x40\x8b\x2e\x6c\x85\x1d\x06\x2d\x17\x9e\x97\xfe\x19\xca\x40\x6d\x4f\xff\xb1\x27\x03\xe9\x65\x4f\x62\x6b\x9c\xfd\x45\xcb\xf2\x2b\xcb\x22\x9d\x08\x37\x43\x4c\x18\xdd\xa6\xe9\x73\x0e\x0a\x2d\xcb\x41\x7b\x37\x63\x29\x23\xc3\x40\xea\xb8\x46\x17\xdf\xd7\x3a\x1f\xa7\x2c\xa0\xa1\x6a\xec\x3a\xeb\x3b\x18\x06\xe1\x16\xd0\x37\x30\x27\x14\xad\x08\x15\xc8\x37\x03\x5b\xaf\x21\xc9\x60\x54\xeb\xac\x5a\x0a\xe5\x28\x6e\x5b\xcf\x9c\x5f\x5c\xbc\x4b\x93\x37\x9c\xb4\x68\xff\x80\xfd\xe0\x08\x54\x6c\xd7\x91\x40\xcf\xcd\xe8\x28\x4c\xa9\xfd\xe3\xf3\x9a\xfb\x3e\x8e\x48\x19\xd6\xed\x7a\xcb\x41\x5e\x37\x72\x2d\x1c\x4c\x92\x01\x40\xfe\x68\x60\x80\x7d\x63\xc3\x02\xbb\xee\x34\xf0\x04\x01\xb0\x37\x90\x9e\xcc\xce\x3e\x5b\x3f\xbb\xb9\xba\xfe\xf0\x25\x7d\x04\xd6\xab\x64\x1e\xbf\x00\x1a\x0a\x6a\xfd\xb4\x58\xe1\x39\x1a\xd5\xcf\x3f\x5b\xbf\x13\x38\x3b\x8c\x5c\xed\x7e\xfe\xb1\x97\x58\x50\x21\xec\x0f\xb2\x3a\x99\x9d\xbc\x94\x4e\x6b\x9d\x92\x18\xf0\x18\x1a\xfc\x96\x64\x50\x75\x4b\x96\xc5\x91\xa2\xbb\x06\x1f\x5a\xa2\x86\xe4\x59\xdf\x63\x4f\x06\xfe\x6c\xf0\xe1\x13\x69\x3d\x9f\x4e\xcc\x31\x97\x69\x35\xca\xa0\x18\xd7\x34\xfd\xa5\x38\xfb\x3d\x2f\x2e\xf2\xe2\x0c\x8a\xc2\x14\x45\xba\x5f\x85\x43\xab\xcf\x26\x1b\x9b\xbb\x18\xbe\x1b\xab\x50\x8b\xad\x9e\xac\x0e\xcd\xe2\xb3\x39\x74\x06\xb6\x8e\x58\x51\x14\x3b\x24\xe5\xc1\xd6\x06\x2a\x94\x50\xc6\xea\x76\x40\x54\x15\x5b\x8d\x4a\x65\x27\x3c\x0e\x06\xa6\xa9\xee\x50\xc2\x1c\x07\xda\xf5\xcd\x21\x87\x8f\x03\xd7\xf3\x9d\x68\x8c\x5b\xaf\xbf\xbd\x3b\xe0\xde\x0c\xe4\x0f\xa8\xad\x63\x3c\x46\xbe\xb2\xdd\xa1\xee\x4b\xe4\x6b\x5e\xbe\x9a\xfb\xc1\x71\xbc\x3a\x5e\xc9\xfe\xc2\x6e\xec\x7f\x4c\x7f\x9e\xe5\xc0\x6e\xd5\xb1\xdf\x9e\xe6\x66\x9e\xb7\x6b\x68\x2b\x7e\x6c\x92\x00\x38\xd8\x72\x41\x2b\x03\x2b\x1e\xa5\x7c\xfc\xda\xe3\xc4\x4b\x6b\x7d\xa7\xcc\x55\x87\x60\x66\x33\x1c\xec\xe9\xc6\xdc\xf2\x1e\x3d\xac\xfa\x8a\x5d\xd8\x77\x5a\x17\x72\x79\x79\x7b\x7d\x14\xb8\xbb\xfd\xba\x57\x5d\x65\xb5\xa7\x17\xb6\xe2\xfd\x84\x7d\x9a\xb0\x37\xac\xc5\xd9\xde\x5a\xbc\x90\x6e\x0e\xa7\xff\xbe\xff\xfb\x29\x30\xd5\x1f\xef\xfd\x56\x26\xf3\x34\x5e\x1d\x69\xf2\x7f\x00\x00\x00\xff\xff\x5a\x0d\xb7\x16\x11\x08\x00\x00")
+var _defaultYml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x95\x57\x5b\x6f\xdb\x36\x14\x7e\xf7\xaf\x20\x9c\x97\xad\xb0\x6c\x67\x6d\x36\x54\x6f\x6e\xda\xae\x05\xd2\x35\xab\xbb\x6e\x45\x51\x08\x94\x44\x49\x5c\x28\x51\x21\xa9\x38\x2e\xfa\xe3\xf7\x1d\x52\xf2\x2d\xce\x9a\x24\x40\x60\x9f\xfb\xf5\x3b\xcc\x09\x8b\x1e\xfa\x33\x3a\x61\x8b\xce\xe9\xa8\x14\x8d\x30\xdc\x89\x9c\xd5\xdc\x5c\x09\x67\x9d\x36\x82\x65\xba\x29\x64\xd9\x81\x21\x75\x33\x85\xec\x63\xec\x1a\xad\x1d\xcb\xa5\x11\x19\x6c\xad\x99\x2e\x98\xab\x04\xcb\xb9\xe3\x29\xb7\x62\x44\xec\x64\xc3\x8e\x3d\x03\x5a\x4a\x5a\x27\x1a\xd6\x6a\xe3\x58\xe4\x35\xfc\x47\x71\xdb\x6a\x8b\xe8\xd2\xf5\x9e\x15\x66\x85\xb9\x11\x66\x14\xb4\x12\x12\x8d\xd9\xd9\xf3\xe7\x4f\xc9\x92\x2e\x99\x12\x37\x42\xb1\x9f\x64\x53\xe8\xef\x2b\x6e\x9a\xef\xc2\x18\x6d\x7e\x1e\x81\x97\x78\x5e\xcc\x88\x07\xe9\xeb\x4e\x98\x35\x4f\x95\x80\x57\xae\x94\x5e\xd9\x7d\x47\x4e\xb3\x54\x78\x29\x89\x30\x5c\x65\x74\x57\x56\x8c\xb3\x4c\x49\xd1\x38\xaa\x54\x83\x4c\x50\xa6\xd1\xc6\x52\xcc\x9c\xe9\xc4\xe8\x64\x84\x62\xb6\x49\x69\x78\x26\x92\x16\xfa\x3a\x8f\xd9\x1c\xe4\x15\x57\x89\xd1\x0e\x55\x4f\x64\xe3\x90\x08\x47\x38\x67\x60\x88\x86\xd4\x13\x9e\xe7\x1b\x13\x3d\xc9\x88\x5a\xdf\xc0\x70\xc1\x95\xdd\x21\x2b\x6e\x5d\x72\xd5\xe8\x55\xb3\x65\x9d\xb0\x4f\xdc\x48\x9f\x91\x12\x4d\xe9\x2a\x96\x76\x19\x75\x96\xad\x2a\x94\x92\xad\x8c\x74\xc2\xb2\xdc\xe8\xd6\x67\x6a\x28\x65\xae\x8c\xe0\xf9\xda\x33\xa9\x0d\x2b\x09\x3d\x70\x61\xcd\xf2\x1a\x55\x90\xf8\xc3\x9b\x9c\x21\xd6\x4e\xd8\x09\x13\xd3\x72\xea\xd5\x9d\xcc\xae\x2c\x33\xa2\x55\x7c\x1d\xfa\xc4\x59\x21\xf0\x89\x17\x48\x0d\x8c\xa1\x42\x4d\x09\x63\xb9\xc8\xbb\x56\xc9\x0c\xb9\xc7\xf8\xca\x50\xf4\xf1\x93\xd9\xe9\x52\x64\xb3\x8f\x1f\x16\x2f\x5f\x8d\x7d\x02\x97\x50\xf4\xd5\x84\xba\xd5\x9d\xc9\x90\x8a\xac\xa5\x83\xdf\x39\x2b\xb4\x61\x8d\x0e\x84\x29\x3b\xf7\x6d\xb0\x2c\xe3\x0d\x1a\xbf\x82\x22\x82\x42\x96\xad\xf7\x0d\x23\xd6\x0d\x4d\x4e\x6a\x7e\x9b\x50\xb6\x89\x85\x74\x23\x42\x37\x76\x78\xe9\x1a\x85\x49\xa8\x10\x87\x9c\x1a\xe5\xa7\x59\x9d\xfb\xf0\xde\xc9\x46\xd6\x5d\xcd\x0a\x23\x30\x28\xd2\x5e\x31\xdb\xa2\xc7\x98\x28\xe6\x4d\xf8\x10\xa9\x36\x33\x5f\xd4\x6f\xac\x35\x3a\xf5\x93\x64\xbb\x2c\x43\x6d\x60\xa3\x96\x4d\x42\xfa\x09\xe9\x27\x5e\x7f\x30\x4f\xd9\xf7\xd3\xf5\xa3\xac\xb9\x21\xb3\x2a\xf7\x53\xca\xb3\x2b\x2c\x5b\x81\x36\xa3\x81\x98\x16\x1f\x43\x0d\x83\xc1\x58\x42\x6b\x9e\x78\x03\x21\xbd\x5d\x72\xda\x19\xbb\x4f\xa6\xb4\xc3\xd4\xdb\x21\xb0\x0f\xa1\x9e\x36\x2c\x1f\x3a\xec\x98\x6e\x90\x77\xbf\x9b\x8b\xcb\xb7\x87\x91\x4e\xc2\x20\x75\x98\x34\xda\xb5\xc2\x68\xcc\x7b\x93\x93\xe1\x0e\xa9\x8b\x16\xcc\x9a\x00\x67\xc5\x25\x4d\x88\x57\xe6\x6c\xa5\x01\x45\x66\xba\x75\xd8\x67\xc3\xa9\x97\x94\xb3\x11\xff\x62\xa4\x10\x82\x37\x6f\xb1\x4a\x9d\x65\x67\xf3\xa7\xbb\x3e\x82\x91\x10\xfc\x51\xcf\x43\x5a\x88\x9b\x5d\x89\xb5\x0d\xc6\xa8\x65\x93\xb0\x24\x8c\x82\xc9\xd1\x29\x9a\xa6\x5a\x5a\x4b\x60\xc8\xfe\xa6\xf2\x5a\x81\xdc\x80\x23\x7e\x44\x87\x29\xab\x3b\xeb\xd0\x6b\x8c\x5f\x43\x95\x11\x03\xf4\x91\xf1\x29\x5b\x04\x27\x85\xc4\x62\x56\xe8\x19\xba\xe7\x41\x8f\xc6\x86\xa4\xfc\x9e\x21\xff\x3a\x64\xd9\xca\x84\xe4\x87\x2d\x69\xc0\x8d\xd9\x98\xa2\x13\x66\xec\x89\x8c\x0c\x82\x96\x55\xbc\x29\x45\x54\x8b\x81\xbc\x8d\x36\xf6\xe9\xf4\x26\x0e\xa4\x23\xa7\xf5\x31\x0d\x9f\x7a\x4f\xef\x91\x23\xee\xbf\x92\x95\x96\x03\x20\x0c\xe4\x68\x6f\xb1\x09\xb3\xf7\x6f\x2e\xce\x3f\x8d\x37\x12\xc7\x8d\x0d\xe9\x24\x94\x3e\x74\x67\xc2\x65\xb3\x9d\x8b\x33\xf3\x35\x5a\xd7\x2a\x00\xc0\xa2\xcb\xa5\xf3\x40\x8e\x12\x06\xc0\x9a\xf4\xc1\xb0\x0c\x29\x11\xde\x5a\x8f\x47\xb9\x50\xc2\x7f\x23\x27\xa4\x95\x40\x2b\xc4\x3b\xb8\xba\xe1\x66\x06\xe2\x9e\x3b\x2f\x3a\x05\x35\x04\x6e\xd7\x96\xd4\x76\x30\x74\xb9\xae\x53\xad\x2c\xd2\x35\x4e\x92\x03\x9a\xf7\xcc\x68\x6b\xd1\x2f\x0c\x1c\xe6\x9e\x50\x90\x67\x95\x8f\x8f\x66\xd7\x79\x78\x45\xdc\x80\x63\x42\x54\xe8\xd0\xe9\x5c\xc0\x3a\xd9\x62\xd2\x12\x67\x7b\xcb\x0a\x89\x9d\x63\xb6\xe2\xa6\x9f\x63\x3e\x14\x17\xb7\xd8\x65\x15\xd9\x94\x34\x0b\x5e\x24\xe9\x27\x80\x47\xf5\x78\xa0\x1d\x4e\x47\xcf\xa3\x9f\xce\xe0\xa6\x8c\x2b\xe7\xda\x78\xb6\x9b\x79\x04\x99\x98\x0e\xe5\x20\x18\x82\xc3\x9a\x7c\x19\x7f\x59\x44\xef\xbe\x3e\x19\x7f\xdd\x37\xda\x44\xdf\x7e\x68\x14\x32\x7b\x46\xfb\x76\x1f\x1b\xce\x1d\x7f\xde\x15\xc8\x74\x5c\xbe\xa1\x5a\x10\x5f\xd4\x40\x9c\x8c\xcf\xfe\x10\xab\xe4\x33\x16\x38\x8c\xc3\xfb\x96\x3a\xc0\xd5\xf0\x48\x40\xa1\x9d\x87\x8a\xc3\xe7\xc0\xf0\x8c\x48\x48\x02\xe6\x94\xce\xb8\xa2\xcf\xc1\xce\x2b\x7f\x35\x31\x33\x69\x57\x96\x54\xde\x16\xc8\x5c\x4c\x58\x25\xd0\xe5\x14\x63\xe5\x47\x0a\xb4\x5a\xa0\x41\x80\x94\x19\x3e\x20\x1e\xcb\x00\x1d\xad\xc6\xb1\xa6\x31\xeb\x9c\x54\xe8\x38\x4e\x45\xa8\xc7\xc6\x09\x95\xe0\x59\xf0\xb4\xa4\x78\xd8\xf2\xcf\x8b\xfe\xe5\xb0\x81\x30\xc1\x2e\x21\x59\x02\x24\xd0\x73\x20\x19\x9c\x39\x9d\x69\x35\xf1\xf9\xb4\xf6\x5a\xf9\x18\x5e\xbc\x05\x62\xa2\x4c\x30\xd5\x96\x24\x78\xcc\xd7\xd9\xae\x2f\x6f\xff\xe3\xc5\x72\xe2\x9d\xf4\xf7\xe3\x7c\x11\xf0\x86\x46\x6f\xa8\x21\x99\x27\xcc\x92\x14\x43\x90\x23\xd4\x17\x98\xf3\xc2\x1f\x66\xe0\xbb\x2c\xfb\x39\xa5\x63\xb3\xcd\xd7\x61\x21\x1c\xbf\x12\x76\x0b\x58\x00\x42\x1a\x7e\xbb\x2d\x3d\x84\xc2\x58\x92\xc9\x7b\xf7\x3d\x34\x6c\x9a\x19\x17\x06\x03\xd3\xf2\x23\x59\x88\x04\xd9\xfe\x42\x65\xfc\x5e\x8d\x8c\x07\xcb\x8f\x78\xb9\xd2\x78\xdc\xf2\xba\x45\xb5\xd0\xf2\xb2\x44\x35\x6b\x9d\x77\x4a\x58\x5f\xe4\xbf\x9a\x28\xd3\x75\x4d\x45\xc5\xad\x0d\xcf\xaf\xe9\xa3\xcc\xd3\xa0\x07\xc3\x9b\xb5\x0d\x0e\x62\xdc\x0a\x7a\x05\xf0\xb2\x9c\x5a\xdd\xaf\x89\xbe\x0f\x61\xc3\xd3\x7c\x8b\xc8\x39\x6e\x8f\x6c\x02\x22\xc6\x3b\x28\x1c\xb1\x33\xe8\xee\x11\x4e\xef\x52\xde\xec\x7f\x7d\x79\x10\x98\x75\x00\xdb\xfa\x4e\x54\xf8\xbd\x2f\x1c\x74\x04\x08\x16\x03\x3c\x6c\xce\xaf\x41\x4e\xcb\xe1\x10\x1f\xd8\x2e\x73\x7e\x4b\x0f\x45\x74\x76\x63\x3f\x40\xce\xef\xe0\xbc\x46\x4b\x2b\xbf\xd1\xc7\xbc\x84\x97\x19\x60\x98\x9e\xfd\xe3\x5f\xe6\xa7\xbf\x45\xf3\xe7\xd1\xfc\x94\xcd\xe7\xf1\x7c\x3e\x3e\xcc\x42\xe1\x75\xb1\x75\x32\xb8\x59\x12\x79\xd9\xa5\x36\x33\x32\xdd\xb8\xba\xeb\x8c\x7e\x86\xfd\x8f\xd9\xce\x06\xce\xe7\xf3\x3d\x21\xbc\xf6\x65\x16\xe3\x21\x66\x6c\x42\xd9\xed\x31\x81\xec\x70\xd3\xe1\xad\x55\xe2\x5f\x88\x36\x66\xbe\xab\x7b\x22\xc0\xf4\x56\xec\xfb\x8d\xf0\xfb\xaa\xd5\x59\xb5\x47\x25\x3a\x82\xf9\xf5\xd9\x1d\xd9\xf7\xad\x68\xee\x88\x16\x4a\xf3\x63\xc2\x6f\x64\x59\x3d\x58\xf8\x42\xaf\x1e\x2c\x7b\xae\xb4\x15\x0f\x96\xfe\xa4\x55\x57\xff\xbf\xf8\xb6\x97\xad\x56\xeb\x12\xcf\xb0\x9d\x6e\x0e\xfd\xbc\x0c\xac\x1d\xfa\xb1\x4e\xee\x1c\xa7\x35\xfe\xb5\x48\xfa\x6f\x07\x32\x74\x54\x02\xe4\xd2\xb5\xb3\x38\x77\x90\x9b\x0e\xce\xa5\x3e\x10\x1f\x8e\xda\x01\x39\x24\xb2\x58\x5c\x5e\x1c\x65\x2c\x2f\x3f\x1f\x64\x97\x4a\x57\x8b\x7b\xb6\xe2\x85\xe7\xbd\xf6\xbc\x47\xac\xc5\xe9\xc1\x5a\xdc\x13\x6e\xc4\xa6\xff\xbc\xf8\xb8\x21\xf8\xfc\xe9\x2e\x17\x26\xbc\x02\x08\x3a\xc6\xa3\xff\x00\x52\x7e\xb8\xfe\x61\x10\x00\x00")
 
 func defaultYmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -83,7 +83,7 @@ func defaultYml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "default.yml", size: 2065, mode: os.FileMode(420), modTime: time.Unix(1548668816, 0)}
+	info := bindataFileInfo{name: "default.yml", size: 4193, mode: os.FileMode(420), modTime: time.Unix(1792025308, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -3,9 +3,12 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/alpacahq/marketstore/cmd/backup"
 	"github.com/alpacahq/marketstore/cmd/connect"
 	"github.com/alpacahq/marketstore/cmd/create"
 	"github.com/alpacahq/marketstore/cmd/estimate"
+	"github.com/alpacahq/marketstore/cmd/query"
+	"github.com/alpacahq/marketstore/cmd/restore"
 	"github.com/alpacahq/marketstore/cmd/start"
 	"github.com/alpacahq/marketstore/cmd/tool"
 	"github.com/alpacahq/marketstore/utils"
@@ -40,6 +43,9 @@ func Execute() error {
 	c.AddCommand(start.Cmd)
 	c.AddCommand(tool.Cmd)
 	c.AddCommand(connect.Cmd)
+	c.AddCommand(query.Cmd)
+	c.AddCommand(backup.Cmd)
+	c.AddCommand(restore.Cmd)
 	c.Flags().BoolVarP(&flagPrintVersion, "version", "v", false, "show the version info and exit")
 
 	return c.Execute()
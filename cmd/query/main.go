@@ -0,0 +1,101 @@
+package query
+
+import (
+	"errors"
+
+	"github.com/alpacahq/marketstore/cmd/connect/session"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Command
+	// -------------
+	usage   = "query <sql statement>"
+	short   = "Run a SQL query against a marketstore database and output its result"
+	long    = "This command runs a SQL query against an existing marketstore database and writes its result to the terminal or a file, as a table, CSV or JSON"
+	example = "marketstore query --url localhost:5993 --format csv --output tsla.csv \"SELECT * FROM `TSLA/1Min/OHLCV`;\""
+
+	// Flags.
+	// -------------
+	// Network Address.
+	urlFlag    = "url"
+	defaultURL = ""
+	urlDesc    = "network address to database instance at \"hostname:port\" when used in remote mode"
+	// API key.
+	apiKeyFlag    = "api_key"
+	defaultAPIKey = ""
+	apiKeyDesc    = "API key sent to the database instance when used in remote mode"
+	// Local directory.
+	dirFlag    = "dir"
+	defaultDir = ""
+	dirDesc    = "filesystem path of the directory containing database files when used in local mode"
+	// Output.
+	formatFlag    = "format"
+	defaultFormat = session.TableFormat
+	formatDesc    = "format of the result, table, csv or json"
+	outputFlag    = "output"
+	defaultOutput = ""
+	outputDesc    = "file the result is written to instead of the terminal"
+)
+
+var (
+	// Cmd is the query command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    validateArgs,
+		RunE:    executeQuery,
+	}
+
+	// url set via flag for remote db address.
+	url string
+	// apiKey set via flag for remote db authentication.
+	apiKey string
+	// dir set via flag for local directory location.
+	dir string
+	// format and output file of the result
+	format, output string
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&url, urlFlag, "u", defaultURL, urlDesc)
+	Cmd.Flags().StringVarP(&apiKey, apiKeyFlag, "k", defaultAPIKey, apiKeyDesc)
+	Cmd.Flags().StringVarP(&dir, dirFlag, "d", defaultDir, dirDesc)
+	Cmd.Flags().StringVarP(&format, formatFlag, "f", defaultFormat, formatDesc)
+	Cmd.Flags().StringVarP(&output, outputFlag, "o", defaultOutput, outputDesc)
+}
+
+// validateArgs returns an error that prevents cmd execution if
+// the custom validation fails.
+func validateArgs(cmd *cobra.Command, args []string) error {
+	if len(dir) == 0 && len(url) == 0 {
+		return errors.New("cannot connect to database, use a flag to set location")
+	}
+	if len(args) != 1 {
+		return errors.New("a single SQL statement is required, quote it")
+	}
+	return nil
+}
+
+// executeQuery implements the query command.
+func executeQuery(cmd *cobra.Command, args []string) error {
+	var c *session.Client
+	var err error
+	if len(dir) != 0 {
+		c, err = session.NewLocalClient(dir)
+	} else {
+		c, err = session.NewRemoteClient(url, apiKey)
+	}
+	if err != nil {
+		return err
+	}
+	if err = c.SetOutput(format, output); err != nil {
+		return err
+	}
+	if err = c.Connect(); err != nil {
+		return err
+	}
+	return c.Query(args[0])
+}
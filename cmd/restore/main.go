@@ -0,0 +1,69 @@
+package restore
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Command
+	// -------------
+	usage   = "restore <src>"
+	short   = "Restore a marketstore database from a backup"
+	long    = "This command verifies the files of a backup against its manifest and copies them into the data directory of a stopped instance, which must hold no database files"
+	example = "marketstore restore --dir data /backup/mktsdb-2019-06-01"
+
+	// Flags.
+	// -------------
+	// Local directory.
+	dirFlag = "dir"
+	dirDesc = "filesystem path of the directory the database files are restored into"
+	// Verification only.
+	verifyFlag = "verify"
+	verifyDesc = "only verify the files of the backup against its manifest"
+)
+
+var (
+	// Cmd is the restore command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    cobra.ExactArgs(1),
+		RunE:    executeRestore,
+	}
+
+	// dir set via flag for local directory location.
+	dir string
+	// verify set via flag to only verify the backup.
+	verify bool
+)
+
+func init() {
+	Cmd.Flags().StringVarP(&dir, dirFlag, "d", "", dirDesc)
+	Cmd.Flags().BoolVar(&verify, verifyFlag, false, verifyDesc)
+}
+
+// executeRestore implements the restore command.
+func executeRestore(cmd *cobra.Command, args []string) error {
+	if verify {
+		manifest, err := executor.VerifyBackup(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d files, %d bytes verified\n", len(manifest.Files), manifest.Size())
+		return nil
+	}
+	if dir == "" {
+		return fmt.Errorf("the data directory is required, set it with --%s", dirFlag)
+	}
+	manifest, err := executor.Restore(args[0], dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d files, %d bytes restored to %s\n", len(manifest.Files), manifest.Size(), dir)
+	return nil
+}
@@ -0,0 +1,35 @@
+package start
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/cmd/tool/check"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// checkData checks the data directory as the check tool does, before the
+// WAL is replayed, logging the problems found.  In the fail mode, they are
+// returned as an error for the server not to start.
+func checkData(rootDir, mode string) error {
+	if mode != "warn" && mode != "fail" {
+		return fmt.Errorf("invalid --check-data mode %s, must be warn or fail", mode)
+	}
+	log.Info("checking data directory %s...", rootDir)
+	problems := 0
+	err := check.Dir(rootDir, false, func(relPath, problem string) {
+		log.Error("%s: %s", relPath, problem)
+		problems++
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check data directory - error: %v", err)
+	}
+	switch {
+	case problems == 0:
+		log.Info("no problem found in the data directory")
+	case mode == "fail":
+		return fmt.Errorf("found %d problems in the data directory, run marketstore tool check --repair to fix the damaged files", problems)
+	default:
+		log.Warn("found %d problems in the data directory, starting anyway", problems)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package start
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestCheckData(c *C) {
+	rootDir := c.MkDir()
+	c.Assert(checkData(rootDir, "fail"), IsNil)
+	c.Assert(checkData(rootDir, "strict"), ErrorMatches, "invalid --check-data mode .*")
+
+	c.Assert(ioutil.WriteFile(filepath.Join(rootDir, "1.walfile"), []byte("not a WAL file"), 0600), IsNil)
+	c.Assert(checkData(rootDir, "warn"), IsNil)
+	c.Assert(checkData(rootDir, "fail"), ErrorMatches, "found 1 problems in the data directory.*")
+}
@@ -1,6 +1,7 @@
 package start
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -12,10 +13,21 @@ import (
 	"time"
 
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/executor/quality"
 	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/compress"
+	"github.com/alpacahq/marketstore/frontend/limit"
+	"github.com/alpacahq/marketstore/frontend/pgwire"
+	"github.com/alpacahq/marketstore/frontend/pool"
+	"github.com/alpacahq/marketstore/frontend/requestid"
 	"github.com/alpacahq/marketstore/frontend/stream"
+	"github.com/alpacahq/marketstore/plugins"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/memlimit"
+	"github.com/alpacahq/marketstore/utils/systemd"
 	"github.com/spf13/cobra"
 )
 
@@ -26,6 +38,7 @@ const (
 	example               = "marketstore start --config <path>"
 	defaultConfigFilePath = "./mkts.yml"
 	configDesc            = "set the path for the marketstore YAML configuration file"
+	checkDataDesc         = "check the WAL, catalog and data files before serving, logging the problems found, or refusing to start on them with fail"
 )
 
 var (
@@ -41,11 +54,15 @@ var (
 	}
 	// configFilePath set flag for a path to the config file.
 	configFilePath string
+	// checkDataMode is warn or fail to check the data before serving.
+	checkDataMode string
 )
 
 func init() {
 	utils.InstanceConfig.StartTime = time.Now()
 	Cmd.Flags().StringVarP(&configFilePath, "config", "c", defaultConfigFilePath, configDesc)
+	Cmd.Flags().StringVar(&checkDataMode, "check-data", "", checkDataDesc)
+	Cmd.Flags().Lookup("check-data").NoOptDefVal = "warn"
 }
 
 // executeStart implements the start command.
@@ -66,16 +83,30 @@ func executeStart(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to parse configuration file error: %v", err.Error())
 	}
 
+	// Size the buffers to the memory limit of the container, if any.
+	memoryLimit, err := memlimit.Init(utils.InstanceConfig.MemoryLimit)
+	if err != nil {
+		log.Warn("unable to detect the memory limit of the cgroup - error: %v", err)
+	}
+	if memoryLimit > 0 {
+		log.Info("sizing the buffers to a memory limit of %d bytes", memoryLimit)
+	}
+
 	// Spawn a goroutine and listen for a signal.
-	signalChan := make(chan os.Signal)
+	signalChan := make(chan os.Signal, 1)
 	go func() {
 		for s := range signalChan {
 			switch s {
 			case syscall.SIGUSR1:
 				log.Info("dumping stack traces due to SIGUSR1 request")
 				pprof.Lookup("goroutine").WriteTo(os.Stdout, 1)
-			case syscall.SIGINT:
-				log.Info("initiating graceful shutdown due to SIGINT request")
+			case syscall.SIGHUP:
+				log.Info("reloading configuration due to SIGHUP request")
+				if _, err := ReloadConfig(); err != nil {
+					log.Error("failed to reload configuration - error: %v", err)
+				}
+			case syscall.SIGINT, syscall.SIGTERM:
+				log.Info("initiating graceful shutdown due to %v request", s)
 				atomic.StoreUint32(&frontend.Queryable, uint32(0))
 				log.Info("waiting a grace period of %v to shutdown...", utils.InstanceConfig.StopGracePeriod)
 				time.Sleep(utils.InstanceConfig.StopGracePeriod)
@@ -85,6 +116,26 @@ func executeStart(cmd *cobra.Command, args []string) error {
 	}()
 	signal.Notify(signalChan, syscall.SIGUSR1)
 	signal.Notify(signalChan, syscall.SIGINT)
+	signal.Notify(signalChan, syscall.SIGTERM)
+	signal.Notify(signalChan, syscall.SIGHUP)
+
+	// Check the data before the WAL is replayed, if requested.
+	if checkDataMode != "" {
+		if err := checkData(utils.InstanceConfig.RootDirectory, checkDataMode); err != nil {
+			return err
+		}
+	}
+
+	// Set health check handlers, answering during the startup.
+	http.HandleFunc("/healthz", frontend.Healthz)
+	http.HandleFunc("/readyz", frontend.Readyz)
+	http.HandleFunc("/startupz", frontend.Startupz)
+
+	if utils.InstanceConfig.UtilitiesURL != "" {
+		// Start utility endpoints, probed while the WAL is replayed.
+		log.Info("launching utility service...")
+		go frontend.Utilities(utils.InstanceConfig.UtilitiesURL)
+	}
 
 	// Initialize marketstore services.
 	// --------------------------------
@@ -98,43 +149,134 @@ func executeStart(cmd *cobra.Command, args []string) error {
 		utils.InstanceConfig.BackgroundSync,
 		utils.InstanceConfig.WALBypass)
 
+	// Reject the writes while the disk is nearly full.
+	go executor.WatchDisk(context.Background())
+
+	// Alert on the live feeds no longer writing while their market is open.
+	go executor.WatchFeeds(context.Background())
+
+	// Analyze the quality of the configured buckets on schedule.
+	go quality.Schedule(context.Background())
+
+	// Set API keys, if any.
+	if err := auth.Initialize(utils.InstanceConfig.APIKeys); err != nil {
+		return fmt.Errorf("failed to set API keys - error: %s", err.Error())
+	}
+
+	// Open the audit log, if any.
+	if err := audit.Initialize(utils.InstanceConfig.AuditLog); err != nil {
+		return fmt.Errorf("failed to open audit log - error: %s", err.Error())
+	}
+
+	// Set per client limits, if any.
+	limit.Initialize(
+		utils.InstanceConfig.ClientRateLimit,
+		utils.InstanceConfig.ClientRateBurst,
+		utils.InstanceConfig.ClientMaxQueries)
+
+	// Set the worker pool, if any.
+	pool.Initialize(
+		utils.InstanceConfig.FrontendWorkers,
+		utils.InstanceConfig.FrontendQueueDepth)
+
 	// New server.
-	server, _ := frontend.NewServer()
+	server, service := frontend.NewServer()
 
 	// Set rpc handler.
 	log.Info("launching rpc data server...")
-	go http.Handle("/rpc", server)
+	go http.Handle("/rpc", requestid.Handler(limit.Handler(pool.Handler(compress.Handler(server)))))
+
+	// Set REST handler.
+	log.Info("launching rest data server...")
+	go http.Handle("/v1/", requestid.Handler(limit.Handler(pool.Handler(compress.Handler(frontend.NewRestServer(service))))))
+
+	// Set Grafana JSON datasource handler.
+	go http.Handle("/grafana/", requestid.Handler(limit.Handler(pool.Handler(compress.Handler(frontend.NewGrafanaServer(service))))))
+
+	// Set Prometheus remote storage handlers.
+	go http.Handle("/prometheus/write", requestid.Handler(limit.Handler(pool.Handler(http.HandlerFunc(frontend.PrometheusWrite)))))
+	go http.Handle("/prometheus/read", requestid.Handler(limit.Handler(pool.Handler(http.HandlerFunc(frontend.PrometheusRead)))))
 
 	// Set websocket handler.
 	log.Info("initializing websocket...")
 	stream.Initialize()
-	go http.HandleFunc("/ws", stream.Handler)
+	go http.Handle("/ws", limit.Handler(http.HandlerFunc(stream.Handler)))
+	go http.Handle("/events", limit.Handler(http.HandlerFunc(stream.EventsHandler)))
+
+	// Replay the stored data over the streams, in replay mode.
+	if utils.InstanceConfig.Replay != nil {
+		go func() {
+			if err := stream.Replay(context.Background(), utils.InstanceConfig.Replay); err != nil {
+				log.Error("failed to replay the stored data (%v)", err)
+			}
+		}()
+	}
+
+	// Set the profiling and runtime variables handlers, if enabled.
+	if utils.InstanceConfig.Diagnostics {
+		log.Info("enabling diagnostics endpoints...")
+		frontend.Diagnostics(http.DefaultServeMux)
+	}
 
-	// Initialize any provided plugins.
+	// Initialize any provided plugins, reloaded by the admin RPCs.
+	plugins.SearchPaths = utils.InstanceConfig.PluginPaths
 	InitializeTriggers()
+	ReconcileTriggers()
 	RunBgWorkers()
+	frontend.PluginReloader = Reload
+	frontend.ConfigReloader = ReloadConfig
 
-	if utils.InstanceConfig.UtilitiesURL != "" {
-		// Start utility endpoints.
-		log.Info("launching utility service...")
-		go frontend.Utilities(utils.InstanceConfig.UtilitiesURL)
+	if utils.InstanceConfig.PGWireURL != "" {
+		// Start the Postgres wire protocol listener.
+		log.Info("launching pgwire listener on %s...", utils.InstanceConfig.PGWireURL)
+		go func() {
+			if err := pgwire.NewServer(service).ListenAndServe(utils.InstanceConfig.PGWireURL, utils.InstanceConfig.ListenTLS); err != nil {
+				log.Error("Failed to start pgwire listener - Error: %v", err)
+			}
+		}()
 	}
 
 	log.Info("enabling query access...")
 	atomic.StoreUint32(&frontend.Queryable, 1)
+	frontend.StartupDone(utils.InstanceConfig.StartupProbeDelay)
+	go notifyReady(utils.InstanceConfig.StartupProbeDelay)
 
 	// Serve.
 	log.Info("launching tcp listener for all services...")
-	if err := http.ListenAndServe(utils.InstanceConfig.ListenURL, nil); err != nil {
+	err = frontend.ListenAndServe(utils.InstanceConfig.ListenURL, nil, utils.InstanceConfig.ListenTLS)
+	if err == http.ErrServerClosed {
+		// shutting down, shutdown exits
+		select {}
+	}
+	if err != nil {
 		return fmt.Errorf("failed to start server - error: %s", err.Error())
 	}
 
 	return nil
 }
 
+// shutdown stops the server cleanly within the shutdown timeout: the
+// listener stops accepting requests and waits for those being served, the
+// background workers are stopped, and the writes drained and checkpointed
+// for the WAL not to be replayed on restart.  Past the timeout, the server
+// exits with the WAL left to replay.
 func shutdown() {
-	executor.ThisInstance.ShutdownPending = true
-	executor.ThisInstance.WALWg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), utils.InstanceConfig.ShutdownTimeout)
+	defer cancel()
+	code := 0
+
+	systemd.Notify(systemd.Stopping)
+	log.Info("closing the listener and waiting for the running requests...")
+	if err := frontend.Shutdown(ctx); err != nil {
+		log.Error("failed to wait for the running requests - error: %v", err)
+	}
+	StopBgWorkers()
+	log.Info("draining the writes and checkpointing...")
+	if err := executor.Shutdown(ctx); err != nil {
+		log.Error("failed to shutdown within %v, the WAL will be replayed on startup - error: %v",
+			utils.InstanceConfig.ShutdownTimeout, err)
+		code = 1
+	}
 	log.Info("exiting...")
-	os.Exit(0)
+	os.Exit(code)
 }
@@ -1,7 +1,20 @@
 package start
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	// the contrib modules selectable by name, without loading their .so
+	_ "github.com/alpacahq/marketstore/contrib/builtin"
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
 	"github.com/alpacahq/marketstore/plugins"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/plugins/trigger"
@@ -9,19 +22,141 @@ import (
 	"github.com/alpacahq/marketstore/utils/log"
 )
 
+var (
+	// pluginsMu serializes the loads and reloads of the plugins
+	pluginsMu sync.Mutex
+	// the loaded triggers and started bgworkers with their settings
+	triggers  []*loadedTrigger
+	bgWorkers []*startedBgWorker
+	// whether the bgworkers are started, for the plugins to be reloaded
+	started bool
+
+	// newTriggerMatcher and newBgWorker load the plugins of the settings
+	newTriggerMatcher = NewTriggerMatcher
+	newBgWorker       = NewBgWorker
+)
+
+type loadedTrigger struct {
+	setting *utils.TriggerSetting
+	matcher *trigger.TriggerMatcher
+}
+
+type startedBgWorker struct {
+	setting    *utils.BgWorkerSetting
+	supervisor *bgworker.Supervisor
+}
+
+// stoppable returns whether the worker implements bgworker.Stopper
+func (sw *startedBgWorker) stoppable() bool {
+	_, ok := sw.supervisor.Worker().(bgworker.Stopper)
+	return ok
+}
+
 func InitializeTriggers() {
 	log.Info("InitializeTriggers")
-	config := utils.InstanceConfig
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	triggers, _, _ = loadTriggers(utils.InstanceConfig.Triggers, nil)
+	executor.SetTriggerMatchers(matchers(triggers))
+	log.Info("InitializeTriggers - Done")
+}
+
+// loadTriggers returns the triggers of the settings, reusing those of the
+// previous ones with identical settings, the newly loaded matchers and which
+// of the previous triggers are reused
+func loadTriggers(settings []*utils.TriggerSetting, previous []*loadedTrigger) (
+	loaded []*loadedTrigger, fresh []*trigger.TriggerMatcher, reused []bool) {
+	reused = make([]bool, len(previous))
+	byName := map[string]*trigger.TriggerMatcher{}
+	for _, triggerSetting := range settings {
+		var tmatcher *trigger.TriggerMatcher
+		for i, lt := range previous {
+			if !reused[i] && reflect.DeepEqual(lt.setting, triggerSetting) {
+				// a copy with the same trigger and breaker, for its after
+				// list to be linked while the previous one is fired
+				reused[i] = true
+				copied := *lt.matcher
+				copied.After = nil
+				tmatcher = &copied
+				break
+			}
+		}
+		if tmatcher == nil {
+			log.Info("triggerSetting = %v", triggerSetting)
+			if tmatcher = newTriggerMatcher(triggerSetting); tmatcher == nil {
+				continue
+			}
+			fresh = append(fresh, tmatcher)
+		}
+		loaded = append(loaded, &loadedTrigger{setting: triggerSetting, matcher: tmatcher})
+		byName[triggerSetting.Name] = tmatcher
+	}
+	// the triggers in the after lists are named uniquely and do not depend
+	// on each other in a cycle, as checked by the configuration
+	for _, lt := range loaded {
+		for _, name := range lt.setting.After {
+			before, ok := byName[name]
+			if !ok {
+				log.Error("Trigger %s is after %s, which failed to load", lt.setting.Name, name)
+				continue
+			}
+			lt.matcher.After = append(lt.matcher.After, before)
+		}
+	}
+	return loaded, fresh, reused
+}
+
+func matchers(loaded []*loadedTrigger) []*trigger.TriggerMatcher {
+	tmatchers := make([]*trigger.TriggerMatcher, len(loaded))
+	for i, lt := range loaded {
+		tmatchers[i] = lt.matcher
+	}
+	return tmatchers
+}
+
+// ReconcileTriggers lets the triggers implementing trigger.Reconciler catch
+// up in the background with the writes made while they were not running.
+func ReconcileTriggers() {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	reconcileTriggers(matchers(triggers))
+}
+
+func reconcileTriggers(tmatchers []*trigger.TriggerMatcher) {
 	theInstance := executor.ThisInstance
-	for _, triggerSetting := range config.Triggers {
-		log.Info("triggerSetting = %v", triggerSetting)
-		tmatcher := NewTriggerMatcher(triggerSetting)
-		if tmatcher != nil {
-			theInstance.TriggerMatchers = append(
-				theInstance.TriggerMatchers, tmatcher)
+	var keyPaths []string
+	for _, info := range theInstance.CatalogDir.GatherTimeBucketInfo() {
+		keyPath, err := filepath.Rel(theInstance.RootDir, info.Path)
+		if err != nil {
+			continue
 		}
+		keyPaths = append(keyPaths, filepath.ToSlash(keyPath))
 	}
-	log.Info("InitializeTriggers - Done")
+	sort.Strings(keyPaths)
+	for _, tmatcher := range tmatchers {
+		reconciler, ok := tmatcher.Trigger.(trigger.Reconciler)
+		if !ok {
+			continue
+		}
+		var matched []string
+		for _, keyPath := range keyPaths {
+			if tmatcher.Match(keyPath) {
+				matched = append(matched, keyPath)
+			}
+		}
+		go reconcile(reconciler, tmatcher.PluginName(), matched)
+	}
+}
+
+func reconcile(reconciler trigger.Reconciler, plugin string, keyPaths []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("recovering from %v\n%s", r, string(debug.Stack()))
+		}
+	}()
+	log.Info("Reconciling trigger %s with %d file(s)...", plugin, len(keyPaths))
+	reconciler.Reconcile(keyPaths)
+	log.Info("Reconciling trigger %s - Done", plugin)
 }
 
 func NewTriggerMatcher(ts *utils.TriggerSetting) *trigger.TriggerMatcher {
@@ -35,27 +170,166 @@ func NewTriggerMatcher(ts *utils.TriggerSetting) *trigger.TriggerMatcher {
 		log.Error("Error returned while creating a trigger: %v", err)
 		return nil
 	}
-	return trigger.NewMatcher(trig, ts.On)
+	tmatcher := trigger.NewMatcher(trig, ts.On)
+	tmatcher.Name = ts.Name
+	if tmatcher.Name == "" {
+		tmatcher.Name = ts.Module
+	}
+	tmatcher.Retries = ts.Retries
+	tmatcher.RetryDelay = ts.RetryDelay
+	tmatcher.Breaker = trigger.NewBreaker(ts.BreakerThreshold, ts.BreakerCooldown)
+	return tmatcher
 }
 
 func RunBgWorkers() {
 	log.Info("InitializeBgWorkers")
-	config := utils.InstanceConfig
-	for _, bgWorkerSetting := range config.BgWorkers {
-		// bgWorkerSetting may contain sensitive data such as a password or token.
-		log.Debug("bgWorkerSetting = %v", bgWorkerSetting)
-		bgWorker := NewBgWorker(bgWorkerSetting)
-		if bgWorker != nil {
-			// we should probably keep track of this process status
-			// and may want to kill it or get info.  utils.Process may help
-			// but will figure it out later.
-			log.Info("Start running BgWorker %s...", bgWorkerSetting.Name)
-			go bgWorker.Run()
-		}
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	for _, bgWorkerSetting := range utils.InstanceConfig.BgWorkers {
+		startBgWorker(bgWorkerSetting)
 	}
+	started = true
 	log.Info("InitializeBgWorkers Done")
 }
 
+// startBgWorker starts the bgworker of the setting, returning false if it
+// failed to load
+func startBgWorker(bgWorkerSetting *utils.BgWorkerSetting) bool {
+	// bgWorkerSetting may contain sensitive data such as a password or token.
+	log.Debug("bgWorkerSetting = %v", bgWorkerSetting)
+	bgWorker := newBgWorker(bgWorkerSetting)
+	if bgWorker == nil {
+		return false
+	}
+	log.Info("Start running BgWorker %s...", bgWorkerSetting.Name)
+	policy := bgworker.Policy{
+		Restart:     bgWorkerSetting.Restart,
+		Delay:       bgWorkerSetting.RestartDelay,
+		MaxDelay:    bgWorkerSetting.RestartMaxDelay,
+		MaxRestarts: bgWorkerSetting.MaxRestarts,
+	}
+	supervisor := bgworker.Supervise(bgWorkerSetting.Name, policy, bgWorker, func() (bgworker.BgWorker, error) {
+		if w := newBgWorker(bgWorkerSetting); w != nil {
+			return w, nil
+		}
+		return nil, fmt.Errorf("failed to load %s", bgWorkerSetting.Module)
+	})
+	bgWorkers = append(bgWorkers, &startedBgWorker{setting: bgWorkerSetting, supervisor: supervisor})
+	return true
+}
+
+// Reload reloads the triggers and bgworkers of the configuration file while
+// the server is running.  The triggers and bgworkers of unchanged settings
+// keep running, the others are replaced by those of their new settings,
+// except the bgworkers which cannot be stopped.  The writes made meanwhile
+// fire either the previous triggers or the new ones, which reconcile.
+func Reload() (*frontend.ReloadPluginsResponse, error) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if !started {
+		return nil, errors.New("plugins are not initialized yet")
+	}
+	data, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file error: %s", err.Error())
+	}
+	triggerSettings, bgWorkerSettings, err := utils.ParsePlugins(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file error: %v", err.Error())
+	}
+	return reloadPlugins(triggerSettings, bgWorkerSettings), nil
+}
+
+// reloadPlugins replaces the triggers and bgworkers by those of the
+// settings.  Must be called with pluginsMu held.
+func reloadPlugins(triggerSettings []*utils.TriggerSetting, bgWorkerSettings []*utils.BgWorkerSetting) *frontend.ReloadPluginsResponse {
+	response := &frontend.ReloadPluginsResponse{}
+	reloadTriggers(triggerSettings, response)
+	reloadBgWorkers(bgWorkerSettings, response)
+	utils.InstanceConfig.Triggers = triggerSettings
+	utils.InstanceConfig.BgWorkers = bgWorkerSettings
+	return response
+}
+
+func reloadTriggers(settings []*utils.TriggerSetting, response *frontend.ReloadPluginsResponse) {
+	loaded, fresh, reused := loadTriggers(settings, triggers)
+	executor.SetTriggerMatchers(matchers(loaded))
+	reconcileTriggers(fresh)
+
+	for _, tmatcher := range fresh {
+		response.Started = append(response.Started, tmatcher.PluginName())
+	}
+	for i, lt := range triggers {
+		if reused[i] {
+			response.Kept = append(response.Kept, lt.matcher.PluginName())
+		} else {
+			log.Info("Trigger %s unloaded", lt.matcher.PluginName())
+			// such as the triggers of plugin processes, which exit
+			if closer, ok := lt.matcher.Trigger.(io.Closer); ok {
+				closer.Close()
+			}
+			response.Stopped = append(response.Stopped, lt.matcher.PluginName())
+		}
+	}
+	triggers = loaded
+}
+
+func reloadBgWorkers(settings []*utils.BgWorkerSetting, response *frontend.ReloadPluginsResponse) {
+	previous := bgWorkers
+	bgWorkers = nil
+	unchanged := make([]bool, len(settings))
+	indexOf := func(match func(*utils.BgWorkerSetting) bool) int {
+		for i, setting := range settings {
+			if !unchanged[i] && match(setting) {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, sw := range previous {
+		if i := indexOf(func(s *utils.BgWorkerSetting) bool { return reflect.DeepEqual(s, sw.setting) }); i >= 0 {
+			unchanged[i] = true
+			bgWorkers = append(bgWorkers, sw)
+			response.Kept = append(response.Kept, sw.setting.Name)
+			continue
+		}
+		if !sw.stoppable() {
+			// not started again with its new setting, if any, for both not
+			// to run at once
+			if i := indexOf(func(s *utils.BgWorkerSetting) bool { return s.Name == sw.setting.Name }); i >= 0 {
+				unchanged[i] = true
+			}
+			log.Warn("BgWorker %s cannot be stopped, restart the server for its new setting", sw.setting.Name)
+			bgWorkers = append(bgWorkers, sw)
+			response.Pending = append(response.Pending, sw.setting.Name)
+			continue
+		}
+		log.Info("Stop running BgWorker %s...", sw.setting.Name)
+		sw.supervisor.Stop()
+		response.Stopped = append(response.Stopped, sw.setting.Name)
+	}
+	for i, bgWorkerSetting := range settings {
+		if !unchanged[i] && startBgWorker(bgWorkerSetting) {
+			response.Started = append(response.Started, bgWorkerSetting.Name)
+		}
+	}
+}
+
+// StopBgWorkers stops the background workers implementing bgworker.Stopper,
+// for them not to write while the server shuts down.  The writes of the
+// others are rejected once drained.
+func StopBgWorkers() {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	for _, sw := range bgWorkers {
+		if sw.stoppable() {
+			log.Info("Stop running BgWorker %s...", sw.setting.Name)
+		}
+		// and no longer restarted
+		sw.supervisor.Stop()
+	}
+}
+
 func NewBgWorker(s *utils.BgWorkerSetting) bgworker.BgWorker {
 	loader, err := plugins.NewSymbolLoader(s.Module)
 	if err != nil {
@@ -0,0 +1,153 @@
+package start
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+type stubTrigger struct {
+	on string
+}
+
+func (t *stubTrigger) Fire(keyPath string, records []trigger.Record) {}
+
+// feeder cannot be stopped
+type feeder struct{}
+
+func (w *feeder) Run() { select {} }
+
+type stoppable struct {
+	stop chan struct{}
+}
+
+func (w *stoppable) Run()  { <-w.stop }
+func (w *stoppable) Stop() { close(w.stop) }
+
+func (t *TestSuite) TestReload(c *C) {
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(rootDir, true, true, false, true)
+
+	defer func() {
+		newTriggerMatcher, newBgWorker = NewTriggerMatcher, NewBgWorker
+		triggers, bgWorkers, started = nil, nil, false
+	}()
+	newTriggerMatcher = func(ts *utils.TriggerSetting) *trigger.TriggerMatcher {
+		tmatcher := trigger.NewMatcher(&stubTrigger{on: ts.On}, ts.On)
+		tmatcher.Name = ts.Name
+		return tmatcher
+	}
+	var stopped []*stoppable
+	newBgWorker = func(s *utils.BgWorkerSetting) bgworker.BgWorker {
+		if s.Module == "feeder.so" {
+			return &feeder{}
+		}
+		w := &stoppable{stop: make(chan struct{})}
+		stopped = append(stopped, w)
+		return w
+	}
+
+	configFilePath = filepath.Join(c.MkDir(), "mkts.yml")
+	load := func(config string) {
+		c.Assert(ioutil.WriteFile(configFilePath, []byte(config), 0644), IsNil)
+	}
+	load(`
+triggers:
+  - module: a.so
+    on: "*/1Min/OHLCV"
+  - module: b.so
+    name: b
+    on: "*/1Min/OHLCV"
+    after: [a.so]
+bgworkers:
+  - module: feeder.so
+    name: feed
+    config: {symbols: [BTC]}
+  - module: scheduler.so
+    name: cron
+    config: {jobs: 1}
+`)
+	_, err := Reload()
+	c.Assert(err, NotNil)
+
+	data, _ := ioutil.ReadFile(configFilePath)
+	utils.InstanceConfig.Triggers, utils.InstanceConfig.BgWorkers, err = utils.ParsePlugins(data)
+	c.Assert(err, IsNil)
+	InitializeTriggers()
+	RunBgWorkers()
+	before := executor.ThisInstance.TriggerMatchers
+	c.Assert(before, HasLen, 2)
+	c.Assert(before[1].After, DeepEquals, []*trigger.TriggerMatcher{before[0]})
+
+	load(`
+triggers:
+  - module: a.so
+    on: "*/1Min/OHLCV"
+  - module: b.so
+    name: b
+    on: "*/5Min/OHLCV"
+    after: [a.so]
+  - module: c.so
+    on: "*/1D/OHLCV"
+bgworkers:
+  - module: feeder.so
+    name: feed
+    config: {symbols: [ETH]}
+  - module: scheduler.so
+    name: cron
+    config: {jobs: 2}
+  - module: scheduler.so
+    name: extra
+`)
+	response, err := Reload()
+	c.Assert(err, IsNil)
+	c.Assert(*response, DeepEquals, frontend.ReloadPluginsResponse{
+		Started: []string{"b", "c.so", "cron", "extra"},
+		Stopped: []string{"b", "cron"},
+		Kept:    []string{"a.so"},
+		Pending: []string{"feed"},
+	})
+
+	after := executor.ThisInstance.TriggerMatchers
+	c.Assert(after, HasLen, 3)
+	c.Assert(after[0].Trigger, Equals, before[0].Trigger)
+	c.Assert(after[1].Trigger, Not(Equals), before[1].Trigger)
+	c.Assert(after[1].On, Equals, "*/5Min/OHLCV")
+	c.Assert(after[1].After, DeepEquals, []*trigger.TriggerMatcher{after[0]})
+	c.Assert(utils.InstanceConfig.Triggers, HasLen, 3)
+
+	// the previous cron is stopped, the feed keeps running
+	c.Assert(stopped, HasLen, 3)
+	select {
+	case <-stopped[0].stop:
+	default:
+		c.Fatal("cron is not stopped")
+	}
+	c.Assert(bgWorkers, HasLen, 3)
+	c.Assert(bgWorkers[0].setting.Config["symbols"], DeepEquals, []interface{}{"BTC"})
+
+	// an invalid configuration changes nothing
+	load(`
+triggers:
+  - module: a.so
+    after: [z.so]
+`)
+	_, err = Reload()
+	c.Assert(err, NotNil)
+	c.Assert(executor.ThisInstance.TriggerMatchers, DeepEquals, after)
+}
@@ -0,0 +1,95 @@
+package start
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/frontend/limit"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// ReloadConfig reloads the reloadable settings of the configuration file
+// while the server is running: the log levels, the query and client limits,
+// the free disk space thresholds and the plugins, as Reload does for them.  The
+// other settings only take effect on restart.  An invalid configuration
+// changes nothing.
+func ReloadConfig() (*frontend.ReloadConfigResponse, error) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if !started {
+		return nil, errors.New("plugins are not initialized yet")
+	}
+	data, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file error: %s", err.Error())
+	}
+	settings, err := utils.ParseReloadable(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file error: %v", err.Error())
+	}
+	response := &frontend.ReloadConfigResponse{Changed: applySettings(settings)}
+	for _, change := range response.Changed {
+		log.Info("reloaded %s", change)
+	}
+	response.Plugins = *reloadPlugins(settings.Triggers, settings.BgWorkers)
+	return response, nil
+}
+
+// applySettings applies the settings other than the plugins, and returns
+// those which changed
+func applySettings(settings *utils.ReloadableSettings) (changed []string) {
+	config := &utils.InstanceConfig
+	set := func(name string, current, value interface{}) bool {
+		if current == value {
+			return false
+		}
+		changed = append(changed, fmt.Sprintf("%s: %v", name, value))
+		return true
+	}
+
+	if settings.LogLevel != nil && set("log_level", log.GetLevel(), *settings.LogLevel) {
+		log.SetLevel(*settings.LogLevel)
+	}
+	if levels := log.GetComponentLevels(); !reflect.DeepEqual(levels, settings.LogLevels) {
+		changed = append(changed, fmt.Sprintf("log_levels: %v", settings.LogLevels))
+		log.SetComponentLevels(settings.LogLevels)
+	}
+
+	if set("query_max_rows_scanned", config.QueryMaxRowsScanned, settings.QueryMaxRowsScanned) {
+		config.QueryMaxRowsScanned = settings.QueryMaxRowsScanned
+	}
+	if set("query_max_bytes_read", config.QueryMaxBytesRead, settings.QueryMaxBytesRead) {
+		config.QueryMaxBytesRead = settings.QueryMaxBytesRead
+	}
+	if set("query_max_memory", config.QueryMaxMemory, settings.QueryMaxMemory) {
+		config.QueryMaxMemory = settings.QueryMaxMemory
+	}
+
+	clientLimits := false
+	if set("client_rate_limit", config.ClientRateLimit, settings.ClientRateLimit) {
+		config.ClientRateLimit, clientLimits = settings.ClientRateLimit, true
+	}
+	if set("client_rate_burst", config.ClientRateBurst, settings.ClientRateBurst) {
+		config.ClientRateBurst, clientLimits = settings.ClientRateBurst, true
+	}
+	if set("client_max_queries", config.ClientMaxQueries, settings.ClientMaxQueries) {
+		config.ClientMaxQueries, clientLimits = settings.ClientMaxQueries, true
+	}
+	if clientLimits {
+		// the clients keep their tokens and running queries
+		limit.Update(config.ClientRateLimit, config.ClientRateBurst, config.ClientMaxQueries)
+	}
+
+	if set("min_free_disk_space", config.MinFreeDiskSpace, settings.MinFreeDiskSpace) {
+		config.MinFreeDiskSpace = settings.MinFreeDiskSpace
+	}
+	if set("read_only_free_disk_space", config.ReadOnlyFreeDiskSpace, settings.ReadOnlyFreeDiskSpace) {
+		// applied by the next check of the disk watchdog
+		config.ReadOnlyFreeDiskSpace = settings.ReadOnlyFreeDiskSpace
+	}
+	return changed
+}
@@ -0,0 +1,99 @@
+package start
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+	. "gopkg.in/check.v1"
+)
+
+func (t *TestSuite) TestReloadConfig(c *C) {
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(rootDir, true, true, false, true)
+
+	defer func(level log.Level, config utils.MktsConfig) {
+		newTriggerMatcher = NewTriggerMatcher
+		triggers, bgWorkers, started = nil, nil, false
+		log.SetLevel(level)
+		log.SetComponentLevels(nil)
+		utils.InstanceConfig = config
+	}(log.GetLevel(), utils.InstanceConfig)
+	newTriggerMatcher = func(ts *utils.TriggerSetting) *trigger.TriggerMatcher {
+		tmatcher := trigger.NewMatcher(&stubTrigger{on: ts.On}, ts.On)
+		tmatcher.Name = ts.Name
+		return tmatcher
+	}
+
+	configFilePath = filepath.Join(c.MkDir(), "mkts.yml")
+	load := func(config string) {
+		c.Assert(ioutil.WriteFile(configFilePath, []byte(config), 0644), IsNil)
+	}
+	load(`
+root_directory: /data
+listen_port: 5993
+log_level: info
+query_max_rows_scanned: 1000
+`)
+	data, _ := ioutil.ReadFile(configFilePath)
+	c.Assert(utils.InstanceConfig.Parse(data), IsNil)
+	InitializeTriggers()
+	RunBgWorkers()
+
+	// the other settings are left to a restart
+	load(`
+root_directory: /other
+listen_port: 5994
+log_level: warning
+log_levels:
+  plugins: error
+query_max_rows_scanned: 1000
+client_max_queries: 4
+triggers:
+  - module: a.so
+    on: "*/1Min/OHLCV"
+`)
+	response, err := ReloadConfig()
+	c.Assert(err, IsNil)
+	c.Assert(*response, DeepEquals, frontend.ReloadConfigResponse{
+		Changed: []string{"log_level: warning", "log_levels: map[plugins:error]", "client_max_queries: 4"},
+		Plugins: frontend.ReloadPluginsResponse{Started: []string{"a.so"}},
+	})
+	c.Assert(log.GetLevel(), Equals, log.WARNING)
+	c.Assert(log.GetComponentLevels(), DeepEquals, map[string]log.Level{"plugins": log.ERROR})
+	c.Assert(utils.InstanceConfig.ClientMaxQueries, Equals, 4)
+	c.Assert(utils.InstanceConfig.RootDirectory, Equals, "/data")
+	c.Assert(executor.ThisInstance.TriggerMatchers, HasLen, 1)
+
+	// an invalid configuration changes nothing
+	load(`
+log_level: debug
+query_max_memory: -1
+`)
+	_, err = ReloadConfig()
+	c.Assert(err, NotNil)
+	c.Assert(log.GetLevel(), Equals, log.WARNING)
+	c.Assert(executor.ThisInstance.TriggerMatchers, HasLen, 1)
+
+	// without changes
+	load(`
+log_level: warning
+log_levels:
+  plugins: error
+query_max_rows_scanned: 1000
+client_max_queries: 4
+triggers:
+  - module: a.so
+    on: "*/1Min/OHLCV"
+`)
+	response, err = ReloadConfig()
+	c.Assert(err, IsNil)
+	c.Assert(response.Changed, HasLen, 0)
+	c.Assert(response.Plugins.Kept, DeepEquals, []string{"a.so"})
+}
@@ -0,0 +1,44 @@
+package start
+
+import (
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/systemd"
+)
+
+// notifyReady tells the service manager, if any, that the server is ready
+// once the startup delay has elapsed, then keeps its watchdog from
+// restarting the server as long as the WAL can be written
+func notifyReady(delay time.Duration) {
+	time.Sleep(delay)
+	sent, err := systemd.Notify(systemd.Ready, systemd.Status("serving"))
+	if err != nil {
+		log.Error("failed to notify the service manager - error: %v", err)
+		return
+	}
+	interval := systemd.WatchdogInterval()
+	if !sent || interval == 0 {
+		return
+	}
+	log.Info("notifying the service manager watchdog every %v", interval/2)
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := walHealthy(); err != nil {
+			// the watchdog restarts the server
+			log.Error("not notifying the watchdog - error: %v", err)
+			continue
+		}
+		systemd.Notify(systemd.Watchdog)
+	}
+}
+
+func walHealthy() error {
+	instance := executor.ThisInstance
+	if instance.WALBypass || instance.WALFile == nil {
+		return nil
+	}
+	return instance.WALFile.Healthy()
+}
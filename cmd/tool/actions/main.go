@@ -0,0 +1,177 @@
+package actions
+
+import (
+	"encoding/csv"
+	"fmt"
+	stdio "io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "actions"
+	short   = "List or import the corporate actions of the symbols"
+	long    = "This command lists the corporate actions of the symbols of an instance or data directory, by which their queries and aggregates are adjusted, or imports them from a CSV file with the symbol, kind, ex_date, ratio, amount and new_symbol columns, the kind being split, dividend, symbol_change or merger. The actions of the file can be removed instead, such as those imported by mistake."
+	example = "marketstore tool actions --target localhost:5993 --import actions.csv\n  marketstore tool actions --target localhost:5993 --symbols AAPL,MSFT"
+
+	// Flag descriptions.
+	targetDesc  = "instance at \"hostname:port\", or data directory, of the actions"
+	apiKeyDesc  = "API key sent to the instance"
+	importDesc  = "CSV file of the actions to import"
+	removeDesc  = "remove the actions of the CSV file instead of importing them, default is false"
+	symbolsDesc = "comma separated symbols whose actions are listed, all of them by default"
+)
+
+var (
+	// Available flags.
+	target, apiKey string
+	importFile     string
+	remove         bool
+	symbols        string
+
+	// Cmd is the actions command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeActions,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().StringVar(&importFile, "import", "", importDesc)
+	Cmd.Flags().BoolVar(&remove, "remove", false, removeDesc)
+	Cmd.Flags().StringVar(&symbols, "symbols", "", symbolsDesc)
+}
+
+// executeActions implements the actions tool.
+func executeActions(cmd *cobra.Command, args []string) error {
+	ep := endpoint.New(target, apiKey)
+	if importFile == "" {
+		var response frontend.GetCorporateActionsResponse
+		listed := &frontend.GetCorporateActionsArgs{}
+		if symbols != "" {
+			listed.Symbols = strings.Split(symbols, ",")
+		}
+		if err := ep.Call("GetCorporateActions", listed, &response); err != nil {
+			return err
+		}
+		for _, a := range response.Actions {
+			fmt.Println(format(a))
+		}
+		return nil
+	}
+
+	f, err := os.Open(importFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	actions, err := readActions(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", importFile, err)
+	}
+	method, done := "AddCorporateActions", "added"
+	if remove {
+		method, done = "RemoveCorporateActions", "removed"
+	}
+	var response frontend.CorporateActionsResponse
+	if err = ep.Call(method, &frontend.CorporateActionsArgs{Actions: actions}, &response); err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d actions %s\n", response.Count, len(actions), done)
+	return nil
+}
+
+// readActions returns the actions of the CSV records, after a header naming
+// their columns, whose ex_date is either 2006-01-02 or an epoch
+func readActions(r stdio.Reader) ([]corpaction.Action, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no header")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"symbol", "kind", "ex_date"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("no %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(record []string, name string) (float64, error) {
+		if value := field(record, name); value != "" {
+			return strconv.ParseFloat(value, 64)
+		}
+		return 0, nil
+	}
+	actions := make([]corpaction.Action, 0, len(records)-1)
+	for n, record := range records[1:] {
+		a := corpaction.Action{
+			Symbol:    field(record, "symbol"),
+			Kind:      corpaction.Kind(strings.ToLower(field(record, "kind"))),
+			NewSymbol: field(record, "new_symbol"),
+		}
+		if a.ExDate, err = parseDate(field(record, "ex_date")); err == nil {
+			if a.Ratio, err = number(record, "ratio"); err == nil {
+				a.Amount, err = number(record, "amount")
+			}
+		}
+		if err == nil {
+			err = a.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+2, err)
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// parseDate returns the epoch of the date in the timezone of the server
+func parseDate(value string) (int64, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, utils.InstanceConfig.Timezone); err == nil {
+		return t.Unix(), nil
+	}
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return epoch, nil
+	}
+	return 0, fmt.Errorf("invalid ex_date %s, must be 2006-01-02 or an epoch", value)
+}
+
+func format(a corpaction.Action) string {
+	line := fmt.Sprintf("%s %s %s", a.Symbol, a.Kind,
+		time.Unix(a.ExDate, 0).In(utils.InstanceConfig.Timezone).Format("2006-01-02"))
+	if a.Ratio != 0 {
+		line += fmt.Sprintf(" ratio %g", a.Ratio)
+	}
+	if a.Amount != 0 {
+		line += fmt.Sprintf(" amount %g", a.Amount)
+	}
+	if a.NewSymbol != "" {
+		line += " new_symbol " + a.NewSymbol
+	}
+	return line
+}
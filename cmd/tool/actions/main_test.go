@@ -0,0 +1,38 @@
+package actions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func (s *TestSuite) TestReadActions(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+	actions, err := readActions(strings.NewReader(
+		"symbol,kind,ex_date,ratio,amount,new_symbol\n" +
+			"AAPL,split,2020-08-31,4,,\n" +
+			"AAPL,Dividend,1597363200,,0.82,\n" +
+			"FB,symbol_change,2022-06-09,,,META\n"))
+	c.Assert(err, IsNil)
+	c.Assert(actions, DeepEquals, []corpaction.Action{
+		{Symbol: "AAPL", Kind: corpaction.SPLIT, ExDate: 1598832000, Ratio: 4},
+		{Symbol: "AAPL", Kind: corpaction.DIVIDEND, ExDate: 1597363200, Amount: 0.82},
+		{Symbol: "FB", Kind: corpaction.SYMBOL_CHANGE, ExDate: 1654732800, NewSymbol: "META"},
+	})
+	c.Assert(format(actions[0]), Equals, "AAPL split 2020-08-31 ratio 4")
+
+	_, err = readActions(strings.NewReader("symbol,kind,ex_date,ratio\nAAPL,split,2020-08-31,\n"))
+	c.Assert(err, ErrorMatches, "line 2: .*")
+	_, err = readActions(strings.NewReader("symbol,ex_date\nAAPL,2020-08-31\n"))
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,321 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	stdio "io"
+	"math/rand"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "bench"
+	short   = "Benchmark the writes and queries of an instance or data directory"
+	long    = "This command writes synthetic bars, or ticks, to new buckets of an instance or data directory and queries them back, reporting the write throughput and the query latencies. The data and queries are the same from run to run, so that hardware and configuration changes can be compared. The buckets are destroyed afterwards unless kept."
+	example = "marketstore tool bench --target localhost:5993 --symbols 10 --rows 100000"
+
+	// Flag descriptions.
+	targetDesc    = "instance at \"hostname:port\", or data directory, benchmarked"
+	apiKeyDesc    = "API key sent to the instance"
+	symbolsDesc   = "number of buckets written"
+	rowsDesc      = "number of records written to each bucket"
+	batchDesc     = "number of records of each write"
+	timeframeDesc = "timeframe of the buckets"
+	ticksDesc     = "write ticks, ten a second, to variable length buckets instead of bars"
+	queriesDesc   = "number of queries of each kind"
+	keepDesc      = "keep the buckets written, default is false"
+
+	// Flag defaults.
+	defaultSymbols = 10
+	defaultRows    = 100000
+	defaultBatch   = 10000
+	defaultQueries = 100
+
+	// symbolPrefix names the buckets of the benchmark
+	symbolPrefix = "BENCH_"
+	// lastRecords is the number of records of the last records queries
+	lastRecords = 100
+)
+
+var (
+	// Available flags.
+	target, apiKey string
+	cfg            config
+	keep           bool
+
+	// Cmd is the bench command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeBench,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().IntVar(&cfg.symbols, "symbols", defaultSymbols, symbolsDesc)
+	Cmd.Flags().IntVar(&cfg.rows, "rows", defaultRows, rowsDesc)
+	Cmd.Flags().IntVar(&cfg.batch, "batch", defaultBatch, batchDesc)
+	Cmd.Flags().StringVar(&cfg.timeframe, "timeframe", "1Min", timeframeDesc)
+	Cmd.Flags().BoolVar(&cfg.ticks, "ticks", false, ticksDesc)
+	Cmd.Flags().IntVar(&cfg.queries, "queries", defaultQueries, queriesDesc)
+	Cmd.Flags().BoolVar(&keep, "keep", false, keepDesc)
+}
+
+// config is the workload of the benchmark
+type config struct {
+	symbols, rows, batch, queries int
+	timeframe                     string
+	ticks                         bool
+}
+
+// executeBench implements the bench tool.
+func executeBench(cmd *cobra.Command, args []string) error {
+	if cfg.symbols < 1 || cfg.rows < 1 || cfg.batch < 1 || cfg.queries < 0 {
+		return errors.New("the symbols, rows and batch must be positive")
+	}
+	tf := utils.TimeframeFromString(cfg.timeframe)
+	if tf == nil {
+		return fmt.Errorf("invalid timeframe %s", cfg.timeframe)
+	}
+	e := endpoint.New(target, apiKey)
+
+	keys := cfg.keys()
+	var listing frontend.ListSymbolsResponse
+	err := e.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: symbolPrefix + "*/*/*"}, &listing)
+	if err != nil {
+		return err
+	}
+	if len(listing.Buckets) > 0 {
+		return fmt.Errorf("buckets of a previous benchmark exist in %s, such as %s", target, listing.Buckets[0].Key)
+	}
+
+	results, err := run(e, cfg, tf.Duration)
+	if !keep {
+		if destroyErr := destroy(e, keys); err == nil {
+			err = destroyErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if endpoint.IsDir(target) {
+		fmt.Println("data directory written without WAL")
+	}
+	report(os.Stdout, results)
+	return nil
+}
+
+// keys returns the keys of the buckets of the benchmark
+func (c config) keys() (keys []string) {
+	group := "OHLCV"
+	if c.ticks {
+		group = "TICK"
+	}
+	for i := 0; i < c.symbols; i++ {
+		keys = append(keys, fmt.Sprintf("%s%d/%s/%s", symbolPrefix, i, c.timeframe, group))
+	}
+	return keys
+}
+
+// result is the measure of an operation repeated
+type result struct {
+	Name      string
+	Records   int
+	Elapsed   time.Duration
+	Latencies []time.Duration
+}
+
+// measure runs the operation, which returns the number of records written or
+// read, and adds its latency
+func (r *result) measure(operation func() (int, error)) error {
+	start := time.Now()
+	records, err := operation()
+	latency := time.Since(start)
+	r.Records += records
+	r.Elapsed += latency
+	r.Latencies = append(r.Latencies, latency)
+	return err
+}
+
+// percentile returns the latency under which are the fraction of them
+func (r *result) percentile(fraction float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	latencies := append([]time.Duration{}, r.Latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[int(fraction*float64(len(latencies)-1))]
+}
+
+// run writes the buckets by batches of each in turn, as a feed does, then
+// queries their last records, a range of a hundredth of their records and
+// all of them
+func run(e endpoint.Endpoint, c config, tf time.Duration) ([]*result, error) {
+	keys := c.keys()
+	shapes, rowType := "Open/float32:High/float32:Low/float32:Close/float32:Volume/int64", "fixed"
+	if c.ticks {
+		shapes, rowType = "Bid/float32:Ask/float32", "variable"
+	}
+	for _, key := range keys {
+		if err := endpoint.Create(e, key, shapes, rowType); err != nil {
+			return nil, fmt.Errorf("creation of %s failed: %v", key, err)
+		}
+	}
+
+	// the same data and queries for every run
+	random := rand.New(rand.NewSource(1))
+	start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	written := &result{Name: "write"}
+	for first := 0; first < c.rows; first += c.batch {
+		n := c.batch
+		if first+n > c.rows {
+			n = c.rows - first
+		}
+		for _, key := range keys {
+			cs := c.generate(random, start, tf, first, n)
+			err := written.measure(func() (int, error) {
+				return n, endpoint.Write(e, key, cs, c.ticks)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("write to %s failed: %v", key, err)
+			}
+		}
+	}
+
+	epochEnd := c.time(start, tf, c.rows-1).Unix()
+	last := &result{Name: fmt.Sprintf("query last %d", lastRecords)}
+	ranged := &result{Name: "query range 1%"}
+	full := &result{Name: "query all"}
+	queries := []struct {
+		result *result
+		count  int
+		query  func(key string) frontend.QueryRequest
+	}{
+		{last, c.queries, func(key string) frontend.QueryRequest {
+			return frontend.NewQueryRequestBuilder(key).EpochEnd(epochEnd).LimitRecordCount(lastRecords).End()
+		}},
+		{ranged, c.queries, func(key string) frontend.QueryRequest {
+			window := c.rows / 100
+			first := random.Intn(c.rows - window)
+			return frontend.NewQueryRequestBuilder(key).
+				EpochStart(c.time(start, tf, first).Unix()).
+				EpochEnd(c.time(start, tf, first+window).Unix()).End()
+		}},
+		{full, (c.queries + 9) / 10, func(key string) frontend.QueryRequest {
+			return frontend.NewQueryRequestBuilder(key).EpochEnd(epochEnd).End()
+		}},
+	}
+	for _, q := range queries {
+		for i := 0; i < q.count; i++ {
+			key := keys[random.Intn(len(keys))]
+			req := q.query(key)
+			err := q.result.measure(func() (int, error) {
+				cs, err := endpoint.Run(e, req)
+				if err != nil {
+					return 0, err
+				}
+				return cs.Len(), nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("query of %s failed: %v", key, err)
+			}
+		}
+	}
+	return []*result{written, last, ranged, full}, nil
+}
+
+// time returns the time of the record of the benchmark, a bar of each
+// interval or ten ticks a second
+func (c config) time(start time.Time, tf time.Duration, record int) time.Time {
+	if c.ticks {
+		// off the whole milliseconds, which the interval ticks may round down
+		return start.Add(time.Duration(record)*100*time.Millisecond + time.Microsecond)
+	}
+	return start.Add(time.Duration(record) * tf)
+}
+
+// generate returns n records from the first one, a random walk of prices
+func (c config) generate(random *rand.Rand, start time.Time, tf time.Duration, first, n int) *io.ColumnSeries {
+	epochs := make([]int64, n)
+	nanos := make([]int32, n)
+	prices := make([][]float32, 4)
+	for i := range prices {
+		prices[i] = make([]float32, n)
+	}
+	volumes := make([]int64, n)
+	price := float32(100)
+	for i := 0; i < n; i++ {
+		t := c.time(start, tf, first+i)
+		epochs[i], nanos[i] = t.Unix(), int32(t.Nanosecond())
+		price += float32(random.NormFloat64() * 0.1)
+		prices[0][i], prices[1][i] = price, price+0.05
+		prices[2][i], prices[3][i] = price-0.05, price+0.01
+		volumes[i] = random.Int63n(1000)
+	}
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epochs)
+	if c.ticks {
+		cs.AddColumn("Bid", prices[0])
+		cs.AddColumn("Ask", prices[1])
+		cs.AddColumn("Nanoseconds", nanos)
+		return cs
+	}
+	for i, name := range []string{"Open", "High", "Low", "Close"} {
+		cs.AddColumn(name, prices[i])
+	}
+	cs.AddColumn("Volume", volumes)
+	return cs
+}
+
+// destroy destroys the buckets of the benchmark
+func destroy(e endpoint.Endpoint, keys []string) error {
+	req := &frontend.MultiKeyRequest{}
+	for _, key := range keys {
+		req.Requests = append(req.Requests, frontend.KeyRequest{Key: key})
+	}
+	var response frontend.MultiServerResponse
+	if err := e.Call("Destroy", req, &response); err != nil {
+		return err
+	}
+	for i, resp := range response.Responses {
+		if resp.Error != "" && i < len(keys) {
+			return fmt.Errorf("removal of %s failed: %s", keys[i], resp.Error)
+		}
+	}
+	return nil
+}
+
+// report writes the throughput and latencies of the operations
+func report(w stdio.Writer, results []*result) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OPERATION\tCOUNT\tRECORDS\tRECORDS/S\tP50\tP90\tP99\tMAX\t")
+	for _, r := range results {
+		var throughput float64
+		if r.Elapsed > 0 {
+			throughput = float64(r.Records) / r.Elapsed.Seconds()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f\t%v\t%v\t%v\t%v\t\n", r.Name, len(r.Latencies), r.Records, throughput,
+			round(r.percentile(0.5)), round(r.percentile(0.9)), round(r.percentile(0.99)), round(r.percentile(1)))
+	}
+	tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,51 @@
+package bench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	e endpoint.Endpoint
+}
+
+func (s *TestSuite) SetUpSuite(c *C) {
+	s.e = endpoint.New(c.MkDir(), "")
+}
+
+func (s *TestSuite) TestBench(c *C) {
+	for _, ticks := range []bool{false, true} {
+		cfg := config{symbols: 3, rows: 1000, batch: 300, queries: 20, timeframe: "1Min", ticks: ticks}
+		results, err := run(s.e, cfg, time.Minute)
+		c.Assert(err, IsNil)
+		c.Assert(results, HasLen, 4)
+
+		// 4 batches of each bucket
+		c.Assert(results[0].Records, Equals, 3000)
+		c.Assert(results[0].Latencies, HasLen, 12)
+		c.Assert(results[1].Records, Equals, 20*lastRecords)
+		// 11 bars from the start to the end of the range, inclusive, or
+		// the ticks of the 2 seconds
+		if ticks {
+			c.Assert(results[2].Records, Equals, 20*20)
+		} else {
+			c.Assert(results[2].Records, Equals, 20*11)
+		}
+		c.Assert(results[3].Latencies, HasLen, 2)
+		c.Assert(results[3].Records, Equals, 2*1000)
+
+		var out bytes.Buffer
+		report(&out, results)
+		c.Assert(strings.Count(out.String(), "\n"), Equals, 5)
+		c.Assert(destroy(s.e, cfg.keys()), IsNil)
+	}
+}
@@ -0,0 +1,149 @@
+package check
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// Dir checks the data directory of a database: the WAL files left to replay
+// can be decoded, the directories of the catalog have their category and
+// hold either subdirectories or data files, and the data files have valid
+// headers and intervals, consistent with their path and across the years of
+// their bucket.  The problems are reported with the path they are found at,
+// relative to the directory.  The damaged data files are repaired if
+// requested, the other problems are left to the operator.
+func Dir(rootDir string, repair bool, report func(relPath, problem string)) error {
+	rootDir = filepath.Clean(rootDir)
+	walFiles, err := filepath.Glob(filepath.Join(rootDir, "*.walfile"))
+	if err != nil {
+		return err
+	}
+	for _, walFile := range walFiles {
+		if problem := checkWAL(walFile); problem != "" {
+			report(filepath.Base(walFile), problem)
+		}
+	}
+	return checkCatalogDir(rootDir, rootDir, nil, repair, report)
+}
+
+// checkWAL returns the damage of the WAL file, which can be decoded up to a
+// partially written message at its end, or an empty string
+func checkWAL(walFile string) string {
+	fp, err := os.Open(walFile)
+	if err != nil {
+		return fmt.Sprintf("WAL cannot be opened (%v)", err)
+	}
+	defer fp.Close()
+	// smaller files are removed on startup
+	if fi, err := fp.Stat(); err != nil || fi.Size() < 11 {
+		return ""
+	}
+	wf := &executor.WALFileType{FilePath: walFile, FilePtr: fp}
+	if _, err := wf.Transactions(); err != nil {
+		return fmt.Sprintf("WAL cannot be replayed (%v)", err)
+	}
+	return ""
+}
+
+// checkCatalogDir checks the directory of the catalog, the item of each
+// category of its path, such as Timeframe, being given
+func checkCatalogDir(rootDir, dir string, items map[string]string, repair bool,
+	report func(relPath, problem string)) error {
+	relPath, _ := filepath.Rel(rootDir, dir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var (
+		subDirs, dataFiles []string
+		childCategory      string
+	)
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir() && entry.Name() != "metadata.db":
+			subDirs = append(subDirs, entry.Name())
+		case filepath.Ext(entry.Name()) == ".bin":
+			dataFiles = append(dataFiles, entry.Name())
+		case entry.Name() == "category_name":
+			data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+			childCategory = strings.TrimSpace(string(data))
+		}
+	}
+	if childCategory == "" && (len(subDirs) > 0 || dir != rootDir) {
+		report(relPath, "missing category_name, the catalog cannot be loaded")
+	}
+	if len(subDirs) > 0 && len(dataFiles) > 0 {
+		report(relPath, "holds both data files and subdirectories")
+	}
+	for _, name := range subDirs {
+		subItems := map[string]string{childCategory: name}
+		for c, item := range items {
+			subItems[c] = item
+		}
+		if err = checkCatalogDir(rootDir, filepath.Join(dir, name), subItems, repair, report); err != nil {
+			return err
+		}
+	}
+	if len(dataFiles) == 0 {
+		return nil
+	}
+
+	var timeframe *utils.Timeframe
+	if item, ok := items["Timeframe"]; ok {
+		timeframe = utils.TimeframeFromString(item)
+	}
+
+	sort.Strings(dataFiles)
+	var first *io.TimeBucketInfo
+	for _, name := range dataFiles {
+		filePath := filepath.Join(dir, name)
+		fileRelPath := filepath.Join(relPath, name)
+		problems, err := checkFile(filePath, repair)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			report(fileRelPath, p)
+		}
+		tbi, err := readFileHeader(filePath)
+		if err != nil {
+			// reported by checkFile
+			continue
+		}
+		if timeframe != nil && tbi.GetTimeframe() != timeframe.Duration {
+			report(fileRelPath, fmt.Sprintf("timeframe %v, expected %v from its path",
+				tbi.GetTimeframe(), timeframe.Duration))
+		}
+		if first == nil {
+			first = tbi
+			continue
+		}
+		if tbi.GetRecordType() != first.GetRecordType() ||
+			!reflect.DeepEqual(tbi.GetDataShapes(), first.GetDataShapes()) {
+			report(fileRelPath, fmt.Sprintf("schema %v differs from %v of %s",
+				tbi.GetDataShapes(), first.GetDataShapes(), filepath.Base(first.Path)))
+		}
+	}
+	return nil
+}
+
+func readFileHeader(filePath string) (*io.TimeBucketInfo, error) {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return readHeader(fp, filePath)
+}
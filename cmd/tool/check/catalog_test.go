@@ -0,0 +1,55 @@
+package check
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) check(c *C) []string {
+	var problems []string
+	err := Dir(s.Rootdir, false, func(relPath, problem string) {
+		problems = append(problems, relPath+": "+problem)
+	})
+	c.Assert(err, IsNil)
+	sort.Strings(problems)
+	return problems
+}
+
+func (s *TestSuite) TestDir(c *C) {
+	s.makeFixed(c)
+	for dir, category := range map[string]string{
+		"":                 "Symbol",
+		"EURUSD":           "Timeframe",
+		"EURUSD/1Min":      "AttributeGroup",
+		"EURUSD/1Min/OHLC": "Year",
+	} {
+		c.Assert(ioutil.WriteFile(filepath.Join(s.Rootdir, dir, "category_name"), []byte(category), 0600), IsNil)
+	}
+	c.Assert(s.check(c), HasLen, 0)
+
+	// a year of another schema, in a directory of another timeframe
+	dir := filepath.Join(s.Rootdir, "EURUSD", "1Min", "OHLC")
+	tbi := io.NewTimeBucketInfo(*utils.TimeframeFromString("5Min"), dir, "test", 2002,
+		[]io.DataShape{{Name: "Open", Type: io.FLOAT32}}, io.FIXED)
+	fp, err := os.OpenFile(tbi.Path, os.O_CREATE|os.O_RDWR, 0600)
+	c.Assert(err, IsNil)
+	c.Assert(io.WriteHeader(fp, tbi), IsNil)
+	fp.Close()
+	// without its category
+	c.Assert(os.MkdirAll(filepath.Join(s.Rootdir, "EURUSD", "1H"), 0700), IsNil)
+	// and a damaged WAL
+	c.Assert(ioutil.WriteFile(filepath.Join(s.Rootdir, "1.walfile"), []byte("not a WAL file"), 0600), IsNil)
+
+	problems := s.check(c)
+	c.Assert(problems, HasLen, 4)
+	c.Assert(problems[0], Matches, "1.walfile: WAL cannot be replayed .*")
+	c.Assert(problems[1], Equals, "EURUSD/1H: missing category_name, the catalog cannot be loaded")
+	c.Assert(problems[2], Matches, "EURUSD/1Min/OHLC/2002.bin: schema .* differs from .* of 2001.bin")
+	c.Assert(problems[3], Equals, "EURUSD/1Min/OHLC/2002.bin: timeframe 5m0s, expected 1m0s from its path")
+}
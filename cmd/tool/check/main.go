@@ -0,0 +1,304 @@
+package check
+
+import (
+	"fmt"
+	stdio "io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/klauspost/compress/snappy"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "check"
+	short   = "Check the data files of a database for damage"
+	long    = "This command checks the WAL files, the catalog directories and the headers, the index and the intervals of the data files of a database, and optionally repairs the data files"
+	example = "marketstore tool check --dir <path> --repair"
+
+	// Flag descriptions.
+	rootDirPathDesc  = "set filesystem path of the directory containing the files to check"
+	repairDesc       = "truncate or quarantine the damaged intervals, default is false"
+	uncompressedDesc = "the variable length records were written with disable_variable_compression"
+
+	// recordsPerRead is the number of fixed length records read at once
+	recordsPerRead = 4096
+)
+
+var (
+	// Available flags.
+	rootDirPath          string
+	repair, uncompressed bool
+
+	// Cmd is the check command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeCheck,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVarP(&rootDirPath, "dir", "d", "", rootDirPathDesc)
+	Cmd.MarkFlagRequired("dir")
+	Cmd.Flags().BoolVar(&repair, "repair", false, repairDesc)
+	Cmd.Flags().BoolVar(&uncompressed, "uncompressed", false, uncompressedDesc)
+}
+
+// executeCheck implements the check tool.
+func executeCheck(cmd *cobra.Command, args []string) error {
+	utils.InstanceConfig.DisableVariableCompression = uncompressed
+	rootDirPath = filepath.Clean(rootDirPath)
+
+	var damaged int
+	err := Dir(rootDirPath, repair, func(relPath, problem string) {
+		fmt.Printf("%s: %s\n", relPath, problem)
+		damaged++
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case damaged == 0:
+		fmt.Println("No damage found")
+	case repair:
+		fmt.Printf("Found %d problems, the damaged headers and intervals are repaired\n", damaged)
+	default:
+		return fmt.Errorf("found %d problems, run with --repair to fix the damaged headers and intervals", damaged)
+	}
+	return nil
+}
+
+// checkFile returns the damage found in the data file, repairing it if
+// requested.  A file with a damaged header is moved aside to <file>.damaged,
+// the catalog only reading the .bin files.
+func checkFile(filePath string, repair bool) (problems []string, err error) {
+	flag := os.O_RDONLY
+	if repair {
+		flag = os.O_RDWR
+	}
+	fp, err := os.OpenFile(filePath, flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tbi, err := readHeader(fp, filePath)
+	if err != nil {
+		problem := "header: " + err.Error()
+		if repair {
+			fp.Close()
+			if err = os.Rename(filePath, filePath+".damaged"); err != nil {
+				return nil, err
+			}
+			problem += ", moved to " + filepath.Base(filePath) + ".damaged"
+		}
+		return []string{problem}, nil
+	}
+	if tbi.GetRecordType() == io.VARIABLE {
+		return checkVariable(fp, tbi, fi.Size(), repair)
+	}
+	return checkFixed(fp, tbi, fi.Size(), repair)
+}
+
+// readHeader reads the header of the data file, returning an error if it is
+// not consistent with the file name or the record layout
+func readHeader(fp *os.File, filePath string) (*io.TimeBucketInfo, error) {
+	var buffer [io.Headersize]byte
+	if _, err := fp.ReadAt(buffer[:], 0); err != nil {
+		return nil, fmt.Errorf("short read (%v)", err)
+	}
+	header := (*io.Header)(unsafe.Pointer(&buffer))
+
+	base := filepath.Base(filePath)
+	year, err := strconv.Atoi(base[:len(base)-len(".bin")])
+	if err != nil {
+		return nil, fmt.Errorf("file name is not a year")
+	}
+	switch {
+	case header.Version != io.FileinfoVersion:
+		return nil, fmt.Errorf("version %d, expected %d", header.Version, io.FileinfoVersion)
+	case header.Year != int64(year):
+		return nil, fmt.Errorf("year %d, expected %d", header.Year, year)
+	case header.Timeframe <= 0 || header.Timeframe > int64(utils.Day):
+		return nil, fmt.Errorf("invalid timeframe %v", time.Duration(header.Timeframe))
+	case io.EnumRecordType(header.RecordType) != io.FIXED &&
+		io.EnumRecordType(header.RecordType) != io.VARIABLE:
+		return nil, fmt.Errorf("invalid record type %d", header.RecordType)
+	case header.NElements < 1 || header.NElements > int64(len(header.ElementTypes)):
+		return nil, fmt.Errorf("invalid element count %d", header.NElements)
+	}
+	types := make([]io.EnumElementType, header.NElements)
+	for i, elType := range header.ElementTypes[:header.NElements] {
+		if io.EnumElementType(elType).Size() == 0 {
+			return nil, fmt.Errorf("invalid element type %d", elType)
+		}
+		types[i] = io.EnumElementType(elType)
+	}
+	fieldsLength := io.ElementsLength(types)
+	recordLength := int64(24)
+	if io.EnumRecordType(header.RecordType) == io.FIXED {
+		recordLength = int64(io.AlignedSize(fieldsLength)) + 8
+	}
+	if header.RecordLength != recordLength {
+		return nil, fmt.Errorf("record length %d, expected %d", header.RecordLength, recordLength)
+	}
+	return io.NewTimeBucketInfoFromHeader(header, filePath), nil
+}
+
+// checkFixed checks that each record of the fixed length file is empty or
+// holds the index of its interval.  The damaged records are zeroed on repair,
+// and a partial record at the end of the file is truncated.
+func checkFixed(fp *os.File, tbi *io.TimeBucketInfo, size int64, repair bool) (problems []string, err error) {
+	recordLength := int64(tbi.GetRecordLength())
+	if tail := (size - io.Headersize) % recordLength; tail != 0 {
+		problem := fmt.Sprintf("partial record of %d bytes at the end of the file", tail)
+		size -= tail
+		if repair {
+			if err = fp.Truncate(size); err != nil {
+				return nil, err
+			}
+			problem += ", truncated"
+		}
+		problems = append(problems, problem)
+	}
+
+	buffer := make([]byte, recordsPerRead*recordLength)
+	empty := make([]byte, recordLength)
+	for offset := int64(io.Headersize); offset < size; offset += int64(len(buffer)) {
+		n, err := fp.ReadAt(buffer, offset)
+		if err != nil && err != stdio.EOF {
+			return nil, err
+		}
+		for i := 0; i+int(recordLength) <= n; i += int(recordLength) {
+			held := io.ToInt64(buffer[i:])
+			index := (offset-io.Headersize+int64(i))/recordLength + 1
+			if held == 0 || held == index {
+				continue
+			}
+			problem := fmt.Sprintf("interval %d holds index %d", index, held)
+			if repair {
+				if _, err = fp.WriteAt(empty, offset+int64(i)); err != nil {
+					return nil, err
+				}
+				problem += ", zeroed"
+			}
+			problems = append(problems, problem)
+		}
+	}
+	return problems, nil
+}
+
+// checkVariable checks that the index records of the variable length file
+// point at their interval and at data inside the file, which can be read
+// back as whole records in interval tick order.  The data of the damaged
+// intervals is appended to <file>.quarantine, after their index record, and
+// the intervals are emptied on repair.
+func checkVariable(fp *os.File, tbi *io.TimeBucketInfo, size int64, repair bool) (problems []string, err error) {
+	dataStart := io.FileSize(tbi.GetTimeframe(), int(tbi.Year), int(tbi.GetRecordLength()))
+	if size < dataStart {
+		problem := fmt.Sprintf("index truncated at %d bytes of %d", size, dataStart)
+		if repair {
+			if err = fp.Truncate(dataStart); err != nil {
+				return nil, err
+			}
+			problem += ", extended"
+		}
+		problems = append(problems, problem)
+	}
+	indexBuffer := make([]byte, dataStart-io.Headersize)
+	n, err := fp.ReadAt(indexBuffer, io.Headersize)
+	if err != nil && err != stdio.EOF {
+		return nil, err
+	}
+	indexBuffer = indexBuffer[:n-n%24]
+
+	var quarantine *os.File
+	defer func() {
+		if quarantine != nil {
+			quarantine.Close()
+		}
+	}()
+	varRecLen := int(tbi.GetVariableRecordLength())
+	for i := 0; i < len(indexBuffer); i += 24 {
+		index := int64(i/24) + 1
+		record := indexBuffer[i : i+24]
+		recIndex, offset, length := io.ToInt64(record), io.ToInt64(record[8:]), io.ToInt64(record[16:])
+		if recIndex == 0 {
+			continue
+		}
+
+		var data []byte
+		problem := checkInterval(fp, tbi, index, recIndex, offset, length, size, varRecLen, &data)
+		if problem == "" {
+			continue
+		}
+		problem = fmt.Sprintf("interval %d %s", index, problem)
+		if repair {
+			if quarantine == nil {
+				quarantine, err = os.OpenFile(fp.Name()+".quarantine", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if _, err = quarantine.Write(append(append([]byte{}, record...), data...)); err != nil {
+				return nil, err
+			}
+			if _, err = fp.WriteAt(make([]byte, 24), io.Headersize+int64(i)); err != nil {
+				return nil, err
+			}
+			problem += ", quarantined"
+		}
+		problems = append(problems, problem)
+	}
+	return problems, nil
+}
+
+// checkInterval returns the damage of the interval of a variable length file
+// or an empty string, setting the raw data of the interval if it could be read
+func checkInterval(fp *os.File, tbi *io.TimeBucketInfo, index, recIndex, offset, length, size int64,
+	varRecLen int, data *[]byte) string {
+
+	dataStart := io.FileSize(tbi.GetTimeframe(), int(tbi.Year), int(tbi.GetRecordLength()))
+	if recIndex != index {
+		return fmt.Sprintf("points at interval %d", recIndex)
+	}
+	if offset < dataStart || length <= 0 || offset+length > size {
+		return fmt.Sprintf("points at %d bytes at %d outside the data", length, offset)
+	}
+	*data = make([]byte, length)
+	if _, err := fp.ReadAt(*data, offset); err != nil {
+		return fmt.Sprintf("data read failed (%v)", err)
+	}
+	records := *data
+	if !utils.InstanceConfig.DisableVariableCompression {
+		var err error
+		if records, err = snappy.Decode(nil, records); err != nil {
+			return fmt.Sprintf("data cannot be decompressed (%v)", err)
+		}
+	}
+	if len(records)%varRecLen != 0 {
+		return fmt.Sprintf("data is %d bytes, not a multiple of the %d bytes records", len(records), varRecLen)
+	}
+	var last uint32
+	for i := varRecLen - 4; i < len(records); i += varRecLen {
+		ticks := io.ToUInt32(records[i:])
+		if ticks < last {
+			return fmt.Sprintf("record %d is out of order", i/varRecLen)
+		}
+		last = ticks
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package check
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/klauspost/compress/snappy"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	Rootdir string
+}
+
+func (s *TestSuite) SetUpTest(c *C) {
+	s.Rootdir = c.MkDir()
+}
+
+// makeFixed writes a 1Min OHLC file of the first hundred minutes of 2001
+func (s *TestSuite) makeFixed(c *C) string {
+	dir := filepath.Join(s.Rootdir, "EURUSD", "1Min", "OHLC")
+	c.Assert(os.MkdirAll(dir, 0700), IsNil)
+	tbi := io.NewTimeBucketInfo(*utils.TimeframeFromString("1Min"), dir, "test", 2001,
+		io.NewDataShapeVector([]string{"Open", "High", "Low", "Close"},
+			[]io.EnumElementType{io.FLOAT32, io.FLOAT32, io.FLOAT32, io.FLOAT32}), io.FIXED)
+	fp, err := os.OpenFile(tbi.Path, os.O_CREATE|os.O_RDWR, 0600)
+	c.Assert(err, IsNil)
+	defer fp.Close()
+	c.Assert(io.WriteHeader(fp, tbi), IsNil)
+	start := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	for i := int64(0); i < 100; i++ {
+		record, _ := io.Serialize(nil, io.EpochToIndex(start+60*i, time.Minute))
+		record, _ = io.Serialize(record, []float32{1, 2, 3, 4})
+		_, err = fp.WriteAt(record, io.EpochToOffset(start+60*i, time.Minute, 24))
+		c.Assert(err, IsNil)
+	}
+	return tbi.Path
+}
+
+func (s *TestSuite) TestCheckFixed(c *C) {
+	filePath := s.makeFixed(c)
+	problems, err := checkFile(filePath, false)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+
+	// the 10th interval written in the 5th one
+	fp, err := os.OpenFile(filePath, os.O_RDWR, 0600)
+	c.Assert(err, IsNil)
+	record := make([]byte, 24)
+	_, err = fp.ReadAt(record, io.IndexToOffset(10, 24))
+	c.Assert(err, IsNil)
+	_, err = fp.WriteAt(record, io.IndexToOffset(5, 24))
+	c.Assert(err, IsNil)
+	fi, _ := fp.Stat()
+	c.Assert(fp.Truncate(fi.Size()+7), IsNil)
+	fp.Close()
+
+	problems, err = checkFile(filePath, false)
+	c.Assert(err, IsNil)
+	c.Assert(problems, DeepEquals, []string{
+		"partial record of 7 bytes at the end of the file",
+		"interval 5 holds index 10",
+	})
+	problems, err = checkFile(filePath, true)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 2)
+	problems, err = checkFile(filePath, false)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+
+	// the 10th interval is left alone
+	fp, _ = os.Open(filePath)
+	defer fp.Close()
+	repaired := make([]byte, 24)
+	fp.ReadAt(repaired, io.IndexToOffset(10, 24))
+	c.Assert(repaired, DeepEquals, record)
+	fp.ReadAt(repaired, io.IndexToOffset(5, 24))
+	c.Assert(repaired, DeepEquals, make([]byte, 24))
+}
+
+func (s *TestSuite) TestCheckHeader(c *C) {
+	filePath := s.makeFixed(c)
+	c.Assert(os.Rename(filePath, filepath.Join(filepath.Dir(filePath), "1999.bin")), IsNil)
+	filePath = filepath.Join(filepath.Dir(filePath), "1999.bin")
+
+	problems, err := checkFile(filePath, false)
+	c.Assert(err, IsNil)
+	c.Assert(problems, DeepEquals, []string{"header: year 2001, expected 1999"})
+	_, err = checkFile(filePath, true)
+	c.Assert(err, IsNil)
+	_, err = os.Stat(filePath)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(filePath + ".damaged")
+	c.Assert(err, IsNil)
+}
+
+func (s *TestSuite) TestCheckVariable(c *C) {
+	dir := filepath.Join(s.Rootdir, "TEST", "1Min", "TICK")
+	c.Assert(os.MkdirAll(dir, 0700), IsNil)
+	tbi := io.NewTimeBucketInfo(*utils.TimeframeFromString("1Min"), dir, "test", 2017,
+		[]io.DataShape{{Name: "Bid", Type: io.FLOAT32}}, io.VARIABLE)
+	fp, err := os.OpenFile(tbi.Path, os.O_CREATE|os.O_RDWR, 0600)
+	c.Assert(err, IsNil)
+	c.Assert(io.WriteHeader(fp, tbi), IsNil)
+	c.Assert(fp.Truncate(io.FileSize(tbi.GetTimeframe(), 2017, 24)), IsNil)
+
+	// {Bid, ticks} records
+	block := func(ticks ...uint32) []byte {
+		var records []byte
+		for _, t := range ticks {
+			records, _ = io.Serialize(records, float32(1))
+			records, _ = io.Serialize(records, t)
+		}
+		return snappy.Encode(nil, records)
+	}
+	write := func(index int64, data []byte) {
+		end, _ := fp.Seek(0, os.SEEK_END)
+		fp.Write(data)
+		record, _ := io.Serialize(nil, []int64{index, end, int64(len(data))})
+		fp.WriteAt(record, io.IndexToOffset(index, 24))
+	}
+	write(1, block(1, 2, 3))
+	write(2, block(3, 2))
+	write(3, block(1)[:3])
+	fp.Close()
+
+	problems, err := checkFile(tbi.Path, false)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 2)
+	c.Assert(problems[0], Equals, "interval 2 record 1 is out of order")
+
+	problems, err = checkFile(tbi.Path, true)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 2)
+	problems, err = checkFile(tbi.Path, false)
+	c.Assert(err, IsNil)
+	c.Assert(problems, HasLen, 0)
+
+	// the index record and data of both intervals
+	quarantined, err := ioutil.ReadFile(tbi.Path + ".quarantine")
+	c.Assert(err, IsNil)
+	c.Assert(len(quarantined), Equals, 24+len(block(3, 2))+24+3)
+}
@@ -0,0 +1,193 @@
+package compact
+
+import (
+	"errors"
+	"fmt"
+	stdio "io"
+	"os"
+	"path/filepath"
+	"sort"
+	"unsafe"
+
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/klauspost/compress/snappy"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "compact"
+	short   = "Compact the variable length files of a stopped database"
+	long    = "This command rewrites the variable length files of a database to reclaim the space of the data no longer indexed, optionally re-encoding it. The database must not be running."
+	example = "marketstore tool compact --dir <path> --encoding compressed"
+
+	// Flag descriptions.
+	rootDirPathDesc  = "set filesystem path of the directory containing the files to compact"
+	uncompressedDesc = "the variable length records were written with disable_variable_compression"
+	encodingDesc     = "re-encode the records, compressed or uncompressed, default is unchanged"
+
+	compressed   = "compressed"
+	uncompressed = "uncompressed"
+)
+
+var (
+	// Available flags.
+	rootDirPath    string
+	isUncompressed bool
+	encoding       string
+
+	// Cmd is the compact command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeCompact,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVarP(&rootDirPath, "dir", "d", "", rootDirPathDesc)
+	Cmd.MarkFlagRequired("dir")
+	Cmd.Flags().BoolVar(&isUncompressed, "uncompressed", false, uncompressedDesc)
+	Cmd.Flags().StringVar(&encoding, "encoding", "", encodingDesc)
+}
+
+// executeCompact implements the compact tool.
+func executeCompact(cmd *cobra.Command, args []string) error {
+	rootDirPath = filepath.Clean(rootDirPath)
+	toCompressed := !isUncompressed
+	switch encoding {
+	case "":
+	case compressed:
+		toCompressed = true
+	case uncompressed:
+		toCompressed = false
+	default:
+		return fmt.Errorf("unknown encoding %s, must be compressed or uncompressed", encoding)
+	}
+
+	// bytes before and after compaction by bucket
+	before, after := map[string]int64{}, map[string]int64{}
+	err := filepath.Walk(rootDirPath, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || filepath.Ext(filePath) != ".bin" {
+			return nil
+		}
+		size, compacted, err := compactFile(filePath, !isUncompressed, toCompressed)
+		if err != nil {
+			return fmt.Errorf("compaction of %s failed: %v", filePath, err)
+		}
+		if compacted {
+			bucket, _ := filepath.Rel(rootDirPath, filepath.Dir(filePath))
+			before[bucket] += fi.Size()
+			after[bucket] += size
+		}
+		return nil
+	})
+
+	var buckets []string
+	for bucket := range before {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	var reclaimed int64
+	for _, bucket := range buckets {
+		fmt.Printf("%s: %d bytes, %d reclaimed\n", bucket, after[bucket], before[bucket]-after[bucket])
+		reclaimed += before[bucket] - after[bucket]
+	}
+	fmt.Printf("%d bytes reclaimed in %d buckets\n", reclaimed, len(buckets))
+	return err
+}
+
+// compactFile rewrites the variable length file with the data of its index
+// records alone, in index order, returning its new size.  The fixed length
+// files are left alone, their intervals having a fixed place.  The file is
+// written aside and renamed over the original one, which is kept if the
+// compaction fails.
+func compactFile(filePath string, fromCompressed, toCompressed bool) (size int64, compacted bool, err error) {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return 0, false, err
+	}
+	defer fp.Close()
+
+	var header [io.Headersize]byte
+	if _, err = fp.ReadAt(header[:], 0); err != nil {
+		return 0, false, fmt.Errorf("short header read (%v), run tool check", err)
+	}
+	tbi := io.NewTimeBucketInfoFromHeader((*io.Header)(unsafe.Pointer(&header)), filePath)
+	if tbi.GetRecordType() != io.VARIABLE {
+		return 0, false, nil
+	}
+	if tbi.GetTimeframe() <= 0 || tbi.GetRecordLength() != 24 {
+		return 0, false, errors.New("damaged header, run tool check")
+	}
+
+	dataStart := io.FileSize(tbi.GetTimeframe(), int(tbi.Year), int(tbi.GetRecordLength()))
+	index := make([]byte, dataStart-io.Headersize)
+	if _, err = fp.ReadAt(index, io.Headersize); err != nil && err != stdio.EOF {
+		return 0, false, err
+	}
+
+	tmpPath := filePath + ".compact"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	offset := dataStart
+	for i := 0; i < len(index); i += 24 {
+		record := index[i : i+24]
+		if io.ToInt64(record) == 0 {
+			continue
+		}
+		data := make([]byte, io.ToInt64(record[16:]))
+		if _, err = fp.ReadAt(data, io.ToInt64(record[8:])); err != nil {
+			return 0, false, fmt.Errorf("interval %d read failed (%v), run tool check", i/24+1, err)
+		}
+		if fromCompressed != toCompressed {
+			if data, err = reencode(data, toCompressed); err != nil {
+				return 0, false, fmt.Errorf("interval %d cannot be decompressed (%v), run tool check", i/24+1, err)
+			}
+		}
+		if _, err = out.WriteAt(data, offset); err != nil {
+			return 0, false, err
+		}
+		fields, _ := io.Serialize(nil, []int64{io.ToInt64(record), offset, int64(len(data))})
+		copy(record, fields)
+		offset += int64(len(data))
+	}
+
+	if _, err = out.WriteAt(header[:], 0); err != nil {
+		return 0, false, err
+	}
+	if _, err = out.WriteAt(index, io.Headersize); err != nil {
+		return 0, false, err
+	}
+	if err = out.Truncate(offset); err != nil {
+		return 0, false, err
+	}
+	if err = out.Sync(); err != nil {
+		return 0, false, err
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return 0, false, err
+	}
+	return offset, true, nil
+}
+
+func reencode(data []byte, toCompressed bool) ([]byte, error) {
+	if toCompressed {
+		return snappy.Encode(nil, data), nil
+	}
+	return snappy.Decode(nil, data)
+}
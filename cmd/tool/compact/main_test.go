@@ -0,0 +1,113 @@
+package compact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/klauspost/compress/snappy"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+// makeVariable writes a variable length file whose first interval was
+// written twice, leaving its first data behind, and returns its path and
+// the records of its intervals
+func makeVariable(c *C, dir string) (string, map[int64][]byte) {
+	tbi := io.NewTimeBucketInfo(*utils.TimeframeFromString("1Min"), dir, "test", 2017,
+		[]io.DataShape{{Name: "Bid", Type: io.FLOAT32}}, io.VARIABLE)
+	fp, err := os.OpenFile(tbi.Path, os.O_CREATE|os.O_RDWR, 0600)
+	c.Assert(err, IsNil)
+	defer fp.Close()
+	c.Assert(io.WriteHeader(fp, tbi), IsNil)
+	c.Assert(fp.Truncate(io.FileSize(tbi.GetTimeframe(), 2017, 24)), IsNil)
+
+	records := map[int64][]byte{}
+	write := func(index int64, bids ...float32) {
+		var data []byte
+		for i, bid := range bids {
+			data, _ = io.Serialize(data, bid)
+			data, _ = io.Serialize(data, uint32(i))
+		}
+		records[index] = data
+		data = snappy.Encode(nil, data)
+		end, _ := fp.Seek(0, os.SEEK_END)
+		fp.Write(data)
+		record, _ := io.Serialize(nil, []int64{index, end, int64(len(data))})
+		fp.WriteAt(record, io.IndexToOffset(index, 24))
+	}
+	write(1, 1, 2)
+	write(2, 3)
+	write(1, 1, 2, 4, 5)
+	return tbi.Path, records
+}
+
+// read returns the records of the intervals of a variable length file
+func read(c *C, filePath string, compressed bool) map[int64][]byte {
+	fp, err := os.Open(filePath)
+	c.Assert(err, IsNil)
+	defer fp.Close()
+	records := map[int64][]byte{}
+	for _, index := range []int64{1, 2, 3} {
+		record := make([]byte, 24)
+		fp.ReadAt(record, io.IndexToOffset(index, 24))
+		if io.ToInt64(record) == 0 {
+			continue
+		}
+		data := make([]byte, io.ToInt64(record[16:]))
+		_, err = fp.ReadAt(data, io.ToInt64(record[8:]))
+		c.Assert(err, IsNil)
+		if compressed {
+			data, err = snappy.Decode(nil, data)
+			c.Assert(err, IsNil)
+		}
+		records[index] = data
+	}
+	return records
+}
+
+func (s *TestSuite) TestCompact(c *C) {
+	filePath, records := makeVariable(c, c.MkDir())
+	fi, _ := os.Stat(filePath)
+
+	size, compacted, err := compactFile(filePath, true, true)
+	c.Assert(err, IsNil)
+	c.Assert(compacted, Equals, true)
+	c.Assert(size < fi.Size(), Equals, true)
+	fi, _ = os.Stat(filePath)
+	c.Assert(fi.Size(), Equals, size)
+	c.Assert(read(c, filePath, true), DeepEquals, records)
+
+	// nothing left to reclaim
+	again, _, err := compactFile(filePath, true, true)
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, size)
+
+	// re-encoded
+	_, _, err = compactFile(filePath, true, false)
+	c.Assert(err, IsNil)
+	c.Assert(read(c, filePath, false), DeepEquals, records)
+	_, err = os.Stat(filePath + ".compact")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *TestSuite) TestCompactFixed(c *C) {
+	dir := c.MkDir()
+	tbi := io.NewTimeBucketInfo(*utils.TimeframeFromString("1Min"), dir, "test", 2017,
+		[]io.DataShape{{Name: "Bid", Type: io.FLOAT32}}, io.FIXED)
+	fp, err := os.Create(filepath.Join(dir, "2017.bin"))
+	c.Assert(err, IsNil)
+	c.Assert(io.WriteHeader(fp, tbi), IsNil)
+	fp.Close()
+
+	_, compacted, err := compactFile(tbi.Path, true, true)
+	c.Assert(err, IsNil)
+	c.Assert(compacted, Equals, false)
+}
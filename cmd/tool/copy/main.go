@@ -0,0 +1,156 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "copy <bucket or glob pattern>"
+	short   = "Copy buckets between instances or data directories"
+	long    = "This command copies the records of buckets from a source instance or data directory to a destination one, creating the missing buckets"
+	example = "marketstore tool copy --from /data/mktsdb --to localhost:5993 --start 2017-01-01 --resume \"*/1Min/OHLCV\""
+
+	// Flag descriptions.
+	fromDesc       = "source instance at \"hostname:port\", or data directory"
+	fromAPIKeyDesc = "API key sent to the source instance"
+	toDesc         = "destination instance at \"hostname:port\", or data directory"
+	toAPIKeyDesc   = "API key sent to the destination instance"
+	startDesc      = "copy the records from this time on, as 2006-01-02 or RFC3339"
+	endDesc        = "copy the records until this time (inclusive), as 2006-01-02 or RFC3339"
+	resumeDesc     = "copy the records after the last one of each destination bucket, default is false"
+	batchDesc      = "number of records read and written at once"
+
+	// Flag defaults.
+	defaultBatch = 100000
+)
+
+var (
+	// Available flags.
+	from, fromAPIKey, to, toAPIKey string
+	start, end                     string
+	resume                         bool
+	batch                          int
+
+	// Cmd is the copy command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    cobra.ExactArgs(1),
+		RunE:    executeCopy,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&from, "from", "", fromDesc)
+	Cmd.MarkFlagRequired("from")
+	Cmd.Flags().StringVar(&fromAPIKey, "from_api_key", "", fromAPIKeyDesc)
+	Cmd.Flags().StringVar(&to, "to", "", toDesc)
+	Cmd.MarkFlagRequired("to")
+	Cmd.Flags().StringVar(&toAPIKey, "to_api_key", "", toAPIKeyDesc)
+	Cmd.Flags().StringVar(&start, "start", "", startDesc)
+	Cmd.Flags().StringVar(&end, "end", "", endDesc)
+	Cmd.Flags().BoolVar(&resume, "resume", false, resumeDesc)
+	Cmd.Flags().IntVar(&batch, "batch", defaultBatch, batchDesc)
+}
+
+// executeCopy implements the copy tool.
+func executeCopy(cmd *cobra.Command, args []string) error {
+	if endpoint.IsDir(from) && endpoint.IsDir(to) {
+		return errors.New("only one of the source and the destination can be a data directory")
+	}
+	if batch < 1 {
+		return errors.New("the batch must hold at least one record")
+	}
+	epochStart, err := endpoint.ParseTime(start, 0)
+	if err != nil {
+		return err
+	}
+	epochEnd, err := endpoint.ParseTime(end, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	src, dst := endpoint.New(from, fromAPIKey), endpoint.New(to, toAPIKey)
+
+	var listing frontend.ListSymbolsResponse
+	err = src.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: args[0]}, &listing)
+	if err != nil {
+		return err
+	}
+	if len(listing.Buckets) == 0 {
+		return fmt.Errorf("no bucket matching %s in %s", args[0], from)
+	}
+	for _, md := range listing.Buckets {
+		copied, err := copyBucket(src, dst, md, epochStart, epochEnd, resume, batch)
+		if err != nil {
+			return fmt.Errorf("copy of %s failed after %d records: %v", md.Key, copied, err)
+		}
+		fmt.Printf("%s: %d records copied\n", md.Key, copied)
+	}
+	return nil
+}
+
+// copyBucket copies the records of the bucket between the epochs, from the
+// last record of the destination bucket on when resuming, creating the
+// destination bucket if missing.  The variable length records are written
+// by whole seconds, so that a copy resumes after the last second written.
+func copyBucket(src, dst endpoint.Endpoint, md frontend.BucketMetadata, epochStart, epochEnd int64,
+	resume bool, batch int) (copied int, err error) {
+
+	var listing frontend.ListSymbolsResponse
+	err = dst.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: md.Key}, &listing)
+	if err != nil {
+		return 0, err
+	}
+	if len(listing.Buckets) == 0 {
+		if err = create(dst, md); err != nil {
+			return 0, err
+		}
+	} else {
+		existing := listing.Buckets[0]
+		if existing.RecordType != md.RecordType ||
+			!reflect.DeepEqual(existing.ColumnNames, md.ColumnNames) ||
+			!reflect.DeepEqual(existing.ColumnTypes, md.ColumnTypes) {
+			return 0, errors.New("the destination bucket has other columns or record type")
+		}
+		if resume && existing.LastEpoch >= epochStart {
+			epochStart = existing.LastEpoch + 1
+		}
+	}
+
+	if md.LastEpoch < epochEnd {
+		epochEnd = md.LastEpoch
+	}
+	isVariable := md.RecordType == "variable"
+	err = endpoint.Scan(src, md.Key, isVariable, epochStart, epochEnd, batch, func(cs *io.ColumnSeries) error {
+		if err := endpoint.Write(dst, md.Key, cs, isVariable); err != nil {
+			return err
+		}
+		copied += cs.Len()
+		return nil
+	})
+	return copied, err
+}
+
+// create creates the bucket in the destination with the columns and record
+// type of the source bucket
+func create(dst endpoint.Endpoint, md frontend.BucketMetadata) error {
+	var shapes []string
+	for i, name := range md.ColumnNames {
+		if name != "Epoch" {
+			shapes = append(shapes, name+"/"+md.ColumnTypes[i])
+		}
+	}
+	return endpoint.Create(dst, md.Key, strings.Join(shapes, ":"), md.RecordType)
+}
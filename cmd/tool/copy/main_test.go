@@ -0,0 +1,127 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	src endpoint.Endpoint
+}
+
+// destination records the buckets created and the epochs of the batches
+// written
+type destination struct {
+	shapes  map[string]string
+	batches [][]int64
+	last    int64
+}
+
+func (d *destination) Call(method string, args, reply interface{}) error {
+	switch method {
+	case "ListSymbols":
+		pattern := args.(*frontend.ListSymbolsArgs).Pattern
+		if _, ok := d.shapes[pattern]; ok {
+			reply.(*frontend.ListSymbolsResponse).Buckets = []frontend.BucketMetadata{{
+				Key:         pattern,
+				ColumnNames: []string{"Epoch", "Bid"},
+				ColumnTypes: []string{"int64", "float32"},
+				RecordType:  "variable",
+				LastEpoch:   d.last,
+			}}
+		}
+	case "Create":
+		req := args.(*frontend.MultiCreateRequest).Requests[0]
+		d.shapes[req.Key] = req.DataShapes + " " + req.RowType
+	case "Write":
+		csm, err := args.(*frontend.MultiWriteRequest).Requests[0].Data.ToColumnSeriesMap()
+		if err != nil {
+			return err
+		}
+		for _, cs := range csm {
+			d.batches = append(d.batches, cs.GetEpoch())
+		}
+	}
+	return nil
+}
+
+func (s *TestSuite) SetUpSuite(c *C) {
+	s.src = endpoint.New(c.MkDir(), "")
+
+	// 250 ticks, 10 a second from 1500000000
+	var response frontend.MultiServerResponse
+	c.Assert(s.src.Call("Create", &frontend.MultiCreateRequest{
+		Requests: []frontend.CreateRequest{{
+			Key:        "TEST/1Min/TICK:Symbol/Timeframe/AttributeGroup",
+			DataShapes: "Bid/float32",
+			RowType:    "variable",
+		}},
+	}, &response), IsNil)
+	c.Assert(response.Responses[0].Error, Equals, "")
+
+	cs := io.NewColumnSeries()
+	var epochs []int64
+	var nanos []int32
+	var bids []float32
+	for i := 0; i < 250; i++ {
+		epochs = append(epochs, 1500000000+int64(i/10))
+		nanos = append(nanos, int32(i%10)*1000000+1000)
+		bids = append(bids, float32(i))
+	}
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Bid", bids)
+	cs.AddColumn("Nanoseconds", nanos)
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/TICK"), cs)
+	c.Assert(executor.WriteCSM(csm, true), IsNil)
+}
+
+func (s *TestSuite) TestCopy(c *C) {
+	var listing frontend.ListSymbolsResponse
+	c.Assert(s.src.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: "*/1Min/TICK"}, &listing), IsNil)
+	c.Assert(listing.Buckets, HasLen, 1)
+
+	dst := &destination{shapes: map[string]string{}}
+	copied, err := copyBucket(s.src, dst, listing.Buckets[0], 0, 1600000000, false, 95)
+	c.Assert(err, IsNil)
+	c.Assert(copied, Equals, 250)
+	c.Assert(dst.shapes, DeepEquals, map[string]string{
+		"TEST/1Min/TICK:Symbol/Timeframe/AttributeGroup": "Bid/float32 variable",
+	})
+	// the seconds are written whole, in order
+	seconds := map[int64]int{}
+	var previous int64
+	for i, epochs := range dst.batches {
+		c.Assert(epochs[0] > previous, Equals, true)
+		previous = epochs[len(epochs)-1]
+		for _, epoch := range epochs {
+			if batch, ok := seconds[epoch]; ok {
+				c.Assert(batch, Equals, i)
+			}
+			seconds[epoch] = i
+		}
+	}
+	c.Assert(seconds, HasLen, 25)
+
+	// resumed after the last second copied
+	dst = &destination{shapes: map[string]string{"TEST/1Min/TICK": ""}, last: 1500000019}
+	copied, err = copyBucket(s.src, dst, listing.Buckets[0], 0, 1600000000, true, 95)
+	c.Assert(err, IsNil)
+	c.Assert(copied, Equals, 50)
+
+	// time range
+	dst = &destination{shapes: map[string]string{}}
+	copied, err = copyBucket(s.src, dst, listing.Buckets[0], 1500000005, 1500000006, false, 95)
+	c.Assert(err, IsNil)
+	c.Assert(copied, Equals, 20)
+
+}
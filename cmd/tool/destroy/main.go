@@ -0,0 +1,77 @@
+package destroy
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "destroy"
+	short   = "Destroy the buckets matching a pattern"
+	long    = "This command destroys the buckets of an instance or data directory whose key matches a glob pattern, with all of their records. Without --confirm, it only lists the buckets which would be destroyed."
+	example = "marketstore tool destroy --target localhost:5993 --keys \"TEST*/*/*\" --confirm"
+
+	// Flag descriptions.
+	targetDesc  = "instance at \"hostname:port\", or data directory, whose buckets are destroyed"
+	apiKeyDesc  = "API key sent to the instance"
+	keysDesc    = "glob pattern of the bucket keys, such as \"TEST*/*/*\""
+	confirmDesc = "destroy the buckets rather than only listing them, default is false"
+)
+
+var (
+	// Available flags.
+	target, apiKey, keys string
+	confirm              bool
+
+	// Cmd is the destroy command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeDestroy,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().StringVar(&keys, "keys", "", keysDesc)
+	Cmd.MarkFlagRequired("keys")
+	Cmd.Flags().BoolVar(&confirm, "confirm", false, confirmDesc)
+}
+
+// executeDestroy implements the destroy tool.
+func executeDestroy(cmd *cobra.Command, args []string) error {
+	var response frontend.AdminResponse
+	err := endpoint.New(target, apiKey).Call("DestroyPattern",
+		&frontend.DestroyPatternArgs{Pattern: keys, DryRun: !confirm}, &response)
+	if err != nil {
+		return err
+	}
+
+	destroyed := "destroyed"
+	if !confirm {
+		destroyed = "would be destroyed"
+	}
+	for _, result := range response.Results {
+		if result.Error != "" {
+			fmt.Printf("%s: %s\n", result.Key, result.Error)
+			continue
+		}
+		fmt.Printf("%s: %s\n", result.Key, destroyed)
+	}
+	fmt.Printf("%d buckets %s\n", len(response.Results)-response.Failed, destroyed)
+	if !confirm && len(response.Results) > response.Failed {
+		fmt.Println("run again with --confirm to destroy them")
+	}
+	if response.Failed > 0 {
+		return fmt.Errorf("%d buckets failed", response.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Package endpoint calls the RPC methods of an instance, over HTTP or in this
+// process on a data directory, for the tools which work with either.
+package endpoint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/rpc/msgpack2"
+)
+
+// Endpoint is an instance whose DataService methods are called
+type Endpoint interface {
+	Call(method string, args, reply interface{}) error
+}
+
+// New returns the endpoint of the data directory, set up in this process, or
+// else of the instance at "hostname:port" or its URL
+func New(location, apiKey string) Endpoint {
+	if IsDir(location) {
+		initCatalog, initWALCache, backgroundSync, WALBypass := true, true, false, true
+		executor.NewInstanceSetup(location, initCatalog, initWALCache, backgroundSync, WALBypass)
+		atomic.StoreUint32(&frontend.Queryable, uint32(1))
+		return &local{service: &frontend.DataService{}}
+	}
+	url := location
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	return &remote{url: strings.TrimSuffix(url, "/") + "/rpc", apiKey: apiKey}
+}
+
+// IsDir returns whether the location is a data directory
+func IsDir(location string) bool {
+	fi, err := os.Stat(location)
+	return err == nil && fi.IsDir()
+}
+
+// local calls the RPC methods of this process on its data directory
+type local struct {
+	service *frontend.DataService
+}
+
+func (l *local) Call(method string, args, reply interface{}) error {
+	results := reflect.ValueOf(l.service).MethodByName(method).Call([]reflect.Value{
+		reflect.Zero(reflect.TypeOf((*http.Request)(nil))),
+		reflect.ValueOf(args),
+		reflect.ValueOf(reply),
+	})
+	err, _ := results[0].Interface().(error)
+	return err
+}
+
+// remote calls the RPC methods of an instance
+type remote struct {
+	url, apiKey string
+}
+
+func (r *remote) Call(method string, args, reply interface{}) error {
+	message, err := msgpack2.EncodeClientRequest("DataService."+method, args)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", r.url, bytes.NewBuffer(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-msgpack")
+	req.Header.Set(frontend.APIVersionHeader, strconv.Itoa(frontend.CurrentAPIVersion))
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("response error (%d): %s", resp.StatusCode, string(body))
+	}
+	return msgpack2.DecodeClientResponse(resp.Body, reply)
+}
+
+// Query returns the records of the bucket between the epochs, at most limit
+// of them unless 0
+func Query(e Endpoint, key string, epochStart, epochEnd int64, limit int) (*io.ColumnSeries, error) {
+	builder := frontend.NewQueryRequestBuilder(key).
+		EpochStart(epochStart).
+		EpochEnd(epochEnd)
+	if limit > 0 {
+		builder = builder.LimitRecordCount(limit).LimitFromStart(true)
+	}
+	return Run(e, builder.End())
+}
+
+// Scan passes the records of the bucket between the epochs to fn in order,
+// in batches of about batch records.  The variable length records are passed
+// by whole seconds, so that a scan resumes after the last second passed.
+func Scan(e Endpoint, key string, isVariable bool, epochStart, epochEnd int64, batch int,
+	fn func(cs *io.ColumnSeries) error) error {
+
+	limit := batch
+	for epochStart <= epochEnd {
+		cs, err := Query(e, key, epochStart, epochEnd, limit)
+		if err != nil {
+			return err
+		}
+		if !isVariable {
+			// the start is rounded down to its interval, whose record was passed
+			epochs := cs.GetEpoch()
+			n := 0
+			for n < len(epochs) && epochs[n] < epochStart {
+				n++
+			}
+			if n == len(epochs) {
+				return nil
+			}
+			last := epochs[len(epochs)-1]
+			cs.RestrictLength(len(epochs)-n, io.LAST)
+			if err = fn(cs); err != nil {
+				return err
+			}
+			epochStart = last + 1
+			continue
+		}
+
+		/*
+			The limit of a variable length query counts the records of
+			its first interval before the start, so it is raised until
+			records are returned.  The records of their last second are
+			then read at once, since the limit may have cut it.
+		*/
+		if cs.Len() == 0 {
+			limit *= 2
+			continue
+		}
+		limit = batch
+		epochs := cs.GetEpoch()
+		last := epochs[len(epochs)-1]
+		n := len(epochs)
+		for n > 0 && epochs[n-1] == last {
+			n--
+		}
+		if n > 0 {
+			cs.RestrictLength(n, io.FIRST)
+			if err = fn(cs); err != nil {
+				return err
+			}
+		}
+		if cs, err = Query(e, key, last, last, 0); err != nil {
+			return err
+		}
+		if err = fn(cs); err != nil {
+			return err
+		}
+		epochStart = last + 1
+	}
+	return nil
+}
+
+// Run returns the records of the query, of a single bucket
+func Run(e Endpoint, req frontend.QueryRequest) (*io.ColumnSeries, error) {
+	var response frontend.MultiQueryResponse
+	err := e.Call("Query", &frontend.MultiQueryRequest{Requests: []frontend.QueryRequest{req}}, &response)
+	if err != nil {
+		if strings.Contains(err.Error(), planner.ErrNoFiles.Error()) {
+			return io.NewColumnSeries(), nil
+		}
+		return nil, err
+	}
+	csm, err := response.ToColumnSeriesMap()
+	if err != nil {
+		return nil, err
+	}
+	for _, cs := range *csm {
+		return cs, nil
+	}
+	return io.NewColumnSeries(), nil
+}
+
+// Write writes the records to the bucket
+func Write(e Endpoint, key string, cs *io.ColumnSeries, isVariable bool) error {
+	if cs.Len() == 0 {
+		return nil
+	}
+	np, err := io.NewNumpyDataset(cs)
+	if err != nil {
+		return err
+	}
+	npm, err := io.NewNumpyMultiDataset(np, *io.NewTimeBucketKey(key))
+	if err != nil {
+		return err
+	}
+	var response frontend.MultiServerResponse
+	err = e.Call("Write", &frontend.MultiWriteRequest{
+		Requests: []frontend.WriteRequest{{Data: npm, IsVariableLength: isVariable}},
+	}, &response)
+	return firstError(response, err)
+}
+
+// Create creates the bucket with the data shapes, such as "Bid/float32", and
+// row type, fixed or variable
+func Create(e Endpoint, key, dataShapes, rowType string) error {
+	var response frontend.MultiServerResponse
+	err := e.Call("Create", &frontend.MultiCreateRequest{
+		Requests: []frontend.CreateRequest{{
+			Key:        io.NewTimeBucketKey(key).String(),
+			DataShapes: dataShapes,
+			RowType:    rowType,
+		}},
+	}, &response)
+	return firstError(response, err)
+}
+
+// ParseTime returns the epoch of the date, such as 2006-01-02, or of the
+// RFC3339 time, in the timezone of the instance, defaultEpoch if empty
+func ParseTime(value string, defaultEpoch int64) (int64, error) {
+	if value == "" {
+		return defaultEpoch, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, utils.InstanceConfig.Timezone); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %s, must be 2006-01-02 or RFC3339", value)
+}
+
+func firstError(response frontend.MultiServerResponse, err error) error {
+	if err == nil && len(response.Responses) > 0 && response.Responses[0].Error != "" {
+		err = errors.New(response.Responses[0].Error)
+	}
+	return err
+}
@@ -0,0 +1,302 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "export <bucket or glob pattern>"
+	short   = "Export buckets as InfluxDB line protocol"
+	long    = "This command streams the records of buckets of an instance or data directory as InfluxDB line protocol, to an InfluxDB or QuestDB instance over HTTP or TCP, or to the standard output. The symbol and timeframe of a bucket are the tags of its lines and its other columns their fields."
+	example = "marketstore tool export --from localhost:5993 --to tcp://localhost:9009 --start 2019-01-01 \"*/1Min/OHLCV\""
+
+	// Flag descriptions.
+	fromDesc        = "source instance at \"hostname:port\", or data directory"
+	fromAPIKeyDesc  = "API key sent to the source instance"
+	toDesc          = "destination, as tcp://hostname:port, the HTTP write URL such as http://localhost:8086/write?db=mktsdb, or - for the standard output"
+	tokenDesc       = "token sent in the Authorization header of the HTTP writes"
+	startDesc       = "export the records from this time on, as 2006-01-02 or RFC3339"
+	endDesc         = "export the records until this time (inclusive), as 2006-01-02 or RFC3339"
+	measurementDesc = "measurement of the lines, default is the attribute group of the bucket"
+	batchDesc       = "number of records read and sent at once"
+
+	// Flag defaults.
+	defaultBatch = 10000
+)
+
+var (
+	// Available flags.
+	from, fromAPIKey, to, token string
+	start, end, measurement     string
+	batch                       int
+
+	// Cmd is the export command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    cobra.ExactArgs(1),
+		RunE:    executeExport,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&from, "from", "", fromDesc)
+	Cmd.MarkFlagRequired("from")
+	Cmd.Flags().StringVar(&fromAPIKey, "from_api_key", "", fromAPIKeyDesc)
+	Cmd.Flags().StringVar(&to, "to", "", toDesc)
+	Cmd.MarkFlagRequired("to")
+	Cmd.Flags().StringVar(&token, "token", "", tokenDesc)
+	Cmd.Flags().StringVar(&start, "start", "", startDesc)
+	Cmd.Flags().StringVar(&end, "end", "", endDesc)
+	Cmd.Flags().StringVar(&measurement, "measurement", "", measurementDesc)
+	Cmd.Flags().IntVar(&batch, "batch", defaultBatch, batchDesc)
+}
+
+// executeExport implements the export tool.
+func executeExport(cmd *cobra.Command, args []string) error {
+	if batch < 1 {
+		return errors.New("the batch must hold at least one record")
+	}
+	epochStart, err := endpoint.ParseTime(start, 0)
+	if err != nil {
+		return err
+	}
+	epochEnd, err := endpoint.ParseTime(end, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	s, err := newSink(to, token)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	src := endpoint.New(from, fromAPIKey)
+
+	var listing frontend.ListSymbolsResponse
+	err = src.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: args[0]}, &listing)
+	if err != nil {
+		return err
+	}
+	if len(listing.Buckets) == 0 {
+		return fmt.Errorf("no bucket matching %s in %s", args[0], from)
+	}
+	for _, md := range listing.Buckets {
+		exported, err := exportBucket(src, s, md, measurement, epochStart, epochEnd, batch)
+		if err != nil {
+			return fmt.Errorf("export of %s failed after %d records: %v", md.Key, exported, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d records exported\n", md.Key, exported)
+	}
+	return nil
+}
+
+// exportBucket sends the records of the bucket between the epochs as lines
+// of the measurement, the attribute group of the bucket if empty
+func exportBucket(src endpoint.Endpoint, s sink, md frontend.BucketMetadata, measurement string,
+	epochStart, epochEnd int64, batch int) (exported int, err error) {
+
+	tbk := io.NewTimeBucketKey(md.Key)
+	if measurement == "" {
+		measurement = tbk.GetItemInCategory("AttributeGroup")
+	}
+	tags := fmt.Sprintf("symbol=%s,timeframe=%s",
+		tagEscaper.Replace(tbk.GetItemInCategory("Symbol")), tagEscaper.Replace(tbk.GetItemInCategory("Timeframe")))
+	if md.LastEpoch < epochEnd {
+		epochEnd = md.LastEpoch
+	}
+
+	var lines bytes.Buffer
+	err = endpoint.Scan(src, md.Key, md.RecordType == "variable", epochStart, epochEnd, batch, func(cs *io.ColumnSeries) error {
+		lines.Reset()
+		appendLines(&lines, measurement, tags, cs)
+		if err := s.Send(lines.Bytes()); err != nil {
+			return err
+		}
+		exported += cs.Len()
+		return nil
+	})
+	return exported, err
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// appendLines appends a line of the measurement for each record, its columns
+// being the fields and its epoch and nanoseconds the timestamp in nanoseconds.
+// The fields which are not numbers, NaN or infinite, are left out.
+func appendLines(lines *bytes.Buffer, measurement, tags string, cs *io.ColumnSeries) {
+	epochs := cs.GetEpoch()
+	var nanos []int32
+	if ns, ok := cs.GetByName("Nanoseconds").([]int32); ok {
+		nanos = ns
+	}
+	var names []string
+	var columns []reflect.Value
+	for _, name := range cs.GetColumnNames() {
+		if name == "Epoch" || name == "Nanoseconds" {
+			continue
+		}
+		names = append(names, tagEscaper.Replace(name))
+		columns = append(columns, reflect.ValueOf(cs.GetByName(name)))
+	}
+
+	prefix := measurementEscaper.Replace(measurement) + "," + tags + " "
+	for i, epoch := range epochs {
+		start := lines.Len()
+		lines.WriteString(prefix)
+		fields := 0
+		for j, column := range columns {
+			value := formatField(column.Index(i))
+			if value == "" {
+				continue
+			}
+			if fields > 0 {
+				lines.WriteByte(',')
+			}
+			lines.WriteString(names[j])
+			lines.WriteByte('=')
+			lines.WriteString(value)
+			fields++
+		}
+		if fields == 0 {
+			lines.Truncate(start)
+			continue
+		}
+		ns := epoch * int64(time.Second)
+		if nanos != nil {
+			ns += int64(nanos[i])
+		}
+		lines.WriteByte(' ')
+		lines.WriteString(strconv.FormatInt(ns, 10))
+		lines.WriteByte('\n')
+	}
+}
+
+// formatField returns the value as a field value of line protocol, or an
+// empty string if it has none
+func formatField(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return ""
+		}
+		bits := 64
+		if v.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		return strconv.FormatFloat(f, 'g', -1, bits)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10) + "i"
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10) + "i"
+	case reflect.Bool:
+		if v.Bool() {
+			return "t"
+		}
+		return "f"
+	}
+	return ""
+}
+
+// sink is the destination the lines are sent to
+type sink interface {
+	Send(lines []byte) error
+	Close() error
+}
+
+// newSink returns the sink of the destination
+func newSink(to, token string) (sink, error) {
+	switch {
+	case to == "-":
+		return &writerSink{w: bufio.NewWriter(os.Stdout)}, nil
+	case strings.HasPrefix(to, "tcp://"):
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(to, "tcp://"), 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return &writerSink{w: bufio.NewWriter(conn), conn: conn}, nil
+	case strings.HasPrefix(to, "http://"), strings.HasPrefix(to, "https://"):
+		return &httpSink{url: to, token: token, client: &http.Client{Timeout: time.Minute}}, nil
+	}
+	return nil, fmt.Errorf("invalid destination %s, must be tcp://hostname:port, an HTTP URL or -", to)
+}
+
+// writerSink writes the lines to the standard output, or a TCP connection
+// of the line protocol
+type writerSink struct {
+	w    *bufio.Writer
+	conn net.Conn
+}
+
+func (s *writerSink) Send(lines []byte) error {
+	_, err := s.w.Write(lines)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	err := s.w.Flush()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// httpSink posts the lines to the write URL of an instance, which answers
+// with a 2xx status if they are written
+type httpSink struct {
+	url, token string
+	client     *http.Client
+}
+
+func (s *httpSink) Send(lines []byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("write error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
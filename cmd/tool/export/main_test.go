@@ -0,0 +1,103 @@
+package export
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	src endpoint.Endpoint
+}
+
+func (s *TestSuite) SetUpSuite(c *C) {
+	s.src = endpoint.New(c.MkDir(), "")
+	c.Assert(endpoint.Create(s.src, "TEST/1Min/OHLCV", "Close/float32:Volume/int64", "fixed"), IsNil)
+
+	cs := io.NewColumnSeries()
+	var epochs, volumes []int64
+	var closes []float32
+	for i := 0; i < 250; i++ {
+		epochs = append(epochs, 1500000000+int64(i)*60)
+		closes = append(closes, float32(i)+0.5)
+		volumes = append(volumes, int64(i))
+	}
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Close", closes)
+	cs.AddColumn("Volume", volumes)
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/OHLCV"), cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+}
+
+func (s *TestSuite) TestAppendLines(c *C) {
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{1500000000, 1500000001, 1500000002})
+	cs.AddColumn("Bid Price", []float64{1.25, math.NaN(), math.NaN()})
+	cs.AddColumn("Size", []uint32{100, 200, 0})
+	cs.AddColumn("Odd", []bool{true, false, false})
+	cs.AddColumn("Nanoseconds", []int32{5, 0, 0})
+	cs2 := io.NewColumnSeries()
+	cs2.AddColumn("Epoch", []int64{1500000002})
+	cs2.AddColumn("Bid", []float32{math.Float32frombits(0x7fc00000)})
+
+	var lines bytes.Buffer
+	appendLines(&lines, "TICK data", "symbol=BRK\\ B,timeframe=1Sec", cs)
+	appendLines(&lines, "TICK", "symbol=A,timeframe=1Sec", cs2)
+	c.Assert(lines.String(), Equals, `TICK\ data,symbol=BRK\ B,timeframe=1Sec Bid\ Price=1.25,Size=100i,Odd=t 1500000000000000005
+TICK\ data,symbol=BRK\ B,timeframe=1Sec Size=200i,Odd=f 1500000001000000000
+TICK\ data,symbol=BRK\ B,timeframe=1Sec Size=0i,Odd=f 1500000002000000000
+`)
+}
+
+func (s *TestSuite) TestExport(c *C) {
+	var posts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), "Close=100.5") {
+			http.Error(w, "partial write", http.StatusBadRequest)
+			return
+		}
+		posts = append(posts, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var listing frontend.ListSymbolsResponse
+	c.Assert(s.src.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: "TEST/*/*"}, &listing), IsNil)
+	c.Assert(listing.Buckets, HasLen, 1)
+
+	sink, err := newSink(server.URL+"/write?db=test", "")
+	c.Assert(err, IsNil)
+	exported, err := exportBucket(s.src, sink, listing.Buckets[0], "", 1500000000, 1500000000+99*60, 30)
+	c.Assert(err, IsNil)
+	c.Assert(exported, Equals, 100)
+	c.Assert(posts, HasLen, 4)
+	c.Assert(strings.Count(strings.Join(posts, ""), "\n"), Equals, 100)
+	c.Assert(strings.SplitN(posts[0], "\n", 2)[0], Equals,
+		"OHLCV,symbol=TEST,timeframe=1Min Close=0.5,Volume=0i 1500000000000000000")
+
+	// the errors of the destination stop the export
+	posts = nil
+	exported, err = exportBucket(s.src, sink, listing.Buckets[0], "bars", 0, math.MaxInt64, 30)
+	c.Assert(err, ErrorMatches, `write error \(400\): partial write`)
+	c.Assert(exported, Equals, 88)
+	c.Assert(strings.HasPrefix(posts[0], "bars,symbol=TEST"), Equals, true)
+
+	_, err = newSink("localhost:9009", "")
+	c.Assert(err, NotNil)
+}
@@ -1,8 +1,22 @@
 package tool
 
 import (
+	"github.com/alpacahq/marketstore/cmd/tool/actions"
+	"github.com/alpacahq/marketstore/cmd/tool/bench"
+	"github.com/alpacahq/marketstore/cmd/tool/check"
+	"github.com/alpacahq/marketstore/cmd/tool/compact"
+	"github.com/alpacahq/marketstore/cmd/tool/copy"
+	"github.com/alpacahq/marketstore/cmd/tool/destroy"
+	"github.com/alpacahq/marketstore/cmd/tool/export"
 	"github.com/alpacahq/marketstore/cmd/tool/integrity"
+	"github.com/alpacahq/marketstore/cmd/tool/prune"
+	"github.com/alpacahq/marketstore/cmd/tool/rename"
+	"github.com/alpacahq/marketstore/cmd/tool/resample"
+	"github.com/alpacahq/marketstore/cmd/tool/stats"
+	"github.com/alpacahq/marketstore/cmd/tool/trim"
+	"github.com/alpacahq/marketstore/cmd/tool/verify"
 	"github.com/alpacahq/marketstore/cmd/tool/wal"
+	"github.com/alpacahq/marketstore/cmd/tool/waldump"
 	"github.com/spf13/cobra"
 )
 
@@ -19,12 +33,26 @@ var (
 		Use:        usage,
 		Short:      short,
 		Long:       long,
-		SuggestFor: []string{"wal", "integrity"},
+		SuggestFor: []string{"wal", "integrity", "check", "compact", "copy", "stats", "waldump", "bench", "trim", "verify", "export", "rename", "destroy", "resample", "prune", "actions"},
 		Example:    example,
 	}
 )
 
 func init() {
+	Cmd.AddCommand(actions.Cmd)
+	Cmd.AddCommand(bench.Cmd)
+	Cmd.AddCommand(check.Cmd)
+	Cmd.AddCommand(compact.Cmd)
+	Cmd.AddCommand(copy.Cmd)
+	Cmd.AddCommand(destroy.Cmd)
+	Cmd.AddCommand(export.Cmd)
 	Cmd.AddCommand(integrity.Cmd)
+	Cmd.AddCommand(prune.Cmd)
+	Cmd.AddCommand(rename.Cmd)
+	Cmd.AddCommand(resample.Cmd)
+	Cmd.AddCommand(stats.Cmd)
+	Cmd.AddCommand(trim.Cmd)
+	Cmd.AddCommand(verify.Cmd)
 	Cmd.AddCommand(wal.Cmd)
+	Cmd.AddCommand(waldump.Cmd)
 }
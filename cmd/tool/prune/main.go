@@ -0,0 +1,195 @@
+package prune
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/gobwas/glob"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	usage   = "prune"
+	short   = "Delete the records older than the retention policy"
+	long    = "This command applies the retention rules of a policy file to the buckets of an instance or data directory in one pass, deleting from each bucket the records older than the period of the first rule matching it, such as from cron. A dry run lists the buckets and the disk space which would be freed."
+	example = "marketstore tool prune --target localhost:5993 --policy retention.yaml --dry-run"
+
+	// Flag descriptions.
+	targetDesc = "instance at \"hostname:port\", or data directory, pruned"
+	apiKeyDesc = "API key sent to the instance"
+	policyDesc = "path of the YAML retention policy file"
+	dryRunDesc = "only list the buckets and the space which would be freed, default is false"
+
+	// forever is the period of the rules keeping every record
+	forever = "forever"
+)
+
+var (
+	// Available flags.
+	target, apiKey, policyPath string
+	dryRun                     bool
+
+	// Cmd is the prune command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executePrune,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().StringVar(&policyPath, "policy", "", policyDesc)
+	Cmd.MarkFlagRequired("policy")
+	Cmd.Flags().BoolVar(&dryRun, "dry-run", false, dryRunDesc)
+}
+
+// Policy is the retention policy file, such as:
+//
+//	rules:
+//	  - timeframe: 1Sec
+//	    keep: 30D
+//	  - timeframe: 1Min
+//	    attribute_group: TICK
+//	    keep: 1Y
+//	  - symbol: "SPY"
+//	    keep: forever
+type Policy struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Rule keeps the records of the buckets it matches for a period, the first
+// rule matching a bucket applying to it
+type Rule struct {
+	// Glob patterns of the items of the bucket keys, * if omitted
+	Symbol         string `yaml:"symbol"`
+	Timeframe      string `yaml:"timeframe"`
+	AttributeGroup string `yaml:"attribute_group"`
+	// Period the records are kept for, as a timeframe such as 30D or 1Y,
+	// or forever
+	Keep string `yaml:"keep"`
+
+	pattern glob.Glob
+	period  time.Duration
+}
+
+// Pattern returns the glob pattern of the bucket keys of the rule
+func (r *Rule) Pattern() string {
+	items := []string{r.Symbol, r.Timeframe, r.AttributeGroup}
+	for i, item := range items {
+		if item == "" {
+			items[i] = "*"
+		}
+	}
+	return strings.Join(items, "/")
+}
+
+// loadPolicy returns the policy of the file, whose rules are validated
+func loadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err = yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	if len(policy.Rules) == 0 {
+		return nil, fmt.Errorf("no rules in policy %s", path)
+	}
+	for i, rule := range policy.Rules {
+		if rule.pattern, err = glob.Compile(rule.Pattern(), '/'); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid pattern %s: %v", i+1, rule.Pattern(), err)
+		}
+		if rule.Keep == forever {
+			continue
+		}
+		tf := utils.TimeframeFromString(rule.Keep)
+		if tf == nil {
+			return nil, fmt.Errorf("rule %d: invalid period \"%s\", must be a timeframe such as 30D or forever", i+1, rule.Keep)
+		}
+		rule.period = tf.Duration
+	}
+	return policy, nil
+}
+
+// executePrune implements the prune tool.
+func executePrune(cmd *cobra.Command, args []string) error {
+	policy, err := loadPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+	response, err := prune(endpoint.New(target, apiKey), policy, time.Now(), dryRun)
+	if err != nil {
+		return err
+	}
+
+	freed := "freed"
+	if dryRun {
+		freed = "would be freed"
+	}
+	var total int64
+	for _, result := range response.Results {
+		if result.Error != "" {
+			fmt.Printf("%s: %s\n", result.Key, result.Error)
+			continue
+		}
+		fmt.Printf("%s: %d bytes %s\n", result.Key, result.Freed, freed)
+		total += result.Freed
+	}
+	fmt.Printf("%d buckets, %d bytes %s\n", len(response.Results)-response.Failed, total, freed)
+	if response.Failed > 0 {
+		return fmt.Errorf("%d buckets failed", response.Failed)
+	}
+	return nil
+}
+
+// prune trims every bucket of a rule other than forever to the records of
+// its period before now, and returns the results of the buckets trimmed
+func prune(e endpoint.Endpoint, policy *Policy, now time.Time, dryRun bool) (*frontend.AdminResponse, error) {
+	var listing frontend.ListSymbolsResponse
+	err := e.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: "*/*/*"}, &listing)
+	if err != nil {
+		return nil, err
+	}
+	pruned := &frontend.AdminResponse{}
+	for _, md := range listing.Buckets {
+		rule := policy.match(md.Key)
+		if rule == nil || rule.Keep == forever {
+			continue
+		}
+		var response frontend.AdminResponse
+		err = e.Call("Trim", &frontend.TrimArgs{
+			Pattern: glob.QuoteMeta(md.Key),
+			Before:  now.Add(-rule.period).Unix(),
+			DryRun:  dryRun,
+		}, &response)
+		if err != nil {
+			return nil, err
+		}
+		pruned.Results = append(pruned.Results, response.Results...)
+		pruned.Failed += response.Failed
+	}
+	return pruned, nil
+}
+
+// match returns the first rule matching the bucket key, nil if none
+func (p *Policy) match(key string) *Rule {
+	for _, rule := range p.Rules {
+		if rule.pattern.Match(key) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package prune
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	e endpoint.Endpoint
+}
+
+func (s *TestSuite) SetUpSuite(c *C) {
+	s.e = endpoint.New(c.MkDir(), "")
+
+	// 48 hourly records from 1499997600 in each bucket
+	csm := io.NewColumnSeriesMap()
+	for _, key := range []string{"TEST/1H/OHLCV", "TEST/1H/TICK", "KEEP/1H/OHLCV"} {
+		cs := io.NewColumnSeries()
+		var epochs []int64
+		var prices []float32
+		for i := 0; i < 48; i++ {
+			epochs = append(epochs, 1499997600+int64(i)*3600)
+			prices = append(prices, float32(i))
+		}
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Price", prices)
+		csm.AddColumnSeries(*io.NewTimeBucketKey(key), cs)
+	}
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+}
+
+func writePolicy(c *C, policy string) string {
+	path := filepath.Join(c.MkDir(), "retention.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(policy), 0600), IsNil)
+	return path
+}
+
+func (s *TestSuite) TestPolicy(c *C) {
+	_, err := loadPolicy(writePolicy(c, "rules:\n  - timeframe: 1H\n    keep: 10Days\n"))
+	c.Assert(err, IsNil)
+	_, err = loadPolicy(writePolicy(c, "rules:\n  - timeframe: 1H\n    keep: always\n"))
+	c.Assert(err, ErrorMatches, "rule 1: invalid period.*")
+	_, err = loadPolicy(writePolicy(c, "rules:\n  - timeframe: 1H\n    keep: 1D\n    group: TICK\n"))
+	c.Assert(err, ErrorMatches, "(?s)invalid policy.*")
+	_, err = loadPolicy(writePolicy(c, "rules: []\n"))
+	c.Assert(err, ErrorMatches, "no rules.*")
+}
+
+func (s *TestSuite) TestPrune(c *C) {
+	policy, err := loadPolicy(writePolicy(c, `
+rules:
+  - symbol: KEEP
+    keep: forever
+  - attribute_group: TICK
+    keep: 12H
+  - timeframe: 1H
+    keep: 1D
+`))
+	c.Assert(err, IsNil)
+	now := time.Unix(1499997600+48*3600, 0)
+
+	// a dry run deletes nothing
+	response, err := prune(s.e, policy, now, true)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, HasLen, 2)
+	c.Assert(response.Failed, Equals, 0)
+	for _, key := range []string{"TEST/1H/OHLCV", "TEST/1H/TICK", "KEEP/1H/OHLCV"} {
+		cs, err := endpoint.Query(s.e, key, 0, now.Unix(), 0)
+		c.Assert(err, IsNil)
+		c.Assert(cs.Len(), Equals, 48)
+	}
+
+	// the first rule matching a bucket applies to it
+	response, err = prune(s.e, policy, now, false)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, HasLen, 2)
+	c.Assert(response.Failed, Equals, 0)
+	for key, left := range map[string]int{"TEST/1H/OHLCV": 24, "TEST/1H/TICK": 12, "KEEP/1H/OHLCV": 48} {
+		cs, err := endpoint.Query(s.e, key, 0, now.Unix(), 0)
+		c.Assert(err, IsNil)
+		c.Assert(cs.Len(), Equals, left, Commentf(key))
+	}
+}
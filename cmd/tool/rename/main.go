@@ -0,0 +1,88 @@
+package rename
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "rename"
+	short   = "Rename a symbol across all of its buckets, or a column"
+	long    = "This command renames a symbol of an instance or data directory along with all of its buckets, of every timeframe and attribute group, which are found under either the old or the new symbol, never some of each. The old symbol can be left behind as an alias, so that its queries keep reading the renamed buckets. With --columns, it renames a column of the buckets matching a pattern instead, in the headers of their year files."
+	example = "marketstore tool rename --target localhost:5993 --from FB --to META --alias\n  marketstore tool rename --target localhost:5993 --columns '*/1Min/OHLCV' --from Vol --to Volume"
+
+	// Flag descriptions.
+	targetDesc  = "instance at \"hostname:port\", or data directory, whose symbol is renamed"
+	apiKeyDesc  = "API key sent to the instance"
+	fromDesc    = "symbol or column renamed"
+	toDesc      = "new name of the symbol or column"
+	aliasDesc   = "leave the old symbol behind as an alias of the new one, default is false"
+	columnsDesc = "glob pattern of the bucket keys whose column is renamed instead of a symbol"
+)
+
+var (
+	// Available flags.
+	target, apiKey string
+	from, to       string
+	alias          bool
+	columns        string
+
+	// Cmd is the rename command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeRename,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().StringVar(&from, "from", "", fromDesc)
+	Cmd.MarkFlagRequired("from")
+	Cmd.Flags().StringVar(&to, "to", "", toDesc)
+	Cmd.MarkFlagRequired("to")
+	Cmd.Flags().BoolVar(&alias, "alias", false, aliasDesc)
+	Cmd.Flags().StringVar(&columns, "columns", "", columnsDesc)
+}
+
+// executeRename implements the rename tool.
+func executeRename(cmd *cobra.Command, args []string) error {
+	var response frontend.AdminResponse
+	var err error
+	if columns != "" {
+		err = endpoint.New(target, apiKey).Call("RenameColumn",
+			&frontend.RenameColumnArgs{Pattern: columns, From: from, To: to}, &response)
+	} else {
+		err = endpoint.New(target, apiKey).Call("RenameSymbol",
+			&frontend.RenameSymbolArgs{From: from, To: to, Alias: alias}, &response)
+	}
+	if err != nil {
+		return err
+	}
+	for _, result := range response.Results {
+		if result.Error != "" {
+			fmt.Printf("%s: %s\n", result.Key, result.Error)
+			continue
+		}
+		if columns != "" {
+			fmt.Printf("%s: %s -> %s\n", result.Key, from, to)
+			continue
+		}
+		fmt.Printf("%s -> %s\n", result.Key, result.NewKey)
+	}
+	if response.Failed > 0 {
+		return fmt.Errorf("%d buckets failed", response.Failed)
+	}
+	if alias && columns == "" {
+		fmt.Printf("%s is an alias of %s\n", from, to)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package resample
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/contrib/ondiskagg/aggtrigger"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "resample <bucket or glob pattern>"
+	short   = "Write the aggregates of buckets at other timeframes"
+	long    = "This command reads the records of buckets of an instance or data directory and writes their bars at other timeframes, aggregated as the ondiskagg trigger does, to backfill the aggregates of records written without it"
+	example = "marketstore tool resample --target /data/mktsdb --to 5Min,1D --start 2017-01-01 \"*/1Min/OHLCV\""
+
+	// Flag descriptions.
+	targetDesc     = "instance at \"hostname:port\", or data directory, whose buckets are read and written"
+	apiKeyDesc     = "API key sent to the instance"
+	toDesc         = "comma separated timeframes of the aggregates, such as 5Min,1D"
+	vwapDesc       = "add the volume weighted average price of the bars, default is false"
+	tradeCountDesc = "add the number of trades of the bars, default is false"
+	calendarDesc   = "market calendar of the 1D and 1W bars, nasdaq, nyse, cme, jpx, crypto or the path of a calendar JSON or YAML file"
+	groupDesc      = "attribute group of the aggregates, default is that of the bucket, or OHLCV for variable length records"
+	startDesc      = "aggregate the records from this time on, as 2006-01-02 or RFC3339"
+	endDesc        = "aggregate the records until this time (inclusive), as 2006-01-02 or RFC3339"
+	batchDesc      = "number of records read at once"
+
+	// Flag defaults.
+	defaultBatch = 100000
+)
+
+var (
+	// Available flags.
+	target, apiKey, to string
+	vwap, tradeCount   bool
+	calendar, group    string
+	start, end         string
+	batch              int
+
+	// Cmd is the resample command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    cobra.ExactArgs(1),
+		RunE:    executeResample,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().StringVar(&to, "to", "", toDesc)
+	Cmd.MarkFlagRequired("to")
+	Cmd.Flags().BoolVar(&vwap, "vwap", false, vwapDesc)
+	Cmd.Flags().BoolVar(&tradeCount, "trade_count", false, tradeCountDesc)
+	Cmd.Flags().StringVar(&calendar, "calendar", "", calendarDesc)
+	Cmd.Flags().StringVar(&group, "group", "", groupDesc)
+	Cmd.Flags().StringVar(&start, "start", "", startDesc)
+	Cmd.Flags().StringVar(&end, "end", "", endDesc)
+	Cmd.Flags().IntVar(&batch, "batch", defaultBatch, batchDesc)
+}
+
+// executeResample implements the resample tool.
+func executeResample(cmd *cobra.Command, args []string) error {
+	if batch < 1 {
+		return errors.New("the batch must hold at least one record")
+	}
+	epochStart, err := endpoint.ParseTime(start, 0)
+	if err != nil {
+		return err
+	}
+	epochEnd, err := endpoint.ParseTime(end, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	r, err := newResampler(strings.Split(to, ","))
+	if err != nil {
+		return err
+	}
+	e := endpoint.New(target, apiKey)
+
+	var listing frontend.ListSymbolsResponse
+	err = e.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: args[0]}, &listing)
+	if err != nil {
+		return err
+	}
+	if len(listing.Buckets) == 0 {
+		return fmt.Errorf("no bucket matching %s in %s", args[0], target)
+	}
+	for _, md := range listing.Buckets {
+		written, err := resampleBucket(e, r, md, epochStart, epochEnd, batch)
+		for _, key := range sortedKeys(written) {
+			fmt.Printf("%s: %d bars written to %s\n", md.Key, written[key], key)
+		}
+		if err != nil {
+			return fmt.Errorf("resample of %s failed: %v", md.Key, err)
+		}
+	}
+	return nil
+}
+
+// newResampler returns the resampler of the ondiskagg trigger config of the
+// timeframes and flags
+func newResampler(timeframes []string) (*aggtrigger.Resampler, error) {
+	var destinations []interface{}
+	for _, tf := range timeframes {
+		if utils.TimeframeFromString(tf) == nil {
+			return nil, fmt.Errorf("invalid timeframe %s", tf)
+		}
+		destinations = append(destinations, map[string]interface{}{
+			"timeframe":   tf,
+			"vwap":        vwap,
+			"trade_count": tradeCount,
+		})
+	}
+	return aggtrigger.NewResampler(map[string]interface{}{
+		"destinations":    destinations,
+		"calendar":        calendar,
+		"attribute_group": group,
+	})
+}
+
+// resampleBucket writes the bars of the records of the bucket between the
+// epochs, and returns the number of bars written by destination bucket.  The
+// bars at the edges of the range are made of the records within it only.
+func resampleBucket(e endpoint.Endpoint, r *aggtrigger.Resampler, md frontend.BucketMetadata,
+	epochStart, epochEnd int64, batch int) (written map[string]int, err error) {
+
+	if md.LastEpoch < epochEnd {
+		epochEnd = md.LastEpoch
+	}
+	// the bars are made in the timezone of the bucket
+	loc, err := time.LoadLocation(md.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	written = map[string]int{}
+	scan := func(fn func(cs *io.ColumnSeries) error) error {
+		return endpoint.Scan(e, md.Key, md.RecordType == "variable", epochStart, epochEnd, batch,
+			func(cs *io.ColumnSeries) error {
+				cs.SetLocation(loc)
+				return fn(cs)
+			})
+	}
+	err = r.Resample(io.NewTimeBucketKey(md.Key), scan, func(aggTbk *io.TimeBucketKey, cs *io.ColumnSeries) error {
+		if err := endpoint.Write(e, aggTbk.GetItemKey(), cs, false); err != nil {
+			return err
+		}
+		written[aggTbk.GetItemKey()] += cs.Len()
+		return nil
+	})
+	return written, err
+}
+
+func sortedKeys(m map[string]int) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
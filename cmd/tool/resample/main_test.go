@@ -0,0 +1,79 @@
+package resample
+
+import (
+	"testing"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	e endpoint.Endpoint
+}
+
+func (s *TestSuite) SetUpSuite(c *C) {
+	s.e = endpoint.New(c.MkDir(), "")
+
+	// 180 bars of 1Min from 1500000000, 20 minutes past the hour
+	cs := io.NewColumnSeries()
+	var epochs []int64
+	var open, high, low, close []float32
+	var volume []int32
+	for i := 0; i < 180; i++ {
+		epochs = append(epochs, 1500000000+int64(i)*60)
+		open = append(open, float32(i))
+		high = append(high, float32(i)+1)
+		low = append(low, float32(i)-1)
+		close = append(close, float32(i)+0.5)
+		volume = append(volume, 1)
+	}
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Open", open)
+	cs.AddColumn("High", high)
+	cs.AddColumn("Low", low)
+	cs.AddColumn("Close", close)
+	cs.AddColumn("Volume", volume)
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/OHLCV"), cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+}
+
+func (s *TestSuite) TestResample(c *C) {
+	var listing frontend.ListSymbolsResponse
+	c.Assert(s.e.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: "TEST/1Min/OHLCV"}, &listing), IsNil)
+	c.Assert(listing.Buckets, HasLen, 1)
+
+	r, err := newResampler([]string{"5Min", "1H"})
+	c.Assert(err, IsNil)
+
+	// the batches split the bars, which are written once
+	written, err := resampleBucket(s.e, r, listing.Buckets[0], 0, 1600000000, 7)
+	c.Assert(err, IsNil)
+	c.Assert(written, DeepEquals, map[string]int{"TEST/5Min/OHLCV": 36, "TEST/1H/OHLCV": 4})
+
+	cs, err := endpoint.Query(s.e, "TEST/1H/OHLCV", 0, 1600000000, 0)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetEpoch(), DeepEquals, []int64{1499997600, 1500001200, 1500004800, 1500008400})
+	c.Assert(cs.GetByName("Open").([]float32), DeepEquals, []float32{0, 20, 80, 140})
+	c.Assert(cs.GetByName("High").([]float32), DeepEquals, []float32{20, 80, 140, 180})
+	c.Assert(cs.GetByName("Low").([]float32), DeepEquals, []float32{-1, 19, 79, 139})
+	c.Assert(cs.GetByName("Close").([]float32), DeepEquals, []float32{19.5, 79.5, 139.5, 179.5})
+	c.Assert(cs.GetByName("Volume").([]int32), DeepEquals, []int32{20, 60, 60, 40})
+
+	cs, err = endpoint.Query(s.e, "TEST/5Min/OHLCV", 0, 1600000000, 0)
+	c.Assert(err, IsNil)
+	c.Assert(cs.Len(), Equals, 36)
+	c.Assert(cs.GetEpoch()[1], Equals, int64(1500000300))
+	c.Assert(cs.GetByName("Open").([]float32)[1], Equals, float32(5))
+	c.Assert(cs.GetByName("Close").([]float32)[1], Equals, float32(9.5))
+
+	_, err = newResampler([]string{"Min5"})
+	c.Assert(err, NotNil)
+}
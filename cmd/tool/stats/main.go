@@ -0,0 +1,298 @@
+package stats
+
+import (
+	"fmt"
+	stdio "io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"unsafe"
+
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/klauspost/compress/snappy"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "stats"
+	short   = "Report the disk usage and coverage of the buckets of a database"
+	long    = "This command reports the disk usage, row count and first and last records of each bucket of a database, the largest first, with the totals by symbol and timeframe"
+	example = "marketstore tool stats --dir <path> --top 20"
+
+	// Flag descriptions.
+	rootDirPathDesc  = "set filesystem path of the directory containing the database files"
+	topDesc          = "only report the largest buckets, all of them if 0"
+	uncompressedDesc = "the variable length records were written with disable_variable_compression"
+
+	// recordsPerRead is the number of fixed length records read at once
+	recordsPerRead = 4096
+)
+
+var (
+	// Available flags.
+	rootDirPath  string
+	top          int
+	uncompressed bool
+
+	// Cmd is the stats command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeStats,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVarP(&rootDirPath, "dir", "d", "", rootDirPathDesc)
+	Cmd.MarkFlagRequired("dir")
+	Cmd.Flags().IntVar(&top, "top", 0, topDesc)
+	Cmd.Flags().BoolVar(&uncompressed, "uncompressed", false, uncompressedDesc)
+}
+
+// bucketStats is the disk usage and coverage of a bucket
+type bucketStats struct {
+	Key string
+	// bytes allocated on disk, less than the size of sparse files
+	Disk        int64
+	Rows        int64
+	First, Last time.Time
+}
+
+func (b *bucketStats) add(file *bucketStats) {
+	b.Disk += file.Disk
+	b.Rows += file.Rows
+	if !file.First.IsZero() && (b.First.IsZero() || file.First.Before(b.First)) {
+		b.First = file.First
+	}
+	if file.Last.After(b.Last) {
+		b.Last = file.Last
+	}
+}
+
+// executeStats implements the stats tool.
+func executeStats(cmd *cobra.Command, args []string) error {
+	rootDirPath = filepath.Clean(rootDirPath)
+	buckets, err := gatherStats(rootDirPath, !uncompressed)
+	if err != nil {
+		return err
+	}
+
+	var total bucketStats
+	bySymbol, byTimeframe := map[string]*bucketStats{}, map[string]*bucketStats{}
+	for _, b := range buckets {
+		total.add(b)
+		parts := strings.Split(b.Key, "/")
+		addTo(bySymbol, parts[0], b)
+		addTo(byTimeframe, parts[1], b)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tDISK\tROWS\tFIRST\tLAST")
+	shown := buckets
+	if top > 0 && top < len(shown) {
+		shown = shown[:top]
+	}
+	writeStats(w, shown)
+	fmt.Fprintln(w, "\nSYMBOL\tDISK\tROWS\tFIRST\tLAST")
+	writeStats(w, sorted(bySymbol))
+	fmt.Fprintln(w, "\nTIMEFRAME\tDISK\tROWS\tFIRST\tLAST")
+	writeStats(w, sorted(byTimeframe))
+	fmt.Fprintln(w)
+	total.Key = fmt.Sprintf("%d buckets", len(buckets))
+	writeStats(w, []*bucketStats{&total})
+	return w.Flush()
+}
+
+// addTo adds the stats of the bucket to those of its group
+func addTo(groups map[string]*bucketStats, name string, b *bucketStats) {
+	if groups[name] == nil {
+		groups[name] = &bucketStats{Key: name}
+	}
+	groups[name].add(b)
+}
+
+func writeStats(w stdio.Writer, stats []*bucketStats) {
+	for _, b := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", b.Key, formatBytes(b.Disk), b.Rows, formatTime(b.First), formatTime(b.Last))
+	}
+}
+
+// sorted returns the stats by decreasing disk usage
+func sorted(stats map[string]*bucketStats) (out []*bucketStats) {
+	for _, b := range stats {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Disk != out[j].Disk {
+			return out[i].Disk > out[j].Disk
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// gatherStats returns the stats of every bucket of the data directory,
+// by decreasing disk usage
+func gatherStats(root string, compressed bool) ([]*bucketStats, error) {
+	buckets := map[string]*bucketStats{}
+	err := filepath.Walk(root, func(filePath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || filepath.Ext(filePath) != ".bin" {
+			return nil
+		}
+		key, _ := filepath.Rel(root, filepath.Dir(filePath))
+		key = filepath.ToSlash(key)
+		if len(strings.Split(key, "/")) != 3 {
+			return nil
+		}
+		file, err := fileStats(filePath, compressed)
+		if err != nil {
+			return fmt.Errorf("%s: %v, run tool check", filePath, err)
+		}
+		if buckets[key] == nil {
+			buckets[key] = &bucketStats{Key: key}
+		}
+		buckets[key].add(file)
+		return nil
+	})
+	return sorted(buckets), err
+}
+
+// fileStats returns the disk usage, row count and the times of the first and
+// last rows of the year file
+func fileStats(filePath string, compressed bool) (*bucketStats, error) {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	stats := &bucketStats{Disk: fi.Size()}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		stats.Disk = st.Blocks * 512
+	}
+
+	var header [io.Headersize]byte
+	if _, err = fp.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("short header read (%v)", err)
+	}
+	tbi := io.NewTimeBucketInfoFromHeader((*io.Header)(unsafe.Pointer(&header)), filePath)
+	if tbi.GetTimeframe() <= 0 {
+		return nil, fmt.Errorf("damaged header")
+	}
+	if tbi.GetRecordType() == io.VARIABLE {
+		return stats, variableStats(fp, tbi, compressed, stats)
+	}
+	return stats, fixedStats(fp, tbi, fi.Size(), stats)
+}
+
+// fixedStats counts the records of a fixed length file, which hold the index
+// of their interval, zero if empty
+func fixedStats(fp *os.File, tbi *io.TimeBucketInfo, size int64, stats *bucketStats) error {
+	recordLength := int(tbi.GetRecordLength())
+	buffer := make([]byte, recordsPerRead*recordLength)
+	for offset := int64(io.Headersize); offset < size; offset += int64(len(buffer)) {
+		n, err := fp.ReadAt(buffer, offset)
+		if err != nil && err != stdio.EOF {
+			return err
+		}
+		for i := 0; i+recordLength <= n; i += recordLength {
+			if index := io.ToInt64(buffer[i:]); index != 0 {
+				t := io.IndexToTime(index, tbi.GetTimeframe(), tbi.Year)
+				stats.Rows++
+				if stats.First.IsZero() {
+					stats.First = t
+				}
+				stats.Last = t
+			}
+		}
+	}
+	return nil
+}
+
+// variableStats counts the records of a variable length file from the
+// length of the data of its intervals, the first and last rows being those
+// of the first and last intervals
+func variableStats(fp *os.File, tbi *io.TimeBucketInfo, compressed bool, stats *bucketStats) error {
+	dataStart := io.FileSize(tbi.GetTimeframe(), int(tbi.Year), int(tbi.GetRecordLength()))
+	index := make([]byte, dataStart-io.Headersize)
+	n, err := fp.ReadAt(index, io.Headersize)
+	if err != nil && err != stdio.EOF {
+		return err
+	}
+	index = index[:n-n%24]
+
+	varRecLen := int(tbi.GetVariableRecordLength())
+	var first, last []byte
+	var firstIndex, lastIndex int64
+	for i := 0; i < len(index); i += 24 {
+		recIndex, offset, length := io.ToInt64(index[i:]), io.ToInt64(index[i+8:]), io.ToInt64(index[i+16:])
+		if recIndex == 0 {
+			continue
+		}
+		data := make([]byte, length)
+		if _, err = fp.ReadAt(data, offset); err != nil {
+			return err
+		}
+		if compressed {
+			if data, err = snappy.Decode(nil, data); err != nil {
+				return err
+			}
+		}
+		if len(data) < varRecLen {
+			continue
+		}
+		stats.Rows += int64(len(data) / varRecLen)
+		if first == nil {
+			first, firstIndex = data[:varRecLen], recIndex
+		}
+		last, lastIndex = data[len(data)-varRecLen:], recIndex
+	}
+	if first != nil {
+		stats.First = recordTime(tbi, firstIndex, first)
+		stats.Last = recordTime(tbi, lastIndex, last)
+	}
+	return nil
+}
+
+// recordTime returns the time of a variable length record, from the interval
+// ticks of its trailer
+func recordTime(tbi *io.TimeBucketInfo, index int64, record []byte) time.Time {
+	ticks := io.ToUInt32(record[len(record)-4:])
+	start := io.IndexToTime(index, tbi.GetTimeframe(), tbi.Year)
+	fraction := float64(ticks) / float64(math.MaxUint32)
+	return start.Add(time.Duration(fraction * float64(tbi.GetTimeframe())))
+}
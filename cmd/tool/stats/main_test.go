@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/klauspost/compress/snappy"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func makeFile(c *C, root, key string, year int16, rt io.EnumRecordType) *os.File {
+	dir := filepath.Join(root, key)
+	c.Assert(os.MkdirAll(dir, 0700), IsNil)
+	tbi := io.NewTimeBucketInfo(*utils.TimeframeFromString("1Min"), dir, "test", year,
+		[]io.DataShape{{Name: "Bid", Type: io.FLOAT32}}, rt)
+	fp, err := os.OpenFile(tbi.Path, os.O_CREATE|os.O_RDWR, 0600)
+	c.Assert(err, IsNil)
+	c.Assert(io.WriteHeader(fp, tbi), IsNil)
+	if rt == io.VARIABLE {
+		c.Assert(fp.Truncate(io.FileSize(tbi.GetTimeframe(), int(year), 24)), IsNil)
+	}
+	return fp
+}
+
+func (s *TestSuite) TestStats(c *C) {
+	root := c.MkDir()
+
+	// 100 minutes in 2016 and 2017
+	for _, year := range []int16{2016, 2017} {
+		fp := makeFile(c, root, "EURUSD/1Min/OHLC", year, io.FIXED)
+		start := time.Date(int(year), time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+		for i := int64(0); i < 100; i++ {
+			record, _ := io.Serialize(nil, io.EpochToIndex(start+60*i, time.Minute))
+			record, _ = io.Serialize(record, []float32{1, 0})
+			fp.WriteAt(record, io.EpochToOffset(start+60*i, time.Minute, 16))
+		}
+		fp.Close()
+	}
+
+	// 3 ticks in the 2nd minute, 2 in the 11th
+	fp := makeFile(c, root, "EURUSD/1Min/TICK", 2017, io.VARIABLE)
+	write := func(index int64, ticks ...uint32) {
+		var data []byte
+		for _, t := range ticks {
+			data, _ = io.Serialize(data, float32(1))
+			data, _ = io.Serialize(data, t)
+		}
+		data = snappy.Encode(nil, data)
+		end, _ := fp.Seek(0, os.SEEK_END)
+		fp.Write(data)
+		record, _ := io.Serialize(nil, []int64{index, end, int64(len(data))})
+		fp.WriteAt(record, io.IndexToOffset(index, 24))
+	}
+	write(2, 0, 1<<30, 1<<31)
+	write(11, 0, 1<<31)
+	fp.Close()
+
+	buckets, err := gatherStats(root, true)
+	c.Assert(err, IsNil)
+	c.Assert(buckets, HasLen, 2)
+	stats := map[string]*bucketStats{}
+	for _, b := range buckets {
+		stats[b.Key] = b
+		c.Assert(b.Disk > 0, Equals, true)
+	}
+
+	ohlc := stats["EURUSD/1Min/OHLC"]
+	c.Assert(ohlc.Rows, Equals, int64(200))
+	c.Assert(ohlc.First.UTC(), Equals, time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(ohlc.Last.UTC(), Equals, time.Date(2017, time.January, 1, 1, 39, 0, 0, time.UTC))
+
+	tick := stats["EURUSD/1Min/TICK"]
+	c.Assert(tick.Rows, Equals, int64(5))
+	c.Assert(tick.First.UTC(), Equals, time.Date(2017, time.January, 1, 0, 1, 0, 0, time.UTC))
+	c.Assert(tick.Last.UTC().Truncate(time.Millisecond), Equals, time.Date(2017, time.January, 1, 0, 10, 30, 0, time.UTC))
+}
@@ -0,0 +1,84 @@
+package trim
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "trim"
+	short   = "Delete the records before a date from the buckets matching a pattern"
+	long    = "This command deletes the records before a date from the buckets of an instance or data directory whose key matches a glob pattern, removing the year files which end before it. A dry run lists the buckets and the disk space which would be freed."
+	example = "marketstore tool trim --target localhost:5993 --before 2018-01-01 --keys \"*/1Sec/*\" --dry-run"
+
+	// Flag descriptions.
+	targetDesc = "instance at \"hostname:port\", or data directory, trimmed"
+	apiKeyDesc = "API key sent to the instance"
+	beforeDesc = "delete the records before this time, as 2006-01-02 or RFC3339"
+	keysDesc   = "glob pattern of the bucket keys, such as \"*/1Sec/*\""
+	dryRunDesc = "only list the buckets and the space which would be freed, default is false"
+)
+
+var (
+	// Available flags.
+	target, apiKey string
+	before, keys   string
+	dryRun         bool
+
+	// Cmd is the trim command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeTrim,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&target, "target", "", targetDesc)
+	Cmd.MarkFlagRequired("target")
+	Cmd.Flags().StringVar(&apiKey, "api_key", "", apiKeyDesc)
+	Cmd.Flags().StringVar(&before, "before", "", beforeDesc)
+	Cmd.MarkFlagRequired("before")
+	Cmd.Flags().StringVar(&keys, "keys", "", keysDesc)
+	Cmd.MarkFlagRequired("keys")
+	Cmd.Flags().BoolVar(&dryRun, "dry-run", false, dryRunDesc)
+}
+
+// executeTrim implements the trim tool.
+func executeTrim(cmd *cobra.Command, args []string) error {
+	epoch, err := endpoint.ParseTime(before, 0)
+	if err != nil {
+		return err
+	}
+	var response frontend.AdminResponse
+	err = endpoint.New(target, apiKey).Call("Trim",
+		&frontend.TrimArgs{Pattern: keys, Before: epoch, DryRun: dryRun}, &response)
+	if err != nil {
+		return err
+	}
+
+	freed := "freed"
+	if dryRun {
+		freed = "would be freed"
+	}
+	var total int64
+	for _, result := range response.Results {
+		if result.Error != "" {
+			fmt.Printf("%s: %s\n", result.Key, result.Error)
+			continue
+		}
+		fmt.Printf("%s: %d bytes %s\n", result.Key, result.Freed, freed)
+		total += result.Freed
+	}
+	fmt.Printf("%d buckets, %d bytes %s\n", len(response.Results)-response.Failed, total, freed)
+	if response.Failed > 0 {
+		return fmt.Errorf("%d buckets failed", response.Failed)
+	}
+	return nil
+}
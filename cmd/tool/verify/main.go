@@ -0,0 +1,233 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "verify <bucket or glob pattern>"
+	short   = "Compare the buckets of two instances or data directories"
+	long    = "This command compares the records of the buckets of a replica, an instance or a backup data directory, with those of the source instance by checksums of ranges of time, reporting the missing buckets and the ranges which differ"
+	example = "marketstore tool verify --source localhost:5993 --replica /backup/mktsdb --range 1D \"*/1Min/OHLCV\""
+
+	// Flag descriptions.
+	sourceDesc        = "source instance at \"hostname:port\", or data directory"
+	sourceAPIKeyDesc  = "API key sent to the source instance"
+	replicaDesc       = "replica instance at \"hostname:port\", or data directory"
+	replicaAPIKeyDesc = "API key sent to the replica instance"
+	startDesc         = "compare the records from this time on, as 2006-01-02 or RFC3339"
+	endDesc           = "compare the records until this time (inclusive), as 2006-01-02 or RFC3339"
+	rangeDesc         = "length of the ranges of time compared, such as 1H or 1D"
+
+	// Flag defaults.
+	defaultRange = "1D"
+)
+
+var (
+	// Available flags.
+	source, sourceAPIKey, replica, replicaAPIKey string
+	start, end, rangeLength                      string
+
+	// Cmd is the verify command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		Args:    cobra.ExactArgs(1),
+		RunE:    executeVerify,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVar(&source, "source", "", sourceDesc)
+	Cmd.MarkFlagRequired("source")
+	Cmd.Flags().StringVar(&sourceAPIKey, "source_api_key", "", sourceAPIKeyDesc)
+	Cmd.Flags().StringVar(&replica, "replica", "", replicaDesc)
+	Cmd.MarkFlagRequired("replica")
+	Cmd.Flags().StringVar(&replicaAPIKey, "replica_api_key", "", replicaAPIKeyDesc)
+	Cmd.Flags().StringVar(&start, "start", "", startDesc)
+	Cmd.Flags().StringVar(&end, "end", "", endDesc)
+	Cmd.Flags().StringVar(&rangeLength, "range", defaultRange, rangeDesc)
+}
+
+// divergence is a range of time whose records differ between the source and
+// the replica
+type divergence struct {
+	EpochStart, EpochEnd int64
+	// records of the range on each side
+	Source, Replica int
+}
+
+func (d divergence) String() string {
+	span := fmt.Sprintf("%s - %s", formatEpoch(d.EpochStart), formatEpoch(d.EpochEnd))
+	if d.Source == d.Replica {
+		return fmt.Sprintf("%s: %d records, checksums differ", span, d.Source)
+	}
+	return fmt.Sprintf("%s: %d records in the source, %d in the replica", span, d.Source, d.Replica)
+}
+
+// executeVerify implements the verify tool.
+func executeVerify(cmd *cobra.Command, args []string) error {
+	if endpoint.IsDir(source) && endpoint.IsDir(replica) {
+		return errors.New("only one of the source and the replica can be a data directory")
+	}
+	tf := utils.TimeframeFromString(rangeLength)
+	if tf == nil || tf.Duration < time.Second {
+		return fmt.Errorf("invalid range %s, must be a timeframe such as 1H or 1D", rangeLength)
+	}
+	epochStart, err := endpoint.ParseTime(start, 0)
+	if err != nil {
+		return err
+	}
+	epochEnd, err := endpoint.ParseTime(end, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	src, dst := endpoint.New(source, sourceAPIKey), endpoint.New(replica, replicaAPIKey)
+
+	srcBuckets, err := listBuckets(src, args[0])
+	if err != nil {
+		return err
+	}
+	dstBuckets, err := listBuckets(dst, args[0])
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for key := range srcBuckets {
+		keys = append(keys, key)
+	}
+	for key := range dstBuckets {
+		if _, ok := srcBuckets[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return fmt.Errorf("no bucket matching %s", args[0])
+	}
+
+	diverged := 0
+	for _, key := range keys {
+		srcMd, inSource := srcBuckets[key]
+		dstMd, inReplica := dstBuckets[key]
+		switch {
+		case !inReplica:
+			fmt.Printf("%s: missing in the replica\n", key)
+			diverged++
+			continue
+		case !inSource:
+			fmt.Printf("%s: missing in the source\n", key)
+			diverged++
+			continue
+		}
+		divergences, err := verifyBucket(src, dst, srcMd, dstMd, epochStart, epochEnd, int64(tf.Duration/time.Second))
+		if err != nil {
+			return fmt.Errorf("verification of %s failed: %v", key, err)
+		}
+		if len(divergences) == 0 {
+			fmt.Printf("%s: identical\n", key)
+			continue
+		}
+		fmt.Printf("%s: %d ranges differ\n", key, len(divergences))
+		for _, d := range divergences {
+			fmt.Printf("  %v\n", d)
+		}
+		diverged++
+	}
+	if diverged > 0 {
+		return fmt.Errorf("%d of %d buckets differ", diverged, len(keys))
+	}
+	return nil
+}
+
+// listBuckets returns the metadata of the buckets matching the pattern by key
+func listBuckets(e endpoint.Endpoint, pattern string) (map[string]frontend.BucketMetadata, error) {
+	var listing frontend.ListSymbolsResponse
+	if err := e.Call("ListSymbols", &frontend.ListSymbolsArgs{Metadata: true, Pattern: pattern}, &listing); err != nil {
+		return nil, err
+	}
+	buckets := map[string]frontend.BucketMetadata{}
+	for _, md := range listing.Buckets {
+		buckets[md.Key] = md
+	}
+	return buckets, nil
+}
+
+// verifyBucket compares the checksums of the ranges of the bucket between the
+// epochs on both sides, the ranges being aligned on multiples of the interval
+// so that they are the same whatever the records held
+func verifyBucket(src, dst endpoint.Endpoint, srcMd, dstMd frontend.BucketMetadata,
+	epochStart, epochEnd, interval int64) ([]divergence, error) {
+
+	first, last := srcMd.FirstEpoch, srcMd.LastEpoch
+	if dstMd.FirstEpoch < first {
+		first = dstMd.FirstEpoch
+	}
+	if dstMd.LastEpoch > last {
+		last = dstMd.LastEpoch
+	}
+	if first > epochStart {
+		epochStart = first
+	}
+	if last < epochEnd {
+		epochEnd = last
+	}
+	if epochEnd < epochStart {
+		return nil, nil
+	}
+	epochStart -= epochStart % interval
+
+	args := &frontend.ChecksumArgs{Key: srcMd.Key, EpochStart: epochStart, EpochEnd: epochEnd, Interval: interval}
+	var srcSums, dstSums frontend.ChecksumResponse
+	if err := src.Call("Checksum", args, &srcSums); err != nil {
+		return nil, err
+	}
+	if err := dst.Call("Checksum", args, &dstSums); err != nil {
+		return nil, err
+	}
+	return compare(srcSums.Ranges, dstSums.Ranges), nil
+}
+
+// compare returns the ranges whose checksums differ, the ranges of each side
+// being in order
+func compare(srcRanges, dstRanges []frontend.RangeChecksum) (divergences []divergence) {
+	i, j := 0, 0
+	for i < len(srcRanges) || j < len(dstRanges) {
+		switch {
+		case j == len(dstRanges) || (i < len(srcRanges) && srcRanges[i].EpochStart < dstRanges[j].EpochStart):
+			s := srcRanges[i]
+			divergences = append(divergences, divergence{EpochStart: s.EpochStart, EpochEnd: s.EpochEnd, Source: s.Records})
+			i++
+		case i == len(srcRanges) || dstRanges[j].EpochStart < srcRanges[i].EpochStart:
+			d := dstRanges[j]
+			divergences = append(divergences, divergence{EpochStart: d.EpochStart, EpochEnd: d.EpochEnd, Replica: d.Records})
+			j++
+		default:
+			s, d := srcRanges[i], dstRanges[j]
+			if s.Records != d.Records || s.Checksum != d.Checksum {
+				divergences = append(divergences, divergence{
+					EpochStart: s.EpochStart, EpochEnd: s.EpochEnd, Source: s.Records, Replica: d.Records,
+				})
+			}
+			i++
+			j++
+		}
+	}
+	return divergences
+}
+
+func formatEpoch(epoch int64) string {
+	return time.Unix(epoch, 0).In(utils.InstanceConfig.Timezone).Format(time.RFC3339)
+}
@@ -0,0 +1,99 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/alpacahq/marketstore/cmd/tool/endpoint"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct {
+	src endpoint.Endpoint
+	md  frontend.BucketMetadata
+}
+
+// alteredReplica returns the checksums of the source, altered
+type alteredReplica struct {
+	endpoint.Endpoint
+	alter func(ranges []frontend.RangeChecksum) []frontend.RangeChecksum
+}
+
+func (r *alteredReplica) Call(method string, args, reply interface{}) error {
+	if err := r.Endpoint.Call(method, args, reply); err != nil {
+		return err
+	}
+	if response, ok := reply.(*frontend.ChecksumResponse); ok {
+		response.Ranges = r.alter(response.Ranges)
+	}
+	return nil
+}
+
+func (s *TestSuite) SetUpSuite(c *C) {
+	s.src = endpoint.New(c.MkDir(), "")
+	c.Assert(endpoint.Create(s.src, "TEST/1Min/OHLCV", "Close/float32", "fixed"), IsNil)
+
+	// 3 hours of bars from 1500002400, 40 minutes past the hour
+	cs := io.NewColumnSeries()
+	var epochs []int64
+	var closes []float32
+	for i := 0; i < 180; i++ {
+		epochs = append(epochs, 1500002400+int64(i)*60)
+		closes = append(closes, float32(i))
+	}
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Close", closes)
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/OHLCV"), cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	buckets, err := listBuckets(s.src, "TEST/*/*")
+	c.Assert(err, IsNil)
+	c.Assert(buckets, HasLen, 1)
+	s.md = buckets["TEST/1Min/OHLCV"]
+}
+
+func (s *TestSuite) TestVerify(c *C) {
+	same := &alteredReplica{s.src, func(ranges []frontend.RangeChecksum) []frontend.RangeChecksum { return ranges }}
+	divergences, err := verifyBucket(s.src, same, s.md, s.md, 0, 1600000000, 3600)
+	c.Assert(err, IsNil)
+	c.Assert(divergences, HasLen, 0)
+
+	// the ranges are aligned on the hour
+	var ranges []frontend.RangeChecksum
+	record := &alteredReplica{s.src, func(r []frontend.RangeChecksum) []frontend.RangeChecksum {
+		ranges = r
+		return r
+	}}
+	_, err = verifyBucket(s.src, record, s.md, s.md, 0, 1600000000, 3600)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, HasLen, 4)
+	c.Assert(ranges[0].EpochStart, Equals, int64(1500001200))
+	c.Assert(ranges[0].Records, Equals, 40)
+	c.Assert(ranges[1].Records, Equals, 60)
+	c.Assert(ranges[3].Records, Equals, 20)
+
+	// a range missing and a range altered
+	altered := &alteredReplica{s.src, func(r []frontend.RangeChecksum) []frontend.RangeChecksum {
+		r[2].Checksum++
+		return append(r[:1], r[2:]...)
+	}}
+	divergences, err = verifyBucket(s.src, altered, s.md, s.md, 0, 1600000000, 3600)
+	c.Assert(err, IsNil)
+	c.Assert(divergences, DeepEquals, []divergence{
+		{EpochStart: 1500004800, EpochEnd: 1500008399, Source: 60},
+		{EpochStart: 1500008400, EpochEnd: 1500011999, Source: 60, Replica: 60},
+	})
+	c.Assert(divergences[1].String(), Matches, ".*: 60 records, checksums differ")
+
+	// only the ranges of the time range are compared
+	divergences, err = verifyBucket(s.src, altered, s.md, s.md, 1500000000, 1500002399, 3600)
+	c.Assert(err, IsNil)
+	c.Assert(divergences, HasLen, 0)
+}
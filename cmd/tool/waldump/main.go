@@ -0,0 +1,213 @@
+package waldump
+
+import (
+	"fmt"
+	stdio "io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/spf13/cobra"
+)
+
+const (
+	usage   = "waldump"
+	short   = "Print the transactions of a WAL file and replay them selectively"
+	long    = "This command decodes a WAL file and prints its transactions with the buckets and records they write, their commit status and whether they are checkpointed. The pending transactions, or those selected, can be replayed into the data directory, skipping some of them. The database must not be running."
+	example = "marketstore tool waldump --file <path> --replay --skip 1521659104002911231"
+
+	// Flag descriptions.
+	walFilePathDesc = "set the path to the WAL file"
+	rootDirPathDesc = "set filesystem path of the data directory, default is the directory of the WAL file"
+	replayDesc      = "replay the transactions not yet checkpointed, or those of --tgid, and mark the WAL file replayed"
+	tgidDesc        = "only print and replay these transactions"
+	skipDesc        = "do not replay these transactions"
+)
+
+var (
+	// Available flags.
+	walFilePath string
+	rootDirPath string
+	replay      bool
+	tgids       []string
+	skips       []string
+
+	// Cmd is the waldump command.
+	Cmd = &cobra.Command{
+		Use:     usage,
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE:    executeWALDump,
+	}
+)
+
+func init() {
+	// Parse flags.
+	Cmd.Flags().StringVarP(&walFilePath, "file", "f", "", walFilePathDesc)
+	Cmd.MarkFlagRequired("file")
+	Cmd.Flags().StringVarP(&rootDirPath, "dir", "d", "", rootDirPathDesc)
+	Cmd.Flags().BoolVar(&replay, "replay", false, replayDesc)
+	Cmd.Flags().StringSliceVar(&tgids, "tgid", nil, tgidDesc)
+	Cmd.Flags().StringSliceVar(&skips, "skip", nil, skipDesc)
+}
+
+// executeWALDump implements the waldump tool.
+func executeWALDump(cmd *cobra.Command, args []string) error {
+	walFilePath = filepath.Clean(walFilePath)
+	if rootDirPath == "" {
+		rootDirPath = filepath.Dir(walFilePath)
+	}
+	selected, err := parseTGIDs(tgids)
+	if err != nil {
+		return err
+	}
+	skipped, err := parseTGIDs(skips)
+	if err != nil {
+		return err
+	}
+
+	flag := os.O_RDONLY
+	if replay {
+		flag = os.O_RDWR
+		// the replay writes the WAL status as a WAL bypassing instance
+		executor.NewInstanceSetup(rootDirPath, false, false, false, true)
+	}
+	fp, err := os.OpenFile(walFilePath, flag, 0600)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	wf := &executor.WALFileType{FilePath: walFilePath, FilePtr: fp, RootPath: rootDirPath}
+
+	needsReplay := wf.NeedsReplay()
+	if needsReplay {
+		fmt.Printf("%s: not replayed\n", walFilePath)
+	} else {
+		fmt.Printf("%s: replayed\n", walFilePath)
+	}
+	txns, err := wf.Transactions()
+	if err != nil {
+		return err
+	}
+	txns = filter(txns, selected, skipped, replay)
+	dump(os.Stdout, txns)
+	if !replay {
+		return nil
+	}
+	if !needsReplay && len(selected) == 0 {
+		return fmt.Errorf("the WAL file is already replayed, select the transactions to replay again with --tgid")
+	}
+	if len(txns) == 0 {
+		fmt.Println("no transaction to replay")
+		return nil
+	}
+	if err = wf.ReplayTransactions(txns); err != nil {
+		return err
+	}
+	fmt.Printf("%d transactions replayed\n", len(txns))
+	return nil
+}
+
+// filter returns the selected transactions, all if none is, without the
+// skipped ones.  The transactions to replay are the pending ones unless
+// selected.
+func filter(txns []*executor.WALTransaction, selected, skipped map[int64]bool, replay bool) (out []*executor.WALTransaction) {
+	for _, txn := range txns {
+		if len(selected) > 0 && !selected[txn.TGID] {
+			continue
+		}
+		if replay && (skipped[txn.TGID] || len(selected) == 0 && txn.Checkpointed) {
+			continue
+		}
+		out = append(out, txn)
+	}
+	return out
+}
+
+// dump prints the transactions with the records written by year file
+func dump(w stdio.Writer, txns []*executor.WALTransaction) {
+	for _, txn := range txns {
+		state := "pending"
+		if txn.Checkpointed {
+			state = "checkpointed"
+		}
+		files := map[string][]executor.WALWrite{}
+		var records int
+		for _, write := range txn.Writes {
+			files[write.WALKeyPath] = append(files[write.WALKeyPath], write)
+			records += write.Records
+		}
+		fmt.Fprintf(w, "TGID %d: %s, %s, %d records\n", txn.TGID, statusName(txn.Status), state, records)
+
+		var keyPaths []string
+		for keyPath := range files {
+			keyPaths = append(keyPaths, keyPath)
+		}
+		sort.Strings(keyPaths)
+		for _, keyPath := range keyPaths {
+			var records int
+			first, last := files[keyPath][0].Index, files[keyPath][0].Index
+			for _, write := range files[keyPath] {
+				records += write.Records
+				if write.Index < first {
+					first = write.Index
+				}
+				if write.Index > last {
+					last = write.Index
+				}
+			}
+			recordType := "fixed"
+			if files[keyPath][0].RecordType == io.VARIABLE {
+				recordType = "variable"
+			}
+			fmt.Fprintf(w, "  %s %s: %d records, %s - %s\n", keyPath, recordType, records,
+				intervalTime(keyPath, first), intervalTime(keyPath, last))
+		}
+	}
+}
+
+func statusName(status executor.TxnStatusEnum) string {
+	switch status {
+	case executor.PREPARING:
+		return "preparing"
+	case executor.COMMITINTENDED:
+		return "commit intended"
+	case executor.COMMITCOMPLETE:
+		return "committed"
+	}
+	return fmt.Sprintf("status %d", status)
+}
+
+// intervalTime returns the start time of the interval of the year file with
+// the Symbol/Timeframe/AttributeGroup/Year.bin WAL key path
+func intervalTime(keyPath string, index int64) string {
+	parts := strings.Split(filepath.ToSlash(keyPath), "/")
+	if len(parts) != 4 {
+		return fmt.Sprintf("interval %d", index)
+	}
+	tf := utils.TimeframeFromString(parts[1])
+	year, err := strconv.Atoi(strings.TrimSuffix(parts[3], ".bin"))
+	if tf == nil || err != nil {
+		return fmt.Sprintf("interval %d", index)
+	}
+	return io.IndexToTime(index, tf.Duration, int16(year)).UTC().Format(time.RFC3339)
+}
+
+func parseTGIDs(values []string) (map[int64]bool, error) {
+	parsed := map[int64]bool{}
+	for _, value := range values {
+		tgid, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TGID %s", value)
+		}
+		parsed[tgid] = true
+	}
+	return parsed, nil
+}
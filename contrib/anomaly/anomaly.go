@@ -0,0 +1,20 @@
+// This is a shim package for buiding a plugin module wrapping
+// the importable anomalytrigger package.  For more details, see anomalytrigger.
+package main
+
+import (
+	"github.com/alpacahq/marketstore/contrib/anomaly/anomalytrigger"
+	"github.com/alpacahq/marketstore/plugins/abi"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+)
+
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
+// NewTrigger returns a new anomaly trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	return anomalytrigger.NewTrigger(conf)
+}
+
+func main() {
+}
@@ -0,0 +1,388 @@
+// Anomaly implements a trigger that evaluates data quality rules on the
+// writes to the buckets matching the trigger, and alerts on the records
+// breaking them, as a first line of defense against bad or missing data.
+//
+// Example:
+// 	triggers:
+// 	  - module: anomaly.so
+// 	    on: */1Min/OHLCV
+// 	    config:
+// 	      rules:
+// 	        - type: jump
+// 	          threshold: 5
+// 	        - type: zscore
+// 	          column: Volume
+// 	          threshold: 4
+// 	        - type: stale
+// 	          max_age: 5m
+// 	      webhooks:
+// 	        - https://example.com/hooks/alerts
+// 	      bucket: "{Symbol}/{Timeframe}/ALERTS"
+//
+// jump alerts on a change of the column from the previous record beyond the
+// threshold in percent, zscore on a value beyond threshold standard
+// deviations from the mean of the previous period records, and stale on a
+// bucket which has not been written to for max_age.  Every alert is logged,
+// POSTed to the webhooks and written to the alert bucket if configured.
+package anomalytrigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/uda"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// RuleConfig is the configuration of a single rule.
+type RuleConfig struct {
+	// One of jump, zscore and stale
+	Type string `json:"type"`
+	// Column of jump, Close if omitted, and of zscore, Volume if omitted
+	Column string `json:"column"`
+	// Percent of jump, 10 if omitted, and standard deviations of zscore, 3
+	// if omitted
+	Threshold float64 `json:"threshold"`
+	// Previous records of zscore, 20 if omitted
+	Period int `json:"period"`
+	// Time without writes of stale, e.g. 5m
+	MaxAge string `json:"max_age"`
+}
+
+// AnomalyTriggerConfig is the configuration for AnomalyTrigger you can
+// define in marketstore's config file under triggers extension.
+type AnomalyTriggerConfig struct {
+	Rules []RuleConfig `json:"rules"`
+	// URLs the alerts are POSTed to
+	Webhooks []string `json:"webhooks"`
+	// Bucket the alerts are written to, with {<Category>} replaced by the
+	// item of the bucket of the alert in that category
+	Bucket string `json:"bucket"`
+}
+
+// Alert is a record breaking a rule, or a stale bucket.
+type Alert struct {
+	Rule   string `json:"rule"`
+	Bucket string `json:"bucket"`
+	// Epoch of the record, or of the last write for stale
+	Epoch int64 `json:"epoch"`
+	// Change in percent for jump, z-score for zscore and seconds since the
+	// last write for stale
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+
+	code int16
+	tbk  *io.TimeBucketKey
+}
+
+// AnomalyTrigger is the main trigger.
+type AnomalyTrigger struct {
+	config   map[string]interface{}
+	rules    []*rule
+	stale    []*rule
+	webhooks []string
+	bucket   string
+	// records read before those written
+	lookback int
+	client   *http.Client
+
+	sync.Mutex
+	// last write of each bucket, and if it was alerted on as stale
+	lastWrites map[io.TimeBucketKey]*lastWrite
+}
+
+type lastWrite struct {
+	at      time.Time
+	alerted bool
+}
+
+var (
+	_         trigger.Trigger = &AnomalyTrigger{}
+	loadError                 = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *AnomalyTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := AnomalyTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new anomaly trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	if len(config.Rules) == 0 {
+		log.Warn("no rules are configured\n")
+		return nil, loadError
+	}
+
+	t := &AnomalyTrigger{
+		config:     conf,
+		webhooks:   config.Webhooks,
+		bucket:     config.Bucket,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		lastWrites: map[io.TimeBucketKey]*lastWrite{},
+	}
+	for _, rc := range config.Rules {
+		r, err := newRule(&rc)
+		if err != nil {
+			log.Error("invalid rule (%v)\n", err)
+			return nil, loadError
+		}
+		if r.code == StaleRule {
+			t.stale = append(t.stale, r)
+			continue
+		}
+		if r.lookback() > t.lookback {
+			t.lookback = r.lookback()
+		}
+		t.rules = append(t.rules, r)
+	}
+	for _, url := range config.Webhooks {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			log.Error("invalid webhook url: %s\n", url)
+			return nil, loadError
+		}
+	}
+
+	log.Info("%d rule(s) configured\n", len(config.Rules))
+
+	if len(t.stale) > 0 {
+		go t.watch()
+	}
+	return t, nil
+}
+
+// Fire implements trigger interface.
+func (s *AnomalyTrigger) Fire(keyPath string, records []trigger.Record) {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	if len(s.stale) > 0 {
+		s.Lock()
+		s.lastWrites[*tbk] = &lastWrite{at: time.Now()}
+		s.Unlock()
+	}
+	if len(s.rules) == 0 {
+		return
+	}
+
+	cs, err := read(tbk, tail.Add(tf.Duration-time.Second), s.lookback+len(records))
+	if err != nil {
+		log.Error("failed to read %v (%v)\n", tbk.String(), err)
+		return
+	}
+	if cs == nil || cs.Len() == 0 {
+		return
+	}
+	s.emit(s.evaluate(tbk, cs, head))
+}
+
+// evaluate returns the alerts of the records of the column series from head
+func (s *AnomalyTrigger) evaluate(tbk *io.TimeBucketKey, cs *io.ColumnSeries, head time.Time) (alerts []*Alert) {
+	epoch := cs.GetEpoch()
+	first := 0
+	for first < len(epoch) && epoch[first] < head.Unix() {
+		first++
+	}
+	for _, r := range s.rules {
+		if !cs.Exists(r.column) {
+			log.Error("no %s column in %v\n", r.column, tbk.String())
+			continue
+		}
+		values, err := uda.ColumnToFloat64(cs, r.column)
+		if err != nil {
+			log.Error("failed to read %s of %v (%v)\n", r.column, tbk.String(), err)
+			continue
+		}
+		indexes, measures := r.evaluate(values, first)
+		for k, j := range indexes {
+			alerts = append(alerts, &Alert{
+				Rule:      ruleNames[r.code],
+				Bucket:    tbk.GetItemKey(),
+				Epoch:     epoch[j],
+				Value:     measures[k],
+				Threshold: r.threshold,
+				code:      r.code,
+				tbk:       tbk,
+			})
+		}
+	}
+	return alerts
+}
+
+// watch alerts on the stale buckets
+func (s *AnomalyTrigger) watch() {
+	interval := s.stale[0].maxAge
+	for _, r := range s.stale[1:] {
+		if r.maxAge < interval {
+			interval = r.maxAge
+		}
+	}
+	ticker := time.NewTicker(interval / 2)
+	for now := range ticker.C {
+		s.emit(s.checkStale(now))
+	}
+}
+
+// checkStale returns the alerts of the buckets not written to for the max
+// age of a stale rule, each bucket being alerted on once until written to
+func (s *AnomalyTrigger) checkStale(now time.Time) (alerts []*Alert) {
+	s.Lock()
+	defer s.Unlock()
+	for key, lw := range s.lastWrites {
+		if lw.alerted {
+			continue
+		}
+		age := now.Sub(lw.at)
+		for _, r := range s.stale {
+			if age < r.maxAge {
+				continue
+			}
+			tbk := key
+			alerts = append(alerts, &Alert{
+				Rule:      ruleNames[r.code],
+				Bucket:    tbk.GetItemKey(),
+				Epoch:     lw.at.Unix(),
+				Value:     age.Seconds(),
+				Threshold: r.maxAge.Seconds(),
+				code:      r.code,
+				tbk:       &tbk,
+			})
+			lw.alerted = true
+			break
+		}
+	}
+	return alerts
+}
+
+// emit logs the alerts, and sends them to the webhooks and the alert bucket
+func (s *AnomalyTrigger) emit(alerts []*Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	for _, a := range alerts {
+		log.Warn("%s alert on %v at %v: %g (threshold %g)\n",
+			a.Rule, a.Bucket, time.Unix(a.Epoch, 0).UTC(), a.Value, a.Threshold)
+	}
+	if s.bucket != "" {
+		if err := s.write(alerts); err != nil {
+			log.Error("failed to write alerts (%v)\n", err)
+		}
+	}
+	if len(s.webhooks) > 0 {
+		go s.notify(alerts)
+	}
+}
+
+// write appends the alerts to the alert buckets
+func (s *AnomalyTrigger) write(alerts []*Alert) error {
+	type columns struct {
+		epoch     []int64
+		rule      []int16
+		value     []float64
+		threshold []float64
+	}
+	byKey := map[io.TimeBucketKey]*columns{}
+	var keys []io.TimeBucketKey
+	for _, a := range alerts {
+		key := *io.NewTimeBucketKey(expand(s.bucket, a.tbk))
+		cols := byKey[key]
+		if cols == nil {
+			cols = &columns{}
+			byKey[key] = cols
+			keys = append(keys, key)
+		}
+		cols.epoch = append(cols.epoch, a.Epoch)
+		cols.rule = append(cols.rule, a.code)
+		cols.value = append(cols.value, a.Value)
+		cols.threshold = append(cols.threshold, a.Threshold)
+	}
+	csm := io.NewColumnSeriesMap()
+	for _, key := range keys {
+		cols := byKey[key]
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", cols.epoch)
+		cs.AddColumn("Rule", cols.rule)
+		cs.AddColumn("Value", cols.value)
+		cs.AddColumn("Threshold", cols.threshold)
+		csm.AddColumnSeries(key, cs)
+	}
+	return executor.WriteCSM(csm, true)
+}
+
+// notify POSTs the alerts to the webhooks, as a JSON array
+func (s *AnomalyTrigger) notify(alerts []*Alert) {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		log.Error("failed to encode alerts (%v)\n", err)
+		return
+	}
+	for _, url := range s.webhooks {
+		resp, err := s.client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Error("failed to send alerts to %v (%v)\n", url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Error("failed to send alerts to %v (%v)\n", url, resp.Status)
+		}
+	}
+}
+
+// read returns the last rows of the bucket until end
+func read(tbk *io.TimeBucketKey, end time.Time, rows int) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	q.SetEnd(end.Unix())
+	q.SetRowLimit(io.LAST, rows)
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	return csm[*tbk], nil
+}
+
+// expand replaces {<Category>} with the item of the key in that category.
+func expand(template string, tbk *io.TimeBucketKey) string {
+	out := template
+	for _, category := range tbk.GetCategories() {
+		out = strings.Replace(out, "{"+category+"}", tbk.GetItemInCategory(category), -1)
+	}
+	return out
+}
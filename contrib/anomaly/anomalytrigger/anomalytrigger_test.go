@@ -0,0 +1,179 @@
+package anomalytrigger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	ret, err := NewTrigger(getConfig(`{
+        "rules": [
+            {"type": "jump"},
+            {"type": "zscore", "period": 50},
+            {"type": "stale", "max_age": "5m"}
+        ]
+        }`))
+	c.Assert(err, IsNil)
+	trig := ret.(*AnomalyTrigger)
+	c.Assert(trig.rules, HasLen, 2)
+	c.Assert(*trig.rules[0], DeepEquals, rule{code: JumpRule, column: "Close", threshold: 10})
+	c.Assert(*trig.rules[1], DeepEquals, rule{code: ZScoreRule, column: "Volume", threshold: 3, period: 50})
+	c.Assert(trig.stale, HasLen, 1)
+	c.Assert(trig.stale[0].maxAge, Equals, 5*time.Minute)
+	c.Assert(trig.lookback, Equals, 50)
+
+	for _, config := range []string{
+		`{}`,
+		`{"rules": [{"type": "spread"}]}`,
+		`{"rules": [{"type": "jump", "threshold": -1}]}`,
+		`{"rules": [{"type": "zscore", "period": 1}]}`,
+		`{"rules": [{"type": "stale"}]}`,
+		`{"rules": [{"type": "stale", "max_age": "5 minutes"}]}`,
+		`{"rules": [{"type": "jump"}], "webhooks": ["example.com"]}`,
+	} {
+		ret, err = NewTrigger(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestRules(c *C) {
+	jump := &rule{code: JumpRule, threshold: 10}
+	indexes, measures := jump.evaluate([]float64{100, 105, 120, 0, 10, 8}, 0)
+	// no change from 0
+	c.Assert(indexes, DeepEquals, []int{2, 3, 5})
+	c.Assert(measures[1], Equals, -100.)
+	c.Assert(measures[2], Equals, -20.)
+
+	// only the values from first are evaluated
+	indexes, _ = jump.evaluate([]float64{100, 105, 120, 0, 10, 8}, 4)
+	c.Assert(indexes, DeepEquals, []int{5})
+
+	zscore := &rule{code: ZScoreRule, threshold: 3, period: 4}
+	indexes, measures = zscore.evaluate([]float64{10, 12, 10, 12, 20, 11}, 0)
+	c.Assert(indexes, DeepEquals, []int{4})
+	c.Assert(measures, DeepEquals, []float64{9.})
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	trig, err := NewTrigger(getConfig(`{
+        "rules": [{"type": "jump", "threshold": 5}],
+        "webhooks": ["` + server.URL + `"],
+        "bucket": "{Symbol}/{Timeframe}/ALERTS"
+        }`))
+	c.Assert(err, IsNil)
+
+	var epoch []int64
+	for i := 0; i < 4; i++ {
+		epoch = append(epoch, time.Date(2017, 12, 14, 10, i, 0, 0, time.UTC).Unix())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Close", []float32{100., 110., 111., 100.})
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLCV")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	// fire with the last two records only, the jump to 110 was alerted on
+	// by a previous write
+	rs := cs.ToRowSeries(*tbk, true)
+	rowData := rs.GetData()
+	times := rs.GetTime()
+	rowLen := len(rowData) / len(times)
+	records := make([]trigger.Record, 0, 2)
+	for i := 2; i < len(times); i++ {
+		record := rowData[i*rowLen : (i+1)*rowLen]
+		buf, _ := io.Serialize(nil, io.TimeToIndex(times[i], time.Minute))
+		records = append(records, trigger.Record(append(buf, record[8:]...)))
+	}
+	trig.Fire("TEST/1Min/OHLCV/2017.bin", records)
+
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the webhook was not notified")
+	}
+	var alerts []Alert
+	c.Assert(json.Unmarshal(body, &alerts), IsNil)
+	c.Assert(alerts, HasLen, 1)
+	c.Assert(alerts[0].Rule, Equals, "jump")
+	c.Assert(alerts[0].Bucket, Equals, "TEST/1Min/OHLCV")
+	c.Assert(alerts[0].Epoch, Equals, epoch[3])
+	c.Assert(alerts[0].Threshold, Equals, 5.)
+
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	alertKey := io.NewTimeBucketKey("TEST/1Min/ALERTS")
+	q.AddTargetKey(alertKey)
+	q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+	parsed, err := q.Parse()
+	c.Assert(err, IsNil)
+	scanner, err := executor.NewReader(parsed)
+	c.Assert(err, IsNil)
+	csm, err = scanner.Read()
+	c.Assert(err, IsNil)
+	alertCs := csm[*alertKey]
+	c.Assert(alertCs, NotNil)
+	c.Assert(alertCs.GetEpoch(), DeepEquals, []int64{epoch[3]})
+	c.Assert(alertCs.GetByName("Rule"), DeepEquals, []int16{JumpRule})
+}
+
+func (t *TestSuite) TestStale(c *C) {
+	ret, err := NewTrigger(getConfig(`{"rules": [{"type": "stale", "max_age": "1h"}]}`))
+	c.Assert(err, IsNil)
+	trig := ret.(*AnomalyTrigger)
+
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLCV")
+	written := time.Now()
+	trig.lastWrites[*tbk] = &lastWrite{at: written}
+
+	c.Assert(trig.checkStale(written.Add(time.Minute)), HasLen, 0)
+	alerts := trig.checkStale(written.Add(2 * time.Hour))
+	c.Assert(alerts, HasLen, 1)
+	c.Assert(alerts[0].Rule, Equals, "stale")
+	c.Assert(alerts[0].Bucket, Equals, "TEST/1Min/OHLCV")
+	c.Assert(alerts[0].Value, Equals, (2 * time.Hour).Seconds())
+
+	// alerted on once until written to again
+	c.Assert(trig.checkStale(written.Add(3*time.Hour)), HasLen, 0)
+}
@@ -0,0 +1,135 @@
+package anomalytrigger
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Rule codes of the Rule column of the alert buckets
+const (
+	JumpRule   int16 = 1
+	ZScoreRule int16 = 2
+	StaleRule  int16 = 3
+)
+
+var ruleNames = map[int16]string{
+	JumpRule:   "jump",
+	ZScoreRule: "zscore",
+	StaleRule:  "stale",
+}
+
+// rule evaluates the records of a write, the records before it being read
+// back for the rules comparing the records with the previous ones
+type rule struct {
+	code   int16
+	column string
+	// percent for jump, standard deviations for zscore
+	threshold float64
+	// previous records of zscore
+	period int
+	// time without writes of stale
+	maxAge time.Duration
+}
+
+// newRule returns the rule of the configuration, applying the defaults of
+// its parameters
+func newRule(rc *RuleConfig) (*rule, error) {
+	r := &rule{column: rc.Column, threshold: rc.Threshold, period: rc.Period}
+	switch strings.ToLower(rc.Type) {
+	case "jump":
+		r.code = JumpRule
+		if r.column == "" {
+			r.column = "Close"
+		}
+		if r.threshold == 0 {
+			r.threshold = 10
+		}
+	case "zscore":
+		r.code = ZScoreRule
+		if r.column == "" {
+			r.column = "Volume"
+		}
+		if r.threshold == 0 {
+			r.threshold = 3
+		}
+		if r.period == 0 {
+			r.period = 20
+		}
+		if r.period < 2 {
+			return nil, fmt.Errorf("invalid period %d", r.period)
+		}
+	case "stale":
+		r.code = StaleRule
+		if rc.MaxAge == "" {
+			return nil, fmt.Errorf("stale requires a max_age")
+		}
+		maxAge, err := time.ParseDuration(rc.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("invalid max_age %s", rc.MaxAge)
+		}
+		r.maxAge = maxAge
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown rule type \"%s\"", rc.Type)
+	}
+	if r.threshold < 0 {
+		return nil, fmt.Errorf("invalid threshold %g", r.threshold)
+	}
+	return r, nil
+}
+
+// lookback returns the number of records before the first of a write which
+// the rule compares it with
+func (r *rule) lookback() int {
+	switch r.code {
+	case JumpRule:
+		return 1
+	case ZScoreRule:
+		return r.period
+	}
+	return 0
+}
+
+// evaluate returns the indexes of the values from first on breaking the rule,
+// and the values compared with the threshold
+func (r *rule) evaluate(values []float64, first int) (indexes []int, measures []float64) {
+	for j := first; j < len(values); j++ {
+		if j < r.lookback() {
+			continue
+		}
+		var measure float64
+		switch r.code {
+		case JumpRule:
+			prev := values[j-1]
+			if prev == 0 {
+				continue
+			}
+			measure = (values[j] - prev) * 100 / prev
+		case ZScoreRule:
+			mean, std := meanStd(values[j-r.period : j])
+			if std == 0 {
+				continue
+			}
+			measure = (values[j] - mean) / std
+		}
+		if math.Abs(measure) > r.threshold {
+			indexes = append(indexes, j)
+			measures = append(measures, measure)
+		}
+	}
+	return indexes, measures
+}
+
+// meanStd returns the mean and the population standard deviation
+func meanStd(values []float64) (mean, std float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(values)))
+}
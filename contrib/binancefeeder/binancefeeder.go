@@ -13,12 +13,16 @@ import (
 	binance "github.com/adshao/go-binance"
 	"github.com/alpacahq/marketstore/executor"
 	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 var suffixBinanceDefs = map[string]string{
 	"Min": "m",
 	"H":   "h",
@@ -9,12 +9,16 @@ import (
 	bitmex "github.com/alpacahq/marketstore/contrib/bitmexfeeder/api"
 	"github.com/alpacahq/marketstore/executor"
 	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 // FetcherConfig is the configuration for BitmexFetcher you can define in
 // marketstore's config file through bgworker extension.
 type FetcherConfig struct {
@@ -0,0 +1,36 @@
+// Package builtin compiles the contrib triggers and background workers into
+// the server, which selects them by name in the module of their
+// configuration, such as ondiskagg in place of ondiskagg.so.  The server is
+// then usable without loading plugin modules, which the static, cross
+// compiled and cgo-less builds cannot do.
+package builtin
+
+import (
+	"github.com/alpacahq/marketstore/contrib/anomaly/anomalytrigger"
+	"github.com/alpacahq/marketstore/contrib/continuousquery/cqtrigger"
+	"github.com/alpacahq/marketstore/contrib/indicator/indicatortrigger"
+	"github.com/alpacahq/marketstore/contrib/midpoint/midpointtrigger"
+	"github.com/alpacahq/marketstore/contrib/nats/natstrigger"
+	"github.com/alpacahq/marketstore/contrib/ondiskagg/aggtrigger"
+	"github.com/alpacahq/marketstore/contrib/polygon/polygonfetcher"
+	"github.com/alpacahq/marketstore/contrib/redis/redistrigger"
+	"github.com/alpacahq/marketstore/contrib/stream/streamtrigger"
+	"github.com/alpacahq/marketstore/contrib/tradebar/tradebartrigger"
+	"github.com/alpacahq/marketstore/contrib/webhook/webhooktrigger"
+	"github.com/alpacahq/marketstore/plugins"
+)
+
+func init() {
+	plugins.RegisterTrigger("anomaly", anomalytrigger.NewTrigger)
+	plugins.RegisterTrigger("continuousquery", cqtrigger.NewTrigger)
+	plugins.RegisterTrigger("indicator", indicatortrigger.NewTrigger)
+	plugins.RegisterTrigger("midpoint", midpointtrigger.NewTrigger)
+	plugins.RegisterTrigger("nats", natstrigger.NewTrigger)
+	plugins.RegisterTrigger("ondiskagg", aggtrigger.NewTrigger)
+	plugins.RegisterTrigger("redis", redistrigger.NewTrigger)
+	plugins.RegisterTrigger("stream", streamtrigger.NewTrigger)
+	plugins.RegisterTrigger("tradebar", tradebartrigger.NewTrigger)
+	plugins.RegisterTrigger("webhook", webhooktrigger.NewTrigger)
+
+	plugins.RegisterBgWorker("polygon", polygonfetcher.NewBgWorker)
+}
@@ -1,16 +1,22 @@
-// Package calendar provides market calendar, with which you can
-// check if the market is open at specific point of time.
-// Though the package is generalized to support different market
-// calendars, only the NASDAQ is implemented at this moment.
-// You can create your own calendar if you provide the calendar
-// json string.  See nasdaq.go for the format.
+// Package calendar provides market calendars, with which you can check if
+// the market is open at a specific point of time, and get its sessions,
+// holidays and early closes.  The NASDAQ, NYSE, CME, JPX and 24/7 crypto
+// calendars are built in, see Load for their names.  You can create your
+// own calendar from a JSON or YAML document, see nasdaq.go for the format.
 package calendar
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"gopkg.in/yaml.v2"
 )
 
 type MarketState int
@@ -24,25 +30,46 @@ type Time struct {
 	hour, minute, second int
 }
 
+// seconds returns the seconds of the time since midnight
+func (t Time) seconds() int {
+	return t.hour*3600 + t.minute*60 + t.second
+}
+
+// on returns the time of the day in the location, midnight of the next day
+// for 24:00:00
+func (t Time) on(day time.Time, loc *time.Location) time.Time {
+	yy, mm, dd := day.Date()
+	return time.Date(yy, mm, dd, t.hour, t.minute, t.second, 0, loc)
+}
+
 type Calendar struct {
+	name           string
 	days           map[int]MarketState
+	weekdays       [7]bool
 	tz             *time.Location
 	openTime       Time
 	closeTime      Time
 	earlyCloseTime Time
+	// the midday break of the sessions, if hasBreak
+	breakStart, breakEnd Time
+	hasBreak             bool
 }
 
 type calendarJson struct {
-	NonTradingDays []string `json:"non_trading_days"`
-	EarlyCloses    []string `json:"early_closes"`
-	Timezone       string   `json:"timezone"`
-	OpenTime       string   `json:"open_time"`
-	CloseTime      string   `json:"close_time"`
-	EarlyCloseTime string   `json:"early_close_time"`
+	Name           string   `json:"name" yaml:"name"`
+	NonTradingDays []string `json:"non_trading_days" yaml:"non_trading_days"`
+	EarlyCloses    []string `json:"early_closes" yaml:"early_closes"`
+	Timezone       string   `json:"timezone" yaml:"timezone"`
+	OpenTime       string   `json:"open_time" yaml:"open_time"`
+	CloseTime      string   `json:"close_time" yaml:"close_time"`
+	EarlyCloseTime string   `json:"early_close_time" yaml:"early_close_time"`
+	BreakStart     string   `json:"break_start" yaml:"break_start"`
+	BreakEnd       string   `json:"break_end" yaml:"break_end"`
+	Weekdays       []string `json:"weekdays" yaml:"weekdays"`
 }
 
 // Nasdaq implements market calendar for the NASDAQ.
-var Nasdaq = New(NasdaqJson)
+var Nasdaq = builtin("nasdaq", NasdaqJson)
 
 func jd(t time.Time) int {
 	// Note: Date() is faster than calling Hour(), Month(), and Day() separately
@@ -62,6 +89,33 @@ func ParseTime(tstr string) Time {
 	return Time{h, m, s}
 }
 
+// parseTime parses a time of the day as HH:MM or HH:MM:SS, up to 24:00:00
+// for the sessions closing at midnight
+func parseTime(tstr string) (Time, error) {
+	seps := strings.Split(tstr, ":")
+	if len(seps) == 2 {
+		seps = append(seps, "0")
+	}
+	if len(seps) != 3 {
+		return Time{}, fmt.Errorf("invalid time of the day \"%s\"", tstr)
+	}
+	var values [3]int
+	for i, sep := range seps {
+		v, err := strconv.Atoi(sep)
+		if err != nil || v < 0 || v > 59 {
+			return Time{}, fmt.Errorf("invalid time of the day \"%s\"", tstr)
+		}
+		values[i] = v
+	}
+	t := Time{values[0], values[1], values[2]}
+	if t.hour > 24 || t.hour == 24 && t.seconds() != 24*3600 {
+		return Time{}, fmt.Errorf("invalid time of the day \"%s\"", tstr)
+	}
+	return t, nil
+}
+
+// New returns the calendar of the JSON document, see Parse for one
+// returning its errors
 func New(calendarJSON string) *Calendar {
 	cal := Calendar{days: map[int]MarketState{}}
 	cmap := calendarJson{}
@@ -74,16 +128,192 @@ func New(calendarJSON string) *Calendar {
 		t, _ := time.Parse("2006-01-02", dateString)
 		cal.days[jd(t)] = EarlyClose
 	}
+	cal.name = cmap.Name
 	cal.tz, _ = time.LoadLocation(cmap.Timezone)
 	cal.openTime = ParseTime(cmap.OpenTime)
 	cal.closeTime = ParseTime(cmap.CloseTime)
 	cal.earlyCloseTime = ParseTime(cmap.EarlyCloseTime)
+	for wd := time.Monday; wd <= time.Friday; wd++ {
+		cal.weekdays[wd] = true
+	}
 	return &cal
 }
 
+// Parse returns the calendar of the JSON or YAML document.  Its sessions
+// are from open_time to close_time, or to early_close_time on the
+// early_closes days, in its timezone, on the weekdays, Monday to Friday if
+// not set, except for the non_trading_days.  An open_time later than the
+// close_time opens the session on the day before, such as 17:00 for the
+// futures trading overnight, and a close_time of 24:00 closes it at
+// midnight.  The sessions pause between break_start and break_end if set.
+func Parse(data []byte) (*Calendar, error) {
+	cmap := calendarJson{}
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(data, &cmap)
+	} else {
+		err = yaml.Unmarshal(data, &cmap)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar: %v", err)
+	}
+	cal := Calendar{name: cmap.Name, days: map[int]MarketState{}}
+	for state, dates := range map[MarketState][]string{Closed: cmap.NonTradingDays, EarlyClose: cmap.EarlyCloses} {
+		for _, dateString := range dates {
+			t, err := time.Parse("2006-01-02", dateString)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date \"%s\" of the calendar", dateString)
+			}
+			if prev, ok := cal.days[jd(t)]; ok && prev != state {
+				return nil, fmt.Errorf("%s is both a non trading day and an early close", dateString)
+			}
+			cal.days[jd(t)] = state
+		}
+	}
+	if cmap.Timezone == "" {
+		return nil, fmt.Errorf("calendar without a timezone")
+	}
+	if cal.tz, err = time.LoadLocation(cmap.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone of the calendar: %v", err)
+	}
+	if cmap.OpenTime == "" || cmap.CloseTime == "" {
+		return nil, fmt.Errorf("calendar without an open_time and a close_time")
+	}
+	if cal.openTime, err = parseTime(cmap.OpenTime); err != nil {
+		return nil, err
+	}
+	if cal.closeTime, err = parseTime(cmap.CloseTime); err != nil {
+		return nil, err
+	}
+	if cal.openTime == cal.closeTime {
+		return nil, fmt.Errorf("calendar opening and closing at %s", cmap.OpenTime)
+	}
+	cal.earlyCloseTime = cal.closeTime
+	if cmap.EarlyCloseTime != "" {
+		if cal.earlyCloseTime, err = parseTime(cmap.EarlyCloseTime); err != nil {
+			return nil, err
+		}
+	} else if len(cmap.EarlyCloses) > 0 {
+		return nil, fmt.Errorf("calendar with early_closes without an early_close_time")
+	}
+	if cmap.BreakStart != "" || cmap.BreakEnd != "" {
+		if cal.breakStart, err = parseTime(cmap.BreakStart); err != nil {
+			return nil, err
+		}
+		if cal.breakEnd, err = parseTime(cmap.BreakEnd); err != nil {
+			return nil, err
+		}
+		if cal.breakStart.seconds() >= cal.breakEnd.seconds() ||
+			cal.breakEnd.seconds() >= cal.closeTime.seconds() ||
+			!cal.overnight() && cal.breakStart.seconds() <= cal.openTime.seconds() {
+			return nil, fmt.Errorf("break from %s to %s is not within the sessions", cmap.BreakStart, cmap.BreakEnd)
+		}
+		cal.hasBreak = true
+	}
+	if len(cmap.Weekdays) == 0 {
+		cmap.Weekdays = []string{"Mon", "Tue", "Wed", "Thu", "Fri"}
+	}
+	for _, name := range cmap.Weekdays {
+		wd, err := parseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		cal.weekdays[wd] = true
+	}
+	return &cal, nil
+}
+
+// parseWeekday parses the name of a weekday, or its first three letters
+func parseWeekday(name string) (time.Weekday, error) {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		if strings.EqualFold(name, wd.String()) || strings.EqualFold(name, wd.String()[:3]) {
+			return wd, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday \"%s\" of the calendar", name)
+}
+
+// builtin returns the calendar of the document built in the package
+func builtin(name, data string) *Calendar {
+	cal, err := Parse([]byte(data))
+	if err != nil {
+		panic(fmt.Sprintf("calendar %s: %v", name, err))
+	}
+	cal.name = name
+	return cal
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Calendar{
+		"nasdaq": Nasdaq,
+		"nyse":   NYSE,
+		"cme":    CME,
+		"jpx":    JPX,
+		"crypto": Crypto,
+	}
+)
+
+// Register makes the calendar available to Load by its name, replacing the
+// calendar registered with the name if any, or removes it if cal is nil
+func Register(name string, cal *Calendar) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if cal == nil {
+		delete(registry, strings.ToLower(name))
+		return
+	}
+	registry[strings.ToLower(name)] = cal
+}
+
+// Names returns the sorted names of the registered calendars
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load returns the calendar registered with the name, case insensitive,
+// which is one of nasdaq, nyse, cme, jpx and crypto unless others are
+// registered, or else the calendar of the JSON or YAML file at the path
+func Load(nameOrPath string) (*Calendar, error) {
+	registryMu.RLock()
+	cal := registry[strings.ToLower(nameOrPath)]
+	registryMu.RUnlock()
+	if cal != nil {
+		return cal, nil
+	}
+	data, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar %s (%v)", nameOrPath, err)
+	}
+	if cal, err = Parse(data); err != nil {
+		return nil, fmt.Errorf("failed to load calendar %s (%v)", nameOrPath, err)
+	}
+	if cal.name == "" {
+		cal.name = nameOrPath
+	}
+	return cal, nil
+}
+
+// Name returns the name of the calendar
+func (calendar *Calendar) Name() string {
+	return calendar.name
+}
+
+// overnight returns true if the sessions open on the day before their day
+func (calendar *Calendar) overnight() bool {
+	return calendar.openTime.seconds() > calendar.closeTime.seconds()
+}
+
 // IsMarketDay check if today is a trading day or not.
 func (calendar *Calendar) IsMarketDay(t time.Time) bool {
-	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+	if !calendar.weekdays[t.Weekday()] {
 		return false
 	}
 	if state, ok := calendar.days[jd(t)]; ok {
@@ -100,36 +330,7 @@ func (calendar *Calendar) EpochIsMarketOpen(epoch int64) bool {
 
 // IsMarketOpen returns true if t is in the market hours
 func (calendar *Calendar) IsMarketOpen(t time.Time) bool {
-	wd := t.Weekday()
-	if wd == time.Saturday || wd == time.Sunday {
-		return false
-	}
-
-	year, month, day := t.Date()
-	ot := calendar.openTime
-	open := time.Date(year, month, day, ot.hour, ot.minute, ot.second, 0, calendar.tz)
-	if state, ok := calendar.days[jd(t)]; ok {
-		switch state {
-		case EarlyClose:
-			et := calendar.earlyCloseTime
-			close := time.Date(year, month, day, et.hour, et.minute, et.second, 0, calendar.tz)
-			if t.Before(open) || t.Equal(close) || t.After(close) {
-				return false
-			}
-			return true
-		case Closed:
-			fallthrough
-		default:
-			return false
-		}
-	} else {
-		ct := calendar.closeTime
-		close := time.Date(year, month, day, ct.hour, ct.minute, ct.second, 0, calendar.tz)
-		if t.Before(open) || t.Equal(close) || t.After(close) {
-			return false
-		}
-		return true
-	}
+	return calendar.SessionOf(t) != nil
 }
 
 // EpochMarketClose determines the market close time of the day that
@@ -141,33 +342,14 @@ func (calendar *Calendar) EpochMarketClose(epoch int64) *time.Time {
 }
 
 // MarketClose determines the market close time of the day that the
-// supplied timestamp occurs on. Returns nil if it is not a market day.
+// supplied timestamp occurs on in the timezone of the calendar. Returns
+// nil if it is not a market day.
 func (calendar *Calendar) MarketClose(t time.Time) (mktClose *time.Time) {
-	if state, ok := calendar.days[jd(t)]; ok {
-		switch state {
-		case EarlyClose:
-			earlyClose := time.Date(
-				t.Year(), t.Month(), t.Day(),
-				calendar.earlyCloseTime.hour,
-				calendar.earlyCloseTime.minute,
-				calendar.earlyCloseTime.second,
-				0, calendar.tz)
-
-			mktClose = &earlyClose
-		case Closed:
-			return
-		default:
-			normalClose := time.Date(
-				t.Year(), t.Month(), t.Day(),
-				calendar.closeTime.hour,
-				calendar.closeTime.minute,
-				calendar.closeTime.second,
-				0, calendar.tz)
-
-			mktClose = &normalClose
-		}
+	session := calendar.Session(t.In(calendar.tz))
+	if session == nil {
+		return nil
 	}
-	return nil
+	return &session.Close
 }
 
 func (calendar *Calendar) Tz() *time.Location {
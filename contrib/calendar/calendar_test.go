@@ -1,6 +1,8 @@
 package calendar
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -51,3 +53,89 @@ func (s *CalendarTestSuite) TestCalendar(c *C) {
 
 	c.Assert(Nasdaq.Tz().String(), Equals, "America/New_York")
 }
+
+func (s *CalendarTestSuite) TestMarketClose(c *C) {
+	// normal day
+	close := Nasdaq.MarketClose(time.Date(2021, 8, 31, 11, 0, 0, 0, NY))
+	c.Assert(close, NotNil)
+	c.Assert(close.Equal(time.Date(2021, 8, 31, 16, 0, 0, 0, NY)), Equals, true)
+
+	// early close, in the timezone of the calendar
+	close = Nasdaq.MarketClose(time.Date(2018, 7, 3, 15, 0, 0, 0, time.UTC))
+	c.Assert(close.Equal(time.Date(2018, 7, 3, 13, 0, 0, 0, NY)), Equals, true)
+
+	// holiday
+	c.Assert(Nasdaq.MarketClose(time.Date(2018, 1, 15, 11, 0, 0, 0, NY)), IsNil)
+}
+
+func (s *CalendarTestSuite) TestSessions(c *C) {
+	// the CME opens on the day before, Sunday for Monday
+	chicago := CME.Tz()
+	sessions := CME.Sessions(time.Date(2021, 8, 27, 0, 0, 0, 0, chicago), time.Date(2021, 8, 31, 0, 0, 0, 0, chicago))
+	c.Assert(sessions, HasLen, 3)
+	c.Assert(sessions[1].Open.Equal(time.Date(2021, 8, 29, 17, 0, 0, 0, chicago)), Equals, true)
+	c.Assert(sessions[1].Close.Equal(time.Date(2021, 8, 30, 16, 0, 0, 0, chicago)), Equals, true)
+	c.Assert(CME.IsMarketOpen(time.Date(2021, 8, 29, 18, 0, 0, 0, chicago)), Equals, true)
+	c.Assert(CME.IsMarketOpen(time.Date(2021, 8, 30, 16, 30, 0, 0, chicago)), Equals, false)
+	c.Assert(CME.SessionDay(time.Date(2021, 8, 30, 17, 0, 0, 0, chicago)).Day(), Equals, 31)
+
+	// the JPX breaks for lunch
+	tokyo := JPX.Tz()
+	c.Assert(JPX.IsMarketOpen(time.Date(2025, 3, 21, 11, 0, 0, 0, tokyo)), Equals, true)
+	c.Assert(JPX.IsMarketOpen(time.Date(2025, 3, 21, 12, 0, 0, 0, tokyo)), Equals, false)
+	c.Assert(JPX.IsMarketOpen(time.Date(2025, 3, 20, 11, 0, 0, 0, tokyo)), Equals, false)
+	next := JPX.NextSession(time.Date(2025, 3, 19, 16, 0, 0, 0, tokyo))
+	c.Assert(next.Day.Equal(time.Date(2025, 3, 21, 0, 0, 0, 0, tokyo)), Equals, true)
+
+	// crypto trades all day long, every day
+	sunday := time.Date(2021, 8, 29, 23, 59, 0, 0, time.UTC)
+	c.Assert(Crypto.IsMarketOpen(sunday), Equals, true)
+	c.Assert(Crypto.SessionOf(sunday).Close.Equal(time.Date(2021, 8, 30, 0, 0, 0, 0, time.UTC)), Equals, true)
+
+	holidays := NYSE.Holidays(time.Date(2021, 11, 1, 0, 0, 0, 0, NY), time.Date(2021, 12, 31, 0, 0, 0, 0, NY))
+	c.Assert(holidays, HasLen, 2)
+	c.Assert(holidays[0].Format("2006-01-02"), Equals, "2021-11-25")
+	earlyCloses := NYSE.EarlyCloses(time.Date(2021, 11, 1, 0, 0, 0, 0, NY), time.Date(2021, 12, 31, 0, 0, 0, 0, NY))
+	c.Assert(earlyCloses, HasLen, 1)
+	c.Assert(earlyCloses[0].Format("2006-01-02"), Equals, "2021-11-26")
+}
+
+func (s *CalendarTestSuite) TestLoad(c *C) {
+	cal, err := Load("NYSE")
+	c.Assert(err, IsNil)
+	c.Assert(cal, Equals, NYSE)
+
+	path := filepath.Join(c.MkDir(), "lse.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(`
+name: lse
+timezone: Europe/London
+open_time: "08:00"
+close_time: "16:30"
+early_close_time: "12:30"
+non_trading_days: [2021-12-27, 2021-12-28]
+early_closes: [2021-12-24, 2021-12-31]
+`), 0644), IsNil)
+	cal, err = Load(path)
+	c.Assert(err, IsNil)
+	c.Assert(cal.Name(), Equals, "lse")
+	london := cal.Tz()
+	c.Assert(cal.IsMarketOpen(time.Date(2021, 12, 24, 12, 0, 0, 0, london)), Equals, true)
+	c.Assert(cal.IsMarketOpen(time.Date(2021, 12, 24, 13, 0, 0, 0, london)), Equals, false)
+	c.Assert(cal.IsMarketDay(time.Date(2021, 12, 27, 0, 0, 0, 0, london)), Equals, false)
+
+	Register("lse", cal)
+	defer Register("lse", nil)
+	c.Assert(Names(), DeepEquals, []string{"cme", "crypto", "jpx", "lse", "nasdaq", "nyse"})
+
+	for _, doc := range []string{
+		`{"timezone": "Nowhere/Else", "open_time": "09:30", "close_time": "16:00"}`,
+		`{"timezone": "UTC", "open_time": "09:30"}`,
+		`{"timezone": "UTC", "open_time": "09:30", "close_time": "25:00"}`,
+		`{"timezone": "UTC", "open_time": "09:30", "close_time": "16:00", "break_start": "08:00", "break_end": "09:00"}`,
+		`{"timezone": "UTC", "open_time": "09:30", "close_time": "16:00", "weekdays": ["Funday"]}`,
+		`{"timezone": "UTC", "open_time": "09:30", "close_time": "16:00", "early_closes": ["2021-12-24"]}`,
+	} {
+		_, err = Parse([]byte(doc))
+		c.Assert(err, NotNil, Commentf(doc))
+	}
+}
@@ -0,0 +1,103 @@
+package calendar
+
+// NYSE implements market calendar for the New York Stock Exchange, whose
+// holidays and early closes are those of the NASDAQ.
+var NYSE = builtin("nyse", NasdaqJson)
+
+// CME implements market calendar for the CME Globex equity and interest
+// rate futures, trading from 17:00 Chicago time on the day before until
+// 16:00.  Its holidays and early closes are approximated by those of the
+// NYSE, on which the Globex closes at 12:15 rather than not trading.
+var CME = func() *Calendar {
+	cal := builtin("cme", CMEJson)
+	for day, state := range NYSE.days {
+		cal.days[day] = state
+	}
+	return cal
+}()
+
+// JPX implements market calendar for the Tokyo Stock Exchange, with the
+// morning and afternoon sessions and the closing time of 15:30 from 2024-11-05.
+var JPX = builtin("jpx", JPXJson)
+
+// Crypto implements the calendar of the markets open all the time, such as
+// those of the crypto currencies, whose sessions are the days in UTC.
+var Crypto = builtin("crypto", CryptoJson)
+
+var CMEJson = `{
+  "timezone": "America/Chicago",
+  "open_time": "17:00:00",
+  "close_time": "16:00:00",
+  "early_close_time": "12:15:00"
+}`
+
+var JPXJson = `{
+  "timezone": "Asia/Tokyo",
+  "open_time": "09:00:00",
+  "close_time": "15:30:00",
+  "break_start": "11:30:00",
+  "break_end": "12:30:00",
+  "non_trading_days": [
+    "2024-01-01",
+    "2024-01-02",
+    "2024-01-03",
+    "2024-01-08",
+    "2024-02-12",
+    "2024-02-23",
+    "2024-03-20",
+    "2024-04-29",
+    "2024-05-03",
+    "2024-05-06",
+    "2024-07-15",
+    "2024-08-12",
+    "2024-09-16",
+    "2024-09-23",
+    "2024-10-14",
+    "2024-11-04",
+    "2024-12-31",
+    "2025-01-01",
+    "2025-01-02",
+    "2025-01-03",
+    "2025-01-13",
+    "2025-02-11",
+    "2025-02-24",
+    "2025-03-20",
+    "2025-04-29",
+    "2025-05-05",
+    "2025-05-06",
+    "2025-07-21",
+    "2025-08-11",
+    "2025-09-15",
+    "2025-09-23",
+    "2025-10-13",
+    "2025-11-03",
+    "2025-11-24",
+    "2025-12-31",
+    "2026-01-01",
+    "2026-01-02",
+    "2026-01-12",
+    "2026-02-11",
+    "2026-02-23",
+    "2026-03-20",
+    "2026-04-29",
+    "2026-05-04",
+    "2026-05-05",
+    "2026-05-06",
+    "2026-07-20",
+    "2026-08-11",
+    "2026-09-21",
+    "2026-09-22",
+    "2026-09-23",
+    "2026-10-12",
+    "2026-11-03",
+    "2026-11-23",
+    "2026-12-31"
+  ]
+}`
+
+var CryptoJson = `{
+  "timezone": "UTC",
+  "open_time": "00:00:00",
+  "close_time": "24:00:00",
+  "weekdays": ["Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"]
+}`
@@ -0,0 +1,139 @@
+package calendar
+
+import (
+	"time"
+)
+
+// Session is the trading session of a market day
+type Session struct {
+	// Day is midnight of the market day in the timezone of the calendar
+	Day   time.Time
+	Open  time.Time
+	Close time.Time
+	// BreakStart and BreakEnd bound the midday break of the session, zero
+	// without one
+	BreakStart time.Time
+	BreakEnd   time.Time
+	// EarlyClose is true if the session closes early
+	EarlyClose bool
+}
+
+// Contains returns true if the market is open at t during the session
+func (s *Session) Contains(t time.Time) bool {
+	if t.Before(s.Open) || !t.Before(s.Close) {
+		return false
+	}
+	return s.BreakStart.IsZero() || t.Before(s.BreakStart) || !t.Before(s.BreakEnd)
+}
+
+// day returns midnight of the day of t in the timezone of the calendar
+func (calendar *Calendar) day(t time.Time) time.Time {
+	yy, mm, dd := t.In(calendar.tz).Date()
+	return time.Date(yy, mm, dd, 0, 0, 0, 0, calendar.tz)
+}
+
+// Session returns the session of the market day of the date of t, nil if
+// the market is closed on that day
+func (calendar *Calendar) Session(t time.Time) *Session {
+	yy, mm, dd := t.Date()
+	day := time.Date(yy, mm, dd, 0, 0, 0, 0, calendar.tz)
+	if !calendar.IsMarketDay(day) {
+		return nil
+	}
+	session := &Session{
+		Day:   day,
+		Open:  calendar.openTime.on(day, calendar.tz),
+		Close: calendar.closeTime.on(day, calendar.tz),
+	}
+	if calendar.overnight() {
+		session.Open = calendar.openTime.on(day.AddDate(0, 0, -1), calendar.tz)
+	}
+	if calendar.days[jd(day)] == EarlyClose {
+		session.Close = calendar.earlyCloseTime.on(day, calendar.tz)
+		session.EarlyClose = true
+	}
+	if calendar.hasBreak {
+		breakStart := calendar.breakStart.on(day, calendar.tz)
+		breakEnd := calendar.breakEnd.on(day, calendar.tz)
+		// an early close before the end of the break leaves it out
+		if breakEnd.Before(session.Close) {
+			session.BreakStart, session.BreakEnd = breakStart, breakEnd
+		}
+	}
+	return session
+}
+
+// SessionOf returns the session the market is open in at t, nil if it is
+// closed at t
+func (calendar *Calendar) SessionOf(t time.Time) *Session {
+	day := calendar.day(t)
+	for _, d := range []time.Time{day, day.AddDate(0, 0, 1)} {
+		if session := calendar.Session(d); session != nil && session.Contains(t) {
+			return session
+		}
+	}
+	return nil
+}
+
+// SessionDay returns midnight of the day t belongs to in the timezone of
+// the calendar, which is the day of t, or the next day from the close on if
+// the sessions open on the day before
+func (calendar *Calendar) SessionDay(t time.Time) time.Time {
+	day := calendar.day(t)
+	if calendar.overnight() && !t.Before(calendar.closeTime.on(day, calendar.tz)) {
+		return day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// Sessions returns the sessions open at any time from start until end, in
+// the order of time
+func (calendar *Calendar) Sessions(start, end time.Time) []Session {
+	var sessions []Session
+	last := calendar.day(end).AddDate(0, 0, 1)
+	for day := calendar.day(start); !day.After(last); day = day.AddDate(0, 0, 1) {
+		if session := calendar.Session(day); session != nil &&
+			session.Close.After(start) && session.Open.Before(end) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions
+}
+
+// NextSession returns the session open at t, or else the next to open
+// after t within a year, nil if there is none
+func (calendar *Calendar) NextSession(t time.Time) *Session {
+	day := calendar.day(t)
+	for i := 0; i <= 366; i++ {
+		if session := calendar.Session(day.AddDate(0, 0, i)); session != nil && session.Close.After(t) {
+			return session
+		}
+	}
+	return nil
+}
+
+// Holidays returns midnight of the weekdays from the day of start to that
+// of end the market is closed on, in the timezone of the calendar
+func (calendar *Calendar) Holidays(start, end time.Time) []time.Time {
+	return calendar.daysOf(Closed, start, end)
+}
+
+// EarlyCloses returns midnight of the days from the day of start to that of
+// end the market closes early on, in the timezone of the calendar
+func (calendar *Calendar) EarlyCloses(start, end time.Time) []time.Time {
+	return calendar.daysOf(EarlyClose, start, end)
+}
+
+func (calendar *Calendar) daysOf(state MarketState, start, end time.Time) []time.Time {
+	var days []time.Time
+	last := calendar.day(end)
+	for day := calendar.day(start); !day.After(last); day = day.AddDate(0, 0, 1) {
+		if !calendar.weekdays[day.Weekday()] {
+			continue
+		}
+		if s, ok := calendar.days[jd(day)]; ok && s == state {
+			days = append(days, day)
+		}
+	}
+	return days
+}
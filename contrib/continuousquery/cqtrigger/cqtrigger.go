@@ -0,0 +1,205 @@
+// ContinuousQuery implements a trigger that maintains materialized views
+// defined by SQL queries.  Each time data is written to a bucket matching
+// the trigger, every configured view re-runs its query over the time window
+// touched by the write and writes the result to its destination bucket.
+//
+// Example:
+// 	triggers:
+// 	  - module: continuousquery.so
+// 	    on: */1Min/OHLCV
+// 	    config:
+// 	      views:
+// 	        - query: "SELECT Epoch, Close, Volume FROM `{source}` WHERE Epoch >= ? AND Epoch <= ? AND Volume > 1000"
+// 	          destination: "{Symbol}/1Min/BIGVOL"
+// 	        - query: "SELECT candlecandler('5Min', Open, High, Low, Close) FROM `{source}` WHERE Epoch >= ? AND Epoch <= ?"
+// 	          destination: "{Symbol}/5Min/CANDLE"
+// 	          window: 5Min
+//
+// In both query and destination, {source} is replaced by the written bucket
+// key and {<Category>} by its item in that category, e.g. {Symbol}.  The '?'
+// placeholders, if present, are bound to the first and last second of the
+// window touched by the write, aligned to window (the written timeframe by
+// default), so the query only reads the data needed to update the view.
+package cqtrigger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/sqlparser"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// ViewConfig is the configuration of a single materialized view.
+type ViewConfig struct {
+	Query       string `json:"query"`
+	Destination string `json:"destination"`
+	Window      string `json:"window"`
+}
+
+// CQTriggerConfig is the configuration for ContinuousQueryTrigger you can
+// define in marketstore's config file under triggers extension.
+type CQTriggerConfig struct {
+	Views []ViewConfig `json:"views"`
+}
+
+type view struct {
+	query       string
+	destination string
+	// nil aligns updates to the timeframe of the written bucket
+	window *utils.CandleDuration
+}
+
+// ContinuousQueryTrigger is the main trigger.
+type ContinuousQueryTrigger struct {
+	config map[string]interface{}
+	views  []view
+	// parsed queries by their text, after substitution of the source bucket
+	statements *sqlparser.StatementCache
+}
+
+var (
+	_         trigger.Trigger = &ContinuousQueryTrigger{}
+	loadError                 = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *CQTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := CQTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new continuous query trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	if len(config.Views) == 0 {
+		log.Warn("no views are configured\n")
+		return nil, loadError
+	}
+
+	var views []view
+	for _, vc := range config.Views {
+		if vc.Query == "" || vc.Destination == "" {
+			log.Error("views require both a query and a destination\n")
+			return nil, loadError
+		}
+		v := view{
+			query:       vc.Query,
+			destination: vc.Destination,
+		}
+		if vc.Window != "" {
+			if utils.TimeframeFromString(vc.Window) == nil {
+				log.Error("invalid window: %s\n", vc.Window)
+				return nil, loadError
+			}
+			v.window = utils.CandleDurationFromString(vc.Window)
+		}
+		views = append(views, v)
+	}
+
+	log.Info("%d view(s) configured\n", len(views))
+
+	return &ContinuousQueryTrigger{
+		config:     conf,
+		views:      views,
+		statements: sqlparser.NewStatementCache(1024),
+	}, nil
+}
+
+// Fire implements trigger interface.
+func (s *ContinuousQueryTrigger) Fire(keyPath string, records []trigger.Record) {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	for _, v := range s.views {
+		if err := s.update(v, tbk, tf, head, tail); err != nil {
+			log.Error(
+				"failed to update view of %v into %v (%v)\n",
+				tbk.String(),
+				expand(v.destination, tbk),
+				err)
+		}
+	}
+}
+
+// update re-runs the view query over the window touched by the write and
+// writes the result to the view destination.
+func (s *ContinuousQueryTrigger) update(
+	v view,
+	tbk *io.TimeBucketKey,
+	tf *utils.Timeframe,
+	head, tail time.Time) error {
+
+	window := v.window
+	if window == nil {
+		window = utils.CandleDurationFromString(tf.String)
+	}
+	start := window.Truncate(head)
+	end := window.Ceil(tail).Add(-time.Second)
+
+	ast, err := s.statements.Get(expand(v.query, tbk))
+	if err != nil {
+		return err
+	}
+	var parameters []interface{}
+	switch ast.NumParameters {
+	case 0:
+	case 2:
+		parameters = []interface{}{start.Unix(), end.Unix()}
+	default:
+		return fmt.Errorf("query must have either no parameters or two for the window start and end, has %d",
+			ast.NumParameters)
+	}
+
+	es, err := sqlparser.NewPreparedExecutableStatement(ast, parameters...)
+	if err != nil {
+		return err
+	}
+	cs, err := es.Materialize()
+	if err != nil {
+		return err
+	}
+	if cs == nil || cs.Len() == 0 {
+		return nil
+	}
+	if cs.GetEpoch() == nil {
+		return fmt.Errorf("query result has no Epoch column")
+	}
+
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey(expand(v.destination, tbk)), cs)
+	return executor.WriteCSM(csm, false)
+}
+
+// expand replaces {source} with the bucket key and {<Category>} with the
+// item of the key in that category.
+func expand(template string, tbk *io.TimeBucketKey) string {
+	out := strings.Replace(template, "{source}", tbk.GetItemKey(), -1)
+	for _, category := range tbk.GetCategories() {
+		out = strings.Replace(out, "{"+category+"}", tbk.GetItemInCategory(category), -1)
+	}
+	return out
+}
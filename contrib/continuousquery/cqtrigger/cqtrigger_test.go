@@ -0,0 +1,164 @@
+package cqtrigger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	var config = getConfig(`{
+        "views": [
+            {"query": "SELECT Close FROM ` + "`{source}`" + `;", "destination": "{Symbol}/1Min/CLOSE"},
+            {"query": "SELECT Close FROM ` + "`{source}`" + `;", "destination": "{Symbol}/5Min/CLOSE", "window": "5Min"}
+        ]
+        }`)
+	var ret, err = NewTrigger(config)
+	c.Assert(err, IsNil)
+	var trig = ret.(*ContinuousQueryTrigger)
+	c.Assert(len(trig.views), Equals, 2)
+	c.Assert(trig.views[0].window, IsNil)
+	c.Assert(trig.views[1].window, NotNil)
+
+	// missing views
+	ret, err = NewTrigger(getConfig(`{}`))
+	c.Assert(ret, IsNil)
+	c.Assert(err, NotNil)
+
+	// missing destination
+	ret, err = NewTrigger(getConfig(`{"views": [{"query": "SELECT Close FROM x;"}]}`))
+	c.Assert(ret, IsNil)
+	c.Assert(err, NotNil)
+
+	// bad window
+	ret, err = NewTrigger(getConfig(`{"views": [{"query": "q", "destination": "d", "window": "5Foo"}]}`))
+	c.Assert(ret, IsNil)
+	c.Assert(err, NotNil)
+}
+
+func (t *TestSuite) TestExpand(c *C) {
+	tbk := io.NewTimeBucketKey("AAPL/1Min/OHLCV")
+	c.Assert(expand("SELECT * FROM `{source}`;", tbk), Equals, "SELECT * FROM `AAPL/1Min/OHLCV`;")
+	c.Assert(expand("{Symbol}/5Min/{AttributeGroup}", tbk), Equals, "AAPL/5Min/OHLCV")
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	// We assume WriteCSM here is synchronous by not running
+	// background writer
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(getConfig(`{
+        "views": [
+            {
+                "query": "SELECT Epoch, Close FROM ` + "`{source}`" + ` WHERE Epoch >= ? AND Epoch <= ? AND Close > 3;",
+                "destination": "{Symbol}/1Min/HIGHCLOSE"
+            },
+            {
+                "query": "SELECT candlecandler('5Min', Open, High, Low, Close) FROM ` + "`{source}`" + ` WHERE Epoch >= ? AND Epoch <= ?;",
+                "destination": "{Symbol}/5Min/CANDLE",
+                "window": "5Min"
+            }
+        ]
+        }`))
+	c.Assert(err, IsNil)
+
+	epoch := []int64{
+		time.Date(2017, 12, 14, 10, 3, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 14, 10, 4, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 14, 10, 5, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 14, 10, 6, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 14, 10, 10, 0, 0, time.UTC).Unix(),
+	}
+	open := []float32{1., 2., 3., 4., 5.}
+	high := []float32{1.1, 2.1, 3.1, 4.1, 5.1}
+	low := []float32{0.9, 1.9, 2.9, 3.9, 4.9}
+	close := []float32{1.05, 2.05, 3.05, 4.05, 5.05}
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", open)
+	cs.AddColumn("High", high)
+	cs.AddColumn("Low", low)
+	cs.AddColumn("Close", close)
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLC")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	err = executor.WriteCSM(csm, false)
+	c.Assert(err, IsNil)
+
+	// Fire with the last two records only, the view windows are aligned
+	// so the 5Min view still sees the 10:05 record
+	rs := cs.ToRowSeries(*tbk, true)
+	rowData := rs.GetData()
+	times := rs.GetTime()
+	numRows := len(times)
+	rowLen := len(rowData) / numRows
+
+	records := make([]trigger.Record, 0, numRows)
+	for i := 3; i < numRows; i++ {
+		pos := i * rowLen
+		record := rowData[pos : pos+rowLen]
+		index := io.TimeToIndex(times[i], time.Minute)
+
+		buf, _ := io.Serialize(nil, index)
+		buf = append(buf, record[8:]...)
+
+		records = append(records, trigger.Record(buf))
+	}
+
+	trig.Fire("TEST/1Min/OHLC/2017.bin", records)
+
+	read := func(key string) *io.ColumnSeries {
+		q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+		target := io.NewTimeBucketKey(key)
+		q.AddTargetKey(target)
+		q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+		parsed, err := q.Parse()
+		c.Assert(err, IsNil)
+		scanner, err := executor.NewReader(parsed)
+		c.Assert(err, IsNil)
+		csm, err := scanner.Read()
+		c.Assert(err, IsNil)
+		return csm[*target]
+	}
+
+	// Only the fired window is recomputed: 10:06 to 10:10
+	// in the 1Min view, 10:05 to 10:14 in the 5Min view
+	filtered := read("TEST/1Min/HIGHCLOSE")
+	c.Assert(filtered, NotNil)
+	c.Assert(filtered.GetEpoch(), DeepEquals, epoch[3:])
+	c.Assert(filtered.GetByName("Close"), DeepEquals, []float32{4.05, 5.05})
+
+	candles := read("TEST/5Min/CANDLE")
+	c.Assert(candles, NotNil)
+	c.Assert(candles.Len(), Equals, 2)
+	c.Assert(candles.GetByName("Open").([]float32)[0], Equals, float32(3.))
+	c.Assert(candles.GetByName("Close").([]float32)[0], Equals, float32(4.05))
+	c.Assert(candles.GetByName("Open").([]float32)[1], Equals, float32(5.))
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/alpacahq/marketstore/executor"
 	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
@@ -17,6 +18,9 @@ import (
 	gdax "github.com/preichenberger/go-gdax"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 type byTime []gdax.HistoricRate
 
 func (a byTime) Len() int           { return len(a) }
@@ -11,11 +11,15 @@ import (
 
 	"github.com/alpacahq/marketstore/contrib/iex/api"
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 const (
 	minute   = "1Min"
 	daily    = "1D"
@@ -0,0 +1,223 @@
+package indicatortrigger
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// indicator computes the columns of a technical indicator from a series of
+// values, NaN where the indicator is not defined yet
+type indicator interface {
+	// columns returns the names of the columns of the indicator
+	columns() []string
+	// compute returns the columns of the indicator for the values
+	compute(values []float64) [][]float64
+	// warmup returns the number of values before the first to compute the
+	// indicator exactly, or closely enough for the smoothed ones
+	warmup() int
+}
+
+// newIndicator returns the indicator of the configuration, applying the
+// defaults of its parameters
+func newIndicator(ic *IndicatorConfig) (indicator, error) {
+	def := func(value *int, defValue int) {
+		if *value == 0 {
+			*value = defValue
+		}
+	}
+	switch strings.ToLower(ic.Type) {
+	case "sma":
+		def(&ic.Period, 20)
+		return &smaIndicator{period: ic.Period}, checkPeriods(ic.Period)
+	case "ema":
+		def(&ic.Period, 20)
+		return &emaIndicator{period: ic.Period}, checkPeriods(ic.Period)
+	case "rsi":
+		def(&ic.Period, 14)
+		return &rsiIndicator{period: ic.Period}, checkPeriods(ic.Period)
+	case "macd":
+		def(&ic.Fast, 12)
+		def(&ic.Slow, 26)
+		def(&ic.Signal, 9)
+		if err := checkPeriods(ic.Fast, ic.Slow, ic.Signal); err != nil {
+			return nil, err
+		}
+		if ic.Fast >= ic.Slow {
+			return nil, fmt.Errorf("fast period %d must be shorter than slow period %d", ic.Fast, ic.Slow)
+		}
+		return &macdIndicator{fast: ic.Fast, slow: ic.Slow, signal: ic.Signal}, nil
+	case "bollinger":
+		def(&ic.Period, 20)
+		if ic.StdDev == 0 {
+			ic.StdDev = 2
+		}
+		if ic.StdDev < 0 {
+			return nil, fmt.Errorf("invalid stddev %g", ic.StdDev)
+		}
+		return &bollingerIndicator{period: ic.Period, k: ic.StdDev}, checkPeriods(ic.Period)
+	}
+	return nil, fmt.Errorf("unknown indicator type \"%s\"", ic.Type)
+}
+
+func checkPeriods(periods ...int) error {
+	for _, period := range periods {
+		if period < 1 {
+			return fmt.Errorf("invalid period %d", period)
+		}
+	}
+	return nil
+}
+
+// smoothing is the number of periods read before the first value of the
+// exponentially smoothed indicators, after which the weight of the values
+// left out is below 1e-4 of the result
+const smoothing = 10
+
+type smaIndicator struct {
+	period int
+}
+
+func (i *smaIndicator) columns() []string { return []string{"SMA"} }
+func (i *smaIndicator) warmup() int       { return i.period - 1 }
+func (i *smaIndicator) compute(values []float64) [][]float64 {
+	return [][]float64{sma(values, i.period)}
+}
+
+type emaIndicator struct {
+	period int
+}
+
+func (i *emaIndicator) columns() []string { return []string{"EMA"} }
+func (i *emaIndicator) warmup() int       { return smoothing * i.period }
+func (i *emaIndicator) compute(values []float64) [][]float64 {
+	return [][]float64{ema(values, i.period, 2/float64(i.period+1))}
+}
+
+// rsiIndicator is the relative strength index of Wilder
+type rsiIndicator struct {
+	period int
+}
+
+func (i *rsiIndicator) columns() []string { return []string{"RSI"} }
+func (i *rsiIndicator) warmup() int       { return smoothing * i.period }
+func (i *rsiIndicator) compute(values []float64) [][]float64 {
+	out := nanSlice(len(values))
+	if len(values) <= i.period {
+		return [][]float64{out}
+	}
+	gains := make([]float64, len(values)-1)
+	losses := make([]float64, len(values)-1)
+	for j := 1; j < len(values); j++ {
+		if change := values[j] - values[j-1]; change > 0 {
+			gains[j-1] = change
+		} else {
+			losses[j-1] = -change
+		}
+	}
+	alpha := 1 / float64(i.period)
+	avgGain := ema(gains, i.period, alpha)
+	avgLoss := ema(losses, i.period, alpha)
+	for j := i.period; j < len(values); j++ {
+		gain, loss := avgGain[j-1], avgLoss[j-1]
+		switch {
+		case loss == 0 && gain == 0:
+			out[j] = 50
+		case loss == 0:
+			out[j] = 100
+		default:
+			out[j] = 100 - 100/(1+gain/loss)
+		}
+	}
+	return [][]float64{out}
+}
+
+// macdIndicator is the moving average convergence divergence
+type macdIndicator struct {
+	fast, slow, signal int
+}
+
+func (i *macdIndicator) columns() []string { return []string{"MACD", "Signal", "Histogram"} }
+func (i *macdIndicator) warmup() int       { return smoothing*i.slow + i.signal }
+func (i *macdIndicator) compute(values []float64) [][]float64 {
+	fast := ema(values, i.fast, 2/float64(i.fast+1))
+	slow := ema(values, i.slow, 2/float64(i.slow+1))
+	macd := nanSlice(len(values))
+	for j := range values {
+		macd[j] = fast[j] - slow[j]
+	}
+	// the signal line starts with the first MACD value
+	start := i.slow - 1
+	signal := nanSlice(len(values))
+	histogram := nanSlice(len(values))
+	if start < len(values) {
+		copy(signal[start:], ema(macd[start:], i.signal, 2/float64(i.signal+1)))
+	}
+	for j := range values {
+		histogram[j] = macd[j] - signal[j]
+	}
+	return [][]float64{macd, signal, histogram}
+}
+
+// bollingerIndicator is the simple moving average of the period and the
+// bands k standard deviations above and below it
+type bollingerIndicator struct {
+	period int
+	k      float64
+}
+
+func (i *bollingerIndicator) columns() []string { return []string{"Middle", "Upper", "Lower"} }
+func (i *bollingerIndicator) warmup() int       { return i.period - 1 }
+func (i *bollingerIndicator) compute(values []float64) [][]float64 {
+	middle := sma(values, i.period)
+	upper := nanSlice(len(values))
+	lower := nanSlice(len(values))
+	for j := i.period - 1; j < len(values); j++ {
+		var variance float64
+		for _, v := range values[j-i.period+1 : j+1] {
+			variance += (v - middle[j]) * (v - middle[j])
+		}
+		band := i.k * math.Sqrt(variance/float64(i.period))
+		upper[j] = middle[j] + band
+		lower[j] = middle[j] - band
+	}
+	return [][]float64{middle, upper, lower}
+}
+
+// sma returns the simple moving average of the period
+func sma(values []float64, period int) []float64 {
+	out := nanSlice(len(values))
+	var sum float64
+	for j, v := range values {
+		sum += v
+		if j >= period {
+			sum -= values[j-period]
+		}
+		if j >= period-1 {
+			out[j] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// ema returns the exponential moving average of smoothing factor alpha,
+// starting with the simple moving average of the first period values
+func ema(values []float64, period int, alpha float64) []float64 {
+	out := nanSlice(len(values))
+	if len(values) < period {
+		return out
+	}
+	out[period-1] = sma(values[:period], period)[period-1]
+	for j := period; j < len(values); j++ {
+		out[j] = alpha*values[j] + (1-alpha)*out[j-1]
+	}
+	return out
+}
+
+func nanSlice(n int) []float64 {
+	out := make([]float64, n)
+	for j := range out {
+		out[j] = math.NaN()
+	}
+	return out
+}
@@ -0,0 +1,259 @@
+// Indicator implements a trigger that maintains technical indicators of the
+// bar buckets matching the trigger in sibling attribute groups, so that the
+// clients can query them rather than recomputing them on every request.
+//
+// Example:
+// 	triggers:
+// 	  - module: indicator.so
+// 	    on: */1Min/OHLCV
+// 	    config:
+// 	      indicators:
+// 	        - type: rsi
+// 	          period: 14
+// 	        - type: macd
+// 	        - type: bollinger
+// 	          period: 20
+// 	          stddev: 2
+//
+// With the above, a write to AAPL/1Min/OHLCV updates AAPL/1Min/RSI14,
+// AAPL/1Min/MACD12_26_9 and AAPL/1Min/BB20_2 for the records written.  Each
+// write reads back the records written along with those before them needed
+// to compute the indicators, so the indicators are updated incrementally.
+package indicatortrigger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/uda"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// IndicatorConfig is the configuration of a single indicator.
+type IndicatorConfig struct {
+	// One of sma, ema, rsi, macd and bollinger
+	Type string `json:"type"`
+	// Source column, Close if omitted
+	Column string `json:"column"`
+	// Period of sma, ema, rsi and bollinger, 20 if omitted, 14 for rsi
+	Period int `json:"period"`
+	// Periods of macd, 12, 26 and 9 if omitted
+	Fast   int `json:"fast"`
+	Slow   int `json:"slow"`
+	Signal int `json:"signal"`
+	// Width of the bollinger bands in standard deviations, 2 if omitted
+	StdDev float64 `json:"stddev"`
+	// Attribute group of the indicator, e.g. RSI14 if omitted
+	Destination string `json:"destination"`
+}
+
+// IndicatorTriggerConfig is the configuration for IndicatorTrigger you can
+// define in marketstore's config file under triggers extension.
+type IndicatorTriggerConfig struct {
+	Indicators []IndicatorConfig `json:"indicators"`
+}
+
+type target struct {
+	indicator   indicator
+	column      string
+	destination string
+}
+
+// IndicatorTrigger is the main trigger.
+type IndicatorTrigger struct {
+	config  map[string]interface{}
+	targets []target
+	// records read before those written
+	warmup int
+}
+
+var (
+	_         trigger.Trigger = &IndicatorTrigger{}
+	loadError                 = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *IndicatorTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := IndicatorTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new indicator trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	if len(config.Indicators) == 0 {
+		log.Warn("no indicators are configured\n")
+		return nil, loadError
+	}
+
+	var (
+		targets []target
+		warmup  int
+	)
+	destinations := map[string]bool{}
+	for _, ic := range config.Indicators {
+		ind, err := newIndicator(&ic)
+		if err != nil {
+			log.Error("invalid indicator (%v)\n", err)
+			return nil, loadError
+		}
+		t := target{
+			indicator:   ind,
+			column:      ic.Column,
+			destination: ic.Destination,
+		}
+		if t.column == "" {
+			t.column = "Close"
+		}
+		if t.destination == "" {
+			t.destination = defaultDestination(&ic)
+		}
+		if destinations[t.destination] {
+			log.Error("indicators can not share destination %s\n", t.destination)
+			return nil, loadError
+		}
+		destinations[t.destination] = true
+		if ind.warmup() > warmup {
+			warmup = ind.warmup()
+		}
+		targets = append(targets, t)
+	}
+
+	log.Info("%d indicator(s) configured\n", len(targets))
+
+	return &IndicatorTrigger{
+		config:  conf,
+		targets: targets,
+		warmup:  warmup,
+	}, nil
+}
+
+// defaultDestination returns the attribute group of the indicator named by
+// its type and parameters
+func defaultDestination(ic *IndicatorConfig) string {
+	switch strings.ToLower(ic.Type) {
+	case "macd":
+		return fmt.Sprintf("MACD%d_%d_%d", ic.Fast, ic.Slow, ic.Signal)
+	case "bollinger":
+		return fmt.Sprintf("BB%d_%s", ic.Period, strings.Replace(strconv.FormatFloat(ic.StdDev, 'g', -1, 64), ".", "_", -1))
+	}
+	return fmt.Sprintf("%s%d", strings.ToUpper(ic.Type), ic.Period)
+}
+
+// Fire implements trigger interface.
+func (s *IndicatorTrigger) Fire(keyPath string, records []trigger.Record) {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	cs, err := s.read(tbk, tail.Add(tf.Duration-time.Second), s.warmup+len(records))
+	if err != nil {
+		log.Error("failed to read %v (%v)\n", tbk.String(), err)
+		return
+	}
+	if cs == nil || cs.Len() == 0 {
+		return
+	}
+
+	for _, t := range s.targets {
+		destKey := io.NewTimeBucketKey(strings.Join([]string{elements[0], elements[1], t.destination}, "/"))
+		if err := s.update(t, cs, destKey, head); err != nil {
+			log.Error("failed to update %v from %v (%v)\n", destKey.String(), tbk.String(), err)
+		}
+	}
+}
+
+// read returns the last rows of the bucket until end
+func (s *IndicatorTrigger) read(tbk *io.TimeBucketKey, end time.Time, rows int) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	q.SetEnd(end.Unix())
+	q.SetRowLimit(io.LAST, rows)
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	return csm[*tbk], nil
+}
+
+// update computes the indicator and writes its values from head on, where
+// it is defined
+func (s *IndicatorTrigger) update(t target, cs *io.ColumnSeries, destKey *io.TimeBucketKey, head time.Time) error {
+	if !cs.Exists(t.column) {
+		return fmt.Errorf("no %s column", t.column)
+	}
+	values, err := uda.ColumnToFloat64(cs, t.column)
+	if err != nil {
+		return err
+	}
+	columns := t.indicator.compute(values)
+
+	epoch := cs.GetEpoch()
+	var (
+		outEpoch   []int64
+		outColumns = make([][]float64, len(columns))
+	)
+	for j := range epoch {
+		if epoch[j] < head.Unix() || !defined(columns, j) {
+			continue
+		}
+		outEpoch = append(outEpoch, epoch[j])
+		for k := range columns {
+			outColumns[k] = append(outColumns[k], columns[k][j])
+		}
+	}
+	if len(outEpoch) == 0 {
+		return nil
+	}
+
+	out := io.NewColumnSeries()
+	out.AddColumn("Epoch", outEpoch)
+	for k, name := range t.indicator.columns() {
+		out.AddColumn(name, outColumns[k])
+	}
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*destKey, out)
+	return executor.WriteCSM(csm, false)
+}
+
+func defined(columns [][]float64, j int) bool {
+	for _, column := range columns {
+		if math.IsNaN(column[j]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package indicatortrigger
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	ret, err := NewTrigger(getConfig(`{
+        "indicators": [
+            {"type": "rsi"},
+            {"type": "macd"},
+            {"type": "bollinger", "stddev": 2.5},
+            {"type": "sma", "period": 50, "column": "Open", "destination": "OPENSMA"}
+        ]
+        }`))
+	c.Assert(err, IsNil)
+	trig := ret.(*IndicatorTrigger)
+	c.Assert(trig.targets, HasLen, 4)
+	var destinations []string
+	for _, t := range trig.targets {
+		destinations = append(destinations, t.destination)
+	}
+	c.Assert(destinations, DeepEquals, []string{"RSI14", "MACD12_26_9", "BB20_2_5", "OPENSMA"})
+	c.Assert(trig.targets[0].column, Equals, "Close")
+	c.Assert(trig.targets[3].column, Equals, "Open")
+	c.Assert(trig.warmup, Equals, 10*26+9)
+
+	for _, config := range []string{
+		`{}`,
+		`{"indicators": [{"type": "stochastic"}]}`,
+		`{"indicators": [{"type": "rsi", "period": -1}]}`,
+		`{"indicators": [{"type": "macd", "fast": 26, "slow": 12}]}`,
+		`{"indicators": [{"type": "rsi"}, {"type": "rsi"}]}`,
+	} {
+		ret, err = NewTrigger(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestIndicators(c *C) {
+	values := []float64{1, 2, 3, 4, 5, 6}
+
+	c.Assert(sma(values, 3)[2:], DeepEquals, []float64{2, 3, 4, 5})
+	c.Assert(math.IsNaN(sma(values, 3)[1]), Equals, true)
+
+	// seeded with the SMA of the first period values
+	c.Assert(ema(values, 3, 0.5)[2:], DeepEquals, []float64{2, 3, 4, 5})
+
+	rsi := (&rsiIndicator{period: 3}).compute(values)[0]
+	c.Assert(math.IsNaN(rsi[2]), Equals, true)
+	c.Assert(rsi[3:], DeepEquals, []float64{100, 100, 100})
+	rsi = (&rsiIndicator{period: 2}).compute([]float64{1, 2, 1, 2})[0]
+	c.Assert(rsi[2], Equals, 50.)
+	// Wilder's smoothing
+	c.Assert(rsi[3], Equals, 100-100/(1+0.75/0.25))
+
+	bands := (&bollingerIndicator{period: 2, k: 2}).compute([]float64{1, 3, 3})
+	c.Assert(bands[0][1:], DeepEquals, []float64{2, 3})
+	c.Assert(bands[1][1:], DeepEquals, []float64{4, 3})
+	c.Assert(bands[2][1:], DeepEquals, []float64{0, 3})
+
+	macd := (&macdIndicator{fast: 2, slow: 3, signal: 2}).compute(values)
+	// the EMAs of a linear series lag it by a constant
+	c.Assert(macd[0][2:], DeepEquals, []float64{0.5, 0.5, 0.5, 0.5})
+	c.Assert(math.IsNaN(macd[1][2]), Equals, true)
+	c.Assert(macd[1][3:], DeepEquals, []float64{0.5, 0.5, 0.5})
+	c.Assert(macd[2][3:], DeepEquals, []float64{0, 0, 0})
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(getConfig(`{
+        "indicators": [
+            {"type": "sma", "period": 3},
+            {"type": "bollinger", "period": 2, "stddev": 2}
+        ]
+        }`))
+	c.Assert(err, IsNil)
+
+	var epoch []int64
+	for i := 0; i < 5; i++ {
+		epoch = append(epoch, time.Date(2017, 12, 14, 10, i, 0, 0, time.UTC).Unix())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Close", []float32{1., 3., 3., 5., 7.})
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLCV")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	// fire with the last two records only, the records before them are read
+	// back to compute the indicators
+	rs := cs.ToRowSeries(*tbk, true)
+	rowData := rs.GetData()
+	times := rs.GetTime()
+	rowLen := len(rowData) / len(times)
+	records := make([]trigger.Record, 0, 2)
+	for i := 3; i < len(times); i++ {
+		record := rowData[i*rowLen : (i+1)*rowLen]
+		buf, _ := io.Serialize(nil, io.TimeToIndex(times[i], time.Minute))
+		records = append(records, trigger.Record(append(buf, record[8:]...)))
+	}
+	trig.Fire("TEST/1Min/OHLCV/2017.bin", records)
+
+	read := func(key string) *io.ColumnSeries {
+		q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+		target := io.NewTimeBucketKey(key)
+		q.AddTargetKey(target)
+		q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+		parsed, err := q.Parse()
+		c.Assert(err, IsNil)
+		scanner, err := executor.NewReader(parsed)
+		c.Assert(err, IsNil)
+		csm, err := scanner.Read()
+		c.Assert(err, IsNil)
+		c.Assert(csm[*target], NotNil)
+		return csm[*target]
+	}
+
+	smaCs := read("TEST/1Min/SMA3")
+	c.Assert(smaCs.GetEpoch(), DeepEquals, epoch[3:])
+	c.Assert(smaCs.GetByName("SMA"), DeepEquals, []float64{11. / 3, 5.})
+
+	bandsCs := read("TEST/1Min/BB2_2")
+	c.Assert(bandsCs.GetEpoch(), DeepEquals, epoch[3:])
+	c.Assert(bandsCs.GetByName("Middle"), DeepEquals, []float64{4., 6.})
+	c.Assert(bandsCs.GetByName("Upper"), DeepEquals, []float64{6., 8.})
+	c.Assert(bandsCs.GetByName("Lower"), DeepEquals, []float64{2., 4.})
+}
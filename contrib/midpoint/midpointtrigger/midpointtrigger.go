@@ -0,0 +1,333 @@
+// Midpoint implements a trigger that samples the variable length quote
+// buckets matching the trigger into fixed interval series of the best bid
+// and offer, their midpoint and spread, the standard input of the execution
+// quality analysis.  Underlying data schema is expected at least
+// - BidPrice:float32 or float64
+// - AskPrice:float32 or float64
+// optionally,
+// - BidSize:any numeric type
+// - AskSize:any numeric type
+//
+// Example:
+// 	triggers:
+// 	  - module: midpoint.so
+// 	    on: */1Min/QUOTE
+// 	    config:
+// 	      destinations:
+// 	        - 1Sec
+// 	        - 1Min
+//
+// With the above, a write to AAPL/1Min/QUOTE updates AAPL/1Sec/NBBO and
+// AAPL/1Min/NBBO with the last quote of each interval the quotes written fall
+// in.  The quotes without a positive bid and ask, and the crossed ones, are
+// left out.
+package midpointtrigger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/uda"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// MidpointTriggerConfig is the configuration for MidpointTrigger you can
+// define in marketstore's config file under triggers extension.
+type MidpointTriggerConfig struct {
+	// Sampling intervals, 1Sec if omitted
+	Destinations []string `json:"destinations"`
+	// Attribute group of the samples, NBBO if omitted
+	AttributeGroup string `json:"attribute_group"`
+}
+
+// MidpointTrigger is the main trigger.
+type MidpointTrigger struct {
+	config       map[string]interface{}
+	destinations []utils.Timeframe
+	group        string
+	// largest destination, the span the quotes are read in
+	span time.Duration
+}
+
+var (
+	_         trigger.CheckedTrigger = &MidpointTrigger{}
+	loadError                        = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *MidpointTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := MidpointTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new midpoint trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	if len(config.Destinations) == 0 {
+		config.Destinations = []string{"1Sec"}
+	}
+	t := &MidpointTrigger{
+		config: conf,
+		group:  config.AttributeGroup,
+	}
+	for _, dest := range config.Destinations {
+		tf := utils.TimeframeFromString(dest)
+		if tf == nil {
+			log.Error("invalid destination: %s\n", dest)
+			return nil, loadError
+		}
+		if tf.Duration >= utils.Day || utils.Day%tf.Duration != 0 {
+			log.Error("destination %s does not divide a day\n", dest)
+			return nil, loadError
+		}
+		if tf.Duration > t.span {
+			t.span = tf.Duration
+		}
+		t.destinations = append(t.destinations, *tf)
+	}
+	if t.group == "" {
+		t.group = "NBBO"
+	}
+
+	log.Info("%d destination(s) configured\n", len(t.destinations))
+
+	return t, nil
+}
+
+// Fire implements trigger interface.
+func (s *MidpointTrigger) Fire(keyPath string, records []trigger.Record) {
+	if err := s.TryFire(keyPath, records); err != nil {
+		log.Error("%v\n", err)
+	}
+}
+
+// TryFire implements trigger.CheckedTrigger, so that the failed writes of
+// the samples are retried and dead-lettered.
+func (s *MidpointTrigger) TryFire(keyPath string, records []trigger.Record) error {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	// the quotes of the intervals written are read along with the others of
+	// the samples they fall in
+	start := head.Truncate(s.span)
+	end := tail.Add(tf.Duration)
+	if ceil := end.Truncate(s.span); ceil.Before(end) {
+		end = ceil.Add(s.span)
+	}
+
+	cs, err := read(tbk, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to read %v (%v)", tbk.String(), err)
+	}
+	if cs == nil || cs.Len() == 0 {
+		return nil
+	}
+	q, err := filter(cs, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to read quotes of %v (%v)", tbk.String(), err)
+	}
+	if len(q.epoch) == 0 {
+		return nil
+	}
+
+	csm := io.NewColumnSeriesMap()
+	for _, dest := range s.destinations {
+		sampleTbk := io.NewTimeBucketKey(strings.Join([]string{elements[0], dest.String, s.group}, "/"))
+		csm.AddColumnSeries(*sampleTbk, q.sample(dest.Duration))
+	}
+	if err := executor.WriteCSM(csm, false); err != nil {
+		return fmt.Errorf("failed to write samples of %v (%v)", tbk.String(), err)
+	}
+	return nil
+}
+
+// quotes are the quotes of a bucket sampled
+type quotes struct {
+	epoch            []int64
+	bid, ask         []float64
+	bidSize, askSize []float64
+	// types of the sample columns, those of the quote columns, no sizes
+	// being sampled if the bucket has none
+	priceType, sizeType io.EnumElementType
+	sizes               bool
+}
+
+// filter returns the quotes of the column series in [start, end) with a
+// positive bid and ask which are not crossed, in time order, the late quotes
+// being appended to the quotes of their interval
+func filter(cs *io.ColumnSeries, start, end time.Time) (*quotes, error) {
+	for _, name := range []string{"BidPrice", "AskPrice"} {
+		if !cs.Exists(name) {
+			return nil, fmt.Errorf("no %s column", name)
+		}
+	}
+	bid, err := uda.ColumnToFloat64(cs, "BidPrice")
+	if err != nil {
+		return nil, err
+	}
+	ask, err := uda.ColumnToFloat64(cs, "AskPrice")
+	if err != nil {
+		return nil, err
+	}
+	q := &quotes{priceType: io.FLOAT64, sizeType: io.FLOAT64}
+	if _, ok := cs.GetByName("BidPrice").([]float32); ok {
+		q.priceType = io.FLOAT32
+	}
+	var bidSize, askSize []float64
+	if cs.Exists("BidSize") && cs.Exists("AskSize") {
+		q.sizes = true
+		if bidSize, err = uda.ColumnToFloat64(cs, "BidSize"); err != nil {
+			return nil, err
+		}
+		if askSize, err = uda.ColumnToFloat64(cs, "AskSize"); err != nil {
+			return nil, err
+		}
+		switch cs.GetByName("BidSize").(type) {
+		case []float32:
+			q.sizeType = io.FLOAT32
+		case []int32:
+			q.sizeType = io.INT32
+		}
+	}
+
+	epoch := cs.GetEpoch()
+	nanos, _ := cs.GetByName("Nanoseconds").([]int32)
+	order := make([]int, len(epoch))
+	for i := range order {
+		order[i] = i
+	}
+	if nanos != nil {
+		sort.SliceStable(order, func(a, b int) bool {
+			i, j := order[a], order[b]
+			return epoch[i] < epoch[j] || epoch[i] == epoch[j] && nanos[i] < nanos[j]
+		})
+	} else {
+		sort.SliceStable(order, func(a, b int) bool { return epoch[order[a]] < epoch[order[b]] })
+	}
+	for _, i := range order {
+		if epoch[i] < start.Unix() || epoch[i] >= end.Unix() || bid[i] <= 0 || ask[i] <= 0 || ask[i] < bid[i] {
+			continue
+		}
+		q.epoch = append(q.epoch, epoch[i])
+		q.bid = append(q.bid, bid[i])
+		q.ask = append(q.ask, ask[i])
+		if q.sizes {
+			q.bidSize = append(q.bidSize, bidSize[i])
+			q.askSize = append(q.askSize, askSize[i])
+		}
+	}
+	return q, nil
+}
+
+// sample returns the last quote of each interval of the timeframe with
+// quotes, with its midpoint and spread
+func (q *quotes) sample(timeframe time.Duration) *io.ColumnSeries {
+	secs := int64(timeframe / time.Second)
+	// index of the last quote of each interval
+	var (
+		epoch []int64
+		last  []int
+	)
+	for i := range q.epoch {
+		sampleEpoch := q.epoch[i] - q.epoch[i]%secs
+		if n := len(epoch); n > 0 && epoch[n-1] == sampleEpoch {
+			last[n-1] = i
+			continue
+		}
+		epoch = append(epoch, sampleEpoch)
+		last = append(last, i)
+	}
+
+	bid := make([]float64, len(last))
+	ask := make([]float64, len(last))
+	mid := make([]float64, len(last))
+	spread := make([]float64, len(last))
+	bidSize := make([]float64, len(last))
+	askSize := make([]float64, len(last))
+	for k, i := range last {
+		bid[k], ask[k] = q.bid[i], q.ask[i]
+		mid[k] = (q.bid[i] + q.ask[i]) / 2
+		spread[k] = q.ask[i] - q.bid[i]
+		if q.sizes {
+			bidSize[k], askSize[k] = q.bidSize[i], q.askSize[i]
+		}
+	}
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("BidPrice", convert(bid, q.priceType))
+	cs.AddColumn("AskPrice", convert(ask, q.priceType))
+	if q.sizes {
+		cs.AddColumn("BidSize", convert(bidSize, q.sizeType))
+		cs.AddColumn("AskSize", convert(askSize, q.sizeType))
+	}
+	cs.AddColumn("Mid", mid)
+	cs.AddColumn("Spread", spread)
+	return cs
+}
+
+// convert returns the values as a column of the element type
+func convert(values []float64, typ io.EnumElementType) interface{} {
+	switch typ {
+	case io.FLOAT32:
+		out := make([]float32, len(values))
+		for i, v := range values {
+			out[i] = float32(v)
+		}
+		return out
+	case io.INT32:
+		out := make([]int32, len(values))
+		for i, v := range values {
+			out[i] = int32(v)
+		}
+		return out
+	}
+	return values
+}
+
+// read returns the quotes of the bucket in [start, end)
+func read(tbk *io.TimeBucketKey, start, end time.Time) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	// TODO: subtracting 1 second is not needed once we support "<" operator
+	q.SetRange(start.Unix(), end.Add(-time.Second).Unix())
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	return csm[*tbk], nil
+}
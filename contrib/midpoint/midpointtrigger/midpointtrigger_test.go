@@ -0,0 +1,122 @@
+package midpointtrigger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	ret, err := NewTrigger(getConfig(`{}`))
+	c.Assert(err, IsNil)
+	trig := ret.(*MidpointTrigger)
+	c.Assert(trig.destinations, HasLen, 1)
+	c.Assert(trig.destinations[0].String, Equals, "1Sec")
+	c.Assert(trig.group, Equals, "NBBO")
+
+	ret, err = NewTrigger(getConfig(`{"destinations": ["1Sec", "1Min"], "attribute_group": "MID"}`))
+	c.Assert(err, IsNil)
+	trig = ret.(*MidpointTrigger)
+	c.Assert(trig.span, Equals, time.Minute)
+	c.Assert(trig.group, Equals, "MID")
+
+	for _, config := range []string{
+		`{"destinations": ["1Fortnight"]}`,
+		`{"destinations": ["7Min"]}`,
+		`{"destinations": ["1D"]}`,
+	} {
+		ret, err = NewTrigger(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(getConfig(`{"destinations": ["1Sec", "1Min"]}`))
+	c.Assert(err, IsNil)
+
+	base := time.Date(2017, 12, 14, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+	times := []time.Time{
+		at(100 * time.Millisecond),
+		at(500 * time.Millisecond),
+		// crossed, left out
+		at(700 * time.Millisecond),
+		at(1200 * time.Millisecond),
+	}
+	epoch := make([]int64, len(times))
+	nanos := make([]int32, len(times))
+	for i, ts := range times {
+		epoch[i] = ts.Unix()
+		nanos[i] = int32(ts.Nanosecond())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("BidPrice", []float32{10., 10.5, 11., 10.})
+	cs.AddColumn("AskPrice", []float32{10.5, 11., 10.5, 10.25})
+	cs.AddColumn("BidSize", []int32{1, 2, 3, 4})
+	cs.AddColumn("AskSize", []int32{5, 6, 7, 8})
+	cs.AddColumn("Nanoseconds", nanos)
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/QUOTE"), cs)
+	c.Assert(executor.WriteCSM(csm, true), IsNil)
+
+	buf, _ := io.Serialize(nil, io.TimeToIndex(base, time.Minute))
+	trig.Fire("TEST/1Min/QUOTE/2017.bin", []trigger.Record{trigger.Record(buf)})
+
+	secCs := readSamples(c, "TEST/1Sec/NBBO")
+	c.Assert(secCs.GetEpoch(), DeepEquals, []int64{base.Unix(), at(time.Second).Unix()})
+	c.Assert(secCs.GetByName("BidPrice"), DeepEquals, []float32{10.5, 10.})
+	c.Assert(secCs.GetByName("AskPrice"), DeepEquals, []float32{11., 10.25})
+	c.Assert(secCs.GetByName("BidSize"), DeepEquals, []int32{2, 4})
+	c.Assert(secCs.GetByName("AskSize"), DeepEquals, []int32{6, 8})
+	c.Assert(secCs.GetByName("Mid"), DeepEquals, []float64{10.75, 10.125})
+	c.Assert(secCs.GetByName("Spread"), DeepEquals, []float64{.5, .25})
+
+	minCs := readSamples(c, "TEST/1Min/NBBO")
+	c.Assert(minCs.GetEpoch(), DeepEquals, []int64{base.Unix()})
+	c.Assert(minCs.GetByName("Mid"), DeepEquals, []float64{10.125})
+}
+
+func readSamples(c *C, key string) *io.ColumnSeries {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	tbk := io.NewTimeBucketKey(key)
+	q.AddTargetKey(tbk)
+	q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+	parsed, err := q.Parse()
+	c.Assert(err, IsNil)
+	scanner, err := executor.NewReader(parsed)
+	c.Assert(err, IsNil)
+	csm, err := scanner.Read()
+	c.Assert(err, IsNil)
+	c.Assert(csm[*tbk], NotNil)
+	return csm[*tbk]
+}
@@ -0,0 +1,20 @@
+// This is a shim package for buiding a plugin module wrapping
+// the importable natstrigger package.  For more details, see natstrigger.
+package main
+
+import (
+	"github.com/alpacahq/marketstore/contrib/nats/natstrigger"
+	"github.com/alpacahq/marketstore/plugins/abi"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+)
+
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
+// NewTrigger returns a new NATS trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	return natstrigger.NewTrigger(conf)
+}
+
+func main() {
+}
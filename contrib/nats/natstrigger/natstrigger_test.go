@@ -0,0 +1,118 @@
+package natstrigger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	msgpack "github.com/vmihailenco/msgpack"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+type message struct {
+	subject string
+	data    []byte
+}
+
+type fakePublisher struct {
+	messages []message
+}
+
+func (p *fakePublisher) Publish(subject string, data []byte) error {
+	p.messages = append(p.messages, message{subject, data})
+	return nil
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	trig, err := newTrigger(&NatsTriggerConfig{})
+	c.Assert(err, IsNil)
+	c.Assert(trig.prefix, Equals, "marketstore")
+
+	for _, config := range []NatsTriggerConfig{
+		{SubjectPrefix: "market.*"},
+		{Encoding: "avro"},
+	} {
+		trig, err = newTrigger(&config)
+		c.Assert(trig, IsNil)
+		c.Assert(err, NotNil)
+	}
+}
+
+func (t *TestSuite) TestSubject(c *C) {
+	c.Assert(Subject("marketstore", io.NewTimeBucketKey("AAPL/1Min/OHLCV")), Equals, "marketstore.AAPL.1Min.OHLCV")
+	c.Assert(Subject("md.us", io.NewTimeBucketKey("BRK.B/1D/OHLCV")), Equals, "md.us.BRK_B.1D.OHLCV")
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	var epoch []int64
+	for i := 0; i < 3; i++ {
+		epoch = append(epoch, time.Date(2017, 12, 14, 10, i, 0, 0, time.UTC).Unix())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Close", []float32{1., 2., 3.})
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLCV")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	// fired with the first and last records, the one between them being
+	// left out
+	index := func(epoch int64) trigger.Record {
+		buf, _ := io.Serialize(nil, io.TimeToIndex(time.Unix(epoch, 0), time.Minute))
+		return trigger.Record(buf)
+	}
+	records := []trigger.Record{index(epoch[0]), index(epoch[2])}
+
+	trig, err := newTrigger(&NatsTriggerConfig{})
+	c.Assert(err, IsNil)
+	p := &fakePublisher{}
+	trig.conn = p
+	trig.Fire("TEST/1Min/OHLCV/2017.bin", records)
+
+	c.Assert(p.messages, HasLen, 2)
+	c.Assert(p.messages[0].subject, Equals, "marketstore.TEST.1Min.OHLCV")
+	var payload struct {
+		Key  string                 `msgpack:"key"`
+		Data map[string]interface{} `msgpack:"data"`
+	}
+	c.Assert(msgpack.Unmarshal(p.messages[1].data, &payload), IsNil)
+	c.Assert(payload.Key, Equals, "TEST/1Min/OHLCV")
+	c.Assert(payload.Data["Epoch"], Equals, epoch[2])
+	c.Assert(payload.Data["Close"], Equals, float32(3.))
+
+	trig, err = newTrigger(&NatsTriggerConfig{Encoding: "json"})
+	c.Assert(err, IsNil)
+	p = &fakePublisher{}
+	trig.conn = p
+	trig.Fire("TEST/1Min/OHLCV/2017.bin", records[:1])
+
+	c.Assert(p.messages, HasLen, 1)
+	var jsonPayload struct {
+		Key  string             `json:"key"`
+		Data map[string]float64 `json:"data"`
+	}
+	c.Assert(json.Unmarshal(p.messages[0].data, &jsonPayload), IsNil)
+	c.Assert(jsonPayload.Data["Epoch"], Equals, float64(epoch[0]))
+	c.Assert(jsonPayload.Data["Close"], Equals, 1.)
+}
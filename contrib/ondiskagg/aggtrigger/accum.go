@@ -1,12 +1,49 @@
 package aggtrigger
 
 import (
-	"fmt"
+	"reflect"
 
 	"github.com/alpacahq/marketstore/contrib/ondiskagg/aggtrigger/functions"
+	"github.com/alpacahq/marketstore/uda"
 	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
 )
 
+// defaultFuncs aggregates the columns of bars which are not configured
+var defaultFuncs = map[string]string{
+	"Open":   "first",
+	"High":   "max",
+	"Low":    "min",
+	"Close":  "last",
+	"Volume": "sum",
+}
+
+// builtinFuncs are the aggregation functions of any numeric column, mean
+// returning float64 for integer columns
+var builtinFuncs = map[string]struct{}{
+	"first": {}, "last": {}, "min": {}, "max": {}, "sum": {}, "mean": {},
+}
+
+// customFuncs are the registered aggregation functions by name
+var customFuncs = map[string]func([]float64) float64{}
+
+// RegisterFunction makes a custom aggregation function available to the
+// columns configuration under the given name.  The values of the column are
+// converted to float64 for it, and so is its output column.  Functions must
+// be registered before the trigger is created, e.g. from the init function
+// of a package built into the ondiskagg module or imported by a backfiller.
+func RegisterFunction(name string, fn func([]float64) float64) {
+	customFuncs[name] = fn
+}
+
+func validFunction(funcName string) bool {
+	if _, ok := builtinFuncs[funcName]; ok {
+		return true
+	}
+	_, ok := customFuncs[funcName]
+	return ok
+}
+
 type accumParam struct {
 	inputName, funcName, outputName string
 }
@@ -20,17 +57,27 @@ type accumulator struct {
 	ivalues interface{} // input column(s)
 	iout    interface{} // output slice
 	ifunc   interface{} // function
+	valid   []bool      // validity of the input, nil if none missing
+	ovalid  []bool      // validity of the output, with an input one
+	scale   *int        // scale of a decimal output
 }
 
 func newAccumGroup(cs *io.ColumnSeries, params []accumParam) *accumGroup {
 	accumulators := []*accumulator{}
+	applied := []accumParam{}
 	for _, param := range params {
 		accumulator := newAccumulator(cs, param)
+		if accumulator == nil {
+			log.Error("cannot aggregate column %s of type %T with %s\n",
+				param.inputName, cs.GetColumn(param.inputName), param.funcName)
+			continue
+		}
 		accumulators = append(accumulators, accumulator)
+		applied = append(applied, param)
 	}
 	return &accumGroup{
 		accumulators: accumulators,
-		params:       params,
+		params:       applied,
 	}
 }
 
@@ -42,12 +89,22 @@ func (ag *accumGroup) apply(start, end int) {
 
 func (ag *accumGroup) addColumns(cs *io.ColumnSeries) {
 	for i, param := range ag.params {
-		cs.AddColumn(param.outputName, ag.accumulators[i].iout)
+		name := cs.AddColumn(param.outputName, ag.accumulators[i].iout)
+		for _, present := range ag.accumulators[i].ovalid {
+			if !present {
+				cs.SetValidity(name, ag.accumulators[i].ovalid)
+				break
+			}
+		}
+		if scale := ag.accumulators[i].scale; scale != nil {
+			cs.SetScale(name, *scale)
+		}
 	}
 }
 
 func newAccumulator(cs *io.ColumnSeries, param accumParam) *accumulator {
 	var ifunc, iout interface{}
+	ivalues := cs.GetColumn(param.inputName)
 	switch param.funcName {
 	case "first":
 		inColumn := cs.GetColumn(param.inputName)
@@ -89,7 +146,6 @@ func newAccumulator(cs *io.ColumnSeries, param accumParam) *accumulator {
 			ifunc = functions.FirstUint64
 			iout = make([]uint64, 0)
 		default:
-			fmt.Printf("no compatible function\n")
 			return nil
 		}
 	case "max":
@@ -132,7 +188,6 @@ func newAccumulator(cs *io.ColumnSeries, param accumParam) *accumulator {
 			ifunc = functions.MaxUint64
 			iout = make([]uint64, 0)
 		default:
-			fmt.Printf("no compatible function\n")
 			return nil
 		}
 	case "min":
@@ -175,7 +230,6 @@ func newAccumulator(cs *io.ColumnSeries, param accumParam) *accumulator {
 			ifunc = functions.MinUint64
 			iout = make([]uint64, 0)
 		default:
-			fmt.Printf("no compatible function\n")
 			return nil
 		}
 	case "last":
@@ -218,7 +272,6 @@ func newAccumulator(cs *io.ColumnSeries, param accumParam) *accumulator {
 			ifunc = functions.LastUint64
 			iout = make([]uint64, 0)
 		default:
-			fmt.Printf("no compatible function\n")
 			return nil
 		}
 	case "sum":
@@ -261,65 +314,112 @@ func newAccumulator(cs *io.ColumnSeries, param accumParam) *accumulator {
 			ifunc = functions.SumUint64
 			iout = make([]uint64, 0)
 		default:
-			fmt.Printf("no compatible function\n")
+			return nil
+		}
+	case "mean":
+		inColumn := cs.GetColumn(param.inputName)
+		switch inColumn.(type) {
+		case []float32:
+			ifunc = functions.MeanFloat32
+			iout = make([]float32, 0)
+		case []float64, []int, []int32, []int64:
+			ivalues, _ = uda.ColumnToFloat64(cs, param.inputName)
+			ifunc = functions.MeanFloat64
+			iout = make([]float64, 0)
+		default:
+			return nil
+		}
+	default:
+		fn, ok := customFuncs[param.funcName]
+		if !ok {
+			return nil
+		}
+		switch cs.GetColumn(param.inputName).(type) {
+		case []float32, []float64, []int, []int32, []int64:
+			ivalues, _ = uda.ColumnToFloat64(cs, param.inputName)
+			ifunc = fn
+			iout = make([]float64, 0)
+		default:
 			return nil
 		}
 	}
-	return &accumulator{
+	accumulator := &accumulator{
 		iout:    iout,
 		ifunc:   ifunc,
-		ivalues: cs.GetColumn(param.inputName),
+		ivalues: ivalues,
+		valid:   cs.GetValidity(param.inputName),
+	}
+	// the decimals of the other functions are converted to floats
+	if scale, ok := cs.GetScale(param.inputName); ok {
+		switch param.funcName {
+		case "first", "last", "min", "max", "sum":
+			accumulator.scale = &scale
+		}
 	}
+	return accumulator
 }
 
+// presentValues returns the values of the window which are not missing
+func presentValues(ivalues interface{}, valid []bool, start, end int) interface{} {
+	values := reflect.ValueOf(ivalues)
+	present := reflect.MakeSlice(values.Type(), 0, end-start)
+	for i := start; i < end; i++ {
+		if valid[i] {
+			present = reflect.Append(present, values.Index(i))
+		}
+	}
+	return present.Interface()
+}
+
+// apply appends the aggregate of the values of the window to the output,
+// skipping the missing ones, and missing if all are
 func (ac *accumulator) apply(start, end int) {
+	ivalues := ac.ivalues
+	if ac.valid != nil {
+		ivalues = presentValues(ac.ivalues, ac.valid, start, end)
+		start, end = 0, reflect.ValueOf(ivalues).Len()
+		ac.ovalid = append(ac.ovalid, end > 0)
+		if end == 0 {
+			out := reflect.ValueOf(ac.iout)
+			ac.iout = reflect.Append(out, reflect.Zero(out.Type().Elem())).Interface()
+			return
+		}
+	}
 	switch fn := ac.ifunc.(type) {
 	case func([]float32) float32:
-		ivalues := ac.ivalues
 		out := ac.iout.([]float32)
 		ac.iout = append(out, fn(ivalues.([]float32)[start:end]))
 	case func([]float64) float64:
-		ivalues := ac.ivalues
 		out := ac.iout.([]float64)
 		ac.iout = append(out, fn(ivalues.([]float64)[start:end]))
 	case func([]int8) int8:
-		ivalues := ac.ivalues
 		out := ac.iout.([]int8)
 		ac.iout = append(out, fn(ivalues.([]int8)[start:end]))
 	case func([]int16) int16:
-		ivalues := ac.ivalues
 		out := ac.iout.([]int16)
 		ac.iout = append(out, fn(ivalues.([]int16)[start:end]))
 	case func([]int) int:
-		ivalues := ac.ivalues
 		out := ac.iout.([]int)
 		ac.iout = append(out, fn(ivalues.([]int)[start:end]))
 	case func([]int32) int32:
-		ivalues := ac.ivalues
 		out := ac.iout.([]int32)
 		ac.iout = append(out, fn(ivalues.([]int32)[start:end]))
 	case func([]int64) int64:
-		ivalues := ac.ivalues
 		out := ac.iout.([]int64)
 		ac.iout = append(out, fn(ivalues.([]int64)[start:end]))
 	case func([]uint8) uint8:
-		ivalues := ac.ivalues
 		out := ac.iout.([]uint8)
 		ac.iout = append(out, fn(ivalues.([]uint8)[start:end]))
 	case func([]uint16) uint16:
-		ivalues := ac.ivalues
 		out := ac.iout.([]uint16)
 		ac.iout = append(out, fn(ivalues.([]uint16)[start:end]))
 	case func([]uint) uint:
-		ivalues := ac.ivalues
 		out := ac.iout.([]uint)
 		ac.iout = append(out, fn(ivalues.([]uint)[start:end]))
 	case func([]uint32) uint32:
-		ivalues := ac.ivalues
 		out := ac.iout.([]uint32)
 		ac.iout = append(out, fn(ivalues.([]uint32)[start:end]))
 	case func([]uint64) uint64:
-		ivalues := ac.ivalues
 		out := ac.iout.([]uint64)
 		ac.iout = append(out, fn(ivalues.([]uint64)[start:end]))
 	default:
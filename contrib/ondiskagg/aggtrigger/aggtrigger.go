@@ -6,6 +6,10 @@
 // - Close:float32 or float64
 // optionally,
 // - Volume:one of float32, float64, or int32
+// - VWAP:one of float32, float64
+// - TradeCount:any integer type
+// and the columns configured with an aggregation function, so that any
+// bucket of numeric columns may be aggregated.
 //
 // Example:
 // 	triggers:
@@ -17,10 +21,23 @@
 // 	        - 5Min
 // 	        - 15Min
 // 	        - 1H
-// 	        - 1D
+// 	        - timeframe: 1D
+// 	          vwap: true
+// 	          trade_count: true
+// 	      columns:
+// 	        Spread: mean
 //
-// destinations are downsample target time windows.  Optionally, if filter
-// is set to "nasdaq", it filters the scan data by NASDAQ market hours.
+// destinations are downsample target time windows, which may also compute
+// the VWAP and the trade count of each bar.  columns maps the other source
+// columns to aggregate to their aggregation function.  If adjust is set to
+// split, or all for the dividends too, the records of each bar are adjusted
+// for the corporate actions of the symbol within it.  If calendar is set,
+// the 1D and 1W bars are made of the sessions of the market calendar.  The
+// bars of a destination with an anchor start at the time of the day of the
+// anchor rather than at midnight.  The ticks of a variable length source,
+// such as trades, are aggregated as bars from their price and size columns
+// into the OHLCV attribute group.  Optionally, if filter is set
+// to "nasdaq", it filters the scan data by NASDAQ market hours.
 package aggtrigger
 
 import (
@@ -33,9 +50,12 @@ import (
 	"time"
 
 	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/contrib/ondiskagg/aggtrigger/functions"
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/executor/corpaction"
 	"github.com/alpacahq/marketstore/planner"
 	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/uda"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
@@ -44,22 +64,96 @@ import (
 // AggTriggerConfig is the configuration for OnDiskAggTrigger you can define in
 // marketstore's config file under triggers extension.
 type AggTriggerConfig struct {
-	Destinations []string `json:"destinations"`
-	Filter       string   `json:"filter"`
+	Destinations []DestinationConfig `json:"destinations"`
+	Filter       string              `json:"filter"`
+	// Aggregation functions by source column for every destination, see
+	// DestinationConfig
+	Columns map[string]string `json:"columns"`
+	// Market calendar of every destination, see DestinationConfig
+	Calendar string `json:"calendar"`
+	// Recompute on startup the aggregates of the records written while the
+	// trigger was not running, true if omitted
+	CatchUp *bool `json:"catch_up"`
+	// Attribute group of the destinations, that of the source if omitted, or
+	// OHLCV if the source has variable length records
+	AttributeGroup string `json:"attribute_group"`
+	// Price and size columns of the ticks of a variable length source,
+	// aggregated as OHLC and Volume, Price and Size if omitted
+	Price string `json:"price"`
+	Size  string `json:"size"`
+	// Adjust the records of a bar for the corporate actions of the symbol
+	// whose ex-date is within the bar, for it to be in the terms of its end
+	// rather than mixing the prices before and after a split: split, or all
+	// for the dividends too
+	Adjust string `json:"adjust"`
+}
+
+// DestinationConfig is a downsample target time window, given either as its
+// timeframe alone, or as an object with the columns to add to OHLCV.
+type DestinationConfig struct {
+	Timeframe string `json:"timeframe"`
+	// Add the volume weighted average price of the bar, from the VWAP and
+	// Volume columns of the source, or from its typical price
+	// (High+Low+Close)/3 if it has no VWAP column
+	VWAP bool `json:"vwap"`
+	// Add the number of trades of the bar, the sum of the TradeCount column
+	// of the source, or its number of records if it has none
+	TradeCount bool `json:"trade_count"`
+	// Aggregation functions by source column, replacing those of the trigger
+	// config.  The functions are first, last, min, max, sum, mean and the
+	// registered ones, and OHLCV are aggregated as bars unless configured.
+	Columns map[string]string `json:"columns"`
+	// Market calendar, replacing that of the trigger config, to which the
+	// 1D and 1W bars are aligned: either nasdaq or the path of a calendar
+	// JSON file.  The bars are then made of the records within the sessions
+	// of the calendar, holidays and early closes included, on the day of the
+	// session in its timezone or on the Monday of the week for 1W, and are
+	// written at midnight of that day in the timezone of the server.
+	Calendar string `json:"calendar"`
+	// Start of the bars, as the time of the day they start at, such as "09:30"
+	// for 4H bars starting at 09:30, 13:30 and so on until 09:30 of the next
+	// day, and for 1W the weekday, such as "Monday" or "Monday 09:30".  The
+	// anchor is in the timezone of the calendar if set, of the server
+	// otherwise, and the bars are written in the bucket slot of their start.
+	Anchor string `json:"anchor"`
+
+	cal      *calendar.Calendar
+	anchored *anchoredWindow
+}
+
+// UnmarshalJSON accepts a destination given as a timeframe string
+func (dc *DestinationConfig) UnmarshalJSON(data []byte) error {
+	var timeframe string
+	if err := json.Unmarshal(data, &timeframe); err == nil {
+		*dc = DestinationConfig{Timeframe: timeframe}
+		return nil
+	}
+	type destinationConfig DestinationConfig
+	return json.Unmarshal(data, (*destinationConfig)(dc))
 }
 
 // OnDiskAggTrigger is the main trigger.
 type OnDiskAggTrigger struct {
 	config       map[string]interface{}
 	destinations timeframes
+	// configuration of each destination by timeframe
+	options map[string]DestinationConfig
 	// filter by market hours if this is "nasdaq"
 	filter   string
 	aggCache *sync.Map
+	// reconcile the destinations on startup
+	catchUp bool
+	// attribute group of the destinations if configured
+	group string
+	// price and size columns of the ticks
+	price, size string
+	// adjustment of the records for the corporate actions within a bar
+	adjust corpaction.Mode
 }
 
 var (
-	_         trigger.Trigger = &OnDiskAggTrigger{}
-	loadError                 = errors.New("plugin load error")
+	_         trigger.CheckedTrigger = &OnDiskAggTrigger{}
+	loadError                        = errors.New("plugin load error")
 )
 
 func recast(config map[string]interface{}) *AggTriggerConfig {
@@ -87,21 +181,75 @@ func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
 	}
 
 	var tfs timeframes
+	options := map[string]DestinationConfig{}
+	calendars := map[string]*calendar.Calendar{}
 
 	for _, dest := range config.Destinations {
-		tf := utils.TimeframeFromString(dest)
+		tf := utils.TimeframeFromString(dest.Timeframe)
 		if tf == nil {
-			log.Fatal("invalid destination: %s", dest)
+			log.Fatal("invalid destination: %s", dest.Timeframe)
+		}
+		if dest.Columns == nil {
+			dest.Columns = config.Columns
+		}
+		if dest.Calendar == "" {
+			dest.Calendar = config.Calendar
+		}
+		if dest.Calendar != "" {
+			if calendars[dest.Calendar] == nil {
+				cal, err := loadCalendar(dest.Calendar)
+				if err != nil {
+					log.Error("%v\n", err)
+					return nil, loadError
+				}
+				calendars[dest.Calendar] = cal
+			}
+			dest.cal = calendars[dest.Calendar]
+		}
+		if dest.Anchor != "" {
+			if err := dest.setAnchor(); err != nil {
+				log.Error("invalid anchor of destination %s (%v)\n", dest.Timeframe, err)
+				return nil, loadError
+			}
+		}
+		for name, funcName := range dest.Columns {
+			if !validFunction(funcName) {
+				log.Error("unknown aggregation function \"%s\" for column %s\n", funcName, name)
+				return nil, loadError
+			}
 		}
 		tfs = append(tfs, *tf)
+		options[tf.String] = dest
 	}
 
-	return &OnDiskAggTrigger{
+	var adjust corpaction.Mode
+	if config.Adjust != "" {
+		var err error
+		if adjust, err = corpaction.ParseMode(config.Adjust); err != nil {
+			log.Error("%v\n", err)
+			return nil, loadError
+		}
+	}
+
+	t := &OnDiskAggTrigger{
 		config:       conf,
 		destinations: tfs,
+		options:      options,
 		filter:       filter,
 		aggCache:     &sync.Map{},
-	}, nil
+		catchUp:      config.CatchUp == nil || *config.CatchUp,
+		group:        config.AttributeGroup,
+		price:        config.Price,
+		size:         config.Size,
+		adjust:       adjust,
+	}
+	if t.price == "" {
+		t.price = "Price"
+	}
+	if t.size == "" {
+		t.size = "Size"
+	}
+	return t, nil
 }
 func minInt64(values []int64) int64 {
 	min := values[0]
@@ -125,6 +273,14 @@ func maxInt64(values []int64) int64 {
 
 // Fire implements trigger interface.
 func (s *OnDiskAggTrigger) Fire(keyPath string, records []trigger.Record) {
+	if err := s.TryFire(keyPath, records); err != nil {
+		log.Error("%v\n", err)
+	}
+}
+
+// TryFire implements trigger.CheckedTrigger, so that the failed writes of
+// the aggregates are retried and dead-lettered.
+func (s *OnDiskAggTrigger) TryFire(keyPath string, records []trigger.Record) error {
 	elements := strings.Split(keyPath, "/")
 	tf := utils.NewTimeframe(elements[1])
 	fileName := elements[len(elements)-1]
@@ -141,8 +297,14 @@ func (s *OnDiskAggTrigger) Fire(keyPath string, records []trigger.Record) {
 		tf.Duration,
 		int16(year))
 
+	// the bars are made in the timezone of the source bucket
+	loc := executor.BucketTimezone(*tbk)
+	head, tail = head.In(loc), tail.In(loc)
+
 	// query the upper bound since it will contain the most candles
-	window := utils.CandleDurationFromString(s.destinations.UpperBound().String)
+	upper := s.destinations.UpperBound().String
+	opts := s.options[upper]
+	window := opts.window(upper)
 
 	// check if we have a valid cache, if not, re-query
 	if v, ok := s.aggCache.Load(tbk.String()); ok {
@@ -160,46 +322,57 @@ func (s *OnDiskAggTrigger) Fire(keyPath string, records []trigger.Record) {
 			c.cs.GetCandleAttributes(),
 			tf.Duration, int16(year), records)
 
-		cs = io.ColumnSeriesUnion(cs, &c.cs)
+		// the records just written replace the cached ones at the same
+		// time, rewritten out of order
+		cs, err := io.ColumnSeriesMerge(cs, &c.cs, io.PreferLeft)
+		if err != nil {
+			log.Debug("invalidating cache for: %v (%v)\n", tbk.String(), err)
+			s.aggCache.Delete(tbk.String())
 
-		s.write(tbk, cs, tail, head, elements)
+			goto Query
+		}
 
-		return
+		return s.write(tbk, cs, tail, head, elements)
 	}
 
 Query:
 	csm, err := s.query(tbk, window, head, tail)
 	if err != nil || csm == nil {
-		log.Error("query error for %v (%v)\n", tbk.String(), err)
-		return
+		return fmt.Errorf("query error for %v (%v)", tbk.String(), err)
 	}
 
 	cs := (*csm)[*tbk]
 
 	if cs != nil {
-		s.write(tbk, cs, tail, head, elements)
+		return s.write(tbk, cs, tail, head, elements)
 	}
 
-	return
+	return nil
 }
 
 func (s *OnDiskAggTrigger) write(
 	tbk *io.TimeBucketKey,
 	cs *io.ColumnSeries,
 	tail, head time.Time,
-	elements []string) {
+	elements []string) error {
 
+	variable := isVariable(cs)
+	if variable {
+		cs = s.fromTicks(cs)
+	}
+	cs.SetLocation(head.Location())
+	group := s.destinationGroup(elements[2], variable)
 	for _, dest := range s.destinations {
-		aggTbk := io.NewTimeBucketKeyFromString(elements[0] + "/" + dest.String + "/" + elements[2])
+		aggTbk := io.NewTimeBucketKeyFromString(elements[0] + "/" + dest.String + "/" + group)
 
 		if err := s.writeAggregates(aggTbk, tbk, *cs, dest, head, tail); err != nil {
-			log.Error(
-				"failed to write %v aggregates (%v)\n",
+			return fmt.Errorf(
+				"failed to write %v aggregates (%v)",
 				tbk.String(),
 				err)
-			return
 		}
 	}
+	return nil
 }
 
 type cachedAgg struct {
@@ -219,7 +392,8 @@ func (s *OnDiskAggTrigger) writeAggregates(
 
 	csm := io.NewColumnSeriesMap()
 
-	window := utils.CandleDurationFromString(dest.String)
+	opts := s.options[dest.String]
+	window := opts.window(dest.String)
 	start := window.Truncate(head).Unix()
 	end := window.Ceil(tail).Add(-time.Second).Unix()
 
@@ -232,19 +406,10 @@ func (s *OnDiskAggTrigger) writeAggregates(
 		return nil
 	}
 
-	// decide whether to apply market-hour filter
-	applyingFilter := false
-	if s.filter == "nasdaq" && window.Duration() >= utils.Day {
-		calendarTz := calendar.Nasdaq.Tz()
-		if utils.InstanceConfig.Timezone.String() != calendarTz.String() {
-			log.Warn("misconfiguration... system must be configure in %s\n", calendarTz)
-		} else {
-			applyingFilter = true
-		}
-	}
-
-	// store when writing for upper bound
-	if dest.Duration == s.destinations.UpperBound().Duration {
+	// store when writing for upper bound, the ticks of a variable length
+	// source being read back on every write as they can not be decoded
+	// from the records
+	if dest.Duration == s.destinations.UpperBound().Duration && !isVariable(&cs) {
 		defer func() {
 			t := window.Truncate(tail)
 			tEpoch := t.Unix()
@@ -260,38 +425,112 @@ func (s *OnDiskAggTrigger) writeAggregates(
 		}()
 	}
 
+	if bars := s.bars(aggTbk, &slc, dest); bars != nil {
+		csm.AddColumnSeries(*aggTbk, bars)
+	}
+
+	return executor.WriteCSM(csm, false)
+}
+
+// bars returns the bars of the destination of the records, filtered by the
+// market hours if configured, or nil if none of them is within them
+func (s *OnDiskAggTrigger) bars(aggTbk *io.TimeBucketKey, cs *io.ColumnSeries, dest utils.Timeframe) *io.ColumnSeries {
+	opts := s.options[dest.String]
+	window := opts.window(dest.String)
+
+	// decide which market-hour filter to apply
+	var marketOpen func(epoch int64) bool
+	if sw, ok := window.(*sessionWindow); ok {
+		marketOpen = sw.cal.EpochIsMarketOpen
+	} else if s.filter == "nasdaq" && dest.Duration >= utils.Day {
+		calendarTz := calendar.Nasdaq.Tz()
+		if utils.InstanceConfig.Timezone.String() != calendarTz.String() {
+			log.Warn("misconfiguration... system must be configure in %s\n", calendarTz)
+		} else {
+			marketOpen = calendar.Nasdaq.EpochIsMarketOpen
+		}
+	}
+
 	// apply the filter
-	if applyingFilter {
-		tqSlc := slc.ApplyTimeQual(calendar.Nasdaq.EpochIsMarketOpen)
+	if marketOpen != nil {
+		cs = cs.ApplyTimeQual(marketOpen)
 
 		// normally this will always be true, but when there are random bars
 		// on the weekend, it won't be, so checking to avoid panic
-		if len(tqSlc.GetEpoch()) > 0 {
-			csm.AddColumnSeries(*aggTbk, aggregate(tqSlc, aggTbk))
+		if len(cs.GetEpoch()) == 0 {
+			return nil
+		}
+	}
+	if s.adjust != "" {
+		adjusted, err := adjustBars(cs, aggTbk.GetItemInCategory("Symbol"), window, s.adjust)
+		if err != nil {
+			log.Error("failed to adjust the records of %s (%v)\n", aggTbk.String(), err)
+		} else {
+			cs = adjusted
 		}
-	} else {
-		csm.AddColumnSeries(*aggTbk, aggregate(&slc, aggTbk))
 	}
+	return aggregate(cs, aggTbk, opts)
+}
 
-	return executor.WriteCSM(csm, false)
+// adjustBars returns a copy of the records adjusted for the corporate
+// actions of the symbol within the bar of each record
+func adjustBars(cs *io.ColumnSeries, symbol string, window aggWindow, mode corpaction.Mode) (*io.ColumnSeries, error) {
+	store, err := corpaction.Instance()
+	if err != nil {
+		return nil, err
+	}
+	actions := store.Get(symbol)
+	if len(actions) == 0 {
+		return cs, nil
+	}
+	asOf := make([]int64, cs.Len())
+	for i, t := range cs.GetTime() {
+		asOf[i] = window.Ceil(t).Unix() - 1
+	}
+	// a copy of the columns, which Adjust replaces
+	adjusted, err := io.SliceColumnSeriesByEpoch(*cs, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &adjusted, corpaction.Adjust(&adjusted, actions, mode, asOf)
 }
 
-func aggregate(cs *io.ColumnSeries, tbk *io.TimeBucketKey) *io.ColumnSeries {
-	timeWindow := utils.CandleDurationFromString(tbk.GetItemInCategory("Timeframe"))
+func aggregate(cs *io.ColumnSeries, tbk *io.TimeBucketKey, opts DestinationConfig) *io.ColumnSeries {
+	timeWindow := opts.window(tbk.GetItemInCategory("Timeframe"))
 
-	params := []accumParam{
-		accumParam{"Open", "first", "Open"},
-		accumParam{"High", "max", "High"},
-		accumParam{"Low", "min", "Low"},
-		accumParam{"Close", "last", "Close"},
+	params := accumParams(cs, opts)
+	countTrades := opts.TradeCount && !cs.Exists("TradeCount")
+	accumGroup := newAccumGroup(cs, params)
+
+	// the VWAP is weighted by volume, so is left out without it
+	var prices, volumes []float64
+	if opts.VWAP && cs.Exists("Volume") && (cs.Exists("VWAP") || cs.Exists("High") && cs.Exists("Low") && cs.Exists("Close")) {
+		volumes, _ = uda.ColumnToFloat64(cs, "Volume")
+		if cs.Exists("VWAP") {
+			prices, _ = uda.ColumnToFloat64(cs, "VWAP")
+		} else {
+			prices = typicalPrices(cs)
+		}
 	}
-	if cs.Exists("Volume") {
-		params = append(params, accumParam{"Volume", "sum", "Volume"})
+
+	barEpoch := func(start time.Time) int64 { return start.Unix() }
+	if sw, ok := timeWindow.(*sessionWindow); ok {
+		barEpoch = func(start time.Time) int64 { return sw.epoch(start, cs.GetLocation()) }
 	}
-	accumGroup := newAccumGroup(cs, params)
 
 	ts := cs.GetTime()
 	outEpoch := make([]int64, 0)
+	outVWAP := make([]float64, 0)
+	outTradeCount := make([]int64, 0)
+	apply := func(start, end int) {
+		accumGroup.apply(start, end)
+		if volumes != nil {
+			outVWAP = append(outVWAP, functions.VWAP(prices[start:end], volumes[start:end]))
+		}
+		if countTrades {
+			outTradeCount = append(outTradeCount, int64(end-start))
+		}
+	}
 
 	groupKey := timeWindow.Truncate(ts[0])
 	groupStart := 0
@@ -300,26 +539,74 @@ func aggregate(cs *io.ColumnSeries, tbk *io.TimeBucketKey) *io.ColumnSeries {
 	for i, t := range ts {
 		if !timeWindow.IsWithin(t, groupKey) {
 			// Emit new row and re-init aggState
-			outEpoch = append(outEpoch, groupKey.Unix())
-			accumGroup.apply(groupStart, i)
+			outEpoch = append(outEpoch, barEpoch(groupKey))
+			apply(groupStart, i)
 			groupKey = timeWindow.Truncate(t)
 			groupStart = i
 		}
 	}
 	// accumulate any remaining values if not yet
-	outEpoch = append(outEpoch, groupKey.Unix())
-	accumGroup.apply(groupStart, len(ts))
+	outEpoch = append(outEpoch, barEpoch(groupKey))
+	apply(groupStart, len(ts))
 
 	// finalize output
 	outCs := io.NewColumnSeries()
 	outCs.AddColumn("Epoch", outEpoch)
 	accumGroup.addColumns(outCs)
+	if volumes != nil {
+		outCs.AddColumn("VWAP", outVWAP)
+	}
+	if countTrades {
+		outCs.AddColumn("TradeCount", outTradeCount)
+	}
 	return outCs
 }
 
+// accumParams returns how to aggregate each column of the source: OHLCV as
+// bars, then the other configured columns in the order of the source
+func accumParams(cs *io.ColumnSeries, opts DestinationConfig) (params []accumParam) {
+	funcs := map[string]string{}
+	for name, funcName := range opts.Columns {
+		funcs[name] = funcName
+	}
+	if opts.TradeCount {
+		funcs["TradeCount"] = "sum"
+	}
+	names := []string{"Open", "High", "Low", "Close", "Volume"}
+	for _, name := range cs.GetColumnNames() {
+		_, configured := funcs[name]
+		_, isDefault := defaultFuncs[name]
+		if configured && !isDefault {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		funcName, ok := funcs[name]
+		if !ok {
+			funcName = defaultFuncs[name]
+		}
+		if cs.Exists(name) {
+			params = append(params, accumParam{name, funcName, name})
+		}
+	}
+	return params
+}
+
+// typicalPrices returns the (High+Low+Close)/3 price of each record
+func typicalPrices(cs *io.ColumnSeries) []float64 {
+	high, _ := uda.ColumnToFloat64(cs, "High")
+	low, _ := uda.ColumnToFloat64(cs, "Low")
+	close, _ := uda.ColumnToFloat64(cs, "Close")
+	prices := make([]float64, len(high))
+	for i := range prices {
+		prices[i] = (high[i] + low[i] + close[i]) / 3
+	}
+	return prices
+}
+
 func (s *OnDiskAggTrigger) query(
 	tbk *io.TimeBucketKey,
-	window *utils.CandleDuration,
+	window aggWindow,
 	head, tail time.Time) (*io.ColumnSeriesMap, error) {
 
 	cDir := executor.ThisInstance.CatalogDir
@@ -10,6 +10,7 @@ import (
 	"github.com/alpacahq/marketstore/plugins/trigger"
 
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/executor/corpaction"
 	"github.com/alpacahq/marketstore/planner"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
@@ -38,6 +39,58 @@ func (t *TestSuite) TestNew(c *C) {
 	c.Assert(trig.filter, Equals, "")
 	c.Assert(err, IsNil)
 
+	// destinations with options
+	config = getConfig(`{
+        "destinations": ["5Min", {"timeframe": "1D", "vwap": true, "trade_count": true}]
+        }`)
+	ret, err = NewTrigger(config)
+	c.Assert(err, IsNil)
+	trig = ret.(*OnDiskAggTrigger)
+	c.Assert(len(trig.destinations), Equals, 2)
+	c.Assert(trig.options["5Min"], DeepEquals, DestinationConfig{Timeframe: "5Min"})
+	c.Assert(trig.options["1D"], DeepEquals, DestinationConfig{Timeframe: "1D", VWAP: true, TradeCount: true})
+
+	// aggregation functions of the columns
+	config = getConfig(`{
+        "destinations": ["5Min", {"timeframe": "1D", "columns": {"Spread": "max"}}],
+        "columns": {"Spread": "mean"}
+        }`)
+	ret, err = NewTrigger(config)
+	c.Assert(err, IsNil)
+	trig = ret.(*OnDiskAggTrigger)
+	c.Assert(trig.options["5Min"].Columns, DeepEquals, map[string]string{"Spread": "mean"})
+	c.Assert(trig.options["1D"].Columns, DeepEquals, map[string]string{"Spread": "max"})
+
+	// market calendar
+	config = getConfig(`{"destinations": ["5Min", "1D"], "calendar": "nasdaq"}`)
+	ret, err = NewTrigger(config)
+	c.Assert(err, IsNil)
+	trig = ret.(*OnDiskAggTrigger)
+	opts := trig.options["1D"]
+	c.Assert(opts.window("1D"), FitsTypeOf, &sessionWindow{})
+	opts = trig.options["5Min"]
+	c.Assert(opts.window("5Min"), FitsTypeOf, &utils.CandleDuration{})
+
+	// the overnight sessions of the CME are of the day of their close
+	config = getConfig(`{"destinations": ["1D"], "calendar": "cme"}`)
+	ret, err = NewTrigger(config)
+	c.Assert(err, IsNil)
+	opts = ret.(*OnDiskAggTrigger).options["1D"]
+	window := opts.window("1D")
+	chicago, _ := time.LoadLocation("America/Chicago")
+	c.Assert(window.Truncate(time.Date(2021, 8, 29, 18, 0, 0, 0, chicago)).Equal(time.Date(2021, 8, 30, 0, 0, 0, 0, chicago)), Equals, true)
+	c.Assert(window.Truncate(time.Date(2021, 8, 30, 15, 0, 0, 0, chicago)).Equal(time.Date(2021, 8, 30, 0, 0, 0, 0, chicago)), Equals, true)
+
+	config = getConfig(`{"destinations": ["1D"], "calendar": "/no/such/calendar.json"}`)
+	ret, err = NewTrigger(config)
+	c.Assert(ret, IsNil)
+	c.Assert(err, NotNil)
+
+	config = getConfig(`{"destinations": ["5Min"], "columns": {"Spread": "median"}}`)
+	ret, err = NewTrigger(config)
+	c.Assert(ret, IsNil)
+	c.Assert(err, NotNil)
+
 	// missing destinations
 	config = getConfig(`{}`)
 	ret, err = NewTrigger(config)
@@ -66,7 +119,7 @@ func (t *TestSuite) TestAgg(c *C) {
 	cs.AddColumn("Low", low)
 	cs.AddColumn("Close", close)
 
-	outCs := aggregate(cs, tbk)
+	outCs := aggregate(cs, tbk, DestinationConfig{})
 	c.Assert(outCs.Len(), Equals, 3)
 	c.Assert(outCs.GetColumn("Open").([]float32)[0], Equals, float32(1.))
 	c.Assert(outCs.GetColumn("High").([]float32)[1], Equals, float32(4.1))
@@ -91,12 +144,109 @@ func (t *TestSuite) TestAgg(c *C) {
 	cs.AddColumn("Low", low)
 	cs.AddColumn("Close", close)
 
-	outCs = aggregate(cs, tbk)
+	outCs = aggregate(cs, tbk, DestinationConfig{})
 	c.Assert(outCs.Len(), Equals, 2)
 	d1 := time.Date(2017, 12, 15, 0, 0, 0, 0, utils.InstanceConfig.Timezone)
 	d2 := time.Date(2017, 12, 16, 0, 0, 0, 0, utils.InstanceConfig.Timezone)
 	c.Assert(outCs.GetEpoch()[0], Equals, d1.Unix())
 	c.Assert(outCs.GetEpoch()[1], Equals, d2.Unix())
+
+	// in the timezone of the bucket
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	cs.SetLocation(tokyo)
+	outCs = aggregate(cs, tbk, DestinationConfig{})
+	c.Assert(outCs.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 12, 16, 0, 0, 0, 0, tokyo).Unix(),
+		time.Date(2017, 12, 17, 0, 0, 0, 0, tokyo).Unix(),
+	})
+}
+
+func (t *TestSuite) TestAggVWAP(c *C) {
+	epoch := []int64{
+		time.Date(2017, 12, 15, 10, 3, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 4, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 5, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 6, 0, 0, time.UTC).Unix(),
+	}
+	tbk := io.NewTimeBucketKey("TEST/5Min/OHLCV")
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", []float32{1., 2., 3., 4.})
+	cs.AddColumn("High", []float32{3., 4., 5., 6.})
+	cs.AddColumn("Low", []float32{0., 1., 2., 3.})
+	cs.AddColumn("Close", []float32{3., 4., 5., 6.})
+	cs.AddColumn("Volume", []int32{1, 3, 0, 0})
+	opts := DestinationConfig{VWAP: true, TradeCount: true}
+
+	// from the typical prices 2, 3, 4 and 5
+	outCs := aggregate(cs, tbk, opts)
+	c.Assert(outCs.Len(), Equals, 2)
+	c.Assert(outCs.GetColumn("VWAP").([]float64), DeepEquals, []float64{2.75, 4.5})
+	c.Assert(outCs.GetColumn("TradeCount").([]int64), DeepEquals, []int64{2, 2})
+
+	// from the VWAP and TradeCount of the source
+	cs.AddColumn("VWAP", []float64{2.5, 3.5, 4.5, 5.5})
+	cs.AddColumn("TradeCount", []int32{10, 20, 30, 40})
+	outCs = aggregate(cs, tbk, opts)
+	c.Assert(outCs.GetColumn("VWAP").([]float64), DeepEquals, []float64{3.25, 5.})
+	c.Assert(outCs.GetColumn("TradeCount").([]int32), DeepEquals, []int32{30, 70})
+
+	// only on demand
+	outCs = aggregate(cs, tbk, DestinationConfig{})
+	c.Assert(outCs.Exists("VWAP"), Equals, false)
+	c.Assert(outCs.Exists("TradeCount"), Equals, false)
+}
+
+func (t *TestSuite) TestAggColumns(c *C) {
+	RegisterFunction("range", func(values []float64) float64 {
+		min, max := values[0], values[0]
+		for _, v := range values {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		return max - min
+	})
+	defer delete(customFuncs, "range")
+
+	epoch := []int64{
+		time.Date(2017, 12, 15, 10, 3, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 4, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 5, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 6, 0, 0, time.UTC).Unix(),
+	}
+	// no OHLCV columns
+	tbk := io.NewTimeBucketKey("TEST/5Min/FUNDING")
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Rate", []float32{1., 2., 3., 5.})
+	cs.AddColumn("Spread", []int32{1, 2, 4, 8})
+	cs.AddColumn("Mark", []float64{1., 2., 4., 8.})
+	cs.AddColumn("Ignored", []float64{1., 2., 3., 4.})
+
+	outCs := aggregate(cs, tbk, DestinationConfig{
+		Columns: map[string]string{"Mark": "range", "Spread": "mean", "Rate": "last"},
+	})
+	c.Assert(outCs.Len(), Equals, 2)
+	c.Assert(outCs.GetColumnNames(), DeepEquals, []string{"Epoch", "Rate", "Spread", "Mark"})
+	c.Assert(outCs.GetColumn("Rate").([]float32), DeepEquals, []float32{2., 5.})
+	c.Assert(outCs.GetColumn("Spread").([]float64), DeepEquals, []float64{1.5, 6.})
+	c.Assert(outCs.GetColumn("Mark").([]float64), DeepEquals, []float64{1., 4.})
+
+	// configured OHLCV columns
+	cs = io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", []float32{1., 2., 3., 4.})
+	cs.AddColumn("High", []float32{3., 4., 5., 6.})
+	cs.AddColumn("Low", []float32{0., 1., 2., 3.})
+	cs.AddColumn("Close", []float32{3., 4., 5., 6.})
+	outCs = aggregate(cs, tbk, DestinationConfig{Columns: map[string]string{"Close": "mean"}})
+	c.Assert(outCs.GetColumnNames(), DeepEquals, []string{"Epoch", "Open", "High", "Low", "Close"})
+	c.Assert(outCs.GetColumn("Open").([]float32), DeepEquals, []float32{1., 3.})
+	c.Assert(outCs.GetColumn("Close").([]float32), DeepEquals, []float32{3.5, 5.5})
 }
 
 func (t *TestSuite) TestFire(c *C) {
@@ -210,3 +360,358 @@ func (t *TestSuite) TestFire(c *C) {
 	t2 := time.Unix(cs1D.GetEpoch()[1], 0).In(utils.InstanceConfig.Timezone)
 	c.Assert(t2.Equal(time.Date(2017, 12, 15, 0, 0, 0, 0, utils.InstanceConfig.Timezone)), Equals, true)
 }
+
+func (t *TestSuite) TestFireCalendar(c *C) {
+	tz := utils.InstanceConfig.Timezone
+	defer func() { utils.InstanceConfig.Timezone = tz }()
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(map[string]interface{}{
+		"calendar":     "nasdaq",
+		"destinations": []string{"1D", "1W"},
+	})
+	c.Assert(err, IsNil)
+
+	ny, _ := time.LoadLocation("America/New_York")
+	epoch := []int64{
+		// before and after the session
+		time.Date(2017, 11, 22, 9, 0, 0, 0, ny).Unix(),
+		time.Date(2017, 11, 22, 10, 0, 0, 0, ny).Unix(),
+		time.Date(2017, 11, 22, 15, 59, 0, 0, ny).Unix(),
+		time.Date(2017, 11, 22, 17, 0, 0, 0, ny).Unix(),
+		// Thanksgiving
+		time.Date(2017, 11, 23, 10, 0, 0, 0, ny).Unix(),
+		// early close
+		time.Date(2017, 11, 24, 12, 59, 0, 0, ny).Unix(),
+		time.Date(2017, 11, 24, 13, 30, 0, 0, ny).Unix(),
+		time.Date(2017, 11, 27, 10, 0, 0, 0, ny).Unix(),
+	}
+	values := []float32{1., 2., 3., 4., 5., 6., 7., 8.}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", values)
+	cs.AddColumn("High", values)
+	cs.AddColumn("Low", values)
+	cs.AddColumn("Close", values)
+	tbk := io.NewTimeBucketKey("CAL/1Min/OHLC")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	trig.Fire("CAL/1Min/OHLC/2017.bin", toRecords(cs, tbk, time.Minute))
+
+	cs1D := readAll(c, io.NewTimeBucketKey("CAL/1D/OHLC"))
+	c.Assert(cs1D.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 11, 22, 0, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 11, 27, 0, 0, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs1D.GetColumn("Open").([]float32), DeepEquals, []float32{2., 6., 8.})
+	c.Assert(cs1D.GetColumn("Close").([]float32), DeepEquals, []float32{3., 6., 8.})
+
+	// weeks start on Monday
+	opts := trig.(*OnDiskAggTrigger).options["1W"]
+	tqCs := cs.ApplyTimeQual(opts.cal.EpochIsMarketOpen)
+	cs1W := aggregate(tqCs, io.NewTimeBucketKey("CAL/1W/OHLC"), opts)
+	c.Assert(cs1W.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 11, 20, 0, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 11, 27, 0, 0, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs1W.GetColumn("Open").([]float32), DeepEquals, []float32{2., 8.})
+	c.Assert(cs1W.GetColumn("Close").([]float32), DeepEquals, []float32{6., 8.})
+}
+
+func (t *TestSuite) TestFireAdjust(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(map[string]interface{}{
+		"destinations": []string{"5Min", "1D"},
+		"adjust":       "split",
+	})
+	c.Assert(err, IsNil)
+
+	day := time.Date(2020, 8, 31, 0, 0, 0, 0, time.UTC)
+	store, err := corpaction.Instance()
+	c.Assert(err, IsNil)
+	_, err = store.Add(corpaction.Action{Symbol: "ADJ", Kind: corpaction.SPLIT,
+		ExDate: day.Add(10*time.Hour + 5*time.Minute).Unix(), Ratio: 2})
+	c.Assert(err, IsNil)
+
+	epoch := []int64{}
+	for _, minute := range []int{3, 4, 5, 6} {
+		epoch = append(epoch, day.Add(10*time.Hour+time.Duration(minute)*time.Minute).Unix())
+	}
+	values := []float32{200., 202., 100., 99.}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", values)
+	cs.AddColumn("High", values)
+	cs.AddColumn("Low", values)
+	cs.AddColumn("Close", values)
+	tbk := io.NewTimeBucketKey("ADJ/1Min/OHLC")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	trig.Fire("ADJ/1Min/OHLC/2020.bin", toRecords(cs, tbk, time.Minute))
+
+	// the bar of the split is in its terms, the bar before it is not
+	cs1D := readAll(c, io.NewTimeBucketKey("ADJ/1D/OHLC"))
+	c.Assert(cs1D.GetColumn("Open").([]float32), DeepEquals, []float32{100.})
+	c.Assert(cs1D.GetColumn("High").([]float32), DeepEquals, []float32{101.})
+	c.Assert(cs1D.GetColumn("Low").([]float32), DeepEquals, []float32{99.})
+	cs5Min := readAll(c, io.NewTimeBucketKey("ADJ/5Min/OHLC"))
+	c.Assert(cs5Min.GetColumn("Open").([]float32), DeepEquals, []float32{200., 100.})
+	// the records are not adjusted
+	c.Assert(values, DeepEquals, []float32{200., 202., 100., 99.})
+
+	_, err = NewTrigger(map[string]interface{}{
+		"destinations": []string{"1D"},
+		"adjust":       "total",
+	})
+	c.Assert(err, NotNil)
+}
+
+func (t *TestSuite) TestFireTicks(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(getConfig(`{
+		"destinations": ["1Min", {"timeframe": "5Min", "vwap": true, "trade_count": true}]
+	}`))
+	c.Assert(err, IsNil)
+
+	// the ticks of the first minute are written out of order
+	ticks := []time.Time{
+		time.Date(2017, 12, 15, 10, 0, 30, 0, time.UTC),
+		time.Date(2017, 12, 15, 10, 0, 10, 500, time.UTC),
+		time.Date(2017, 12, 15, 10, 0, 10, 100, time.UTC),
+		time.Date(2017, 12, 15, 10, 1, 5, 0, time.UTC),
+		time.Date(2017, 12, 15, 10, 5, 1, 0, time.UTC),
+	}
+	epoch := make([]int64, len(ticks))
+	nanos := make([]int32, len(ticks))
+	for i, tick := range ticks {
+		epoch[i] = tick.Unix()
+		nanos[i] = int32(tick.Nanosecond())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Price", []float32{3., 2., 1., 4., 5.})
+	cs.AddColumn("Size", []int32{10, 20, 30, 40, 50})
+	cs.AddColumn("Nanoseconds", nanos)
+	tbk := io.NewTimeBucketKey("TICK/1Min/TRADE")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, true), IsNil)
+	c.Assert(isVariableBucket(tbk), Equals, true)
+
+	records := make([]trigger.Record, len(ticks))
+	for i, tick := range ticks {
+		buf, _ := io.Serialize(nil, io.TimeToIndex(tick, time.Minute))
+		records[i] = trigger.Record(buf)
+	}
+	trig.Fire("TICK/1Min/TRADE/2017.bin", records)
+
+	cs1Min := readAll(c, io.NewTimeBucketKey("TICK/1Min/OHLCV"))
+	c.Assert(cs1Min.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 12, 15, 10, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 1, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 5, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs1Min.GetColumn("Open").([]float32), DeepEquals, []float32{1., 4., 5.})
+	c.Assert(cs1Min.GetColumn("High").([]float32), DeepEquals, []float32{3., 4., 5.})
+	c.Assert(cs1Min.GetColumn("Low").([]float32), DeepEquals, []float32{1., 4., 5.})
+	c.Assert(cs1Min.GetColumn("Close").([]float32), DeepEquals, []float32{3., 4., 5.})
+	c.Assert(cs1Min.GetColumn("Volume").([]int32), DeepEquals, []int32{60, 40, 50})
+
+	cs5Min := readAll(c, io.NewTimeBucketKey("TICK/5Min/OHLCV"))
+	c.Assert(cs5Min.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 12, 15, 10, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 5, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs5Min.GetColumn("Open").([]float32), DeepEquals, []float32{1., 5.})
+	c.Assert(cs5Min.GetColumn("Close").([]float32), DeepEquals, []float32{4., 5.})
+	c.Assert(cs5Min.GetColumn("Volume").([]int32), DeepEquals, []int32{100, 50})
+	c.Assert(cs5Min.GetColumn("TradeCount").([]int64), DeepEquals, []int64{4, 1})
+	c.Assert(cs5Min.GetColumn("VWAP").([]float64), DeepEquals, []float64{2.6, 5.})
+
+	// the destinations of a variable length source are in OHLCV
+	stale, err := trig.(*OnDiskAggTrigger).stale("TICK/1Min/TRADE/2017.bin")
+	c.Assert(err, IsNil)
+	c.Assert(stale, Equals, false)
+}
+
+func (t *TestSuite) TestAggAnchor(c *C) {
+	tz := utils.InstanceConfig.Timezone
+	defer func() { utils.InstanceConfig.Timezone = tz }()
+	utils.InstanceConfig.Timezone = time.UTC
+
+	trig, err := NewTrigger(getConfig(`{
+        "destinations": [
+            {"timeframe": "4H", "anchor": "09:30"},
+            {"timeframe": "1W", "anchor": "Sunday 17:00"}
+        ]
+        }`))
+	c.Assert(err, IsNil)
+	options := trig.(*OnDiskAggTrigger).options
+
+	epoch := []int64{
+		time.Date(2017, 12, 15, 9, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 9, 30, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 13, 29, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 13, 30, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 17, 16, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 17, 18, 0, 0, 0, time.UTC).Unix(),
+	}
+	values := []float32{1., 2., 3., 4., 5., 6.}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", values)
+	cs.AddColumn("High", values)
+	cs.AddColumn("Low", values)
+	cs.AddColumn("Close", values)
+
+	cs4H := aggregate(cs, io.NewTimeBucketKey("TEST/4H/OHLC"), options["4H"])
+	c.Assert(cs4H.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 12, 15, 5, 30, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 9, 30, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 13, 30, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 17, 13, 30, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 17, 17, 30, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs4H.GetColumn("Open").([]float32), DeepEquals, []float32{1., 2., 4., 5., 6.})
+	c.Assert(cs4H.GetColumn("Close").([]float32), DeepEquals, []float32{1., 3., 4., 5., 6.})
+
+	cs1W := aggregate(cs, io.NewTimeBucketKey("TEST/1W/OHLC"), options["1W"])
+	c.Assert(cs1W.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 12, 10, 17, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 17, 17, 0, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs1W.GetColumn("Close").([]float32), DeepEquals, []float32{5., 6.})
+
+	// the anchors are local times across daylight saving time changes
+	ny, _ := time.LoadLocation("America/New_York")
+	window, err := newAnchoredWindow("1D", &anchor{hour: 17}, ny)
+	c.Assert(err, IsNil)
+	start := window.Truncate(time.Date(2017, 11, 5, 12, 0, 0, 0, ny))
+	c.Assert(start.Equal(time.Date(2017, 11, 4, 17, 0, 0, 0, ny)), Equals, true)
+	c.Assert(window.Ceil(start).Equal(time.Date(2017, 11, 5, 17, 0, 0, 0, ny)), Equals, true)
+
+	for _, dest := range []string{
+		`{"timeframe": "7H", "anchor": "09:30"}`,
+		`{"timeframe": "2D", "anchor": "09:30"}`,
+		`{"timeframe": "4H", "anchor": "Monday 09:30"}`,
+		`{"timeframe": "1W", "anchor": "Someday"}`,
+		`{"timeframe": "1D", "anchor": "9h30"}`,
+		`{"timeframe": "1D", "anchor": "09:30", "calendar": "nasdaq"}`,
+	} {
+		_, err = NewTrigger(getConfig(`{"destinations": [` + dest + `]}`))
+		c.Assert(err, NotNil, Commentf(dest))
+	}
+}
+
+func toRecords(cs *io.ColumnSeries, tbk *io.TimeBucketKey, tf time.Duration) []trigger.Record {
+	rs := cs.ToRowSeries(*tbk, true)
+	rowData := rs.GetData()
+	times := rs.GetTime()
+	rowLen := len(rowData) / len(times)
+
+	records := make([]trigger.Record, len(times))
+	for i := range times {
+		record := rowData[i*rowLen : (i+1)*rowLen]
+		buf, _ := io.Serialize(nil, io.TimeToIndex(times[i], tf))
+		records[i] = trigger.Record(append(buf, record[8:]...))
+	}
+	return records
+}
+
+func readAll(c *C, tbk *io.TimeBucketKey) *io.ColumnSeries {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+	parsed, err := q.Parse()
+	c.Assert(err, IsNil)
+	scanner, err := executor.NewReader(parsed)
+	c.Assert(err, IsNil)
+	csm, err := scanner.Read()
+	c.Assert(err, IsNil)
+	c.Assert(csm[*tbk], NotNil)
+	return csm[*tbk]
+}
+
+func (t *TestSuite) TestReconcile(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	// written without the trigger
+	epoch := []int64{
+		time.Date(2017, 12, 15, 10, 3, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 4, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 5, 0, 0, time.UTC).Unix(),
+	}
+	values := []float32{1., 2., 3.}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", values)
+	cs.AddColumn("High", values)
+	cs.AddColumn("Low", values)
+	cs.AddColumn("Close", values)
+	tbk := io.NewTimeBucketKey("REC/1Min/OHLC")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+	keyPath := "REC/1Min/OHLC/2017.bin"
+
+	// disabled
+	ret, err := NewTrigger(getConfig(`{"destinations": ["5Min"], "catch_up": false}`))
+	c.Assert(err, IsNil)
+	ret.(trigger.Reconciler).Reconcile([]string{keyPath})
+	_, err = os.Stat(filepath.Join(rootDir, "REC/5Min/OHLC/2017.bin"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	ret, err = NewTrigger(getConfig(`{"destinations": ["5Min"]}`))
+	c.Assert(err, IsNil)
+	trig := ret.(*OnDiskAggTrigger)
+	stale, err := trig.stale(keyPath)
+	c.Assert(err, IsNil)
+	c.Assert(stale, Equals, true)
+
+	trig.Reconcile([]string{keyPath})
+	cs5 := readAll(c, io.NewTimeBucketKey("REC/5Min/OHLC"))
+	c.Assert(cs5.GetEpoch(), DeepEquals, []int64{
+		time.Date(2017, 12, 15, 10, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 15, 10, 5, 0, 0, time.UTC).Unix(),
+	})
+	c.Assert(cs5.GetColumn("Close").([]float32), DeepEquals, []float32{2., 3.})
+	stale, err = trig.stale(keyPath)
+	c.Assert(err, IsNil)
+	c.Assert(stale, Equals, false)
+
+	// modified since
+	future := time.Now().Add(time.Hour)
+	c.Assert(os.Chtimes(filepath.Join(rootDir, keyPath), future, future), IsNil)
+	stale, err = trig.stale(keyPath)
+	c.Assert(err, IsNil)
+	c.Assert(stale, Equals, true)
+}
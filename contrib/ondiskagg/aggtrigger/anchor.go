@@ -0,0 +1,146 @@
+package aggtrigger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+)
+
+// anchor is the start of the bars of a destination, at a time of the day and
+// for weekly bars on a day of the week
+type anchor struct {
+	weekday      time.Weekday
+	hour, minute int
+}
+
+// parseAnchor parses an anchor such as "09:30", "Monday" or "Monday 09:30",
+// the weekday being only valid for weekly bars
+func parseAnchor(value string, weekly bool) (*anchor, error) {
+	a := &anchor{weekday: time.Monday}
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid anchor \"%s\"", value)
+	}
+	if len(fields) == 2 || !strings.Contains(fields[0], ":") {
+		if !weekly {
+			return nil, fmt.Errorf("anchor \"%s\" has a weekday, which is only valid for 1W", value)
+		}
+		weekday, ok := weekdays[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday in anchor \"%s\"", value)
+		}
+		a.weekday = weekday
+		fields = fields[1:]
+	}
+	if len(fields) == 1 {
+		t, err := time.Parse("15:04", fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of day in anchor \"%s\"", value)
+		}
+		a.hour, a.minute = t.Hour(), t.Minute()
+	}
+	return a, nil
+}
+
+var weekdays = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays[strings.ToLower(d.String())] = d
+	}
+}
+
+// anchoredWindow is the window of bars starting at the anchor, and then every
+// duration until the anchor of the next day, or of the next week for weekly
+// bars.  Since the anchor is a time of the day in the timezone, the bars keep
+// starting at the same local times across daylight saving time changes.
+type anchoredWindow struct {
+	anchor   *anchor
+	loc      *time.Location
+	duration time.Duration
+	daily    bool
+	weekly   bool
+}
+
+// newAnchoredWindow returns the anchored window of the timeframe, which is
+// either 1D, 1W or an intraday timeframe dividing a day so that the last bar
+// of a day ends at the anchor of the next
+func newAnchoredWindow(timeframe string, a *anchor, loc *time.Location) (*anchoredWindow, error) {
+	tf := utils.TimeframeFromString(timeframe)
+	if tf == nil {
+		return nil, fmt.Errorf("invalid timeframe %s", timeframe)
+	}
+	aw := &anchoredWindow{
+		anchor:   a,
+		loc:      loc,
+		duration: tf.Duration,
+		daily:    timeframe == "1D",
+		weekly:   timeframe == "1W",
+	}
+	if !aw.daily && !aw.weekly && (tf.Duration >= utils.Day || utils.Day%tf.Duration != 0) {
+		return nil, fmt.Errorf("%s bars can not be anchored, only 1D, 1W and the timeframes dividing a day", timeframe)
+	}
+	return aw, nil
+}
+
+func (aw *anchoredWindow) Truncate(ts time.Time) time.Time {
+	loc := aw.loc
+	if loc == nil {
+		loc = ts.Location()
+	}
+	local := ts.In(loc)
+	yy, mm, dd := local.Date()
+	start := time.Date(yy, mm, dd, aw.anchor.hour, aw.anchor.minute, 0, 0, loc)
+	if aw.weekly {
+		start = start.AddDate(0, 0, -(int(start.Weekday())-int(aw.anchor.weekday)+7)%7)
+		if start.After(local) {
+			start = start.AddDate(0, 0, -7)
+		}
+		return start
+	}
+	if start.After(local) {
+		start = start.AddDate(0, 0, -1)
+	}
+	if aw.daily {
+		return start
+	}
+	return start.Add(local.Sub(start) / aw.duration * aw.duration)
+}
+
+func (aw *anchoredWindow) Ceil(ts time.Time) time.Time {
+	start := aw.Truncate(ts)
+	switch {
+	case aw.weekly:
+		return start.AddDate(0, 0, 7)
+	case aw.daily:
+		return start.AddDate(0, 0, 1)
+	}
+	// the next bar starts at the start of the following one of ts, unless a
+	// daylight saving time change shortened the day, when it is the anchor
+	return aw.Truncate(start.Add(aw.duration))
+}
+
+func (aw *anchoredWindow) IsWithin(ts, start time.Time) bool {
+	return aw.Truncate(ts).Equal(start)
+}
+
+// setAnchor sets the anchored window of the destination from its anchor, in
+// the timezone of its calendar if set
+func (dc *DestinationConfig) setAnchor() error {
+	if dc.cal != nil && (dc.Timeframe == "1D" || dc.Timeframe == "1W") {
+		return fmt.Errorf("%s bars are aligned to the sessions of the calendar", dc.Timeframe)
+	}
+	a, err := parseAnchor(dc.Anchor, dc.Timeframe == "1W")
+	if err != nil {
+		return err
+	}
+	// in the timezone of the records, that of their bucket, by default
+	var loc *time.Location
+	if dc.cal != nil {
+		loc = dc.cal.Tz()
+	}
+	dc.anchored, err = newAnchoredWindow(dc.Timeframe, a, loc)
+	return err
+}
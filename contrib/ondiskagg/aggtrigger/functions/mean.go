@@ -0,0 +1,13 @@
+package functions
+
+func MeanFloat32(values []float32) float32 {
+	return SumFloat32(values) / float32(len(values))
+}
+
+func MeanFloat64(values []float64) float64 {
+	sum := float64(0)
+	for _, val := range values {
+		sum += val
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,16 @@
+package functions
+
+// VWAP returns the average of the prices weighted by the volumes, or their
+// plain average if there is no volume
+func VWAP(prices, volumes []float64) float64 {
+	var notional, volume, sum float64
+	for i, price := range prices {
+		notional += price * volumes[i]
+		volume += volumes[i]
+		sum += price
+	}
+	if volume == 0 {
+		return sum / float64(len(prices))
+	}
+	return notional / volume
+}
@@ -0,0 +1,109 @@
+package aggtrigger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+var _ trigger.Reconciler = &OnDiskAggTrigger{}
+
+// Reconcile implements trigger.Reconciler.  Since the aggregates are written
+// after their source, a source file modified after the file of the same year
+// of a destination, or without it, was written while the trigger was not
+// running, and the aggregates of its whole year are recomputed.
+func (s *OnDiskAggTrigger) Reconcile(keyPaths []string) {
+	if !s.catchUp {
+		return
+	}
+	for _, keyPath := range keyPaths {
+		stale, err := s.stale(keyPath)
+		if err != nil {
+			log.Error("failed to reconcile %v (%v)\n", keyPath, err)
+			continue
+		}
+		if !stale {
+			continue
+		}
+		log.Info("recomputing the aggregates of %v\n", keyPath)
+		if err = s.recompute(keyPath); err != nil {
+			log.Error("failed to recompute the aggregates of %v (%v)\n", keyPath, err)
+		}
+	}
+}
+
+// stale returns true if a destination of the source file is out of date
+func (s *OnDiskAggTrigger) stale(keyPath string) (bool, error) {
+	// <Symbol>/<Timeframe>/<AttributeGroup>/<Year>.bin
+	elements := strings.Split(keyPath, "/")
+	if len(elements) != 4 {
+		return false, fmt.Errorf("unexpected file path")
+	}
+	rootDir := executor.ThisInstance.RootDir
+	source, err := os.Stat(filepath.Join(rootDir, keyPath))
+	if err != nil {
+		return false, err
+	}
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:3], "/"))
+	group := s.destinationGroup(elements[2], isVariableBucket(tbk))
+	for _, dest := range s.destinations {
+		destPath := filepath.Join(rootDir, elements[0], dest.String, group, elements[3])
+		info, err := os.Stat(destPath)
+		switch {
+		case os.IsNotExist(err):
+			return true, nil
+		case err != nil:
+			return false, err
+		case info.ModTime().Before(source.ModTime()):
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recompute writes the aggregates of every record of the source file
+func (s *OnDiskAggTrigger) recompute(keyPath string) error {
+	elements := strings.Split(keyPath, "/")
+	year, err := strconv.Atoi(strings.TrimSuffix(elements[3], ".bin"))
+	if err != nil {
+		return err
+	}
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:3], "/"))
+
+	// the year files are of the system timezone, the bars of the bucket's
+	loc := executor.BucketTimezone(*tbk)
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, utils.InstanceConfig.Timezone)
+	end := start.AddDate(1, 0, 0).Add(-time.Second)
+	start, end = start.In(loc), end.In(loc)
+	upper := s.destinations.UpperBound().String
+	opts := s.options[upper]
+	csm, err := s.query(tbk, opts.window(upper), start, end)
+	if err != nil {
+		return err
+	}
+	cs := (*csm)[*tbk]
+	if cs == nil || cs.Len() == 0 {
+		return nil
+	}
+
+	// only the bars of the records of the year, the first and last of which
+	// are completed by those of the adjacent years
+	epoch := cs.GetEpoch()
+	head, tail := start, end
+	if first := time.Unix(epoch[0], 0).In(loc); first.After(head) {
+		head = first
+	}
+	if last := time.Unix(epoch[len(epoch)-1], 0).In(loc); last.Before(tail) {
+		tail = last
+	}
+	return s.write(tbk, cs, tail, head, elements)
+}
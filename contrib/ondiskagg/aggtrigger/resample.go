@@ -0,0 +1,116 @@
+package aggtrigger
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// Resampler aggregates the records of a bucket as the trigger would have on
+// their write, so that the aggregates of records written without it, such
+// as a bulk loaded history, are backfilled offline.
+type Resampler struct {
+	trig *OnDiskAggTrigger
+}
+
+// NewResampler returns the resampler of the trigger config
+func NewResampler(conf map[string]interface{}) (*Resampler, error) {
+	t, err := NewTrigger(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Resampler{trig: t.(*OnDiskAggTrigger)}, nil
+}
+
+// Resample passes to write the bars of every destination of the source
+// bucket, from its records which scan passes to its function in time order,
+// in batches which may split a bar.  The bars of a destination are written
+// once the records of a later bar are read, so each of them is written once.
+// The bars are made in the timezone of the column series of the records.
+func (r *Resampler) Resample(tbk *io.TimeBucketKey,
+	scan func(fn func(cs *io.ColumnSeries) error) error,
+	write func(aggTbk *io.TimeBucketKey, cs *io.ColumnSeries) error) error {
+
+	// start of the bars not yet written, by destination
+	done := make([]int64, len(r.trig.destinations))
+	for i := range done {
+		done[i] = math.MinInt64
+	}
+	var pending *io.ColumnSeries
+
+	emit := func(i int, cs *io.ColumnSeries, end int64) error {
+		slc := between(cs, done[i], end)
+		if slc.Len() == 0 {
+			return nil
+		}
+		variable := isVariable(slc)
+		if variable {
+			slc = r.trig.fromTicks(slc)
+		}
+		dest := r.trig.destinations[i]
+		group := r.trig.destinationGroup(tbk.GetItemInCategory("AttributeGroup"), variable)
+		aggTbk := io.NewTimeBucketKey(strings.Join([]string{tbk.GetItemInCategory("Symbol"), dest.String, group}, "/"))
+		if bars := r.trig.bars(aggTbk, slc, dest); bars != nil {
+			return write(aggTbk, bars)
+		}
+		return nil
+	}
+
+	err := scan(func(cs *io.ColumnSeries) error {
+		if cs.Len() == 0 {
+			return nil
+		}
+		if pending != nil {
+			var err error
+			if cs, err = io.ColumnSeriesConcat(pending, cs); err != nil {
+				return err
+			}
+		}
+		epochs := cs.GetEpoch()
+		last := time.Unix(epochs[len(epochs)-1], 0).In(cs.GetLocation())
+		keep := int64(math.MaxInt64)
+		for i, dest := range r.trig.destinations {
+			opts := r.trig.options[dest.String]
+			// the bar of the last record may be completed by the next batch
+			start := opts.window(dest.String).Truncate(last).Unix()
+			if start > done[i] {
+				if err := emit(i, cs, start); err != nil {
+					return err
+				}
+				done[i] = start
+			}
+			if done[i] < keep {
+				keep = done[i]
+			}
+		}
+		pending = between(cs, keep, math.MaxInt64)
+		return nil
+	})
+	if err != nil || pending == nil {
+		return err
+	}
+	for i := range r.trig.destinations {
+		if err = emit(i, pending, math.MaxInt64); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// between returns the records of cs from the start epoch until the end one,
+// excluded
+func between(cs *io.ColumnSeries, start, end int64) *io.ColumnSeries {
+	epochs := cs.GetEpoch()
+	i := sort.Search(len(epochs), func(i int) bool { return epochs[i] >= start })
+	j := sort.Search(len(epochs), func(j int) bool { return epochs[j] >= end })
+	out := io.NewColumnSeries()
+	for _, name := range cs.GetColumnNames() {
+		out.AddColumn(name, reflect.ValueOf(cs.GetByName(name)).Slice(i, j).Interface())
+	}
+	out.SetLocation(cs.GetLocation())
+	return out
+}
@@ -0,0 +1,73 @@
+package aggtrigger
+
+import (
+	"time"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/utils"
+)
+
+// aggWindow groups the source records into the bars of a destination
+type aggWindow interface {
+	// Truncate returns the start of the bar of ts
+	Truncate(ts time.Time) time.Time
+	// Ceil returns the start of the bar following that of ts
+	Ceil(ts time.Time) time.Time
+	// IsWithin returns true if ts is in the bar starting at start
+	IsWithin(ts, start time.Time) bool
+}
+
+// sessionWindow is the window of daily or weekly bars made of the sessions
+// of a market calendar, grouped by their market day in its timezone, or by
+// their week starting on Monday for weekly bars
+type sessionWindow struct {
+	cal    *calendar.Calendar
+	weekly bool
+}
+
+func (sw *sessionWindow) Truncate(ts time.Time) time.Time {
+	day := sw.cal.SessionDay(ts)
+	if sw.weekly {
+		// weeks start on Monday
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func (sw *sessionWindow) Ceil(ts time.Time) time.Time {
+	if sw.weekly {
+		return sw.Truncate(ts).AddDate(0, 0, 7)
+	}
+	return sw.Truncate(ts).AddDate(0, 0, 1)
+}
+
+func (sw *sessionWindow) IsWithin(ts, start time.Time) bool {
+	return sw.Truncate(ts).Equal(start)
+}
+
+// epoch returns the epoch of the bar starting at start, midnight of its day
+// in the timezone of the bucket, by whose days its bars are dated
+func (sw *sessionWindow) epoch(start time.Time, loc *time.Location) int64 {
+	yy, mm, dd := start.Date()
+	return time.Date(yy, mm, dd, 0, 0, 0, 0, loc).Unix()
+}
+
+// window returns the window of the destination of the timeframe, aligned to
+// the sessions of the calendar of the destination for 1D and 1W, or else to
+// its anchor
+func (dc *DestinationConfig) window(timeframe string) aggWindow {
+	if dc.cal != nil && (timeframe == "1D" || timeframe == "1W") {
+		return &sessionWindow{cal: dc.cal, weekly: timeframe == "1W"}
+	}
+	if dc.anchored != nil {
+		return dc.anchored
+	}
+	return utils.CandleDurationFromString(timeframe)
+}
+
+// loadCalendar returns the market calendar of the name, either one of the
+// calendar package, one of the calendars setting or the path of a calendar
+// JSON or YAML file in the format of the calendar package
+func loadCalendar(name string) (*calendar.Calendar, error) {
+	return calendar.Load(name)
+}
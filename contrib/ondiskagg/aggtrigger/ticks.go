@@ -0,0 +1,73 @@
+package aggtrigger
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// isVariable returns true if the column series was read from a variable
+// length bucket, whose records have the Nanoseconds of their time
+func isVariable(cs *io.ColumnSeries) bool {
+	return cs.Exists("Nanoseconds")
+}
+
+// isVariableBucket returns true if the bucket has variable length records
+func isVariableBucket(tbk *io.TimeBucketKey) bool {
+	tbi, err := executor.ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(tbk)
+	return err == nil && tbi.GetRecordType() == io.VARIABLE
+}
+
+// destinationGroup returns the attribute group of the destinations of a
+// source group, the configured one, or OHLCV for the ticks of a variable
+// length source, that of the source otherwise
+func (s *OnDiskAggTrigger) destinationGroup(group string, variable bool) string {
+	switch {
+	case s.group != "":
+		return s.group
+	case variable:
+		return "OHLCV"
+	}
+	return group
+}
+
+// fromTicks returns the column series of the ticks of a variable length
+// source in time order, the records of an interval being ordered by write,
+// with the price column as Open, High, Low and Close and the size column as
+// Volume to be aggregated as bars, unless the ticks already have them
+func (s *OnDiskAggTrigger) fromTicks(cs *io.ColumnSeries) *io.ColumnSeries {
+	epoch := cs.GetEpoch()
+	nanos, _ := cs.GetByName("Nanoseconds").([]int32)
+	order := make([]int, len(epoch))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		return epoch[i] < epoch[j] || epoch[i] == epoch[j] && nanos != nil && nanos[i] < nanos[j]
+	})
+
+	out := io.NewColumnSeries()
+	for _, name := range cs.GetColumnNames() {
+		col := reflect.ValueOf(cs.GetByName(name))
+		sorted := reflect.MakeSlice(col.Type(), len(order), len(order))
+		for k, i := range order {
+			sorted.Index(k).Set(col.Index(i))
+		}
+		out.AddColumn(name, sorted.Interface())
+	}
+	out.SetLocation(cs.GetLocation())
+	if out.Exists(s.price) {
+		for _, name := range []string{"Open", "High", "Low", "Close"} {
+			if !out.Exists(name) {
+				out.AddColumn(name, out.GetByName(s.price))
+			}
+		}
+	}
+	if out.Exists(s.size) && !out.Exists("Volume") {
+		out.AddColumn("Volume", out.GetByName(s.size))
+	}
+	return out
+}
@@ -4,9 +4,13 @@ package main
 
 import (
 	"github.com/alpacahq/marketstore/contrib/ondiskagg/aggtrigger"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/trigger"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 // NewTrigger returns a new on-disk aggregate trigger based on the configuration.
 func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
 	return aggtrigger.NewTrigger(conf)
@@ -12,10 +12,14 @@ import (
 
 	"github.com/alpacahq/marketstore/contrib/polyiex/api"
 	"github.com/alpacahq/marketstore/contrib/polyiex/handlers"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils/log"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 type PolyIEXFetcher struct {
 	config FetcherConfig
 }
@@ -0,0 +1,280 @@
+// Redis implements a trigger that pushes the rows written to the buckets
+// matching the trigger to Redis, published to a channel or appended to a
+// stream per bucket, so that the web backends already using Redis receive
+// the live bars without a websocket stream of their own.
+//
+// Example:
+// 	triggers:
+// 	  - module: redis.so
+// 	    on: */1Min/OHLCV
+// 	    config:
+// 	      address: localhost:6379
+// 	      mode: stream
+// 	      max_len: 10000
+//
+// With the above, each row written to AAPL/1Min/OHLCV is appended to the
+// marketstore:AAPL/1Min/OHLCV stream, with a field per column, trimmed to
+// about 10000 entries.  In the default pubsub mode, the rows are published
+// to the channel of the same name in the message format of the websocket
+// stream, for the subscribers of e.g. marketstore:*/1Min/OHLCV.
+package redistrigger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/stream"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+	msgpack "github.com/vmihailenco/msgpack"
+)
+
+// RedisTriggerConfig is the configuration for RedisTrigger you can define in
+// marketstore's config file under triggers extension.
+type RedisTriggerConfig struct {
+	// Address of the server, localhost:6379 if omitted
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	// One of pubsub, the default, and stream
+	Mode string `json:"mode"`
+	// Prefix of the channels and streams, marketstore: if omitted
+	Prefix string `json:"prefix"`
+	// Encoding of the pubsub messages, json, the default, or msgpack
+	Encoding string `json:"encoding"`
+	// Approximate maximum length of the streams, unlimited if omitted
+	MaxLen int `json:"max_len"`
+	// Timeout of the connection and of each write, 5s if omitted
+	Timeout string `json:"timeout"`
+}
+
+// RedisTrigger is the main trigger.
+type RedisTrigger struct {
+	config map[string]interface{}
+	client *client
+	stream bool
+	prefix string
+	encode func(v interface{}) ([]byte, error)
+	maxLen int
+}
+
+var (
+	_         trigger.CheckedTrigger = &RedisTrigger{}
+	loadError                        = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *RedisTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := RedisTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new Redis trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	t := &RedisTrigger{
+		config: conf,
+		prefix: config.Prefix,
+		maxLen: config.MaxLen,
+		client: &client{
+			address:  config.Address,
+			password: config.Password,
+			db:       config.DB,
+			timeout:  5 * time.Second,
+		},
+	}
+	if t.prefix == "" {
+		t.prefix = "marketstore:"
+	}
+	if t.client.address == "" {
+		t.client.address = "localhost:6379"
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil || timeout <= 0 {
+			log.Error("invalid timeout: %s\n", config.Timeout)
+			return nil, loadError
+		}
+		t.client.timeout = timeout
+	}
+	switch strings.ToLower(config.Mode) {
+	case "", "pubsub":
+	case "stream":
+		t.stream = true
+	default:
+		log.Error("unknown mode \"%s\"\n", config.Mode)
+		return nil, loadError
+	}
+	switch strings.ToLower(config.Encoding) {
+	case "", "json":
+		t.encode = json.Marshal
+	case "msgpack":
+		t.encode = msgpack.Marshal
+	default:
+		log.Error("unknown encoding \"%s\"\n", config.Encoding)
+		return nil, loadError
+	}
+	if t.maxLen < 0 {
+		log.Error("invalid max_len %d\n", t.maxLen)
+		return nil, loadError
+	}
+
+	// the server is not required to be up, the connection being dialed
+	// again on every write until it is
+	if err := t.client.do([]string{"PING"}); err != nil {
+		log.Warn("failed to connect to redis at %s (%v)\n", t.client.address, err)
+	}
+
+	log.Info("pushing to redis at %s\n", t.client.address)
+
+	return t, nil
+}
+
+// Fire implements trigger interface.
+func (s *RedisTrigger) Fire(keyPath string, records []trigger.Record) {
+	if err := s.TryFire(keyPath, records); err != nil {
+		log.Error("%v\n", err)
+	}
+}
+
+// TryFire implements trigger.CheckedTrigger, so that the failed pushes are
+// retried and dead-lettered.
+func (s *RedisTrigger) TryFire(keyPath string, records []trigger.Record) error {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	cs, err := read(tbk, head, tail.Add(tf.Duration-time.Second))
+	if err != nil {
+		return fmt.Errorf("failed to read %v (%v)", tbk.String(), err)
+	}
+	if cs == nil || cs.Len() == 0 {
+		return nil
+	}
+
+	key := s.prefix + tbk.GetItemKey()
+	var commands [][]string
+	for _, i := range written(cs, records, tf.Duration, int16(year)) {
+		command, err := s.command(key, tbk, cs, i)
+		if err != nil {
+			return fmt.Errorf("failed to encode %v (%v)", tbk.String(), err)
+		}
+		commands = append(commands, command)
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	if err := s.client.do(commands...); err != nil {
+		return fmt.Errorf("failed to push %v to %s (%v)", tbk.String(), key, err)
+	}
+	return nil
+}
+
+// command returns the command pushing the row of the column series
+func (s *RedisTrigger) command(key string, tbk *io.TimeBucketKey, cs *io.ColumnSeries, i int) ([]string, error) {
+	if !s.stream {
+		data, err := s.encode(stream.Payload{Key: tbk.GetItemKey(), Data: row(cs, i)})
+		if err != nil {
+			return nil, err
+		}
+		return []string{"PUBLISH", key, string(data)}, nil
+	}
+	command := []string{"XADD", key}
+	if s.maxLen > 0 {
+		command = append(command, "MAXLEN", "~", strconv.Itoa(s.maxLen))
+	}
+	command = append(command, "*")
+	values := row(cs, i)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command = append(command, name, fmt.Sprint(values[name]))
+	}
+	return command, nil
+}
+
+// written returns the indexes of the rows of the column series read back
+// which were written.  The rows of a fixed length bucket are those of the
+// epochs of the records, while the records of a variable length bucket only
+// have the epochs of their intervals, ordered by write, so that its rows
+// written are the last ones.
+func written(cs *io.ColumnSeries, records []trigger.Record, tf time.Duration, year int16) (rows []int) {
+	epoch := cs.GetEpoch()
+	if cs.Exists("Nanoseconds") {
+		first := len(epoch) - len(records)
+		if first < 0 {
+			first = 0
+		}
+		for i := first; i < len(epoch); i++ {
+			rows = append(rows, i)
+		}
+		return rows
+	}
+	epochs := map[int64]bool{}
+	for _, record := range records {
+		epochs[io.IndexToTime(record.Index(), tf, year).Unix()] = true
+	}
+	for i := range epoch {
+		if epochs[epoch[i]] {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// row returns the values of the columns of a row by name
+func row(cs *io.ColumnSeries, i int) map[string]interface{} {
+	m := map[string]interface{}{}
+	for name, col := range cs.GetColumns() {
+		m[name] = reflect.ValueOf(col).Index(i).Interface()
+	}
+	return m
+}
+
+// read returns the rows of the bucket between start and end
+func read(tbk *io.TimeBucketKey, start, end time.Time) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	q.SetRange(start.Unix(), end.Unix())
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	return csm[*tbk], nil
+}
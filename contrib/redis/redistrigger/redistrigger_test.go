@@ -0,0 +1,192 @@
+package redistrigger
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+// fakeServer answers the commands of the trigger like a Redis server, and
+// sends them to commands
+type fakeServer struct {
+	listener net.Listener
+	commands chan []string
+}
+
+func newFakeServer(c *C) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s := &fakeServer{listener: listener, commands: make(chan []string, 100)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			r.ReadString('\n')
+			arg, _ := r.ReadString('\n')
+			args[i] = strings.TrimSuffix(arg, "\r\n")
+		}
+		s.commands <- args
+		switch args[0] {
+		case "PING":
+			conn.Write([]byte("+PONG\r\n"))
+		case "AUTH":
+			if args[1] != "secret" {
+				conn.Write([]byte("-ERR invalid password\r\n"))
+				continue
+			}
+			conn.Write([]byte("+OK\r\n"))
+		case "PUBLISH":
+			conn.Write([]byte(":1\r\n"))
+		case "XADD":
+			conn.Write([]byte("$15\r\n1526919030474-0\r\n"))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	server := newFakeServer(c)
+	defer server.listener.Close()
+
+	ret, err := NewTrigger(getConfig(`{"address": "` + server.listener.Addr().String() + `", "password": "secret"}`))
+	c.Assert(err, IsNil)
+	trig := ret.(*RedisTrigger)
+	c.Assert(trig.prefix, Equals, "marketstore:")
+	c.Assert(trig.stream, Equals, false)
+	c.Assert(<-server.commands, DeepEquals, []string{"AUTH", "secret"})
+	c.Assert(<-server.commands, DeepEquals, []string{"PING"})
+
+	for _, config := range []string{
+		`{"mode": "list"}`,
+		`{"encoding": "avro"}`,
+		`{"timeout": "5 seconds"}`,
+		`{"mode": "stream", "max_len": -1}`,
+	} {
+		ret, err = NewTrigger(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	var epoch []int64
+	for i := 0; i < 3; i++ {
+		epoch = append(epoch, time.Date(2017, 12, 14, 10, i, 0, 0, time.UTC).Unix())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Close", []float32{1., 2., 3.})
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLCV")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	// fired with the first and last records, the one between them being
+	// left out
+	index := func(epoch int64) trigger.Record {
+		buf, _ := io.Serialize(nil, io.TimeToIndex(time.Unix(epoch, 0), time.Minute))
+		return trigger.Record(buf)
+	}
+	records := []trigger.Record{index(epoch[0]), index(epoch[2])}
+
+	server := newFakeServer(c)
+	address := server.listener.Addr().String()
+
+	ret, err := NewTrigger(getConfig(`{"address": "` + address + `"}`))
+	c.Assert(err, IsNil)
+	<-server.commands
+	c.Assert(ret.(*RedisTrigger).TryFire("TEST/1Min/OHLCV/2017.bin", records), IsNil)
+	command := <-server.commands
+	c.Assert(command[:2], DeepEquals, []string{"PUBLISH", "marketstore:TEST/1Min/OHLCV"})
+	var payload struct {
+		Key  string             `json:"key"`
+		Data map[string]float64 `json:"data"`
+	}
+	c.Assert(json.Unmarshal([]byte(command[2]), &payload), IsNil)
+	c.Assert(payload.Key, Equals, "TEST/1Min/OHLCV")
+	c.Assert(payload.Data["Epoch"], Equals, float64(epoch[0]))
+	c.Assert((<-server.commands)[0], Equals, "PUBLISH")
+
+	ret, err = NewTrigger(getConfig(`{"address": "` + address + `", "mode": "stream", "max_len": 100}`))
+	c.Assert(err, IsNil)
+	<-server.commands
+	trig := ret.(*RedisTrigger)
+	c.Assert(trig.TryFire("TEST/1Min/OHLCV/2017.bin", records[1:]), IsNil)
+	c.Assert(<-server.commands, DeepEquals, []string{
+		"XADD", "marketstore:TEST/1Min/OHLCV", "MAXLEN", "~", "100", "*",
+		"Close", "3", "Epoch", strconv.FormatInt(epoch[2], 10)})
+
+	// dialed again once the server is back
+	server.listener.Close()
+	trig.client.Lock()
+	trig.client.close()
+	trig.client.Unlock()
+	c.Assert(trig.TryFire("TEST/1Min/OHLCV/2017.bin", records[1:]), NotNil)
+
+	listener, err := net.Listen("tcp", address)
+	c.Assert(err, IsNil)
+	server.listener = listener
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	c.Assert(trig.TryFire("TEST/1Min/OHLCV/2017.bin", records[1:]), IsNil)
+	c.Assert((<-server.commands)[0], Equals, "XADD")
+}
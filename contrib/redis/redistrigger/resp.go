@@ -0,0 +1,146 @@
+package redistrigger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// client is a minimal Redis client of the RESP protocol, sending pipelines
+// of commands over a single connection dialed again after a failure
+type client struct {
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+
+	sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// do sends the commands and reads their replies, returning the first error
+// reply.  The connection is closed after any other error, the replies of the
+// pipeline being lost, to be dialed again by the next call.
+func (c *client) do(commands ...[]string) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return err
+		}
+	}
+	err := c.pipeline(commands)
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.close()
+	}
+	return err
+}
+
+func (c *client) dial() (err error) {
+	if c.conn, err = net.DialTimeout("tcp", c.address, c.timeout); err != nil {
+		c.conn = nil
+		return err
+	}
+	c.r = bufio.NewReader(c.conn)
+	c.w = bufio.NewWriter(c.conn)
+	var setup [][]string
+	if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		if err = c.pipeline(setup); err != nil {
+			c.close()
+		}
+	}
+	return err
+}
+
+func (c *client) close() {
+	c.conn.Close()
+	c.conn = nil
+}
+
+func (c *client) pipeline(commands [][]string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	for _, args := range commands {
+		fmt.Fprintf(c.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	var first error
+	for range commands {
+		err := c.readReply()
+		if _, ok := err.(redisError); err != nil && !ok {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// readReply reads a reply, returning a redisError for an error reply
+func (c *client) readReply() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = c.r.Discard(n + 2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := c.readReply(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected reply %q", line)
+}
+
+func (c *client) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", errors.New("malformed reply")
+	}
+	return line[:len(line)-2], nil
+}
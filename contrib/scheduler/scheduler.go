@@ -0,0 +1,372 @@
+// Scheduler implements a background worker that runs jobs on cron schedules,
+// such as the nightly backfills, rollups and exports, without writing a
+// plugin for each of them.  A job runs either an external command, a SQL
+// statement or the export of buckets to a CSV file.
+//
+// Example:
+// 	bgworkers:
+// 	  - module: scheduler.so
+// 	    name: nightly
+// 	    config:
+// 	      timezone: America/New_York
+// 	      jobs:
+// 	        - name: backfill
+// 	          schedule: "0 2 * * 1-5"
+// 	          command: ["/usr/local/bin/backfill", "--from", "{start}", "--to", "{end}"]
+// 	          window: 24h
+// 	        - name: rollup
+// 	          schedule: "30 2 * * *"
+// 	          sql: "INSERT INTO `AAPL/1D/OHLCV` SELECT candlecandler('1D', Open, High, Low, Close) FROM `AAPL/1Min/OHLCV` WHERE Epoch >= ? AND Epoch < ?"
+// 	          window: 24h
+// 	        - name: export
+// 	          schedule: "@daily"
+// 	          export:
+// 	            bucket: AAPL,MSFT/1Min/OHLCV
+// 	            path: /backup/1Min-{date}.csv
+// 	          window: 24h
+//
+// The schedules are cron expressions in the timezone of the worker, that of
+// the server by default.  With window, the job works on the period of that
+// length ending at its scheduled time: the '?' parameters of the SQL
+// statement are bound to its start and end epochs, and the export only
+// writes its rows.  {date}, {start} and {end} are replaced in the command
+// arguments and the export path by the date of the run and the RFC 3339
+// start and end of the window.  A job is skipped while its previous run is
+// still running.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/abi"
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/sqlparser"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
+// ExportConfig is the export of buckets to a CSV file
+type ExportConfig struct {
+	// Bucket key, with comma separated items such as AAPL,MSFT/1Min/OHLCV
+	Bucket string `json:"bucket"`
+	Path   string `json:"path"`
+	// Format of the Epoch column, see io.FormatEpoch, unix if omitted
+	TimeFormat string `json:"time_format"`
+}
+
+// JobConfig is a job and its schedule.  Exactly one of Command, SQL and
+// Export is set.
+type JobConfig struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// Executable and arguments of the command, not run by a shell
+	Command []string      `json:"command"`
+	SQL     string        `json:"sql"`
+	Export  *ExportConfig `json:"export"`
+	// Length of the period ending at the scheduled time the job works on,
+	// such as 24h
+	Window string `json:"window"`
+	// Timeout of the command, none if omitted
+	Timeout string `json:"timeout"`
+}
+
+// SchedulerConfig is the configuration for Scheduler you can define in
+// marketstore's config file through bgworker extension.
+type SchedulerConfig struct {
+	// Timezone of the schedules, that of the server if omitted
+	Timezone string      `json:"timezone"`
+	Jobs     []JobConfig `json:"jobs"`
+}
+
+type job struct {
+	JobConfig
+	schedule *schedule
+	ast      *sqlparser.AstBuilder
+	window   time.Duration
+	timeout  time.Duration
+
+	sync.Mutex
+	running bool
+}
+
+// Scheduler is the main worker instance.  It implements bgworker.Run() and
+// bgworker.Stopper.
+type Scheduler struct {
+	config map[string]interface{}
+	jobs   []*job
+	loc    *time.Location
+	stop   chan struct{}
+	once   sync.Once
+}
+
+var loadError = errors.New("plugin load error")
+
+func recast(config map[string]interface{}) *SchedulerConfig {
+	data, _ := json.Marshal(config)
+	ret := SchedulerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewBgWorker returns the new instance of Scheduler.  See SchedulerConfig
+// for the details of available configurations.
+func NewBgWorker(conf map[string]interface{}) (bgworker.BgWorker, error) {
+	config := recast(conf)
+
+	s := &Scheduler{config: conf, loc: utils.InstanceConfig.Timezone, stop: make(chan struct{})}
+	if config.Timezone != "" {
+		loc, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			log.Error("invalid timezone %s (%v)\n", config.Timezone, err)
+			return nil, loadError
+		}
+		s.loc = loc
+	}
+	if len(config.Jobs) == 0 {
+		log.Error("no jobs are configured\n")
+		return nil, loadError
+	}
+	for i, jc := range config.Jobs {
+		j, err := newJob(jc, s.loc)
+		if err != nil {
+			log.Error("invalid job %d %s (%v)\n", i, jc.Name, err)
+			return nil, loadError
+		}
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("job%d", i)
+		}
+		s.jobs = append(s.jobs, j)
+	}
+	log.Info("%d job(s) scheduled\n", len(s.jobs))
+
+	return s, nil
+}
+
+func newJob(jc JobConfig, loc *time.Location) (j *job, err error) {
+	j = &job{JobConfig: jc}
+	if j.schedule, err = parseSchedule(jc.Schedule, loc); err != nil {
+		return nil, err
+	}
+	actions := 0
+	if len(jc.Command) > 0 {
+		actions++
+	}
+	if jc.SQL != "" {
+		actions++
+		if j.ast, err = sqlparser.NewAstBuilder(jc.SQL); err != nil {
+			return nil, fmt.Errorf("invalid sql (%v)", err)
+		}
+	}
+	if jc.Export != nil {
+		actions++
+		if jc.Export.Bucket == "" || jc.Export.Path == "" {
+			return nil, errors.New("export requires a bucket and a path")
+		}
+	}
+	if actions != 1 {
+		return nil, errors.New("exactly one of command, sql and export is required")
+	}
+	if jc.Window != "" {
+		if j.window, err = time.ParseDuration(jc.Window); err != nil || j.window <= 0 {
+			return nil, fmt.Errorf("invalid window %s", jc.Window)
+		}
+	}
+	if jc.Timeout != "" {
+		if j.timeout, err = time.ParseDuration(jc.Timeout); err != nil || j.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %s", jc.Timeout)
+		}
+	}
+	return j, nil
+}
+
+// Run runs the jobs at their scheduled times until stopped.
+func (s *Scheduler) Run() {
+	next := make([]time.Time, len(s.jobs))
+	for i, j := range s.jobs {
+		next[i] = j.schedule.Next(time.Now())
+		log.Info("job %s is next run at %v\n", j.Name, next[i])
+	}
+	for {
+		var wake time.Time
+		for _, t := range next {
+			if !t.IsZero() && (wake.IsZero() || t.Before(wake)) {
+				wake = t
+			}
+		}
+		if wake.IsZero() {
+			log.Warn("no job is scheduled anymore\n")
+			return
+		}
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-timer.C:
+		case <-s.stop:
+			timer.Stop()
+			log.Info("scheduler stopped\n")
+			return
+		}
+
+		for i, j := range s.jobs {
+			if next[i].IsZero() || next[i].After(time.Now()) {
+				continue
+			}
+			go s.start(j, next[i])
+			// the runs missed while the server was suspended are skipped
+			next[i] = j.schedule.Next(time.Now())
+		}
+	}
+}
+
+// Stop stops scheduling the jobs, letting those running finish.
+func (s *Scheduler) Stop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// start runs the job scheduled at the time unless it is still running
+func (s *Scheduler) start(j *job, at time.Time) {
+	j.Lock()
+	if j.running {
+		j.Unlock()
+		log.Warn("job %s scheduled at %v is skipped, its previous run is still running\n", j.Name, at)
+		return
+	}
+	j.running = true
+	j.Unlock()
+	defer func() {
+		j.Lock()
+		j.running = false
+		j.Unlock()
+	}()
+
+	begin := time.Now()
+	if err := s.runJob(j, at); err != nil {
+		log.Error("job %s scheduled at %v failed (%v)\n", j.Name, at, err)
+		return
+	}
+	log.Info("job %s scheduled at %v done in %v\n", j.Name, at, time.Since(begin))
+}
+
+// runJob runs the job scheduled at the time
+func (s *Scheduler) runJob(j *job, at time.Time) error {
+	at = at.In(s.loc)
+	start, end := at, at
+	if j.window > 0 {
+		start = at.Add(-j.window)
+	}
+	switch {
+	case len(j.Command) > 0:
+		return s.runCommand(j, at, start, end)
+	case j.SQL != "":
+		return runSQL(j.ast, j.window > 0, start, end)
+	default:
+		return export(j.Export, expand(j.Export.Path, at, start, end), j.window > 0, start, end)
+	}
+}
+
+func (s *Scheduler) runCommand(j *job, at, start, end time.Time) error {
+	ctx := context.Background()
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+	args := make([]string, len(j.Command))
+	for i, arg := range j.Command {
+		args[i] = expand(arg, at, start, end)
+	}
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// runSQL executes the statement, with its parameters bound to the start
+// and end epochs of the window if set
+func runSQL(ast *sqlparser.AstBuilder, window bool, start, end time.Time) error {
+	var parameters []interface{}
+	switch {
+	case ast.NumParameters == 0:
+	case ast.NumParameters == 2 && window:
+		parameters = []interface{}{start.Unix(), end.Unix()}
+	default:
+		return fmt.Errorf("sql must have either no parameters or two for the window start and end, has %d",
+			ast.NumParameters)
+	}
+	es, err := sqlparser.NewPreparedExecutableStatement(ast, parameters...)
+	if err != nil {
+		return err
+	}
+	_, err = es.Materialize()
+	return err
+}
+
+// export writes the rows of the buckets within the window, if set, to a CSV
+// file at the path, replaced once written
+func export(ec *ExportConfig, path string, window bool, start, end time.Time) error {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(io.NewTimeBucketKey(ec.Bucket))
+	if window {
+		q.SetRange(start.Unix(), end.Unix()-1)
+	} else {
+		q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+	}
+	parsed, err := q.Parse()
+	if err != nil {
+		return err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = csm.WriteCSV(f, ec.TimeFormat); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// expand replaces {date} with the date of the run and {start} and {end}
+// with the window
+func expand(template string, at, start, end time.Time) string {
+	return strings.NewReplacer(
+		"{date}", at.Format("2006-01-02"),
+		"{start}", start.Format(time.RFC3339),
+		"{end}", end.Format(time.RFC3339),
+	).Replace(template)
+}
+
+func main() {}
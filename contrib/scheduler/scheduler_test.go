@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	ret, err := NewBgWorker(getConfig(`{
+		"timezone": "America/New_York",
+		"jobs": [
+			{"schedule": "@daily", "command": ["true"]},
+			{"name": "export", "schedule": "0 3 * * 1-5", "window": "24h",
+			 "export": {"bucket": "AAPL/1Min/OHLCV", "path": "/tmp/{date}.csv"}}
+		]}`))
+	c.Assert(err, IsNil)
+	s := ret.(*Scheduler)
+	c.Assert(s.loc.String(), Equals, "America/New_York")
+	c.Assert(s.jobs, HasLen, 2)
+	c.Assert(s.jobs[0].Name, Equals, "job0")
+	c.Assert(s.jobs[1].window, Equals, 24*time.Hour)
+
+	for _, config := range []string{
+		`{}`,
+		`{"timezone": "Mars/Olympus_Mons", "jobs": [{"schedule": "@daily", "command": ["true"]}]}`,
+		`{"jobs": [{"schedule": "@daily"}]}`,
+		`{"jobs": [{"schedule": "@daily", "command": ["true"], "sql": "SELECT * FROM x"}]}`,
+		`{"jobs": [{"schedule": "0 0 * *", "command": ["true"]}]}`,
+		`{"jobs": [{"schedule": "@daily", "command": ["true"], "window": "1 day"}]}`,
+		`{"jobs": [{"schedule": "@daily", "export": {"bucket": "AAPL/1Min/OHLCV"}}]}`,
+		`{"jobs": [{"schedule": "@daily", "sql": "SELEKT"}]}`,
+	} {
+		ret, err = NewBgWorker(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestStop(c *C) {
+	ret, err := NewBgWorker(getConfig(`{"jobs": [{"schedule": "@yearly", "command": ["true"]}]}`))
+	c.Assert(err, IsNil)
+	s := ret.(*Scheduler)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Run()
+		close(stopped)
+	}()
+	s.Stop()
+	s.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		c.Fatal("scheduler did not stop")
+	}
+}
+
+func (t *TestSuite) TestSchedule(c *C) {
+	ny, _ := time.LoadLocation("America/New_York")
+	from := time.Date(2018, 3, 9, 15, 4, 30, 0, ny) // Friday
+
+	for _, test := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2018, 3, 9, 15, 5, 0, 0, ny)},
+		{"*/15 * * * *", time.Date(2018, 3, 9, 15, 15, 0, 0, ny)},
+		{"30 2 * * 1-5", time.Date(2018, 3, 12, 2, 30, 0, 0, ny)},
+		{"0 9-17/4 * * *", time.Date(2018, 3, 9, 17, 0, 0, 0, ny)},
+		{"0 0 * * sun", time.Date(2018, 3, 11, 0, 0, 0, 0, ny)},
+		{"0 0 * * 7", time.Date(2018, 3, 11, 0, 0, 0, 0, ny)},
+		{"@monthly", time.Date(2018, 4, 1, 0, 0, 0, 0, ny)},
+		{"0 0 1 jan,jul *", time.Date(2018, 7, 1, 0, 0, 0, 0, ny)},
+		// either the day of month or the day of week
+		{"0 12 15 * mon", time.Date(2018, 3, 12, 12, 0, 0, 0, ny)},
+		// skipped by the start of daylight saving time on the 11th
+		{"30 2 * * 0", time.Date(2018, 3, 18, 2, 30, 0, 0, ny)},
+		{"0 0 30 2 *", time.Time{}},
+		// the repeated hour of the end of daylight saving time
+		{"30 1 4 11 *", time.Date(2018, 11, 4, 1, 30, 0, 0, ny)},
+	} {
+		s, err := parseSchedule(test.expr, ny)
+		c.Assert(err, IsNil, Commentf(test.expr))
+		c.Assert(s.Next(from).Equal(test.next), Equals, true, Commentf("%s: %v", test.expr, s.Next(from)))
+	}
+
+	for _, expr := range []string{"60 * * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@often"} {
+		_, err := parseSchedule(expr, ny)
+		c.Assert(err, NotNil, Commentf(expr))
+	}
+}
+
+func (t *TestSuite) TestRunJob(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	var epoch []int64
+	for i := 0; i < 3; i++ {
+		epoch = append(epoch, time.Date(2018, 1, 1+i, 12, 0, 0, 0, time.UTC).Unix())
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Close", []float32{1., 2., 3.})
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/OHLCV"), cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	dir := c.MkDir()
+	ret, err := NewBgWorker(getConfig(`{"jobs": [
+		{"schedule": "@daily", "window": "24h",
+		 "export": {"bucket": "TEST/1Min/OHLCV", "path": "` + dir + `/export/{date}.csv"}},
+		{"schedule": "@daily", "command": ["touch", "` + dir + `/{date}"]},
+		{"schedule": "@daily", "command": ["false"]}
+	]}`))
+	c.Assert(err, IsNil)
+	s := ret.(*Scheduler)
+	at := time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	// only the rows of the window
+	c.Assert(s.runJob(s.jobs[0], at), IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "export", "2018-01-03.csv"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Key,Epoch,Close\nTEST/1Min/OHLCV,1514894400,2\n")
+
+	c.Assert(s.runJob(s.jobs[1], at), IsNil)
+	_, err = os.Stat(filepath.Join(dir, "2018-01-03"))
+	c.Assert(err, IsNil)
+
+	c.Assert(s.runJob(s.jobs[2], at), NotNil)
+}
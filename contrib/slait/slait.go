@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
@@ -20,6 +21,9 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 type SlaitSubscriberConfig struct {
 	Endpoint         string     `json:"endpoint"`
 	Topic            string     `json:"topic"`
@@ -153,6 +153,11 @@ func ColumnSeriesForPayload(cs *io.ColumnSeries) *map[string]interface{} {
 	for key, col := range cs.GetColumns() {
 		s := reflect.ValueOf(col)
 		for i := 0; i < s.Len(); i++ {
+			if !cs.IsValid(key, i) {
+				// missing
+				m[key] = nil
+				break
+			}
 			m[key] = s.Index(i).Interface()
 			break
 		}
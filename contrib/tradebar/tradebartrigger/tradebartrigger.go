@@ -0,0 +1,370 @@
+// TradeBar implements a trigger that builds OHLCV bars from the variable
+// length trade buckets matching the trigger, so that the raw trades ingested
+// are queryable as bars without an external job.  Underlying data schema is
+// expected at least
+// - Price:float32 or float64
+// - Size:any numeric type
+// optionally,
+// - Cond1, Cond2, Cond3 and Cond4:any integer type
+//
+// Example:
+// 	triggers:
+// 	  - module: tradebar.so
+// 	    on: */1Min/TRADE
+// 	    config:
+// 	      destinations:
+// 	        - 1Sec
+// 	        - 1Min
+// 	      exclude_conditions: [15, 16, 17, 18, 19, 51]
+//
+// With the above, a write to AAPL/1Min/TRADE rebuilds the bars of
+// AAPL/1Sec/OHLCV and AAPL/1Min/OHLCV the trades written fall in, from all
+// the trades of those bars, so that late trades are accounted for.  The
+// trades with any of the excluded condition codes, and those without a
+// positive price and size, are left out of the bars.
+package tradebartrigger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/uda"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// DefaultExcludeConditions are the numeric SIP condition codes, as mapped by
+// Polygon, of the trades which do not update the bars: the exchange summary,
+// the opening, reopening and closing prints, and the official open and close.
+var DefaultExcludeConditions = []int{15, 16, 17, 18, 19, 51}
+
+// TradeBarTriggerConfig is the configuration for TradeBarTrigger you can
+// define in marketstore's config file under triggers extension.
+type TradeBarTriggerConfig struct {
+	// Timeframes of the bars, 1Min if omitted
+	Destinations []string `json:"destinations"`
+	// Attribute group of the bars, OHLCV if omitted
+	AttributeGroup string `json:"attribute_group"`
+	// Price and size columns of the trades, Price and Size if omitted
+	Price string `json:"price"`
+	Size  string `json:"size"`
+	// Condition code columns of the trades, Cond1 to Cond4 if omitted, the
+	// columns missing from a bucket being ignored
+	ConditionColumns []string `json:"condition_columns"`
+	// Condition codes of the trades left out of the bars,
+	// DefaultExcludeConditions if omitted
+	ExcludeConditions []int `json:"exclude_conditions"`
+}
+
+// TradeBarTrigger is the main trigger.
+type TradeBarTrigger struct {
+	config       map[string]interface{}
+	destinations []utils.Timeframe
+	group        string
+	price, size  string
+	conditions   []string
+	exclude      map[int]bool
+	// largest destination, the span the trades are read in
+	span time.Duration
+}
+
+var (
+	_         trigger.CheckedTrigger = &TradeBarTrigger{}
+	loadError                        = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *TradeBarTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := TradeBarTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new trade bar trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	if len(config.Destinations) == 0 {
+		config.Destinations = []string{"1Min"}
+	}
+	t := &TradeBarTrigger{
+		config:     conf,
+		group:      config.AttributeGroup,
+		price:      config.Price,
+		size:       config.Size,
+		conditions: config.ConditionColumns,
+		exclude:    map[int]bool{},
+	}
+	for _, dest := range config.Destinations {
+		tf := utils.TimeframeFromString(dest)
+		if tf == nil {
+			log.Error("invalid destination: %s\n", dest)
+			return nil, loadError
+		}
+		if tf.Duration >= utils.Day || utils.Day%tf.Duration != 0 {
+			log.Error("destination %s does not divide a day, aggregate its bars with ondiskagg\n", dest)
+			return nil, loadError
+		}
+		if tf.Duration > t.span {
+			t.span = tf.Duration
+		}
+		t.destinations = append(t.destinations, *tf)
+	}
+	if t.group == "" {
+		t.group = "OHLCV"
+	}
+	if t.price == "" {
+		t.price = "Price"
+	}
+	if t.size == "" {
+		t.size = "Size"
+	}
+	if t.conditions == nil {
+		t.conditions = []string{"Cond1", "Cond2", "Cond3", "Cond4"}
+	}
+	exclude := config.ExcludeConditions
+	if exclude == nil {
+		exclude = DefaultExcludeConditions
+	}
+	for _, code := range exclude {
+		t.exclude[code] = true
+	}
+
+	log.Info("%d destination(s) configured\n", len(t.destinations))
+
+	return t, nil
+}
+
+// Fire implements trigger interface.
+func (s *TradeBarTrigger) Fire(keyPath string, records []trigger.Record) {
+	if err := s.TryFire(keyPath, records); err != nil {
+		log.Error("%v\n", err)
+	}
+}
+
+// TryFire implements trigger.CheckedTrigger, so that the failed writes of
+// the bars are retried and dead-lettered.
+func (s *TradeBarTrigger) TryFire(keyPath string, records []trigger.Record) error {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	// the trades of the intervals written are read along with the others of
+	// the bars they fall in
+	start := head.Truncate(s.span)
+	end := tail.Add(tf.Duration)
+	if ceil := end.Truncate(s.span); ceil.Before(end) {
+		end = ceil.Add(s.span)
+	}
+
+	cs, err := read(tbk, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to read %v (%v)", tbk.String(), err)
+	}
+	if cs == nil || cs.Len() == 0 {
+		return nil
+	}
+	trades, err := s.filter(cs, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to read trades of %v (%v)", tbk.String(), err)
+	}
+	if len(trades.epoch) == 0 {
+		return nil
+	}
+
+	csm := io.NewColumnSeriesMap()
+	for _, dest := range s.destinations {
+		barTbk := io.NewTimeBucketKey(strings.Join([]string{elements[0], dest.String, s.group}, "/"))
+		csm.AddColumnSeries(*barTbk, trades.bars(dest.Duration))
+	}
+	if err := executor.WriteCSM(csm, false); err != nil {
+		return fmt.Errorf("failed to write bars of %v (%v)", tbk.String(), err)
+	}
+	return nil
+}
+
+// trades are the trades of a bucket making up the bars
+type trades struct {
+	epoch []int64
+	price []float64
+	size  []float64
+	// types of the bar columns, those of the trade columns
+	priceType, sizeType io.EnumElementType
+}
+
+// filter returns the trades of the column series in [start, end) with a
+// positive price and size, and none of the excluded condition codes, in time
+// order, the late trades being appended to the trades of their interval
+func (s *TradeBarTrigger) filter(cs *io.ColumnSeries, start, end time.Time) (*trades, error) {
+	for _, name := range []string{s.price, s.size} {
+		if !cs.Exists(name) {
+			return nil, fmt.Errorf("no %s column", name)
+		}
+	}
+	price, err := uda.ColumnToFloat64(cs, s.price)
+	if err != nil {
+		return nil, err
+	}
+	size, err := uda.ColumnToFloat64(cs, s.size)
+	if err != nil {
+		return nil, err
+	}
+	var conditions [][]float64
+	for _, name := range s.conditions {
+		if !cs.Exists(name) {
+			continue
+		}
+		codes, err := uda.ColumnToFloat64(cs, name)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, codes)
+	}
+
+	t := &trades{priceType: io.FLOAT64, sizeType: io.FLOAT64}
+	if _, ok := cs.GetByName(s.price).([]float32); ok {
+		t.priceType = io.FLOAT32
+	}
+	switch cs.GetByName(s.size).(type) {
+	case []float32:
+		t.sizeType = io.FLOAT32
+	case []int32:
+		t.sizeType = io.INT32
+	}
+
+	epoch := cs.GetEpoch()
+	nanos, _ := cs.GetByName("Nanoseconds").([]int32)
+	order := make([]int, len(epoch))
+	for i := range order {
+		order[i] = i
+	}
+	if nanos != nil {
+		sort.SliceStable(order, func(a, b int) bool {
+			i, j := order[a], order[b]
+			return epoch[i] < epoch[j] || epoch[i] == epoch[j] && nanos[i] < nanos[j]
+		})
+	} else {
+		sort.SliceStable(order, func(a, b int) bool { return epoch[order[a]] < epoch[order[b]] })
+	}
+Trades:
+	for _, i := range order {
+		if epoch[i] < start.Unix() || epoch[i] >= end.Unix() || price[i] <= 0 || size[i] <= 0 {
+			continue
+		}
+		for _, codes := range conditions {
+			if s.exclude[int(codes[i])] {
+				continue Trades
+			}
+		}
+		t.epoch = append(t.epoch, epoch[i])
+		t.price = append(t.price, price[i])
+		t.size = append(t.size, size[i])
+	}
+	return t, nil
+}
+
+// bars returns the bars of the trades over the timeframe, with the columns of the types of the trade columns
+func (t *trades) bars(timeframe time.Duration) *io.ColumnSeries {
+	secs := int64(timeframe / time.Second)
+	var (
+		epoch                  []int64
+		open, high, low, close []float64
+		volume                 []float64
+		count                  []int64
+	)
+	for i := range t.epoch {
+		barEpoch := t.epoch[i] - t.epoch[i]%secs
+		price := t.price[i]
+		if n := len(epoch); n == 0 || epoch[n-1] != barEpoch {
+			epoch = append(epoch, barEpoch)
+			open = append(open, price)
+			high = append(high, price)
+			low = append(low, price)
+			close = append(close, price)
+			volume = append(volume, 0)
+			count = append(count, 0)
+		}
+		n := len(epoch) - 1
+		if price > high[n] {
+			high[n] = price
+		}
+		if price < low[n] {
+			low[n] = price
+		}
+		close[n] = price
+		volume[n] += t.size[i]
+		count[n]++
+	}
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Open", convert(open, t.priceType))
+	cs.AddColumn("High", convert(high, t.priceType))
+	cs.AddColumn("Low", convert(low, t.priceType))
+	cs.AddColumn("Close", convert(close, t.priceType))
+	cs.AddColumn("Volume", convert(volume, t.sizeType))
+	cs.AddColumn("TradeCount", count)
+	return cs
+}
+
+// convert returns the values as a column of the element type
+func convert(values []float64, typ io.EnumElementType) interface{} {
+	switch typ {
+	case io.FLOAT32:
+		out := make([]float32, len(values))
+		for i, v := range values {
+			out[i] = float32(v)
+		}
+		return out
+	case io.INT32:
+		out := make([]int32, len(values))
+		for i, v := range values {
+			out[i] = int32(v)
+		}
+		return out
+	}
+	return values
+}
+
+// read returns the trades of the bucket in [start, end)
+func read(tbk *io.TimeBucketKey, start, end time.Time) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	// TODO: subtracting 1 second is not needed once we support "<" operator
+	q.SetRange(start.Unix(), end.Add(-time.Second).Unix())
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	return csm[*tbk], nil
+}
@@ -0,0 +1,143 @@
+package tradebartrigger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	ret, err := NewTrigger(getConfig(`{}`))
+	c.Assert(err, IsNil)
+	trig := ret.(*TradeBarTrigger)
+	c.Assert(trig.destinations, HasLen, 1)
+	c.Assert(trig.destinations[0].String, Equals, "1Min")
+	c.Assert(trig.group, Equals, "OHLCV")
+	c.Assert(trig.conditions, DeepEquals, []string{"Cond1", "Cond2", "Cond3", "Cond4"})
+	c.Assert(trig.exclude[51], Equals, true)
+
+	ret, err = NewTrigger(getConfig(`{
+        "destinations": ["1Sec", "5Min"],
+        "exclude_conditions": []
+        }`))
+	c.Assert(err, IsNil)
+	trig = ret.(*TradeBarTrigger)
+	c.Assert(trig.span, Equals, 5*time.Minute)
+	c.Assert(trig.exclude, HasLen, 0)
+
+	for _, config := range []string{
+		`{"destinations": ["1Fortnight"]}`,
+		`{"destinations": ["7Min"]}`,
+		`{"destinations": ["1D"]}`,
+	} {
+		ret, err = NewTrigger(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	trig, err := NewTrigger(getConfig(`{"destinations": ["1Sec", "1Min"]}`))
+	c.Assert(err, IsNil)
+
+	base := time.Date(2017, 12, 14, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+	times := []time.Time{
+		at(100 * time.Millisecond),
+		at(500 * time.Millisecond),
+		// an opening print, left out
+		at(700 * time.Millisecond),
+		at(1200 * time.Millisecond),
+		at(time.Minute + 300*time.Millisecond),
+	}
+	write := func(times []time.Time, price []float32, size []int32, cond []int32) {
+		epoch := make([]int64, len(times))
+		nanos := make([]int32, len(times))
+		for i, ts := range times {
+			epoch[i] = ts.Unix()
+			nanos[i] = int32(ts.Nanosecond())
+		}
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", epoch)
+		cs.AddColumn("Price", price)
+		cs.AddColumn("Size", size)
+		cs.AddColumn("Cond1", cond)
+		cs.AddColumn("Nanoseconds", nanos)
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*io.NewTimeBucketKey("TEST/1Min/TRADE"), cs)
+		c.Assert(executor.WriteCSM(csm, true), IsNil)
+	}
+	write(times[:2], []float32{10., 11.}, []int32{100, 200}, []int32{0, 0})
+	// written after the trades of the same interval after them
+	write(times[2:], []float32{20., 9., 12.}, []int32{50, 300, 400}, []int32{19, 0, 0})
+	write([]time.Time{at(300 * time.Millisecond)}, []float32{8.}, []int32{10}, []int32{0})
+
+	// fired for the second minute only, which is rebuilt alone
+	index := func(ts time.Time) trigger.Record {
+		buf, _ := io.Serialize(nil, io.TimeToIndex(ts, time.Minute))
+		return trigger.Record(buf)
+	}
+	trig.Fire("TEST/1Min/TRADE/2017.bin", []trigger.Record{index(times[4])})
+	minCs := readBars(c, "TEST/1Min/OHLCV")
+	c.Assert(minCs.GetEpoch(), DeepEquals, []int64{at(time.Minute).Unix()})
+
+	trig.Fire("TEST/1Min/TRADE/2017.bin", []trigger.Record{index(times[0]), index(times[4])})
+
+	secCs := readBars(c, "TEST/1Sec/OHLCV")
+	c.Assert(secCs.GetEpoch(), DeepEquals, []int64{base.Unix(), at(time.Second).Unix(), at(time.Minute).Unix()})
+	c.Assert(secCs.GetByName("Open"), DeepEquals, []float32{10., 9., 12.})
+	c.Assert(secCs.GetByName("High"), DeepEquals, []float32{11., 9., 12.})
+	c.Assert(secCs.GetByName("Low"), DeepEquals, []float32{8., 9., 12.})
+	c.Assert(secCs.GetByName("Close"), DeepEquals, []float32{11., 9., 12.})
+	c.Assert(secCs.GetByName("Volume"), DeepEquals, []int32{310, 300, 400})
+	c.Assert(secCs.GetByName("TradeCount"), DeepEquals, []int64{3, 1, 1})
+
+	minCs = readBars(c, "TEST/1Min/OHLCV")
+	c.Assert(minCs.GetEpoch(), DeepEquals, []int64{base.Unix(), at(time.Minute).Unix()})
+	c.Assert(minCs.GetByName("Open"), DeepEquals, []float32{10., 12.})
+	c.Assert(minCs.GetByName("Close"), DeepEquals, []float32{9., 12.})
+	c.Assert(minCs.GetByName("Volume"), DeepEquals, []int32{610, 400})
+}
+
+func readBars(c *C, key string) *io.ColumnSeries {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	tbk := io.NewTimeBucketKey(key)
+	q.AddTargetKey(tbk)
+	q.SetRange(planner.MinEpoch, planner.MaxEpoch)
+	parsed, err := q.Parse()
+	c.Assert(err, IsNil)
+	scanner, err := executor.NewReader(parsed)
+	c.Assert(err, IsNil)
+	csm, err := scanner.Read()
+	c.Assert(err, IsNil)
+	c.Assert(csm[*tbk], NotNil)
+	return csm[*tbk]
+}
@@ -0,0 +1,273 @@
+// Webhook implements a trigger that POSTs a JSON summary of the writes to the
+// buckets matching the trigger to the configured URLs, so that downstream
+// systems can act on new data without polling.
+//
+// Example:
+// 	triggers:
+// 	  - module: webhook.so
+// 	    on: */1Min/OHLCV
+// 	    config:
+// 	      urls:
+// 	        - https://example.com/hooks/marketstore
+// 	      headers:
+// 	        Authorization: Bearer secret
+// 	      include_rows: true
+//
+// Each write is summarized as its bucket, the epochs of its first and last
+// records and its number of records, and with include_rows also carries the
+// rows written, read back from the bucket by column.  The notifications are
+// queued and sent in the background, so that the writes are not held up by
+// the webhooks, and are dropped when the queue is full.
+package webhooktrigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// WebhookTriggerConfig is the configuration for WebhookTrigger you can define
+// in marketstore's config file under triggers extension.
+type WebhookTriggerConfig struct {
+	URLs []string `json:"urls"`
+	// Headers added to the requests, e.g. for authentication
+	Headers map[string]string `json:"headers"`
+	// Send the rows written along with the summary
+	IncludeRows bool `json:"include_rows"`
+	// Timeout of each request, 5s if omitted
+	Timeout string `json:"timeout"`
+	// Attempts after a failed request, 3 if omitted
+	Retries *int `json:"retries"`
+	// Notifications waiting to be sent, 1000 if omitted
+	QueueSize int `json:"queue_size"`
+}
+
+// Notification is the JSON body POSTed for each write.
+type Notification struct {
+	// Bucket key, e.g. AAPL/1Min/OHLCV
+	Bucket string `json:"bucket"`
+	// Epochs of the first and last records written
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Number of records written
+	Rows int `json:"rows"`
+	// Rows written by column, with include_rows
+	Columns map[string]interface{} `json:"columns,omitempty"`
+}
+
+// WebhookTrigger is the main trigger.
+type WebhookTrigger struct {
+	config      map[string]interface{}
+	urls        []string
+	headers     map[string]string
+	includeRows bool
+	retries     int
+	// delay before the first retry, doubled for each following one
+	backoff time.Duration
+	client  *http.Client
+	queue   chan *Notification
+}
+
+var (
+	_         trigger.Trigger = &WebhookTrigger{}
+	loadError                 = errors.New("plugin load error")
+)
+
+func recast(config map[string]interface{}) *WebhookTriggerConfig {
+	data, _ := json.Marshal(config)
+	ret := WebhookTriggerConfig{}
+	json.Unmarshal(data, &ret)
+	return &ret
+}
+
+// NewTrigger returns a new webhook trigger based on the configuration.
+func NewTrigger(conf map[string]interface{}) (trigger.Trigger, error) {
+	config := recast(conf)
+
+	if len(config.URLs) == 0 {
+		log.Warn("no urls are configured\n")
+		return nil, loadError
+	}
+	for _, url := range config.URLs {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			log.Error("invalid webhook url: %s\n", url)
+			return nil, loadError
+		}
+	}
+
+	timeout := 5 * time.Second
+	if config.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Timeout); err != nil {
+			log.Error("invalid timeout: %s\n", config.Timeout)
+			return nil, loadError
+		}
+	}
+	retries := 3
+	if config.Retries != nil {
+		retries = *config.Retries
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	log.Info("%d webhook(s) configured\n", len(config.URLs))
+
+	t := &WebhookTrigger{
+		config:      conf,
+		urls:        config.URLs,
+		headers:     config.Headers,
+		includeRows: config.IncludeRows,
+		retries:     retries,
+		backoff:     time.Second,
+		client:      &http.Client{Timeout: timeout},
+		queue:       make(chan *Notification, queueSize),
+	}
+	go t.run()
+	return t, nil
+}
+
+// Fire implements trigger interface.
+func (s *WebhookTrigger) Fire(keyPath string, records []trigger.Record) {
+	elements := strings.Split(keyPath, "/")
+	tf := utils.NewTimeframe(elements[1])
+	fileName := elements[len(elements)-1]
+	year, _ := strconv.Atoi(strings.Replace(fileName, ".bin", "", 1))
+	tbk := io.NewTimeBucketKey(strings.Join(elements[:len(elements)-1], "/"))
+
+	head := io.IndexToTime(
+		records[0].Index(),
+		tf.Duration,
+		int16(year))
+
+	tail := io.IndexToTime(
+		records[len(records)-1].Index(),
+		tf.Duration,
+		int16(year))
+
+	n := &Notification{
+		Bucket: tbk.GetItemKey(),
+		Start:  head.Unix(),
+		End:    tail.Unix(),
+		Rows:   len(records),
+	}
+	if s.includeRows {
+		columns, err := readRows(tbk, head, tail.Add(tf.Duration-time.Second))
+		if err != nil {
+			log.Error("failed to read the rows written to %v (%v)\n", tbk.String(), err)
+			return
+		}
+		n.Columns = columns
+	}
+
+	select {
+	case s.queue <- n:
+	default:
+		log.Error("webhook queue is full, dropping the notification of %v\n", tbk.String())
+	}
+}
+
+// readRows returns the rows of the bucket between start and end by column
+func readRows(tbk *io.TimeBucketKey, start, end time.Time) (map[string]interface{}, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(tbk)
+	q.SetRange(start.Unix(), end.Unix())
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	cs := csm[*tbk]
+	if cs == nil {
+		return nil, nil
+	}
+	return cs.GetColumns(), nil
+}
+
+// run sends the queued notifications to every URL
+func (s *WebhookTrigger) run() {
+	for n := range s.queue {
+		body, err := json.Marshal(n)
+		if err != nil {
+			log.Error("failed to encode the notification of %v (%v)\n", n.Bucket, err)
+			continue
+		}
+		for _, url := range s.urls {
+			if err = s.send(url, body); err != nil {
+				log.Error("failed to notify %v of %v (%v)\n", url, n.Bucket, err)
+			}
+		}
+	}
+}
+
+// send POSTs the body to the URL, retrying on network and server errors
+func (s *WebhookTrigger) send(url string, body []byte) (err error) {
+	backoff := s.backoff
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = s.post(url, body); err == nil {
+			return nil
+		}
+		if _, ok := err.(clientError); ok {
+			// the request would be refused again
+			return err
+		}
+	}
+	return err
+}
+
+// clientError is a 4xx response
+type clientError struct {
+	status string
+}
+
+func (e clientError) Error() string {
+	return e.status
+}
+
+func (s *WebhookTrigger) post(url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%s", resp.Status)
+	case resp.StatusCode >= 400:
+		return clientError{status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package webhooktrigger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&TestSuite{})
+
+type TestSuite struct{}
+
+func getConfig(data string) (ret map[string]interface{}) {
+	json.Unmarshal([]byte(data), &ret)
+	return
+}
+
+func (t *TestSuite) TestNew(c *C) {
+	ret, err := NewTrigger(getConfig(`{
+        "urls": ["http://localhost:8080/hook"],
+        "timeout": "1s",
+        "retries": 0
+        }`))
+	c.Assert(err, IsNil)
+	trig := ret.(*WebhookTrigger)
+	c.Assert(trig.urls, DeepEquals, []string{"http://localhost:8080/hook"})
+	c.Assert(trig.client.Timeout, Equals, time.Second)
+	c.Assert(trig.retries, Equals, 0)
+	c.Assert(cap(trig.queue), Equals, 1000)
+
+	for _, config := range []string{
+		`{}`,
+		`{"urls": ["localhost:8080/hook"]}`,
+		`{"urls": ["http://localhost:8080/hook"], "timeout": "1 second"}`,
+	} {
+		ret, err = NewTrigger(getConfig(config))
+		c.Assert(ret, IsNil)
+		c.Assert(err, NotNil, Commentf(config))
+	}
+}
+
+func (t *TestSuite) TestFire(c *C) {
+	utils.InstanceConfig.Timezone = time.UTC
+
+	rootDir := filepath.Join(c.MkDir(), "mktsdb")
+	os.MkdirAll(rootDir, 0777)
+	executor.NewInstanceSetup(
+		rootDir,
+		true, true, false, false)
+
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request fails and is retried
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	ret, err := NewTrigger(getConfig(`{
+        "urls": ["` + server.URL + `"],
+        "headers": {"Authorization": "Bearer secret"},
+        "include_rows": true
+        }`))
+	c.Assert(err, IsNil)
+	trig := ret.(*WebhookTrigger)
+	trig.backoff = time.Millisecond
+
+	epoch := []int64{
+		time.Date(2017, 12, 14, 10, 3, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 14, 10, 4, 0, 0, time.UTC).Unix(),
+		time.Date(2017, 12, 14, 10, 5, 0, 0, time.UTC).Unix(),
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epoch)
+	cs.AddColumn("Close", []float32{1., 2., 3.})
+	tbk := io.NewTimeBucketKey("TEST/1Min/OHLC")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	// fire with the last two records only
+	rs := cs.ToRowSeries(*tbk, true)
+	rowData := rs.GetData()
+	times := rs.GetTime()
+	rowLen := len(rowData) / len(times)
+	records := make([]trigger.Record, 0, 2)
+	for i := 1; i < len(times); i++ {
+		record := rowData[i*rowLen : (i+1)*rowLen]
+		buf, _ := io.Serialize(nil, io.TimeToIndex(times[i], time.Minute))
+		records = append(records, trigger.Record(append(buf, record[8:]...)))
+	}
+	trig.Fire("TEST/1Min/OHLC/2017.bin", records)
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the webhook was not notified")
+	}
+	c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+	c.Assert(r.Header.Get("Authorization"), Equals, "Bearer secret")
+
+	var n struct {
+		Notification
+		Columns map[string][]float64 `json:"columns"`
+	}
+	c.Assert(json.Unmarshal(<-bodies, &n), IsNil)
+	c.Assert(n.Bucket, Equals, "TEST/1Min/OHLC")
+	c.Assert(n.Start, Equals, epoch[1])
+	c.Assert(n.End, Equals, epoch[2])
+	c.Assert(n.Rows, Equals, 2)
+	c.Assert(n.Columns["Epoch"], DeepEquals, []float64{float64(epoch[1]), float64(epoch[2])})
+	c.Assert(n.Columns["Close"], DeepEquals, []float64{2., 3.})
+}
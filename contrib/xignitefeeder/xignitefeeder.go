@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/alpacahq/marketstore/plugins/abi"
 	"github.com/alpacahq/marketstore/utils"
 	"time"
 
@@ -17,6 +18,9 @@ import (
 	"github.com/pkg/errors"
 )
 
+// MarketstoreABI is the version of the plugin interface the module is built against
+var MarketstoreABI = abi.Version
+
 // NewBgWorker returns the new instance of XigniteFeeder.
 // See configs.Config for the details of available configurations.
 // nolint
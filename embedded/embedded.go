@@ -0,0 +1,199 @@
+// Package embedded opens a data directory in-process, for research tools
+// and batch jobs to use the storage engine of marketstore as a library,
+// without starting the server.
+//
+//	db, err := embedded.Open("/data/mktsdb", nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//	cs, err := db.Read("AAPL/1Min/OHLCV", start, end)
+//
+// The storage engine is a singleton, so that a process opens one data
+// directory at a time, and the directory should not be opened by a running
+// server meanwhile.  The queries are those of the Query RPC, built with
+// frontend.NewQueryRequestBuilder, including the functions, the
+// aggregations and the SQL statements.
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+var (
+	// ErrOpen is returned by Open while another data directory is open
+	ErrOpen = errors.New("a data directory is already open in the process")
+	// ErrClosed is returned by the methods of a closed DB
+	ErrClosed = errors.New("the data directory is closed")
+
+	mu   sync.Mutex
+	open *DB
+)
+
+// Options of the data directory opened
+type Options struct {
+	// WAL writes through the write-ahead log, replayed on the next opening
+	// after a crash, the writes being readable once flushed, every 500ms
+	// or on Flush.  Without it, the writes go straight to the data files.
+	WAL bool
+	// Timezone by which the records are split into days and aggregated,
+	// UTC by default
+	Timezone *time.Location
+}
+
+// DB is a data directory opened in-process
+type DB struct {
+	dir     string
+	options Options
+	service *frontend.DataService
+}
+
+// Open opens the data directory, created if it does not exist, replaying
+// its WAL if it was not closed
+func Open(dir string, options *Options) (*DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if open != nil {
+		return nil, ErrOpen
+	}
+	if options == nil {
+		options = &Options{}
+	}
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %v", dir, err)
+	}
+	db := &DB{dir: dir, options: *options, service: &frontend.DataService{}}
+	if db.options.Timezone == nil {
+		db.options.Timezone = time.UTC
+	}
+	utils.InstanceConfig.RootDirectory = dir
+	utils.InstanceConfig.Timezone = db.options.Timezone
+	if utils.InstanceConfig.WALRotateInterval == 0 {
+		utils.InstanceConfig.WALRotateInterval = 5
+	}
+	executor.NewInstanceSetup(dir, true, true, db.options.WAL, !db.options.WAL)
+	db.service.Init()
+	atomic.StoreUint32(&frontend.Queryable, 1)
+	open = db
+	return db, nil
+}
+
+// Dir returns the data directory
+func (db *DB) Dir() string {
+	return db.dir
+}
+
+func (db *DB) check() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if open != db {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Write writes the column series to their buckets, created if they do not
+// exist, of variable length records if variableLength, e.g. the ticks
+func (db *DB) Write(csm io.ColumnSeriesMap, variableLength bool) error {
+	if err := db.check(); err != nil {
+		return err
+	}
+	return executor.WriteCSM(csm, variableLength)
+}
+
+// Flush makes the writes so far readable, those written through the WAL
+// being otherwise flushed every 500ms
+func (db *DB) Flush() error {
+	if err := db.check(); err != nil {
+		return err
+	}
+	if db.options.WAL {
+		executor.ThisInstance.WALFile.RequestFlush()
+	}
+	return nil
+}
+
+// Query runs the queries, returning the result of each in order
+func (db *DB) Query(reqs ...frontend.QueryRequest) ([]io.ColumnSeriesMap, error) {
+	if err := db.check(); err != nil {
+		return nil, err
+	}
+	var response frontend.MultiQueryResponse
+	err := db.service.Query(nil, &frontend.MultiQueryRequest{Requests: reqs}, &response)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]io.ColumnSeriesMap, len(response.Responses))
+	for i, resp := range response.Responses {
+		if resp.Result == nil {
+			// the results in CSV format are in the CSV of the response
+			continue
+		}
+		if results[i], err = resp.Result.ToColumnSeriesMap(); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Read returns the records of the bucket with the item key, e.g.
+// "AAPL/1Min/OHLCV", from start until end, included, nil if it has none
+func (db *DB) Read(key string, start, end time.Time) (*io.ColumnSeries, error) {
+	req := frontend.NewQueryRequestBuilder(key).
+		EpochStart(start.Unix()).EpochStartNanos(start.UnixNano()).
+		EpochEnd(end.Unix()).EpochEndNanos(end.UnixNano()).
+		End()
+	results, err := db.Query(req)
+	if err != nil {
+		if errors.Is(err, planner.ErrNoFiles) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, cs := range results[0] {
+		return cs, nil
+	}
+	return nil, nil
+}
+
+// Symbols returns the sorted symbols of the buckets of the directory
+func (db *DB) Symbols() ([]string, error) {
+	if err := db.check(); err != nil {
+		return nil, err
+	}
+	symbols := []string{}
+	for symbol := range executor.ThisInstance.CatalogDir.GatherCategoriesAndItems()["Symbol"] {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols, nil
+}
+
+// Close flushes the pending writes to the data files and closes the
+// directory, which may then be opened again, this one or another
+func (db *DB) Close() error {
+	if err := db.check(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := executor.Shutdown(ctx)
+	atomic.StoreUint32(&frontend.Queryable, 0)
+	mu.Lock()
+	open = nil
+	mu.Unlock()
+	return err
+}
@@ -0,0 +1,93 @@
+package embedded
+
+import (
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type EmbeddedTestSuite struct{}
+
+var _ = Suite(&EmbeddedTestSuite{})
+
+func bars(start time.Time, n int) io.ColumnSeriesMap {
+	epochs := make([]int64, n)
+	closes := make([]float32, n)
+	for i := range epochs {
+		epochs[i] = start.Add(time.Duration(i) * time.Minute).Unix()
+		closes[i] = float32(100 + i)
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epochs)
+	for _, name := range []string{"Open", "High", "Low", "Close"} {
+		cs.AddColumn(name, closes)
+	}
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("AAPL/1Min/OHLCV"), cs)
+	return csm
+}
+
+func (s *EmbeddedTestSuite) TestOpen(c *C) {
+	dir := c.MkDir() + "/mktsdb"
+	start := time.Date(2024, time.March, 4, 14, 30, 0, 0, time.UTC)
+	for _, options := range []*Options{nil, {WAL: true}} {
+		db, err := Open(dir, options)
+		c.Assert(err, IsNil)
+		_, err = Open(dir, nil)
+		c.Assert(err, Equals, ErrOpen)
+
+		c.Assert(db.Write(bars(start, 10), false), IsNil)
+		c.Assert(db.Flush(), IsNil)
+		cs, err := db.Read("AAPL/1Min/OHLCV", start, start.Add(4*time.Minute))
+		c.Assert(err, IsNil)
+		c.Assert(cs.Len(), Equals, 5)
+		c.Assert(cs.GetByName("Close"), DeepEquals, []float32{100, 101, 102, 103, 104})
+
+		symbols, err := db.Symbols()
+		c.Assert(err, IsNil)
+		c.Assert(symbols, DeepEquals, []string{"AAPL"})
+		cs, err = db.Read("MSFT/1Min/OHLCV", start, start.Add(time.Hour))
+		c.Assert(err, IsNil)
+		c.Assert(cs, IsNil)
+
+		c.Assert(db.Close(), IsNil)
+		c.Assert(db.Write(bars(start, 1), false), Equals, ErrClosed)
+		c.Assert(db.Close(), Equals, ErrClosed)
+
+		// the writes are in the data files once closed
+		db, err = Open(dir, options)
+		c.Assert(err, IsNil)
+		cs, err = db.Read("AAPL/1Min/OHLCV", start, start.Add(time.Hour))
+		c.Assert(err, IsNil)
+		c.Assert(cs.Len(), Equals, 10)
+		c.Assert(db.Close(), IsNil)
+	}
+}
+
+func (s *EmbeddedTestSuite) TestQuery(c *C) {
+	db, err := Open(c.MkDir(), nil)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	start := time.Date(2024, time.March, 4, 14, 30, 0, 0, time.UTC)
+	c.Assert(db.Write(bars(start, 10), false), IsNil)
+
+	results, err := db.Query(
+		frontend.NewQueryRequestBuilder("AAPL/1Min/OHLCV").LimitRecordCount(3).End(),
+		frontend.NewQueryRequestBuilder("AAPL/1Min/OHLCV").
+			Functions([]string{"candlecandler('5Min',Open,High,Low,Close)"}).End(),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	cs := results[0][*io.NewTimeBucketKey("AAPL/1Min/OHLCV")]
+	c.Assert(cs.GetByName("Close"), DeepEquals, []float32{107, 108, 109})
+	c.Assert(results[1], HasLen, 1)
+	for _, cs := range results[1] {
+		c.Assert(cs.GetByName("Close"), DeepEquals, []float32{104, 109})
+	}
+}
@@ -712,6 +712,74 @@ func (s *TestSuite) TestWriter(c *C) {
 	s.WALFile.createCheckpoint()
 }
 
+func (s *TestSuite) TestWriteDeduplicated(c *C) {
+	c.Assert(utils.InstanceConfig.SetDeduplicate([]string{"*/1Min/TRADE"}), IsNil)
+	defer utils.InstanceConfig.SetDeduplicate(nil)
+
+	ticks := []time.Time{
+		time.Date(2016, time.March, 1, 10, 0, 1, 123456789, time.UTC),
+		time.Date(2016, time.March, 1, 10, 0, 2, 0, time.UTC),
+		time.Date(2016, time.March, 1, 10, 1, 3, 500, time.UTC),
+	}
+	write := func(key string, ticks []time.Time, price []float32) {
+		epoch := make([]int64, len(ticks))
+		nanos := make([]int32, len(ticks))
+		for i, t := range ticks {
+			epoch[i] = t.Unix()
+			nanos[i] = int32(t.Nanosecond())
+		}
+		cs := NewColumnSeries()
+		cs.AddColumn("Epoch", epoch)
+		cs.AddColumn("Price", price)
+		cs.AddColumn("Nanoseconds", nanos)
+		csm := NewColumnSeriesMap()
+		csm.AddColumnSeries(*NewTimeBucketKey(key), cs)
+		c.Assert(WriteCSM(csm, true), IsNil)
+	}
+	read := func(key string) *ColumnSeries {
+		cs, err := readRange(*NewTimeBucketKey(key), ticks[0].Unix(), ticks[2].Unix())
+		c.Assert(err, IsNil)
+		return cs
+	}
+
+	// duplicates within the write
+	write("DEDUP/1Min/TRADE", append(ticks, ticks[0]), []float32{1., 2., 3., 1.})
+	c.Assert(read("DEDUP/1Min/TRADE").Len(), Equals, 3)
+
+	// the replayed ticks are dropped, but the new ones and those of the
+	// same time with other values
+	write("DEDUP/1Min/TRADE", ticks, []float32{1., 2., 4.})
+	cs := read("DEDUP/1Min/TRADE")
+	c.Assert(cs.GetByName("Price").([]float32), DeepEquals, []float32{1., 2., 3., 4.})
+
+	// not configured
+	write("DEDUP/1Min/QUOTE", ticks, []float32{1., 2., 3.})
+	write("DEDUP/1Min/QUOTE", ticks, []float32{1., 2., 3.})
+	c.Assert(read("DEDUP/1Min/QUOTE").Len(), Equals, 6)
+}
+
+func (s *TestSuite) TestWriteNotOwned(c *C) {
+	utils.InstanceConfig.ShardName = "a"
+	utils.InstanceConfig.Shards = []*utils.ShardSetting{
+		{Name: "a", Symbols: []string{"OWNED"}},
+		{Name: "b", URL: "http://b:5993/", Symbols: []string{"*"}},
+	}
+	defer func() { utils.InstanceConfig.ShardName, utils.InstanceConfig.Shards = "", nil }()
+
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{time.Date(2016, time.March, 1, 10, 0, 0, 0, time.UTC).Unix()})
+	cs.AddColumn("Price", []float32{1.})
+	csm := NewColumnSeriesMap()
+	csm.AddColumnSeries(*NewTimeBucketKey("OWNED/1Min/PRICE"), cs)
+	c.Assert(WriteCSM(csm, false), IsNil)
+
+	csm.AddColumnSeries(*NewTimeBucketKey("OTHER/1Min/PRICE"), cs)
+	err := WriteCSM(csm, false)
+	c.Assert(err, FitsTypeOf, SymbolNotOwnedError(""))
+	_, err = ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(NewTimeBucketKey("OTHER/1Min/PRICE"))
+	c.Assert(err, NotNil)
+}
+
 func (s *DestructiveWALTests) SetUpSuite(c *C) {
 	s.Rootdir = c.MkDir()
 	s.ItemsWritten = MakeDummyCurrencyDir(s.Rootdir, true, false)
@@ -783,6 +851,43 @@ func (s *DestructiveWALTests) TestWALWrite(c *C) {
 
 }
 
+func (s *DestructiveWALTests) TestWALTransactions(c *C) {
+	var err error
+	s.WALFile, err = NewWALFile(s.Rootdir, "")
+	c.Assert(err, IsNil)
+	tgc := NewTransactionPipe()
+	TGID := tgc.TGID()
+	_, err = addTGData(s.DataDirectory, tgc, 100, false)
+	c.Assert(err, IsNil)
+	c.Assert(s.WALFile.flushToWAL(tgc), IsNil)
+
+	txns, err := s.WALFile.Transactions()
+	c.Assert(err, IsNil)
+	c.Assert(txns, HasLen, 1)
+	c.Assert(txns[0].TGID, Equals, TGID)
+	c.Assert(txns[0].Status, Equals, COMMITCOMPLETE)
+	c.Assert(txns[0].Checkpointed, Equals, false)
+	c.Assert(txns[0].Writes, HasLen, 300)
+	keys := map[string]int{}
+	for _, write := range txns[0].Writes {
+		c.Assert(write.RecordType, Equals, FIXED)
+		c.Assert(write.Index > 0, Equals, true)
+		keys[filepath.Dir(write.WALKeyPath)] += write.Records
+	}
+	c.Assert(keys, DeepEquals, map[string]int{
+		"EURUSD/1Min/OHLC": 100, "NZDUSD/1Min/OHLC": 100, "USDJPY/1Min/OHLC": 100,
+	})
+
+	c.Assert(s.WALFile.createCheckpoint(), IsNil)
+	txns, err = s.WALFile.Transactions()
+	c.Assert(err, IsNil)
+	c.Assert(txns[0].Checkpointed, Equals, true)
+	s.WALFile.WriteStatus(OPEN, REPLAYED)
+	if s.WALFile.CanDeleteSafely() {
+		s.WALFile.Delete()
+	}
+}
+
 func (s *DestructiveWALTests) TestBrokenWAL(c *C) {
 	var err error
 
@@ -0,0 +1,169 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupManifest is the file of a backup listing the files it holds
+const BackupManifest = "MANIFEST.json"
+
+// Manifest lists the files of a backup, so that a restore can verify them
+type Manifest struct {
+	Created time.Time      `json:"created"`
+	Files   []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	// Path relative to the root directory
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Size returns the bytes of the files of the backup
+func (m *Manifest) Size() (size int64) {
+	for _, f := range m.Files {
+		size += f.Size
+	}
+	return size
+}
+
+// Backup copies the files of the root directory into the destination
+// directory, which must not exist or be empty, as of a single point in time
+// while the instance keeps running, with a manifest of them.  The WAL files
+// are left out, their transactions being flushed to the primary files first.
+func Backup(dest string) (*Manifest, error) {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dest)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("backup directory %s is not empty", dest)
+	}
+
+	manifest := &Manifest{}
+	err = ThisInstance.WALFile.Snapshot(func() error {
+		manifest.Created = time.Now().UTC()
+		return filepath.Walk(ThisInstance.RootDir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() || filepath.Ext(path) == ".walfile" {
+				return nil
+			}
+			rel, _ := filepath.Rel(ThisInstance.RootDir, path)
+			file, err := copyFile(path, filepath.Join(dest, rel))
+			if err != nil {
+				return err
+			}
+			file.Path = filepath.ToSlash(rel)
+			manifest.Files = append(manifest.Files, *file)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return manifest, ioutil.WriteFile(filepath.Join(dest, BackupManifest), data, 0600)
+}
+
+// VerifyBackup returns the manifest of the backup, or an error if one of its
+// files is missing or differs from the manifest
+func VerifyBackup(src string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(src, BackupManifest))
+	if err != nil {
+		return nil, fmt.Errorf("no manifest in %s (%v)", src, err)
+	}
+	manifest := &Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s (%v)", src, err)
+	}
+	for _, want := range manifest.Files {
+		got, err := hashFile(filepath.Join(src, filepath.FromSlash(want.Path)))
+		if err != nil {
+			return nil, err
+		}
+		if got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return nil, fmt.Errorf("%s differs from the manifest", want.Path)
+		}
+	}
+	return manifest, nil
+}
+
+// Restore verifies the backup and copies its files into the root directory
+// of a stopped instance, which must hold no database files
+func Restore(src, rootDir string) (*Manifest, error) {
+	manifest, err := VerifyBackup(src)
+	if err != nil {
+		return nil, err
+	}
+	matches, _ := filepath.Glob(filepath.Join(rootDir, "*", "*", "*", "*.bin"))
+	if len(matches) > 0 {
+		return nil, fmt.Errorf("%s already holds database files", rootDir)
+	}
+	for _, f := range manifest.Files {
+		path := filepath.FromSlash(f.Path)
+		if _, err = copyFile(filepath.Join(src, path), filepath.Join(rootDir, path)); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// copyFile copies the file, creating the directories of the destination, and
+// returns its size and checksum
+func copyFile(src, dest string) (*ManifestFile, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	if err = os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestFile{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func hashFile(path string) (*ManifestFile, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, in)
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestFile{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
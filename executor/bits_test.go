@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type BitsTests struct{}
+
+var _ = Suite(&BitsTests{})
+
+func (s *BitsTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *BitsTests) TestBoolColumns(c *C) {
+	start := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).Unix()
+	write := func(tbk *io.TimeBucketKey) {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{start, start + 60, start + 120})
+		cs.AddColumn("Close", []float32{1, 2, 3})
+		cs.AddColumn("Halted", []bool{false, true, false})
+		cs.AddColumn("OddLot", []bool{true, true, false})
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*tbk, cs)
+		c.Assert(WriteCSM(csm, false), IsNil)
+	}
+	read := func(tbk *io.TimeBucketKey) {
+		cs, err := readRange(*tbk, start, start+180)
+		c.Assert(err, IsNil)
+		c.Assert(cs.GetByName("Halted"), DeepEquals, []bool{false, true, false})
+		c.Assert(cs.GetByName("OddLot"), DeepEquals, []bool{true, true, false})
+		c.Assert(cs.GetByName("Close"), DeepEquals, []float32{1, 2, 3})
+	}
+
+	// the flags share a byte of the records of the buckets created by writes
+	tbk := io.NewTimeBucketKey("AAPL/1Min/OHLCV")
+	write(tbk)
+	read(tbk)
+	tbi, err := ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(tbi.GetElementTypes(), DeepEquals, []io.EnumElementType{io.FLOAT32, io.BIT, io.BIT})
+	c.Assert(tbi.GetRecordLength(), Equals, int32(io.AlignedSize(8+4+1)))
+
+	// a byte per value in the BOOL buckets
+	tbk = io.NewTimeBucketKey("MSFT/1Min/OHLCV")
+	dsv := []io.DataShape{
+		{Name: "Close", Type: io.FLOAT32},
+		{Name: "Halted", Type: io.BOOL},
+		{Name: "OddLot", Type: io.BOOL},
+	}
+	tf := utils.NewTimeframe("1Min")
+	tbi = io.NewTimeBucketInfo(*tf, tbk.GetPathToYearFiles(ThisInstance.RootDir), "Test", int16(2018), dsv, io.FIXED)
+	c.Assert(ThisInstance.CatalogDir.AddTimeBucket(tbk, tbi), IsNil)
+	write(tbk)
+	read(tbk)
+}
@@ -15,6 +15,10 @@ import (
 */
 const WriteChannelCommandDepth = 1000000
 
+// writeBufferShare is the divisor of the memory limit giving the size of the
+// data the writes are coalesced into before it is flushed
+const writeBufferShare = 16
+
 type WriteCommand struct {
 	RecordType    io.EnumRecordType
 	WALKeyPath    string
@@ -32,8 +36,13 @@ func (wc *WriteCommand) toString() string {
 // and writes it to WAL when flush() is called
 type TransactionPipe struct {
 	tgID         int64              // Current transaction group ID
+	pendingBytes int64              // Size of the data of the queued write commands
 	writeChannel chan *WriteCommand // Channel for write commands
 	flushChannel chan chan struct{} // Channel for flush request
+	// Channel for snapshot requests, run with the writes held
+	snapshotChannel chan func()
+	// Channel for the shutdown request of the WAL writer
+	shutdownChannel chan struct{}
 }
 
 // NewTransactionPipe creates a new transaction pipe that channels all
@@ -43,10 +52,31 @@ func NewTransactionPipe() *TransactionPipe {
 	// Allocate the write channel with enough depth to allow all conceivable writers concurrent access
 	tgc.writeChannel = make(chan *WriteCommand, WriteChannelCommandDepth)
 	tgc.flushChannel = make(chan chan struct{}, WriteChannelCommandDepth)
+	tgc.snapshotChannel = make(chan func())
+	tgc.shutdownChannel = make(chan struct{})
 	tgc.NewTGID()
 	return tgc
 }
 
+// queue queues the write command for the next flush
+func (tgc *TransactionPipe) queue(cc *WriteCommand) {
+	atomic.AddInt64(&tgc.pendingBytes, int64(len(cc.Data)))
+	tgc.writeChannel <- cc
+}
+
+// dequeue takes the next write command to flush
+func (tgc *TransactionPipe) dequeue() *WriteCommand {
+	cc := <-tgc.writeChannel
+	atomic.AddInt64(&tgc.pendingBytes, -int64(len(cc.Data)))
+	return cc
+}
+
+// PendingBytes returns the size of the data of the write commands waiting
+// for the next flush
+func (tgc *TransactionPipe) PendingBytes() int64 {
+	return atomic.LoadInt64(&tgc.pendingBytes)
+}
+
 // NewTGID monotonically increases the transaction group ID using
 // the current unix epoch nanosecond timestamp
 func (tgc *TransactionPipe) NewTGID() int64 {
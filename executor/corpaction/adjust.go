@@ -0,0 +1,181 @@
+package corpaction
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/alpacahq/marketstore/uda"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// Mode is what the prices and volumes are adjusted for
+type Mode string
+
+const (
+	// SPLITS adjusts the prices and volumes for the splits
+	SPLITS Mode = "split"
+	// ALL adjusts them for the splits, and the prices for the dividends too
+	ALL Mode = "all"
+)
+
+// ParseMode returns the mode of its name
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case SPLITS, ALL:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown adjustment \"%s\", split or all", name)
+}
+
+// PriceColumns are the columns adjusted as prices, by the inverse of the
+// ratio of a split and by the dividends
+var PriceColumns = []string{"Open", "High", "Low", "Close", "Price", "Bid", "Ask", "VWAP"}
+
+// VolumeColumns are the columns adjusted as volumes, by the ratio of a split
+var VolumeColumns = []string{"Volume", "Size", "BidSize", "AskSize"}
+
+// Factors returns the factors of the prices and of the volumes of the
+// records at the epochs, in the order of time, for the actions whose ex-date
+// is after the record and no later than its asOf epoch, or than any if asOf
+// is nil.  A dividend lowers the prices by its share of the close before
+// its ex-date, the last of the unadjusted closes of the records before it,
+// and is left out without closes.
+func Factors(actions []Action, epochs, asOf []int64, mode Mode, closes []float64) (prices, volumes []float64) {
+	prices = make([]float64, len(epochs))
+	volumes = make([]float64, len(epochs))
+	for i := range epochs {
+		prices[i], volumes[i] = 1, 1
+	}
+	for _, a := range actions {
+		// the records before the ex-date
+		n := sort.Search(len(epochs), func(i int) bool { return epochs[i] >= a.ExDate })
+		if n == 0 {
+			continue
+		}
+		var priceFactor, volumeFactor float64
+		switch {
+		case a.Kind == SPLIT:
+			priceFactor, volumeFactor = 1/a.Ratio, a.Ratio
+		case a.Kind == DIVIDEND && mode == ALL && closes != nil:
+			close := closes[n-1]
+			if math.IsNaN(close) || close <= a.Amount {
+				continue
+			}
+			priceFactor, volumeFactor = 1-a.Amount/close, 1
+		default:
+			continue
+		}
+		for i := 0; i < n; i++ {
+			if asOf != nil && a.ExDate > asOf[i] {
+				continue
+			}
+			prices[i] *= priceFactor
+			volumes[i] *= volumeFactor
+		}
+	}
+	return prices, volumes
+}
+
+// Adjust adjusts the price and volume columns of the records of a symbol,
+// in the order of time, for its actions, see Factors.  The columns are
+// replaced rather than modified, so that the columns shared with other
+// series are left unadjusted.
+func Adjust(cs *io.ColumnSeries, actions []Action, mode Mode, asOf []int64) error {
+	if len(actions) == 0 || cs.Len() == 0 {
+		return nil
+	}
+	var closes []float64
+	for _, name := range []string{"Close", "Price"} {
+		if cs.Exists(name) {
+			var err error
+			if closes, err = uda.ColumnToFloat64(cs, name); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	prices, volumes := Factors(actions, cs.GetEpoch(), asOf, mode, closes)
+	if isOne(prices) && isOne(volumes) {
+		return nil
+	}
+	for _, group := range []struct {
+		names   []string
+		factors []float64
+	}{{PriceColumns, prices}, {VolumeColumns, volumes}} {
+		for _, name := range group.names {
+			if !cs.Exists(name) {
+				continue
+			}
+			col, err := scaleColumn(cs, name, group.factors)
+			if err != nil {
+				return err
+			}
+			if err = cs.Replace(name, col); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scaleColumn returns the values of the column times the factors, rounded
+// to the nearest for the integers and the decimals
+func scaleColumn(cs *io.ColumnSeries, name string, factors []float64) (interface{}, error) {
+	switch col := cs.GetByName(name).(type) {
+	case []float32:
+		out := make([]float32, len(col))
+		for i, v := range col {
+			out[i] = float32(float64(v) * factors[i])
+		}
+		return out, nil
+	case []float64:
+		out := make([]float64, len(col))
+		for i, v := range col {
+			out[i] = v * factors[i]
+		}
+		return out, nil
+	case []int64:
+		if scale, ok := cs.GetScale(name); ok {
+			values := io.DecimalsToFloats(col, scale)
+			for i := range values {
+				values[i] *= factors[i]
+			}
+			return io.FloatsToDecimals(values, scale)
+		}
+		out := make([]int64, len(col))
+		for i, v := range col {
+			out[i] = int64(math.Round(float64(v) * factors[i]))
+		}
+		return out, nil
+	case []int32:
+		out := make([]int32, len(col))
+		for i, v := range col {
+			out[i] = int32(math.Round(float64(v) * factors[i]))
+		}
+		return out, nil
+	case []uint64:
+		out := make([]uint64, len(col))
+		for i, v := range col {
+			out[i] = uint64(math.Round(float64(v) * factors[i]))
+		}
+		return out, nil
+	case []uint32:
+		out := make([]uint32, len(col))
+		for i, v := range col {
+			out[i] = uint32(math.Round(float64(v) * factors[i]))
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("column %s of type %T can not be adjusted", name, col)
+	}
+}
+
+func isOne(factors []float64) bool {
+	for _, f := range factors {
+		if f != 1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+// Package corpaction stores the corporate actions of the symbols, such as
+// their splits and dividends, and adjusts their prices and volumes for them,
+// for the queries, the aggregation triggers and the tools to share a single
+// record of them rather than each feed keeping its own.
+package corpaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/alpacahq/marketstore/executor"
+)
+
+// File is the file of the corporate actions in the root directory, a file
+// rather than a directory which would be loaded as part of the catalog
+const File = "corporate_actions.json"
+
+// Kind is the kind of a corporate action
+type Kind string
+
+const (
+	SPLIT         Kind = "split"
+	DIVIDEND      Kind = "dividend"
+	SYMBOL_CHANGE Kind = "symbol_change"
+	MERGER        Kind = "merger"
+)
+
+// Action is a corporate action of a symbol, effective from its ex-date
+type Action struct {
+	Symbol string `json:"symbol" msgpack:"symbol"`
+	Kind   Kind   `json:"kind" msgpack:"kind"`
+	// Epoch of the ex-date, from which the symbol trades in the terms of the
+	// action, such as the first day of its split shares
+	ExDate int64 `json:"ex_date" msgpack:"ex_date"`
+	// New shares per old share of a split, such as 4 for a 4-for-1 split or
+	// 0.1 for a 1-for-10 reverse split, or shares of NewSymbol per share of
+	// a merger
+	Ratio float64 `json:"ratio,omitempty" msgpack:"ratio,omitempty"`
+	// Cash per share of a dividend or of a merger
+	Amount float64 `json:"amount,omitempty" msgpack:"amount,omitempty"`
+	// New symbol of a symbol change, or the acquirer of a merger
+	NewSymbol string `json:"new_symbol,omitempty" msgpack:"new_symbol,omitempty"`
+}
+
+// Validate returns an error if the action misses what its kind requires
+func (a *Action) Validate() error {
+	if a.Symbol == "" {
+		return fmt.Errorf("corporate action without a symbol")
+	}
+	if a.ExDate <= 0 {
+		return fmt.Errorf("%s %s without an ex-date", a.Kind, a.Symbol)
+	}
+	switch a.Kind {
+	case SPLIT:
+		if a.Ratio <= 0 {
+			return fmt.Errorf("split of %s without a positive ratio", a.Symbol)
+		}
+	case DIVIDEND:
+		if a.Amount <= 0 {
+			return fmt.Errorf("dividend of %s without a positive amount", a.Symbol)
+		}
+	case SYMBOL_CHANGE:
+		if a.NewSymbol == "" || a.NewSymbol == a.Symbol {
+			return fmt.Errorf("symbol change of %s without a new symbol", a.Symbol)
+		}
+	case MERGER:
+		if a.NewSymbol == "" || a.Ratio < 0 || a.Amount < 0 || a.Ratio+a.Amount == 0 {
+			return fmt.Errorf("merger of %s without an acquirer and its terms", a.Symbol)
+		}
+	default:
+		return fmt.Errorf("unknown kind of corporate action \"%s\"", a.Kind)
+	}
+	return nil
+}
+
+// Store is the corporate actions of the symbols of a root directory
+type Store struct {
+	mu   sync.RWMutex
+	path string
+	// actions by symbol, in the order of their ex-date
+	actions map[string][]Action
+}
+
+// Open loads the corporate actions of the root directory, none if it has
+// no file of them yet
+func Open(root string) (*Store, error) {
+	s := &Store{path: filepath.Join(root, File), actions: map[string][]Action{}}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var actions []Action
+	if err = json.Unmarshal(data, &actions); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", s.path, err)
+	}
+	for _, a := range actions {
+		s.actions[a.Symbol] = append(s.actions[a.Symbol], a)
+	}
+	for _, list := range s.actions {
+		sortActions(list)
+	}
+	return s, nil
+}
+
+var (
+	instanceMu sync.Mutex
+	instance   *Store
+	// root directory the instance store was opened for
+	instanceRoot string
+)
+
+// Instance returns the store of the root directory of the instance, opened
+// once
+func Instance() (*Store, error) {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+	if executor.ThisInstance == nil {
+		return nil, fmt.Errorf("no instance to load the corporate actions of")
+	}
+	root := executor.ThisInstance.RootDir
+	if instance != nil && instanceRoot == root {
+		return instance, nil
+	}
+	s, err := Open(root)
+	if err != nil {
+		return nil, err
+	}
+	instance, instanceRoot = s, root
+	return s, nil
+}
+
+// Get returns the actions of the symbol in the order of their ex-date
+func (s *Store) Get(symbol string) []Action {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Action(nil), s.actions[symbol]...)
+}
+
+// Symbols returns the sorted symbols having corporate actions
+func (s *Store) Symbols() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.symbolsLocked()
+}
+
+// Add records the actions, leaving out those already recorded, and returns
+// how many were added.  None is if any of them is invalid.
+func (s *Store) Add(actions ...Action) (int, error) {
+	for i := range actions {
+		if err := actions[i].Validate(); err != nil {
+			return 0, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	changed := map[string]bool{}
+	for _, a := range actions {
+		if indexOf(s.actions[a.Symbol], a) >= 0 {
+			continue
+		}
+		s.actions[a.Symbol] = append(s.actions[a.Symbol], a)
+		changed[a.Symbol] = true
+		added++
+	}
+	for symbol := range changed {
+		sortActions(s.actions[symbol])
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, s.save()
+}
+
+// Remove deletes the recorded actions equal to those given, and returns how
+// many were removed
+func (s *Store) Remove(actions ...Action) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for _, a := range actions {
+		list := s.actions[a.Symbol]
+		if i := indexOf(list, a); i >= 0 {
+			list = append(list[:i], list[i+1:]...)
+			if len(list) == 0 {
+				delete(s.actions, a.Symbol)
+			} else {
+				s.actions[a.Symbol] = list
+			}
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.save()
+}
+
+// save writes the actions to the file, replacing it at once.  The caller
+// holds mu.
+func (s *Store) save() error {
+	all := []Action{}
+	for _, symbol := range s.symbolsLocked() {
+		all = append(all, s.actions[symbol]...)
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(s.path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *Store) symbolsLocked() []string {
+	symbols := make([]string, 0, len(s.actions))
+	for symbol := range s.actions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+func indexOf(actions []Action, a Action) int {
+	for i := range actions {
+		if actions[i] == a {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortActions(actions []Action) {
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].ExDate < actions[j].ExDate })
+}
@@ -0,0 +1,88 @@
+package corpaction
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CorpActionTestSuite struct{}
+
+var _ = Suite(&CorpActionTestSuite{})
+
+func (s *CorpActionTestSuite) TestStore(c *C) {
+	root := c.MkDir()
+	store, err := Open(root)
+	c.Assert(err, IsNil)
+	split := Action{Symbol: "AAPL", Kind: SPLIT, ExDate: 1598832000, Ratio: 4}
+	dividend := Action{Symbol: "AAPL", Kind: DIVIDEND, ExDate: 1597363200, Amount: 0.82}
+	change := Action{Symbol: "FB", Kind: SYMBOL_CHANGE, ExDate: 1654732800, NewSymbol: "META"}
+
+	added, err := store.Add(split, dividend, change, split)
+	c.Assert(err, IsNil)
+	c.Assert(added, Equals, 3)
+	added, _ = store.Add(split)
+	c.Assert(added, Equals, 0)
+	c.Assert(store.Symbols(), DeepEquals, []string{"AAPL", "FB"})
+	// in the order of their ex-date
+	c.Assert(store.Get("AAPL"), DeepEquals, []Action{dividend, split})
+
+	// none of the actions is added if one is invalid
+	_, err = store.Add(Action{Symbol: "MSFT", Kind: DIVIDEND, ExDate: 1597363200, Amount: 0.51},
+		Action{Symbol: "MSFT", Kind: SPLIT, ExDate: 1597363200})
+	c.Assert(err, NotNil)
+	c.Assert(store.Get("MSFT"), HasLen, 0)
+
+	removed, err := store.Remove(change, change)
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 1)
+
+	// recorded in the root directory
+	store, err = Open(root)
+	c.Assert(err, IsNil)
+	c.Assert(store.Symbols(), DeepEquals, []string{"AAPL"})
+	c.Assert(store.Get("AAPL"), DeepEquals, []Action{dividend, split})
+}
+
+func (s *CorpActionTestSuite) TestAdjust(c *C) {
+	actions := []Action{
+		{Symbol: "AAPL", Kind: DIVIDEND, ExDate: 200, Amount: 1},
+		{Symbol: "AAPL", Kind: SPLIT, ExDate: 300, Ratio: 4},
+	}
+	newSeries := func() *io.ColumnSeries {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{100, 200, 300})
+		cs.AddColumn("Close", []float32{400, 396, 100})
+		cs.AddColumn("Volume", []int64{10, 20, 80})
+		return cs
+	}
+
+	cs := newSeries()
+	close := cs.GetByName("Close")
+	c.Assert(Adjust(cs, actions, SPLITS, nil), IsNil)
+	c.Assert(cs.GetByName("Close"), DeepEquals, []float32{100, 99, 100})
+	c.Assert(cs.GetByName("Volume"), DeepEquals, []int64{40, 80, 80})
+	// the columns are replaced
+	c.Assert(close, DeepEquals, []float32{400, 396, 100})
+
+	// the dividend of 1 is a quarter of a percent of the close before it
+	cs = newSeries()
+	c.Assert(Adjust(cs, actions, ALL, nil), IsNil)
+	c.Assert(cs.GetByName("Close"), DeepEquals, []float32{99.75, 99, 100})
+	c.Assert(cs.GetByName("Volume"), DeepEquals, []int64{40, 80, 80})
+
+	// only for the actions up to their asOf epoch
+	cs = newSeries()
+	c.Assert(Adjust(cs, actions, ALL, []int64{299, 299, 299}), IsNil)
+	c.Assert(cs.GetByName("Close"), DeepEquals, []float32{399, 396, 100})
+
+	prices, _ := Factors(actions, []int64{100, 200}, nil, ALL, nil)
+	c.Assert(prices, DeepEquals, []float64{0.25, 0.25})
+
+	_, err := ParseMode("total")
+	c.Assert(err, NotNil)
+}
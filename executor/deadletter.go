@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+// DeadLetterFile is the file of the dead letters in the root directory, a
+// file rather than a directory which would be loaded as part of the catalog
+const DeadLetterFile = "deadletter.jsonl"
+
+var (
+	errCircuitOpen = errors.New("circuit open")
+	deadLetterMu   sync.Mutex
+)
+
+// DeadLetter is a write a trigger failed to execute on, appended as a JSON
+// line to the dead letter file, so that it can be inspected and fired again
+// rather than lost.
+type DeadLetter struct {
+	Time    time.Time `json:"time"`
+	Plugin  string    `json:"plugin"`
+	KeyPath string    `json:"key_path"`
+	Indexes []int64   `json:"indexes"`
+	// Records written, indexes and payloads, as fired
+	Records []trigger.Record `json:"records"`
+	// Executions attempted, 0 if the circuit of the trigger was open
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+}
+
+func deadLetter(plugin, key string, records []trigger.Record, attempts int, err error) {
+	stats.TriggerDeadLetters.Inc(plugin)
+	indexes := make([]int64, len(records))
+	for i := range records {
+		indexes[i] = records[i].Index()
+	}
+	letter := DeadLetter{
+		Time:     time.Now().UTC(),
+		Plugin:   plugin,
+		KeyPath:  key,
+		Indexes:  indexes,
+		Records:  records,
+		Attempts: attempts,
+		Error:    err.Error(),
+	}
+	if ThisInstance == nil || ThisInstance.RootDir == "" {
+		log.Error("trigger %s dropped %d record(s) of %s (%v)", plugin, len(records), key, err)
+		return
+	}
+	if err := appendDeadLetter(filepath.Join(ThisInstance.RootDir, DeadLetterFile), &letter); err != nil {
+		log.Error("failed to dead-letter %d record(s) of %s for trigger %s (%v)", len(records), key, plugin, err)
+	}
+}
+
+func appendDeadLetter(path string, letter *DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	deadLetterMu.Lock()
+	defer deadLetterMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// encodeDecimals converts the columns of the column series written to the
+// DECIMAL columns of the bucket into decimals of their scale, from the
+// decimals of another scale, the integers or the floats
+func encodeDecimals(tbk io.TimeBucketKey, tbi *io.TimeBucketInfo, cs *io.ColumnSeries) error {
+	var scales map[string]int
+	for _, shape := range tbi.GetDataShapes() {
+		if shape.Type != io.DECIMAL || !cs.Exists(shape.Name) {
+			continue
+		}
+		if scales == nil {
+			var err error
+			if scales, err = ThisInstance.CatalogDir.GetScales(&tbk); err != nil {
+				return err
+			}
+		}
+		scale := scales[shape.Name]
+		var (
+			values []int64
+			err    error
+		)
+		switch column := cs.GetByName(shape.Name).(type) {
+		case []int64:
+			from, _ := cs.GetScale(shape.Name)
+			values, err = io.Rescale(column, from, scale)
+		case []float32:
+			f64 := make([]float64, len(column))
+			for i, f := range column {
+				f64[i] = float64(f)
+			}
+			values, err = io.FloatsToDecimals(f64, scale)
+		case []float64:
+			values, err = io.FloatsToDecimals(column, scale)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("column %s of %s: %v", shape.Name, tbk.String(), err)
+		}
+		if err = cs.Replace(shape.Name, values); err != nil {
+			return err
+		}
+		cs.SetScale(shape.Name, scale)
+	}
+	return nil
+}
+
+// recordScales records the scales of the DECIMAL columns of the column
+// series written to the bucket created for it
+func recordScales(tbk io.TimeBucketKey, cs *io.ColumnSeries) error {
+	scales := map[string]int{}
+	for _, name := range cs.GetColumnNames() {
+		if scale, ok := cs.GetScale(name); ok {
+			scales[name] = scale
+		}
+	}
+	if len(scales) == 0 {
+		return nil
+	}
+	return ThisInstance.CatalogDir.SetScales(&tbk, scales)
+}
+
+// decodeDecimals sets the scales of the DECIMAL columns of the column series
+// read from the bucket
+func decodeDecimals(tbk io.TimeBucketKey, cs *io.ColumnSeries, dataShapes []io.DataShape) error {
+	var scales map[string]int
+	for _, shape := range dataShapes {
+		if shape.Type != io.DECIMAL || !cs.Exists(shape.Name) {
+			continue
+		}
+		if scales == nil {
+			var err error
+			if scales, err = ThisInstance.CatalogDir.GetScales(&tbk); err != nil {
+				return err
+			}
+		}
+		cs.SetScale(shape.Name, scales[shape.Name])
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type DecimalsTests struct{}
+
+var _ = Suite(&DecimalsTests{})
+
+func (s *DecimalsTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *DecimalsTests) TestDecimalColumns(c *C) {
+	tbk := io.NewTimeBucketKey("AAPL/1Min/OHLCV")
+	start := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).Unix()
+	write := func(epoch int64, price interface{}, scale int) error {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{epoch, epoch + 60})
+		cs.AddColumn("Price", price)
+		if scale >= 0 {
+			cs.SetScale("Price", scale)
+		}
+		cs.AddColumn("Size", []int32{1, 2})
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*tbk, cs)
+		return WriteCSM(csm, false)
+	}
+
+	// the bucket created by the write keeps the scale of its decimals, to
+	// which the later writes are converted
+	c.Assert(write(start, []int64{12345, 12350}, 2), IsNil)
+	c.Assert(write(start+120, []int64{1234567, 5}, 4), IsNil)
+	c.Assert(write(start+240, []float64{0.1 + 0.2, 7}, -1), IsNil)
+	c.Assert(write(start+360, []int64{1, 2}, -1), IsNil)
+
+	scales, err := ThisInstance.CatalogDir.GetScales(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(scales, DeepEquals, map[string]int{"Price": 2})
+
+	cs, err := readRange(*tbk, start, start+480)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetColumnNames(), DeepEquals, []string{"Epoch", "Price", "Size"})
+	c.Assert(cs.GetByName("Price"), DeepEquals, []int64{12345, 12350, 12346, 0, 30, 700, 100, 200})
+	c.Assert(cs.GetByName("Size"), DeepEquals, []int32{1, 2, 1, 2, 1, 2, 1, 2})
+	scale, ok := cs.GetScale("Price")
+	c.Assert(ok, Equals, true)
+	c.Assert(scale, Equals, 2)
+
+	// decimals out of the range of the scale are refused
+	c.Assert(write(start+480, []int64{1 << 62, 0}, 0), NotNil)
+}
@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+// dedupLock serializes the writes to the deduplicated buckets, so that the
+// rows of a write are read back by the check of the next one
+var dedupLock sync.Mutex
+
+// deduplicated returns true if the variable length records written to the
+// bucket are deduplicated, its item key matching a pattern of the
+// deduplicate setting
+func deduplicated(tbk io.TimeBucketKey) bool {
+	return utils.InstanceConfig.Deduplicated(tbk.GetItemKey())
+}
+
+// deduplicate returns the column series of the variable length records to
+// write to the bucket without the exact duplicates of the rows already
+// written to it, or of its previous rows, with the same time and the same
+// values, such as the ticks replayed by a feed after reconnecting, or the
+// same time and Sequence for the records of a sequenced bucket.  Since the
+// times are stored in 2^32 ticks of the interval, the rows read back are
+// duplicates within two ticks, about 28ns for 1Min.
+func deduplicate(tbk io.TimeBucketKey, cs *io.ColumnSeries) (*io.ColumnSeries, error) {
+	times := cs.GetTime()
+	if len(times) == 0 {
+		return cs, nil
+	}
+	var names []string
+	for _, name := range cs.GetColumnNames() {
+		if name != "Epoch" && name != "Nanoseconds" && name != EpochNanosColumn {
+			names = append(names, name)
+		}
+	}
+	if keyedBySequence(tbk, cs) {
+		names = []string{SequenceColumn}
+	}
+
+	// times of the rows written by their values
+	written := map[string][]int64{}
+	var tolerance int64
+	if _, err := ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(&tbk); err == nil {
+		tf, err := tbk.GetTimeFrame()
+		if err != nil {
+			return nil, err
+		}
+		tolerance = 2*int64(tf.Duration)>>32 + 1
+		start, end := times[0].Unix(), times[0].Unix()
+		for _, t := range times {
+			if t.Unix() < start {
+				start = t.Unix()
+			}
+			if t.Unix() > end {
+				end = t.Unix()
+			}
+		}
+		rows, err := readRange(tbk, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s to deduplicate (%v)", tbk.String(), err)
+		}
+		if rows != nil && hasColumns(rows, names) {
+			for i, t := range rows.GetTime() {
+				key := rowKey(rows, names, i)
+				written[key] = append(written[key], t.UnixNano())
+			}
+		}
+	}
+
+	var keep []int
+	seen := map[string]bool{}
+	for i, t := range times {
+		key := rowKey(cs, names, i)
+		timeKey := fmt.Sprint(t.UnixNano(), "\x00", key)
+		if seen[timeKey] || isWritten(written[key], t.UnixNano(), tolerance) {
+			continue
+		}
+		seen[timeKey] = true
+		keep = append(keep, i)
+	}
+	if len(keep) == len(times) {
+		return cs, nil
+	}
+	stats.DeduplicatedRows.Add(float64(len(times) - len(keep)))
+
+	out := io.NewColumnSeries()
+	for _, name := range cs.GetColumnNames() {
+		col := reflect.ValueOf(cs.GetByName(name))
+		kept := reflect.MakeSlice(col.Type(), len(keep), len(keep))
+		for k, i := range keep {
+			kept.Index(k).Set(col.Index(i))
+		}
+		out.AddColumn(name, kept.Interface())
+		if valid := cs.GetValidity(name); valid != nil {
+			keptValid := make([]bool, len(keep))
+			for k, i := range keep {
+				keptValid[k] = valid[i]
+			}
+			out.SetValidity(name, keptValid)
+		}
+		if scale, ok := cs.GetScale(name); ok {
+			out.SetScale(name, scale)
+		}
+	}
+	return out, nil
+}
+
+func isWritten(written []int64, t, tolerance int64) bool {
+	for _, w := range written {
+		if w-t <= tolerance && t-w <= tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// readRange returns the rows of the bucket between the start and end epochs
+func readRange(tbk io.TimeBucketKey, start, end int64) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(ThisInstance.CatalogDir)
+	q.AddTargetKey(&tbk)
+	q.SetRange(start, end)
+	parsed, err := q.Parse()
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	return csm[tbk], nil
+}
+
+func hasColumns(cs *io.ColumnSeries, names []string) bool {
+	for _, name := range names {
+		if !cs.Exists(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// rowKey returns the values of the columns of a row but its time, compared
+// to find its duplicates
+func rowKey(cs *io.ColumnSeries, names []string, i int) string {
+	values := make([]string, len(names))
+	for j, name := range names {
+		if !cs.IsValid(name, i) {
+			// missing, unlike any value
+			values[j] = "\x01"
+			continue
+		}
+		values[j] = fmt.Sprint(reflect.ValueOf(cs.GetByName(name)).Index(i).Interface())
+	}
+	return strings.Join(values, "\x00")
+}
@@ -65,7 +65,7 @@ func (de *deleter) delete(iop *ioplan) (err error) {
 		defer f.Close()
 
 		seekerFunc := func(offset int64) error {
-			if _, err = f.Seek(fp.Offset, io.SeekStart); err != nil {
+			if _, err = f.Seek(offset, io.SeekStart); err != nil {
 				log.Error("Read: seeking in %s\n%s", filePath, err)
 				return err
 			}
@@ -81,7 +81,7 @@ func (de *deleter) delete(iop *ioplan) (err error) {
 			This will preserve the existing holes in the data area at the expense of
 			a potentially large number of file seeks
 		*/
-		bufferSize := int(fp.Length + int64(iop.RecordLen))
+		bufferSize := int(fp.Length)
 		buffer := make([]byte, bufferSize)
 		n, err := f.Read(buffer)
 		if err != nil || n != bufferSize {
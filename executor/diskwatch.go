@@ -0,0 +1,92 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+var (
+	// readOnly is set while the free disk space is below the
+	// read_only_free_disk_space threshold, rejecting the writes
+	readOnly uint32
+
+	diskCheckInterval = 5 * time.Second
+
+	diskFreeBytes = stats.NewGauge("marketstore_disk_free_bytes",
+		"Free space of the volume of the root directory, holding the data files and the WAL")
+	readOnlyGauge = stats.NewGauge("marketstore_read_only",
+		"1 while the writes are rejected for lack of disk space, 0 otherwise")
+	readOnlyRejects = stats.NewCounter("marketstore_read_only_rejected_writes_total",
+		"Number of writes rejected for lack of disk space")
+)
+
+// ReadOnly returns whether the writes are rejected for lack of disk space
+func ReadOnly() bool {
+	return atomic.LoadUint32(&readOnly) == 1
+}
+
+// DiskFree returns the space available on the volume of the directory, in
+// bytes
+func DiskFree(dir string) (int64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, err
+	}
+	return int64(fs.Bavail) * int64(fs.Bsize), nil
+}
+
+// WatchDisk checks the free space of the volume of the root directory every
+// few seconds, until the context is done.  The writes are rejected while it
+// is below the read_only_free_disk_space setting, for a full disk not to
+// leave a data file or the WAL partially written, and accepted again once
+// space is freed.  The reads go on meanwhile.  The disk usage of the
+// namespaces is refreshed along.
+func WatchDisk(ctx context.Context) {
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+	for {
+		checkDiskSpace(ThisInstance.RootDir, utils.InstanceConfig.ReadOnlyFreeDiskSpace)
+		refreshNamespaces()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDiskSpace switches the writes off or on depending on the free space
+// of the directory's volume
+func checkDiskSpace(dir string, threshold int64) {
+	free, err := DiskFree(dir)
+	if err != nil {
+		log.Error("unable to stat %s for its free space: %v", dir, err)
+		return
+	}
+	diskFreeBytes.Set(float64(free))
+	switch below := free < threshold; {
+	case below && atomic.CompareAndSwapUint32(&readOnly, 0, 1):
+		readOnlyGauge.Set(1)
+		log.Error("%d bytes free on the volume of %s, less than read_only_free_disk_space of %d, "+
+			"rejecting the writes until space is freed", free, dir, threshold)
+	case !below && atomic.CompareAndSwapUint32(&readOnly, 1, 0):
+		readOnlyGauge.Set(0)
+		log.Info("%d bytes free on the volume of %s, accepting the writes again", free, dir)
+	}
+}
+
+func checkReadOnly(caller string) error {
+	if !ReadOnly() {
+		return nil
+	}
+	readOnlyRejects.Inc()
+	return DiskFullError(fmt.Sprintf("%s: less than %d bytes free", caller,
+		utils.InstanceConfig.ReadOnlyFreeDiskSpace))
+}
@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type DiskWatchTests struct{}
+
+var _ = Suite(&DiskWatchTests{})
+
+func (s *DiskWatchTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *DiskWatchTests) TearDownTest(c *C) {
+	atomic.StoreUint32(&readOnly, 0)
+}
+
+func (s *DiskWatchTests) TestReadOnly(c *C) {
+	write := func() error {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{time.Date(2016, time.March, 1, 10, 0, 0, 0, time.UTC).Unix()})
+		cs.AddColumn("Price", []float32{1.})
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*io.NewTimeBucketKey("DISK/1Min/PRICE"), cs)
+		return WriteCSM(csm, false)
+	}
+
+	free, err := DiskFree(ThisInstance.RootDir)
+	c.Assert(err, IsNil)
+	c.Assert(free > 0, Equals, true)
+
+	// below the threshold, the writes are rejected
+	checkDiskSpace(ThisInstance.RootDir, math.MaxInt64)
+	c.Assert(ReadOnly(), Equals, true)
+	err = write()
+	c.Assert(err, FitsTypeOf, DiskFullError(""))
+
+	// until space is freed
+	checkDiskSpace(ThisInstance.RootDir, 0)
+	c.Assert(ReadOnly(), Equals, false)
+	c.Assert(write(), IsNil)
+}
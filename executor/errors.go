@@ -19,6 +19,36 @@ func (msg SingleTargetRequiredForWriter) Error() string {
 	return errReport("%s: There can be only one target directory for a writer, change your query", string(msg))
 }
 
+type QueryLimitExceededError string
+
+func (msg QueryLimitExceededError) Error() string {
+	return errReport("%s: Query resource limit exceeded, narrow the query", string(msg))
+}
+
+type SymbolNotOwnedError string
+
+func (msg SymbolNotOwnedError) Error() string {
+	return errReport("%s: Symbol is written by its shard alone, write it there", string(msg))
+}
+
+type ShuttingDownError string
+
+func (msg ShuttingDownError) Error() string {
+	return errReport("%s: Server is shutting down, retry on restart", string(msg))
+}
+
+type DiskFullError string
+
+func (msg DiskFullError) Error() string {
+	return errReport("%s: Server is read-only for lack of disk space, retry once space is freed", string(msg))
+}
+
+type NamespaceQuotaError string
+
+func (msg NamespaceQuotaError) Error() string {
+	return errReport("%s: Namespace quota exceeded, free some of its space or buckets", string(msg))
+}
+
 // WAL Messages
 type CacheEntryAlreadyOpenError string
 
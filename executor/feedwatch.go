@@ -0,0 +1,204 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+var (
+	lastWritesMu sync.Mutex
+	// time of the last write of each bucket since startup, by item key
+	lastWrites = map[string]time.Time{}
+
+	feedLastWriteAge = stats.NewGauge("marketstore_feed_last_write_age_seconds",
+		"Longest time since the last write to a bucket of the feed within its market hours", "feed")
+	feedStaleBuckets = stats.NewGauge("marketstore_feed_stale_buckets",
+		"Number of buckets of the feed not written to for its max_age within its market hours", "feed")
+	feedAlerts = stats.NewCounter("marketstore_feed_stale_alerts_total",
+		"Number of alerts on the buckets of the feed not written to for its max_age", "feed")
+)
+
+// recordWrite records the time of a write to the bucket for WatchFeeds
+func recordWrite(tbk io.TimeBucketKey, at time.Time) {
+	lastWritesMu.Lock()
+	lastWrites[tbk.GetItemKey()] = at
+	lastWritesMu.Unlock()
+}
+
+// LastWrite returns the time of the last write to the bucket since
+// startup, false if it was not written to
+func LastWrite(itemKey string) (time.Time, bool) {
+	lastWritesMu.Lock()
+	defer lastWritesMu.Unlock()
+	at, ok := lastWrites[itemKey]
+	return at, ok
+}
+
+// FeedAlert is a bucket of a feed not written to for its max_age within its
+// market hours, POSTed to the webhooks of the feed_health setting
+type FeedAlert struct {
+	Feed   string `json:"feed"`
+	Bucket string `json:"bucket"`
+	// LastWrite is the epoch of the last write to the bucket, or of the
+	// startup if it was not written to since
+	LastWrite int64 `json:"last_write"`
+	// Age is the seconds since the last write within the market hours
+	Age    float64 `json:"age"`
+	MaxAge float64 `json:"max_age"`
+}
+
+// feedWatch is the state of a feed of the feed_health setting
+type feedWatch struct {
+	*utils.FeedSetting
+	glob glob.Glob
+	cal  *calendar.Calendar
+	// buckets alerted on, until written to again
+	alerted map[string]bool
+}
+
+func newFeedWatch(feed *utils.FeedSetting) (w *feedWatch, err error) {
+	w = &feedWatch{FeedSetting: feed, alerted: map[string]bool{}}
+	if w.glob, err = glob.Compile(feed.Pattern, '/'); err != nil {
+		return nil, err
+	}
+	if feed.Calendar != "" {
+		if w.cal, err = calendar.Load(feed.Calendar); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// WatchFeeds alerts on the buckets of the feeds of the feed_health setting
+// not written to for their max_age while their market is open, checking
+// them every check_interval until the context is done.  The age of a write
+// before the session counts from its open, for the feeds not to be alerted
+// on overnight and on the holidays.  A bucket is alerted on once until it
+// is written to again, the buckets not written to since the startup being
+// as old as the startup.
+func WatchFeeds(ctx context.Context) {
+	setting := utils.InstanceConfig.FeedHealth
+	if setting == nil || len(setting.Feeds) == 0 {
+		return
+	}
+	started := time.Now()
+	watches := make([]*feedWatch, 0, len(setting.Feeds))
+	for _, feed := range setting.Feeds {
+		w, err := newFeedWatch(feed)
+		if err != nil {
+			log.Error("feed %s not watched: %v", feed.Name, err)
+			continue
+		}
+		watches = append(watches, w)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(setting.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var alerts []FeedAlert
+			keys := BucketKeys()
+			for _, w := range watches {
+				alerts = append(alerts, w.check(keys, started, now)...)
+			}
+			for _, url := range setting.Webhooks {
+				if len(alerts) > 0 {
+					go postFeedAlerts(client, url, alerts)
+				}
+			}
+		}
+	}
+}
+
+// check returns the new alerts on the buckets of the feed among the keys,
+// and updates the metrics of the feed
+func (w *feedWatch) check(keys []string, started, now time.Time) (alerts []FeedAlert) {
+	// the start of the market hours the ages are counted from
+	since := time.Time{}
+	if w.cal != nil {
+		session := w.cal.SessionOf(now)
+		if session == nil {
+			feedLastWriteAge.Set(0, w.Name)
+			feedStaleBuckets.Set(0, w.Name)
+			return nil
+		}
+		since = session.Open
+		if !session.BreakEnd.IsZero() && now.After(session.BreakEnd) {
+			since = session.BreakEnd
+		}
+	}
+	maxAge, stale := time.Duration(0), 0
+	for _, key := range keys {
+		if !w.glob.Match(key) {
+			continue
+		}
+		last, ok := LastWrite(key)
+		if !ok {
+			last = started
+		}
+		age := now.Sub(last)
+		if last.Before(since) {
+			age = now.Sub(since)
+		}
+		if age > maxAge {
+			maxAge = age
+		}
+		if age < w.MaxAge {
+			if w.alerted[key] {
+				log.Info("feed %s is writing to %s again", w.Name, key)
+				delete(w.alerted, key)
+			}
+			continue
+		}
+		stale++
+		if w.alerted[key] {
+			continue
+		}
+		w.alerted[key] = true
+		feedAlerts.Inc(w.Name)
+		log.Warn("feed %s has not written to %s for %v", w.Name, key, age.Round(time.Second))
+		alerts = append(alerts, FeedAlert{
+			Feed:      w.Name,
+			Bucket:    key,
+			LastWrite: last.Unix(),
+			Age:       age.Seconds(),
+			MaxAge:    w.MaxAge.Seconds(),
+		})
+	}
+	feedLastWriteAge.Set(maxAge.Seconds(), w.Name)
+	feedStaleBuckets.Set(float64(stale), w.Name)
+	return alerts
+}
+
+// postFeedAlerts POSTs the alerts to the webhook as a JSON array, without
+// retries
+func postFeedAlerts(client *http.Client, url string, alerts []FeedAlert) {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Error("failed to post the feed alerts to %s (%v)", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Error("failed to post the feed alerts to %s (status %d)", url, resp.StatusCode)
+	}
+}
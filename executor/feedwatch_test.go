@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type FeedWatchTests struct{}
+
+var _ = Suite(&FeedWatchTests{})
+
+func (s *FeedWatchTests) TestCheck(c *C) {
+	w, err := newFeedWatch(&utils.FeedSetting{
+		Name: "feed", Pattern: "FEED*/1Min/OHLCV", MaxAge: 5 * time.Minute, Calendar: "nyse"})
+	c.Assert(err, IsNil)
+	ny := w.cal.Tz()
+	keys := []string{"FEEDA/1Min/OHLCV", "FEEDB/1Min/OHLCV", "FEEDA/1D/OHLCV"}
+	// started on the Friday evening
+	started := time.Date(2024, time.March, 1, 20, 0, 0, 0, ny)
+
+	// the market is closed over the weekend
+	c.Assert(w.check(keys, started, time.Date(2024, time.March, 2, 12, 0, 0, 0, ny)), HasLen, 0)
+
+	// the age counts from the open, not from the startup
+	recordWrite(*io.NewTimeBucketKey("FEEDA/1Min/OHLCV"), time.Date(2024, time.March, 4, 9, 35, 0, 0, ny))
+	c.Assert(w.check(keys, started, time.Date(2024, time.March, 4, 9, 34, 0, 0, ny)), HasLen, 0)
+	alerts := w.check(keys, started, time.Date(2024, time.March, 4, 9, 38, 0, 0, ny))
+	c.Assert(alerts, HasLen, 1)
+	c.Assert(alerts[0].Bucket, Equals, "FEEDB/1Min/OHLCV")
+	c.Assert(alerts[0].Age, Equals, (8 * time.Minute).Seconds())
+
+	// alerted on once, until written to again
+	c.Assert(w.check(keys, started, time.Date(2024, time.March, 4, 9, 39, 0, 0, ny)), HasLen, 0)
+	c.Assert(w.alerted["FEEDB/1Min/OHLCV"], Equals, true)
+	recordWrite(*io.NewTimeBucketKey("FEEDB/1Min/OHLCV"), time.Date(2024, time.March, 4, 9, 40, 0, 0, ny))
+	alerts = w.check(keys, started, time.Date(2024, time.March, 4, 9, 41, 0, 0, ny))
+	c.Assert(alerts, HasLen, 1)
+	c.Assert(alerts[0].Bucket, Equals, "FEEDA/1Min/OHLCV")
+	c.Assert(w.alerted["FEEDB/1Min/OHLCV"], Equals, false)
+
+	// without a calendar, the age counts from the startup
+	w, err = newFeedWatch(&utils.FeedSetting{Name: "crypto", Pattern: "BTC/1Min/*", MaxAge: time.Minute})
+	c.Assert(err, IsNil)
+	alerts = w.check([]string{"BTC/1Min/OHLCV"}, started, started.Add(2*time.Minute))
+	c.Assert(alerts, HasLen, 1)
+	c.Assert(alerts[0].LastWrite, Equals, started.Unix())
+}
@@ -2,17 +2,40 @@ package executor
 
 import (
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alpacahq/marketstore/catalog"
 	"github.com/alpacahq/marketstore/plugins/trigger"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
 )
 
 var ThisInstance *InstanceMetadata
 
+// startupPhase is the phase of NewInstanceSetup in progress
+var startupPhase atomic.Value
+
+// StartupPhase returns the phase of the setup of the instance in progress,
+// loading the catalog or replaying the WAL, or an empty string if none is
+func StartupPhase() string {
+	phase, _ := startupPhase.Load().(string)
+	return phase
+}
+
+func init() {
+	stats.NewGaugeFunc("marketstore_catalog_buckets", "Number of time bucket files in the catalog",
+		func() float64 {
+			if StartupPhase() != "" || ThisInstance == nil || ThisInstance.CatalogDir == nil {
+				return 0
+			}
+			return float64(len(ThisInstance.CatalogDir.GatherTimeBucketInfo()))
+		})
+}
+
 type InstanceMetadata struct {
 	InstanceID      int64
 	RootDir         string
@@ -20,7 +43,6 @@ type InstanceMetadata struct {
 	TXNPipe         *TransactionPipe
 	WALFile         *WALFileType
 	WALWg           sync.WaitGroup
-	ShutdownPending bool
 	WALBypass       bool
 	TriggerMatchers []*trigger.TriggerMatcher
 }
@@ -46,6 +68,7 @@ func NewInstanceSetup(relRootDir string, options ...bool) {
 	log.Info("WAL Setup: initCatalog %v, initWALCache %v, backgroundSync %v, WALBypass %v: \n",
 		initCatalog, initWALCache, backgroundSync, WALBypass)
 
+	defer startupPhase.Store("")
 	if ThisInstance == nil {
 		ThisInstance = new(InstanceMetadata)
 	}
@@ -57,8 +80,11 @@ func NewInstanceSetup(relRootDir string, options ...bool) {
 	}
 	ThisInstance.InstanceID = time.Now().UTC().UnixNano()
 	ThisInstance.RootDir = rootDir
+	// the writes of an instance shut down before are accepted again
+	atomic.StoreUint32(&closed, 0)
 	// Initialize a global catalog
 	if initCatalog {
+		startupPhase.Store("loading catalog")
 		ThisInstance.CatalogDir = catalog.NewDirectory(rootDir)
 	}
 	ThisInstance.WALBypass = WALBypass
@@ -68,15 +94,40 @@ func NewInstanceSetup(relRootDir string, options ...bool) {
 			ThisInstance.TXNPipe = NewTransactionPipe()
 			ThisInstance.WALFile = &WALFileType{RootPath: ThisInstance.RootDir}
 		} else {
+			startupPhase.Store("replaying WAL")
 			ThisInstance.TXNPipe, ThisInstance.WALFile, err = StartupCacheAndWAL(ThisInstance.RootDir)
 			if err != nil {
 				log.Fatal("Unable to startup Cache and WAL")
 			}
 		}
 		if backgroundSync {
-			// Startup the WAL and Primary cache flushers
-			go ThisInstance.WALFile.SyncWAL(500*time.Millisecond, 5*time.Minute, utils.InstanceConfig.WALRotateInterval)
+			// Startup the WAL and Primary cache flushers, a shutdown right
+			// after waiting for them
+			atomic.StoreUint32(&walWriter, 1)
 			ThisInstance.WALWg.Add(1)
+			go ThisInstance.WALFile.SyncWAL(500*time.Millisecond, 5*time.Minute, utils.InstanceConfig.WALRotateInterval)
+		}
+	}
+}
+
+// BucketKeys returns the item keys of the buckets of the catalog
+func BucketKeys() []string {
+	if ThisInstance == nil || ThisInstance.CatalogDir == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var keys []string
+	for _, info := range ThisInstance.CatalogDir.GatherTimeBucketInfo() {
+		// <root>/<Symbol>/<Timeframe>/<AttributeGroup>/<Year>.bin
+		elements := strings.Split(filepath.ToSlash(filepath.Dir(info.Path)), "/")
+		if len(elements) < 3 {
+			continue
+		}
+		key := strings.Join(elements[len(elements)-3:], "/")
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
 		}
 	}
+	return keys
 }
@@ -0,0 +1,119 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+var (
+	namespaceMu sync.Mutex
+	// disk usage of each namespace, refreshed by WatchDisk
+	namespaceBytes = map[string]int64{}
+
+	namespaceBuckets = stats.NewGauge("marketstore_namespace_buckets",
+		"Number of buckets of the namespace", "namespace")
+	namespaceDiskBytes = stats.NewGauge("marketstore_namespace_disk_bytes",
+		"Size of the data files of the buckets of the namespace", "namespace")
+	namespaceRejects = stats.NewCounter("marketstore_namespace_rejected_writes_total",
+		"Number of writes rejected for exceeding the quota of the namespace", "namespace")
+)
+
+// NamespaceUsage returns the number of buckets of the namespace and the
+// size of their data files, in bytes
+func NamespaceUsage(name string) (buckets int, bytes int64) {
+	usage := namespaceUsage()
+	return usage[name].buckets, usage[name].bytes
+}
+
+type nsUsage struct {
+	buckets int
+	bytes   int64
+}
+
+// namespaceUsage returns the usage of every namespace with a bucket, from
+// the data files of the catalog
+func namespaceUsage() map[string]nsUsage {
+	usages := map[string]nsUsage{}
+	if ThisInstance == nil || ThisInstance.CatalogDir == nil || len(utils.InstanceConfig.Namespaces) == 0 {
+		return usages
+	}
+	seen := map[string]bool{}
+	for _, info := range ThisInstance.CatalogDir.GatherTimeBucketInfo() {
+		// <root>/<Symbol>/<Timeframe>/<AttributeGroup>/<Year>.bin
+		elements := strings.Split(filepath.ToSlash(filepath.Dir(info.Path)), "/")
+		if len(elements) < 3 {
+			continue
+		}
+		ns := utils.InstanceConfig.NamespaceOf(elements[len(elements)-3])
+		if ns == nil {
+			continue
+		}
+		u := usages[ns.Name]
+		if key := strings.Join(elements[len(elements)-3:], "/"); !seen[key] {
+			seen[key] = true
+			u.buckets++
+		}
+		if fi, err := os.Stat(info.Path); err == nil {
+			u.bytes += fi.Size()
+		}
+		usages[ns.Name] = u
+	}
+	return usages
+}
+
+// refreshNamespaces updates the disk usage of the namespaces checked by
+// CheckQuota, and their metrics
+func refreshNamespaces() {
+	if len(utils.InstanceConfig.Namespaces) == 0 {
+		return
+	}
+	usages := namespaceUsage()
+	bytes := make(map[string]int64, len(usages))
+	for _, ns := range utils.InstanceConfig.Namespaces {
+		u := usages[ns.Name]
+		bytes[ns.Name] = u.bytes
+		namespaceBuckets.Set(float64(u.buckets), ns.Name)
+		namespaceDiskBytes.Set(float64(u.bytes), ns.Name)
+	}
+	namespaceMu.Lock()
+	namespaceBytes = bytes
+	namespaceMu.Unlock()
+}
+
+// CheckQuota returns an error if the bucket is of a namespace at its
+// max_disk_bytes, as of the last check of the disk, or if it is a new
+// bucket of a namespace with max_buckets already
+func CheckQuota(tbk io.TimeBucketKey) error {
+	ns := utils.InstanceConfig.NamespaceOf(tbk.GetItemInCategory("Symbol"))
+	if ns == nil {
+		return nil
+	}
+	if ns.MaxDiskBytes > 0 {
+		namespaceMu.Lock()
+		bytes := namespaceBytes[ns.Name]
+		namespaceMu.Unlock()
+		if bytes >= ns.MaxDiskBytes {
+			namespaceRejects.Inc(ns.Name)
+			return NamespaceQuotaError(fmt.Sprintf("%s: %d bytes of max_disk_bytes %d used by namespace %s",
+				tbk.GetItemKey(), bytes, ns.MaxDiskBytes, ns.Name))
+		}
+	}
+	if ns.MaxBuckets > 0 {
+		if _, err := ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(&tbk); err == nil {
+			return nil
+		}
+		if buckets, _ := NamespaceUsage(ns.Name); buckets >= ns.MaxBuckets {
+			namespaceRejects.Inc(ns.Name)
+			return NamespaceQuotaError(fmt.Sprintf("%s: namespace %s has max_buckets %d already",
+				tbk.GetItemKey(), ns.Name, ns.MaxBuckets))
+		}
+	}
+	return nil
+}
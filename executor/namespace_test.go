@@ -0,0 +1,56 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type NamespaceTests struct{}
+
+var _ = Suite(&NamespaceTests{})
+
+func (s *NamespaceTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *NamespaceTests) TearDownTest(c *C) {
+	utils.InstanceConfig.Namespaces = nil
+	namespaceBytes = map[string]int64{}
+}
+
+func (s *NamespaceTests) TestQuota(c *C) {
+	write := func(symbol string) error {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{time.Date(2016, time.March, 1, 10, 0, 0, 0, time.UTC).Unix()})
+		cs.AddColumn("Price", []float32{1.})
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*io.NewTimeBucketKey(symbol + "/1Min/PRICE"), cs)
+		return WriteCSM(csm, false)
+	}
+	alpha := &utils.NamespaceSetting{Name: "alpha", MaxBuckets: 2}
+	utils.InstanceConfig.Namespaces = []*utils.NamespaceSetting{alpha}
+
+	c.Assert(write("alpha.AAPL"), IsNil)
+	c.Assert(write("alpha.MSFT"), IsNil)
+	// at max_buckets, the existing buckets are still written
+	c.Assert(write("alpha.NVDA"), FitsTypeOf, NamespaceQuotaError(""))
+	c.Assert(write("alpha.AAPL"), IsNil)
+	// the buckets of no namespace are not limited
+	c.Assert(write("NVDA"), IsNil)
+
+	buckets, bytes := NamespaceUsage("alpha")
+	c.Assert(buckets, Equals, 2)
+	c.Assert(bytes > 0, Equals, true)
+
+	// max_disk_bytes is checked against the usage of the last refresh
+	alpha.MaxDiskBytes = bytes
+	c.Assert(write("alpha.AAPL"), IsNil)
+	refreshNamespaces()
+	c.Assert(write("alpha.AAPL"), FitsTypeOf, NamespaceQuotaError(""))
+	alpha.MaxDiskBytes = bytes + 1
+	c.Assert(write("alpha.AAPL"), IsNil)
+}
@@ -0,0 +1,185 @@
+package executor
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+/*
+The variable length records store their time in 2^32 ticks of their interval,
+about 14ns for 1Min, so the Nanoseconds read back are approximate.  The
+nanosecond buckets have the hidden INT32 EpochNanos column besides, holding
+the exact nanoseconds of the second of their records, so that their records
+are read back at their exact time and in its order.  Their Epoch is in
+nanoseconds, without a Nanoseconds column, in the writes and in the results
+of the queries.
+*/
+
+// EpochNanosColumn is the hidden column of the nanosecond buckets
+const EpochNanosColumn = "EpochNanos"
+
+// NanosecondIndexed returns true if the bucket is a nanosecond bucket, whose
+// records are indexed by their epoch in nanoseconds
+func NanosecondIndexed(tbk io.TimeBucketKey) bool {
+	tbi, err := ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(&tbk)
+	return err == nil && nanosecondIndexed(tbi)
+}
+
+func nanosecondIndexed(tbi *io.TimeBucketInfo) bool {
+	if tbi.GetRecordType() != io.VARIABLE {
+		return false
+	}
+	for _, shape := range tbi.GetDataShapes() {
+		if shape.Name == EpochNanosColumn && shape.Type == io.INT32 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeEpochNanos splits the nanosecond Epoch of the column series written
+// to a nanosecond bucket into the seconds and the Nanoseconds of the other
+// variable length records, unless it has them already, and sets the
+// EpochNanos column from the Nanoseconds
+func encodeEpochNanos(cs *io.ColumnSeries) error {
+	nanos, ok := cs.GetByName("Nanoseconds").([]int32)
+	if !ok {
+		epochs := cs.GetEpoch()
+		if epochs == nil {
+			return fmt.Errorf("no Epoch column of nanoseconds to write")
+		}
+		secs := make([]int64, len(epochs))
+		nanos = make([]int32, len(epochs))
+		for i, epoch := range epochs {
+			secs[i], nanos[i] = splitNanos(epoch)
+		}
+		if err := cs.Replace("Epoch", secs); err != nil {
+			return err
+		}
+		cs.AddColumn("Nanoseconds", nanos)
+	}
+	exact := make([]int32, len(nanos))
+	copy(exact, nanos)
+	if cs.Exists(EpochNanosColumn) {
+		return cs.Replace(EpochNanosColumn, exact)
+	}
+	cs.AddColumn(EpochNanosColumn, exact)
+	return nil
+}
+
+// decodeEpochNanos sets the Nanoseconds of the column series read from a
+// nanosecond bucket from its EpochNanos column, which is removed, correcting
+// the Epoch they were read with from the ticks
+func decodeEpochNanos(cs *io.ColumnSeries) error {
+	exact, ok := cs.GetByName(EpochNanosColumn).([]int32)
+	if !ok {
+		return nil
+	}
+	epochs := cs.GetEpoch()
+	nanos, _ := cs.GetByName("Nanoseconds").([]int32)
+	secs := make([]int64, len(epochs))
+	for i, epoch := range epochs {
+		read := epoch * 1e9
+		if nanos != nil {
+			read += int64(nanos[i])
+		}
+		// the read time is within a tick of the written one
+		secs[i], _ = splitNanos(read - int64(exact[i]) + 5e8)
+	}
+	if err := cs.Replace("Epoch", secs); err != nil {
+		return err
+	}
+	if nanos == nil {
+		cs.AddColumn("Nanoseconds", exact)
+	} else if err := cs.Replace("Nanoseconds", exact); err != nil {
+		return err
+	}
+	return cs.Remove(EpochNanosColumn)
+}
+
+// ToEpochNanos replaces the Epoch and the Nanoseconds of the column series
+// by its Epoch in nanoseconds, as the nanosecond buckets are queried
+func ToEpochNanos(cs *io.ColumnSeries) error {
+	nanos, ok := cs.GetByName("Nanoseconds").([]int32)
+	if !ok {
+		return nil
+	}
+	epochs := cs.GetEpoch()
+	out := make([]int64, len(epochs))
+	for i, epoch := range epochs {
+		out[i] = epoch*1e9 + int64(nanos[i])
+	}
+	if err := cs.Replace("Epoch", out); err != nil {
+		return err
+	}
+	return cs.Remove("Nanoseconds")
+}
+
+func hasEpochNanos(dataShapes []io.DataShape) bool {
+	for _, shape := range dataShapes {
+		if shape.Name == EpochNanosColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// trimToNanoseconds removes the rows of the column series with nanoseconds
+// before the start or after the end of the range to their nanosecond
+func trimToNanoseconds(cs *io.ColumnSeries, dr *planner.DateRange) error {
+	nanos, ok := cs.GetByName("Nanoseconds").([]int32)
+	if !ok || dr == nil {
+		return nil
+	}
+	epochs := cs.GetEpoch()
+	var keep []int
+	for i, epoch := range epochs {
+		if epoch < dr.Start || epoch == dr.Start && nanos[i] < dr.StartNanos ||
+			epoch > dr.End || epoch == dr.End && nanos[i] > dr.EndNanos {
+			continue
+		}
+		keep = append(keep, i)
+	}
+	if len(keep) == len(epochs) {
+		return nil
+	}
+	return reorderRows(cs, keep)
+}
+
+// reorderRows replaces the rows of the column series by those of the indexes
+func reorderRows(cs *io.ColumnSeries, indexes []int) error {
+	for _, name := range cs.GetColumnNames() {
+		col := reflect.ValueOf(cs.GetByName(name))
+		rows := reflect.MakeSlice(col.Type(), len(indexes), len(indexes))
+		for k, i := range indexes {
+			rows.Index(k).Set(col.Index(i))
+		}
+		valid := cs.GetValidity(name)
+		if err := cs.Replace(name, rows.Interface()); err != nil {
+			return err
+		}
+		if valid != nil {
+			rowsValid := make([]bool, len(indexes))
+			for k, i := range indexes {
+				rowsValid[k] = valid[i]
+			}
+			cs.SetValidity(name, rowsValid)
+		}
+	}
+	return nil
+}
+
+// splitNanos returns the seconds and the nanoseconds of the second of an
+// epoch in nanoseconds
+func splitNanos(epoch int64) (int64, int32) {
+	secs := epoch / 1e9
+	nanos := epoch % 1e9
+	if nanos < 0 {
+		secs--
+		nanos += 1e9
+	}
+	return secs, int32(nanos)
+}
@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type NanoIndexTests struct{}
+
+var _ = Suite(&NanoIndexTests{})
+
+func (s *NanoIndexTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *NanoIndexTests) TestNanosecondBucket(c *C) {
+	tbk := io.NewTimeBucketKey("AAPL/1D/TRADE")
+	dsv := []io.DataShape{
+		{Name: "Price", Type: io.FLOAT32},
+		{Name: EpochNanosColumn, Type: io.INT32},
+	}
+	tf := utils.NewTimeframe("1D")
+	tbi := io.NewTimeBucketInfo(*tf, tbk.GetPathToYearFiles(ThisInstance.RootDir), "Test", int16(2018), dsv, io.VARIABLE)
+	c.Assert(ThisInstance.CatalogDir.AddTimeBucket(tbk, tbi), IsNil)
+	c.Assert(NanosecondIndexed(*tbk), Equals, true)
+
+	second := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).UnixNano()
+	write := func(epochs []int64, prices []float32) {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Price", prices)
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*tbk, cs)
+		c.Assert(WriteCSM(csm, true), IsNil)
+	}
+	// the ticks of a day are about 20us, the records are read back at their
+	// exact time and in its order
+	write([]int64{second + 999999999, second + 7}, []float32{3, 2})
+	write([]int64{second + 3, second + 1e9}, []float32{1, 4})
+
+	read := func(startNanos, endNanos int32) *io.ColumnSeries {
+		q := planner.NewQuery(ThisInstance.CatalogDir)
+		q.AddTargetKey(tbk)
+		q.SetRange(second/1e9, second/1e9+1)
+		q.SetNanoseconds(startNanos, endNanos)
+		parsed, err := q.Parse()
+		c.Assert(err, IsNil)
+		scanner, err := NewReader(parsed)
+		c.Assert(err, IsNil)
+		csm, err := scanner.Read()
+		c.Assert(err, IsNil)
+		cs := csm[*tbk]
+		c.Assert(ToEpochNanos(cs), IsNil)
+		return cs
+	}
+	cs := read(0, 999999999)
+	c.Assert(cs.GetColumnNames(), DeepEquals, []string{"Epoch", "Price"})
+	c.Assert(cs.GetEpoch(), DeepEquals, []int64{second + 3, second + 7, second + 999999999, second + 1e9})
+	c.Assert(cs.GetByName("Price"), DeepEquals, []float32{1, 2, 3, 4})
+
+	// the range is bounded by the nanoseconds of its start and end
+	cs = read(5, 0)
+	c.Assert(cs.GetEpoch(), DeepEquals, []int64{second + 7, second + 999999999, second + 1e9})
+	cs = read(8, -1)
+	c.Assert(cs.GetEpoch(), DeepEquals, []int64{second + 999999999})
+}
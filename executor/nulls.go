@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// nullsColumn is the hidden UINT64 column of the buckets storing missing
+// values, whose bit i is set in the records missing the value of the i-th
+// column of the bucket but the Epoch, only the first 64 being able to miss
+// values
+const nullsColumn = "Nulls"
+
+// addNullsColumn adds an empty Nulls column to the column series with
+// missing values, for the bucket created by its write to have one
+func addNullsColumn(cs *io.ColumnSeries) {
+	if cs.HasValidity() && !cs.Exists(nullsColumn) {
+		cs.AddColumn(nullsColumn, make([]uint64, cs.Len()))
+	}
+}
+
+// encodeNulls sets the Nulls column of the column series written to the
+// bucket from the validity of its columns, if the bucket has one
+func encodeNulls(tbk io.TimeBucketKey, tbi *io.TimeBucketInfo, cs *io.ColumnSeries) error {
+	shapes := tbi.GetDataShapes()
+	hasNulls := false
+	for _, shape := range shapes {
+		if shape.Name == nullsColumn && shape.Type == io.UINT64 {
+			hasNulls = true
+		}
+	}
+	if !hasNulls {
+		if cs.HasValidity() {
+			return fmt.Errorf("bucket %s has no %s column to store missing values",
+				tbk.String(), nullsColumn)
+		}
+		return nil
+	}
+
+	nulls := make([]uint64, cs.Len())
+	for i, shape := range shapes {
+		valid := cs.GetValidity(shape.Name)
+		if valid == nil {
+			continue
+		}
+		if i >= 64 {
+			return fmt.Errorf("column %s of bucket %s cannot miss values, only its first 64 columns can",
+				shape.Name, tbk.String())
+		}
+		for j, v := range valid {
+			if !v {
+				nulls[j] |= 1 << uint(i)
+			}
+		}
+	}
+	if cs.Exists(nullsColumn) {
+		return cs.Replace(nullsColumn, nulls)
+	}
+	cs.AddColumn(nullsColumn, nulls)
+	return nil
+}
+
+// decodeNulls sets the validity of the columns of the column series read
+// from the bucket from its Nulls column, which is removed
+func decodeNulls(cs *io.ColumnSeries, dataShapes []io.DataShape) error {
+	nulls, ok := cs.GetByName(nullsColumn).([]uint64)
+	if !ok {
+		return nil
+	}
+	// the data shapes of the query start with the Epoch
+	for i, shape := range dataShapes[1:] {
+		if i >= 64 {
+			break
+		}
+		bit := uint64(1) << uint(i)
+		var valid []bool
+		for j, n := range nulls {
+			if n&bit == 0 {
+				continue
+			}
+			if valid == nil {
+				valid = make([]bool, len(nulls))
+				for k := range valid {
+					valid[k] = true
+				}
+			}
+			valid[j] = false
+		}
+		cs.SetValidity(shape.Name, valid)
+	}
+	return cs.Remove(nullsColumn)
+}
+
+// HiddenColumn returns true for the hidden columns of the buckets, which
+// are not read as columns of their own
+func HiddenColumn(name string) bool {
+	return name == nullsColumn || name == EpochNanosColumn
+}
+
+// NullableColumns returns the columns of the bucket which can miss values,
+// none without a Nulls column
+func NullableColumns(tbi *io.TimeBucketInfo) map[string]bool {
+	nullable := map[string]bool{}
+	shapes := tbi.GetDataShapes()
+	for _, shape := range shapes {
+		if shape.Name == nullsColumn && shape.Type == io.UINT64 {
+			for i, shape := range shapes {
+				if i < 64 && !HiddenColumn(shape.Name) {
+					nullable[shape.Name] = true
+				}
+			}
+			break
+		}
+	}
+	return nullable
+}
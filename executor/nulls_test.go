@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type NullsTests struct{}
+
+var _ = Suite(&NullsTests{})
+
+func (s *NullsTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *NullsTests) TestMissingValues(c *C) {
+	tbk := io.NewTimeBucketKey("AAPL/1Min/OHLCV")
+	start := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).Unix()
+	write := func(tbk *io.TimeBucketKey, epoch int64, valid []bool) error {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{epoch, epoch + 60, epoch + 120})
+		cs.AddColumn("Close", []float32{1, 2, 3})
+		cs.AddColumn("Volume", []int64{10, 20, 30})
+		cs.SetValidity("Volume", valid)
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*tbk, cs)
+		return WriteCSM(csm, false)
+	}
+
+	// the bucket created by the write has a Nulls column
+	c.Assert(write(tbk, start, []bool{true, false, true}), IsNil)
+	c.Assert(write(tbk, start+180, nil), IsNil)
+
+	cs, err := readRange(*tbk, start, start+360)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetColumnNames(), DeepEquals, []string{"Epoch", "Close", "Volume"})
+	c.Assert(cs.GetByName("Volume"), DeepEquals, []int64{10, 20, 30, 10, 20, 30})
+	c.Assert(cs.GetValidity("Volume"), DeepEquals, []bool{true, false, true, true, true, true})
+	c.Assert(cs.GetValidity("Close"), IsNil)
+
+	// a bucket without a Nulls column only takes values
+	other := io.NewTimeBucketKey("MSFT/1Min/OHLCV")
+	c.Assert(write(other, start, nil), IsNil)
+	c.Assert(write(other, start+180, []bool{false, true, true}), NotNil)
+	cs, err = readRange(*other, start, start+360)
+	c.Assert(err, IsNil)
+	c.Assert(cs.Len(), Equals, 3)
+	c.Assert(cs.HasValidity(), Equals, false)
+}
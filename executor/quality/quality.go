@@ -0,0 +1,253 @@
+// Package quality analyzes the records of the buckets for their gaps, zero
+// or negative prices, duplicate timestamps and abnormal jumps, and records
+// the findings in a QUALITY bucket next to each bucket analyzed, with the
+// coverage of every period analyzed, so that the completeness of a dataset
+// can be tracked over time.
+package quality
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/uda"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// AttributeGroup is that of the buckets of the findings, e.g.
+// AAPL/1Min/QUALITY for those of AAPL/1Min/OHLCV
+const AttributeGroup = "QUALITY"
+
+// The kinds of findings
+const (
+	// GAP is a period without records, its Value the seconds of it within
+	// the market hours
+	GAP = "gap"
+	// PRICE is a zero or negative price, its Value
+	PRICE = "price"
+	// DUPLICATE is a time of several records, its Value their number
+	DUPLICATE = "duplicate"
+	// JUMP is a change of the price beyond the maximum, its Value the
+	// relative change, e.g. -0.25 for a fall of a quarter
+	JUMP = "jump"
+	// COVERAGE is the share of the market hours of a period analyzed the
+	// records cover, from 0 to 1, at the start of the period
+	COVERAGE = "coverage"
+)
+
+// Finding is an issue of a record, or of a period
+type Finding struct {
+	Epoch int64  `msgpack:"epoch"`
+	Kind  string `msgpack:"kind"`
+	// Column is the price column of the PRICE and JUMP findings
+	Column string  `msgpack:"column,omitempty"`
+	Value  float64 `msgpack:"value"`
+}
+
+// Rules are what the records of a bucket are checked against
+type Rules struct {
+	// Timeframe is the period a record covers
+	Timeframe time.Duration
+	// MaxGap is the longest period without records within the market hours
+	// not reported, the Timeframe by default, for a missing record to be
+	MaxGap time.Duration
+	// MaxJump is the largest relative change of the close, or of the price,
+	// between two records not reported, 0 for no limit
+	MaxJump float64
+	// Calendar bounds the market hours, all the time without one
+	Calendar *calendar.Calendar
+}
+
+// Analyze returns the findings of the records of the column series from
+// start until end, in the order of time, the last being their coverage
+func Analyze(cs *io.ColumnSeries, start, end time.Time, rules Rules) []Finding {
+	var findings []Finding
+	epochs := cs.GetEpoch()
+	findings = append(findings, duplicates(cs)...)
+	findings = append(findings, prices(cs)...)
+	findings = append(findings, jumps(cs, rules.MaxJump)...)
+	gaps, coverage := gaps(epochs, start, end, rules)
+	findings = append(findings, gaps...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Epoch < findings[j].Epoch
+	})
+	if coverage >= 0 {
+		findings = append(findings, Finding{Epoch: start.Unix(), Kind: COVERAGE, Value: coverage})
+	}
+	return findings
+}
+
+// duplicates returns the times of several records, to their nanosecond if
+// the records have them
+func duplicates(cs *io.ColumnSeries) (findings []Finding) {
+	epochs := cs.GetEpoch()
+	nanos, _ := cs.GetByName("Nanoseconds").([]int32)
+	same := func(i, j int) bool {
+		return epochs[i] == epochs[j] && (nanos == nil || nanos[i] == nanos[j])
+	}
+	for i := 0; i < len(epochs); {
+		n := 1
+		for i+n < len(epochs) && same(i, i+n) {
+			n++
+		}
+		if n > 1 {
+			findings = append(findings, Finding{Epoch: epochs[i], Kind: DUPLICATE, Value: float64(n)})
+		}
+		i += n
+	}
+	return findings
+}
+
+// prices returns the zero and negative values of the price columns
+func prices(cs *io.ColumnSeries) (findings []Finding) {
+	epochs := cs.GetEpoch()
+	for _, name := range corpaction.PriceColumns {
+		if !cs.Exists(name) {
+			continue
+		}
+		values, err := uda.ColumnToFloat64(cs, name)
+		if err != nil {
+			continue
+		}
+		for i, v := range values {
+			if v <= 0 {
+				findings = append(findings, Finding{Epoch: epochs[i], Kind: PRICE, Column: name, Value: v})
+			}
+		}
+	}
+	return findings
+}
+
+// jumps returns the changes of the close, or else of the price, beyond
+// maxJump between the records with a positive one
+func jumps(cs *io.ColumnSeries, maxJump float64) (findings []Finding) {
+	if maxJump <= 0 {
+		return nil
+	}
+	epochs := cs.GetEpoch()
+	for _, name := range []string{"Close", "Price"} {
+		if !cs.Exists(name) {
+			continue
+		}
+		values, err := uda.ColumnToFloat64(cs, name)
+		if err != nil {
+			return nil
+		}
+		prev := math.NaN()
+		for i, v := range values {
+			if !(v > 0) {
+				continue
+			}
+			if change := v/prev - 1; math.Abs(change) > maxJump {
+				findings = append(findings, Finding{Epoch: epochs[i], Kind: JUMP, Column: name, Value: change})
+			}
+			prev = v
+		}
+		return findings
+	}
+	return nil
+}
+
+// gaps returns the periods within the market hours from start until end
+// the records do not cover for MaxGap or longer, each record covering its
+// timeframe, and the share of the market hours the records cover, -1 if
+// the market was not open
+func gaps(epochs []int64, start, end time.Time, rules Rules) (findings []Finding, coverage float64) {
+	hours := newMarketHours(start, end, rules.Calendar)
+	if hours.total == 0 {
+		return nil, -1
+	}
+	timeframe := int64(rules.Timeframe / time.Second)
+	maxGap := int64(rules.MaxGap / time.Second)
+	if maxGap <= 0 {
+		maxGap = timeframe
+	}
+	var missing int64
+	covered := start.Unix()
+	gap := func(until int64) {
+		if seconds := hours.between(covered, until); seconds > 0 {
+			missing += seconds
+			if seconds >= maxGap {
+				findings = append(findings, Finding{Epoch: hours.next(covered), Kind: GAP, Value: float64(seconds)})
+			}
+		}
+	}
+	for _, epoch := range epochs {
+		if epoch > covered {
+			gap(epoch)
+		}
+		if epoch+timeframe > covered {
+			covered = epoch + timeframe
+		}
+	}
+	if end.Unix() > covered {
+		gap(end.Unix())
+	}
+	return findings, 1 - float64(missing)/float64(hours.total)
+}
+
+// marketHours are the periods the market is open within a period
+type marketHours struct {
+	// the open periods in order, and the seconds open before each
+	spans  [][2]int64
+	before []int64
+	total  int64
+}
+
+func newMarketHours(start, end time.Time, cal *calendar.Calendar) *marketHours {
+	h := &marketHours{}
+	add := func(from, to time.Time) {
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			h.spans = append(h.spans, [2]int64{from.Unix(), to.Unix()})
+			h.before = append(h.before, h.total)
+			h.total += to.Unix() - from.Unix()
+		}
+	}
+	if cal == nil {
+		add(start, end)
+		return h
+	}
+	for _, s := range cal.Sessions(start, end) {
+		if s.BreakStart.IsZero() {
+			add(s.Open, s.Close)
+		} else {
+			add(s.Open, s.BreakStart)
+			add(s.BreakEnd, s.Close)
+		}
+	}
+	return h
+}
+
+// open returns the seconds the market is open before the epoch
+func (h *marketHours) open(epoch int64) int64 {
+	i := sort.Search(len(h.spans), func(i int) bool { return h.spans[i][1] > epoch })
+	if i == len(h.spans) {
+		return h.total
+	}
+	if epoch <= h.spans[i][0] {
+		return h.before[i]
+	}
+	return h.before[i] + epoch - h.spans[i][0]
+}
+
+// between returns the seconds the market is open from one epoch to another
+func (h *marketHours) between(from, to int64) int64 {
+	return h.open(to) - h.open(from)
+}
+
+// next returns the epoch, or the next open after it if the market is closed
+func (h *marketHours) next(epoch int64) int64 {
+	i := sort.Search(len(h.spans), func(i int) bool { return h.spans[i][1] > epoch })
+	if i < len(h.spans) && epoch < h.spans[i][0] {
+		return h.spans[i][0]
+	}
+	return epoch
+}
@@ -0,0 +1,117 @@
+package quality
+
+import (
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type QualityTestSuite struct{}
+
+var _ = Suite(&QualityTestSuite{})
+
+func (s *QualityTestSuite) TestAnalyze(c *C) {
+	cal, err := calendar.Load("nyse")
+	c.Assert(err, IsNil)
+	ny := cal.Tz()
+	at := func(hour, minute int) int64 {
+		return time.Date(2024, time.March, 4, hour, minute, 0, 0, ny).Unix()
+	}
+	// the bars of the session, but for those from 10:00 until 10:09
+	var epochs []int64
+	var closes []float32
+	for epoch := at(9, 30); epoch < at(16, 0); epoch += 60 {
+		if epoch >= at(10, 0) && epoch < at(10, 10) {
+			continue
+		}
+		epochs = append(epochs, epoch)
+		closes = append(closes, 100)
+		switch epoch {
+		case at(11, 0):
+			epochs = append(epochs, epoch)
+			closes = append(closes, 100)
+		case at(12, 0):
+			closes[len(closes)-1] = 0
+		case at(13, 0):
+			closes[len(closes)-1] = 150
+		}
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Close", closes)
+
+	rules := Rules{Timeframe: time.Minute, MaxJump: 0.2, Calendar: cal}
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, ny)
+	end := start.AddDate(0, 0, 1)
+	rise, fall, missing := 150., 100., 600.
+	findings := Analyze(cs, start, end, rules)
+	c.Assert(findings, DeepEquals, []Finding{
+		{Epoch: at(10, 0), Kind: GAP, Value: 600},
+		{Epoch: at(11, 0), Kind: DUPLICATE, Value: 2},
+		{Epoch: at(12, 0), Kind: PRICE, Column: "Close", Value: 0},
+		{Epoch: at(13, 0), Kind: JUMP, Column: "Close", Value: 0.5},
+		{Epoch: at(13, 1), Kind: JUMP, Column: "Close", Value: fall/rise - 1},
+		{Epoch: start.Unix(), Kind: COVERAGE, Value: 1 - missing/(390*60)},
+	})
+
+	// the shorter gaps only count against the coverage
+	rules.MaxGap = 15 * time.Minute
+	rules.MaxJump = 0
+	findings = Analyze(cs, start, end, rules)
+	c.Assert(findings, HasLen, 3)
+	c.Assert(findings[2].Kind, Equals, COVERAGE)
+
+	// nothing is missing while the market is closed
+	empty := io.NewColumnSeries()
+	weekend := time.Date(2024, time.March, 2, 0, 0, 0, 0, ny)
+	c.Assert(Analyze(empty, weekend, weekend.AddDate(0, 0, 2), rules), HasLen, 0)
+	// a session without records
+	findings = Analyze(empty, start, end, rules)
+	c.Assert(findings, DeepEquals, []Finding{
+		{Epoch: at(9, 30), Kind: GAP, Value: 390 * 60},
+		{Epoch: start.Unix(), Kind: COVERAGE, Value: 0},
+	})
+}
+
+func (s *QualityTestSuite) TestCheck(c *C) {
+	executor.NewInstanceSetup(c.MkDir(), true, true, false, true)
+	start := time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC)
+	tbk := io.NewTimeBucketKey("AAPL/1Min/OHLCV")
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{start.Unix(), start.Unix() + 60, start.Unix() + 300})
+	cs.AddColumn("Close", []float32{100, -1, 101})
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	check := &utils.QualityCheckSetting{Pattern: "*/1Min/*"}
+	end := start.Add(10 * time.Minute)
+	c.Assert(Check(check, start, end), IsNil)
+	// neither the QUALITY buckets are analyzed, nor the findings written
+	// twice
+	c.Assert(Check(check, start, end), IsNil)
+
+	quality := Key(*tbk)
+	c.Assert(quality.GetItemKey(), Equals, "AAPL/1Min/QUALITY")
+	findings, err := Read(quality, start, end)
+	c.Assert(err, IsNil)
+	c.Assert(findings, HasLen, 1)
+	missing := 420.
+	c.Assert(findings["OHLCV"], DeepEquals, []Finding{
+		{Epoch: start.Unix(), Kind: COVERAGE, Value: 1 - missing/600},
+		{Epoch: start.Unix() + 60, Kind: PRICE, Column: "Close", Value: -1},
+		{Epoch: start.Unix() + 120, Kind: GAP, Value: 180},
+		{Epoch: start.Unix() + 360, Kind: GAP, Value: 240},
+	})
+
+	_, err = Findings(io.NewColumnSeries())
+	c.Assert(err, NotNil)
+}
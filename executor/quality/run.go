@@ -0,0 +1,201 @@
+package quality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// delay of the runs after the end of the period they analyze, for the
+// records of its end to be written
+const delay = time.Minute
+
+// Schedule analyzes the buckets of the quality setting every interval, from
+// the next multiple of it since the Unix epoch, until the context is done
+func Schedule(ctx context.Context) {
+	setting := utils.InstanceConfig.Quality
+	if setting == nil || len(setting.Checks) == 0 {
+		return
+	}
+	for {
+		end := time.Now().Truncate(setting.Interval).Add(setting.Interval)
+		timer := time.NewTimer(time.Until(end.Add(delay)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for _, check := range setting.Checks {
+			if err := Check(check, end.Add(-setting.Interval), end); err != nil {
+				log.Error("failed to analyze the quality of %s (%v)", check.Pattern, err)
+			}
+		}
+	}
+}
+
+// Check analyzes the records from start until end of the buckets matching
+// the pattern of the check, and writes the findings to their QUALITY
+// buckets, but for those already written by a previous check of the period
+func Check(check *utils.QualityCheckSetting, start, end time.Time) error {
+	g, err := glob.Compile(check.Pattern, '/')
+	if err != nil {
+		return err
+	}
+	rules := Rules{MaxGap: check.MaxGap, MaxJump: check.MaxJump}
+	if check.Calendar != "" {
+		if rules.Calendar, err = calendar.Load(check.Calendar); err != nil {
+			return err
+		}
+	}
+	for _, key := range executor.BucketKeys() {
+		tbk := io.NewTimeBucketKey(key)
+		if !g.Match(key) || tbk.GetItemInCategory("AttributeGroup") == AttributeGroup {
+			continue
+		}
+		rules.Timeframe = utils.CandleDurationFromString(tbk.GetItemInCategory("Timeframe")).Duration()
+		cs, err := read(*tbk, start, end)
+		if err != nil {
+			return err
+		}
+		findings, err := unrecorded(*tbk, Analyze(cs, start, end, rules), start, end)
+		if err != nil {
+			return err
+		}
+		if err = Write(*tbk, findings); err != nil {
+			return fmt.Errorf("failed to write the findings of %s: %v", key, err)
+		}
+		issues := 0
+		for _, f := range findings {
+			if f.Kind != COVERAGE {
+				issues++
+			}
+		}
+		if issues > 0 {
+			log.Info("found %d quality issues in %s from %v to %v", issues, key, start, end)
+		}
+	}
+	return nil
+}
+
+// Key returns the key of the QUALITY bucket of the findings of a bucket,
+// shared by the buckets of its symbol and timeframe, whose findings have the
+// attribute group of their bucket
+func Key(tbk io.TimeBucketKey) io.TimeBucketKey {
+	return *io.NewTimeBucketKey(strings.Join([]string{
+		tbk.GetItemInCategory("Symbol"),
+		tbk.GetItemInCategory("Timeframe"),
+		AttributeGroup,
+	}, "/"))
+}
+
+// Write records the findings of the bucket in its QUALITY bucket
+func Write(tbk io.TimeBucketKey, findings []Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	epochs := make([]int64, len(findings))
+	kinds := make([]string, len(findings))
+	columns := make([]string, len(findings))
+	values := make([]float64, len(findings))
+	groups := make([]string, len(findings))
+	for i, f := range findings {
+		epochs[i], kinds[i], columns[i], values[i] = f.Epoch, f.Kind, f.Column, f.Value
+		groups[i] = tbk.GetItemInCategory("AttributeGroup")
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("AttributeGroup", groups)
+	cs.AddColumn("Kind", kinds)
+	cs.AddColumn("Column", columns)
+	cs.AddColumn("Value", values)
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(Key(tbk), cs)
+	return executor.WriteCSM(csm, true)
+}
+
+// Findings returns the findings of the records of a QUALITY bucket by the
+// attribute group of their bucket
+func Findings(cs *io.ColumnSeries) (map[string][]Finding, error) {
+	epochs := cs.GetEpoch()
+	groups, ok := cs.GetByName("AttributeGroup").([]string)
+	kinds, ok1 := cs.GetByName("Kind").([]string)
+	columns, ok2 := cs.GetByName("Column").([]string)
+	values, ok3 := cs.GetByName("Value").([]float64)
+	if !ok || !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("not the records of a %s bucket", AttributeGroup)
+	}
+	findings := map[string][]Finding{}
+	for i := range epochs {
+		findings[groups[i]] = append(findings[groups[i]],
+			Finding{Epoch: epochs[i], Kind: kinds[i], Column: columns[i], Value: values[i]})
+	}
+	return findings, nil
+}
+
+// unrecorded returns the findings of the bucket not in its QUALITY bucket
+// from start until end yet
+func unrecorded(tbk io.TimeBucketKey, findings []Finding, start, end time.Time) ([]Finding, error) {
+	recorded, err := Read(Key(tbk), start, end)
+	if err != nil || len(recorded) == 0 {
+		return findings, err
+	}
+	seen := map[Finding]bool{}
+	for _, f := range recorded[tbk.GetItemInCategory("AttributeGroup")] {
+		seen[f] = true
+	}
+	var unseen []Finding
+	for _, f := range findings {
+		if !seen[f] {
+			unseen = append(unseen, f)
+		}
+	}
+	return unseen, nil
+}
+
+// Read returns the findings of a QUALITY bucket from start until end,
+// excluded, by the attribute group of their bucket
+func Read(key io.TimeBucketKey, start, end time.Time) (map[string][]Finding, error) {
+	cs, err := read(key, start, end)
+	if err != nil || cs.Len() == 0 {
+		return nil, err
+	}
+	return Findings(cs)
+}
+
+// read returns the records of the bucket from start until end, excluded
+func read(tbk io.TimeBucketKey, start, end time.Time) (*io.ColumnSeries, error) {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(&tbk)
+	q.SetRange(start.Unix(), end.Unix()-1)
+	parsed, err := q.Parse()
+	if errors.Is(err, planner.ErrNoFiles) {
+		// no records within the period
+		return io.NewColumnSeries(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return nil, err
+	}
+	if cs := csm[tbk]; cs != nil {
+		return cs, nil
+	}
+	return io.NewColumnSeries(), nil
+}
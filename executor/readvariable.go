@@ -16,12 +16,15 @@ import (
 */
 import "C"
 
-func (r *reader) readSecondStage(bufMeta []bufferMeta, limitCount int32, direction DirectionEnum) (rb []byte, err error) {
+func (r *reader) readSecondStage(bufMeta []bufferMeta, limitCount int32, direction DirectionEnum,
+	sampleInterval int) (rb []byte, err error) {
 	/*
 		Here we use the bufFileMap which has index data for each file, then we read
-		the target data into the resultBuffer up to the limitCount number of records
+		the target data into the resultBuffer up to the limitCount number of records,
+		only the first of every sampleInterval records if sampling
 	*/
 	var varRecLen int
+	var sampleCount int64
 	// resultBuffers for all bufMetas
 	totalBuf := make([]byte, 0)
 	for _, md := range bufMeta {
@@ -87,7 +90,7 @@ func (r *reader) readSecondStage(bufMeta []bufferMeta, limitCount int32, directi
 
 			// Loop over the variable records and prepend the index time to each
 			numVarRecords := len(buffer) / varRecLen
-			if direction == FIRST {
+			if direction == FIRST && sampleInterval <= 1 {
 				if numVarRecords >= numberLeftToRead {
 					numVarRecords = numberLeftToRead
 				}
@@ -99,6 +102,15 @@ func (r *reader) readSecondStage(bufMeta []bufferMeta, limitCount int32, directi
 			C.rewriteBuffer(arg1, C.int(varRecLen), C.int(numVarRecords), arg4,
 				C.int64_t(md.Intervals), C.int64_t(intervalStartEpoch))
 
+			if sampleInterval > 1 {
+				rbTemp = sampleRows(rbTemp, varRecLen+8, sampleInterval, &sampleCount)
+				numVarRecords = len(rbTemp) / (varRecLen + 8)
+				if direction == FIRST && numVarRecords > numberLeftToRead {
+					numVarRecords = numberLeftToRead
+					rbTemp = rbTemp[:numVarRecords*(varRecLen+8)]
+				}
+			}
+
 			//rb = append(rb, rbTemp...)
 			if (rbCursor + len(rbTemp)) > totalDatalen {
 				totalDatalen += totalDatalen
@@ -131,3 +143,16 @@ func (r *reader) readSecondStage(bufMeta []bufferMeta, limitCount int32, directi
 	}
 	return totalBuf, nil
 }
+
+// sampleRows keeps the first of every interval rows of the buffer, count
+// being the number of rows sampled so far
+func sampleRows(buffer []byte, rowLen, interval int, count *int64) []byte {
+	kept := buffer[:0]
+	for i := 0; i+rowLen <= len(buffer); i += rowLen {
+		if *count%int64(interval) == 0 {
+			kept = append(kept, buffer[i:i+rowLen]...)
+		}
+		*count++
+	}
+	return kept
+}
@@ -46,7 +46,9 @@ inline void getTimeFromTicks(uint32_t intervalStart, int64_t intervalsPerDay,
 		subseconds -= 1000000000;
 		fractionalSeconds += 1;
 	}
-	ept->epoch = intStart + fractionalSeconds;
+	// add the whole seconds as an integer, the double sum of the epoch and
+	// fractional seconds rounding up to the next second near its end
+	ept->epoch = intStart + (int64_t)fractionalSeconds;
 	// round the subseconds after the decimal point to minimize the cancellation error of subseconds
 	// round( subseconds ) = (int32_t)(subseconds + 0.5)
 	ept->nanos = subseconds + 0.5;
@@ -14,10 +14,15 @@ import (
 	"github.com/alpacahq/marketstore/utils"
 	. "github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/memlimit"
 )
 
 const RecordsPerRead = 2000
 
+// readBufferShare is the divisor of the memory limit giving the size of the
+// read buffers of a query
+const readBufferShare = 1024
+
 type SortedFileList []planner.QualifiedFile
 
 func (fl SortedFileList) Len() int           { return len(fl) }
@@ -45,6 +50,8 @@ type ioplan struct {
 	VariableRecordLen int
 	Limit             *planner.RowLimit
 	TimeQuals         []planner.TimeQualFunc
+	SampleInterval    int
+	ResourceLimits    planner.ResourceLimits
 }
 
 func NewIOPlan(fl SortedFileList, pr *planner.ParseResult) (iop *ioplan, err error) {
@@ -160,6 +167,8 @@ func NewIOPlan(fl SortedFileList, pr *planner.ParseResult) (iop *ioplan, err err
 	}
 
 	iop.TimeQuals = pr.TimeQuals
+	iop.SampleInterval = pr.SampleInterval
+	iop.ResourceLimits = pr.ResourceLimits
 
 	return iop, nil
 }
@@ -169,8 +178,15 @@ type reader struct {
 	IOPMap map[TimeBucketKey]*ioplan
 	// for packingReader to avoid redundant allocation.
 	// really ought to be somewhere close to the function...
-	readBuffer []byte
-	fileBuffer []byte
+	readBuffer     []byte
+	fileBuffer     []byte
+	recordsPerRead int32
+	// work done across all keys, checked against the query resource limits
+	usage resourceUsage
+}
+
+type resourceUsage struct {
+	rowsScanned, bytesRead, memory int64
 }
 
 func NewReader(pr *planner.ParseResult) (r *reader, err error) {
@@ -199,12 +215,27 @@ func NewReader(pr *planner.ParseResult) (r *reader, err error) {
 	// Number of bytes to buffer, some multiple of record length
 	// This should be at least bigger than 4096 and be better multiple of 4KB,
 	// which is the common io size on most of the storage/filesystem.
-	readSize := RecordsPerRead * maxRecordLen
+	r.recordsPerRead = recordsPerRead(maxRecordLen)
+	readSize := r.recordsPerRead * maxRecordLen
 	r.readBuffer = make([]byte, readSize)
 	r.fileBuffer = make([]byte, readSize)
 	return r, nil
 }
 
+// recordsPerRead returns the number of records read at once, fewer than
+// RecordsPerRead when the read buffers would exceed their share of the
+// memory limit
+func recordsPerRead(recordLen int32) int32 {
+	n := int32(RecordsPerRead)
+	budget := memlimit.Share(readBufferShare)
+	if recordLen > 0 && budget > 0 && int64(n)*int64(recordLen) > budget {
+		if n = int32(budget / int64(recordLen)); n < 1 {
+			n = 1
+		}
+	}
+	return n
+}
+
 func (r *reader) Read() (csm ColumnSeriesMap, err error) {
 	// TODO: Need to consider the huge buffer which use loooong time gap to query.
 	// Which probably cause out of memory issue and need new mechanism to handle
@@ -226,10 +257,36 @@ func (r *reader) Read() (csm ColumnSeriesMap, err error) {
 			return nil, err
 		}
 		if rt == VARIABLE {
-			buffer = trimResultsToRange(r.pr.Range.Start, r.pr.Range.End, rlen, buffer)
+			start := r.pr.Range.Start
+			if hasEpochNanos(dsMap[key]) {
+				// the Epoch read from the ticks is up to a tick earlier
+				start--
+			}
+			buffer = trimResultsToRange(start, r.pr.Range.End, rlen, buffer)
 		}
 		rs := NewRowSeries(key, buffer, dsMap[key], rlen, cat, rt)
 		key, cs := rs.ToColumnSeries()
+		if err = decodeStrings(key, cs, dsMap[key]); err != nil {
+			return nil, err
+		}
+		if err = decodeNulls(cs, dsMap[key]); err != nil {
+			return nil, err
+		}
+		if err = decodeDecimals(key, cs, dsMap[key]); err != nil {
+			return nil, err
+		}
+		if err = decodeEpochNanos(cs); err != nil {
+			return nil, err
+		}
+		bySequence := rt == VARIABLE && hasSequence(cs) && Sequenced(key)
+		if rt == VARIABLE && (hasEpochNanos(dsMap[key]) || bySequence) {
+			if err = sortByTime(cs, bySequence); err != nil {
+				return nil, err
+			}
+		}
+		if err = trimToNanoseconds(cs, r.pr.Range); err != nil {
+			return nil, err
+		}
 		csm[key] = cs
 	}
 	return csm, err
@@ -283,7 +340,7 @@ func (r *reader) read(iop *ioplan) (resultBuffer []byte, err error) {
 	// Number of bytes to buffer, some multiple of record length
 	// This should be at least bigger than 4096 and be better multiple of 4KB,
 	// which is the common io size on most of the storage/filesystem.
-	maxToBuffer := RecordsPerRead * iop.RecordLen
+	maxToBuffer := r.recordsPerRead * iop.RecordLen
 	readBuffer := r.readBuffer[:maxToBuffer]
 	// Scan direction
 	direction := iop.Limit.Direction
@@ -300,6 +357,8 @@ func (r *reader) read(iop *ioplan) (resultBuffer []byte, err error) {
 	}
 
 	ex := newIoExec(iop)
+	ex.usage = &r.usage
+	ex.forward = direction == FIRST
 
 	/*
 		if direction == FIRST
@@ -329,6 +388,9 @@ func (r *reader) read(iop *ioplan) (resultBuffer []byte, err error) {
 				iop.RecordLen,
 				limitBytes,
 				readBuffer)
+			if _, ok := err.(QueryLimitExceededError); ok {
+				return nil, err
+			}
 			if iop.RecordType == VARIABLE {
 				// If we've added data to the buffer from this file, record it for possible later use
 				if len(resultBuffer) > dataLen {
@@ -358,6 +420,9 @@ func (r *reader) read(iop *ioplan) (resultBuffer []byte, err error) {
 				bytesLeftToFill,
 				readBuffer,
 				r.fileBuffer)
+			if _, ok := err.(QueryLimitExceededError); ok {
+				return nil, err
+			}
 
 			bytesLeftToFill -= bytesRead
 			if iop.RecordType == VARIABLE {
@@ -403,17 +468,29 @@ func (r *reader) read(iop *ioplan) (resultBuffer []byte, err error) {
 		If this is a variable record type, we need a second stage of reading to get the data from the files
 	*/
 	if iop.RecordType == VARIABLE {
-		resultBuffer, err = r.readSecondStage(bufMeta, iop.Limit.Number, iop.Limit.Direction)
+		resultBuffer, err = r.readSecondStage(bufMeta, iop.Limit.Number, iop.Limit.Direction, iop.SampleInterval)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	r.usage.memory += int64(len(resultBuffer))
+	if err := ex.checkResourceLimits(0); err != nil {
+		return nil, err
+	}
+
 	return resultBuffer, err
 }
 
 type ioExec struct {
 	plan *ioplan
+	// number of valid records considered for sampling so far
+	sampleCount int64
+	// set for the forward scans, whose sampled out records are skipped
+	forward bool
+	// number of records to skip past the last one sampled
+	skip  int64
+	usage *resourceUsage
 }
 
 func (ex *ioExec) packingReader(packedBuffer *[]byte, f io.ReadSeeker, buffer []byte,
@@ -431,6 +508,21 @@ func (ex *ioExec) packingReader(packedBuffer *[]byte, f io.ReadSeeker, buffer []
 
 	var totalRead int64
 	for {
+		if ex.skip > 0 {
+			// the records sampled out are seeked over rather than read
+			skipBytes := ex.skip * int64(recordSize)
+			if skipBytes > maxRead-totalRead {
+				skipBytes = maxRead - totalRead
+			}
+			if _, err := f.Seek(skipBytes, os.SEEK_CUR); err != nil {
+				return err
+			}
+			totalRead += skipBytes
+			ex.skip -= skipBytes / int64(recordSize)
+			if totalRead >= maxRead {
+				return nil
+			}
+		}
 		n, _ := f.Read(buffer)
 
 		nn := int64(n)
@@ -441,6 +533,11 @@ func (ex *ioExec) packingReader(packedBuffer *[]byte, f io.ReadSeeker, buffer []
 		} else if nn < int64(recordSize) {
 			return fmt.Errorf("packingReader: Short read %d bytes, recordsize: %d bytes", n, recordSize)
 		}
+		ex.usage.bytesRead += nn
+		ex.usage.rowsScanned += nn / int64(recordSize)
+		if err := ex.checkResourceLimits(int64(len(*packedBuffer))); err != nil {
+			return err
+		}
 		// Calculate how many are left to read
 		leftBytes := maxRead - totalRead
 		if leftBytes < 0 {
@@ -452,6 +549,10 @@ func (ex *ioExec) packingReader(packedBuffer *[]byte, f io.ReadSeeker, buffer []
 		numToRead := nn / int64(recordSize)
 		var i int64
 		for i = 0; i < numToRead; i++ {
+			if ex.skip > 0 {
+				ex.skip--
+				continue
+			}
 			curpos := i * int64(recordSize)
 			index := int64(binary.LittleEndian.Uint64(buffer[curpos:]))
 			if index != 0 {
@@ -460,6 +561,9 @@ func (ex *ioExec) packingReader(packedBuffer *[]byte, f io.ReadSeeker, buffer []
 				if !ex.checkTimeQuals(index) {
 					continue
 				}
+				if !ex.sample() {
+					continue
+				}
 				idxpos := len(*packedBuffer)
 				*packedBuffer = append(*packedBuffer, buffer[curpos:curpos+int64(recordSize)]...)
 				b := *packedBuffer
@@ -527,6 +631,10 @@ func (ex *ioExec) readBackward(finalBuffer []byte, fp *ioFilePlan,
 
 	maxToBuffer := int32(len(readBuffer))
 	if finalBuffer == nil {
+		// the records are copied into the final buffer of the limit
+		if err = ex.checkResourceLimits(int64(bytesToRead)); err != nil {
+			return nil, false, 0, err
+		}
 		finalBuffer = make([]byte, bytesToRead, bytesToRead)
 	}
 
@@ -631,8 +739,42 @@ func (ex *ioExec) checkTimeQuals(epoch int64) bool {
 	return true
 }
 
+// sample reports whether the next valid record should be retained.  When
+// sampling a forward scan of fixed length records, each record kept is
+// followed by SampleInterval-1 records skipped without being read, and
+// otherwise only the first of every SampleInterval valid records is kept.
+// The variable length records are sampled by row by readSecondStage.
+func (ex *ioExec) sample() bool {
+	if ex.plan.SampleInterval <= 1 || ex.plan.RecordType == VARIABLE {
+		return true
+	}
+	if ex.forward {
+		ex.skip = int64(ex.plan.SampleInterval - 1)
+		return true
+	}
+	keep := ex.sampleCount%int64(ex.plan.SampleInterval) == 0
+	ex.sampleCount++
+	return keep
+}
+
+// checkResourceLimits returns an error once the work done by the query exceeds
+// any of its limits, pending is the size of the buffer still being filled
+func (ex *ioExec) checkResourceLimits(pending int64) error {
+	limits := ex.plan.ResourceLimits
+	switch {
+	case limits.MaxRowsScanned > 0 && ex.usage.rowsScanned > limits.MaxRowsScanned:
+		return QueryLimitExceededError(fmt.Sprintf("scanned more than %d rows", limits.MaxRowsScanned))
+	case limits.MaxBytesRead > 0 && ex.usage.bytesRead > limits.MaxBytesRead:
+		return QueryLimitExceededError(fmt.Sprintf("read more than %d bytes", limits.MaxBytesRead))
+	case limits.MaxMemory > 0 && ex.usage.memory+pending > limits.MaxMemory:
+		return QueryLimitExceededError(fmt.Sprintf("buffered more than %d bytes", limits.MaxMemory))
+	}
+	return nil
+}
+
 func newIoExec(iop *ioplan) *ioExec {
 	return &ioExec{
-		plan: iop,
+		plan:  iop,
+		usage: new(resourceUsage),
 	}
 }
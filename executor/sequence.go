@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"sort"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// SequenceColumn is the int64 or uint64 column of the variable length
+// records of the sequenced buckets, keyed by their time and their sequence
+// number, such as the prints of a consolidated feed at the same time.  A
+// record is not written again with the same key, and the records are read
+// in the order of their keys.  A bucket is sequenced once created so, the
+// Sequence column of the other buckets being a column like any other.
+const SequenceColumn = "Sequence"
+
+// Sequenced returns true if the bucket is a sequenced bucket, whose records
+// are keyed by their time and their sequence number
+func Sequenced(tbk io.TimeBucketKey) bool {
+	sequenced, err := ThisInstance.CatalogDir.GetSequenced(&tbk)
+	return err == nil && sequenced
+}
+
+// hasSequence returns true if the column series has the sequence numbers of
+// the records of a sequenced bucket
+func hasSequence(cs *io.ColumnSeries) bool {
+	switch cs.GetByName(SequenceColumn).(type) {
+	case []int64, []uint64:
+		return true
+	}
+	return false
+}
+
+// keyedBySequence returns true if the column series written to the bucket
+// is keyed by the time and the sequence number of its records
+func keyedBySequence(tbk io.TimeBucketKey, cs *io.ColumnSeries) bool {
+	return hasSequence(cs) && Sequenced(tbk)
+}
+
+func anyKeyedBySequence(csm io.ColumnSeriesMap) bool {
+	for tbk, cs := range csm {
+		if keyedBySequence(tbk, cs) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByTime sorts the rows of the column series of variable length records
+// by their time, then by their sequence number if bySequence
+func sortByTime(cs *io.ColumnSeries, bySequence bool) error {
+	epochs := cs.GetEpoch()
+	nanos, _ := cs.GetByName("Nanoseconds").([]int32)
+	var sequence func(i int) uint64
+	switch seq := cs.GetByName(SequenceColumn).(type) {
+	case []int64:
+		// in the order of the int64 values
+		sequence = func(i int) uint64 { return uint64(seq[i]) ^ 1<<63 }
+	case []uint64:
+		sequence = func(i int) uint64 { return seq[i] }
+	}
+	if !bySequence {
+		sequence = nil
+	}
+	order := make([]int, len(epochs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if epochs[a] != epochs[b] {
+			return epochs[a] < epochs[b]
+		}
+		if nanos != nil && nanos[a] != nanos[b] {
+			return nanos[a] < nanos[b]
+		}
+		return sequence != nil && sequence(a) < sequence(b)
+	})
+	if sort.IntsAreSorted(order) {
+		return nil
+	}
+	return reorderRows(cs, order)
+}
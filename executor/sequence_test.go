@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type SequenceTests struct{}
+
+var _ = Suite(&SequenceTests{})
+
+func (s *SequenceTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+// sequenceWriter returns a function writing the prints to the bucket
+func sequenceWriter(c *C, tbk *io.TimeBucketKey) func(epochs []int64, nanos []int32, sequence []uint64, prices []float32) {
+	return func(epochs []int64, nanos []int32, sequence []uint64, prices []float32) {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Price", prices)
+		cs.AddColumn("Sequence", sequence)
+		cs.AddColumn("Nanoseconds", nanos)
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*tbk, cs)
+		c.Assert(WriteCSM(csm, true), IsNil)
+	}
+}
+
+func (s *SequenceTests) TestSequenceKey(c *C) {
+	tbk := io.NewTimeBucketKey("AAPL/1Min/TRADE")
+	dsv := []io.DataShape{
+		{Name: "Price", Type: io.FLOAT32},
+		{Name: "Sequence", Type: io.UINT64},
+	}
+	tf := utils.NewTimeframe("1Min")
+	tbi := io.NewTimeBucketInfo(*tf, tbk.GetPathToYearFiles(ThisInstance.RootDir), "Test", int16(2018), dsv, io.VARIABLE)
+	c.Assert(ThisInstance.CatalogDir.AddTimeBucket(tbk, tbi), IsNil)
+	c.Assert(ThisInstance.CatalogDir.SetSequenced(tbk), IsNil)
+	c.Assert(Sequenced(*tbk), Equals, true)
+	start := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).Unix()
+	write := sequenceWriter(c, tbk)
+
+	// prints at the same time are read in the order of their sequence
+	write([]int64{start, start, start + 1}, []int32{500, 500, 0}, []uint64{3, 1, 4}, []float32{3, 1, 4})
+	// and written once, the same prices at the same time being kept with
+	// another sequence number
+	write([]int64{start, start, start}, []int32{500, 500, 500}, []uint64{1, 2, 5}, []float32{1, 2, 1})
+
+	cs, err := readRange(*tbk, start, start+60)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetByName("Sequence"), DeepEquals, []uint64{1, 2, 3, 5, 4})
+	c.Assert(cs.GetByName("Price"), DeepEquals, []float32{1, 2, 3, 1, 4})
+}
+
+func (s *SequenceTests) TestSequenceNotSequenced(c *C) {
+	// a bucket not created sequenced keeps all the rows of its Sequence
+	// column, in the order they are written
+	tbk := io.NewTimeBucketKey("AAPL/1Min/TRADE")
+	start := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).Unix()
+	write := sequenceWriter(c, tbk)
+	write([]int64{start, start, start + 1}, []int32{500, 500, 0}, []uint64{3, 1, 4}, []float32{3, 1, 4})
+	write([]int64{start, start}, []int32{500, 500}, []uint64{3, 1}, []float32{3, 1})
+	c.Assert(Sequenced(*tbk), Equals, false)
+
+	cs, err := readRange(*tbk, start, start+60)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetByName("Sequence"), DeepEquals, []uint64{3, 1, 3, 1, 4})
+	c.Assert(cs.GetByName("Price"), DeepEquals, []float32{3, 1, 3, 1, 4})
+}
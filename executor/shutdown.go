@@ -0,0 +1,96 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// closed is set once the instance rejects the writes, when shutting down
+var closed uint32
+
+// writesLock is held shared by the writes from their check of closed until
+// they are queued, so that none is queued past the final flush
+var writesLock sync.RWMutex
+
+// draining tracks the shutdowns, which carry on past their deadline until
+// the triggers return
+var draining sync.WaitGroup
+
+func writesClosed() bool {
+	return atomic.LoadUint32(&closed) == 1
+}
+
+// Shutdown stops the instance cleanly: the writes pending in the WAL are
+// flushed and the triggers fired until none is left, including those fired
+// by the writes of other triggers, after which the writes are rejected and
+// the primary files checkpointed.  The WAL file is then removed, as it has
+// nothing left to replay on the next startup.  The writers should be
+// stopped first, such as the API listener, for the writes to be drained.
+// If the context is done first, its error is returned and the WAL is
+// replayed on the next startup as after a crash.
+func Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	draining.Add(1)
+	go func() {
+		defer draining.Done()
+		defer close(stopped)
+		drainTriggers(ctx)
+		if ctx.Err() != nil {
+			// left to the WAL replay
+			return
+		}
+		writesLock.Lock()
+		atomic.StoreUint32(&closed, 1)
+		writesLock.Unlock()
+		if haveWALWriter() {
+			// the WAL writer checkpoints and removes the WAL file
+			ThisInstance.TXNPipe.shutdownChannel <- struct{}{}
+			ThisInstance.WALWg.Wait()
+			return
+		}
+		ThisInstance.WALFile.shutdown()
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainTriggers flushes the pending writes and waits for the triggers they
+// fire, until their own writes do not fire any
+func drainTriggers(ctx context.Context) {
+	for ctx.Err() == nil {
+		before := atomic.LoadUint64(&dispatched)
+		ThisInstance.WALFile.RequestFlush()
+		triggerWg.Wait()
+		if atomic.LoadUint64(&dispatched) == before {
+			return
+		}
+		log.Info("waiting for the triggers to finish...")
+	}
+}
+
+// shutdown flushes the pending writes, checkpoints the primary files and
+// removes the WAL file, which has nothing left to replay
+func (wf *WALFileType) shutdown() {
+	log.Info("Flushing to WAL...")
+	if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
+		log.Error("failed to flush to WAL, it will be replayed on startup: %v", err)
+		return
+	}
+	log.Info("Flushing to disk...")
+	wf.createCheckpoint()
+	if ThisInstance.WALBypass || wf.FilePtr == nil {
+		return
+	}
+	wf.FilePtr.Close()
+	if err := os.Remove(wf.FilePath); err != nil {
+		log.Error("failed to remove WAL file %s: %v", wf.FilePath, err)
+	}
+}
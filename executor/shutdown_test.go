@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type ShutdownTests struct{}
+
+var _ = Suite(&ShutdownTests{})
+
+func (s *ShutdownTests) SetUpTest(c *C) {
+	// with the WAL writer, as the server runs
+	NewInstanceSetup(c.MkDir(), true, true, true)
+}
+
+func (s *ShutdownTests) TearDownTest(c *C) {
+	draining.Wait()
+	if haveWALWriter() {
+		ThisInstance.TXNPipe.shutdownChannel <- struct{}{}
+		ThisInstance.WALWg.Wait()
+	}
+	atomic.StoreUint32(&closed, 0)
+	SetTriggerMatchers(nil)
+}
+
+// copyTrigger writes the records of the 1Min buckets to their 5Min bucket
+type copyTrigger struct{}
+
+func (t *copyTrigger) Fire(keyPath string, records []trigger.Record) {
+	epochs := make([]int64, len(records))
+	for i, record := range records {
+		epochs[i] = record.Index()*60 + time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Price", make([]float32, len(records)))
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("COPY/5Min/PRICE"), cs)
+	WriteCSM(csm, false)
+}
+
+func (s *ShutdownTests) TestShutdown(c *C) {
+	SetTriggerMatchers([]*trigger.TriggerMatcher{trigger.NewMatcher(&copyTrigger{}, "*/1Min/PRICE")})
+	start := time.Date(2016, time.March, 1, 10, 0, 0, 0, time.UTC)
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{start.Unix(), start.Add(time.Minute).Unix()})
+	cs.AddColumn("Price", []float32{1., 2.})
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("COPY/1Min/PRICE"), cs)
+	c.Assert(WriteCSM(csm, false), IsNil)
+
+	walPath := ThisInstance.WALFile.FilePath
+	c.Assert(Shutdown(context.Background()), IsNil)
+
+	// the writes of the triggers are drained too
+	copied, err := readRange(*io.NewTimeBucketKey("COPY/5Min/PRICE"), 0, start.Unix())
+	c.Assert(err, IsNil)
+	c.Assert(copied.Len(), Not(Equals), 0)
+
+	// with nothing left to replay
+	_, err = os.Stat(walPath)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	err = WriteCSM(csm, false)
+	c.Assert(err, FitsTypeOf, ShuttingDownError(""))
+}
+
+func (s *ShutdownTests) TestShutdownDeadline(c *C) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+	SetTriggerMatchers([]*trigger.TriggerMatcher{trigger.NewMatcher(&blockingTrigger{blocked}, "*/1Min/PRICE")})
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{time.Date(2016, time.March, 1, 10, 0, 0, 0, time.UTC).Unix()})
+	cs.AddColumn("Price", []float32{1.})
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("BLOCK/1Min/PRICE"), cs)
+	c.Assert(WriteCSM(csm, false), IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.Assert(Shutdown(ctx), Equals, context.DeadlineExceeded)
+}
+
+type blockingTrigger struct {
+	blocked chan struct{}
+}
+
+func (t *blockingTrigger) Fire(keyPath string, records []trigger.Record) {
+	<-t.blocked
+}
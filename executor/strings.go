@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// serializeRows returns the records of the column series in the layout of
+// the bucket, its string columns being stored in the fixed slots of their
+// type in the bucket, or as the codes of the dictionary of the bucket for
+// STRING, and its bool columns a byte per value for BOOL
+func serializeRows(tbk io.TimeBucketKey, tbi *io.TimeBucketInfo, cs *io.ColumnSeries, alignData bool) ([]byte, error) {
+	bucketTypes := map[string]io.EnumElementType{}
+	for _, shape := range tbi.GetDataShapes() {
+		if shape.Type.IsString() || shape.Type == io.BOOL {
+			bucketTypes[shape.Name] = shape.Type
+		}
+	}
+	if len(bucketTypes) == 0 {
+		return cs.ToRowSeries(tbk, alignData).GetData(), nil
+	}
+
+	encoded := io.NewColumnSeries()
+	dataShapes := cs.GetDataShapes()
+	for i, shape := range dataShapes {
+		column := cs.GetByName(shape.Name)
+		typ, ok := bucketTypes[shape.Name]
+		switch {
+		case !ok:
+		case typ == io.STRING:
+			sd, err := ThisInstance.CatalogDir.GetStringDictionary(&tbk)
+			if err != nil {
+				return nil, err
+			}
+			if column, err = sd.Encode(column.([]string)); err != nil {
+				return nil, err
+			}
+			dataShapes[i].Type = io.UINT32
+		case typ == io.BOOL:
+			bytes := make([]byte, len(column.([]bool)))
+			for j, b := range column.([]bool) {
+				if b {
+					bytes[j] = 1
+				}
+			}
+			column = bytes
+			dataShapes[i].Type = io.UINT8
+		default:
+			dataShapes[i].Type = typ
+		}
+		encoded.AddColumn(shape.Name, column)
+	}
+	data, _ := io.SerializeColumnsToRows(encoded, dataShapes, alignData)
+	return data, nil
+}
+
+// decodeStrings replaces the codes of the dictionary encoded string columns
+// read from the bucket by their strings
+func decodeStrings(tbk io.TimeBucketKey, cs *io.ColumnSeries, dataShapes []io.DataShape) error {
+	for _, shape := range dataShapes {
+		if shape.Type != io.STRING {
+			continue
+		}
+		codes, ok := cs.GetByName(shape.Name).([]uint32)
+		if !ok {
+			continue
+		}
+		sd, err := ThisInstance.CatalogDir.GetStringDictionary(&tbk)
+		if err != nil {
+			return err
+		}
+		values, err := sd.Decode(codes)
+		if err != nil {
+			return err
+		}
+		if err = cs.Replace(shape.Name, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
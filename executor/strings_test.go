@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/catalog"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type StringsTests struct{}
+
+var _ = Suite(&StringsTests{})
+
+func (s *StringsTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *StringsTests) TestStringColumns(c *C) {
+	tbk := io.NewTimeBucketKey("AAPL/1Sec/TRADE")
+	tf := utils.NewTimeframe("1Sec")
+	dsv := []io.DataShape{
+		{Name: "Price", Type: io.FLOAT32},
+		{Name: "Exchange", Type: io.STRING},
+		{Name: "Headline", Type: io.STRING16},
+	}
+	tbi := io.NewTimeBucketInfo(*tf, tbk.GetPathToYearFiles(ThisInstance.RootDir), "Test", int16(2018), dsv, io.VARIABLE)
+	c.Assert(ThisInstance.CatalogDir.AddTimeBucket(tbk, tbi), IsNil)
+
+	start := time.Date(2018, time.January, 2, 9, 30, 0, 0, time.UTC).Unix()
+	write := func(epoch int64, exchanges, headlines []string) {
+		cs := io.NewColumnSeries()
+		epochs := make([]int64, len(exchanges))
+		prices := make([]float32, len(exchanges))
+		for i := range epochs {
+			epochs[i] = epoch + int64(i)
+		}
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Price", prices)
+		cs.AddColumn("Exchange", exchanges)
+		cs.AddColumn("Headline", headlines)
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*tbk, cs)
+		c.Assert(WriteCSM(csm, true), IsNil)
+	}
+	write(start, []string{"NASDAQ", "NYSE", "NASDAQ"},
+		[]string{"", "Apple earnings", "Apple beats estimates by a mile"})
+	write(start+10, []string{"ARCA", "NYSE"}, []string{"€uro zone ¥€", "x"})
+
+	cs, err := readRange(*tbk, start, start+20)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetByName("Exchange"), DeepEquals, []string{"NASDAQ", "NYSE", "NASDAQ", "ARCA", "NYSE"})
+	// cut to the 16 bytes of the slots, after their last whole character
+	c.Assert(cs.GetByName("Headline"), DeepEquals,
+		[]string{"", "Apple earnings", "Apple beats esti", "€uro zone ¥", "x"})
+
+	// the codes of the dictionary, written once per string
+	sd, err := ThisInstance.CatalogDir.GetStringDictionary(tbk)
+	c.Assert(err, IsNil)
+	c.Assert(sd.Len(), Equals, 4)
+
+	// the dictionary is reloaded from its file
+	ThisInstance.CatalogDir = catalog.NewDirectory(ThisInstance.RootDir)
+	cs, err = readRange(*tbk, start, start+20)
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetByName("Exchange"), DeepEquals, []string{"NASDAQ", "NYSE", "NASDAQ", "ARCA", "NYSE"})
+}
@@ -0,0 +1,87 @@
+package symbology
+
+// charValue returns the value of a character of an identifier, 0 to 9 for
+// the digits and 10 to 35 for the letters, -1 for any other
+func charValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// doubleAddDouble returns the check digit of the characters by the
+// "double add double" of the CUSIP, which the FIGI shares: the values of
+// every second character are doubled and the digits of all summed.
+func doubleAddDouble(chars string) int {
+	sum := 0
+	for i := 0; i < len(chars); i++ {
+		v := charValue(chars[i])
+		if v < 0 {
+			return -1
+		}
+		if i%2 == 1 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+	return (10 - sum%10) % 10
+}
+
+// ValidCUSIP returns true if the CUSIP is 9 digits and letters with a valid
+// check digit
+func ValidCUSIP(cusip string) bool {
+	if len(cusip) != 9 {
+		return false
+	}
+	check := doubleAddDouble(cusip[:8])
+	return check >= 0 && int(cusip[8]-'0') == check
+}
+
+// ValidFIGI returns true if the FIGI is 12 digits and consonants, the third
+// a G, with a valid check digit
+func ValidFIGI(figi string) bool {
+	if len(figi) != 12 || figi[2] != 'G' {
+		return false
+	}
+	for i := 0; i < len(figi); i++ {
+		switch figi[i] {
+		case 'A', 'E', 'I', 'O', 'U':
+			return false
+		}
+	}
+	check := doubleAddDouble(figi[:11])
+	return check >= 0 && int(figi[11]-'0') == check
+}
+
+// ValidISIN returns true if the ISIN is a country code, 9 digits and
+// letters and a valid Luhn check digit
+func ValidISIN(isin string) bool {
+	if len(isin) != 12 || charValue(isin[0]) < 10 || charValue(isin[1]) < 10 {
+		return false
+	}
+	// the letters are expanded to their two digits
+	var digits []int
+	for i := 0; i < 11; i++ {
+		v := charValue(isin[i])
+		if v < 0 {
+			return false
+		}
+		if v >= 10 {
+			digits = append(digits, v/10)
+		}
+		digits = append(digits, v%10)
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		v := digits[i]
+		// doubled from the rightmost
+		if (len(digits)-1-i)%2 == 0 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+	return int(isin[11]-'0') == (10-sum%10)%10
+}
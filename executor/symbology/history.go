@@ -0,0 +1,62 @@
+package symbology
+
+import (
+	"math"
+
+	"github.com/alpacahq/marketstore/executor/corpaction"
+)
+
+// Segment is a former ticker of a symbol, and the period it traded under it
+type Segment struct {
+	Symbol string `json:"symbol" msgpack:"symbol"`
+	// Start is the epoch of the change to the ticker, 0 if unknown, and End
+	// that of the change from it, the period being from Start until End
+	Start int64 `json:"start" msgpack:"start"`
+	End   int64 `json:"end" msgpack:"end"`
+}
+
+// Changes returns the symbol changes of the corporate actions of the store
+func Changes(store *corpaction.Store) []corpaction.Action {
+	var changes []corpaction.Action
+	for _, symbol := range store.Symbols() {
+		for _, a := range store.Get(symbol) {
+			if a.Kind == corpaction.SYMBOL_CHANGE {
+				changes = append(changes, a)
+			}
+		}
+	}
+	return changes
+}
+
+// History returns the former tickers of the symbol, the most recent first,
+// by following its symbol changes backwards: the ticker it changed from,
+// the ticker that one changed from before, and so on.  A ticker reused
+// after a change is only followed back until its own change.
+func History(changes []corpaction.Action, symbol string) []Segment {
+	var history []Segment
+	current, end := symbol, int64(math.MaxInt64)
+	for len(history) < len(changes) {
+		// the latest change to the current ticker before its period ends
+		var from *corpaction.Action
+		for i := range changes {
+			a := &changes[i]
+			if a.NewSymbol == current && a.ExDate < end && (from == nil || a.ExDate > from.ExDate) {
+				from = a
+			}
+		}
+		if from == nil || from.Symbol == symbol {
+			break
+		}
+		history = append(history, Segment{Symbol: from.Symbol, End: from.ExDate})
+		current, end = from.Symbol, from.ExDate
+	}
+	for i := range history {
+		// the period of a former ticker starts at the change to it, if any
+		for _, a := range changes {
+			if a.NewSymbol == history[i].Symbol && a.ExDate < history[i].End && a.ExDate > history[i].Start {
+				history[i].Start = a.ExDate
+			}
+		}
+	}
+	return history
+}
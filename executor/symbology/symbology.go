@@ -0,0 +1,250 @@
+// Package symbology records the alternative identifiers of the symbols,
+// such as their CUSIP, ISIN and FIGI, and resolves the former tickers of a
+// symbol from its symbol changes recorded as corporate actions, for the
+// queries of a ticker to find the records stored under its former ones.
+package symbology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alpacahq/marketstore/executor"
+)
+
+// File is the file of the identifiers in the root directory, a file rather
+// than a directory which would be loaded as part of the catalog
+const File = "symbology.json"
+
+// Identifiers are the alternative identifiers of the security of a symbol
+type Identifiers struct {
+	Symbol string `json:"symbol" msgpack:"symbol"`
+	CUSIP  string `json:"cusip,omitempty" msgpack:"cusip,omitempty"`
+	ISIN   string `json:"isin,omitempty" msgpack:"isin,omitempty"`
+	FIGI   string `json:"figi,omitempty" msgpack:"figi,omitempty"`
+}
+
+// Validate returns an error if the identifiers have no symbol, or if any of
+// them is malformed or fails its check digit
+func (ids *Identifiers) Validate() error {
+	if ids.Symbol == "" {
+		return fmt.Errorf("identifiers without a symbol")
+	}
+	if ids.CUSIP != "" && !ValidCUSIP(ids.CUSIP) {
+		return fmt.Errorf("invalid CUSIP \"%s\" of %s", ids.CUSIP, ids.Symbol)
+	}
+	if ids.ISIN != "" && !ValidISIN(ids.ISIN) {
+		return fmt.Errorf("invalid ISIN \"%s\" of %s", ids.ISIN, ids.Symbol)
+	}
+	if ids.FIGI != "" && !ValidFIGI(ids.FIGI) {
+		return fmt.Errorf("invalid FIGI \"%s\" of %s", ids.FIGI, ids.Symbol)
+	}
+	return nil
+}
+
+// values returns the identifiers set, without the symbol
+func (ids Identifiers) values() []string {
+	var values []string
+	for _, id := range []string{ids.CUSIP, ids.ISIN, ids.FIGI} {
+		if id != "" {
+			values = append(values, id)
+		}
+	}
+	return values
+}
+
+// Store is the identifiers of the symbols of a root directory
+type Store struct {
+	mu   sync.RWMutex
+	path string
+	// identifiers by symbol
+	ids map[string]Identifiers
+}
+
+// Open loads the identifiers of the root directory, none if it has no file
+// of them yet
+func Open(root string) (*Store, error) {
+	s := &Store{path: filepath.Join(root, File), ids: map[string]Identifiers{}}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var all []Identifiers
+	if err = json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", s.path, err)
+	}
+	for _, ids := range all {
+		s.ids[ids.Symbol] = ids
+	}
+	return s, nil
+}
+
+var (
+	instanceMu sync.Mutex
+	instance   *Store
+	// root directory the instance store was opened for
+	instanceRoot string
+)
+
+// Instance returns the store of the root directory of the instance, opened
+// once
+func Instance() (*Store, error) {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+	if executor.ThisInstance == nil {
+		return nil, fmt.Errorf("no instance to load the identifiers of")
+	}
+	root := executor.ThisInstance.RootDir
+	if instance != nil && instanceRoot == root {
+		return instance, nil
+	}
+	s, err := Open(root)
+	if err != nil {
+		return nil, err
+	}
+	instance, instanceRoot = s, root
+	return s, nil
+}
+
+// Get returns the identifiers of the symbol, false if it has none
+func (s *Store) Get(symbol string) (Identifiers, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids, ok := s.ids[symbol]
+	return ids, ok
+}
+
+// Symbols returns the sorted symbols having identifiers
+func (s *Store) Symbols() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.symbolsLocked()
+}
+
+// Resolve returns the symbol of the CUSIP, ISIN or FIGI, case insensitive,
+// false if none has it
+func (s *Store) Resolve(id string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for symbol, ids := range s.ids {
+		for _, value := range ids.values() {
+			if strings.EqualFold(value, id) {
+				return symbol, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Set records the identifiers, replacing those of their symbols, and
+// returns how many symbols changed.  None is if any of them is invalid, or
+// has an identifier of another symbol.
+func (s *Store) Set(all ...Identifiers) (int, error) {
+	for i := range all {
+		all[i].CUSIP = strings.ToUpper(all[i].CUSIP)
+		all[i].ISIN = strings.ToUpper(all[i].ISIN)
+		all[i].FIGI = strings.ToUpper(all[i].FIGI)
+		if err := all[i].Validate(); err != nil {
+			return 0, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owners := map[string]string{}
+	for symbol, ids := range s.ids {
+		for _, value := range ids.values() {
+			owners[value] = symbol
+		}
+	}
+	for _, ids := range all {
+		// the identifiers replaced are no longer owned
+		for _, value := range s.ids[ids.Symbol].values() {
+			delete(owners, value)
+		}
+	}
+	for _, ids := range all {
+		for _, value := range ids.values() {
+			if owner, ok := owners[value]; ok && owner != ids.Symbol {
+				return 0, fmt.Errorf("%s of %s is already that of %s", value, ids.Symbol, owner)
+			}
+			owners[value] = ids.Symbol
+		}
+	}
+	changed := 0
+	for _, ids := range all {
+		if prev, ok := s.ids[ids.Symbol]; ok && prev == ids {
+			continue
+		}
+		s.ids[ids.Symbol] = ids
+		changed++
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, s.save()
+}
+
+// Remove deletes the identifiers of the symbols, and returns how many had
+// some
+func (s *Store) Remove(symbols ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for _, symbol := range symbols {
+		if _, ok := s.ids[symbol]; ok {
+			delete(s.ids, symbol)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.save()
+}
+
+// Rename moves the identifiers of a renamed symbol to its new name
+func (s *Store) Rename(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, ok := s.ids[from]
+	if !ok {
+		return nil
+	}
+	delete(s.ids, from)
+	ids.Symbol = to
+	s.ids[to] = ids
+	return s.save()
+}
+
+// save writes the identifiers to the file, replacing it at once.  The
+// caller holds mu.
+func (s *Store) save() error {
+	all := []Identifiers{}
+	for _, symbol := range s.symbolsLocked() {
+		all = append(all, s.ids[symbol])
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(s.path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *Store) symbolsLocked() []string {
+	symbols := make([]string, 0, len(s.ids))
+	for symbol := range s.ids {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
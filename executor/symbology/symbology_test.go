@@ -0,0 +1,82 @@
+package symbology
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/executor/corpaction"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SymbologyTestSuite struct{}
+
+var _ = Suite(&SymbologyTestSuite{})
+
+func (s *SymbologyTestSuite) TestCheckDigits(c *C) {
+	c.Assert(ValidCUSIP("037833100"), Equals, true)
+	c.Assert(ValidCUSIP("037833101"), Equals, false)
+	c.Assert(ValidISIN("US0378331005"), Equals, true)
+	c.Assert(ValidISIN("US0378331006"), Equals, false)
+	c.Assert(ValidISIN("0S0378331005"), Equals, false)
+	c.Assert(ValidFIGI("BBG000B9XRY4"), Equals, true)
+	c.Assert(ValidFIGI("BBG000B9XRY5"), Equals, false)
+	c.Assert(ValidFIGI("BBA000B9XRY4"), Equals, false)
+}
+
+func (s *SymbologyTestSuite) TestStore(c *C) {
+	root := c.MkDir()
+	store, err := Open(root)
+	c.Assert(err, IsNil)
+	apple := Identifiers{Symbol: "AAPL", CUSIP: "037833100", ISIN: "us0378331005", FIGI: "BBG000B9XRY4"}
+	changed, err := store.Set(apple)
+	c.Assert(err, IsNil)
+	c.Assert(changed, Equals, 1)
+	changed, _ = store.Set(apple)
+	c.Assert(changed, Equals, 0)
+
+	symbol, ok := store.Resolve("US0378331005")
+	c.Assert(ok, Equals, true)
+	c.Assert(symbol, Equals, "AAPL")
+	_, ok = store.Resolve("MSFT")
+	c.Assert(ok, Equals, false)
+
+	// an identifier is that of a single symbol
+	_, err = store.Set(Identifiers{Symbol: "APPL", CUSIP: "037833100"})
+	c.Assert(err, NotNil)
+	_, err = store.Set(Identifiers{Symbol: "MSFT", CUSIP: "594918105"})
+	c.Assert(err, NotNil)
+
+	c.Assert(store.Rename("AAPL", "APC"), IsNil)
+	store, err = Open(root)
+	c.Assert(err, IsNil)
+	c.Assert(store.Symbols(), DeepEquals, []string{"APC"})
+	ids, _ := store.Get("APC")
+	c.Assert(ids.ISIN, Equals, "US0378331005")
+
+	removed, err := store.Remove("APC", "MSFT")
+	c.Assert(err, IsNil)
+	c.Assert(removed, Equals, 1)
+}
+
+func (s *SymbologyTestSuite) TestHistory(c *C) {
+	store, err := corpaction.Open(c.MkDir())
+	c.Assert(err, IsNil)
+	_, err = store.Add(
+		corpaction.Action{Symbol: "FB", Kind: corpaction.SYMBOL_CHANGE, ExDate: 300, NewSymbol: "META"},
+		corpaction.Action{Symbol: "TFBK", Kind: corpaction.SYMBOL_CHANGE, ExDate: 100, NewSymbol: "FB"},
+		// the former ticker reused afterwards
+		corpaction.Action{Symbol: "XYZ", Kind: corpaction.SYMBOL_CHANGE, ExDate: 400, NewSymbol: "FB"},
+		corpaction.Action{Symbol: "FB", Kind: corpaction.DIVIDEND, ExDate: 200, Amount: 1},
+	)
+	c.Assert(err, IsNil)
+	changes := Changes(store)
+	c.Assert(changes, HasLen, 3)
+	c.Assert(History(changes, "META"), DeepEquals, []Segment{
+		{Symbol: "FB", Start: 100, End: 300},
+		{Symbol: "TFBK", End: 100},
+	})
+	c.Assert(History(changes, "FB"), DeepEquals, []Segment{{Symbol: "XYZ", End: 400}})
+	c.Assert(History(changes, "AAPL"), HasLen, 0)
+}
@@ -0,0 +1,67 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// locations caches the timezones recorded for the buckets by name
+var locations sync.Map
+
+// BucketTimezone returns the timezone of the bucket, by which its records are
+// split into days and aggregated into bars: the one recorded for it, else
+// that of the first bucket_timezones setting matching it, else that of the
+// instance.  The records are stored by their epoch, whatever the timezone.
+func BucketTimezone(tbk io.TimeBucketKey) *time.Location {
+	if ThisInstance != nil && ThisInstance.CatalogDir != nil {
+		if name, err := ThisInstance.CatalogDir.GetTimezone(&tbk); err == nil && name != "" {
+			if loc, err := loadLocation(name); err == nil {
+				return loc
+			}
+			log.Error("invalid timezone %s recorded for %s", name, tbk.GetItemKey())
+		}
+	}
+	if loc := utils.InstanceConfig.BucketTimezoneOf(tbk.GetItemKey()); loc != nil {
+		return loc
+	}
+	return utils.InstanceConfig.Timezone
+}
+
+// SetBucketTimezone records the timezone of the bucket, or removes the record
+// if the name is empty for the bucket to follow the configuration again
+func SetBucketTimezone(tbk io.TimeBucketKey, name string) error {
+	if name != "" {
+		if _, err := loadLocation(name); err != nil {
+			return err
+		}
+	}
+	return ThisInstance.CatalogDir.SetTimezone(&tbk, name)
+}
+
+// recordBucketTimezone records the timezone of the bucket_timezones setting
+// matching a new bucket, so that the bucket keeps it when the setting changes
+func recordBucketTimezone(tbk io.TimeBucketKey) {
+	loc := utils.InstanceConfig.BucketTimezoneOf(tbk.GetItemKey())
+	if loc == nil {
+		return
+	}
+	if err := ThisInstance.CatalogDir.SetTimezone(&tbk, loc.String()); err != nil {
+		log.Error("failed to record the timezone of %s (%v)", tbk.GetItemKey(), err)
+	}
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
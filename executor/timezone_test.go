@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type TimezoneTests struct{}
+
+var _ = Suite(&TimezoneTests{})
+
+func (s *TimezoneTests) SetUpTest(c *C) {
+	NewInstanceSetup(c.MkDir(), true, true, false, true)
+}
+
+func (s *TimezoneTests) TestBucketTimezone(c *C) {
+	defer func(config utils.MktsConfig) { utils.InstanceConfig = config }(utils.InstanceConfig)
+	var config utils.MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+bucket_timezones:
+  - pattern: "*.T/*/*"
+    timezone: Asia/Tokyo
+`)), IsNil)
+	utils.InstanceConfig.BucketTimezones = config.BucketTimezones
+
+	write := func(key string) {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{time.Date(2016, time.December, 31, 20, 0, 0, 0, time.UTC).Unix()})
+		cs.AddColumn("Price", []float32{1.})
+		// the year files are those of the system timezone, whatever the
+		// location of the records
+		cs.SetLocation(time.FixedZone("JST", 9*60*60))
+		csm := io.NewColumnSeriesMap()
+		csm.AddColumnSeries(*io.NewTimeBucketKey(key), cs)
+		c.Assert(WriteCSM(csm, false), IsNil)
+	}
+	write("7203.T/1Min/PRICE")
+	write("AAPL/1Min/PRICE")
+	tokyo := *io.NewTimeBucketKey("7203.T/1Min/PRICE")
+	aapl := *io.NewTimeBucketKey("AAPL/1Min/PRICE")
+	tbi, err := ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(&tokyo)
+	c.Assert(err, IsNil)
+	c.Assert(tbi.Year, Equals, int16(2016))
+
+	// recorded on the creation of the bucket
+	c.Assert(BucketTimezone(tokyo).String(), Equals, "Asia/Tokyo")
+	c.Assert(BucketTimezone(aapl), Equals, utils.InstanceConfig.Timezone)
+	name, _ := ThisInstance.CatalogDir.GetTimezone(&tokyo)
+	c.Assert(name, Equals, "Asia/Tokyo")
+	utils.InstanceConfig.BucketTimezones = nil
+	c.Assert(BucketTimezone(tokyo).String(), Equals, "Asia/Tokyo")
+
+	c.Assert(SetBucketTimezone(aapl, "America/New_York"), IsNil)
+	c.Assert(BucketTimezone(aapl).String(), Equals, "America/New_York")
+	c.Assert(SetBucketTimezone(aapl, "America/Nowhere"), NotNil)
+	c.Assert(SetBucketTimezone(tokyo, ""), IsNil)
+	c.Assert(BucketTimezone(tokyo), Equals, utils.InstanceConfig.Timezone)
+}
@@ -13,10 +13,14 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/alpacahq/marketstore/executor/buffile"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/memlimit"
+	"github.com/alpacahq/marketstore/utils/stats"
 )
 
 /*
@@ -34,6 +38,8 @@ type WALFileType struct {
 	FilePath          string   // WAL file full path
 	lastCommittedTGID int64    // TGID to be checkpointed
 	FilePtr           *os.File // Active file pointer to FileName
+	syncErr           error    // Error of the last sync, if it failed
+	mu                sync.Mutex
 }
 
 func NewWALFile(rootDir string, existingFilePath string) (wf *WALFileType, err error) {
@@ -245,7 +251,7 @@ func (wf *WALFileType) flushToWAL(tgc *TransactionPipe) (err error) {
 		This loop serializes write transactions from the channel for writing to disk
 	*/
 	for i := 0; i < WTCount; i++ {
-		command := <-tgc.writeChannel
+		command := tgc.dequeue()
 		TG_Serialized, _ = io.Serialize(TG_Serialized, int8(command.RecordType))
 		TG_Serialized, _ = io.Serialize(TG_Serialized, int16(len(command.WALKeyPath)))
 		TG_Serialized, _ = io.Serialize(TG_Serialized, command.WALKeyPath)
@@ -282,7 +288,7 @@ func (wf *WALFileType) flushToWAL(tgc *TransactionPipe) (err error) {
 		wf.FilePtr.Write(TG_Serialized)
 		cksum := hash.Sum(nil)
 		wf.FilePtr.Write(cksum) // Checksum
-		wf.FilePtr.Sync()       // Flush the OS buffer
+		wf.syncFile()           // Flush the OS buffer
 
 		// WAL Transaction Commit Complete Message
 		TGID := tgc.TGID()
@@ -521,6 +527,149 @@ func (wf *WALFileType) Replay(writeData bool) error {
 	log.Info("Finished replay of TGData")
 	return nil
 }
+
+// WALTransaction is a transaction group of a WAL file, as decoded by
+// Transactions
+type WALTransaction struct {
+	TGID int64
+	// Status is the last status of the transaction written to the WAL
+	Status TxnStatusEnum
+	// Checkpointed is set once the transaction is durably written to the
+	// primary store, so that it is not replayed
+	Checkpointed bool
+	Writes       []WALWrite
+	serialized   []byte
+}
+
+// WALWrite is the write of a transaction group to an interval of a year file
+type WALWrite struct {
+	WALKeyPath string
+	RecordType io.EnumRecordType
+	Index      int64
+	Records    int
+}
+
+// Transactions decodes the transaction groups of the WAL file in TGID order,
+// those with TG data alone, without replaying them.  The decoding stops at a
+// partially written message, as left by a crash.
+func (wf *WALFileType) Transactions() (txns []*WALTransaction, err error) {
+	defer wf.FilePtr.Seek(0, goio.SeekEnd)
+	wf.FilePtr.Seek(0, goio.SeekStart)
+
+	byTGID := map[int64]*WALTransaction{}
+	status := map[int64]TxnStatusEnum{}
+	for {
+		MID, err := wf.readMessageID()
+		if _, ok := err.(ShortReadError); ok {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch MID {
+		case TGDATA:
+			TGID, TG_Serialized, err := wf.readTGData()
+			if _, ok := err.(ShortReadError); ok {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if _, ok := byTGID[TGID]; ok {
+				return nil, fmt.Errorf("duplicate TG data for TGID %d", TGID)
+			}
+			txn := &WALTransaction{TGID: TGID, serialized: TG_Serialized}
+			if txn.Writes, err = decodeWrites(TG_Serialized); err != nil {
+				return nil, fmt.Errorf("TGID %d: %v", TGID, err)
+			}
+			byTGID[TGID] = txn
+			txns = append(txns, txn)
+			continue
+		case TXNINFO:
+			TGID, destination, txnStatus, err := wf.readTransactionInfo()
+			if _, ok := err.(ShortReadError); ok {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if destination == WAL {
+				status[TGID] = txnStatus
+			} else if _, ok := byTGID[TGID]; ok && txnStatus == COMMITCOMPLETE {
+				// As in Replay, the checkpoint covers the transactions before it
+				for tgid, txn := range byTGID {
+					if tgid <= TGID {
+						txn.Checkpointed = true
+					}
+				}
+			}
+			continue
+		case STATUS:
+			if _, _, _, err = wf.ReadStatus(); err == nil {
+				continue
+			}
+		}
+		// A partially written message ends the WAL
+		break
+	}
+
+	for _, txn := range txns {
+		txn.Status = status[txn.TGID]
+	}
+	sort.Slice(txns, func(i, j int) bool { return txns[i].TGID < txns[j].TGID })
+	return txns, nil
+}
+
+// decodeWrites returns the writes of the serialized TG data
+func decodeWrites(TG_Serialized []byte) (writes []WALWrite, err error) {
+	if len(TG_Serialized) < 16 {
+		return nil, fmt.Errorf("short TG data")
+	}
+	WTCount := io.ToInt64(TG_Serialized[8:16])
+	cursor := 16
+	for i := 0; i < int(WTCount); i++ {
+		if cursor+3 > len(TG_Serialized) {
+			return nil, fmt.Errorf("short write %d", i)
+		}
+		recordType := io.EnumRecordType(io.ToInt8(TG_Serialized[cursor:]))
+		FPLen := int(io.ToInt16(TG_Serialized[cursor+1:]))
+		cursor += 3
+		if cursor+FPLen+8+16 > len(TG_Serialized) {
+			return nil, fmt.Errorf("short write %d", i)
+		}
+		write := WALWrite{
+			WALKeyPath: string(TG_Serialized[cursor : cursor+FPLen]),
+			RecordType: recordType,
+		}
+		cursor += FPLen
+		dataLen := int(io.ToInt32(TG_Serialized[cursor:]))
+		varRecLen := int(io.ToInt32(TG_Serialized[cursor+4:]))
+		cursor += 8
+		write.Index = io.ToInt64(TG_Serialized[cursor+8:])
+		write.Records = 1
+		if recordType == io.VARIABLE && varRecLen > 0 {
+			write.Records = dataLen / varRecLen
+		}
+		writes = append(writes, write)
+		cursor += 8 + 8 + dataLen
+	}
+	if cursor > len(TG_Serialized) {
+		return nil, fmt.Errorf("short TG data")
+	}
+	return writes, nil
+}
+
+// ReplayTransactions writes the transactions to the primary store, whatever
+// their status, and marks the WAL file replayed so that the others are not.
+func (wf *WALFileType) ReplayTransactions(txns []*WALTransaction) error {
+	wf.WriteStatus(OPEN, REPLAYINPROCESS)
+	for _, txn := range txns {
+		log.Info("Replaying TGID: %d, data length is: %d bytes", txn.TGID, len(txn.serialized))
+		if err := wf.replayTGData(txn.serialized); err != nil {
+			return err
+		}
+	}
+	wf.WriteStatus(OPEN, REPLAYED)
+	return nil
+}
+
 func (wf *WALFileType) WriteStatus(FileStatus FileStatusEnum, ReplayState ReplayStateEnum) {
 	wf.FileStatus = FileStatus
 	wf.ReplayState = ReplayState
@@ -532,12 +681,42 @@ func (wf *WALFileType) WriteStatus(FileStatus FileStatusEnum, ReplayState Replay
 	buffer, _ = io.Serialize(buffer, int64(wf.OwningInstanceID))
 	wf.FilePtr.Seek(0, os.SEEK_SET)
 	wf.FilePtr.Write(buffer)
-	wf.FilePtr.Sync()
+	wf.syncFile()
 	wf.FilePtr.Seek(0, os.SEEK_END)
 }
 func (wf *WALFileType) write(buffer []byte) {
 	wf.FilePtr.Write(buffer)
-	wf.FilePtr.Sync()
+	wf.syncFile()
+}
+
+// syncFile flushes the WAL file to disk and records how long it took
+func (wf *WALFileType) syncFile() {
+	start := time.Now()
+	err := wf.FilePtr.Sync()
+	stats.WALSyncDuration.Observe(time.Since(start).Seconds())
+	wf.mu.Lock()
+	wf.syncErr = err
+	wf.mu.Unlock()
+	if err != nil {
+		log.Error("failed to sync WAL file %s: %v", wf.FilePath, err)
+	}
+}
+
+// Healthy returns an error if the WAL file is not open or can
+// no longer be written to disk
+func (wf *WALFileType) Healthy() error {
+	if wf.FilePtr == nil {
+		return fmt.Errorf("WAL file is not open")
+	}
+	if _, err := os.Stat(wf.FilePath); err != nil {
+		return fmt.Errorf("WAL file is missing: %v", err)
+	}
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	if wf.syncErr != nil {
+		return fmt.Errorf("WAL file sync failed: %v", wf.syncErr)
+	}
+	return nil
 }
 func (wf *WALFileType) WriteTransactionInfo(tid int64, did DestEnum, txnStatus TxnStatusEnum) {
 	buffer := wf.initMessage(TXNINFO)
@@ -799,54 +978,64 @@ func StartupCacheAndWAL(rootDir string) (tgc *TransactionPipe, wf *WALFileType,
 	return NewTransactionPipe(), wf, nil
 }
 
-var haveWALWriter = false
+// walWriter is set while the WAL writer goroutine runs
+var walWriter uint32
+
+func haveWALWriter() bool {
+	return atomic.LoadUint32(&walWriter) == 1
+}
 
 func (wf *WALFileType) SyncWAL(WALRefresh, PrimaryRefresh time.Duration, walRotateInterval int) {
 	/*
 	   Example: syncWAL(500 * time.Millisecond, 15 * time.Minute)
 	*/
-	haveWALWriter = true
+	atomic.StoreUint32(&walWriter, 1)
 	tickerWAL := time.NewTicker(WALRefresh)
 	tickerPrimary := time.NewTicker(PrimaryRefresh)
 	tickerCheck := time.NewTicker(WALRefresh / 100)
 	primaryFlushCounter := 0
 
 	chanCap := cap(ThisInstance.TXNPipe.writeChannel)
+	// the coalesced writes are flushed early past their share of the memory limit
+	writeBufferSize := memlimit.Share(writeBufferShare)
 	for {
-		if !ThisInstance.ShutdownPending {
-			select {
-			case <-tickerWAL.C:
-				if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
-					log.Fatal(err.Error())
-				}
-			case f := <-ThisInstance.TXNPipe.flushChannel:
+		select {
+		case <-tickerWAL.C:
+			if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
+				log.Fatal(err.Error())
+			}
+		case f := <-ThisInstance.TXNPipe.flushChannel:
+			if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
+				log.Fatal(err.Error())
+			}
+			f <- struct{}{}
+		case snapshot := <-ThisInstance.TXNPipe.snapshotChannel:
+			if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
+				log.Fatal(err.Error())
+			}
+			wf.createCheckpoint()
+			snapshot()
+		case <-tickerCheck.C:
+			queued := len(ThisInstance.TXNPipe.writeChannel)
+			pending := ThisInstance.TXNPipe.PendingBytes()
+			if float64(queued)/float64(chanCap) >= 0.8 ||
+				(writeBufferSize > 0 && pending >= writeBufferSize) {
 				if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
 					log.Fatal(err.Error())
 				}
-				f <- struct{}{}
-			case <-tickerCheck.C:
-				queued := len(ThisInstance.TXNPipe.writeChannel)
-				if float64(queued)/float64(chanCap) >= 0.8 {
-					if err := wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
-						log.Fatal(err.Error())
-					}
-				}
-			case <-tickerPrimary.C:
-				wf.createCheckpoint()
-				primaryFlushCounter++
-				if primaryFlushCounter%walRotateInterval == 0 {
-					log.Info("Truncating WAL file...")
-					wf.FilePtr.Truncate(0)
-					wf.WriteStatus(OPEN, NOTREPLAYED)
-					primaryFlushCounter = 0
-				}
 			}
-		} else {
-			haveWALWriter = false
-			log.Info("Flushing to WAL...")
-			wf.flushToWAL(ThisInstance.TXNPipe)
-			log.Info("Flushing to disk...")
+		case <-tickerPrimary.C:
 			wf.createCheckpoint()
+			primaryFlushCounter++
+			if primaryFlushCounter%walRotateInterval == 0 {
+				log.Info("Truncating WAL file...")
+				wf.FilePtr.Truncate(0)
+				wf.WriteStatus(OPEN, NOTREPLAYED)
+				primaryFlushCounter = 0
+			}
+		case <-ThisInstance.TXNPipe.shutdownChannel:
+			atomic.StoreUint32(&walWriter, 0)
+			wf.shutdown()
 			ThisInstance.WALWg.Done()
 			return
 		}
@@ -859,7 +1048,7 @@ func (wf *WALFileType) SyncWAL(WALRefresh, PrimaryRefresh time.Duration, walRota
 // returns if there is already one queued which will handle the data
 // present in the write channel, as it will flush as soon as possible.
 func (wf *WALFileType) RequestFlush() {
-	if !haveWALWriter {
+	if !haveWALWriter() {
 		wf.flushToWAL(ThisInstance.TXNPipe)
 		return
 	}
@@ -871,3 +1060,23 @@ func (wf *WALFileType) RequestFlush() {
 	ThisInstance.TXNPipe.flushChannel <- f
 	<-f
 }
+
+// Snapshot calls fn with the writes so far flushed to the primary files and
+// synced, the writes which follow being held until it returns, so that the
+// primary files can be read as of a single point in time.
+func (wf *WALFileType) Snapshot(fn func() error) (err error) {
+	if !haveWALWriter() {
+		if err = wf.flushToWAL(ThisInstance.TXNPipe); err != nil {
+			return err
+		}
+		wf.createCheckpoint()
+		return fn()
+	}
+	done := make(chan struct{})
+	ThisInstance.TXNPipe.snapshotChannel <- func() {
+		err = fn()
+		close(done)
+	}
+	<-done
+	return err
+}
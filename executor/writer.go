@@ -13,6 +13,7 @@ import (
 	"github.com/alpacahq/marketstore/utils/io"
 	. "github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
 	"github.com/klauspost/compress/snappy"
 )
 
@@ -134,7 +135,7 @@ func (w *Writer) WriteRecords(ts []time.Time, data []byte) {
 			/*
 				This row is at a new index, output previous output buffer
 			*/
-			w.tgc.writeChannel <- cc
+			w.tgc.queue(cc)
 			// Setup next command
 			prevIndex = index
 			outBuf = formatRecord([]byte{}, record, t, index, w.tbi.GetIntervals())
@@ -150,7 +151,7 @@ func (w *Writer) WriteRecords(ts []time.Time, data []byte) {
 			/*
 				The last iteration must output it's command buffer
 			*/
-			w.tgc.writeChannel <- cc
+			w.tgc.queue(cc)
 		}
 		// if cc != nil {
 		// 	log.Info(cc.toString())
@@ -262,13 +263,57 @@ func WriteBufferToFileIndirect(fp *os.File, buffer offsetIndexBuffer, varRecLen
 	return err
 }
 
+// CheckOwnership returns an error if another shard owns the symbol of the
+// bucket, for the symbols to be written by their shard alone
+func CheckOwnership(tbk io.TimeBucketKey) error {
+	symbol := tbk.GetItemInCategory("Symbol")
+	if utils.InstanceConfig.OwnsSymbol(symbol) {
+		return nil
+	}
+	return SymbolNotOwnedError(fmt.Sprintf("%s owned by shard %s",
+		symbol, utils.InstanceConfig.ShardOf(symbol).Name))
+}
+
 // WriteCSM writs ColumnSeriesMap csm to each destination file, and flush it to the disk,
 // isVariableLength is set to true if the record content is variable-length type. WriteCSM
 // also verifies the DataShapeVector of the incoming ColumnSeriesMap matches the on-disk
 // DataShapeVector defined by the file header. WriteCSM will create any files if they do
 // not already exist for the given ColumnSeriesMap based on its TimeBucketKey.
-func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
+// The symbols owned by another shard are not written, none of csm then, nor
+// are the buckets of a namespace beyond its quota.
+func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) error {
+	writesLock.RLock()
+	if writesClosed() {
+		writesLock.RUnlock()
+		return ShuttingDownError("WriteCSM")
+	}
+	err := queueCSM(csm, isVariableLength)
+	writesLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	ThisInstance.WALFile.RequestFlush()
+	return nil
+}
+
+// queueCSM queues the writes of csm for the next flush
+func queueCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
+	if err = checkReadOnly("WriteCSM"); err != nil {
+		return err
+	}
 	cDir := ThisInstance.CatalogDir
+	for tbk := range csm {
+		if err = CheckOwnership(tbk); err != nil {
+			return err
+		}
+		if err = CheckQuota(tbk); err != nil {
+			return err
+		}
+	}
+	if isVariableLength && (len(utils.InstanceConfig.Deduplicate) > 0 || anyKeyedBySequence(csm)) {
+		dedupLock.Lock()
+		defer dedupLock.Unlock()
+	}
 	for tbk, cs := range csm {
 		tf, err := tbk.GetTimeFrame()
 		if err != nil {
@@ -278,14 +323,33 @@ func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
 		/*
 			Prepare data for writing
 		*/
+		nanosecondBucket := NanosecondIndexed(tbk)
+		if nanosecondBucket {
+			if err = encodeEpochNanos(cs); err != nil {
+				return err
+			}
+		}
+		if isVariableLength && (deduplicated(tbk) || keyedBySequence(tbk, cs)) {
+			if cs, err = deduplicate(tbk, cs); err != nil {
+				return err
+			}
+			if cs.Len() == 0 {
+				continue
+			}
+		}
 		var alignData bool
 		times := cs.GetTime()
-		if isVariableLength {
+		if cs.GetLocation() != utils.InstanceConfig.Timezone {
+			// the records are stored in the year files of the system timezone
+			for i := range times {
+				times[i] = io.ToSystemTimezone(times[i])
+			}
+		}
+		if isVariableLength || nanosecondBucket {
 			cs.Remove("Nanoseconds")
 			alignData = false
 		}
-		rs := cs.ToRowSeries(tbk, alignData)
-		rowdata := rs.GetData()
+		addNullsColumn(cs)
 
 		tbi, err := cDir.GetLatestTimeBucketInfoFromKey(&tbk)
 		if err != nil {
@@ -299,10 +363,10 @@ func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
 				recordType = io.FIXED
 			}
 
-			if len(cs.GetTime()) == 0 {
+			if len(times) == 0 {
 				continue
 			}
-			year := int16(cs.GetTime()[0].Year())
+			year := int16(times[0].Year())
 			tbi = io.NewTimeBucketInfo(
 				*tf,
 				tbk.GetPathToYearFiles(cDir.GetPath()),
@@ -317,11 +381,22 @@ func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
 				if !strings.Contains(err.Error(), "Can not overwrite file") && !strings.Contains(err.Error(), "file exists") {
 					return err
 				}
+			} else {
+				recordBucketTimezone(tbk)
+				if err := recordScales(tbk, cs); err != nil {
+					return err
+				}
 			}
 		}
+		if err = encodeNulls(tbk, tbi, cs); err != nil {
+			return err
+		}
+		if err = encodeDecimals(tbk, tbi, cs); err != nil {
+			return err
+		}
 		// Check if the previously-written data schema matches the input
 		columnMismatchError := "unable to match data columns (%v) to bucket columns (%v)"
-		dbDSV := tbi.GetDataShapesWithEpoch()
+		dbDSV := io.ColumnShapes(tbi.GetDataShapesWithEpoch())
 		csDSV := cs.GetDataShapes()
 		if len(dbDSV) != len(csDSV) {
 			return fmt.Errorf(columnMismatchError, csDSV, dbDSV)
@@ -330,6 +405,10 @@ func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
 		if missing != nil || coercion != nil {
 			return fmt.Errorf(columnMismatchError, csDSV, dbDSV)
 		}
+		rowdata, err := serializeRows(tbk, tbi, cs, alignData)
+		if err != nil {
+			return err
+		}
 
 		/*
 			Create a writer for this TimeBucket
@@ -340,8 +419,9 @@ func WriteCSM(csm io.ColumnSeriesMap, isVariableLength bool) (err error) {
 		}
 
 		w.WriteRecords(times, rowdata)
+		stats.WrittenRows.Add(float64(len(times)))
+		stats.Writes.Inc(tbk.GetItemInCategory("Timeframe"))
+		recordWrite(tbk, time.Now())
 	}
-	wal := ThisInstance.WALFile
-	wal.RequestFlush()
 	return nil
 }
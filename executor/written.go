@@ -1,11 +1,14 @@
 package executor
 
 import (
+	"fmt"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
 
 	"github.com/alpacahq/marketstore/plugins/trigger"
 )
@@ -16,11 +19,17 @@ var (
 	done      chan struct{}
 	m         map[string][]trigger.Record
 	triggerWg sync.WaitGroup
+	// the number of writes dispatched to the triggers
+	dispatched uint64
+	// matchersMu guards the trigger matchers of the instance, replaced
+	// while the writes are dispatched when the triggers are reloaded
+	matchersMu sync.RWMutex
 )
 
 type writtenRecords struct {
 	key     string
 	records []trigger.Record
+	at      time.Time
 }
 
 func setup() {
@@ -42,32 +51,120 @@ func appendRecord(keyPath string, record []byte) {
 // if the file path matches the condition.  This is meant to be
 // run in a separate goroutine and recovers from panics in the triggers.
 func dispatchRecords() {
+	now := time.Now()
 	for key, records := range m {
-		c <- writtenRecords{key: key, records: records}
+		// done once run has taken the records and started their triggers
+		triggerWg.Add(1)
+		atomic.AddUint64(&dispatched, 1)
+		c <- writtenRecords{key: key, records: records, at: now}
 	}
 	m = nil // for GC
 }
 
+// SetTriggerMatchers replaces the trigger matchers of the instance, the
+// writes dispatched before being fired with the previous ones.
+func SetTriggerMatchers(tmatchers []*trigger.TriggerMatcher) {
+	matchersMu.Lock()
+	defer matchersMu.Unlock()
+	ThisInstance.TriggerMatchers = tmatchers
+}
+
+func triggerMatchers() []*trigger.TriggerMatcher {
+	matchersMu.RLock()
+	defer matchersMu.RUnlock()
+	return ThisInstance.TriggerMatchers
+}
+
 func run() {
 	defer func() { done <- struct{}{} }()
 	for wr := range c {
-		for _, tmatcher := range ThisInstance.TriggerMatchers {
+		tmatchers := triggerMatchers()
+		// the fired triggers close their channel when done, for those after
+		// them to be fired
+		fired := map[*trigger.TriggerMatcher]chan struct{}{}
+		for _, tmatcher := range tmatchers {
 			if tmatcher.Match(wr.key) {
-				triggerWg.Add(1)
-				go fire(tmatcher.Trigger, wr.key, wr.records)
+				fired[tmatcher] = make(chan struct{})
 			}
 		}
+		for _, tmatcher := range tmatchers {
+			done, ok := fired[tmatcher]
+			if !ok {
+				continue
+			}
+			var after []chan struct{}
+			for _, before := range tmatcher.After {
+				if ch, ok := fired[before]; ok {
+					after = append(after, ch)
+				}
+			}
+			triggerWg.Add(1)
+			stats.TriggerBacklog.Inc(tmatcher.PluginName())
+			go fire(tmatcher, wr, after, done)
+		}
+		triggerWg.Done()
 	}
 }
 
-func fire(trig trigger.Trigger, key string, records []trigger.Record) {
+// fire executes the trigger once those before it are done, retrying the
+// failed executions and dead-lettering the writes of those failing for good
+func fire(tmatcher *trigger.TriggerMatcher, wr writtenRecords, after []chan struct{}, done chan struct{}) {
+	key, records := wr.key, wr.records
+	plugin := tmatcher.PluginName()
 	defer func() {
+		stats.TriggerBacklog.Dec(plugin)
+		close(done)
 		triggerWg.Done()
+	}()
+	for _, ch := range after {
+		<-ch
+	}
+	stats.TriggerLag.Observe(time.Since(wr.at).Seconds(), plugin)
+	if !tmatcher.Breaker.Allow(time.Now()) {
+		deadLetter(plugin, key, records, 0, errCircuitOpen)
+		return
+	}
+
+	var err error
+	delay := tmatcher.RetryDelay
+	attempts := 0
+	for {
+		attempts++
+		if err = execute(tmatcher.Trigger, plugin, key, records); err == nil || attempts > tmatcher.Retries {
+			break
+		}
+		log.Warn("trigger %s failed on %s (%v), retrying in %v", plugin, key, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if tmatcher.Breaker.Report(err, time.Now()) {
+		log.Error("trigger %s failed %d times in a row, not firing it for %v",
+			plugin, tmatcher.Breaker.Threshold, tmatcher.Breaker.Cooldown)
+	}
+	if err != nil {
+		stats.TriggerFailures.Inc(plugin)
+		deadLetter(plugin, key, records, attempts, err)
+	}
+}
+
+// execute fires the trigger, recovering from its panics
+func execute(trig trigger.Trigger, plugin, key string, records []trigger.Record) (err error) {
+	defer func() {
 		if r := recover(); r != nil {
+			stats.TriggerPanics.Inc(plugin)
 			log.Error("recovering from %v\n%s", r, string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
+	stats.TriggerFires.Inc(plugin)
+	stats.TriggerRows.Add(float64(len(records)), plugin)
+	start := time.Now()
+	defer func() { stats.TriggerDuration.Observe(time.Since(start).Seconds(), plugin) }()
+	if checked, ok := trig.(trigger.CheckedTrigger); ok {
+		return checked.TryFire(key, records)
+	}
 	trig.Fire(key, records)
+	return nil
 }
 
 // FinishAndWait closes the writtenIndexes channel, and waits
@@ -1,10 +1,19 @@
 package executor
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/alpacahq/marketstore/plugins/trigger"
 	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/stats"
 )
 
 type WrittenIndexesTests struct{}
@@ -41,6 +50,124 @@ func (s *WrittenIndexesTests) SetTrigger(t trigger.Trigger, on string) {
 	ThisInstance.TriggerMatchers = matchers
 }
 
+// orderTrigger records the order in which the triggers are fired
+type orderTrigger struct {
+	name  string
+	order chan string
+	delay time.Duration
+}
+
+func (t *orderTrigger) Fire(keyPath string, records []trigger.Record) {
+	time.Sleep(t.delay)
+	t.order <- t.name
+}
+
+func (s *WrittenIndexesTests) TestTriggerOrder(c *C) {
+	order := make(chan string, 3)
+	// slower triggers fire before the others
+	dedup := trigger.NewMatcher(&orderTrigger{name: "dedup", order: order, delay: 50 * time.Millisecond}, "AAPL/1Min/OHLCV")
+	agg := trigger.NewMatcher(&orderTrigger{name: "agg", order: order, delay: 20 * time.Millisecond}, "AAPL/1Min/OHLCV")
+	indicator := trigger.NewMatcher(&orderTrigger{name: "indicator", order: order}, "AAPL/1Min/OHLCV")
+	agg.After = []*trigger.TriggerMatcher{dedup}
+	indicator.After = []*trigger.TriggerMatcher{agg, dedup}
+	// not matched, so not waited for
+	other := trigger.NewMatcher(&orderTrigger{name: "other", order: order}, "TSLA/1Min/OHLCV")
+	dedup.After = []*trigger.TriggerMatcher{other}
+	ThisInstance.TriggerMatchers = []*trigger.TriggerMatcher{indicator, agg, dedup, other}
+
+	buffer := io.SwapSliceData([]int64{0, 5}, byte(0)).([]byte)
+	appendRecord("AAPL/1Min/OHLCV/2017.bin", offsetIndexBuffer(buffer).IndexAndPayload())
+	dispatchRecords()
+
+	c.Assert([]string{<-order, <-order, <-order}, DeepEquals, []string{"dedup", "agg", "indicator"})
+	triggerWg.Wait()
+}
+
+// failingTrigger fails its first executions
+type failingTrigger struct {
+	failures int
+	fired    chan error
+}
+
+func (t *failingTrigger) Fire(keyPath string, records []trigger.Record) {}
+
+func (t *failingTrigger) TryFire(keyPath string, records []trigger.Record) (err error) {
+	if t.failures > 0 {
+		t.failures--
+		err = errors.New("write failed")
+	}
+	t.fired <- err
+	return err
+}
+
+func (s *WrittenIndexesTests) TestTriggerRetry(c *C) {
+	rootDir := ThisInstance.RootDir
+	defer func() { ThisInstance.RootDir = rootDir }()
+	ThisInstance.RootDir = c.MkDir()
+
+	buffer := io.SwapSliceData([]int64{0, 5}, byte(0)).([]byte)
+	write := func() {
+		appendRecord("AAPL/1Min/OHLCV/2017.bin", offsetIndexBuffer(buffer).IndexAndPayload())
+		dispatchRecords()
+	}
+
+	// succeeds on the second retry
+	t := &failingTrigger{failures: 2, fired: make(chan error, 10)}
+	tmatcher := trigger.NewMatcher(t, "AAPL/1Min/OHLCV")
+	tmatcher.Name = "failing"
+	tmatcher.Retries = 2
+	tmatcher.RetryDelay = time.Millisecond
+	tmatcher.Breaker = trigger.NewBreaker(2, time.Hour)
+	ThisInstance.TriggerMatchers = []*trigger.TriggerMatcher{tmatcher}
+	write()
+	c.Assert(<-t.fired, NotNil)
+	c.Assert(<-t.fired, NotNil)
+	c.Assert(<-t.fired, IsNil)
+	triggerWg.Wait()
+
+	// fails for good twice, opening the circuit
+	t.failures = 6
+	for i := 0; i < 2; i++ {
+		write()
+		for j := 0; j < 3; j++ {
+			c.Assert(<-t.fired, NotNil)
+		}
+		triggerWg.Wait()
+	}
+	c.Assert(tmatcher.Breaker.Allow(time.Now()), Equals, false)
+
+	// not fired, but dead-lettered
+	write()
+	var lines []string
+	for deadline := time.Now().Add(5 * time.Second); len(lines) < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		data, _ := ioutil.ReadFile(filepath.Join(ThisInstance.RootDir, DeadLetterFile))
+		lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	triggerWg.Wait()
+	c.Assert(lines, HasLen, 3)
+	c.Assert(len(t.fired), Equals, 0)
+
+	var letter DeadLetter
+	c.Assert(json.Unmarshal([]byte(lines[0]), &letter), IsNil)
+	c.Assert(letter.KeyPath, Equals, "AAPL/1Min/OHLCV/2017.bin")
+	c.Assert(letter.Attempts, Equals, 3)
+	c.Assert(letter.Error, Equals, "write failed")
+	c.Assert(letter.Records, HasLen, 1)
+	c.Assert(json.Unmarshal([]byte(lines[2]), &letter), IsNil)
+	c.Assert(letter.Attempts, Equals, 0)
+	c.Assert(letter.Error, Equals, "circuit open")
+
+	var buf bytes.Buffer
+	c.Assert(stats.WriteMetrics(&buf), IsNil)
+	metrics := buf.String()
+	c.Assert(strings.Contains(metrics, `marketstore_trigger_fires_total{plugin="failing"} 9`), Equals, true)
+	c.Assert(strings.Contains(metrics, `marketstore_trigger_rows_total{plugin="failing"} 9`), Equals, true)
+	c.Assert(strings.Contains(metrics, `marketstore_trigger_duration_seconds_count{plugin="failing"} 9`), Equals, true)
+	c.Assert(strings.Contains(metrics, `marketstore_trigger_lag_seconds_count{plugin="failing"} 4`), Equals, true)
+	c.Assert(strings.Contains(metrics, `marketstore_trigger_backlog{plugin="failing"} 0`), Equals, true)
+}
+
 func (s *WrittenIndexesTests) TestWrittenIndexes(c *C) {
 	t := &FakeTrigger{fireC: make(chan struct{})}
 	s.SetTrigger(t, "AAPL/1Min/OHLCV")
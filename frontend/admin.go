@@ -0,0 +1,536 @@
+package frontend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/gobwas/glob"
+)
+
+type DestroyPatternArgs struct {
+	// Glob pattern of the bucket keys, such as "*/1Min/OHLCV"
+	Pattern string `msgpack:"pattern"`
+	// Only return the buckets which would be destroyed
+	DryRun bool `msgpack:"dry_run,omitempty"`
+}
+
+type RenameSymbolArgs struct {
+	From string `msgpack:"from"`
+	To   string `msgpack:"to"`
+	// Leave the old symbol behind as an alias of the new one, so that the
+	// queries of the old symbol keep reading its buckets
+	Alias bool `msgpack:"alias,omitempty"`
+}
+
+type TrimArgs struct {
+	// Glob pattern of the bucket keys, such as "AAPL/*/*"
+	Pattern string `msgpack:"pattern"`
+	// Epoch before which the records are deleted
+	Before int64 `msgpack:"before"`
+	// Only return the buckets which would be trimmed
+	DryRun bool `msgpack:"dry_run,omitempty"`
+}
+
+type SetTimezoneArgs struct {
+	// Glob pattern of the bucket keys, such as "*.T/*/*"
+	Pattern string `msgpack:"pattern"`
+	// Timezone by name of the TZ database, such as "Asia/Tokyo", or empty
+	// for the buckets to follow the bucket_timezones setting again
+	Timezone string `msgpack:"timezone"`
+	// Only return the buckets whose timezone would be set
+	DryRun bool `msgpack:"dry_run,omitempty"`
+}
+
+type SetMetadataArgs struct {
+	// Glob pattern of the bucket keys, such as "AAPL/*/*"
+	Pattern string `msgpack:"pattern"`
+	// User metadata to set, such as "description" or "source", the
+	// entries with an empty value being removed
+	Metadata map[string]string `msgpack:"metadata"`
+	// Replace all the metadata of the buckets with Metadata instead
+	Replace bool `msgpack:"replace,omitempty"`
+	// Only return the buckets whose metadata would be set
+	DryRun bool `msgpack:"dry_run,omitempty"`
+}
+
+type RenameColumnArgs struct {
+	// Glob pattern of the bucket keys, such as "*/1Min/OHLCV"
+	Pattern string `msgpack:"pattern"`
+	From    string `msgpack:"from"`
+	To      string `msgpack:"to"`
+	// Only return the buckets whose column would be renamed
+	DryRun bool `msgpack:"dry_run,omitempty"`
+}
+
+type ReloadPluginsArgs struct{}
+
+type ReloadConfigArgs struct{}
+
+type BackupArgs struct {
+	// Directory of the server host the backup is written to, which must
+	// not exist or be empty
+	Dest string `msgpack:"dest"`
+}
+
+type DumpArgs struct {
+	// Runtime profile, goroutine by default, or heap, allocs,
+	// threadcreate, block or mutex
+	Profile string `msgpack:"profile,omitempty"`
+	// 0 for the compressed protobuf read by go tool pprof, 1 for the
+	// legacy text format, 2 for the goroutine stacks as in a panic
+	Debug int `msgpack:"debug,omitempty"`
+	// Run a garbage collection before a heap profile, for it to be up to date
+	GC bool `msgpack:"gc,omitempty"`
+}
+
+type DumpResponse struct {
+	Profile string `msgpack:"profile"`
+	Data    []byte `msgpack:"data"`
+}
+
+type BackupResponse struct {
+	// Time of the backup, in unix epoch seconds
+	Created int64 `msgpack:"created"`
+	Files   int   `msgpack:"files"`
+	Bytes   int64 `msgpack:"bytes"`
+}
+
+type AdminResult struct {
+	Key string `msgpack:"key"`
+	// The key of the bucket after a rename
+	NewKey string `msgpack:"new_key,omitempty"`
+	// The disk space in bytes freed by the year files removed by a trim,
+	// or which would be by a dry run
+	Freed int64  `msgpack:"freed,omitempty"`
+	Error string `msgpack:"error,omitempty"`
+}
+
+type AdminResponse struct {
+	// One result per bucket, sorted by key
+	Results []AdminResult
+	Failed  int
+}
+
+// ReloadPluginsResponse has the names of the triggers and bgworkers by
+// what their reload did to them
+type ReloadPluginsResponse struct {
+	// Added to the configuration, or whose setting changed
+	Started []string
+	// Removed from the configuration, or whose setting changed
+	Stopped []string
+	// Whose setting is unchanged
+	Kept []string
+	// Bgworkers removed from the configuration or whose setting changed,
+	// which cannot be stopped and run on until the server is restarted
+	Pending []string
+}
+
+// ReloadConfigResponse has the reloadable settings which changed, such as
+// "log_level: debug", along with the reload of the plugins
+type ReloadConfigResponse struct {
+	Changed []string
+	Plugins ReloadPluginsResponse
+}
+
+var (
+	// PluginReloader reloads the triggers and bgworkers of the configuration
+	// file of the server, set by the start command
+	PluginReloader func() (*ReloadPluginsResponse, error)
+	// ConfigReloader reloads the reloadable settings of the configuration
+	// file of the server, set by the start command
+	ConfigReloader func() (*ReloadConfigResponse, error)
+)
+
+// DestroyPattern destroys every bucket whose key matches the pattern
+func (s *DataService) DestroyPattern(r *http.Request, args *DestroyPatternArgs, response *AdminResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	keys, _, err := matchingBuckets(args.Pattern)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = auth.AuthorizeBucket(r, auth.ADMIN, key); err == nil && !args.DryRun {
+			err = executor.ThisInstance.CatalogDir.RemoveTimeBucket(io.NewTimeBucketKey(key))
+			if err != nil {
+				err = fmt.Errorf("removal of catalog entry failed: %s", err.Error())
+			}
+		}
+		if !args.DryRun {
+			audit.Record(r, audit.DESTROY, key, 0, err)
+		}
+		response.appendResult(AdminResult{Key: key}, err)
+	}
+	return nil
+}
+
+// RenameSymbol renames a symbol along with all of its buckets, which are
+// either found under the old or the new symbol, never some of each.  The
+// queries of the aliases of the symbol follow it to its new name.
+func (s *DataService) RenameSymbol(r *http.Request, args *RenameSymbolArgs, response *AdminResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	for _, symbol := range []string{args.From, args.To} {
+		if symbol == "" || symbol == "." || symbol == ".." || strings.ContainsAny(symbol, "/:*") {
+			return fmt.Errorf("symbol \"%s\" is not a valid symbol name", symbol)
+		}
+	}
+	keys, _, err := matchingBuckets(glob.QuoteMeta(args.From) + "/*/*")
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("symbol \"%s\" not found", args.From)
+	}
+	results := make([]AdminResult, len(keys))
+	for i, key := range keys {
+		results[i] = AdminResult{Key: key, NewKey: args.To + strings.TrimPrefix(key, args.From)}
+		for _, k := range []string{results[i].Key, results[i].NewKey} {
+			if err = auth.AuthorizeBucket(r, auth.ADMIN, k); err != nil {
+				audit.Record(r, audit.RENAME, key, 0, err)
+				return err
+			}
+		}
+	}
+
+	// the pending writes are to the files under the old name
+	flushWAL()
+	err = executor.ThisInstance.CatalogDir.RenameSubDir(args.From, args.To)
+	if err == nil {
+		if err = renameAliases(args.From, args.To, args.Alias); err != nil {
+			err = fmt.Errorf("alias update failed: %v", err)
+		} else if err = renameIdentifiers(args.From, args.To); err != nil {
+			err = fmt.Errorf("identifiers update failed: %v", err)
+		}
+	}
+	for _, result := range results {
+		audit.Record(r, audit.RENAME, result.Key, 0, err)
+		response.appendResult(result, err)
+	}
+	return nil
+}
+
+// Trim deletes the records before an epoch from every bucket whose key
+// matches the pattern, removing the year files which end before it
+func (s *DataService) Trim(r *http.Request, args *TrimArgs, response *AdminResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	if args.Before <= 0 {
+		return fmt.Errorf("before must be a positive epoch")
+	}
+	keys, buckets, err := matchingBuckets(args.Pattern)
+	if err != nil {
+		return err
+	}
+	if !args.DryRun {
+		flushWAL()
+	}
+	for _, key := range keys {
+		var freed int64
+		if err = auth.AuthorizeBucket(r, auth.ADMIN, key); err == nil {
+			freed, err = trimBucket(key, buckets[key], args.Before, args.DryRun)
+		}
+		if !args.DryRun {
+			audit.Record(r, audit.TRIM, key, 0, err)
+		}
+		response.appendResult(AdminResult{Key: key, Freed: freed}, err)
+	}
+	return nil
+}
+
+// trimBucket returns the disk space of the year files removed, only
+// computing it for a dry run
+func trimBucket(key string, infos []*io.TimeBucketInfo, before int64, dryRun bool) (freed int64, err error) {
+	beforeYear := int16(io.ToSystemTimezone(time.Unix(before, 0)).Year())
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Year < infos[j].Year })
+	// the latest year file is kept for the bucket to stay in the catalog
+	for _, info := range infos[:len(infos)-1] {
+		if info.Year >= beforeYear {
+			break
+		}
+		var st syscall.Stat_t
+		if err = syscall.Stat(info.Path, &st); err != nil {
+			return freed, err
+		}
+		if dryRun {
+			freed += st.Blocks * 512
+			continue
+		}
+		subDir, err := executor.ThisInstance.CatalogDir.GetOwningSubDirectory(info.Path)
+		if err != nil {
+			return freed, err
+		}
+		if err = subDir.RemoveFile(info.Year); err != nil {
+			return freed, err
+		}
+		freed += st.Blocks * 512
+	}
+	if dryRun {
+		return freed, nil
+	}
+
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(io.NewTimeBucketKey(key))
+	q.SetRange(planner.MinEpoch, before-1)
+	parsed, err := q.Parse()
+	if err != nil {
+		if errors.Is(err, planner.ErrNoFiles) {
+			return freed, nil
+		}
+		return freed, err
+	}
+	de, err := executor.NewDeleter(parsed)
+	if err != nil {
+		return freed, err
+	}
+	return freed, de.Delete()
+}
+
+// SetTimezone records the timezone of every bucket whose key matches the
+// pattern, by which their records are split into days and aggregated
+func (s *DataService) SetTimezone(r *http.Request, args *SetTimezoneArgs, response *AdminResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	if args.Timezone != "" {
+		if _, err = time.LoadLocation(args.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %s: %v", args.Timezone, err)
+		}
+	}
+	keys, _, err := matchingBuckets(args.Pattern)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = auth.AuthorizeBucket(r, auth.ADMIN, key); err == nil && !args.DryRun {
+			err = executor.SetBucketTimezone(*io.NewTimeBucketKey(key), args.Timezone)
+			audit.Record(r, audit.TIMEZONE, key, 0, err)
+		}
+		response.appendResult(AdminResult{Key: key}, err)
+	}
+	return nil
+}
+
+// SetMetadata sets the user metadata of every bucket whose key matches the
+// pattern, such as its description, units or source feed
+func (s *DataService) SetMetadata(r *http.Request, args *SetMetadataArgs, response *AdminResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	keys, _, err := matchingBuckets(args.Pattern)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = auth.AuthorizeBucket(r, auth.ADMIN, key); err == nil && !args.DryRun {
+			err = setMetadata(*io.NewTimeBucketKey(key), args.Metadata, args.Replace)
+			audit.Record(r, audit.METADATA, key, 0, err)
+		}
+		response.appendResult(AdminResult{Key: key}, err)
+	}
+	return nil
+}
+
+func setMetadata(tbk io.TimeBucketKey, metadata map[string]string, replace bool) error {
+	current := map[string]string{}
+	if !replace {
+		var err error
+		if current, err = executor.ThisInstance.CatalogDir.GetMetadata(&tbk); err != nil {
+			return err
+		}
+	}
+	for name, value := range metadata {
+		if value == "" {
+			delete(current, name)
+			continue
+		}
+		current[name] = value
+	}
+	return executor.ThisInstance.CatalogDir.SetMetadata(&tbk, current)
+}
+
+// RenameColumn renames a column of every bucket whose key matches the
+// pattern, in the headers of all of their year files, without rewriting
+// their records
+func (s *DataService) RenameColumn(r *http.Request, args *RenameColumnArgs, response *AdminResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	for _, name := range []string{args.From, args.To} {
+		if name == "" || strings.EqualFold(name, "Epoch") || executor.HiddenColumn(name) {
+			return fmt.Errorf("column \"%s\" can not be renamed", name)
+		}
+	}
+	keys, buckets, err := matchingBuckets(args.Pattern)
+	if err != nil {
+		return err
+	}
+	if !args.DryRun {
+		// the pending writes are to the files with the old header
+		flushWAL()
+	}
+	for _, key := range keys {
+		if err = auth.AuthorizeBucket(r, auth.ADMIN, key); err == nil {
+			if args.DryRun {
+				err = checkColumn(key, buckets[key], args.From)
+			} else {
+				err = executor.ThisInstance.CatalogDir.RenameColumn(io.NewTimeBucketKey(key), args.From, args.To)
+				audit.Record(r, audit.COLUMN, key, 0, err)
+			}
+		}
+		response.appendResult(AdminResult{Key: key}, err)
+	}
+	return nil
+}
+
+// checkColumn returns an error if the bucket has no column of the name
+func checkColumn(key string, infos []*io.TimeBucketInfo, name string) error {
+	for _, info := range infos {
+		for _, n := range info.GetElementNames() {
+			if n == name {
+				return nil
+			}
+		}
+		break
+	}
+	return fmt.Errorf("no column %s in %s", name, key)
+}
+
+// Backup copies the database files into a directory as of a single point in
+// time, holding the writes meanwhile, with a manifest to verify them on
+// restore
+func (s *DataService) Backup(r *http.Request, args *BackupArgs, response *BackupResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	if args.Dest == "" {
+		return fmt.Errorf("dest is required")
+	}
+	manifest, err := executor.Backup(args.Dest)
+	audit.Record(r, audit.BACKUP, args.Dest, 0, err)
+	if err != nil {
+		return err
+	}
+	response.Created = manifest.Created.Unix()
+	response.Files = len(manifest.Files)
+	response.Bytes = manifest.Size()
+	return nil
+}
+
+// Dump returns a runtime profile of the server, such as its goroutine
+// stacks or its heap, to diagnose a production instance without the
+// diagnostics endpoints
+func (s *DataService) Dump(r *http.Request, args *DumpArgs, response *DumpResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	name := args.Profile
+	if name == "" {
+		name = "goroutine"
+	}
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		return fmt.Errorf("unknown profile %s", name)
+	}
+	if args.GC && name == "heap" {
+		runtime.GC()
+	}
+	var buf bytes.Buffer
+	err = profile.WriteTo(&buf, args.Debug)
+	audit.Record(r, audit.DUMP, name, 0, err)
+	if err != nil {
+		return err
+	}
+	response.Profile = name
+	response.Data = buf.Bytes()
+	return nil
+}
+
+// matchingBuckets returns the sorted keys and the year files of the
+// buckets whose key matches the glob pattern
+func matchingBuckets(pattern string) ([]string, map[string][]*io.TimeBucketInfo, error) {
+	if pattern == "" {
+		return nil, nil, fmt.Errorf("pattern is required")
+	}
+	g, err := glob.Compile(pattern, '/')
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pattern \"%s\": %v", pattern, err)
+	}
+	buckets := gatherBuckets()
+	keys := []string{}
+	for key := range buckets {
+		if g.Match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, buckets, nil
+}
+
+// ReloadPlugins reloads the triggers and bgworkers of the configuration file,
+// without restarting the server nor interrupting the writes
+func (s *DataService) ReloadPlugins(r *http.Request, args *ReloadPluginsArgs, response *ReloadPluginsResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	if PluginReloader == nil {
+		return errors.New("plugins cannot be reloaded by this server")
+	}
+	reloaded, err := PluginReloader()
+	audit.Record(r, audit.RELOAD, "", 0, err)
+	if err != nil {
+		return err
+	}
+	*response = *reloaded
+	return nil
+}
+
+// ReloadConfig reloads the log level, the query and client limits, the
+// minimum free disk space and the plugins of the configuration file, without
+// restarting the server nor interrupting the writes and connections
+func (s *DataService) ReloadConfig(r *http.Request, args *ReloadConfigArgs, response *ReloadConfigResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	if ConfigReloader == nil {
+		return errors.New("configuration cannot be reloaded by this server")
+	}
+	reloaded, err := ConfigReloader()
+	audit.Record(r, audit.RELOAD, "", 0, err)
+	if err != nil {
+		return err
+	}
+	*response = *reloaded
+	return nil
+}
+
+// flushWAL writes the pending writes to the primary files
+func flushWAL() {
+	if executor.ThisInstance.WALFile != nil {
+		executor.ThisInstance.WALFile.RequestFlush()
+	}
+}
+
+func (ar *AdminResponse) appendResult(result AdminResult, err error) {
+	if err != nil {
+		result.Error = err.Error()
+		ar.Failed++
+	}
+	ar.Results = append(ar.Results, result)
+}
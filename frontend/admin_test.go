@@ -0,0 +1,372 @@
+package frontend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestAdmin(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	countRecords := func(key string, start int64) int {
+		var qresponse MultiQueryResponse
+		err := service.Query(nil, &MultiQueryRequest{
+			Requests: []QueryRequest{NewQueryRequestBuilder(key).EpochStart(start).End()},
+		}, &qresponse)
+		if err != nil {
+			return -1
+		}
+		csm, err := qresponse.Responses[0].Result.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		for _, cs := range csm {
+			return cs.Len()
+		}
+		return 0
+	}
+
+	var qresponse MultiQueryResponse
+	err := service.Query(nil, &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("EURUSD/1D/OHLC").End()},
+	}, &qresponse)
+	c.Assert(err, IsNil)
+	csm, err := qresponse.Responses[0].Result.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	var nds *io.NumpyDataset
+	for _, cs := range csm {
+		nds, err = io.NewNumpyDataset(cs)
+		c.Assert(err, IsNil)
+	}
+	var bresponse BulkWriteResponse
+	err = service.BulkWrite(nil, &MultiBulkWriteRequest{
+		Requests: []BulkWriteRequest{
+			{Key: "ADMIN0/1D/OHLC", Data: nds},
+			{Key: "ADMIN1/1D/OHLC", Data: nds},
+		},
+	}, &bresponse)
+	c.Assert(err, IsNil)
+	c.Assert(bresponse.Failed, Equals, 0)
+	total := countRecords("ADMIN0/1D/OHLC", 0)
+	c.Assert(total > 0, Equals, true)
+
+	// rename
+	var response AdminResponse
+	err = service.RenameSymbol(nil, &RenameSymbolArgs{From: "ADMIN0", To: "ADMIN2"}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 0)
+	c.Assert(response.Results, DeepEquals, []AdminResult{{Key: "ADMIN0/1D/OHLC", NewKey: "ADMIN2/1D/OHLC"}})
+	c.Assert(countRecords("ADMIN2/1D/OHLC", 0), Equals, total)
+	c.Assert(countRecords("ADMIN0/1D/OHLC", 0), Equals, -1)
+
+	response = AdminResponse{}
+	err = service.RenameSymbol(nil, &RenameSymbolArgs{From: "ADMIN2", To: "ADMIN1"}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 1)
+	c.Assert(countRecords("ADMIN2/1D/OHLC", 0), Equals, total)
+	err = service.RenameSymbol(nil, &RenameSymbolArgs{From: "ADMIN2", To: "A/B"}, &AdminResponse{})
+	c.Assert(err, NotNil)
+	err = service.RenameSymbol(nil, &RenameSymbolArgs{From: "NOSUCH", To: "ADMIN3"}, &AdminResponse{})
+	c.Assert(err, NotNil)
+
+	// trim
+	before := time.Date(2001, 7, 1, 0, 0, 0, 0, time.UTC).Unix()
+	kept := countRecords("ADMIN2/1D/OHLC", before)
+	c.Assert(kept > 0 && kept < total, Equals, true)
+	response = AdminResponse{}
+	err = service.Trim(nil, &TrimArgs{Pattern: "ADMIN2/*/*", Before: before, DryRun: true}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, HasLen, 1)
+	freed := response.Results[0].Freed
+	c.Assert(freed > 0, Equals, true)
+	c.Assert(countRecords("ADMIN2/1D/OHLC", 0), Equals, total)
+	response = AdminResponse{}
+	err = service.Trim(nil, &TrimArgs{Pattern: "ADMIN2/*/*", Before: before}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, DeepEquals, []AdminResult{{Key: "ADMIN2/1D/OHLC", Freed: freed}})
+	c.Assert(countRecords("ADMIN2/1D/OHLC", 0), Equals, kept)
+	// the 2000 year file is removed
+	for _, info := range gatherBuckets()["ADMIN2/1D/OHLC"] {
+		c.Assert(info.Year > 2000, Equals, true)
+	}
+	c.Assert(countRecords("ADMIN1/1D/OHLC", 0), Equals, total)
+	err = service.Trim(nil, &TrimArgs{Pattern: "ADMIN2/*/*"}, &AdminResponse{})
+	c.Assert(err, NotNil)
+
+	// destroy
+	response = AdminResponse{}
+	err = service.DestroyPattern(nil, &DestroyPatternArgs{Pattern: "ADMIN*/*/*", DryRun: true}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, DeepEquals, []AdminResult{{Key: "ADMIN1/1D/OHLC"}, {Key: "ADMIN2/1D/OHLC"}})
+	c.Assert(countRecords("ADMIN1/1D/OHLC", 0), Equals, total)
+	response = AdminResponse{}
+	err = service.DestroyPattern(nil, &DestroyPatternArgs{Pattern: "ADMIN*/*/*"}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, HasLen, 2)
+	c.Assert(response.Failed, Equals, 0)
+	c.Assert(countRecords("ADMIN1/1D/OHLC", 0), Equals, -1)
+	c.Assert(countRecords("ADMIN2/1D/OHLC", 0), Equals, -1)
+	err = service.DestroyPattern(nil, &DestroyPatternArgs{}, &AdminResponse{})
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerTestSuite) TestReloadPlugins(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	defer func(reloader func() (*ReloadPluginsResponse, error)) { PluginReloader = reloader }(PluginReloader)
+	PluginReloader = nil
+	err := service.ReloadPlugins(nil, &ReloadPluginsArgs{}, &ReloadPluginsResponse{})
+	c.Assert(err, NotNil)
+
+	PluginReloader = func() (*ReloadPluginsResponse, error) {
+		return &ReloadPluginsResponse{Started: []string{"ondiskagg.so"}, Kept: []string{"GDAXFetcher"}}, nil
+	}
+	var response ReloadPluginsResponse
+	err = service.ReloadPlugins(nil, &ReloadPluginsArgs{}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Started, DeepEquals, []string{"ondiskagg.so"})
+	c.Assert(response.Kept, DeepEquals, []string{"GDAXFetcher"})
+}
+
+func (s *ServerTestSuite) TestReloadConfig(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	defer func(reloader func() (*ReloadConfigResponse, error)) { ConfigReloader = reloader }(ConfigReloader)
+	ConfigReloader = nil
+	err := service.ReloadConfig(nil, &ReloadConfigArgs{}, &ReloadConfigResponse{})
+	c.Assert(err, NotNil)
+
+	ConfigReloader = func() (*ReloadConfigResponse, error) {
+		return &ReloadConfigResponse{Changed: []string{"log_level: debug"}}, nil
+	}
+	var response ReloadConfigResponse
+	err = service.ReloadConfig(nil, &ReloadConfigArgs{}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Changed, DeepEquals, []string{"log_level: debug"})
+}
+
+func (s *ServerTestSuite) TestDump(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var response DumpResponse
+	c.Assert(service.Dump(nil, &DumpArgs{Debug: 2}, &response), IsNil)
+	c.Assert(response.Profile, Equals, "goroutine")
+	c.Assert(string(response.Data), Matches, "(?s)goroutine \\d+ \\[running\\]:.*")
+
+	response = DumpResponse{}
+	c.Assert(service.Dump(nil, &DumpArgs{Profile: "heap", GC: true}, &response), IsNil)
+	c.Assert(response.Data, Not(HasLen), 0)
+
+	c.Assert(service.Dump(nil, &DumpArgs{Profile: "missing"}, &DumpResponse{}), ErrorMatches, "unknown profile missing")
+}
+
+func (s *ServerTestSuite) TestSetTimezone(c *C) {
+	service := &DataService{}
+	service.Init()
+	defer service.SetTimezone(nil, &SetTimezoneArgs{Pattern: "USDJPY/*/*"}, &AdminResponse{})
+
+	var response AdminResponse
+	err := service.SetTimezone(nil, &SetTimezoneArgs{Pattern: "USDJPY/*/*", Timezone: "Asia/Tokyo", DryRun: true}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, Not(HasLen), 0)
+	c.Assert(executor.BucketTimezone(*io.NewTimeBucketKey("USDJPY/1Min/OHLC")), Equals, utils.InstanceConfig.Timezone)
+
+	response = AdminResponse{}
+	err = service.SetTimezone(nil, &SetTimezoneArgs{Pattern: "USDJPY/*/*", Timezone: "Asia/Tokyo"}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 0)
+	var listing ListSymbolsResponse
+	err = service.ListSymbols(nil, &ListSymbolsArgs{Metadata: true, Pattern: "*/1Min/OHLC"}, &listing)
+	c.Assert(err, IsNil)
+	for _, md := range listing.Buckets {
+		timezone := utils.InstanceConfig.Timezone.String()
+		if md.Key == "USDJPY/1Min/OHLC" {
+			timezone = "Asia/Tokyo"
+		}
+		c.Assert(md.Timezone, Equals, timezone)
+	}
+
+	err = service.SetTimezone(nil, &SetTimezoneArgs{Pattern: "USDJPY/*/*", Timezone: "Asia/Nowhere"}, &AdminResponse{})
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerTestSuite) TestSetMetadata(c *C) {
+	service := &DataService{}
+	service.Init()
+	defer service.SetMetadata(nil, &SetMetadataArgs{Pattern: "USDJPY/*/*", Replace: true}, &AdminResponse{})
+
+	var response AdminResponse
+	err := service.SetMetadata(nil, &SetMetadataArgs{Pattern: "USDJPY/*/*",
+		Metadata: map[string]string{"source": "oanda", "units": "JPY"}}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 0)
+	c.Assert(response.Results, Not(HasLen), 0)
+
+	// the entries are set one by one unless replaced, and removed by an
+	// empty value
+	err = service.SetMetadata(nil, &SetMetadataArgs{Pattern: "USDJPY/1Min/OHLC",
+		Metadata: map[string]string{"units": "", "description": "test bars"}}, &AdminResponse{})
+	c.Assert(err, IsNil)
+	var listing ListSymbolsResponse
+	err = service.ListSymbols(nil, &ListSymbolsArgs{Metadata: true, Pattern: "*/1Min/OHLC"}, &listing)
+	c.Assert(err, IsNil)
+	for _, md := range listing.Buckets {
+		var metadata map[string]string
+		if md.Key == "USDJPY/1Min/OHLC" {
+			metadata = map[string]string{"source": "oanda", "description": "test bars"}
+		}
+		c.Assert(md.Metadata, DeepEquals, metadata)
+	}
+
+	err = service.SetMetadata(nil, &SetMetadataArgs{Pattern: "USDJPY/1Min/OHLC",
+		Metadata: map[string]string{"source": "fxcm"}, Replace: true}, &AdminResponse{})
+	c.Assert(err, IsNil)
+	var schemas GetSchemaResponse
+	err = service.GetSchema(nil, &GetSchemaArgs{Keys: []string{"USDJPY/1Min/OHLC"}}, &schemas)
+	c.Assert(err, IsNil)
+	c.Assert(schemas.Schemas[0].Metadata, DeepEquals, map[string]string{"source": "fxcm"})
+}
+
+func (s *ServerTestSuite) TestRenameColumn(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var response AdminResponse
+	err := service.RenameColumn(nil, &RenameColumnArgs{Pattern: "USDJPY/1Min/OHLC",
+		From: "Close", To: "Last", DryRun: true}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 0)
+	c.Assert(response.Results, HasLen, 1)
+
+	defer service.RenameColumn(nil, &RenameColumnArgs{Pattern: "USDJPY/1Min/OHLC",
+		From: "Last", To: "Close"}, &AdminResponse{})
+	response = AdminResponse{}
+	err = service.RenameColumn(nil, &RenameColumnArgs{Pattern: "USDJPY/1Min/OHLC",
+		From: "Close", To: "Last"}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 0)
+	var schemas GetSchemaResponse
+	err = service.GetSchema(nil, &GetSchemaArgs{Keys: []string{"USDJPY/1Min/OHLC"}}, &schemas)
+	c.Assert(err, IsNil)
+	names := []string{}
+	for _, column := range schemas.Schemas[0].Columns {
+		names = append(names, column.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"Epoch", "Open", "High", "Low", "Last"})
+
+	// the buckets without the column fail one by one
+	response = AdminResponse{}
+	err = service.RenameColumn(nil, &RenameColumnArgs{Pattern: "USDJPY/1Min/OHLC",
+		From: "Close", To: "Final"}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 1)
+	err = service.RenameColumn(nil, &RenameColumnArgs{Pattern: "USDJPY/1Min/OHLC",
+		From: "Last", To: "Nulls"}, &AdminResponse{})
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerTestSuite) TestBackup(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	dest := filepath.Join(c.MkDir(), "backup")
+	var response BackupResponse
+	c.Assert(service.Backup(nil, &BackupArgs{Dest: dest}, &response), IsNil)
+	c.Assert(response.Files > 0, Equals, true)
+	c.Assert(response.Bytes > 0, Equals, true)
+	_, err := os.Stat(filepath.Join(dest, "EURUSD", "1Min", "OHLC", "2000.bin"))
+	c.Assert(err, IsNil)
+	walFiles, _ := filepath.Glob(filepath.Join(dest, "*.walfile"))
+	c.Assert(walFiles, HasLen, 0)
+
+	// the destination must be empty
+	c.Assert(service.Backup(nil, &BackupArgs{Dest: dest}, &BackupResponse{}), ErrorMatches, ".*not empty")
+
+	rootDir := c.MkDir()
+	manifest, err := executor.Restore(dest, rootDir)
+	c.Assert(err, IsNil)
+	c.Assert(manifest.Files, HasLen, response.Files)
+	_, err = os.Stat(filepath.Join(rootDir, "EURUSD", "1Min", "OHLC", "2000.bin"))
+	c.Assert(err, IsNil)
+	_, err = executor.Restore(dest, rootDir)
+	c.Assert(err, ErrorMatches, ".*already holds database files")
+
+	// a damaged backup is not restored
+	path := filepath.Join(dest, filepath.FromSlash(manifest.Files[0].Path))
+	c.Assert(ioutil.WriteFile(path, []byte("damaged"), 0600), IsNil)
+	_, err = executor.VerifyBackup(dest)
+	c.Assert(err, ErrorMatches, ".* differs from the manifest")
+	_, err = executor.Restore(dest, c.MkDir())
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerTestSuite) TestRenameAlias(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	query := func(key string) (string, int) {
+		var qresponse MultiQueryResponse
+		err := service.Query(nil, &MultiQueryRequest{
+			Requests: []QueryRequest{NewQueryRequestBuilder(key).End()},
+		}, &qresponse)
+		if err != nil {
+			return "", -1
+		}
+		csm, err := qresponse.Responses[0].Result.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		for tbk, cs := range csm {
+			return tbk.GetItemKey(), cs.Len()
+		}
+		return "", 0
+	}
+
+	var qresponse MultiQueryResponse
+	err := service.Query(nil, &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("EURUSD/1D/OHLC").End()},
+	}, &qresponse)
+	c.Assert(err, IsNil)
+	csm, err := qresponse.Responses[0].Result.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	var nds *io.NumpyDataset
+	for _, cs := range csm {
+		nds, err = io.NewNumpyDataset(cs)
+		c.Assert(err, IsNil)
+	}
+	var bresponse BulkWriteResponse
+	err = service.BulkWrite(nil, &MultiBulkWriteRequest{
+		Requests: []BulkWriteRequest{{Key: "ALIAS0/1D/OHLC", Data: nds}},
+	}, &bresponse)
+	c.Assert(err, IsNil)
+	c.Assert(bresponse.Failed, Equals, 0)
+	_, total := query("ALIAS0/1D/OHLC")
+
+	var response AdminResponse
+	err = service.RenameSymbol(nil, &RenameSymbolArgs{From: "ALIAS0", To: "ALIAS1", Alias: true}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Failed, Equals, 0)
+	key, n := query("ALIAS0/1D/OHLC")
+	c.Assert(key, Equals, "ALIAS0/1D/OHLC")
+	c.Assert(n, Equals, total)
+
+	// the alias follows the symbol
+	err = service.RenameSymbol(nil, &RenameSymbolArgs{From: "ALIAS1", To: "ALIAS2"}, &AdminResponse{})
+	c.Assert(err, IsNil)
+	_, n = query("ALIAS0/1D/OHLC")
+	c.Assert(n, Equals, total)
+	_, n = query("ALIAS1/1D/OHLC")
+	c.Assert(n, Equals, -1)
+	_, err = os.Stat(filepath.Join(executor.ThisInstance.RootDir, SymbolAliasFile))
+	c.Assert(err, IsNil)
+
+	err = service.DestroyPattern(nil, &DestroyPatternArgs{Pattern: "ALIAS*/*/*"}, &AdminResponse{})
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,119 @@
+package frontend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// SymbolAliasFile is the file of the symbol aliases in the root directory, a
+// file rather than a directory which would be loaded as part of the catalog
+const SymbolAliasFile = "aliases.json"
+
+var (
+	aliasMu sync.Mutex
+	// root directory the aliases were loaded from
+	aliasRoot string
+	// new symbol by renamed symbol
+	aliases map[string]string
+)
+
+// loadAliases returns the aliases of the root directory of the instance,
+// loaded once.  The caller holds aliasMu.
+func loadAliases() map[string]string {
+	root := executor.ThisInstance.RootDir
+	if aliases != nil && aliasRoot == root {
+		return aliases
+	}
+	aliasRoot, aliases = root, map[string]string{}
+	data, err := ioutil.ReadFile(filepath.Join(root, SymbolAliasFile))
+	if err == nil {
+		json.Unmarshal(data, &aliases)
+	}
+	return aliases
+}
+
+// renameAliases points the aliases of the renamed symbol to its new name,
+// leaving the renamed symbol behind as an alias of it if requested
+func renameAliases(from, to string, alias bool) error {
+	aliasMu.Lock()
+	defer aliasMu.Unlock()
+	loaded := loadAliases()
+	changed := alias
+	for a, symbol := range loaded {
+		if symbol == from {
+			loaded[a], changed = to, true
+		}
+	}
+	if alias {
+		loaded[from] = to
+	}
+	if _, ok := loaded[to]; ok {
+		delete(loaded, to)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(loaded, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(aliasRoot, SymbolAliasFile)
+	if err = ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// resolveAliases returns the symbols with the aliases replaced by the symbol
+// they stand for, and the aliases by symbol.  The symbols of the catalog are
+// never aliases, so that a symbol reused after a rename is its own.
+func resolveAliases(symbols []string) (resolved []string, aliasOf map[string]string) {
+	aliasMu.Lock()
+	loaded := loadAliases()
+	aliasMu.Unlock()
+	if len(loaded) == 0 {
+		return symbols, nil
+	}
+	var known map[string]int
+	resolved = make([]string, len(symbols))
+	for i, symbol := range symbols {
+		resolved[i] = symbol
+		to, ok := loaded[symbol]
+		if !ok {
+			continue
+		}
+		if known == nil {
+			known = executor.ThisInstance.CatalogDir.GatherCategoriesAndItems()["Symbol"]
+		}
+		if _, exists := known[symbol]; exists {
+			continue
+		}
+		if aliasOf == nil {
+			aliasOf = map[string]string{}
+		}
+		resolved[i], aliasOf[to] = to, symbol
+	}
+	return resolved, aliasOf
+}
+
+// unaliasKeys returns the results keyed by the aliases they were requested by
+func unaliasKeys(csm io.ColumnSeriesMap, aliasOf map[string]string) io.ColumnSeriesMap {
+	if aliasOf == nil {
+		return csm
+	}
+	out := io.NewColumnSeriesMap()
+	for tbk, cs := range csm {
+		if alias, ok := aliasOf[tbk.GetItemInCategory("Symbol")]; ok {
+			tbk.SetItemInCategory("Symbol", alias)
+		}
+		out[tbk] = cs
+	}
+	return out
+}
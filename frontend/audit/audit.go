@@ -0,0 +1,172 @@
+// Package audit records the mutating operations on the database, writes,
+// bucket creations and deletions and plugin reloads, with who made them,
+// when, from where, on which bucket and how many rows, in an audit log for
+// data governance.
+//
+// Records are written to every registered sink.  The file sink appends one
+// JSON record per line and the syslog sink logs the same JSON records, and
+// other sinks can be added with AddSink.  Without sinks nothing is recorded.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+const (
+	WRITE    = "write"
+	CREATE   = "create"
+	DESTROY  = "destroy"
+	RENAME   = "rename"
+	TRIM     = "trim"
+	RELOAD   = "reload"
+	BACKUP   = "backup"
+	DUMP     = "dump"
+	TIMEZONE = "timezone"
+	METADATA = "metadata"
+	COLUMN   = "rename_column"
+	ACTIONS  = "corporate_actions"
+	IDS      = "identifiers"
+)
+
+// Event is a record of the audit log
+type Event struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// the name of the API key of the request, if any
+	Identity string `json:"identity,omitempty"`
+	// the remote address of the request, or "local" for in-process calls
+	Source string `json:"source"`
+	Bucket string `json:"bucket"`
+	Rows   int    `json:"rows,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Sink is a destination of the audit log
+type Sink interface {
+	Write(event *Event) error
+}
+
+var (
+	sinks []Sink
+	mu    sync.RWMutex
+)
+
+// Initialize replaces the sinks with the ones of the setting
+func Initialize(setting *utils.AuditLogSetting) error {
+	var s []Sink
+	if setting != nil {
+		if setting.File != "" {
+			sink, err := NewFileSink(setting.File)
+			if err != nil {
+				return err
+			}
+			s = append(s, sink)
+		}
+		if setting.Syslog {
+			sink, err := NewSyslogSink()
+			if err != nil {
+				return err
+			}
+			s = append(s, sink)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = s
+	if len(sinks) > 0 {
+		log.Info("audit log enabled with %d sink(s)", len(sinks))
+	}
+	return nil
+}
+
+// AddSink registers an additional sink
+func AddSink(sink Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Record writes an event for the operation of the request on the bucket
+// to every sink, along with its error if the operation failed
+func Record(r *http.Request, operation, bucket string, rows int, err error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+	event := &Event{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Source:    "local",
+		Bucket:    bucket,
+		Rows:      rows,
+	}
+	if r != nil {
+		event.Identity = auth.Identity(r)
+		event.Source = r.RemoteAddr
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	for _, sink := range sinks {
+		if err := sink.Write(event); err != nil {
+			log.Error("failed to write audit log record (%v)", err)
+		}
+	}
+}
+
+// FileSink appends the records to a file, one JSON record per line
+type FileSink struct {
+	sync.Mutex
+	f *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %v", err)
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Write(event *Event) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.f.Write(append(buf, '\n'))
+	return err
+}
+
+// SyslogSink logs the records as JSON to the local syslog daemon
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+func NewSyslogSink() (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "marketstore")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) Write(event *Event) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.w.Notice(string(buf))
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type AuditTestSuite struct{}
+
+var _ = Suite(&AuditTestSuite{})
+
+func (s *AuditTestSuite) TearDownTest(c *C) {
+	Initialize(nil)
+	auth.Initialize(nil)
+}
+
+type memorySink struct {
+	events []*Event
+}
+
+func (s *memorySink) Write(event *Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *AuditTestSuite) TestFileSink(c *C) {
+	path := filepath.Join(c.MkDir(), "audit.log")
+	c.Assert(Initialize(&utils.AuditLogSetting{File: path}), IsNil)
+	auth.Initialize([]*utils.APIKeySetting{{Name: "loader", Key: "secret", Permission: "write"}})
+
+	r, _ := http.NewRequest("POST", "/rpc", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-API-Key", "secret")
+	Record(r, WRITE, "AAPL/1Min/OHLCV", 10, nil)
+	Record(nil, DESTROY, "AAPL/1Min/OHLCV", 0, errors.New("no such bucket"))
+
+	buf, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	c.Assert(lines, HasLen, 2)
+
+	var event Event
+	c.Assert(json.Unmarshal([]byte(lines[0]), &event), IsNil)
+	c.Assert(event.Operation, Equals, WRITE)
+	c.Assert(event.Identity, Equals, "loader")
+	c.Assert(event.Source, Equals, "10.0.0.1:1234")
+	c.Assert(event.Bucket, Equals, "AAPL/1Min/OHLCV")
+	c.Assert(event.Rows, Equals, 10)
+	c.Assert(event.Time.IsZero(), Equals, false)
+	c.Assert(strings.Contains(lines[0], "secret"), Equals, false)
+
+	event = Event{}
+	c.Assert(json.Unmarshal([]byte(lines[1]), &event), IsNil)
+	c.Assert(event.Operation, Equals, DESTROY)
+	c.Assert(event.Source, Equals, "local")
+	c.Assert(event.Error, Equals, "no such bucket")
+
+	c.Assert(Initialize(&utils.AuditLogSetting{File: filepath.Join(path, "missing", "audit.log")}), NotNil)
+}
+
+func (s *AuditTestSuite) TestAddSink(c *C) {
+	// nothing is recorded without sinks
+	Record(nil, WRITE, "AAPL/1Min/OHLCV", 1, nil)
+
+	sink := &memorySink{}
+	AddSink(sink)
+	Record(nil, CREATE, "AAPL/1Min/OHLCV", 0, nil)
+	c.Assert(sink.events, HasLen, 1)
+	c.Assert(sink.events[0].Operation, Equals, CREATE)
+}
@@ -0,0 +1,295 @@
+// Package auth implements API key authentication for the server endpoints.
+// Each configured key is granted one of the read, write or admin permissions,
+// where each permission includes the ones before it.  When no keys are
+// configured, authentication is disabled and every request is allowed.
+//
+// Clients present their key in the "Authorization: Bearer <key>" or the
+// "X-API-Key" header, or in the "api_key" URL parameter for clients that can
+// not set headers, such as websockets in browsers.
+//
+// A key may further be limited to buckets with rules mapping item key
+// patterns to permissions, e.g. a writer restricted to "*/1Min/OHLCV" that
+// can only read the other buckets.  The permission of such a key on a bucket
+// is the highest one among the matching rules, up to the permission of the
+// key itself, and none if no rule matches.
+//
+// A key of a namespace is confined to the buckets whose symbol is prefixed
+// by the namespace, e.g. "alpha.AAPL/1Min/OHLCV" of the namespace alpha,
+// and has at most the write permission on the instance, the admin calls of
+// the instance being left to the keys of no namespace.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/gobwas/glob"
+)
+
+type Permission int
+
+const (
+	NONE Permission = iota
+	READ
+	WRITE
+	ADMIN
+)
+
+func (p Permission) String() string {
+	switch p {
+	case READ:
+		return "read"
+	case WRITE:
+		return "write"
+	case ADMIN:
+		return "admin"
+	}
+	return "none"
+}
+
+var (
+	UnauthenticatedError = errors.New("Missing or unknown API key")
+	keys                 map[string]*identity
+	mu                   sync.RWMutex
+)
+
+// identity is the permission granted to a key, and its bucket rules if any
+type identity struct {
+	name       string
+	permission Permission
+	rules      []bucketRule
+	// prefix of the symbols of the namespace of the key, if any
+	prefix string
+}
+
+type bucketRule struct {
+	pattern    glob.Glob
+	permission Permission
+}
+
+// bucketPermission returns the permission of the identity on the bucket
+// with the item key, e.g. "AAPL/1Min/OHLCV"
+func (id *identity) bucketPermission(itemKey string) Permission {
+	if !strings.HasPrefix(itemKey, id.prefix) {
+		return NONE
+	}
+	if len(id.rules) == 0 {
+		return id.permission
+	}
+	permission := NONE
+	for _, rule := range id.rules {
+		if rule.permission > permission && rule.pattern.Match(itemKey) {
+			permission = rule.permission
+		}
+	}
+	if permission > id.permission {
+		return id.permission
+	}
+	return permission
+}
+
+func PermissionFromString(permission string) (Permission, error) {
+	switch strings.ToLower(permission) {
+	case "read":
+		return READ, nil
+	case "write":
+		return WRITE, nil
+	case "admin":
+		return ADMIN, nil
+	}
+	return NONE, fmt.Errorf("invalid permission: %s, should be one of read, write or admin", permission)
+}
+
+// PermissionError is returned for an authenticated request
+// whose key lacks the permission it requires
+type PermissionError struct {
+	Required Permission
+	Bucket   string
+}
+
+func (e PermissionError) Error() string {
+	if e.Bucket != "" {
+		return fmt.Sprintf("API key does not have %s permission on %s", e.Required, e.Bucket)
+	}
+	return fmt.Sprintf("API key does not have %s permission", e.Required)
+}
+
+// Initialize sets the accepted keys, replacing any previous ones.  A
+// setting without a key, or with an invalid permission or bucket rule,
+// fails it and the previous keys are kept.
+func Initialize(settings []*utils.APIKeySetting) error {
+	m := map[string]*identity{}
+	for i, setting := range settings {
+		if setting == nil || setting.Key == "" {
+			return fmt.Errorf("API key setting %d without a key", i)
+		}
+		id, err := newIdentity(setting)
+		if err != nil {
+			return fmt.Errorf("invalid API key setting %s: %v", keyName(setting), err)
+		}
+		m[setting.Key] = id
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	keys = m
+	if len(keys) > 0 {
+		log.Info("API key authentication enabled with %d key(s)", len(keys))
+	}
+	return nil
+}
+
+func newIdentity(setting *utils.APIKeySetting) (*identity, error) {
+	permission, err := PermissionFromString(setting.Permission)
+	if err != nil {
+		return nil, err
+	}
+	id := &identity{name: keyName(setting), permission: permission}
+	if setting.Namespace != "" {
+		id.prefix = setting.Namespace + utils.NamespaceSeparator
+	}
+	for _, bucket := range setting.Buckets {
+		if bucket == nil || bucket.Pattern == "" {
+			return nil, errors.New("bucket rule without a pattern")
+		}
+		pattern, err := glob.Compile(bucket.Pattern, '/')
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket pattern %s: %v", bucket.Pattern, err)
+		}
+		permission, err := PermissionFromString(bucket.Permission)
+		if err != nil {
+			return nil, err
+		}
+		id.rules = append(id.rules, bucketRule{pattern: pattern, permission: permission})
+	}
+	return id, nil
+}
+
+// keyName returns the name of the key setting, or one derived from the key
+// as the key itself is never exposed, e.g. in the logs
+func keyName(setting *utils.APIKeySetting) string {
+	if setting.Name != "" {
+		return setting.Name
+	}
+	sum := sha256.Sum256([]byte(setting.Key))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
+
+// Enabled returns true if any keys are configured
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(keys) > 0
+}
+
+// Authorize checks that the request carries a key with the required
+// permission.  A nil request is an in-process call and is always allowed.
+func Authorize(r *http.Request, required Permission) error {
+	if r == nil || !Enabled() {
+		return nil
+	}
+	id, err := lookup(KeyFromRequest(r))
+	if err != nil {
+		return err
+	}
+	if id.permission < required || (id.prefix != "" && required == ADMIN) {
+		return PermissionError{Required: required}
+	}
+	return nil
+}
+
+// AuthorizeBucket checks that the request carries a key with the required
+// permission on the bucket with the item key, e.g. "AAPL/1Min/OHLCV"
+func AuthorizeBucket(r *http.Request, required Permission, itemKey string) error {
+	if r == nil {
+		return nil
+	}
+	return AuthorizeKey(KeyFromRequest(r), required, itemKey)
+}
+
+// AuthorizeKey is AuthorizeBucket for a key presented earlier, such as
+// the one a stream subscriber connected with
+func AuthorizeKey(key string, required Permission, itemKey string) error {
+	if !Enabled() {
+		return nil
+	}
+	id, err := lookup(key)
+	if err != nil {
+		return err
+	}
+	if id.bucketPermission(itemKey) < required {
+		return PermissionError{Required: required, Bucket: itemKey}
+	}
+	return nil
+}
+
+func lookup(key string) (*identity, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	id, ok := keys[key]
+	if !ok {
+		return nil, UnauthenticatedError
+	}
+	return id, nil
+}
+
+// Identity returns the name of the key presented by the request, or its
+// fingerprint if it has no name, and empty if there is no known key
+func Identity(r *http.Request) string {
+	if r == nil || !Enabled() {
+		return ""
+	}
+	id, err := lookup(KeyFromRequest(r))
+	if err != nil {
+		return ""
+	}
+	return id.name
+}
+
+// Namespace returns the prefix of the symbols of the namespace of the key
+// presented by the request, empty if it is of none
+func Namespace(r *http.Request) string {
+	if r == nil || !Enabled() {
+		return ""
+	}
+	id, err := lookup(KeyFromRequest(r))
+	if err != nil {
+		return ""
+	}
+	return id.prefix
+}
+
+// KeyFromRequest returns the API key presented by the request, if any
+func KeyFromRequest(r *http.Request) string {
+	if bearer := r.Header.Get("Authorization"); bearer != "" {
+		if parts := strings.SplitN(bearer, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if r.URL == nil {
+		return ""
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// Status returns the HTTP status code for an authorization error
+func Status(err error) int {
+	switch err.(type) {
+	case PermissionError:
+		return http.StatusForbidden
+	}
+	if err == UnauthenticatedError {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
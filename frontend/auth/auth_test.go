@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type AuthTestSuite struct{}
+
+var _ = Suite(&AuthTestSuite{})
+
+func (s *AuthTestSuite) TearDownTest(c *C) {
+	Initialize(nil)
+}
+
+func (s *AuthTestSuite) TestAuthorize(c *C) {
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// disabled without keys
+	c.Assert(Enabled(), Equals, false)
+	c.Assert(Authorize(r, ADMIN), IsNil)
+
+	c.Assert(Initialize([]*utils.APIKeySetting{
+		{Key: "reader", Permission: "read"},
+		{Key: "writer", Permission: "Write"},
+		{Key: "admin", Permission: "admin"},
+	}), IsNil)
+	c.Assert(Enabled(), Equals, true)
+
+	c.Assert(Authorize(r, READ), Equals, UnauthenticatedError)
+	c.Assert(Authorize(nil, ADMIN), IsNil)
+
+	r.Header.Set("X-API-Key", "bad")
+	c.Assert(Authorize(r, READ), Equals, UnauthenticatedError)
+
+	r.Header.Set("X-API-Key", "reader")
+	c.Assert(Authorize(r, READ), IsNil)
+	c.Assert(Authorize(r, WRITE), Equals, PermissionError{Required: WRITE})
+	c.Assert(Status(Authorize(r, WRITE)), Equals, http.StatusForbidden)
+
+	r.Header.Set("Authorization", "Bearer writer")
+	c.Assert(Authorize(r, WRITE), IsNil)
+	c.Assert(Authorize(r, ADMIN), NotNil)
+
+	r, _ = http.NewRequest("GET", "/ws?api_key=admin", nil)
+	c.Assert(Authorize(r, ADMIN), IsNil)
+	c.Assert(Identity(r), Equals, "key-8c6976e5")
+	c.Assert(Status(UnauthenticatedError), Equals, http.StatusUnauthorized)
+}
+
+func (s *AuthTestSuite) TestAuthorizeBucket(c *C) {
+	Initialize([]*utils.APIKeySetting{
+		{Name: "alice", Key: "reader", Permission: "read"},
+		{Key: "writer", Permission: "write", Buckets: []*utils.BucketAccessSetting{
+			{Pattern: "*/1Min/OHLCV", Permission: "write"},
+			{Pattern: "*/*/*", Permission: "read"},
+		}},
+		{Key: "analyst", Permission: "read", Buckets: []*utils.BucketAccessSetting{
+			{Pattern: "{AAPL,TSLA}/*/*", Permission: "admin"},
+		}},
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// keys without rules have their permission on every bucket
+	r.Header.Set("X-API-Key", "reader")
+	c.Assert(Identity(r), Equals, "alice")
+	c.Assert(AuthorizeBucket(r, READ, "AAPL/1Min/OHLCV"), IsNil)
+	c.Assert(AuthorizeBucket(r, WRITE, "AAPL/1Min/OHLCV"), NotNil)
+
+	r.Header.Set("X-API-Key", "writer")
+	c.Assert(AuthorizeBucket(r, WRITE, "AAPL/1Min/OHLCV"), IsNil)
+	c.Assert(AuthorizeBucket(r, WRITE, "AAPL/1D/OHLCV"), Equals,
+		PermissionError{Required: WRITE, Bucket: "AAPL/1D/OHLCV"})
+	c.Assert(AuthorizeBucket(r, READ, "AAPL/1D/OHLCV"), IsNil)
+	c.Assert(Status(AuthorizeBucket(r, WRITE, "AAPL/1D/OHLCV")), Equals, http.StatusForbidden)
+
+	// rules do not grant more than the key permission
+	c.Assert(AuthorizeKey("analyst", READ, "TSLA/1Min/OHLCV"), IsNil)
+	c.Assert(AuthorizeKey("analyst", WRITE, "TSLA/1Min/OHLCV"), NotNil)
+	c.Assert(AuthorizeKey("analyst", READ, "NVDA/1Min/OHLCV"), NotNil)
+
+	c.Assert(AuthorizeBucket(nil, ADMIN, "AAPL/1Min/OHLCV"), IsNil)
+	Initialize(nil)
+	c.Assert(AuthorizeKey("", ADMIN, "AAPL/1Min/OHLCV"), IsNil)
+}
+
+func (s *AuthTestSuite) TestInitializeInvalid(c *C) {
+	c.Assert(Initialize([]*utils.APIKeySetting{{Key: "reader", Permission: "read"}}), IsNil)
+
+	// an invalid setting fails the startup rather than leaving a key out
+	for _, setting := range []*utils.APIKeySetting{
+		{Key: "bad", Permission: "superuser"},
+		{Permission: "read"},
+		{Key: "bad", Permission: "read", Buckets: []*utils.BucketAccessSetting{{Pattern: "[AAPL/*/*", Permission: "read"}}},
+		{Key: "bad", Permission: "read", Buckets: []*utils.BucketAccessSetting{{Permission: "read"}}},
+		nil,
+	} {
+		err := Initialize([]*utils.APIKeySetting{{Key: "writer", Permission: "write"}, setting})
+		c.Assert(err, NotNil)
+	}
+	// the previous keys are kept
+	c.Assert(AuthorizeKey("reader", READ, "AAPL/1Min/OHLCV"), IsNil)
+	c.Assert(AuthorizeKey("writer", READ, "AAPL/1Min/OHLCV"), Equals, UnauthenticatedError)
+	c.Assert(AuthorizeKey("bad", READ, "AAPL/1Min/OHLCV"), Equals, UnauthenticatedError)
+}
+
+func (s *AuthTestSuite) TestNamespace(c *C) {
+	Initialize([]*utils.APIKeySetting{
+		{Key: "alpha", Permission: "admin", Namespace: "alpha"},
+		{Key: "beta", Permission: "write", Namespace: "beta", Buckets: []*utils.BucketAccessSetting{
+			{Pattern: "*/1Min/*", Permission: "write"},
+		}},
+		{Key: "admin", Permission: "admin"},
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	r.Header.Set("X-API-Key", "alpha")
+	c.Assert(Namespace(r), Equals, "alpha.")
+	c.Assert(AuthorizeBucket(r, ADMIN, "alpha.AAPL/1Min/OHLCV"), IsNil)
+	c.Assert(AuthorizeBucket(r, READ, "beta.AAPL/1Min/OHLCV"), NotNil)
+	c.Assert(AuthorizeBucket(r, READ, "AAPL/1Min/OHLCV"), NotNil)
+	// not an admin of the instance
+	c.Assert(Authorize(r, WRITE), IsNil)
+	c.Assert(Authorize(r, ADMIN), Equals, PermissionError{Required: ADMIN})
+
+	// the rules apply within the namespace
+	c.Assert(AuthorizeKey("beta", WRITE, "beta.AAPL/1Min/OHLCV"), IsNil)
+	c.Assert(AuthorizeKey("beta", READ, "beta.AAPL/1D/OHLCV"), NotNil)
+	c.Assert(AuthorizeKey("beta", READ, "betamax/1Min/OHLCV"), NotNil)
+
+	r.Header.Set("X-API-Key", "admin")
+	c.Assert(Namespace(r), Equals, "")
+	c.Assert(AuthorizeBucket(r, ADMIN, "alpha.AAPL/1Min/OHLCV"), IsNil)
+	c.Assert(Authorize(r, ADMIN), IsNil)
+}
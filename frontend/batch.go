@@ -0,0 +1,146 @@
+package frontend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	rpc "github.com/alpacahq/rpc/rpc2"
+	msgpack "github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+/*
+	Batches: as in JSON-RPC 2.0, the body of an RPC request may be an array
+	of calls instead of a single one.  The calls are served in turn and
+	their responses returned in an array in the same order, without the
+	responses of the calls without an id.
+*/
+
+// maxBatchSize caps the number of calls of a batch
+const maxBatchSize = 100
+
+var emptyBatchError = errors.New("rpc: empty batch")
+
+// splitBatch returns the encoded calls of the body if it is a batch
+func splitBatch(contentType string, body []byte) (calls [][]byte, isBatch bool, err error) {
+	if strings.HasPrefix(strings.ToLower(contentType), "application/x-msgpack") {
+		if len(body) == 0 {
+			return nil, false, nil
+		}
+		c := codes.Code(body[0])
+		if !codes.IsFixedArray(c) && c != codes.Array16 && c != codes.Array32 {
+			return nil, false, nil
+		}
+		var elems []interface{}
+		if err = msgpack.Unmarshal(body, &elems); err != nil {
+			return nil, true, fmt.Errorf("rpc: malformed batch: %v", err)
+		}
+		for _, elem := range elems {
+			call, err := msgpack.Marshal(elem)
+			if err != nil {
+				return nil, true, err
+			}
+			calls = append(calls, call)
+		}
+	} else {
+		if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+			return nil, false, nil
+		}
+		var elems []json.RawMessage
+		if err = json.Unmarshal(body, &elems); err != nil {
+			return nil, true, fmt.Errorf("rpc: malformed batch: %v", err)
+		}
+		for _, elem := range elems {
+			calls = append(calls, elem)
+		}
+	}
+	switch {
+	case len(calls) == 0:
+		return nil, true, emptyBatchError
+	case len(calls) > maxBatchSize:
+		return nil, true, fmt.Errorf("rpc: batch of %d calls, at most %d are allowed", len(calls), maxBatchSize)
+	}
+	return calls, true, nil
+}
+
+// serveBatch serves each call as if it was a request of its own, and writes
+// the array of their responses
+func (s *RpcServer) serveBatch(w http.ResponseWriter, r *http.Request, calls [][]byte) {
+	var (
+		responses [][]byte
+		header    http.Header
+	)
+	for _, call := range calls {
+		sub := new(http.Request)
+		*sub = *r
+		sub.Body = ioutil.NopCloser(bytes.NewReader(call))
+		sub.ContentLength = int64(len(call))
+		rec := &batchRecorder{header: http.Header{}}
+		s.Server.ServeHTTP(rec, sub)
+		if rec.body.Len() > 0 {
+			responses = append(responses, rec.body.Bytes())
+			header = rec.header
+		}
+	}
+	if len(responses) == 0 {
+		// only notifications
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+
+	var buf bytes.Buffer
+	if strings.HasPrefix(header.Get("Content-Type"), "application/x-msgpack") {
+		msgpack.NewEncoder(&buf).EncodeArrayLen(len(responses))
+		for _, response := range responses {
+			buf.Write(response)
+		}
+	} else {
+		buf.WriteByte('[')
+		for i, response := range responses {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(bytes.TrimSpace(response))
+		}
+		buf.WriteByte(']')
+	}
+	w.Write(buf.Bytes())
+}
+
+// batchRecorder holds the response of a call of a batch
+type batchRecorder struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (br *batchRecorder) Header() http.Header         { return br.header }
+func (br *batchRecorder) Write(b []byte) (int, error) { return br.body.Write(b) }
+func (br *batchRecorder) WriteHeader(status int)      {}
+
+// readBatch returns the calls of the request if it is a batch, or else
+// restores its body for the RPC server, writing the error if it fails
+func readBatch(w http.ResponseWriter, r *http.Request) (calls [][]byte, ok bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		rpc.WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	calls, isBatch, err := splitBatch(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		rpc.WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if !isBatch {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return calls, true
+}
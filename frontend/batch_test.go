@@ -0,0 +1,116 @@
+package frontend
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/alpacahq/marketstore/utils/rpc/msgpack2"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestBatch(c *C) {
+	serv, _ := NewServer()
+
+	post := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/rpc", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		serv.ServeHTTP(w, req)
+		return w
+	}
+	query := func(key string) interface{} {
+		return &MultiQueryRequest{
+			Requests: []QueryRequest{
+				(NewQueryRequestBuilder(key).
+					EpochStart(0).
+					EpochEnd(math.MaxInt32).
+					LimitRecordCount(10).
+					End()),
+			},
+		}
+	}
+
+	// msgpack batch, answered in order
+	keys := []string{"USDJPY/1Min/OHLC", "EURUSD/1Min/OHLC", "NZDUSD/1Min/OHLC"}
+	methods := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		methods[i] = "DataService.Query"
+		args[i] = query(key)
+	}
+	body, err := msgpack2.EncodeClientBatchRequest(methods, args)
+	c.Assert(err, IsNil)
+	w := post("application/x-msgpack", body)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	responses, err := msgpack2.DecodeClientBatchResponse(w.Body)
+	c.Assert(err, IsNil)
+	c.Assert(len(responses), Equals, len(keys))
+	for i, key := range keys {
+		var response MultiQueryResponse
+		c.Assert(msgpack2.DecodeClientResponse(bytes.NewReader(responses[i]), &response), IsNil)
+		csm, err := response.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		for tbk, cs := range *csm {
+			c.Assert(tbk.GetItemKey(), Equals, key)
+			c.Assert(cs.Len(), Equals, 10)
+		}
+	}
+
+	// a failing call does not fail the others
+	body, err = msgpack2.EncodeClientBatchRequest(
+		[]string{"DataService.NoSuchMethod", "DataService.ListSymbols"},
+		[]interface{}{&ListSymbolsArgs{}, &ListSymbolsArgs{}})
+	c.Assert(err, IsNil)
+	w = post("application/x-msgpack", body)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	responses, err = msgpack2.DecodeClientBatchResponse(w.Body)
+	c.Assert(err, IsNil)
+	c.Assert(len(responses), Equals, 2)
+	var symbols ListSymbolsResponse
+	c.Assert(msgpack2.DecodeClientResponse(bytes.NewReader(responses[0]), &symbols), NotNil)
+	c.Assert(msgpack2.DecodeClientResponse(bytes.NewReader(responses[1]), &symbols), IsNil)
+	c.Assert(len(symbols.Results), Equals, 3)
+
+	// JSON batch, without the response of the notification
+	w = post("application/json", []byte(`[
+		{"jsonrpc": "2.0", "method": "DataService.ListSymbols", "params": {}, "id": 1},
+		{"jsonrpc": "2.0", "method": "DataService.ListSymbols", "params": {}},
+		{"jsonrpc": "2.0", "method": "DataService.ListSymbols", "params": {}, "id": 2}
+	]`))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	var jsonResponses []struct {
+		Id     int
+		Result ListSymbolsResponse
+	}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &jsonResponses), IsNil)
+	c.Assert(len(jsonResponses), Equals, 2)
+	c.Assert(jsonResponses[0].Id, Equals, 1)
+	c.Assert(jsonResponses[1].Id, Equals, 2)
+	c.Assert(len(jsonResponses[1].Result.Results), Equals, 3)
+
+	// single requests are still served as such
+	body, err = msgpack2.EncodeClientRequest("DataService.ListSymbols", &ListSymbolsArgs{})
+	c.Assert(err, IsNil)
+	w = post("application/x-msgpack", body)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	symbols = ListSymbolsResponse{}
+	c.Assert(msgpack2.DecodeClientResponse(w.Body, &symbols), IsNil)
+	c.Assert(len(symbols.Results), Equals, 3)
+
+	// empty and oversized batches
+	w = post("application/json", []byte(`[]`))
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	methods = make([]string, maxBatchSize+1)
+	args = make([]interface{}, maxBatchSize+1)
+	for i := range methods {
+		methods[i] = "DataService.ListSymbols"
+		args[i] = &ListSymbolsArgs{}
+	}
+	body, err = msgpack2.EncodeClientBatchRequest(methods, args)
+	c.Assert(err, IsNil)
+	w = post("application/x-msgpack", body)
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+}
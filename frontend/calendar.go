@@ -0,0 +1,114 @@
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type GetSessionsArgs struct {
+	// Calendar by name, a built-in one or one of the calendars setting
+	Calendar   string `msgpack:"calendar"`
+	EpochStart int64  `msgpack:"epoch_start"`
+	EpochEnd   int64  `msgpack:"epoch_end"`
+}
+
+// SessionInfo is a trading session of a market day, in epoch seconds
+type SessionInfo struct {
+	// Day of the session in the timezone of the calendar, e.g. 2021-08-31
+	Day        string `msgpack:"day"`
+	Open       int64  `msgpack:"open"`
+	Close      int64  `msgpack:"close"`
+	BreakStart int64  `msgpack:"break_start,omitempty"`
+	BreakEnd   int64  `msgpack:"break_end,omitempty"`
+	EarlyClose bool   `msgpack:"early_close,omitempty"`
+}
+
+type GetSessionsResponse struct {
+	Timezone string        `msgpack:"timezone"`
+	Sessions []SessionInfo `msgpack:"sessions"`
+	// Days the market is closed on, besides its weekends, and days it
+	// closes early on, e.g. 2021-11-25
+	Holidays    []string `msgpack:"holidays"`
+	EarlyCloses []string `msgpack:"early_closes"`
+}
+
+// GetSessions returns the sessions, holidays and early closes of the market
+// calendar from the start to the end
+func (s *DataService) GetSessions(r *http.Request, args *GetSessionsArgs, response *GetSessionsResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	cal, err := lookupCalendar(args.Calendar)
+	if err != nil {
+		return err
+	}
+	if args.EpochEnd < args.EpochStart {
+		return fmt.Errorf("epoch_end is before epoch_start")
+	}
+	start, end := time.Unix(args.EpochStart, 0), time.Unix(args.EpochEnd, 0)
+	if end.Sub(start) > 10*366*24*time.Hour {
+		return fmt.Errorf("sessions of more than ten years are not returned at once")
+	}
+	response.Timezone = cal.Tz().String()
+	response.Sessions = []SessionInfo{}
+	for _, session := range cal.Sessions(start, end) {
+		info := SessionInfo{
+			Day:        session.Day.Format("2006-01-02"),
+			Open:       session.Open.Unix(),
+			Close:      session.Close.Unix(),
+			EarlyClose: session.EarlyClose,
+		}
+		if !session.BreakStart.IsZero() {
+			info.BreakStart, info.BreakEnd = session.BreakStart.Unix(), session.BreakEnd.Unix()
+		}
+		response.Sessions = append(response.Sessions, info)
+	}
+	response.Holidays = formatDays(cal.Holidays(start, end))
+	response.EarlyCloses = formatDays(cal.EarlyCloses(start, end))
+	return nil
+}
+
+// lookupCalendar returns the registered market calendar of the name, the
+// paths of calendar files being left out for the clients not to read the
+// files of the server
+func lookupCalendar(name string) (*calendar.Calendar, error) {
+	for _, known := range calendar.Names() {
+		if strings.EqualFold(name, known) {
+			return calendar.Load(known)
+		}
+	}
+	return nil, fmt.Errorf("unknown calendar \"%s\", one of %s", name, strings.Join(calendar.Names(), ", "))
+}
+
+func formatDays(days []time.Time) []string {
+	formatted := make([]string, len(days))
+	for i, day := range days {
+		formatted[i] = day.Format("2006-01-02")
+	}
+	return formatted
+}
+
+// sessionResult leaves out the records of the intraday buckets of the
+// result outside of the sessions of the market calendar, the daily and
+// longer bars being kept
+func sessionResult(csm io.ColumnSeriesMap, name string) error {
+	cal, err := lookupCalendar(name)
+	if err != nil {
+		return err
+	}
+	for tbk, cs := range csm {
+		tf := utils.TimeframeFromString(tbk.GetItemInCategory("Timeframe"))
+		if tf != nil && tf.Duration >= utils.Day {
+			continue
+		}
+		csm[tbk] = cs.ApplyTimeQual(cal.EpochIsMarketOpen)
+	}
+	return nil
+}
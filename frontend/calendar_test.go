@@ -0,0 +1,69 @@
+package frontend
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+func (s *ServerTestSuite) TestSessionQuery(c *C) {
+	service := &DataService{}
+	service.Init()
+	tbk := *io.NewTimeBucketKey("USDJPY/1Min/OHLC")
+	query := func(session string) (*io.ColumnSeries, error) {
+		builder := NewQueryRequestBuilder("USDJPY/1Min/OHLC").LimitRecordCount(2000)
+		if session != "" {
+			builder.Session(session)
+		}
+		var response MultiQueryResponse
+		err := service.Query(nil, &MultiQueryRequest{Requests: []QueryRequest{builder.End()}}, &response)
+		if err != nil {
+			return nil, err
+		}
+		csm, err := response.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		return (*csm)[tbk], nil
+	}
+	raw, err := query("")
+	c.Assert(err, IsNil)
+	all, err := query("crypto")
+	c.Assert(err, IsNil)
+	c.Assert(all.Len(), Equals, raw.Len())
+
+	nyse, err := query("NYSE")
+	c.Assert(err, IsNil)
+	c.Assert(nyse.Len() < raw.Len(), Equals, true)
+	for _, epoch := range nyse.GetEpoch() {
+		c.Assert(calendar.NYSE.EpochIsMarketOpen(epoch), Equals, true)
+	}
+
+	// the files of the server are not read as calendars
+	_, err = query("/etc/passwd")
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerTestSuite) TestGetSessions(c *C) {
+	service := &DataService{}
+	ny, _ := time.LoadLocation("America/New_York")
+	var response GetSessionsResponse
+	c.Assert(service.GetSessions(nil, &GetSessionsArgs{
+		Calendar:   "nyse",
+		EpochStart: time.Date(2021, 11, 22, 0, 0, 0, 0, ny).Unix(),
+		EpochEnd:   time.Date(2021, 11, 28, 0, 0, 0, 0, ny).Unix(),
+	}, &response), IsNil)
+	c.Assert(response.Timezone, Equals, "America/New_York")
+	c.Assert(response.Sessions, HasLen, 4)
+	c.Assert(response.Sessions[0], Equals, SessionInfo{
+		Day:   "2021-11-22",
+		Open:  time.Date(2021, 11, 22, 9, 30, 0, 0, ny).Unix(),
+		Close: time.Date(2021, 11, 22, 16, 0, 0, 0, ny).Unix(),
+	})
+	c.Assert(response.Sessions[3].EarlyClose, Equals, true)
+	c.Assert(response.Holidays, DeepEquals, []string{"2021-11-25"})
+	c.Assert(response.EarlyCloses, DeepEquals, []string{"2021-11-26"})
+
+	c.Assert(service.GetSessions(nil, &GetSessionsArgs{Calendar: "lse"}, &response), NotNil)
+}
@@ -0,0 +1,149 @@
+package frontend
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/limit"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// ranges checksummed by query, to bound the records read at once
+const checksumBatch = 64
+
+// This is the parameter interface for DataService.Checksum method.
+type ChecksumArgs struct {
+	// Key of the bucket, <symbol>/<timeframe>/<attributegroup>
+	Key string `msgpack:"key"`
+	// Range of the records checksummed, inclusive, in unix epoch seconds
+	EpochStart int64 `msgpack:"epoch_start"`
+	EpochEnd   int64 `msgpack:"epoch_end"`
+	// Length in seconds of the ranges checksummed from EpochStart on, a
+	// single range if 0
+	Interval int64 `msgpack:"interval,omitempty"`
+}
+
+// RangeChecksum is the checksum of the records of a range of epochs
+type RangeChecksum struct {
+	EpochStart int64 `msgpack:"epoch_start"`
+	// Inclusive
+	EpochEnd int64  `msgpack:"epoch_end"`
+	Records  int    `msgpack:"records"`
+	Checksum uint64 `msgpack:"checksum"`
+}
+
+type ChecksumResponse struct {
+	// The ranges holding records, in order
+	Ranges []RangeChecksum `msgpack:"ranges"`
+}
+
+// Checksum returns the checksums of the records of the bucket by range of
+// epochs, for instances holding the same records to be verified without
+// reading them.  The checksum is a 64 bit FNV-1a hash of the values of the
+// records in order, their columns sorted by name.
+func (s *DataService) Checksum(r *http.Request, args *ChecksumArgs, response *ChecksumResponse) (err error) {
+	if args == nil {
+		return argsNilError
+	}
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	if err = auth.AuthorizeBucket(r, auth.READ, args.Key); err != nil {
+		return err
+	}
+	if args.EpochEnd < args.EpochStart || args.Interval < 0 {
+		return fmt.Errorf("invalid range %d to %d by %d seconds", args.EpochStart, args.EpochEnd, args.Interval)
+	}
+	release, err := limit.Acquire(r)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer observeDuration("checksum", time.Now())
+
+	interval := args.Interval
+	if interval == 0 {
+		interval = args.EpochEnd - args.EpochStart + 1
+	}
+	for start := args.EpochStart; start <= args.EpochEnd; start += checksumBatch * interval {
+		end := start + checksumBatch*interval - 1
+		if end > args.EpochEnd || end < start {
+			end = args.EpochEnd
+		}
+		csm, err := executeQuery(io.NewTimeBucketKey(args.Key), io.ToSystemTimezone(time.Unix(start, 0)),
+			io.ToSystemTimezone(time.Unix(end, 999999999)), 0, false, nil, 0, planner.DefaultResourceLimits())
+		if err != nil {
+			if errors.Is(err, planner.ErrNoFiles) {
+				continue
+			}
+			return err
+		}
+		for _, cs := range csm {
+			response.Ranges = append(response.Ranges, checksumRanges(cs, start, interval)...)
+		}
+	}
+	return nil
+}
+
+// checksumRanges returns the checksums of the records by range of epochs
+// from the start on.  The strings are hashed by length and bytes, and the
+// validity of the columns having one follows their value.
+func checksumRanges(cs *io.ColumnSeries, start, interval int64) (ranges []RangeChecksum) {
+	shapes := cs.GetDataShapes()
+	sort.Slice(shapes, func(i, j int) bool { return shapes[i].Name < shapes[j].Name })
+	columns := make([][]byte, len(shapes))
+	strs := make([][]string, len(shapes))
+	valid := make([][]bool, len(shapes))
+	for i, shape := range shapes {
+		col := cs.GetByName(shape.Name)
+		if s, ok := col.([]string); ok {
+			strs[i] = s
+		} else {
+			columns[i] = io.CastToByteSlice(col)
+		}
+		valid[i] = cs.GetValidity(shape.Name)
+	}
+
+	epochs := cs.GetEpoch()
+	length := make([]byte, 4)
+	for i := 0; i < len(epochs); {
+		rangeStart := start + (epochs[i]-start)/interval*interval
+		rangeEnd := rangeStart + interval - 1
+		h := fnv.New64a()
+		j := i
+		for ; j < len(epochs) && epochs[j] <= rangeEnd; j++ {
+			for k, shape := range shapes {
+				if strs[k] != nil {
+					binary.LittleEndian.PutUint32(length, uint32(len(strs[k][j])))
+					h.Write(length)
+					h.Write([]byte(strs[k][j]))
+				} else {
+					size := shape.Type.Size()
+					h.Write(columns[k][j*size : (j+1)*size])
+				}
+				if valid[k] != nil {
+					if valid[k][j] {
+						h.Write([]byte{1})
+					} else {
+						h.Write([]byte{0})
+					}
+				}
+			}
+		}
+		ranges = append(ranges, RangeChecksum{
+			EpochStart: rangeStart,
+			EpochEnd:   rangeEnd,
+			Records:    j - i,
+			Checksum:   h.Sum64(),
+		})
+		i = j
+	}
+	return ranges
+}
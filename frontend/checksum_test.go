@@ -0,0 +1,67 @@
+package frontend
+
+import (
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/test"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestChecksum(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	start := test.ParseT("2000-01-01 00:00:00").Unix()
+	args := &ChecksumArgs{Key: "USDJPY/1Min/OHLC", EpochStart: start, EpochEnd: start + 86400 - 1, Interval: 3600}
+	var response ChecksumResponse
+	c.Assert(service.Checksum(nil, args, &response), IsNil)
+	c.Assert(response.Ranges, HasLen, 24)
+	for i, rc := range response.Ranges {
+		c.Assert(rc.EpochStart, Equals, start+int64(i)*3600)
+		c.Assert(rc.EpochEnd, Equals, rc.EpochStart+3600-1)
+		c.Assert(rc.Records, Equals, 60)
+	}
+
+	// the checksum of a range is that of its records
+	hour := &ChecksumArgs{Key: "USDJPY/1Min/OHLC", EpochStart: start + 3600, EpochEnd: start + 7200 - 1}
+	var single ChecksumResponse
+	c.Assert(service.Checksum(nil, hour, &single), IsNil)
+	c.Assert(single.Ranges, DeepEquals, response.Ranges[1:2])
+
+	c.Assert(response.Ranges[0].Checksum, Not(Equals), response.Ranges[1].Checksum)
+
+	// the dummy buckets hold the same records
+	hour.Key = "EURUSD/1Min/OHLC"
+	var other ChecksumResponse
+	c.Assert(service.Checksum(nil, hour, &other), IsNil)
+	c.Assert(other.Ranges, DeepEquals, single.Ranges)
+
+	// empty ranges are left out
+	empty := &ChecksumArgs{Key: "USDJPY/1Min/OHLC", EpochStart: 0, EpochEnd: 86400, Interval: 3600}
+	var none ChecksumResponse
+	c.Assert(service.Checksum(nil, empty, &none), IsNil)
+	c.Assert(none.Ranges, HasLen, 0)
+}
+
+func (s *ServerTestSuite) TestChecksumStrings(c *C) {
+	checksum := func(names []string, valid []bool) uint64 {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{60, 120})
+		cs.AddColumn("Name", names)
+		cs.SetValidity("Name", valid)
+		ranges := checksumRanges(cs, 0, 3600)
+		c.Assert(ranges, HasLen, 1)
+		c.Assert(ranges[0].Records, Equals, 2)
+		return ranges[0].Checksum
+	}
+
+	// the strings are hashed by value
+	sum := checksum([]string{"a", "bc"}, nil)
+	c.Assert(checksum([]string{"a", "bc"}, nil), Equals, sum)
+	c.Assert(checksum([]string{"ab", "c"}, nil), Not(Equals), sum)
+	c.Assert(checksum([]string{"a", "bd"}, nil), Not(Equals), sum)
+
+	// along with their validity
+	c.Assert(checksum([]string{"a", ""}, []bool{true, false}), Not(Equals),
+		checksum([]string{"a", ""}, []bool{true, true}))
+}
@@ -2,10 +2,13 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
+	stdio "io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +23,11 @@ import (
 
 type Client struct {
 	BaseURL string
+	// Sent with every request when the server requires API keys
+	APIKey string
+	// Used for https:// base URLs, e.g. to present a client
+	// certificate or trust a private CA
+	TLSConfig *tls.Config
 }
 
 // NewClient intializes a new MarketStore RPC client
@@ -46,21 +54,110 @@ func (cl *Client) DoRPC(functionName string, args interface{}) (response interfa
 	if err != nil {
 		return nil, err
 	}
+	resp, err := cl.post(message)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Unpack and format the response from the RPC call
+	return decodeResponse(functionName, resp.Body)
+}
+
+// ListBuckets returns the metadata of the buckets whose keys match the glob
+// pattern, such as "*/1Min/OHLCV", or of all of them if empty
+func (cl *Client) ListBuckets(pattern string) ([]frontend.BucketMetadata, error) {
+	message, err := msgpack2.EncodeClientRequest("DataService.ListSymbols",
+		&frontend.ListSymbolsArgs{Metadata: true, Pattern: pattern})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cl.post(message)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	result := &frontend.ListSymbolsResponse{}
+	if err = msgpack2.DecodeClientResponse(resp.Body, result); err != nil {
+		return nil, err
+	}
+	return result.Buckets, nil
+}
+
+// BatchCall is one of the RPC calls of a batch
+type BatchCall struct {
+	FunctionName string
+	Args         interface{}
+}
+
+// BatchResult is the response of a call of a batch, as returned by DoRPC
+// for the call alone
+type BatchResult struct {
+	Response interface{}
+	Err      error
+}
+
+// DoBatchRPC makes the RPC calls in a single request to MarketStore's API,
+// returning their results in the same order
+func (cl *Client) DoBatchRPC(calls []BatchCall) (results []BatchResult, err error) {
+	methods := make([]string, len(calls))
+	args := make([]interface{}, len(calls))
+	for i, call := range calls {
+		if call.Args == nil {
+			return nil, fmt.Errorf("args must be non-nil - have: args: %v\n", call.Args)
+		}
+		methods[i] = "DataService." + call.FunctionName
+		args[i] = call.Args
+	}
+	message, err := msgpack2.EncodeClientBatchRequest(methods, args)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cl.post(message)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responses, err := msgpack2.DecodeClientBatchResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) != len(calls) {
+		return nil, fmt.Errorf("batch of %d calls returned %d responses", len(calls), len(responses))
+	}
+	results = make([]BatchResult, len(calls))
+	for i, call := range calls {
+		results[i].Response, results[i].Err = decodeResponse(call.FunctionName, bytes.NewReader(responses[i]))
+	}
+	return results, nil
+}
+
+// post sends the encoded RPC request, returning an error
+// unless the response has status 200
+func (cl *Client) post(message []byte) (*http.Response, error) {
 	reqURL := cl.BaseURL + "/rpc"
 	req, err := http.NewRequest("POST", reqURL, bytes.NewBuffer(message))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/x-msgpack")
+	req.Header.Set(frontend.APIVersionHeader, strconv.Itoa(frontend.CurrentAPIVersion))
+	if cl.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cl.APIKey)
+	}
 	client := new(http.Client)
+	if cl.TLSConfig != nil {
+		client.Transport = &http.Transport{TLSClientConfig: cl.TLSConfig}
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	// Handle any error in the RPC call
 	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		var errText string
 		if err != nil {
@@ -72,12 +169,15 @@ func (cl *Client) DoRPC(functionName string, args interface{}) (response interfa
 		}
 		return nil, fmt.Errorf("response error (%d): %s", resp.StatusCode, errText)
 	}
+	return resp, nil
+}
 
-	// Unpack and format the response from the RPC call
+// decodeResponse unpacks and formats the response of an RPC call
+func decodeResponse(functionName string, r stdio.Reader) (response interface{}, err error) {
 	switch functionName {
 	case "GetInfo":
 		result := &frontend.MultiGetInfoResponse{}
-		err = msgpack2.DecodeClientResponse(resp.Body, result)
+		err = msgpack2.DecodeClientResponse(r, result)
 		if err != nil {
 			return nil, err
 		}
@@ -85,7 +185,7 @@ func (cl *Client) DoRPC(functionName string, args interface{}) (response interfa
 
 	case "Create", "Destroy":
 		result := &frontend.MultiServerResponse{}
-		err = msgpack2.DecodeClientResponse(resp.Body, result)
+		err = msgpack2.DecodeClientResponse(r, result)
 		if err != nil {
 			return nil, err
 		}
@@ -93,7 +193,7 @@ func (cl *Client) DoRPC(functionName string, args interface{}) (response interfa
 
 	case "Query", "SQLStatement":
 		result := &frontend.MultiQueryResponse{}
-		err = msgpack2.DecodeClientResponse(resp.Body, result)
+		err = msgpack2.DecodeClientResponse(r, result)
 		if err != nil {
 			return nil, err
 		}
@@ -101,11 +201,95 @@ func (cl *Client) DoRPC(functionName string, args interface{}) (response interfa
 		return result.ToColumnSeriesMap()
 	case "ListSymbols":
 		result := &frontend.ListSymbolsResponse{}
-		err = msgpack2.DecodeClientResponse(resp.Body, result)
+		err = msgpack2.DecodeClientResponse(r, result)
 		return result.Results, nil
 	case "Write":
 		result := &frontend.MultiServerResponse{}
-		err = msgpack2.DecodeClientResponse(resp.Body, result)
+		err = msgpack2.DecodeClientResponse(r, result)
+	case "BulkWrite":
+		result := &frontend.BulkWriteResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "GetSchema":
+		result := &frontend.GetSchemaResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "AddCorporateActions", "RemoveCorporateActions":
+		result := &frontend.CorporateActionsResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "GetCorporateActions":
+		result := &frontend.GetCorporateActionsResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "SetIdentifiers", "RemoveIdentifiers":
+		result := &frontend.IdentifiersResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "GetSymbology":
+		result := &frontend.GetSymbologyResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "GetSessions":
+		result := &frontend.GetSessionsResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "GetQualityReport":
+		result := &frontend.GetQualityReportResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "Version":
+		result := &frontend.VersionResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "DestroyPattern", "RenameSymbol", "Trim", "SetTimezone", "SetMetadata", "RenameColumn":
+		result := &frontend.AdminResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "ReloadPlugins":
+		result := &frontend.ReloadPluginsResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case "ReloadConfig":
+		result := &frontend.ReloadConfigResponse{}
+		err = msgpack2.DecodeClientResponse(r, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
 
 	default:
 		return nil, fmt.Errorf("unsupported RPC response")
@@ -141,16 +325,47 @@ func (cl *Client) Subscribe(
 	cancel <-chan struct{},
 	streams ...string) (done <-chan struct{}, err error) {
 
+	return cl.subscribe(handler, cancel, stream.SubscribeMessage{Streams: streams})
+}
+
+// SubscribeFrom is like Subscribe, but the handler first receives all the
+// stored rows of the streams from the since epoch on, then the live data.
+func (cl *Client) SubscribeFrom(
+	handler func(pl stream.Payload) error,
+	cancel <-chan struct{},
+	since int64,
+	streams ...string) (done <-chan struct{}, err error) {
+
+	return cl.subscribe(handler, cancel, stream.SubscribeMessage{Streams: streams, Since: &since})
+}
+
+func (cl *Client) subscribe(
+	handler func(pl stream.Payload) error,
+	cancel <-chan struct{},
+	msg stream.SubscribeMessage) (done <-chan struct{}, err error) {
+
+	streams := msg.Streams
+
 	u, _ := url.Parse(cl.BaseURL + "/ws")
-	u.Scheme = "ws"
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	header := http.Header{}
+	if cl.APIKey != "" {
+		header.Set("Authorization", "Bearer "+cl.APIKey)
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = cl.TLSConfig
+	conn, _, err := dialer.Dial(u.String(), header)
 
 	if err != nil {
 		return nil, err
 	}
 
-	buf, err := msgpack.Marshal(stream.SubscribeMessage{Streams: streams})
+	buf, err := msgpack.Marshal(msg)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,113 @@
+// Package compress implements the gzip compression of the responses of the
+// clients announcing support for it with the Accept-Encoding header, since
+// large query results are otherwise dominated by their transfer time.
+package compress
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Favor throughput, as large responses are compressed on the fly
+const level = gzip.BestSpeed
+
+var writers = sync.Pool{
+	New: func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	},
+}
+
+// Handler compresses the responses of h if the client accepts gzip
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !Accepts(r, "gzip") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &responseWriter{ResponseWriter: w}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// Accepts returns true if the Accept-Encoding header of the request
+// includes the encoding, or else *, without a quality value of 0
+func Accepts(r *http.Request, encoding string) bool {
+	wildcard := false
+	for _, value := range r.Header["Accept-Encoding"] {
+		for _, item := range strings.Split(value, ",") {
+			params := strings.Split(item, ";")
+			name := strings.TrimSpace(params[0])
+			switch {
+			case strings.EqualFold(name, encoding):
+				return acceptable(params[1:])
+			case name == "*":
+				wildcard = acceptable(params[1:])
+			}
+		}
+	}
+	return wildcard
+}
+
+// acceptable returns false if the parameters have a quality value of 0
+func acceptable(params []string) bool {
+	for _, param := range params {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			q, err := strconv.ParseFloat(param[2:], 64)
+			return err == nil && q > 0
+		}
+	}
+	return true
+}
+
+// responseWriter compresses the body, unless the handler already
+// set a Content-Encoding or the status has no body
+type responseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.Header()
+	if header.Get("Content-Encoding") == "" && code != http.StatusNoContent && code != http.StatusNotModified {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = writers.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// detect the content type from the uncompressed body
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *responseWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	writers.Put(w.gz)
+	w.gz = nil
+}
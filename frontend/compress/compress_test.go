@@ -0,0 +1,80 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CompressTestSuite struct{}
+
+var _ = Suite(&CompressTestSuite{})
+
+func (s *CompressTestSuite) TestAccepts(c *C) {
+	for encoding, accepted := range map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"deflate, GZIP":         true,
+		"br;q=1.0, gzip;q=0.5":  true,
+		"gzip;q=0":              false,
+		"*":                     true,
+		"identity, deflate":     false,
+		"gzip;q=invalid, gzip":  false,
+		"zstd, gzip ; q=0.001 ": true,
+		"*;q=0, gzip":           true,
+		"gzip;q=0, *":           false,
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", encoding)
+		c.Assert(Accepts(r, "gzip"), Equals, accepted, Commentf("Accept-Encoding: %s", encoding))
+	}
+}
+
+func (s *CompressTestSuite) TestHandler(c *C) {
+	body := strings.Repeat("marketstore ", 1000)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+
+	get := func(path, encoding string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		if encoding != "" {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/", "gzip")
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Encoding"), Equals, "gzip")
+	c.Assert(w.Header().Get("Vary"), Equals, "Accept-Encoding")
+	c.Assert(strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"), Equals, true)
+	c.Assert(w.Body.Len() < len(body), Equals, true)
+	gz, err := gzip.NewReader(w.Body)
+	c.Assert(err, IsNil)
+	buf, err := ioutil.ReadAll(gz)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, body)
+
+	w = get("/", "")
+	c.Assert(w.Header().Get("Content-Encoding"), Equals, "")
+	c.Assert(w.Body.String(), Equals, body)
+
+	w = get("/empty", "gzip")
+	c.Assert(w.Code, Equals, http.StatusNoContent)
+	c.Assert(w.Header().Get("Content-Encoding"), Equals, "")
+	c.Assert(w.Body.Len(), Equals, 0)
+}
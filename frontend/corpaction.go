@@ -0,0 +1,136 @@
+package frontend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type CorporateActionsArgs struct {
+	Actions []corpaction.Action `msgpack:"actions"`
+}
+
+type CorporateActionsResponse struct {
+	// Number of actions added or removed, the others being already
+	// recorded, or not found
+	Count int `msgpack:"count"`
+}
+
+type GetCorporateActionsArgs struct {
+	// Symbols of the actions, all the symbols if empty
+	Symbols []string `msgpack:"symbols,omitempty"`
+}
+
+type GetCorporateActionsResponse struct {
+	// Actions by symbol, in the order of their ex-date
+	Actions []corpaction.Action `msgpack:"actions"`
+}
+
+// AddCorporateActions records the splits, dividends, symbol changes and
+// mergers of the symbols, by which their queries are adjusted
+func (s *DataService) AddCorporateActions(r *http.Request, args *CorporateActionsArgs, response *CorporateActionsResponse) (err error) {
+	if err = auth.Authorize(r, auth.WRITE); err != nil {
+		return err
+	}
+	if err = authorizeActions(r, auth.WRITE, args.Actions); err != nil {
+		audit.Record(r, audit.ACTIONS, "", 0, err)
+		return err
+	}
+	store, err := corpaction.Instance()
+	if err != nil {
+		return err
+	}
+	response.Count, err = store.Add(args.Actions...)
+	audit.Record(r, audit.ACTIONS, "", response.Count, err)
+	return err
+}
+
+// RemoveCorporateActions deletes the recorded actions equal to those given,
+// such as those recorded by mistake
+func (s *DataService) RemoveCorporateActions(r *http.Request, args *CorporateActionsArgs, response *CorporateActionsResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	if err = authorizeActions(r, auth.ADMIN, args.Actions); err != nil {
+		audit.Record(r, audit.ACTIONS, "", 0, err)
+		return err
+	}
+	store, err := corpaction.Instance()
+	if err != nil {
+		return err
+	}
+	response.Count, err = store.Remove(args.Actions...)
+	audit.Record(r, audit.ACTIONS, "", response.Count, err)
+	return err
+}
+
+// GetCorporateActions returns the recorded actions of the symbols
+func (s *DataService) GetCorporateActions(r *http.Request, args *GetCorporateActionsArgs, response *GetCorporateActionsResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	store, err := corpaction.Instance()
+	if err != nil {
+		return err
+	}
+	symbols := args.Symbols
+	if len(symbols) == 0 {
+		symbols = store.Symbols()
+	}
+	// the key of a namespace reads the actions of its namespace alone
+	namespace := auth.Namespace(r)
+	response.Actions = []corpaction.Action{}
+	for _, symbol := range symbols {
+		if strings.HasPrefix(symbol, namespace) {
+			response.Actions = append(response.Actions, store.Get(symbol)...)
+		}
+	}
+	return nil
+}
+
+// authorizeSymbol checks that the request carries a key with the required
+// permission on every bucket of the symbol, as the corporate actions and
+// the identifiers of a symbol apply to all of its buckets
+func authorizeSymbol(r *http.Request, required auth.Permission, symbol string) error {
+	return auth.AuthorizeBucket(r, required, symbol+"/*/*")
+}
+
+// authorizeActions checks the permission of the request on the symbols of
+// the actions, and on the new symbols of the symbol changes and mergers
+func authorizeActions(r *http.Request, required auth.Permission, actions []corpaction.Action) error {
+	for _, action := range actions {
+		for _, symbol := range []string{action.Symbol, action.NewSymbol} {
+			if symbol == "" {
+				continue
+			}
+			if err := authorizeSymbol(r, required, symbol); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// adjustResult adjusts the prices and volumes of the result for the
+// corporate actions of its symbols
+func adjustResult(csm io.ColumnSeriesMap, adjust string) error {
+	mode, err := corpaction.ParseMode(adjust)
+	if err != nil {
+		return err
+	}
+	store, err := corpaction.Instance()
+	if err != nil {
+		return err
+	}
+	for tbk, cs := range csm {
+		actions := store.Get(tbk.GetItemInCategory("Symbol"))
+		if err = corpaction.Adjust(cs, actions, mode, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package frontend
+
+import (
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+func (s *ServerTestSuite) TestCorporateActions(c *C) {
+	service := &DataService{}
+	service.Init()
+	tbk := *io.NewTimeBucketKey("USDJPY/1Min/OHLC")
+	query := func(adjust string) *io.ColumnSeries {
+		builder := NewQueryRequestBuilder("USDJPY/1Min/OHLC").LimitRecordCount(3)
+		if adjust != "" {
+			builder.Adjust(adjust)
+		}
+		var response MultiQueryResponse
+		err := service.Query(nil, &MultiQueryRequest{Requests: []QueryRequest{builder.End()}}, &response)
+		c.Assert(err, IsNil)
+		csm, err := response.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		return (*csm)[tbk]
+	}
+	raw := query("")
+	epochs := raw.GetEpoch()
+
+	split := corpaction.Action{Symbol: "USDJPY", Kind: corpaction.SPLIT, ExDate: epochs[2], Ratio: 2}
+	actions := &CorporateActionsArgs{Actions: []corpaction.Action{split}}
+	defer service.RemoveCorporateActions(nil, actions, &CorporateActionsResponse{})
+	var response CorporateActionsResponse
+	c.Assert(service.AddCorporateActions(nil, actions, &response), IsNil)
+	c.Assert(response.Count, Equals, 1)
+	var listing GetCorporateActionsResponse
+	c.Assert(service.GetCorporateActions(nil, &GetCorporateActionsArgs{}, &listing), IsNil)
+	c.Assert(listing.Actions, DeepEquals, []corpaction.Action{split})
+
+	// the records before the ex-date are in the terms of the split
+	adjusted := query("split")
+	rawClose := raw.GetByName("Close").([]float32)
+	c.Assert(adjusted.GetByName("Close"), DeepEquals, []float32{rawClose[0] / 2, rawClose[1] / 2, rawClose[2]})
+
+	c.Assert(service.Query(nil, &MultiQueryRequest{Requests: []QueryRequest{
+		NewQueryRequestBuilder("USDJPY/1Min/OHLC").Adjust("total").End(),
+	}}, &MultiQueryResponse{}), NotNil)
+	c.Assert(service.AddCorporateActions(nil, &CorporateActionsArgs{Actions: []corpaction.Action{
+		{Symbol: "USDJPY", Kind: corpaction.SPLIT, ExDate: epochs[2]},
+	}}, &response), NotNil)
+}
+
+func (s *ServerTestSuite) TestCorporateActionsNamespace(c *C) {
+	utils.InstanceConfig.Namespaces = []*utils.NamespaceSetting{{Name: "alpha"}}
+	c.Assert(auth.Initialize([]*utils.APIKeySetting{
+		{Key: "alpha", Permission: "write", Namespace: "alpha"},
+		{Key: "admin", Permission: "admin"},
+	}), IsNil)
+	defer func() {
+		utils.InstanceConfig.Namespaces = nil
+		auth.Initialize(nil)
+	}()
+	service := &DataService{}
+	service.Init()
+
+	own := corpaction.Action{Symbol: "alpha.AAPL", Kind: corpaction.SPLIT, ExDate: 1000000000, Ratio: 2}
+	other := corpaction.Action{Symbol: "AAPL", Kind: corpaction.SPLIT, ExDate: 1000000000, Ratio: 2}
+	defer service.RemoveCorporateActions(nil, &CorporateActionsArgs{Actions: []corpaction.Action{own, other}},
+		&CorporateActionsResponse{})
+
+	r, _ := http.NewRequest("POST", "/rpc", nil)
+	r.Header.Set("X-API-Key", "alpha")
+	var response CorporateActionsResponse
+	c.Assert(service.AddCorporateActions(r, &CorporateActionsArgs{Actions: []corpaction.Action{own}}, &response), IsNil)
+	c.Assert(response.Count, Equals, 1)
+	// the symbols of other namespaces, or of none, are not the key's
+	c.Assert(service.AddCorporateActions(r, &CorporateActionsArgs{Actions: []corpaction.Action{other}}, &response), NotNil)
+	change := corpaction.Action{Symbol: "alpha.AAPL", Kind: corpaction.SYMBOL_CHANGE, ExDate: 1100000000, NewSymbol: "AAPL"}
+	c.Assert(service.AddCorporateActions(r, &CorporateActionsArgs{Actions: []corpaction.Action{change}}, &response), NotNil)
+
+	r.Header.Set("X-API-Key", "admin")
+	c.Assert(service.AddCorporateActions(r, &CorporateActionsArgs{Actions: []corpaction.Action{other}}, &response), IsNil)
+	var listing GetCorporateActionsResponse
+	c.Assert(service.GetCorporateActions(r, &GetCorporateActionsArgs{Symbols: []string{"AAPL", "alpha.AAPL"}}, &listing), IsNil)
+	c.Assert(listing.Actions, HasLen, 2)
+
+	r.Header.Set("X-API-Key", "alpha")
+	listing = GetCorporateActionsResponse{}
+	c.Assert(service.GetCorporateActions(r, &GetCorporateActionsArgs{}, &listing), IsNil)
+	c.Assert(listing.Actions, DeepEquals, []corpaction.Action{own})
+	listing = GetCorporateActionsResponse{}
+	c.Assert(service.GetCorporateActions(r, &GetCorporateActionsArgs{Symbols: []string{"AAPL"}}, &listing), IsNil)
+	c.Assert(listing.Actions, HasLen, 0)
+}
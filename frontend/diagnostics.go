@@ -0,0 +1,58 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// Diagnostics registers the runtime diagnostics endpoints on the mux: the
+// pprof profiles under /debug/pprof/, read by go tool pprof, and the
+// runtime variables on /debug/vars, in the JSON format of expvar.  They are
+// restricted to the admin keys when the API keys are enabled.
+func Diagnostics(mux *http.ServeMux) {
+	mux.Handle("/debug/pprof/", adminOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", adminOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", adminOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", adminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", adminOnly(http.HandlerFunc(pprof.Trace)))
+	mux.Handle("/debug/vars", adminOnly(http.HandlerFunc(vars)))
+}
+
+// adminOnly serves the requests carrying an admin key
+func adminOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if err := auth.Authorize(r, auth.ADMIN); err != nil {
+			http.Error(rw, err.Error(), auth.Status(err))
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// vars writes the variables expvar publishes by default, cmdline and
+// memstats, with those of the server.  The expvar package is not imported,
+// as it serves them on the default mux to any client.
+func vars(rw http.ResponseWriter, r *http.Request) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	err := json.NewEncoder(rw).Encode(map[string]interface{}{
+		"cmdline":    os.Args,
+		"memstats":   memStats,
+		"goroutines": runtime.NumGoroutine(),
+		"version":    utils.Tag,
+		"git_hash":   utils.GitHash,
+		"uptime":     time.Since(utils.InstanceConfig.StartTime).String(),
+	})
+	if err != nil {
+		log.Error("Failed to write diagnostics variables - Error: %v", err)
+	}
+}
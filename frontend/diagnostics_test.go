@@ -0,0 +1,58 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+type DiagnosticsTestSuite struct{}
+
+var _ = Suite(&DiagnosticsTestSuite{})
+
+func (s *DiagnosticsTestSuite) TestDiagnostics(c *C) {
+	auth.Initialize([]*utils.APIKeySetting{
+		{Key: "reader", Permission: "read"},
+		{Key: "admin", Permission: "admin"},
+	})
+	defer auth.Initialize(nil)
+
+	mux := http.NewServeMux()
+	Diagnostics(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path, key string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		return resp
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/vars"} {
+		resp := get(path, "")
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, http.StatusUnauthorized, Commentf(path))
+		resp = get(path, "reader")
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, http.StatusForbidden, Commentf(path))
+		resp = get(path, "admin")
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, http.StatusOK, Commentf(path))
+	}
+
+	resp := get("/debug/vars", "admin")
+	defer resp.Body.Close()
+	var vars map[string]interface{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&vars), IsNil)
+	c.Assert(vars["memstats"], NotNil)
+	c.Assert(vars["cmdline"], NotNil)
+	c.Assert(vars["goroutines"].(float64) > 0, Equals, true)
+}
@@ -0,0 +1,138 @@
+package frontend
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// partitionRemotes splits the symbols of a query between this instance and
+// the remotes holding their bucket of the timeframe and attribute group, by
+// remote name.  The "*" symbol is queried on every remote.
+func partitionRemotes(symbols []string, timeframe, recordFormat string) (local []string, remote map[string][]string) {
+	config := &utils.InstanceConfig
+	if len(config.Remotes) == 0 {
+		return symbols, nil
+	}
+	remote = map[string][]string{}
+	if len(symbols) == 1 && symbols[0] == "*" {
+		for _, rs := range config.Remotes {
+			remote[rs.Name] = symbols
+		}
+		return symbols, remote
+	}
+	for _, symbol := range symbols {
+		rs := config.RemoteOf(symbol + "/" + timeframe + "/" + recordFormat)
+		if rs == nil {
+			local = append(local, symbol)
+			continue
+		}
+		remote[rs.Name] = append(remote[rs.Name], symbol)
+	}
+	return local, remote
+}
+
+// queryRemotes runs the query on the symbols of the remotes at once,
+// returning their merged results, those of the buckets the remote holds and
+// the request may read
+func queryRemotes(r *http.Request, req *QueryRequest, remote map[string][]string,
+	timeframe, recordFormat string) (io.ColumnSeriesMap, error) {
+
+	var queries []instanceQuery
+	for _, rs := range utils.InstanceConfig.Remotes {
+		symbols, ok := remote[rs.Name]
+		if !ok {
+			continue
+		}
+		rs := rs
+		queries = append(queries, instanceQuery{
+			name:    "remote " + rs.Name,
+			url:     rs.URL,
+			apiKey:  rs.APIKey,
+			symbols: symbols,
+			keep: func(tbk io.TimeBucketKey) bool {
+				return heldBy(r, rs, tbk.GetItemKey())
+			},
+		})
+	}
+	return queryInstances(req, queries, timeframe, recordFormat)
+}
+
+// heldBy returns whether the remote holds the bucket, leaving out the
+// buckets the request may not read
+func heldBy(r *http.Request, rs *utils.RemoteSetting, itemKey string) bool {
+	return utils.InstanceConfig.RemoteOf(itemKey) == rs && auth.AuthorizeBucket(r, auth.READ, itemKey) == nil
+}
+
+// locallyHeldSymbols returns the symbols with a bucket in the catalog not held
+// by the remotes, the others being out of the federated listings
+func locallyHeldSymbols() map[string]bool {
+	symbols := map[string]bool{}
+	for _, key := range executor.BucketKeys() {
+		if utils.InstanceConfig.RemoteOf(key) == nil {
+			symbols[strings.SplitN(key, "/", 2)[0]] = true
+		}
+	}
+	return symbols
+}
+
+// listRemotes lists the symbols, or buckets, of the remotes at once, from
+// the buckets they hold and the request may read.  A remote failing to
+// answer is reported in its listing, its symbols being left out.
+func listRemotes(r *http.Request, args *ListSymbolsArgs, pattern glob.Glob) (
+	symbols []string, buckets []BucketMetadata, listings []ShardListing) {
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	// the buckets are listed for the symbols to be those of the buckets held
+	rargs := &ListSymbolsArgs{Metadata: true, Local: true}
+	if args.Metadata {
+		rargs.Pattern = args.Pattern
+	}
+	seen := map[string]bool{}
+	listings = make([]ShardListing, len(utils.InstanceConfig.Remotes))
+	for i, rs := range utils.InstanceConfig.Remotes {
+		listings[i].Name = rs.Name
+		wg.Add(1)
+		go func(rs *utils.RemoteSetting, listing *ShardListing) {
+			defer wg.Done()
+			var response ListSymbolsResponse
+			err := callInstance(rs.URL, rs.APIKey, "ListSymbols", rargs, &response)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				listing.Error = err.Error()
+				return
+			}
+			listing.AsOf = time.Now().Unix()
+			for _, md := range response.Buckets {
+				if !heldBy(r, rs, md.Key) {
+					continue
+				}
+				if args.Metadata {
+					buckets = append(buckets, md)
+					continue
+				}
+				symbol := strings.SplitN(md.Key, "/", 2)[0]
+				if (pattern == nil || pattern.Match(symbol)) && !seen[symbol] {
+					seen[symbol] = true
+					symbols = append(symbols, symbol)
+				}
+			}
+		}(rs, &listings[i])
+	}
+	wg.Wait()
+	sort.Strings(symbols)
+	return symbols, buckets, listings
+}
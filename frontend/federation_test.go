@@ -0,0 +1,118 @@
+package frontend
+
+import (
+	"math"
+	"net/http/httptest"
+	"sort"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/utils"
+)
+
+// remotes sets the remotes of the instance from their yaml setting
+func remotes(c *C, setting string) {
+	var config utils.MktsConfig
+	c.Assert(config.Parse([]byte("root_directory: /data\nlisten_port: 5993\nremotes:\n"+setting)), IsNil)
+	utils.InstanceConfig.Remotes = config.Remotes
+}
+
+func (s *ServerTestSuite) TestQueryRemotes(c *C) {
+	// the remote is this instance, reading its own buckets for the
+	// federating one
+	serv, _ := NewServer()
+	server := httptest.NewServer(serv)
+	defer server.Close()
+
+	remotes(c, `
+  - name: fx
+    url: `+server.URL+`
+    buckets: ["EUR*/1Min/*", "*/1D/*"]
+`)
+	defer func() { utils.InstanceConfig.Remotes = nil }()
+
+	service := &DataService{}
+	service.Init()
+	query := func(destination string) []string {
+		args := &MultiQueryRequest{
+			Requests: []QueryRequest{
+				NewQueryRequestBuilder(destination).
+					EpochStart(0).
+					EpochEnd(math.MaxInt32).
+					LimitRecordCount(10).
+					End(),
+			},
+		}
+		var response MultiQueryResponse
+		c.Assert(service.Query(nil, args, &response), IsNil)
+		csm, err := response.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		var keys []string
+		for tbk, cs := range *csm {
+			c.Assert(cs.Len(), Equals, 10)
+			keys = append(keys, tbk.String())
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	c.Assert(query("USDJPY,EURUSD/1Min/OHLC"), DeepEquals, []string{
+		"EURUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+		"USDJPY/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+	})
+	// remote alone
+	c.Assert(query("USDJPY/1D/OHLC"), DeepEquals, []string{
+		"USDJPY/1D/OHLC:Symbol/Timeframe/AttributeGroup",
+	})
+	c.Assert(query("*/1Min/OHLC"), DeepEquals, []string{
+		"EURUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+		"NZDUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+		"USDJPY/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+	})
+
+	// an unreachable remote fails the query of its buckets alone
+	utils.InstanceConfig.Remotes[0].URL = "http://127.0.0.1:1"
+	c.Assert(query("USDJPY/1Min/OHLC"), HasLen, 1)
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("USDJPY,EURUSD/1Min/OHLC").End()},
+	}
+	c.Assert(service.Query(nil, args, &MultiQueryResponse{}), NotNil)
+}
+
+func (s *ServerTestSuite) TestListSymbolsRemotes(c *C) {
+	serv, _ := NewServer()
+	server := httptest.NewServer(serv)
+	defer server.Close()
+
+	remotes(c, `
+  - name: fx
+    url: `+server.URL+`
+    buckets: ["EURUSD/*/*"]
+`)
+	defer func() { utils.InstanceConfig.Remotes = nil }()
+
+	service := &DataService{}
+	service.Init()
+	var response ListSymbolsResponse
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{Pattern: "*USD"}, &response), IsNil)
+	c.Assert(response.Results, DeepEquals, []string{"EURUSD", "NZDUSD"})
+	c.Assert(response.Remotes, HasLen, 1)
+	c.Assert(response.Remotes[0].Name, Equals, "fx")
+	c.Assert(response.Remotes[0].Error, Equals, "")
+
+	// the buckets held by the remote are those it lists
+	response = ListSymbolsResponse{}
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{Metadata: true, Pattern: "*/1Min/*"}, &response), IsNil)
+	var keys []string
+	for _, md := range response.Buckets {
+		keys = append(keys, md.Key)
+	}
+	c.Assert(keys, DeepEquals, []string{"EURUSD/1Min/OHLC", "NZDUSD/1Min/OHLC", "USDJPY/1Min/OHLC"})
+
+	// a remote failing to answer is reported
+	utils.InstanceConfig.Remotes[0].URL = "http://127.0.0.1:1"
+	response = ListSymbolsResponse{}
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{}, &response), IsNil)
+	c.Assert(response.Results, DeepEquals, []string{"NZDUSD", "USDJPY"})
+	c.Assert(response.Remotes[0].Error, Not(Equals), "")
+}
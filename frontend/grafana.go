@@ -0,0 +1,330 @@
+package frontend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	goio "io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+/*
+	Grafana: The endpoints of the Grafana JSON (SimpleJSON) datasource, with
+	the datasource URL set to http://<host>:<port>/grafana.  A timeserie
+	target is a bucket column such as AAPL/1Min/OHLCV/Close, and a table
+	target the bucket AAPL/1Min/OHLCV with all of its columns.
+
+	GET  /grafana/
+	POST /grafana/search       {"target": "AAPL"}
+	POST /grafana/query        {"range": {...}, "targets": [{"target": "AAPL/1Min/OHLCV/Close"}], "maxDataPoints": 500}
+	POST /grafana/annotations  {"range": {...}, "annotation": {"name": "Events", "query": "AAPL/1D/EVENTS/Text"}}
+*/
+
+type GrafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type GrafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	// "timeserie" (default) or "table"
+	Type string `json:"type"`
+}
+
+type GrafanaQueryRequest struct {
+	Range         GrafanaRange    `json:"range"`
+	Targets       []GrafanaTarget `json:"targets"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+}
+
+// GrafanaTimeSerie has datapoints of [value, epoch in milliseconds]
+type GrafanaTimeSerie struct {
+	Target     string           `json:"target"`
+	Datapoints [][2]interface{} `json:"datapoints"`
+}
+
+type GrafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type GrafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []GrafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type GrafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+type GrafanaAnnotationRequest struct {
+	Range      GrafanaRange `json:"range"`
+	Annotation struct {
+		Name   string `json:"name"`
+		Query  string `json:"query"`
+		Enable bool   `json:"enable"`
+	} `json:"annotation"`
+}
+
+type GrafanaAnnotation struct {
+	Annotation interface{} `json:"annotation"`
+	Time       int64       `json:"time"`
+	Title      string      `json:"title"`
+	Text       string      `json:"text"`
+}
+
+type GrafanaServer struct {
+	*http.ServeMux
+	service *DataService
+}
+
+func NewGrafanaServer(service *DataService) *GrafanaServer {
+	s := &GrafanaServer{
+		ServeMux: http.NewServeMux(),
+		service:  service,
+	}
+	s.HandleFunc("/grafana/", s.testConnection)
+	s.HandleFunc("/grafana/search", s.search)
+	s.HandleFunc("/grafana/query", s.query)
+	s.HandleFunc("/grafana/annotations", s.annotations)
+	return s
+}
+
+// testConnection answers the "Save & Test" of the datasource settings
+func (s *GrafanaServer) testConnection(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/grafana/" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := auth.Authorize(r, auth.READ); err != nil {
+		writeRestError(w, auth.Status(err), err)
+		return
+	}
+	writeRestResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// search returns the targets, one per bucket column and bucket, which
+// contain the requested text
+func (s *GrafanaServer) search(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := auth.Authorize(r, auth.READ); err != nil {
+		writeRestError(w, auth.Status(err), err)
+		return
+	}
+	var req GrafanaSearchRequest
+	if !decodeGrafanaRequest(w, r, &req) {
+		return
+	}
+	targets := []string{}
+	for key, infos := range gatherBuckets() {
+		if auth.AuthorizeBucket(r, auth.READ, key) != nil {
+			continue
+		}
+		candidates := []string{key}
+		for _, ds := range infos[0].GetDataShapes() {
+			candidates = append(candidates, key+"/"+ds.Name)
+		}
+		for _, target := range candidates {
+			if strings.Contains(strings.ToLower(target), strings.ToLower(req.Target)) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	sort.Strings(targets)
+	writeRestResponse(w, http.StatusOK, targets)
+}
+
+func (s *GrafanaServer) query(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req GrafanaQueryRequest
+	if !decodeGrafanaRequest(w, r, &req) {
+		return
+	}
+	results := []interface{}{}
+	for _, target := range req.Targets {
+		if target.Target == "" {
+			continue
+		}
+		key, column, err := grafanaTarget(target.Target, target.Type == "table")
+		if err != nil {
+			writeRestError(w, http.StatusBadRequest, err)
+			return
+		}
+		cs, err := s.queryBucket(r, key, column, req.Range, req.MaxDataPoints)
+		if err != nil {
+			writeRestError(w, restStatus(err), err)
+			return
+		}
+		if target.Type == "table" {
+			results = append(results, newGrafanaTable(key, cs))
+		} else {
+			results = append(results, newGrafanaTimeSerie(target.Target, key, column, cs))
+		}
+	}
+	writeRestResponse(w, http.StatusOK, results)
+}
+
+// annotations returns an annotation for every record of the column
+// of the query, with the value of the column as its text
+func (s *GrafanaServer) annotations(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req GrafanaAnnotationRequest
+	if !decodeGrafanaRequest(w, r, &req) {
+		return
+	}
+	key, column, err := grafanaTarget(req.Annotation.Query, false)
+	if err != nil {
+		writeRestError(w, http.StatusBadRequest, err)
+		return
+	}
+	cs, err := s.queryBucket(r, key, column, req.Range, 0)
+	if err != nil {
+		writeRestError(w, restStatus(err), err)
+		return
+	}
+	annotations := []GrafanaAnnotation{}
+	if cs != nil {
+		bucket := newRestBucket(*io.NewTimeBucketKey(key), cs)
+		epochs := cs.GetEpoch()
+		for _, col := range bucket.Columns {
+			if col.Name != column {
+				continue
+			}
+			for i, value := range col.Values {
+				annotations = append(annotations, GrafanaAnnotation{
+					Annotation: req.Annotation,
+					Time:       epochs[i] * 1000,
+					Title:      req.Annotation.Name,
+					Text:       fmt.Sprint(value),
+				})
+			}
+		}
+	}
+	writeRestResponse(w, http.StatusOK, annotations)
+}
+
+// queryBucket returns the records of the bucket in the range, sampled
+// down to about maxDataPoints if not 0, or nil if the range is empty
+func (s *GrafanaServer) queryBucket(r *http.Request, key, column string, rng GrafanaRange,
+	maxDataPoints int) (*io.ColumnSeries, error) {
+	qb := NewQueryRequestBuilder(key).
+		EpochStart(rng.From.Unix()).
+		EpochEnd(rng.To.Unix())
+	if maxDataPoints > 0 {
+		tbk := io.NewTimeBucketKey(key)
+		if tf := utils.CandleDurationFromString(tbk.GetItemInCategory("Timeframe")).Duration(); tf > 0 {
+			records := int(rng.To.Sub(rng.From) / tf)
+			if interval := (records + maxDataPoints - 1) / maxDataPoints; interval > 1 {
+				qb = qb.SampleInterval(interval)
+			}
+		}
+	}
+	req := qb.End()
+	if column != "" {
+		req.Columns = []string{"Epoch", column}
+	}
+
+	var response MultiQueryResponse
+	if err := s.service.Query(r, &MultiQueryRequest{Requests: []QueryRequest{req}}, &response); err != nil {
+		if errors.Is(err, planner.ErrNoFiles) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, qr := range response.Responses {
+		if qr.Result == nil {
+			continue
+		}
+		csm, err := qr.Result.ToColumnSeriesMap()
+		if err != nil {
+			return nil, err
+		}
+		for _, cs := range csm {
+			return cs, nil
+		}
+	}
+	return nil, nil
+}
+
+// grafanaTarget splits a target into the bucket key and the column,
+// which may be left out for a table
+func grafanaTarget(target string, table bool) (key, column string, err error) {
+	parts := strings.Split(target, "/")
+	switch {
+	case len(parts) == 4:
+		return strings.Join(parts[:3], "/"), parts[3], nil
+	case len(parts) == 3 && table:
+		return target, "", nil
+	}
+	return "", "", fmt.Errorf("target \"%s\" is not in proper format, should be like: AAPL/1Min/OHLCV/Close", target)
+}
+
+func newGrafanaTimeSerie(target, key, column string, cs *io.ColumnSeries) GrafanaTimeSerie {
+	ts := GrafanaTimeSerie{Target: target, Datapoints: [][2]interface{}{}}
+	if cs == nil {
+		return ts
+	}
+	epochs := cs.GetEpoch()
+	for _, col := range newRestBucket(*io.NewTimeBucketKey(key), cs).Columns {
+		if col.Name != column {
+			continue
+		}
+		for i, value := range col.Values {
+			ts.Datapoints = append(ts.Datapoints, [2]interface{}{value, epochs[i] * 1000})
+		}
+	}
+	return ts
+}
+
+// newGrafanaTable returns the records of the bucket, with the Epoch
+// column as the time in milliseconds
+func newGrafanaTable(key string, cs *io.ColumnSeries) GrafanaTable {
+	table := GrafanaTable{Type: "table", Columns: []GrafanaColumn{}, Rows: [][]interface{}{}}
+	if cs == nil {
+		return table
+	}
+	bucket := newRestBucket(*io.NewTimeBucketKey(key), cs)
+	for _, col := range bucket.Columns {
+		typ := "number"
+		if col.Name == "Epoch" {
+			typ = "time"
+		}
+		table.Columns = append(table.Columns, GrafanaColumn{Text: col.Name, Type: typ})
+	}
+	for i := 0; i < cs.Len(); i++ {
+		row := make([]interface{}, len(bucket.Columns))
+		for j, col := range bucket.Columns {
+			row[j] = col.Values[i]
+			if col.Name == "Epoch" {
+				row[j] = col.Values[i].(int64) * 1000
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// decodeGrafanaRequest decodes the JSON body of r, which may be empty
+func decodeGrafanaRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != goio.EOF {
+		writeRestError(w, http.StatusBadRequest, fmt.Errorf("malformed request body: %v", err))
+		return false
+	}
+	return true
+}
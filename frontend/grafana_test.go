@@ -0,0 +1,77 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestGrafana(c *C) {
+	service := &DataService{}
+	service.Init()
+	server := httptest.NewServer(NewGrafanaServer(service))
+	defer server.Close()
+
+	post := func(path, body string, out interface{}) int {
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		c.Assert(err, IsNil)
+		defer resp.Body.Close()
+		c.Assert(json.NewDecoder(resp.Body).Decode(out), IsNil)
+		return resp.StatusCode
+	}
+
+	var status map[string]string
+	resp, err := http.Get(server.URL + "/grafana/")
+	c.Assert(err, IsNil)
+	c.Assert(json.NewDecoder(resp.Body).Decode(&status), IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var targets []string
+	c.Assert(post("/grafana/search", `{"target": "eurusd/1min"}`, &targets), Equals, http.StatusOK)
+	c.Assert(targets, DeepEquals, []string{
+		"EURUSD/1Min/OHLC", "EURUSD/1Min/OHLC/Close", "EURUSD/1Min/OHLC/High",
+		"EURUSD/1Min/OHLC/Low", "EURUSD/1Min/OHLC/Open",
+	})
+
+	rng := `"range": {"from": "2002-12-31T23:50:00.000Z", "to": "2002-12-31T23:59:00.000Z"}`
+	var series []GrafanaTimeSerie
+	c.Assert(post("/grafana/query", `{`+rng+`, "targets": [{"target": "EURUSD/1Min/OHLC/Close", "refId": "A"}]}`,
+		&series), Equals, http.StatusOK)
+	c.Assert(series, HasLen, 1)
+	c.Assert(series[0].Target, Equals, "EURUSD/1Min/OHLC/Close")
+	c.Assert(series[0].Datapoints, HasLen, 10)
+	c.Assert(series[0].Datapoints[9][1], Equals, float64(1041379140000))
+
+	series = nil
+	c.Assert(post("/grafana/query", `{`+rng+`, "maxDataPoints": 5, "targets": [{"target": "EURUSD/1Min/OHLC/Close"}]}`,
+		&series), Equals, http.StatusOK)
+	c.Assert(len(series[0].Datapoints) <= 5, Equals, true)
+
+	var tables []GrafanaTable
+	c.Assert(post("/grafana/query", `{`+rng+`, "targets": [{"target": "EURUSD/1Min/OHLC", "type": "table"}]}`,
+		&tables), Equals, http.StatusOK)
+	c.Assert(tables[0].Type, Equals, "table")
+	c.Assert(tables[0].Columns[0], Equals, GrafanaColumn{Text: "Epoch", Type: "time"})
+	c.Assert(tables[0].Columns, HasLen, 5)
+	c.Assert(tables[0].Rows, HasLen, 10)
+
+	var annotations []GrafanaAnnotation
+	c.Assert(post("/grafana/annotations", `{`+rng+`, "annotation": {"name": "Close", "query": "EURUSD/1Min/OHLC/Close"}}`,
+		&annotations), Equals, http.StatusOK)
+	c.Assert(annotations, HasLen, 10)
+	c.Assert(annotations[0].Title, Equals, "Close")
+	c.Assert(annotations[0].Time, Equals, int64(1041378600000))
+
+	var errResp RestErrorResponse
+	c.Assert(post("/grafana/query", `{`+rng+`, "targets": [{"target": "EURUSD"}]}`, &errResp), Equals, http.StatusBadRequest)
+
+	// an empty range has no datapoints
+	series = nil
+	c.Assert(post("/grafana/query", `{"range": {"from": "1990-01-01T00:00:00Z", "to": "1990-01-02T00:00:00Z"}, "targets": [{"target": "EURUSD/1Min/OHLC/Close"}]}`,
+		&series), Equals, http.StatusOK)
+	c.Assert(series[0].Datapoints, HasLen, 0)
+}
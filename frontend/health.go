@@ -0,0 +1,126 @@
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// HealthCheck is the result of one of the checks of the health endpoints
+type HealthCheck struct {
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type HealthMessage struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// Healthz is the liveness probe, failing if the WAL
+// can no longer be written and the server must be restarted
+func Healthz(rw http.ResponseWriter, r *http.Request) {
+	if starting(rw) {
+		return
+	}
+	writeHealth(rw, map[string]HealthCheck{
+		"wal": checkWAL(),
+	})
+}
+
+// Readyz is the readiness probe, failing while the server can not serve
+// queries, or when the WAL, disk space or background workers are unhealthy
+func Readyz(rw http.ResponseWriter, r *http.Request) {
+	if starting(rw) {
+		return
+	}
+	queryable := HealthCheck{Healthy: atomic.LoadUint32(&Queryable) > 0}
+	if !queryable.Healthy {
+		queryable.Detail = "not queryable"
+	}
+	writeHealth(rw, map[string]HealthCheck{
+		"queryable": queryable,
+		"wal":       checkWAL(),
+		"disk":      checkDisk(),
+		"bgworkers": checkBgWorkers(),
+	})
+}
+
+func writeHealth(rw http.ResponseWriter, checks map[string]HealthCheck) {
+	msg := HealthMessage{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.Healthy {
+			msg.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(msg); err != nil {
+		log.Error("Failed to write health message - Error: %v", err)
+	}
+}
+
+func checkWAL() HealthCheck {
+	instance := executor.ThisInstance
+	if instance == nil {
+		return HealthCheck{Detail: "not initialized"}
+	}
+	if instance.WALBypass {
+		return HealthCheck{Healthy: true, Detail: "bypassed"}
+	}
+	if instance.WALFile == nil {
+		return HealthCheck{Detail: "WAL file is not open"}
+	}
+	if err := instance.WALFile.Healthy(); err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	return HealthCheck{Healthy: true}
+}
+
+// checkDisk reports the free space of the root directory, failing
+// if it is below the configured minimum
+func checkDisk() HealthCheck {
+	instance := executor.ThisInstance
+	if instance == nil {
+		return HealthCheck{Detail: "not initialized"}
+	}
+	free, err := executor.DiskFree(instance.RootDir)
+	if err != nil {
+		return HealthCheck{Detail: fmt.Sprintf("unable to stat %s: %v", instance.RootDir, err)}
+	}
+	check := HealthCheck{
+		Healthy: free >= utils.InstanceConfig.MinFreeDiskSpace,
+		Detail:  fmt.Sprintf("%d bytes free", free),
+	}
+	if !check.Healthy {
+		check.Detail += fmt.Sprintf(", less than min_free_disk_space of %d", utils.InstanceConfig.MinFreeDiskSpace)
+	}
+	if executor.ReadOnly() {
+		check.Detail += ", writes rejected"
+	}
+	return check
+}
+
+func checkBgWorkers() HealthCheck {
+	var stopped []string
+	for name, running := range bgworker.Running() {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	if len(stopped) > 0 {
+		sort.Strings(stopped)
+		return HealthCheck{Detail: "stopped: " + strings.Join(stopped, ", ")}
+	}
+	return HealthCheck{Healthy: true}
+}
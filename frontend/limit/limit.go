@@ -0,0 +1,178 @@
+// Package limit implements per client request rate limits and caps on the
+// number of concurrent queries, so that a single client can not saturate the
+// server for everyone else.  Clients are identified by their API key when it
+// is a known one, and otherwise by their IP address.  Requests over a limit
+// are rejected right away with status 429 for the client to back off.
+package limit
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+var (
+	RateLimitedError = errors.New("Too many requests, retry later")
+	TooManyQueries   = errors.New("Too many concurrent queries, retry later")
+
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	maxQueries int
+	clients    = map[string]*client{}
+	// replaced by the tests
+	now = time.Now
+)
+
+// idle clients are forgotten once there are more than this many
+const maxClients = 10000
+
+// client holds the token bucket and the running queries of a client
+type client struct {
+	tokens  float64
+	updated time.Time
+	queries int
+}
+
+// Initialize sets the limits, replacing any previous ones.  The rate is
+// in requests per second, with bursts of up to burst requests, which
+// defaults to the rate rounded up.  Zero disables a limit.
+func Initialize(requestsPerSecond float64, requestBurst, concurrentQueries int) {
+	mu.Lock()
+	defer mu.Unlock()
+	setLimits(requestsPerSecond, requestBurst, concurrentQueries)
+	clients = map[string]*client{}
+}
+
+// Update sets the limits like Initialize, but keeps the tokens and running
+// queries of the clients, for the limits to change while they are served
+func Update(requestsPerSecond float64, requestBurst, concurrentQueries int) {
+	mu.Lock()
+	defer mu.Unlock()
+	setLimits(requestsPerSecond, requestBurst, concurrentQueries)
+	for _, c := range clients {
+		c.tokens = math.Min(c.tokens, burst)
+	}
+}
+
+// setLimits must be called with mu held.
+func setLimits(requestsPerSecond float64, requestBurst, concurrentQueries int) {
+	rate = requestsPerSecond
+	burst = float64(requestBurst)
+	if burst == 0 {
+		burst = math.Ceil(rate)
+	}
+	maxQueries = concurrentQueries
+	if rate > 0 || maxQueries > 0 {
+		log.Info("client limits enabled: %v requests per second, %v concurrent queries", rate, maxQueries)
+	}
+}
+
+// Allow takes a token from the bucket of the client making the request
+func Allow(r *http.Request) error {
+	if r == nil {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if rate <= 0 {
+		return nil
+	}
+	c := lookup(ClientID(r))
+	t := now()
+	c.tokens = math.Min(burst, c.tokens+t.Sub(c.updated).Seconds()*rate)
+	c.updated = t
+	if c.tokens < 1 {
+		return RateLimitedError
+	}
+	c.tokens--
+	return nil
+}
+
+// Acquire reserves one of the concurrent queries of the client making the
+// request.  The returned function releases it and must be called when the
+// query is done.  A nil request is an in-process call and is not limited.
+func Acquire(r *http.Request) (release func(), err error) {
+	if r == nil {
+		return func() {}, nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxQueries <= 0 {
+		return func() {}, nil
+	}
+	c := lookup(ClientID(r))
+	if c.queries >= maxQueries {
+		return nil, TooManyQueries
+	}
+	c.queries++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			c.queries--
+		})
+	}, nil
+}
+
+// Handler rejects the requests of clients over their rate limit
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := Allow(r); err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Limited returns true if the error is due to a client limit
+func Limited(err error) bool {
+	return err == RateLimitedError || err == TooManyQueries
+}
+
+// ClientID identifies the client making the request by its API key,
+// if it is a known one, or else by its IP address
+func ClientID(r *http.Request) string {
+	if auth.Enabled() && auth.Authorize(r, auth.NONE) == nil {
+		return "key:" + auth.KeyFromRequest(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// lookup returns the client with the id, adding it with a full bucket
+// if it is a new one.  Must be called with mu held.
+func lookup(id string) *client {
+	if c, ok := clients[id]; ok {
+		return c
+	}
+	if len(clients) >= maxClients {
+		forgetIdle()
+	}
+	c := &client{tokens: burst, updated: now()}
+	clients[id] = c
+	return c
+}
+
+// forgetIdle removes the clients with a full bucket and no running
+// queries, which are the same as new ones.  Must be called with mu held.
+func forgetIdle() {
+	t := now()
+	for id, c := range clients {
+		if c.queries == 0 && (rate <= 0 || c.tokens+t.Sub(c.updated).Seconds()*rate >= burst) {
+			delete(clients, id)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type LimitTestSuite struct {
+	clock time.Time
+}
+
+var _ = Suite(&LimitTestSuite{})
+
+func (s *LimitTestSuite) SetUpTest(c *C) {
+	s.clock = time.Unix(1500000000, 0)
+	now = func() time.Time { return s.clock }
+}
+
+func (s *LimitTestSuite) TearDownTest(c *C) {
+	now = time.Now
+	Initialize(0, 0, 0)
+	auth.Initialize(nil)
+}
+
+func request(remoteAddr, key string) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = remoteAddr
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	return r
+}
+
+func (s *LimitTestSuite) TestAllow(c *C) {
+	r := request("10.0.0.1:1234", "")
+
+	// unlimited by default
+	for i := 0; i < 100; i++ {
+		c.Assert(Allow(r), IsNil)
+	}
+
+	Initialize(2, 0, 0)
+	c.Assert(Allow(r), IsNil)
+	c.Assert(Allow(r), IsNil)
+	c.Assert(Allow(r), Equals, RateLimitedError)
+
+	// other clients have their own bucket
+	c.Assert(Allow(request("10.0.0.2:1234", "")), IsNil)
+	c.Assert(Allow(nil), IsNil)
+
+	// tokens are refilled at the rate
+	s.clock = s.clock.Add(500 * time.Millisecond)
+	c.Assert(Allow(r), IsNil)
+	c.Assert(Allow(r), Equals, RateLimitedError)
+
+	// up to the burst
+	s.clock = s.clock.Add(time.Hour)
+	Initialize(1, 3, 0)
+	for i := 0; i < 3; i++ {
+		c.Assert(Allow(r), IsNil)
+	}
+	c.Assert(Allow(r), Equals, RateLimitedError)
+}
+
+func (s *LimitTestSuite) TestClientID(c *C) {
+	c.Assert(ClientID(request("10.0.0.1:1234", "secret")), Equals, "ip:10.0.0.1")
+
+	auth.Initialize([]*utils.APIKeySetting{{Key: "secret", Permission: "read"}})
+	c.Assert(ClientID(request("10.0.0.1:1234", "secret")), Equals, "key:secret")
+	c.Assert(ClientID(request("10.0.0.2:1234", "secret")), Equals, "key:secret")
+	// unknown keys can not be used to get a fresh bucket
+	c.Assert(ClientID(request("10.0.0.1:1234", "guess")), Equals, "ip:10.0.0.1")
+}
+
+func (s *LimitTestSuite) TestAcquire(c *C) {
+	Initialize(0, 0, 2)
+	r := request("10.0.0.1:1234", "")
+
+	release1, err := Acquire(r)
+	c.Assert(err, IsNil)
+	release2, err := Acquire(r)
+	c.Assert(err, IsNil)
+	_, err = Acquire(r)
+	c.Assert(err, Equals, TooManyQueries)
+	c.Assert(Limited(err), Equals, true)
+
+	_, err = Acquire(request("10.0.0.2:1234", ""))
+	c.Assert(err, IsNil)
+
+	// releasing twice frees a single query
+	release1()
+	release1()
+	release3, err := Acquire(r)
+	c.Assert(err, IsNil)
+	_, err = Acquire(r)
+	c.Assert(err, Equals, TooManyQueries)
+	release2()
+	release3()
+}
+
+func (s *LimitTestSuite) TestUpdate(c *C) {
+	Initialize(0, 0, 1)
+	r := request("10.0.0.1:1234", "")
+	release, err := Acquire(r)
+	c.Assert(err, IsNil)
+
+	// the running queries are kept
+	Update(0, 0, 2)
+	_, err = Acquire(r)
+	c.Assert(err, IsNil)
+	_, err = Acquire(r)
+	c.Assert(err, Equals, TooManyQueries)
+	release()
+
+	// the tokens are capped by the new burst
+	Update(10, 10, 0)
+	r2 := request("10.0.0.2:1234", "")
+	c.Assert(Allow(r2), IsNil)
+	Update(1, 1, 0)
+	c.Assert(Allow(r2), IsNil)
+	c.Assert(Allow(r2), Equals, RateLimitedError)
+}
+
+func (s *LimitTestSuite) TestHandler(c *C) {
+	Initialize(1, 1, 0)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request("10.0.0.1:1234", ""))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, request("10.0.0.1:1234", ""))
+	c.Assert(w.Code, Equals, http.StatusTooManyRequests)
+	c.Assert(w.Header().Get("Retry-After"), Equals, "1")
+}
@@ -0,0 +1,498 @@
+// Package pgwire serves the SQL statements of the Query API over the
+// PostgreSQL wire protocol, so that psql and the BI tools with a Postgres
+// datasource can connect to marketstore.  Only the simple query protocol
+// is supported, with the results in text format.  The API key, if
+// authentication is enabled, is the password of the connection, sent in
+// clear text and so only accepted over SSL, or from the loopback interface.
+package pgwire
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/limit"
+	"github.com/alpacahq/marketstore/frontend/pool"
+	"github.com/alpacahq/marketstore/utils"
+	mio "github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+const (
+	protocolVersion = 196608 // 3.0
+	sslRequest      = 80877103
+	cancelRequest   = 80877102
+	gssencRequest   = 80877104
+
+	// reported to the clients, which check it for the features they use
+	serverVersion = "9.6.0"
+
+	maxMessageLength = 1 << 24
+)
+
+// Type OIDs of the result columns
+const (
+	oidBool    = 16
+	oidInt8    = 20
+	oidInt2    = 21
+	oidInt4    = 23
+	oidText    = 25
+	oidFloat4  = 700
+	oidFloat8  = 701
+	oidNumeric = 1700
+)
+
+// SQLSTATE error codes
+const (
+	codeInvalidAuthorization  = "28000"
+	codeInvalidPassword       = "28P01"
+	codeProtocolViolation     = "08P01"
+	codeFeatureNotSupported   = "0A000"
+	codeInsufficientPrivilege = "42501"
+	codeTooManyConnections    = "53300"
+	codeInternalError         = "XX000"
+)
+
+type Server struct {
+	service *frontend.DataService
+	// the connections are upgraded to SSL on request if set
+	tlsConfig *tls.Config
+}
+
+func NewServer(service *frontend.DataService) *Server {
+	return &Server{service: service}
+}
+
+// ListenAndServe serves the connections on addr, upgraded to SSL on the
+// request of the clients if a setting is given
+func (s *Server) ListenAndServe(addr string, setting *utils.TLSSetting) error {
+	if setting != nil {
+		config, err := frontend.NewTLSConfig(setting)
+		if err != nil {
+			return err
+		}
+		s.tlsConfig = config
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts the connections of l until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			c := &connection{
+				server: s,
+				conn:   conn,
+				r:      bufio.NewReader(conn),
+				w:      bufio.NewWriter(conn),
+			}
+			if err := c.serve(); err != nil && err != io.EOF {
+				log.Error("pgwire connection from %s failed - Error: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+type connection struct {
+	server *Server
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	apiKey string
+	// set once the connection is upgraded to SSL
+	secure bool
+}
+
+func (c *connection) serve() error {
+	if err := c.startup(); err != nil {
+		return err
+	}
+	// after an error in the extended query protocol, the messages
+	// are ignored until the next Sync
+	failed := false
+	for {
+		typ, body, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'Q':
+			c.simpleQuery(strings.TrimRight(string(body), "\x00"))
+			c.readyForQuery()
+		case 'X':
+			return nil
+		case 'S':
+			failed = false
+			c.readyForQuery()
+		case 'H':
+		case 'P', 'B', 'D', 'E', 'C':
+			if !failed {
+				c.errorResponse(codeFeatureNotSupported, "the extended query protocol is not supported, use the simple query protocol")
+				failed = true
+			}
+		default:
+			c.errorResponse(codeProtocolViolation, fmt.Sprintf("unexpected message type %q", typ))
+			c.w.Flush()
+			return fmt.Errorf("unexpected message type %q", typ)
+		}
+		if err = c.w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// isLoopback returns true if the address is that of the loopback interface,
+// whose traffic does not leave the host
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// startup reads the startup message and authenticates the client
+func (c *connection) startup() error {
+	for started := false; !started; {
+		// the startup message has no type
+		body, err := c.readBody()
+		if err != nil {
+			return err
+		}
+		if len(body) < 4 {
+			return errors.New("startup message too short")
+		}
+		switch code := binary.BigEndian.Uint32(body); code {
+		case sslRequest:
+			if c.server.tlsConfig == nil || c.secure {
+				// the client may carry on without SSL
+				if _, err = c.conn.Write([]byte{'N'}); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err = c.conn.Write([]byte{'S'}); err != nil {
+				return err
+			}
+			conn := tls.Server(c.conn, c.server.tlsConfig)
+			if err = conn.Handshake(); err != nil {
+				return err
+			}
+			c.conn, c.r, c.w = conn, bufio.NewReader(conn), bufio.NewWriter(conn)
+			c.secure = true
+		case gssencRequest:
+			// GSSAPI encryption is not supported, the client may carry on without
+			if _, err = c.conn.Write([]byte{'N'}); err != nil {
+				return err
+			}
+		case cancelRequest:
+			return io.EOF
+		case protocolVersion:
+			started = true
+		default:
+			c.errorResponse(codeFeatureNotSupported, fmt.Sprintf("unsupported protocol version %d", code))
+			c.w.Flush()
+			return fmt.Errorf("unsupported protocol version %d", code)
+		}
+	}
+
+	if auth.Enabled() {
+		if !c.secure && !isLoopback(c.conn.RemoteAddr()) {
+			c.errorResponse(codeInvalidAuthorization, "the password is only accepted over SSL")
+			c.w.Flush()
+			return errors.New("password authentication without SSL")
+		}
+		// AuthenticationCleartextPassword
+		c.writeMessage('R', int32(3))
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		typ, body, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if typ != 'p' {
+			return fmt.Errorf("expected a password message, got %q", typ)
+		}
+		c.apiKey = strings.TrimRight(string(body), "\x00")
+		if err = auth.Authorize(c.request(), auth.NONE); err != nil {
+			c.errorResponse(codeInvalidPassword, err.Error())
+			c.w.Flush()
+			return err
+		}
+	}
+
+	// AuthenticationOk
+	c.writeMessage('R', int32(0))
+	for _, param := range [][2]string{
+		{"server_version", serverVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		c.writeMessage('S', param[0], param[1])
+	}
+	c.readyForQuery()
+	return c.w.Flush()
+}
+
+// request returns the request the queries of the connection are made
+// with, for the authorization, limits and audit log of the Query API
+func (c *connection) request() *http.Request {
+	r, _ := http.NewRequest(http.MethodPost, "/pgwire", nil)
+	r.RemoteAddr = c.conn.RemoteAddr().String()
+	if c.apiKey != "" {
+		r.Header.Set("X-API-Key", c.apiKey)
+	}
+	return r
+}
+
+func (c *connection) simpleQuery(query string) {
+	query = strings.TrimSpace(query)
+	for strings.HasSuffix(query, ";") {
+		query = strings.TrimSpace(strings.TrimSuffix(query, ";"))
+	}
+	if query == "" {
+		c.writeMessage('I')
+		return
+	}
+	command := strings.ToUpper(strings.Fields(query)[0])
+	switch command {
+	// session statements the clients send on connect, which have no effect
+	case "SET", "RESET", "DISCARD", "BEGIN", "COMMIT", "ROLLBACK":
+		c.writeMessage('C', command)
+		return
+	}
+
+	r := c.request()
+	if err := limit.Allow(r); err != nil {
+		c.errorResponse(codeTooManyConnections, err.Error())
+		return
+	}
+	release, err := pool.Acquire(context.Background())
+	if err != nil {
+		c.errorResponse(codeTooManyConnections, err.Error())
+		return
+	}
+	defer release()
+	var response frontend.MultiQueryResponse
+	// the statements of the Query API are terminated
+	err = c.server.service.Query(r, &frontend.MultiQueryRequest{
+		Requests: []frontend.QueryRequest{{IsSQLStatement: true, SQLStatement: query + ";"}},
+	}, &response)
+	if err != nil {
+		c.errorResponse(errorCode(err), err.Error())
+		return
+	}
+	var cs *mio.ColumnSeries
+	if len(response.Responses) > 0 && response.Responses[0].Result != nil {
+		csm, err := response.Responses[0].Result.ToColumnSeriesMap()
+		if err != nil {
+			c.errorResponse(codeInternalError, err.Error())
+			return
+		}
+		for _, s := range csm {
+			cs = s
+		}
+	}
+
+	if command == "INSERT" {
+		c.writeMessage('C', "INSERT 0 0")
+		return
+	}
+	c.writeMessage('C', fmt.Sprintf("%s %d", command, c.writeRows(cs)))
+}
+
+// writeRows writes the row description and the rows of cs in text format
+func (c *connection) writeRows(cs *mio.ColumnSeries) int {
+	var (
+		names   []string
+		columns []reflect.Value
+	)
+	if cs != nil {
+		names = cs.GetColumnNames()
+		for _, name := range names {
+			columns = append(columns, reflect.ValueOf(cs.GetColumn(name)))
+		}
+	}
+
+	description := []interface{}{int16(len(names))}
+	for i, name := range names {
+		oid, size := typeOID(columns[i].Type().Elem().Kind())
+		if _, ok := cs.GetScale(name); ok {
+			oid, size = oidNumeric, -1
+		}
+		// table and column, type, size, modifier and text format
+		description = append(description, name, int32(0), int16(0), int32(oid), int16(size), int32(-1), int16(0))
+	}
+	c.writeMessage('T', description...)
+
+	rows := 0
+	if cs != nil {
+		rows = cs.Len()
+	}
+	for i := 0; i < rows; i++ {
+		row := []interface{}{int16(len(columns))}
+		for j, column := range columns {
+			if !cs.IsValid(names[j], i) {
+				// NULL
+				row = append(row, int32(-1))
+				continue
+			}
+			var value string
+			if scale, ok := cs.GetScale(names[j]); ok {
+				value = mio.FormatDecimal(column.Index(i).Int(), scale)
+			} else {
+				value = formatValue(column.Index(i))
+			}
+			row = append(row, int32(len(value)), []byte(value))
+		}
+		c.writeMessage('D', row...)
+	}
+	return rows
+}
+
+// typeOID returns the OID and the size of the Postgres type of a column
+func typeOID(kind reflect.Kind) (oid int, size int) {
+	switch kind {
+	case reflect.Bool:
+		return oidBool, 1
+	case reflect.Int8, reflect.Uint8, reflect.Int16:
+		return oidInt2, 2
+	case reflect.Uint16, reflect.Int32:
+		return oidInt4, 4
+	case reflect.Uint32, reflect.Int64:
+		return oidInt8, 8
+	case reflect.Uint64:
+		return oidNumeric, -1
+	case reflect.Float32:
+		return oidFloat4, 4
+	case reflect.Float64:
+		return oidFloat8, 8
+	}
+	return oidText, -1
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return "t"
+		}
+		return "f"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		bits := 64
+		if v.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return "NaN"
+		case math.IsInf(f, 1):
+			return "Infinity"
+		case math.IsInf(f, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(f, 'g', -1, bits)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func errorCode(err error) string {
+	if limit.Limited(err) {
+		return codeTooManyConnections
+	}
+	switch auth.Status(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return codeInsufficientPrivilege
+	}
+	return codeInternalError
+}
+
+func (c *connection) errorResponse(code, message string) {
+	c.writeMessage('E',
+		byte('S'), "ERROR",
+		byte('V'), "ERROR",
+		byte('C'), code,
+		byte('M'), message,
+		byte(0))
+}
+
+func (c *connection) readyForQuery() {
+	c.writeMessage('Z', byte('I'))
+}
+
+// writeMessage buffers a message with the fields, strings
+// being null terminated and integers in network byte order
+func (c *connection) writeMessage(typ byte, fields ...interface{}) {
+	var body []byte
+	for _, field := range fields {
+		switch v := field.(type) {
+		case string:
+			body = append(append(body, v...), 0)
+		case []byte:
+			body = append(body, v...)
+		case byte:
+			body = append(body, v)
+		case int16:
+			body = append(body, byte(v>>8), byte(v))
+		case int32:
+			body = append(body, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	c.w.WriteByte(typ)
+	c.w.Write([]byte{
+		byte((len(body) + 4) >> 24), byte((len(body) + 4) >> 16),
+		byte((len(body) + 4) >> 8), byte(len(body) + 4)})
+	c.w.Write(body)
+}
+
+func (c *connection) readMessage() (typ byte, body []byte, err error) {
+	if typ, err = c.r.ReadByte(); err != nil {
+		return 0, nil, err
+	}
+	body, err = c.readBody()
+	return typ, body, err
+}
+
+func (c *connection) readBody() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint32(header[:]))
+	if length < 4 || length > maxMessageLength {
+		return nil, fmt.Errorf("invalid message length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,255 @@
+package pgwire
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/test"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type PGWireTestSuite struct {
+	Rootdir string
+	addr    string
+	service *frontend.DataService
+}
+
+var _ = Suite(&PGWireTestSuite{})
+
+func (s *PGWireTestSuite) SetUpSuite(c *C) {
+	s.Rootdir = c.MkDir()
+	test.MakeDummyCurrencyDir(s.Rootdir, true, false)
+	executor.NewInstanceSetup(s.Rootdir, true, true, false, false)
+	atomic.StoreUint32(&frontend.Queryable, uint32(1))
+
+	s.service = &frontend.DataService{}
+	s.service.Init()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.addr = l.Addr().String()
+	go NewServer(s.service).Serve(l)
+}
+
+func (s *PGWireTestSuite) TearDownSuite(c *C) {
+	test.CleanupDummyDataDir(s.Rootdir)
+}
+
+func (s *PGWireTestSuite) TearDownTest(c *C) {
+	auth.Initialize(nil)
+}
+
+type message struct {
+	typ  byte
+	body []byte
+}
+
+// client is a minimal Postgres client speaking the simple query protocol
+type client struct {
+	c    *C
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (s *PGWireTestSuite) connect(c *C) *client {
+	conn, err := net.Dial("tcp", s.addr)
+	c.Assert(err, IsNil)
+	cl := &client{c: c, conn: conn, r: bufio.NewReader(conn)}
+
+	// clients ask for SSL first
+	cl.send(0, []byte{0x04, 0xd2, 0x16, 0x2f})
+	b, err := cl.r.ReadByte()
+	c.Assert(err, IsNil)
+	c.Assert(b, Equals, byte('N'))
+
+	startup := []byte{0, 3, 0, 0}
+	startup = append(startup, "user\x00test\x00database\x00marketstore\x00\x00"...)
+	cl.send(0, startup)
+	return cl
+}
+
+func (cl *client) send(typ byte, body []byte) {
+	var msg []byte
+	if typ != 0 {
+		msg = append(msg, typ)
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(body)+4))
+	msg = append(append(msg, length...), body...)
+	_, err := cl.conn.Write(msg)
+	cl.c.Assert(err, IsNil)
+}
+
+func (cl *client) receive() message {
+	typ, err := cl.r.ReadByte()
+	cl.c.Assert(err, IsNil)
+	length := make([]byte, 4)
+	_, err = io.ReadFull(cl.r, length)
+	cl.c.Assert(err, IsNil)
+	body := make([]byte, binary.BigEndian.Uint32(length)-4)
+	_, err = io.ReadFull(cl.r, body)
+	cl.c.Assert(err, IsNil)
+	return message{typ, body}
+}
+
+// receiveUntilReady returns the messages up to ReadyForQuery
+func (cl *client) receiveUntilReady() (messages []message) {
+	for {
+		msg := cl.receive()
+		if msg.typ == 'Z' {
+			return messages
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func (cl *client) query(sql string) []message {
+	cl.send('Q', append([]byte(sql), 0))
+	return cl.receiveUntilReady()
+}
+
+func (s *PGWireTestSuite) TestQuery(c *C) {
+	cl := s.connect(c)
+	defer cl.conn.Close()
+	msgs := cl.receiveUntilReady()
+	c.Assert(msgs[0].typ, Equals, byte('R'))
+	c.Assert(msgs[0].body, DeepEquals, []byte{0, 0, 0, 0})
+
+	msgs = cl.query("SET datestyle TO 'ISO';")
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(string(msgs[0].body), Equals, "SET\x00")
+
+	msgs = cl.query("SELECT Epoch, Open FROM `EURUSD/1Min/OHLC` LIMIT 2;")
+	c.Assert(msgs, HasLen, 4)
+	c.Assert(msgs[0].typ, Equals, byte('T'))
+	c.Assert(binary.BigEndian.Uint16(msgs[0].body), Equals, uint16(2))
+	c.Assert(strings.HasPrefix(string(msgs[0].body[2:]), "Epoch\x00"), Equals, true)
+	c.Assert(msgs[1].typ, Equals, byte('D'))
+	c.Assert(binary.BigEndian.Uint16(msgs[1].body), Equals, uint16(2))
+	c.Assert(msgs[3].typ, Equals, byte('C'))
+	c.Assert(string(msgs[3].body), Equals, "SELECT 2\x00")
+
+	msgs = cl.query("SELECT * FROM `NOSUCH/1Min/OHLC`")
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].typ, Equals, byte('E'))
+
+	msgs = cl.query("")
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].typ, Equals, byte('I'))
+
+	// the extended query protocol fails until the next Sync
+	cl.send('P', []byte("\x00SELECT 1\x00\x00\x00"))
+	cl.send('B', []byte("\x00\x00\x00\x00\x00\x00\x00\x00"))
+	cl.send('S', nil)
+	msgs = cl.receiveUntilReady()
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].typ, Equals, byte('E'))
+	c.Assert(strings.Contains(string(msgs[0].body), "0A000"), Equals, true)
+
+	cl.send('X', nil)
+}
+
+func (s *PGWireTestSuite) TestPassword(c *C) {
+	auth.Initialize([]*utils.APIKeySetting{{Key: "secret", Permission: "read"}})
+
+	cl := s.connect(c)
+	defer cl.conn.Close()
+	msg := cl.receive()
+	c.Assert(msg.typ, Equals, byte('R'))
+	c.Assert(msg.body, DeepEquals, []byte{0, 0, 0, 3})
+	cl.send('p', []byte("secret\x00"))
+	msgs := cl.receiveUntilReady()
+	c.Assert(msgs[0].body, DeepEquals, []byte{0, 0, 0, 0})
+	msgs = cl.query("SELECT Epoch FROM `EURUSD/1Min/OHLC` LIMIT 1")
+	c.Assert(msgs[len(msgs)-1].typ, Equals, byte('C'))
+
+	cl = s.connect(c)
+	defer cl.conn.Close()
+	cl.receive()
+	cl.send('p', []byte("wrong\x00"))
+	msg = cl.receive()
+	c.Assert(msg.typ, Equals, byte('E'))
+	c.Assert(strings.Contains(string(msg.body), "28P01"), Equals, true)
+}
+
+func (s *PGWireTestSuite) TestPasswordWithoutSSL(c *C) {
+	auth.Initialize([]*utils.APIKeySetting{{Key: "secret", Permission: "read"}})
+
+	// the pipe is not a loopback connection
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go func() {
+		defer server.Close()
+		(&connection{
+			server: NewServer(s.service),
+			conn:   server,
+			r:      bufio.NewReader(server),
+			w:      bufio.NewWriter(server),
+		}).serve()
+	}()
+	cl := &client{c: c, conn: conn, r: bufio.NewReader(conn)}
+	cl.send(0, []byte("\x00\x03\x00\x00user\x00test\x00\x00"))
+	msg := cl.receive()
+	c.Assert(msg.typ, Equals, byte('E'))
+	c.Assert(strings.Contains(string(msg.body), "28000"), Equals, true)
+}
+
+func (s *PGWireTestSuite) TestSSL(c *C) {
+	server := NewServer(s.service)
+	server.tlsConfig = &tls.Config{Certificates: []tls.Certificate{selfSigned(c)}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	go server.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	cl := &client{c: c, conn: conn, r: bufio.NewReader(conn)}
+	cl.send(0, []byte{0x04, 0xd2, 0x16, 0x2f})
+	b, err := cl.r.ReadByte()
+	c.Assert(err, IsNil)
+	c.Assert(b, Equals, byte('S'))
+
+	secure := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	c.Assert(secure.Handshake(), IsNil)
+	cl.conn, cl.r = secure, bufio.NewReader(secure)
+	cl.send(0, []byte("\x00\x03\x00\x00user\x00test\x00\x00"))
+	cl.receiveUntilReady()
+	msgs := cl.query("SELECT Epoch FROM `EURUSD/1Min/OHLC` LIMIT 1")
+	c.Assert(msgs[len(msgs)-1].typ, Equals, byte('C'))
+}
+
+// selfSigned returns a throwaway certificate for 127.0.0.1
+func selfSigned(c *C) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
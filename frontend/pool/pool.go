@@ -0,0 +1,111 @@
+// Package pool caps the number of requests the API serves at once with a
+// fixed number of workers.  Requests arriving while every worker is busy
+// wait in a bounded queue for the next free one, and are rejected right
+// away with status 503 once the queue is full, so that a storm of queries
+// slows the server down instead of exhausting its memory.
+package pool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+var (
+	OverloadedError = errors.New("Server overloaded, retry later")
+
+	mu sync.RWMutex
+	// one element per busy worker and per waiting request
+	workers, queue chan struct{}
+
+	rejected = stats.NewCounter("marketstore_pool_rejected_total",
+		"Number of requests rejected because every worker was busy and the queue full")
+)
+
+func init() {
+	stats.NewGaugeFunc("marketstore_pool_busy_workers", "Number of workers serving a request",
+		func() float64 { busy, _ := Stats(); return float64(busy) })
+	stats.NewGaugeFunc("marketstore_pool_queued_requests", "Number of requests waiting for a worker",
+		func() float64 { _, queued := Stats(); return float64(queued) })
+}
+
+// Initialize sets the number of workers and the depth of the queue, replacing
+// any previous ones.  Zero workers disables the pool, serving every request
+// right away.  The requests served by the previous pool are not counted
+// against this one.
+func Initialize(numWorkers, queueDepth int) {
+	mu.Lock()
+	defer mu.Unlock()
+	workers, queue = nil, nil
+	if numWorkers > 0 {
+		workers = make(chan struct{}, numWorkers)
+		queue = make(chan struct{}, queueDepth)
+		log.Info("worker pool enabled: %v workers, queue depth %v", numWorkers, queueDepth)
+	}
+}
+
+// Acquire takes a worker, waiting in the queue for one to be free until the
+// context is done.  The returned function frees the worker and must be
+// called when the request is served.
+func Acquire(ctx context.Context) (release func(), err error) {
+	mu.RLock()
+	w, q := workers, queue
+	mu.RUnlock()
+	if w == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case w <- struct{}{}:
+		return releaser(w), nil
+	default:
+	}
+	select {
+	case q <- struct{}{}:
+	default:
+		rejected.Inc()
+		return nil, OverloadedError
+	}
+	defer func() { <-q }()
+	select {
+	case w <- struct{}{}:
+		return releaser(w), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func releaser(w chan struct{}) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-w })
+	}
+}
+
+// Stats returns the number of busy workers and of waiting requests
+func Stats() (busy, queued int) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(workers), len(queue)
+}
+
+// Handler serves the requests on the workers of the pool
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := Acquire(r.Context())
+		if err != nil {
+			if err == OverloadedError {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			}
+			// otherwise the client is gone
+			return
+		}
+		defer release()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package pool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type PoolTestSuite struct{}
+
+var _ = Suite(&PoolTestSuite{})
+
+func (s *PoolTestSuite) TearDownTest(c *C) {
+	Initialize(0, 0)
+}
+
+func (s *PoolTestSuite) TestAcquire(c *C) {
+	// unlimited by default
+	for i := 0; i < 100; i++ {
+		_, err := Acquire(context.Background())
+		c.Assert(err, IsNil)
+	}
+
+	Initialize(2, 1)
+	release1, err := Acquire(context.Background())
+	c.Assert(err, IsNil)
+	release2, err := Acquire(context.Background())
+	c.Assert(err, IsNil)
+	busy, queued := Stats()
+	c.Assert(busy, Equals, 2)
+	c.Assert(queued, Equals, 0)
+
+	// the third request waits for a worker
+	acquired := make(chan func())
+	go func() {
+		release, err := Acquire(context.Background())
+		c.Check(err, IsNil)
+		acquired <- release
+	}()
+	for _, queued = Stats(); queued == 0; _, queued = Stats() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	_, err = Acquire(context.Background())
+	c.Assert(err, Equals, OverloadedError)
+
+	release1()
+	release1()
+	release3 := <-acquired
+	busy, queued = Stats()
+	c.Assert(busy, Equals, 2)
+	c.Assert(queued, Equals, 0)
+
+	// waiting ends with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = Acquire(ctx)
+	c.Assert(err, Equals, context.DeadlineExceeded)
+	_, queued = Stats()
+	c.Assert(queued, Equals, 0)
+
+	release2()
+	release3()
+	busy, _ = Stats()
+	c.Assert(busy, Equals, 0)
+}
+
+func (s *PoolTestSuite) TestHandler(c *C) {
+	Initialize(1, 0)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	c.Assert(w.Code, Equals, http.StatusNoContent)
+
+	release, err := Acquire(context.Background())
+	c.Assert(err, IsNil)
+	defer release()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Header().Get("Retry-After"), Equals, "1")
+}
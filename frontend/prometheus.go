@@ -0,0 +1,314 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/prompb"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/golang/protobuf/proto"
+	"github.com/klauspost/compress/snappy"
+)
+
+/*
+	Prometheus remote storage: remote_write stores the samples of each series
+	in the bucket <symbol>/1Sec/<metric name> with a float64 Value column and
+	the milliseconds of their timestamp in an int32 Nanoseconds column, the
+	symbol being the value of the "symbol" label, or the metric name if the
+	series has none.  The series with other labels are rejected, as they
+	could not be told apart.  remote_read serves these buckets back with the
+	__name__ and symbol labels.
+
+	POST /prometheus/write
+	POST /prometheus/read
+*/
+
+const (
+	prometheusTimeframe = "1Sec"
+	prometheusColumn    = "Value"
+	prometheusNanos     = "Nanoseconds"
+	symbolLabel         = "symbol"
+	nameLabel           = "__name__"
+
+	maxPrometheusRequestSize = 32 << 20
+)
+
+// PrometheusWrite implements the Prometheus remote_write protocol
+func PrometheusWrite(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := auth.Authorize(r, auth.WRITE); err != nil {
+		http.Error(w, err.Error(), auth.Status(err))
+		return
+	}
+	var req prompb.WriteRequest
+	if err := readPrometheusRequest(w, r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type series struct {
+		epochs []int64
+		nanos  []int32
+		values []float64
+	}
+	buckets := map[io.TimeBucketKey]*series{}
+	for _, ts := range req.Timeseries {
+		labels := labelMap(ts.Labels)
+		itemKey, err := prometheusItemKey(labels)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tbk := *io.NewTimeBucketKey(itemKey)
+		s, ok := buckets[tbk]
+		if !ok {
+			s = &series{}
+			buckets[tbk] = s
+		}
+		for _, sample := range ts.Samples {
+			epoch := floorDiv(sample.Timestamp, 1000)
+			s.epochs = append(s.epochs, epoch)
+			s.nanos = append(s.nanos, int32(sample.Timestamp-epoch*1000)*1e6)
+			s.values = append(s.values, sample.Value)
+		}
+	}
+
+	csm := io.NewColumnSeriesMap()
+	for tbk, s := range buckets {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", s.epochs)
+		cs.AddColumn(prometheusColumn, s.values)
+		cs.AddColumn(prometheusNanos, s.nanos)
+		csm.AddColumnSeries(tbk, cs)
+	}
+	if err := authorizeWrite(r, csm); err != nil {
+		recordWrite(r, csm, err)
+		http.Error(w, err.Error(), auth.Status(err))
+		return
+	}
+	err := executor.WriteCSM(csm, false)
+	recordWrite(r, csm, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PrometheusRead implements the Prometheus remote_read protocol, answering
+// with the samples response type that every Prometheus version accepts
+func PrometheusRead(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := auth.Authorize(r, auth.READ); err != nil {
+		http.Error(w, err.Error(), auth.Status(err))
+		return
+	}
+	var req prompb.ReadRequest
+	if err := readPrometheusRequest(w, r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp prompb.ReadResponse
+	for _, query := range req.Queries {
+		result, err := prometheusQuery(r, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	buf, err := proto.Marshal(&resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	if _, err = w.Write(snappy.Encode(nil, buf)); err != nil {
+		log.Error("Failed to write remote read response - Error: %v", err)
+	}
+}
+
+// readPrometheusRequest decodes the snappy compressed protobuf message of r
+func readPrometheusRequest(w http.ResponseWriter, r *http.Request, msg proto.Message) error {
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPrometheusRequestSize))
+	if err != nil {
+		return err
+	}
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return fmt.Errorf("malformed snappy body: %v", err)
+	}
+	if err = proto.Unmarshal(buf, msg); err != nil {
+		return fmt.Errorf("malformed protobuf body: %v", err)
+	}
+	return nil
+}
+
+// prometheusQuery returns the series of the buckets written by
+// PrometheusWrite which match the query and the request may read
+func prometheusQuery(r *http.Request, query *prompb.Query) (*prompb.QueryResult, error) {
+	matchers := make([]func(labels map[string]string) bool, 0, len(query.Matchers))
+	for _, m := range query.Matchers {
+		matcher, err := labelMatcher(m)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	start := io.ToSystemTimezone(time.Unix(floorDiv(query.StartTimestampMs, 1000), 0))
+	end := io.ToSystemTimezone(time.Unix(floorDiv(query.EndTimestampMs, 1000), 999999999))
+
+	result := &prompb.QueryResult{}
+	buckets := gatherBuckets()
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels, ok := prometheusLabels(key, buckets[key])
+		if !ok || auth.AuthorizeBucket(r, auth.READ, key) != nil {
+			continue
+		}
+		matches := true
+		for _, matcher := range matchers {
+			matches = matches && matcher(labels)
+		}
+		if !matches {
+			continue
+		}
+
+		// the buckets written before the milliseconds were kept have no
+		// Nanoseconds column
+		csm, err := executeQuery(io.NewTimeBucketKey(key), start, end, 0, false,
+			nil, 0, planner.DefaultResourceLimits())
+		if err != nil {
+			if errors.Is(err, planner.ErrNoFiles) {
+				continue
+			}
+			return nil, err
+		}
+		ts := &prompb.TimeSeries{}
+		for name, value := range labels {
+			ts.Labels = append(ts.Labels, &prompb.Label{Name: name, Value: value})
+		}
+		sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+		for _, cs := range csm {
+			epochs := cs.GetEpoch()
+			values, _ := cs.GetColumn(prometheusColumn).([]float64)
+			nanos, _ := cs.GetColumn(prometheusNanos).([]int32)
+			for i := range values {
+				timestamp := epochs[i] * 1000
+				if nanos != nil {
+					timestamp += int64(nanos[i]) / 1e6
+				}
+				ts.Samples = append(ts.Samples, &prompb.Sample{Value: values[i], Timestamp: timestamp})
+			}
+		}
+		if len(ts.Samples) > 0 {
+			result.Timeseries = append(result.Timeseries, ts)
+		}
+	}
+	return result, nil
+}
+
+// prometheusItemKey returns the item key of the bucket of a series, which
+// may only have the __name__ and symbol labels
+func prometheusItemKey(labels map[string]string) (string, error) {
+	for label := range labels {
+		if label != nameLabel && label != symbolLabel {
+			return "", fmt.Errorf("label %s can not be stored, only %s and %s are", label, nameLabel, symbolLabel)
+		}
+	}
+	name := labels[nameLabel]
+	if name == "" {
+		return "", fmt.Errorf("series without a %s label", nameLabel)
+	}
+	symbol := labels[symbolLabel]
+	if symbol == "" {
+		symbol = name
+	}
+	for _, v := range []string{name, symbol} {
+		if strings.ContainsAny(v, "/:") {
+			return "", fmt.Errorf("label value %q can not contain / or :", v)
+		}
+	}
+	return symbol + "/" + prometheusTimeframe + "/" + name, nil
+}
+
+// prometheusLabels returns the labels of the series of a bucket, or false
+// if the bucket does not have the layout written by PrometheusWrite
+func prometheusLabels(key string, infos []*io.TimeBucketInfo) (map[string]string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || parts[1] != prometheusTimeframe || len(infos) == 0 {
+		return nil, false
+	}
+	found := false
+	for _, ds := range infos[0].GetDataShapes() {
+		if ds.Name == prometheusColumn && ds.Type == io.FLOAT64 {
+			found = true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	labels := map[string]string{nameLabel: parts[2]}
+	if parts[0] != parts[2] {
+		labels[symbolLabel] = parts[0]
+	}
+	return labels, true
+}
+
+func labelMap(labels []*prompb.Label) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+// labelMatcher returns a function matching the labels of a series, the
+// labels it does not have having an empty value as in Prometheus
+func labelMatcher(m *prompb.LabelMatcher) (func(labels map[string]string) bool, error) {
+	switch m.Type {
+	case prompb.EQ:
+		return func(labels map[string]string) bool { return labels[m.Name] == m.Value }, nil
+	case prompb.NEQ:
+		return func(labels map[string]string) bool { return labels[m.Name] != m.Value }, nil
+	case prompb.RE, prompb.NRE:
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", m.Value, err)
+		}
+		negate := m.Type == prompb.NRE
+		return func(labels map[string]string) bool { return re.MatchString(labels[m.Name]) != negate }, nil
+	}
+	return nil, fmt.Errorf("unsupported matcher type %d", m.Type)
+}
+
+// floorDiv divides rounding towards negative infinity, for the timestamps
+// in milliseconds before 1970
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,96 @@
+package frontend
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/alpacahq/marketstore/frontend/prompb"
+	"github.com/golang/protobuf/proto"
+	"github.com/klauspost/compress/snappy"
+	. "gopkg.in/check.v1"
+)
+
+func prometheusRequest(c *C, handler http.HandlerFunc, msg proto.Message) *httptest.ResponseRecorder {
+	buf, err := proto.Marshal(msg)
+	c.Assert(err, IsNil)
+	r, _ := http.NewRequest("POST", "/prometheus", bytes.NewReader(snappy.Encode(nil, buf)))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func (s *ServerTestSuite) TestPrometheus(c *C) {
+	series := func(samples []*prompb.Sample, labels ...string) *prompb.TimeSeries {
+		ts := &prompb.TimeSeries{Samples: samples}
+		for i := 0; i < len(labels); i += 2 {
+			ts.Labels = append(ts.Labels, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+		}
+		return ts
+	}
+	w := prometheusRequest(c, PrometheusWrite, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			series([]*prompb.Sample{{Value: 1.5, Timestamp: 1500000000000}, {Value: 2.5, Timestamp: 1500000001000}},
+				"__name__", "spread", "symbol", "PROMA"),
+			series([]*prompb.Sample{{Value: 10, Timestamp: 1500000000000}},
+				"__name__", "spread", "symbol", "PROMB"),
+			series([]*prompb.Sample{{Value: 7, Timestamp: 1500000000999}},
+				"__name__", "promup"),
+		},
+	})
+	c.Assert(w.Code, Equals, http.StatusNoContent, Commentf(w.Body.String()))
+
+	w = prometheusRequest(c, PrometheusWrite, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{series(nil, "symbol", "PROMA")},
+	})
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+
+	// the series differing by other labels would share a bucket
+	w = prometheusRequest(c, PrometheusWrite, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{series([]*prompb.Sample{{Value: 3.5, Timestamp: 1500000002000}},
+			"__name__", "spread", "symbol", "PROMA", "venue", "x")},
+	})
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+
+	read := func(matchers ...*prompb.LabelMatcher) []*prompb.TimeSeries {
+		w := prometheusRequest(c, PrometheusRead, &prompb.ReadRequest{
+			Queries: []*prompb.Query{{
+				StartTimestampMs: 1499999999000,
+				EndTimestampMs:   1500000002000,
+				Matchers:         matchers,
+			}},
+		})
+		c.Assert(w.Code, Equals, http.StatusOK, Commentf(w.Body.String()))
+		c.Assert(w.Header().Get("Content-Encoding"), Equals, "snappy")
+		compressed, _ := ioutil.ReadAll(w.Body)
+		buf, err := snappy.Decode(nil, compressed)
+		c.Assert(err, IsNil)
+		var resp prompb.ReadResponse
+		c.Assert(proto.Unmarshal(buf, &resp), IsNil)
+		c.Assert(resp.Results, HasLen, 1)
+		return resp.Results[0].Timeseries
+	}
+
+	ts := read(&prompb.LabelMatcher{Type: prompb.EQ, Name: "__name__", Value: "spread"})
+	c.Assert(ts, HasLen, 2)
+	c.Assert(ts[0].Labels, DeepEquals, []*prompb.Label{{Name: "__name__", Value: "spread"}, {Name: "symbol", Value: "PROMA"}})
+	c.Assert(ts[0].Samples, DeepEquals, []*prompb.Sample{{Value: 1.5, Timestamp: 1500000000000}, {Value: 2.5, Timestamp: 1500000001000}})
+
+	ts = read(
+		&prompb.LabelMatcher{Type: prompb.EQ, Name: "__name__", Value: "spread"},
+		&prompb.LabelMatcher{Type: prompb.NRE, Name: "symbol", Value: "PROMA|PROMC"})
+	c.Assert(ts, HasLen, 1)
+	c.Assert(ts[0].Samples, DeepEquals, []*prompb.Sample{{Value: 10, Timestamp: 1500000000000}})
+
+	ts = read(&prompb.LabelMatcher{Type: prompb.RE, Name: "__name__", Value: "prom.*"})
+	c.Assert(ts, HasLen, 1)
+	c.Assert(ts[0].Labels, DeepEquals, []*prompb.Label{{Name: "__name__", Value: "promup"}})
+	c.Assert(ts[0].Samples, DeepEquals, []*prompb.Sample{{Value: 7, Timestamp: 1500000000999}})
+
+	var response MultiServerResponse
+	err := (&DataService{}).Destroy(nil, &MultiKeyRequest{
+		Requests: []KeyRequest{{Key: "PROMA/1Sec/spread"}, {Key: "PROMB/1Sec/spread"}, {Key: "promup/1Sec/promup"}},
+	}, &response)
+	c.Assert(err, IsNil)
+}
@@ -28,6 +28,16 @@ func (b *QueryRequestBuilder) EpochEnd(value int64) *QueryRequestBuilder {
 	return b
 }
 
+func (b *QueryRequestBuilder) EpochStartNanos(value int64) *QueryRequestBuilder {
+	b.qr.EpochStartNanos = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) EpochEndNanos(value int64) *QueryRequestBuilder {
+	b.qr.EpochEndNanos = &value
+	return b
+}
+
 func (b *QueryRequestBuilder) LimitRecordCount(value int) *QueryRequestBuilder {
 	b.qr.LimitRecordCount = &value
 	return b
@@ -43,6 +53,66 @@ func (b *QueryRequestBuilder) Functions(value []string) *QueryRequestBuilder {
 	return b
 }
 
+func (b *QueryRequestBuilder) SampleInterval(value int) *QueryRequestBuilder {
+	b.qr.SampleInterval = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) MaxRowsScanned(value int64) *QueryRequestBuilder {
+	b.qr.MaxRowsScanned = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) MaxBytesRead(value int64) *QueryRequestBuilder {
+	b.qr.MaxBytesRead = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) MaxMemory(value int64) *QueryRequestBuilder {
+	b.qr.MaxMemory = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Pivot(value bool) *QueryRequestBuilder {
+	b.qr.Pivot = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Format(value string) *QueryRequestBuilder {
+	b.qr.Format = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) TimeFormat(value string) *QueryRequestBuilder {
+	b.qr.TimeFormat = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Timezone(value string) *QueryRequestBuilder {
+	b.qr.Timezone = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Contiguous(value bool) *QueryRequestBuilder {
+	b.qr.Contiguous = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Adjust(value string) *QueryRequestBuilder {
+	b.qr.Adjust = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Session(value string) *QueryRequestBuilder {
+	b.qr.Session = &value
+	return b
+}
+
+func (b *QueryRequestBuilder) Stitch(value bool) *QueryRequestBuilder {
+	b.qr.Stitch = &value
+	return b
+}
+
 func (b *QueryRequestBuilder) End() QueryRequest {
 	return *b.qr
 }
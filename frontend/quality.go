@@ -0,0 +1,114 @@
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gobwas/glob"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/executor/quality"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type GetQualityReportArgs struct {
+	// Buckets are glob patterns of the keys of the buckets analyzed, e.g.
+	// */1Min/OHLCV, all of them if empty
+	Buckets    []string `msgpack:"buckets,omitempty"`
+	EpochStart int64    `msgpack:"epoch_start"`
+	EpochEnd   int64    `msgpack:"epoch_end"`
+}
+
+// QualityReport is the quality of a bucket analyzed within the period of
+// the report
+type QualityReport struct {
+	Bucket string `msgpack:"bucket"`
+	// Coverage is the mean coverage of the periods analyzed, 1 if the market
+	// was not open during any of them
+	Coverage float64 `msgpack:"coverage"`
+	// Counts are the numbers of findings by kind, but for the coverages
+	Counts map[string]int `msgpack:"counts"`
+	// Findings are in the order of time, with the coverage of each period
+	// analyzed at its start
+	Findings []quality.Finding `msgpack:"findings"`
+}
+
+type GetQualityReportResponse struct {
+	Reports []QualityReport `msgpack:"reports"`
+}
+
+// GetQualityReport returns the findings of the quality analyses of the
+// buckets from EpochStart until EpochEnd, and the coverage of their
+// records, the buckets the request may not read being left out
+func (s *DataService) GetQualityReport(r *http.Request, args *GetQualityReportArgs, response *GetQualityReportResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	if args.EpochEnd < args.EpochStart {
+		return fmt.Errorf("epoch_end %d before epoch_start %d", args.EpochEnd, args.EpochStart)
+	}
+	patterns := make([]glob.Glob, 0, len(args.Buckets))
+	for _, pattern := range args.Buckets {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return fmt.Errorf("invalid bucket pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, g)
+	}
+	match := func(key string) bool {
+		for _, g := range patterns {
+			if g.Match(key) {
+				return true
+			}
+		}
+		return len(patterns) == 0
+	}
+
+	start := time.Unix(args.EpochStart, 0)
+	// the end is included
+	end := time.Unix(args.EpochEnd, 0).Add(time.Second)
+	response.Reports = []QualityReport{}
+	for _, key := range executor.BucketKeys() {
+		tbk := io.NewTimeBucketKey(key)
+		if tbk.GetItemInCategory("AttributeGroup") != quality.AttributeGroup {
+			continue
+		}
+		findings, err := quality.Read(*tbk, start, end)
+		if err != nil {
+			return err
+		}
+		for group, found := range findings {
+			bucket := tbk.GetItemInCategory("Symbol") + "/" + tbk.GetItemInCategory("Timeframe") + "/" + group
+			if !match(bucket) || auth.AuthorizeBucket(r, auth.READ, bucket) != nil {
+				continue
+			}
+			response.Reports = append(response.Reports, qualityReport(bucket, found))
+		}
+	}
+	sort.Slice(response.Reports, func(i, j int) bool {
+		return response.Reports[i].Bucket < response.Reports[j].Bucket
+	})
+	return nil
+}
+
+func qualityReport(bucket string, findings []quality.Finding) QualityReport {
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Epoch < findings[j].Epoch })
+	report := QualityReport{Bucket: bucket, Counts: map[string]int{}, Findings: findings}
+	coverage, periods := 0., 0
+	for _, f := range findings {
+		if f.Kind == quality.COVERAGE {
+			coverage += f.Value
+			periods++
+		} else {
+			report.Counts[f.Kind]++
+		}
+	}
+	report.Coverage = 1
+	if periods > 0 {
+		report.Coverage = coverage / float64(periods)
+	}
+	return report
+}
@@ -0,0 +1,55 @@
+package frontend
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/executor/quality"
+	"github.com/alpacahq/marketstore/utils"
+)
+
+func (s *ServerTestSuite) TestQualityReport(c *C) {
+	service := &DataService{}
+	service.Init()
+	defer service.Destroy(nil, &MultiKeyRequest{Requests: []KeyRequest{{Key: "EURUSD/1D/QUALITY"}}}, &MultiServerResponse{})
+
+	start := time.Date(2002, time.February, 1, 0, 0, 0, 0, time.UTC)
+	check := &utils.QualityCheckSetting{Pattern: "EURUSD/1D/*", MaxJump: 0.5}
+	for month := 0; month < 2; month++ {
+		c.Assert(quality.Check(check, start.AddDate(0, month, 0), start.AddDate(0, month+1, 0)), IsNil)
+	}
+
+	args := &GetQualityReportArgs{
+		Buckets:    []string{"*/1D/OHLC"},
+		EpochStart: start.Unix(),
+		EpochEnd:   start.AddDate(1, 0, 0).Unix(),
+	}
+	var response GetQualityReportResponse
+	c.Assert(service.GetQualityReport(nil, args, &response), IsNil)
+	c.Assert(response.Reports, HasLen, 1)
+	report := response.Reports[0]
+	c.Assert(report.Bucket, Equals, "EURUSD/1D/OHLC")
+	c.Assert(report.Coverage, Equals, 1.)
+	c.Assert(report.Counts, DeepEquals, map[string]int{quality.JUMP: 11})
+	c.Assert(report.Findings, HasLen, 13)
+	c.Assert(report.Findings[0], DeepEquals, quality.Finding{Epoch: start.Unix(), Kind: quality.COVERAGE, Value: 1})
+	c.Assert(report.Findings[1].Kind, Equals, quality.JUMP)
+	c.Assert(report.Findings[1].Column, Equals, "Close")
+	for i := 1; i < len(report.Findings); i++ {
+		c.Assert(report.Findings[i].Epoch >= report.Findings[i-1].Epoch, Equals, true)
+	}
+
+	// within the first month only
+	args.EpochEnd = start.AddDate(0, 1, 0).Unix() - 1
+	c.Assert(service.GetQualityReport(nil, args, &response), IsNil)
+	c.Assert(response.Reports, HasLen, 1)
+	c.Assert(response.Reports[0].Counts, DeepEquals, map[string]int{quality.JUMP: 5})
+
+	args.Buckets = []string{"*/1Min/OHLC"}
+	c.Assert(service.GetQualityReport(nil, args, &response), IsNil)
+	c.Assert(response.Reports, HasLen, 0)
+
+	args.EpochEnd = args.EpochStart - 1
+	c.Assert(service.GetQualityReport(nil, args, &response), NotNil)
+}
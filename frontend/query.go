@@ -1,19 +1,24 @@
 package frontend
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"strings"
-	"sync/atomic"
 	"time"
 
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/limit"
 	"github.com/alpacahq/marketstore/planner"
 	"github.com/alpacahq/marketstore/sqlparser"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
 )
 
 // This is the parameter interface for DataService.Query method.
@@ -21,6 +26,9 @@ type QueryRequest struct {
 	// Note: SQL is not fully supported
 	IsSQLStatement bool   `msgpack:"is_sqlstatement"` // If this is a SQL request, Only SQLStatement is relevant
 	SQLStatement   string `msgpack:"sql_statement"`
+	// Values bound in order to the '?' placeholders in SQLStatement, or by
+	// position to its $n placeholders, $1 being the first
+	SQLParameters []interface{} `msgpack:"sql_parameters,omitempty"`
 
 	// Destination is <symbol>/<timeframe>/<attributegroup>
 	Destination string `msgpack:"destination"`
@@ -30,6 +38,10 @@ type QueryRequest struct {
 	EpochStart *int64 `msgpack:"epoch_start,omitempty"`
 	// Upper time predicate (i.e. index <= end) in unix epoch second
 	EpochEnd *int64 `msgpack:"epoch_end,omitempty"`
+	// Lower and upper time predicates in unix epoch nanosecond, instead of
+	// EpochStart and EpochEnd, such as for the nanosecond buckets
+	EpochStartNanos *int64 `msgpack:"epoch_start_nanos,omitempty"`
+	EpochEndNanos   *int64 `msgpack:"epoch_end_nanos,omitempty"`
 	// Number of max returned rows from lower/upper bound
 	LimitRecordCount *int `msgpack:"limit_record_count,omitempty"`
 	// Set to true if LimitRecordCount should be from the lower
@@ -39,6 +51,51 @@ type QueryRequest struct {
 
 	// Support for functions is experimental and subject to change
 	Functions []string `msgpack:"functions,omitempty"`
+
+	// Return only every Nth record of the range, the result is approximate
+	// and flagged as sampled in the response.  The records of fixed length
+	// buckets sampled out are skipped without being read, N-1 of them after
+	// each record returned, and the rows of variable length buckets are
+	// sampled one by one.
+	SampleInterval *int `msgpack:"sample_interval,omitempty"`
+
+	// Resource limits for this query, these can only lower the limits
+	// configured for the server
+	MaxRowsScanned *int64 `msgpack:"max_rows_scanned,omitempty"`
+	MaxBytesRead   *int64 `msgpack:"max_bytes_read,omitempty"`
+	MaxMemory      *int64 `msgpack:"max_memory,omitempty"`
+
+	// Set to true to return a single epoch indexed table with one column
+	// per symbol and field, e.g. Close_AAPL, Close_MSFT
+	Pivot *bool `msgpack:"pivot,omitempty"`
+
+	// Set to "csv" to return the result as CSV text instead of a dataset
+	Format *string `msgpack:"format,omitempty"`
+	// Formatting of the CSV Epoch column, "unix" (default), "rfc3339" or a
+	// Go time layout, e.g. "2006-01-02 15:04:05"
+	TimeFormat *string `msgpack:"time_format,omitempty"`
+	// Timezone by name of the TZ database, e.g. "Asia/Tokyo", by which the
+	// functions aggregate the records into days and the CSV times are
+	// formatted, the timezone of each bucket by default
+	Timezone *string `msgpack:"timezone,omitempty"`
+	// Set to true to lay the columns of the result out in a single buffer,
+	// aligned for the clients to wrap them as numpy arrays without copying
+	Contiguous *bool `msgpack:"contiguous,omitempty"`
+	// Set to "split" to adjust the prices and volumes of the symbols for
+	// their splits recorded by AddCorporateActions, or to "all" to adjust
+	// the prices for their dividends too
+	Adjust *string `msgpack:"adjust,omitempty"`
+	// Market calendar by name, e.g. "nyse", to return only the records of
+	// the intraday buckets within its sessions, see GetSessions
+	Session *string `msgpack:"session,omitempty"`
+	// Set to true to have the records of the former tickers of the symbols,
+	// from their symbol changes recorded by AddCorporateActions, prepended
+	// to their own, see GetSymbology
+	Stitch *bool `msgpack:"stitch,omitempty"`
+
+	// Set by a coordinator querying a shard, for the shard to read its own
+	// buckets instead of querying the other shards in turn
+	Local bool `msgpack:"local,omitempty"`
 }
 
 type MultiQueryRequest struct {
@@ -50,6 +107,13 @@ type MultiQueryRequest struct {
 
 type QueryResponse struct {
 	Result *io.NumpyMultiDataset `msgpack:"result"`
+	// Set when the result was produced from a sample of the stored records
+	Sampled bool `msgpack:"sampled,omitempty"`
+	// Set instead of Result when CSV format is requested
+	CSV []byte `msgpack:"csv,omitempty"`
+	// Timezone of the buckets of the result by key, for those not in the
+	// timezone of the server
+	Timezones map[string]string `msgpack:"timezones,omitempty"`
 }
 
 type MultiQueryResponse struct {
@@ -58,6 +122,23 @@ type MultiQueryResponse struct {
 	Timezone  string          `msgpack:"timezone"` // Server Timezone
 }
 
+// shape downgrades the datasets of the response to the format the clients
+// of the version decode
+func (resp *MultiQueryResponse) shape(version int) (err error) {
+	if version >= APIVersion3 {
+		return nil
+	}
+	for i := range resp.Responses {
+		if resp.Responses[i].Result == nil {
+			continue
+		}
+		if resp.Responses[i].Result, err = resp.Responses[i].Result.Downgrade(io.NumpyFormat1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ToColumnSeriesMap converts a MultiQueryResponse to a
 // ColumnSeriesMap, returning an error if there is any
 // issue encountered while converting.
@@ -70,6 +151,9 @@ func (resp *MultiQueryResponse) ToColumnSeriesMap() (*io.ColumnSeriesMap, error)
 
 	for _, ds := range resp.Responses { // Datasets are packed in a slice, each has a NumpyMultiDataset inside
 		nmds := ds.Result
+		if nmds == nil {
+			continue
+		}
 		for tbkStr, startIndex := range nmds.StartIndex {
 			cs, err := nmds.ToColumnSeries(startIndex, nmds.Lengths[tbkStr])
 			if err != nil {
@@ -83,36 +167,68 @@ func (resp *MultiQueryResponse) ToColumnSeriesMap() (*io.ColumnSeriesMap, error)
 	return &csm, nil
 }
 
+// Parsed SQL statements, reused across requests with different parameters
+var statementCache = sqlparser.NewStatementCache(1024)
+
 func (s *DataService) Query(r *http.Request, reqs *MultiQueryRequest, response *MultiQueryResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	release, err := limit.Acquire(r)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer observeDuration("query", time.Now())
 	response.Version = utils.GitHash
 	response.Timezone = utils.InstanceConfig.Timezone.String()
 	for _, req := range reqs.Requests {
+		csvFormat, err := requestCSVFormat(&req)
+		if err != nil {
+			return err
+		}
 		switch req.IsSQLStatement {
 		case true:
-			ast, err := sqlparser.NewAstBuilder(req.SQLStatement)
+			ast, err := statementCache.Get(req.SQLStatement)
 			if err != nil {
 				return err
 			}
-			es, err := sqlparser.NewExecutableStatement(ast.Mtree)
+			es, err := sqlparser.NewPreparedExecutableStatement(ast, req.SQLParameters...)
 			if err != nil {
 				return err
 			}
+			if err = authorizeStatement(r, es); err != nil {
+				recordStatement(r, es, err)
+				return err
+			}
 			cs, err := es.Materialize()
+			recordStatement(r, es, err)
 			if err != nil {
 				return err
 			}
+			tbk := io.NewTimeBucketKeyFromString(req.SQLStatement + ":SQL")
+			if csvFormat {
+				csv, err := csvResult(io.ColumnSeriesMap{*tbk: cs}, &req)
+				if err != nil {
+					return err
+				}
+				response.Responses = append(response.Responses, QueryResponse{CSV: csv})
+				continue
+			}
 			nds, err := io.NewNumpyDataset(cs)
 			if err != nil {
 				return err
 			}
-			tbk := io.NewTimeBucketKeyFromString(req.SQLStatement + ":SQL")
 			nmds, err := io.NewNumpyMultiDataset(nds, *tbk)
 			if err != nil {
 				return err
 			}
+			if req.Contiguous != nil && *req.Contiguous {
+				nmds.Pack()
+			}
 			response.Responses = append(response.Responses,
 				QueryResponse{
-					nmds,
+					Result: nmds,
 				})
 
 		case false:
@@ -136,14 +252,49 @@ func (s *DataService) Query(r *http.Request, reqs *MultiQueryRequest, response *
 			if len(Timeframe) == 0 || len(RecordFormat) == 0 || len(Symbols) == 0 {
 				return fmt.Errorf("destinations must have a Symbol, Timeframe and AttributeGroup, have: %s",
 					dest.String())
-			} else if len(Symbols) == 1 && Symbols[0] == "*" {
+			}
+			// the symbols owned by other shards are queried on them, unless
+			// this is a shard queried by its coordinator
+			localSymbols, remote := Symbols, map[string][]string(nil)
+			var federated map[string][]string
+			if !req.Local {
+				localSymbols, remote = partitionSymbols(Symbols)
+				// and the buckets held by the remotes on them
+				localSymbols, federated = partitionRemotes(localSymbols, Timeframe, RecordFormat)
+			}
+			routed := len(remote) > 0 || len(federated) > 0
+			if len(Symbols) == 1 && Symbols[0] == "*" {
 				// replace the * "symbol" with a list all known actual symbols
 				allSymbols := executor.ThisInstance.CatalogDir.GatherCategoriesAndItems()["Symbol"]
-				symbols := make([]string, 0, len(allSymbols))
+				localSymbols = make([]string, 0, len(allSymbols))
 				for symbol := range allSymbols {
-					symbols = append(symbols, symbol)
+					// leave out the symbols the key may not read
+					if auth.AuthorizeBucket(r, auth.READ, symbol+"/"+Timeframe+"/"+RecordFormat) != nil {
+						continue
+					}
+					if req.Local || (utils.InstanceConfig.OwnsSymbol(symbol) &&
+						utils.InstanceConfig.RemoteOf(symbol+"/"+Timeframe+"/"+RecordFormat) == nil) {
+						localSymbols = append(localSymbols, symbol)
+					}
 				}
-				keyParts := []string{strings.Join(symbols, ","), Timeframe, RecordFormat}
+			} else {
+				for _, symbol := range Symbols {
+					if err = auth.AuthorizeBucket(r, auth.READ, symbol+"/"+Timeframe+"/"+RecordFormat); err != nil {
+						return err
+					}
+				}
+			}
+			// the renamed symbols are read under their new name, and the
+			// identifiers under their symbol
+			localSymbols, aliasOf := resolveAliases(localSymbols)
+			localSymbols, aliasOf = resolveIdentifiers(localSymbols, aliasOf)
+			for symbol := range aliasOf {
+				if err = auth.AuthorizeBucket(r, auth.READ, symbol+"/"+Timeframe+"/"+RecordFormat); err != nil {
+					return err
+				}
+			}
+			if routed || (len(Symbols) == 1 && Symbols[0] == "*") || aliasOf != nil {
+				keyParts := []string{strings.Join(localSymbols, ","), Timeframe, RecordFormat}
 				itemKey := strings.Join(keyParts, "/")
 				dest = io.NewTimeBucketKey(itemKey, req.KeyCategory)
 			}
@@ -168,18 +319,95 @@ func (s *DataService) Query(r *http.Request, reqs *MultiQueryRequest, response *
 			if req.Columns != nil {
 				columns = req.Columns
 			}
+			sampleInterval := 0
+			if req.SampleInterval != nil {
+				if *req.SampleInterval < 0 {
+					return fmt.Errorf("sample interval must not be negative, have: %d", *req.SampleInterval)
+				}
+				sampleInterval = *req.SampleInterval
+			}
+			limits := requestResourceLimits(&req)
 
 			start := io.ToSystemTimezone(time.Unix(epochStart, 0))
-			stop := io.ToSystemTimezone(time.Unix(epochEnd, 0))
-			csm, err := executeQuery(
-				dest,
-				start, stop,
-				limitRecordCount, limitFromStart,
-				columns,
-			)
+			stop := io.ToSystemTimezone(time.Unix(epochEnd, 999999999))
+			if req.EpochStartNanos != nil {
+				start = io.ToSystemTimezone(time.Unix(0, *req.EpochStartNanos))
+			}
+			if req.EpochEndNanos != nil {
+				stop = io.ToSystemTimezone(time.Unix(0, *req.EpochEndNanos))
+			}
+			csm := io.NewColumnSeriesMap()
+			if len(localSymbols) > 0 || !routed {
+				csm, err = executeQuery(
+					dest,
+					start, stop,
+					limitRecordCount, limitFromStart,
+					columns,
+					sampleInterval,
+					limits,
+				)
+				// no local buckets are found when the shards or the remotes
+				// have them all, or the records are those of the former tickers
+				stitch := req.Stitch != nil && *req.Stitch
+				if err != nil && ((!routed && !stitch) || !errors.Is(err, planner.ErrNoFiles)) {
+					return err
+				}
+				if stitch {
+					if csm == nil {
+						csm = io.NewColumnSeriesMap()
+					}
+					read := func(tbk *io.TimeBucketKey, start, stop time.Time) (io.ColumnSeriesMap, error) {
+						return executeQuery(tbk, start, stop, limitRecordCount, limitFromStart, columns, sampleInterval, limits)
+					}
+					err = stitchHistory(r, csm, localSymbols, Timeframe, RecordFormat,
+						start, stop, limitRecordCount, limitFromStart, read)
+					if err != nil {
+						return err
+					}
+				}
+				csm = unaliasKeys(csm, aliasOf)
+			}
+			if len(remote) > 0 {
+				shardCSM, err := queryShards(r, &req, remote, Timeframe, RecordFormat)
+				if err != nil {
+					return err
+				}
+				if csm == nil {
+					csm = io.NewColumnSeriesMap()
+				}
+				for tbk, cs := range shardCSM {
+					csm[tbk] = cs
+				}
+			}
+			if len(federated) > 0 {
+				remoteCSM, err := queryRemotes(r, &req, federated, Timeframe, RecordFormat)
+				if err != nil {
+					return err
+				}
+				if csm == nil {
+					csm = io.NewColumnSeriesMap()
+				}
+				for tbk, cs := range remoteCSM {
+					csm[tbk] = cs
+				}
+			}
+
+			if req.Adjust != nil {
+				if err = adjustResult(csm, *req.Adjust); err != nil {
+					return err
+				}
+			}
+			if req.Session != nil {
+				if err = sessionResult(csm, *req.Session); err != nil {
+					return err
+				}
+			}
+
+			location, err := requestLocation(req.Timezone)
 			if err != nil {
 				return err
 			}
+			timezones := setTimezones(csm, location)
 
 			/*
 				Execute function pipeline, if requested
@@ -194,11 +422,44 @@ func (s *DataService) Query(r *http.Request, reqs *MultiQueryRequest, response *
 				}
 			}
 
+			/*
+				Pivot the symbols into a single wide table, if requested
+			*/
+			if req.Pivot != nil && *req.Pivot {
+				wide, err := csm.ToWideColumnSeries("Symbol")
+				if err != nil {
+					return err
+				}
+				if location != nil {
+					wide.SetLocation(location)
+				}
+				csm = io.ColumnSeriesMap{*dest: wide}
+			}
+
+			if csvFormat {
+				csv, err := csvResult(csm, &req)
+				if err != nil {
+					return err
+				}
+				response.Responses = append(response.Responses,
+					QueryResponse{
+						Sampled:   sampleInterval > 1,
+						CSV:       csv,
+						Timezones: timezones,
+					})
+				continue
+			}
+
 			/*
 				Separate each TimeBucket from the result and compose a NumpyMultiDataset
 			*/
 			var nmds *io.NumpyMultiDataset
 			for tbk, cs := range csm {
+				if executor.NanosecondIndexed(tbk) {
+					if err = executor.ToEpochNanos(cs); err != nil {
+						return err
+					}
+				}
 				nds, err := io.NewNumpyDataset(cs)
 				if err != nil {
 					return err
@@ -217,38 +478,94 @@ func (s *DataService) Query(r *http.Request, reqs *MultiQueryRequest, response *
 				Append the NumpyMultiDataset to the MultiResponse
 			*/
 
+			if nmds != nil && req.Contiguous != nil && *req.Contiguous {
+				nmds.Pack()
+			}
 			response.Responses = append(response.Responses,
 				QueryResponse{
-					nmds,
+					Result:    nmds,
+					Sampled:   sampleInterval > 1,
+					Timezones: timezones,
 				})
 
 		}
 	}
-	return nil
+	return response.shape(apiVersion(r))
 }
 
-type ListSymbolsResponse struct {
-	Results []string
+// requestLocation returns the timezone of the name of a request, or nil if
+// it has none
+func requestLocation(name *string) (*time.Location, error) {
+	if name == nil || *name == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(*name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s: %v", *name, err)
+	}
+	return loc, nil
 }
 
-type ListSymbolsArgs struct{}
+// setTimezones sets the location of the column series of each bucket to the
+// requested one, or else to the timezone of the bucket, and returns those not
+// in the timezone of the server by key
+func setTimezones(csm io.ColumnSeriesMap, requested *time.Location) map[string]string {
+	var timezones map[string]string
+	for tbk, cs := range csm {
+		loc := requested
+		if loc == nil {
+			loc = executor.BucketTimezone(tbk)
+		}
+		cs.SetLocation(loc)
+		if loc.String() != utils.InstanceConfig.Timezone.String() {
+			if timezones == nil {
+				timezones = map[string]string{}
+			}
+			timezones[tbk.GetItemKey()] = loc.String()
+		}
+	}
+	return timezones
+}
 
-func (s *DataService) ListSymbols(r *http.Request, args *ListSymbolsArgs, response *ListSymbolsResponse) (err error) {
-	if atomic.LoadUint32(&Queryable) == 0 {
-		return queryableError
+// observeDuration records the duration of a query call since start
+func observeDuration(method string, start time.Time) {
+	stats.QueryDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// authorizeStatement checks the permissions of the request
+// on the buckets a SQL statement reads from and writes to
+func authorizeStatement(r *http.Request, es *sqlparser.ExecutableStatement) error {
+	reads, writes := es.Buckets()
+	for _, bucket := range reads {
+		if err := auth.AuthorizeBucket(r, auth.READ, bucket); err != nil {
+			return err
+		}
+	}
+	for _, bucket := range writes {
+		if err := auth.AuthorizeBucket(r, auth.WRITE, bucket); err != nil {
+			return err
+		}
 	}
-	for symbol := range executor.ThisInstance.CatalogDir.GatherCategoriesAndItems()["Symbol"] {
-		response.Results = append(response.Results, symbol)
+	return nil
+}
+
+// recordStatement adds the buckets a SQL statement writes to to the audit log
+func recordStatement(r *http.Request, es *sqlparser.ExecutableStatement, err error) {
+	_, writes := es.Buckets()
+	for _, bucket := range writes {
+		audit.Record(r, audit.WRITE, bucket, 0, err)
 	}
-	return err
 }
 
 /*
 Utility functions
 */
 
+// executeQuery reads the records of the bucket from start to end, to their
+// nanosecond for the records with nanoseconds
 func executeQuery(tbk *io.TimeBucketKey, start, end time.Time, LimitRecordCount int,
-	LimitFromStart bool, columns []string) (io.ColumnSeriesMap, error) {
+	LimitFromStart bool, columns []string, sampleInterval int,
+	limits planner.ResourceLimits) (io.ColumnSeriesMap, error) {
 
 	query := planner.NewQuery(executor.ThisInstance.CatalogDir)
 
@@ -277,25 +594,29 @@ func executeQuery(tbk *io.TimeBucketKey, start, end time.Time, LimitRecordCount
 	}
 
 	query.SetRange(start.Unix(), end.Unix())
+	query.SetNanoseconds(int32(start.Nanosecond()), int32(end.Nanosecond()))
+	query.SetSampleInterval(sampleInterval)
+	query.SetResourceLimits(limits)
+	logger := log.With("bucket", tbk.String())
 	parseResult, err := query.Parse()
 	if err != nil {
 		// No results from query
-		if err.Error() == "No files returned from query parse" {
-			log.Info("No results returned from query: Target: %v, start, end: %v,%v LimitRecordCount: %v",
-				tbk.String(), start, end, LimitRecordCount)
+		if errors.Is(err, planner.ErrNoFiles) {
+			logger.Info("No results returned from query: start, end: %v,%v LimitRecordCount: %v",
+				start, end, LimitRecordCount)
 		} else {
-			log.Error("Parsing query: %s\n", err)
+			logger.Error("Parsing query: %s\n", err)
 		}
 		return nil, err
 	}
 	scanner, err := executor.NewReader(parseResult)
 	if err != nil {
-		log.Error("Unable to create scanner: %s\n", err)
+		logger.Error("Unable to create scanner: %s\n", err)
 		return nil, err
 	}
 	csm, err := scanner.Read()
 	if err != nil {
-		log.Error("Error returned from query scanner: %s\n", err)
+		logger.Error("Error returned from query scanner: %s\n", err)
 		return nil, err
 	}
 
@@ -304,6 +625,48 @@ func executeQuery(tbk *io.TimeBucketKey, start, end time.Time, LimitRecordCount
 	return csm, err
 }
 
+// requestResourceLimits applies the limits requested by the client on top of
+// the server configured limits
+func requestResourceLimits(req *QueryRequest) planner.ResourceLimits {
+	var maxRowsScanned, maxBytesRead, maxMemory int64
+	if req.MaxRowsScanned != nil {
+		maxRowsScanned = *req.MaxRowsScanned
+	}
+	if req.MaxBytesRead != nil {
+		maxBytesRead = *req.MaxBytesRead
+	}
+	if req.MaxMemory != nil {
+		maxMemory = *req.MaxMemory
+	}
+	return planner.DefaultResourceLimits().Restrict(maxRowsScanned, maxBytesRead, maxMemory)
+}
+
+// requestCSVFormat returns whether the request asks for a CSV result
+func requestCSVFormat(req *QueryRequest) (bool, error) {
+	if req.Format == nil {
+		return false, nil
+	}
+	switch strings.ToLower(*req.Format) {
+	case "", "numpy":
+		return false, nil
+	case "csv":
+		return true, nil
+	}
+	return false, fmt.Errorf("format must be one of numpy or csv, have: %s", *req.Format)
+}
+
+func csvResult(csm io.ColumnSeriesMap, req *QueryRequest) ([]byte, error) {
+	timeFormat := ""
+	if req.TimeFormat != nil {
+		timeFormat = *req.TimeFormat
+	}
+	buf := new(bytes.Buffer)
+	if err := csm.WriteCSV(buf, timeFormat); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func runAggFunctions(callChain []string, csInput *io.ColumnSeries) (cs *io.ColumnSeries, err error) {
 	cs = nil
 	for _, call := range callChain {
@@ -356,6 +719,8 @@ func runAggFunctions(callChain []string, csInput *io.ColumnSeries) (cs *io.Colum
 				"No result from aggregate %s",
 				aggName)
 		}
+		// the next function aggregates in the same timezone
+		cs.SetLocation(csInput.GetLocation())
 	}
 	return cs, nil
 }
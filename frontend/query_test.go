@@ -1,6 +1,9 @@
 package frontend
 
 import (
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/test"
 
@@ -10,6 +13,10 @@ import (
 
 	"math"
 
+	"net/http"
+
+	"strings"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -105,6 +112,68 @@ func (s *ServerTestSuite) TestQuery(c *C) {
 	c.Assert(t, Equals, tref)
 }
 
+func (s *ServerTestSuite) TestQueryContiguous(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var response MultiQueryResponse
+	err := service.Query(nil, &MultiQueryRequest{
+		Requests: []QueryRequest{
+			NewQueryRequestBuilder("USDJPY,EURUSD/1Min/OHLC").LimitRecordCount(3).Contiguous(true).End(),
+		},
+	}, &response)
+	c.Assert(err, IsNil)
+	result := response.Responses[0].Result
+	c.Assert(result.Format, Equals, io.NumpyFormat3)
+	c.Assert(result.ColumnData, IsNil)
+	for _, offset := range result.Offsets {
+		c.Assert(offset%io.NumpyAlignment, Equals, 0)
+	}
+	csm, err := response.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Assert((*csm)[*io.NewTimeBucketKey("EURUSD/1Min/OHLC")].Len(), Equals, 3)
+}
+
+func (s *ServerTestSuite) TestQuerySQLParameters(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	stmt := "SELECT Open, Close FROM `USDJPY/1Min/OHLC` WHERE Epoch BETWEEN ? AND ?;"
+	start := time.Date(2002, time.December, 31, 23, 0, 0, 0, time.UTC)
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{
+			{
+				IsSQLStatement: true,
+				SQLStatement:   stmt,
+				SQLParameters:  []interface{}{start.Unix(), start.Add(30 * time.Minute).Unix()},
+			},
+			{
+				IsSQLStatement: true,
+				SQLStatement:   stmt,
+				SQLParameters:  []interface{}{start.Unix(), start.Add(10 * time.Minute).Unix()},
+			},
+		},
+	}
+
+	var response MultiQueryResponse
+	if err := service.Query(nil, args, &response); err != nil {
+		c.Fatalf("error returned: %s", err)
+	}
+	c.Assert(len(response.Responses), Equals, 2)
+
+	cs, err := response.Responses[0].Result.ToColumnSeries()
+	c.Assert(err == nil, Equals, true)
+	c.Assert(cs.Len(), Equals, 29)
+	cs, err = response.Responses[1].Result.ToColumnSeries()
+	c.Assert(err == nil, Equals, true)
+	c.Assert(cs.Len(), Equals, 9)
+
+	args.Requests = args.Requests[:1]
+	args.Requests[0].SQLParameters = args.Requests[0].SQLParameters[:1]
+	err = service.Query(nil, args, &response)
+	c.Assert(err != nil, Equals, true)
+}
+
 func (s *ServerTestSuite) TestQueryFirstN(c *C) {
 	service := &DataService{}
 	service.Init()
@@ -136,6 +205,201 @@ func (s *ServerTestSuite) TestQueryFirstN(c *C) {
 	c.Assert(t, Equals, tref)
 }
 
+func (s *ServerTestSuite) TestQuerySampled(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	start := time.Date(2002, time.October, 1, 10, 0, 0, 0, time.UTC)
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{
+			(NewQueryRequestBuilder("USDJPY/1Min/OHLC").
+				EpochStart(start.Unix()).
+				EpochEnd(start.Add(time.Hour - time.Minute).Unix()).
+				SampleInterval(10).
+				End()),
+		},
+	}
+
+	var response MultiQueryResponse
+	if err := service.Query(nil, args, &response); err != nil {
+		c.Fatalf("error returned: %s", err)
+	}
+	c.Assert(response.Responses[0].Sampled, Equals, true)
+
+	cs, err := response.Responses[0].Result.ToColumnSeries()
+	c.Assert(err == nil, Equals, true)
+	index := cs.GetEpoch()
+	c.Assert(len(index), Equals, 6)
+	c.Assert(index[0], Equals, start.Unix())
+	c.Assert(index[1], Equals, start.Add(10*time.Minute).Unix())
+
+	args.Requests[0] = NewQueryRequestBuilder("USDJPY/1Min/OHLC").
+		EpochStart(start.Unix()).
+		EpochEnd(start.Add(time.Hour - time.Minute).Unix()).
+		End()
+	response = MultiQueryResponse{}
+	if err := service.Query(nil, args, &response); err != nil {
+		c.Fatalf("error returned: %s", err)
+	}
+	c.Assert(response.Responses[0].Sampled, Equals, false)
+	c.Assert(response.Responses[0].Result.Lengths["USDJPY/1Min/OHLC:Symbol/Timeframe/AttributeGroup"], Equals, 60)
+
+	// the records sampled out past the read buffer are seeked over
+	args.Requests[0] = NewQueryRequestBuilder("USDJPY/1Min/OHLC").
+		EpochStart(start.Unix()).
+		EpochEnd(start.Add(5*24*time.Hour - time.Minute).Unix()).
+		SampleInterval(2500).
+		End()
+	response = MultiQueryResponse{}
+	c.Assert(service.Query(nil, args, &response), IsNil)
+	cs, err = response.Responses[0].Result.ToColumnSeries()
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetEpoch(), DeepEquals, []int64{start.Unix(), start.Add(2500 * time.Minute).Unix(),
+		start.Add(5000 * time.Minute).Unix()})
+
+	args.Requests[0].SampleInterval = new(int)
+	*args.Requests[0].SampleInterval = -1
+	c.Assert(service.Query(nil, args, &response) != nil, Equals, true)
+}
+
+func (s *ServerTestSuite) TestQuerySampledVariable(c *C) {
+	service := &DataService{}
+	service.Init()
+	defer service.Destroy(nil, &MultiKeyRequest{Requests: []KeyRequest{{Key: "SMPL/1Sec/TICK"}}}, &MultiServerResponse{})
+
+	// the ten rows of a single second are sampled one by one
+	second := time.Date(2002, time.October, 1, 10, 0, 0, 0, time.UTC).Unix()
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{second, second, second, second, second, second, second, second, second, second})
+	cs.AddColumn("Nanoseconds", []int32{0, 1e8, 2e8, 3e8, 4e8, 5e8, 6e8, 7e8, 8e8, 9e8})
+	cs.AddColumn("Price", []float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("SMPL/1Sec/TICK"), cs)
+	c.Assert(executor.WriteCSM(csm, true), IsNil)
+
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{
+			(NewQueryRequestBuilder("SMPL/1Sec/TICK").
+				EpochStart(second).
+				EpochEnd(second).
+				SampleInterval(3).
+				End()),
+		},
+	}
+	var response MultiQueryResponse
+	c.Assert(service.Query(nil, args, &response), IsNil)
+	cs, err := response.Responses[0].Result.ToColumnSeries()
+	c.Assert(err, IsNil)
+	c.Assert(cs.GetByName("Price"), DeepEquals, []float32{0, 3, 6, 9})
+}
+
+func (s *ServerTestSuite) TestQueryResourceLimits(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	start := time.Date(2002, time.October, 1, 10, 0, 0, 0, time.UTC)
+	query := func(b *QueryRequestBuilder) error {
+		args := &MultiQueryRequest{
+			Requests: []QueryRequest{
+				b.EpochStart(start.Unix()).
+					EpochEnd(start.Add(24 * time.Hour).Unix()).
+					End(),
+			},
+		}
+		var response MultiQueryResponse
+		return service.Query(nil, args, &response)
+	}
+
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC")), IsNil)
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").MaxRowsScanned(100)), NotNil)
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").MaxBytesRead(1000)), NotNil)
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").MaxMemory(1000)), NotNil)
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").MaxMemory(100000000)), IsNil)
+
+	// the last records, scanned backwards
+	last := func() *QueryRequestBuilder {
+		return NewQueryRequestBuilder("USDJPY/1Min/OHLC").LimitRecordCount(1000).LimitFromStart(false)
+	}
+	c.Assert(query(last()), IsNil)
+	c.Assert(query(last().MaxRowsScanned(100)), FitsTypeOf, executor.QueryLimitExceededError(""))
+	c.Assert(query(last().MaxBytesRead(1000)), FitsTypeOf, executor.QueryLimitExceededError(""))
+	c.Assert(query(last().MaxMemory(1000)), FitsTypeOf, executor.QueryLimitExceededError(""))
+	c.Assert(query(last().MaxRowsScanned(100000000)), IsNil)
+	// the buffer of the limit counts, whatever the records read into it
+	c.Assert(query(last().LimitRecordCount(1000000).MaxMemory(1000000)), FitsTypeOf, executor.QueryLimitExceededError(""))
+
+	// Requests can not raise the server limits
+	utils.InstanceConfig.QueryMaxRowsScanned = 100
+	defer func() { utils.InstanceConfig.QueryMaxRowsScanned = 0 }()
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC")), NotNil)
+	c.Assert(query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").MaxRowsScanned(100000000)), NotNil)
+}
+
+func (s *ServerTestSuite) TestQueryPivot(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	start := time.Date(2002, time.October, 1, 10, 0, 0, 0, time.UTC)
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{
+			(NewQueryRequestBuilder("USDJPY,EURUSD/1Min/OHLC").
+				EpochStart(start.Unix()).
+				EpochEnd(start.Add(9 * time.Minute).Unix()).
+				Pivot(true).
+				End()),
+		},
+	}
+
+	var response MultiQueryResponse
+	if err := service.Query(nil, args, &response); err != nil {
+		c.Fatalf("error returned: %s", err)
+	}
+	nmds := response.Responses[0].Result
+	c.Assert(len(nmds.StartIndex), Equals, 1)
+	cs, err := nmds.ToColumnSeries()
+	c.Assert(err, IsNil)
+	c.Assert(cs.Len(), Equals, 10)
+	c.Assert(cs.GetColumnNames(), DeepEquals, []string{
+		"Epoch",
+		"Open_EURUSD", "Open_USDJPY",
+		"High_EURUSD", "High_USDJPY",
+		"Low_EURUSD", "Low_USDJPY",
+		"Close_EURUSD", "Close_USDJPY",
+	})
+}
+
+func (s *ServerTestSuite) TestQueryCSV(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	start := time.Date(2002, time.October, 1, 10, 0, 0, 0, time.UTC)
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{
+			(NewQueryRequestBuilder("USDJPY,EURUSD/1Min/OHLC").
+				EpochStart(start.Unix()).
+				EpochEnd(start.Add(4 * time.Minute).Unix()).
+				Format("csv").
+				TimeFormat("rfc3339").
+				End()),
+		},
+	}
+
+	var response MultiQueryResponse
+	if err := service.Query(nil, args, &response); err != nil {
+		c.Fatalf("error returned: %s", err)
+	}
+	c.Assert(response.Responses[0].Result, IsNil)
+	lines := strings.Split(strings.TrimSpace(string(response.Responses[0].CSV)), "\n")
+	c.Assert(len(lines), Equals, 11)
+	c.Assert(lines[0], Equals, "Key,Epoch,Open,High,Low,Close")
+	c.Assert(strings.HasPrefix(lines[1], "EURUSD/1Min/OHLC,2002-10-01T10:00:00Z,"), Equals, true)
+	c.Assert(strings.HasPrefix(lines[6], "USDJPY/1Min/OHLC,2002-10-01T10:00:00Z,"), Equals, true)
+
+	args.Requests[0].Format = new(string)
+	*args.Requests[0].Format = "xls"
+	c.Assert(service.Query(nil, args, &MultiQueryResponse{}), NotNil)
+}
+
 func (s *ServerTestSuite) TestQueryRange(c *C) {
 	service := &DataService{}
 	service.Init()
@@ -285,6 +549,70 @@ func (s *ServerTestSuite) TestListSymbols(c *C) {
 
 	c.Assert(contains(resp.Results, "EURUSD"), Equals, true)
 	c.Assert(contains(resp.Results, "USDJPY"), Equals, true)
+
+	resp = ListSymbolsResponse{}
+	err := service.ListSymbols(nil, &ListSymbolsArgs{Pattern: "*USD", Offset: 1, Limit: 1}, &resp)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Results, DeepEquals, []string{"NZDUSD"})
+	c.Assert(resp.Total, Equals, 2)
+
+	resp = ListSymbolsResponse{}
+	err = service.ListSymbols(nil, &ListSymbolsArgs{Metadata: true, Pattern: "EURUSD/1Min/*"}, &resp)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Results, IsNil)
+	c.Assert(resp.Buckets, HasLen, 1)
+	md := resp.Buckets[0]
+	c.Assert(md.Key, Equals, "EURUSD/1Min/OHLC")
+	c.Assert(md.ColumnNames, DeepEquals, []string{"Epoch", "Open", "High", "Low", "Close"})
+	c.Assert(md.ColumnTypes, DeepEquals, []string{"int64", "float32", "float32", "float32", "float32"})
+	c.Assert(md.RecordType, Equals, "fixed")
+	c.Assert(md.FirstEpoch > 0, Equals, true)
+	c.Assert(md.LastEpoch > md.FirstEpoch, Equals, true)
+	c.Assert(md.ApproxRows > 0, Equals, true)
+
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{Limit: -1}, &resp), NotNil)
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{Pattern: "[EUR"}, &resp), NotNil)
+}
+
+func (s *ServerTestSuite) TestListSymbolsNamespace(c *C) {
+	utils.InstanceConfig.Namespaces = []*utils.NamespaceSetting{{Name: "alpha"}}
+	auth.Initialize([]*utils.APIKeySetting{
+		{Key: "alpha", Permission: "write", Namespace: "alpha"},
+		{Key: "admin", Permission: "admin"},
+	})
+	defer func() {
+		utils.InstanceConfig.Namespaces = nil
+		auth.Initialize(nil)
+	}()
+	service := &DataService{}
+	service.Init()
+	defer service.Destroy(nil, &MultiKeyRequest{Requests: []KeyRequest{{Key: "alpha.EURUSD/1Min/OHLC"}}}, &MultiServerResponse{})
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{time.Date(2002, time.March, 1, 10, 0, 0, 0, time.UTC).Unix()})
+	for _, name := range []string{"Open", "High", "Low", "Close"} {
+		cs.AddColumn(name, []float32{1.})
+	}
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("alpha.EURUSD/1Min/OHLC"), cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	r, _ := http.NewRequest("POST", "/rpc", nil)
+	r.Header.Set("X-API-Key", "alpha")
+	var resp ListSymbolsResponse
+	c.Assert(service.ListSymbols(r, &ListSymbolsArgs{}, &resp), IsNil)
+	c.Assert(resp.Results, DeepEquals, []string{"alpha.EURUSD"})
+
+	resp = ListSymbolsResponse{}
+	c.Assert(service.ListSymbols(r, &ListSymbolsArgs{Metadata: true}, &resp), IsNil)
+	c.Assert(resp.Buckets, HasLen, 1)
+	c.Assert(resp.Buckets[0].Key, Equals, "alpha.EURUSD/1Min/OHLC")
+
+	// the keys of no namespace list every symbol
+	r.Header.Set("X-API-Key", "admin")
+	resp = ListSymbolsResponse{}
+	c.Assert(service.ListSymbols(r, &ListSymbolsArgs{Pattern: "*EURUSD"}, &resp), IsNil)
+	c.Assert(resp.Results, DeepEquals, []string{"EURUSD", "alpha.EURUSD"})
 }
 
 func (s *ServerTestSuite) TestFunctions(c *C) {
@@ -343,6 +671,51 @@ func (s *ServerTestSuite) TestFunctions(c *C) {
 	c.Assert(t, Equals, tref)
 }
 
+func (s *ServerTestSuite) TestQueryTimezone(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	start := time.Date(2002, time.October, 1, 0, 0, 0, 0, time.UTC)
+	query := func(qb *QueryRequestBuilder) (*MultiQueryResponse, error) {
+		var response MultiQueryResponse
+		err := service.Query(nil, &MultiQueryRequest{Requests: []QueryRequest{qb.
+			EpochStart(start.Unix()).
+			EpochEnd(start.Add(48*time.Hour - time.Second).Unix()).
+			End()}}, &response)
+		return &response, err
+	}
+	dailyBars := func(response *MultiQueryResponse) (epochs []time.Time) {
+		cs, err := response.Responses[0].Result.ToColumnSeries()
+		c.Assert(err, IsNil)
+		for _, epoch := range cs.GetEpoch() {
+			epochs = append(epochs, time.Unix(epoch, 0).UTC())
+		}
+		return epochs
+	}
+	candles := []string{"candlecandler('1D',Open,High,Low,Close)"}
+
+	response, err := query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").Functions(candles))
+	c.Assert(err, IsNil)
+	c.Assert(response.Responses[0].Timezones, IsNil)
+	c.Assert(dailyBars(response), DeepEquals, []time.Time{start, start.AddDate(0, 0, 1)})
+
+	// the days start at midnight in Tokyo
+	response, err = query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").Functions(candles).Timezone("Asia/Tokyo"))
+	c.Assert(err, IsNil)
+	c.Assert(response.Responses[0].Timezones, DeepEquals, map[string]string{"USDJPY/1Min/OHLC": "Asia/Tokyo"})
+	c.Assert(dailyBars(response), DeepEquals, []time.Time{
+		start.Add(-9 * time.Hour), start.Add(15 * time.Hour), start.Add(39 * time.Hour)})
+
+	response, err = query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").
+		Format("csv").TimeFormat("rfc3339").Timezone("Asia/Tokyo"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(strings.Split(string(response.Responses[0].CSV), "\n")[1],
+		"USDJPY/1Min/OHLC,2002-10-01T09:00:00+09:00,"), Equals, true)
+
+	_, err = query(NewQueryRequestBuilder("USDJPY/1Min/OHLC").Timezone("Asia/Nowhere"))
+	c.Assert(err, NotNil)
+}
+
 func printFuncParams(fname string, l_list, p_list []string) {
 	fmt.Printf("LAL funcName=:%s:\n", fname)
 	for i, val := range l_list {
@@ -0,0 +1,78 @@
+// Package requestid tags each request of the API with an id, taken from the
+// X-Request-ID header of the client or else generated, which is echoed in
+// the response and added to the log entries about the request, so that the
+// entries of a request can be found among those of the others.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// Header is the header of the request id, in requests and responses
+const Header = "X-Request-ID"
+
+// maxLength bounds the ids accepted from the clients, which end up in logs
+const maxLength = 128
+
+type contextKey struct{}
+
+// Handler tags the requests of h with their id, and logs them at the debug
+// level once served
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = generate()
+		}
+		w.Header().Set(Header, id)
+		start := time.Now()
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+		log.With("request_id", id).Debug("%s %s served in %v",
+			r.Method, r.URL.Path, time.Since(start))
+	})
+}
+
+// NewContext returns a copy of the context carrying the request id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id of the context, or "" if none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns a logger adding the request id of the context, if any, to
+// its entries
+func Logger(ctx context.Context) *log.Logger {
+	if id := FromContext(ctx); id != "" {
+		return log.With("request_id", id)
+	}
+	return log.With()
+}
+
+// valid returns true if the id is made of printable ASCII characters
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,41 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type RequestIDTestSuite struct{}
+
+var _ = Suite(&RequestIDTestSuite{})
+
+func (s *RequestIDTestSuite) TestHandler(c *C) {
+	var seen string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	// the id of the client is kept
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(Header, "client-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	c.Assert(seen, Equals, "client-42")
+	c.Assert(w.Header().Get(Header), Equals, "client-42")
+
+	// else generated
+	for _, id := range []string{"", "with space", strings.Repeat("x", maxLength+1)} {
+		r, _ = http.NewRequest("GET", "/", nil)
+		r.Header.Set(Header, id)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		c.Assert(seen, HasLen, 16)
+		c.Assert(w.Header().Get(Header), Equals, seen)
+	}
+}
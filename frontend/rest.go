@@ -0,0 +1,535 @@
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/limit"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+/*
+	REST: A plain JSON over HTTP layer on top of DataService, for clients
+	without a msgpack-rpc library.
+
+	GET  /v1/query?destination=AAPL/1Min/OHLCV&start=<epoch>&end=<epoch>&limit=<n>&columns=Open,Close
+	GET  /v1/query?sql=SELECT ...
+	GET  /v1/query?destination=AAPL/1Min/OHLCV&format=csv&time_format=rfc3339
+	POST /v1/write    {"key": "AAPL/1Min/OHLCV", "columns": [{"name": "Epoch", "type": "int64", "values": [...]}, ...]}
+	GET  /v1/symbols
+*/
+
+// RestColumn is a single named and typed column of a JSON bucket. Float
+// values that are NaN are represented as null.
+type RestColumn struct {
+	Name   string        `json:"name"`
+	Type   string        `json:"type"`
+	Values []interface{} `json:"values"`
+	// Number of decimal places of a decimal column, whose values are
+	// numbers or strings; written values with more decimal places are
+	// rounded, and a write without it takes the most decimal places of its
+	// values
+	Scale *int `json:"scale,omitempty"`
+}
+
+// RestBucket is the JSON representation of the data of one time bucket,
+// used in both the query response and the write request.
+type RestBucket struct {
+	Key              string       `json:"key"`
+	Columns          []RestColumn `json:"columns"`
+	IsVariableLength bool         `json:"is_variable_length,omitempty"`
+	// Set in a query response when not the timezone of the server
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type RestQueryResponse struct {
+	Results  []RestBucket `json:"results"`
+	Sampled  bool         `json:"sampled,omitempty"`
+	Version  string       `json:"version"`
+	Timezone string       `json:"timezone"`
+}
+
+type RestWriteResponse struct {
+	Rows int `json:"rows"`
+}
+
+type RestSymbolsResponse struct {
+	Symbols []string `json:"symbols"`
+	// Number of matching symbols before pagination
+	Total int `json:"total"`
+}
+
+type RestErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type RestServer struct {
+	*http.ServeMux
+	service *DataService
+}
+
+func NewRestServer(service *DataService) *RestServer {
+	s := &RestServer{
+		ServeMux: http.NewServeMux(),
+		service:  service,
+	}
+	s.HandleFunc("/v1/query", s.query)
+	s.HandleFunc("/v1/write", s.write)
+	s.HandleFunc("/v1/symbols", s.symbols)
+	return s
+}
+
+func (s *RestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("marketstore-version", utils.GitHash)
+	s.ServeMux.ServeHTTP(w, r)
+}
+
+func (s *RestServer) query(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	req, err := restQueryRequest(r)
+	if err != nil {
+		writeRestError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var response MultiQueryResponse
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		writeRestError(w, auth.Status(err), err)
+		return
+	}
+	err = s.service.Query(r, &MultiQueryRequest{Requests: []QueryRequest{*req}}, &response)
+	if err != nil {
+		writeRestError(w, restStatus(err), err)
+		return
+	}
+
+	if csvFormat, _ := requestCSVFormat(req); csvFormat {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		for _, qr := range response.Responses {
+			if _, err := w.Write(qr.CSV); err != nil {
+				log.Error("Failed to write REST response - Error: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	out := RestQueryResponse{
+		Results:  []RestBucket{},
+		Version:  response.Version,
+		Timezone: response.Timezone,
+	}
+	for _, qr := range response.Responses {
+		out.Sampled = out.Sampled || qr.Sampled
+		if qr.Result == nil {
+			continue
+		}
+		csm, err := qr.Result.ToColumnSeriesMap()
+		if err != nil {
+			writeRestError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for tbk, cs := range csm {
+			bucket := newRestBucket(tbk, cs)
+			bucket.Timezone = qr.Timezones[bucket.Key]
+			out.Results = append(out.Results, bucket)
+		}
+	}
+	sort.Slice(out.Results, func(i, j int) bool {
+		return out.Results[i].Key < out.Results[j].Key
+	})
+	writeRestResponse(w, http.StatusOK, out)
+}
+
+func (s *RestServer) write(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := auth.Authorize(r, auth.WRITE); err != nil {
+		writeRestError(w, auth.Status(err), err)
+		return
+	}
+	var bucket RestBucket
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&bucket); err != nil {
+		writeRestError(w, http.StatusBadRequest, fmt.Errorf("malformed request body: %v", err))
+		return
+	}
+
+	tbk, cs, err := bucket.toColumnSeries()
+	if err != nil {
+		writeRestError(w, http.StatusBadRequest, err)
+		return
+	}
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	if err = authorizeWrite(r, csm); err != nil {
+		recordWrite(r, csm, err)
+		writeRestError(w, auth.Status(err), err)
+		return
+	}
+	err = executor.WriteCSM(csm, bucket.IsVariableLength)
+	recordWrite(r, csm, err)
+	if err != nil {
+		writeRestError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeRestResponse(w, http.StatusOK, RestWriteResponse{Rows: cs.Len()})
+}
+
+func (s *RestServer) symbols(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	if err := auth.Authorize(r, auth.READ); err != nil {
+		writeRestError(w, auth.Status(err), err)
+		return
+	}
+	if atomic.LoadUint32(&Queryable) == 0 {
+		writeRestError(w, http.StatusServiceUnavailable, queryableError)
+		return
+	}
+	params := r.URL.Query()
+	args := &ListSymbolsArgs{Pattern: params.Get("pattern")}
+	for name, value := range map[string]*int{"offset": &args.Offset, "limit": &args.Limit} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeRestError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %v", name, v))
+				return
+			}
+			*value = n
+		}
+	}
+	var response ListSymbolsResponse
+	if err := s.service.ListSymbols(r, args, &response); err != nil {
+		writeRestError(w, http.StatusBadRequest, err)
+		return
+	}
+	out := RestSymbolsResponse{Symbols: response.Results, Total: response.Total}
+	if out.Symbols == nil {
+		out.Symbols = []string{}
+	}
+	writeRestResponse(w, http.StatusOK, out)
+}
+
+// restQueryRequest builds a query request from the URL parameters
+func restQueryRequest(r *http.Request) (*QueryRequest, error) {
+	params := r.URL.Query()
+	var format, timeFormat *string
+	if v := params.Get("format"); v != "" {
+		format = &v
+	}
+	if v := params.Get("time_format"); v != "" {
+		timeFormat = &v
+	}
+	if sql := params.Get("sql"); sql != "" {
+		return &QueryRequest{
+			IsSQLStatement: true,
+			SQLStatement:   sql,
+			Format:         format,
+			TimeFormat:     timeFormat,
+		}, nil
+	}
+
+	destination := params.Get("destination")
+	if destination == "" {
+		return nil, fmt.Errorf("either destination or sql is required")
+	}
+	qb := NewQueryRequestBuilder(destination)
+	if v := params.Get("start"); v != "" {
+		start, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start: %s", v)
+		}
+		qb = qb.EpochStart(start)
+	}
+	if v := params.Get("end"); v != "" {
+		end, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end: %s", v)
+		}
+		qb = qb.EpochEnd(end)
+	}
+	if v := params.Get("start_nanos"); v != "" {
+		start, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start_nanos: %s", v)
+		}
+		qb = qb.EpochStartNanos(start)
+	}
+	if v := params.Get("end_nanos"); v != "" {
+		end, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end_nanos: %s", v)
+		}
+		qb = qb.EpochEndNanos(end)
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit: %s", v)
+		}
+		qb = qb.LimitRecordCount(limit)
+	}
+	if v := params.Get("limit_from_start"); v != "" {
+		fromStart, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit_from_start: %s", v)
+		}
+		qb = qb.LimitFromStart(fromStart)
+	}
+	req := qb.End()
+	if v := params.Get("columns"); v != "" {
+		req.Columns = strings.Split(v, ",")
+	}
+	req.Format = format
+	req.TimeFormat = timeFormat
+	if v := params.Get("timezone"); v != "" {
+		req.Timezone = &v
+	}
+	return &req, nil
+}
+
+func newRestBucket(tbk io.TimeBucketKey, cs *io.ColumnSeries) RestBucket {
+	bucket := RestBucket{
+		Key:     tbk.GetItemKey(),
+		Columns: make([]RestColumn, 0, len(cs.GetColumnNames())),
+	}
+	for _, ds := range cs.GetDataShapes() {
+		col := reflect.ValueOf(cs.GetByName(ds.Name))
+		values := make([]interface{}, col.Len())
+		scale, isDecimal := cs.GetScale(ds.Name)
+		for i := range values {
+			if !cs.IsValid(ds.Name, i) {
+				continue
+			}
+			v := col.Index(i).Interface()
+			if isDecimal {
+				values[i] = json.Number(io.FormatDecimal(v.(int64), scale))
+				continue
+			}
+			switch f := v.(type) {
+			case float32:
+				if math.IsNaN(float64(f)) {
+					v = nil
+				}
+			case float64:
+				if math.IsNaN(f) {
+					v = nil
+				}
+			}
+			values[i] = v
+		}
+		column := RestColumn{
+			Name:   ds.Name,
+			Type:   strings.ToLower(ds.Type.String()),
+			Values: values,
+		}
+		if isDecimal {
+			column.Scale = &scale
+		}
+		bucket.Columns = append(bucket.Columns, column)
+	}
+	return bucket
+}
+
+func (bucket *RestBucket) toColumnSeries() (*io.TimeBucketKey, *io.ColumnSeries, error) {
+	tbk := io.NewTimeBucketKey(bucket.Key)
+	if tbk == nil || len(tbk.GetItemInCategory("Timeframe")) == 0 {
+		return nil, nil, fmt.Errorf("key \"%s\" is not in proper format, should be like: TSLA/1Min/OHLCV",
+			bucket.Key)
+	}
+	if len(bucket.Columns) == 0 {
+		return nil, nil, fmt.Errorf("no columns to write")
+	}
+	cs := io.NewColumnSeries()
+	for _, col := range bucket.Columns {
+		if len(col.Values) != len(bucket.Columns[0].Values) {
+			return nil, nil, fmt.Errorf("column %s has %d values, expected %d",
+				col.Name, len(col.Values), len(bucket.Columns[0].Values))
+		}
+		if io.EnumElementTypeFromName(col.Type) == io.DECIMAL {
+			data, valid, scale, err := col.toDecimals()
+			if err != nil {
+				return nil, nil, err
+			}
+			cs.AddColumn(col.Name, data)
+			cs.SetValidity(col.Name, valid)
+			cs.SetScale(col.Name, scale)
+			continue
+		}
+		data, valid, err := col.toSlice()
+		if err != nil {
+			return nil, nil, err
+		}
+		cs.AddColumn(col.Name, data)
+		cs.SetValidity(col.Name, valid)
+	}
+	if cs.GetEpoch() == nil {
+		return nil, nil, fmt.Errorf("an Epoch column of type int64 is required")
+	}
+	if cs.GetValidity("Epoch") != nil {
+		return nil, nil, fmt.Errorf("the Epoch column cannot have null values")
+	}
+	return tbk, cs, nil
+}
+
+// toSlice converts the JSON values of the column into a slice of its type,
+// and returns their validity if a null is missing a value other than a NaN
+func (col *RestColumn) toSlice() (interface{}, []bool, error) {
+	typ := io.EnumElementTypeFromName(col.Type)
+	if typ == io.NONE {
+		return nil, nil, fmt.Errorf("column %s has unsupported type: %s", col.Name, col.Type)
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(typ.TypeOf()), len(col.Values), len(col.Values))
+	var valid []bool
+	for i, value := range col.Values {
+		elem := out.Index(i)
+		invalid := fmt.Errorf("column %s has invalid %s value: %v", col.Name, col.Type, value)
+		switch v := value.(type) {
+		case nil:
+			switch elem.Kind() {
+			case reflect.Float32, reflect.Float64:
+				elem.SetFloat(math.NaN())
+			default:
+				if valid == nil {
+					valid = make([]bool, len(col.Values))
+					for j := range valid {
+						valid[j] = true
+					}
+				}
+				valid[i] = false
+			}
+		case bool:
+			if elem.Kind() != reflect.Bool {
+				return nil, nil, invalid
+			}
+			elem.SetBool(v)
+		case string:
+			if elem.Kind() != reflect.String {
+				return nil, nil, invalid
+			}
+			elem.SetString(v)
+		case json.Number:
+			switch elem.Kind() {
+			case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				n, err := strconv.ParseInt(v.String(), 10, elem.Type().Bits())
+				if err != nil {
+					return nil, nil, invalid
+				}
+				elem.SetInt(n)
+			case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				n, err := strconv.ParseUint(v.String(), 10, elem.Type().Bits())
+				if err != nil {
+					return nil, nil, invalid
+				}
+				elem.SetUint(n)
+			case reflect.Float32, reflect.Float64:
+				f, err := strconv.ParseFloat(v.String(), elem.Type().Bits())
+				if err != nil {
+					return nil, nil, invalid
+				}
+				elem.SetFloat(f)
+			default:
+				return nil, nil, invalid
+			}
+		default:
+			return nil, nil, invalid
+		}
+	}
+	return out.Interface(), valid, nil
+}
+
+// toDecimals converts the JSON numbers or strings of the decimal column into
+// its values at its scale, and returns their validity if a null is missing
+func (col *RestColumn) toDecimals() ([]int64, []bool, int, error) {
+	texts := make([]string, len(col.Values))
+	var valid []bool
+	scale := 0
+	for i, value := range col.Values {
+		switch v := value.(type) {
+		case nil:
+			if valid == nil {
+				valid = make([]bool, len(col.Values))
+				for j := range valid {
+					valid[j] = true
+				}
+			}
+			valid[i] = false
+			continue
+		case json.Number:
+			texts[i] = v.String()
+		case string:
+			texts[i] = v
+		default:
+			return nil, nil, 0, fmt.Errorf("column %s has invalid %s value: %v", col.Name, col.Type, value)
+		}
+		if dot := strings.IndexByte(texts[i], '.'); dot >= 0 && len(texts[i])-dot-1 > scale {
+			scale = len(texts[i]) - dot - 1
+		}
+	}
+	if col.Scale != nil {
+		scale = *col.Scale
+	}
+	if err := io.ValidScale(scale); err != nil {
+		return nil, nil, 0, fmt.Errorf("column %s: %v", col.Name, err)
+	}
+	out := make([]int64, len(col.Values))
+	for i, text := range texts {
+		if valid != nil && !valid[i] {
+			continue
+		}
+		v, err := io.ParseDecimal(text, scale)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("column %s: %v", col.Name, err)
+		}
+		out[i] = v
+	}
+	return out, valid, scale, nil
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeRestError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+// restStatus returns the HTTP status code for an error of the service
+func restStatus(err error) int {
+	if limit.Limited(err) {
+		return http.StatusTooManyRequests
+	}
+	// bucket permission errors are forbidden, the others bad requests
+	return auth.Status(err)
+}
+
+func writeRestError(w http.ResponseWriter, status int, err error) {
+	writeRestResponse(w, status, RestErrorResponse{Error: err.Error()})
+}
+
+func writeRestResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error("Failed to write REST response - Error: %v", err)
+	}
+}
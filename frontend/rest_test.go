@@ -0,0 +1,211 @@
+package frontend
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestRest(c *C) {
+	service := &DataService{}
+	service.Init()
+	server := httptest.NewServer(NewRestServer(service))
+	defer server.Close()
+
+	get := func(path string, out interface{}) int {
+		resp, err := http.Get(server.URL + path)
+		c.Assert(err, IsNil)
+		defer resp.Body.Close()
+		c.Assert(resp.Header.Get("Content-Type"), Equals, "application/json")
+		c.Assert(json.NewDecoder(resp.Body).Decode(out), IsNil)
+		return resp.StatusCode
+	}
+
+	var symbols RestSymbolsResponse
+	c.Assert(get("/v1/symbols", &symbols), Equals, http.StatusOK)
+	c.Assert(symbols.Symbols, DeepEquals, []string{"EURUSD", "NZDUSD", "USDJPY"})
+	symbols = RestSymbolsResponse{}
+	c.Assert(get("/v1/symbols?pattern=*USD&limit=1", &symbols), Equals, http.StatusOK)
+	c.Assert(symbols.Symbols, DeepEquals, []string{"EURUSD"})
+	c.Assert(symbols.Total, Equals, 2)
+	c.Assert(get("/v1/symbols?offset=x", &symbols), Equals, http.StatusBadRequest)
+
+	var query RestQueryResponse
+	c.Assert(get("/v1/query?destination=USDJPY,EURUSD/1Min/OHLC&limit=5&columns=Open,Close", &query),
+		Equals, http.StatusOK)
+	c.Assert(len(query.Results), Equals, 2)
+	c.Assert(query.Results[0].Key, Equals, "EURUSD/1Min/OHLC")
+	names := []string{}
+	for _, col := range query.Results[0].Columns {
+		names = append(names, col.Name)
+		c.Assert(len(col.Values), Equals, 5)
+	}
+	c.Assert(names, DeepEquals, []string{"Epoch", "Open", "Close"})
+	c.Assert(query.Results[0].Columns[0].Type, Equals, "int64")
+
+	// Write back as another symbol and read it again
+	bucket := query.Results[0]
+	bucket.Key = "RESTTEST/1Min/OHLC"
+	body, _ := json.Marshal(bucket)
+	resp, err := http.Post(server.URL+"/v1/write", "application/json", bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	var written RestWriteResponse
+	c.Assert(json.NewDecoder(resp.Body).Decode(&written), IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(written.Rows, Equals, 5)
+
+	var readBack RestQueryResponse
+	c.Assert(get("/v1/query?destination=RESTTEST/1Min/OHLC", &readBack), Equals, http.StatusOK)
+	c.Assert(len(readBack.Results), Equals, 1)
+	c.Assert(readBack.Results[0].Columns, DeepEquals, bucket.Columns)
+
+	// null values of an integer column are missing
+	resp, err = http.Post(server.URL+"/v1/write", "application/json",
+		strings.NewReader(`{"key": "RESTNULL/1Min/OHLCV", "columns": [{"name": "Epoch", "type": "int64", "values": [60, 120]},
+			{"name": "Volume", "type": "int64", "values": [5, null]}]}`))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	readBack = RestQueryResponse{}
+	c.Assert(get("/v1/query?destination=RESTNULL/1Min/OHLCV&start=0", &readBack), Equals, http.StatusOK)
+	c.Assert(len(readBack.Results), Equals, 1)
+	c.Assert(readBack.Results[0].Columns[1].Values, DeepEquals, []interface{}{float64(5), nil})
+
+	// decimals take the most decimal places of the values without a scale
+	resp, err = http.Post(server.URL+"/v1/write", "application/json",
+		strings.NewReader(`{"key": "RESTDEC/1Min/OHLCV", "columns": [{"name": "Epoch", "type": "int64", "values": [60, 120]},
+			{"name": "Price", "type": "decimal", "values": ["123.456", 1.5]}]}`))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	readBack = RestQueryResponse{}
+	c.Assert(get("/v1/query?destination=RESTDEC/1Min/OHLCV&start=0", &readBack), Equals, http.StatusOK)
+	c.Assert(len(readBack.Results), Equals, 1)
+	price := readBack.Results[0].Columns[1]
+	c.Assert(price.Type, Equals, "decimal")
+	c.Assert(*price.Scale, Equals, 3)
+	c.Assert(price.Values, DeepEquals, []interface{}{123.456, 1.5})
+
+	// CSV
+	resp, err = http.Get(server.URL + "/v1/query?destination=RESTTEST/1Min/OHLC&format=csv")
+	c.Assert(err, IsNil)
+	csv, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "text/csv")
+	c.Assert(len(strings.Split(strings.TrimSpace(string(csv)), "\n")), Equals, 6)
+	c.Assert(strings.HasPrefix(string(csv), "Key,Epoch,Open,Close\n"), Equals, true)
+
+	// Errors
+	var restErr RestErrorResponse
+	c.Assert(get("/v1/query", &restErr), Equals, http.StatusBadRequest)
+	c.Assert(restErr.Error, Not(Equals), "")
+	c.Assert(get("/v1/query?destination=EURUSD/1Min/OHLC&limit=x", &restErr), Equals, http.StatusBadRequest)
+
+	resp, err = http.Post(server.URL+"/v1/write", "application/json",
+		strings.NewReader(`{"key": "RESTTEST/1Min/OHLC", "columns": [{"name": "Epoch", "type": "int64", "values": [1.5]}]}`))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusBadRequest)
+
+	resp, err = http.Post(server.URL+"/v1/symbols", "application/json", nil)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *ServerTestSuite) TestRestAuth(c *C) {
+	auth.Initialize([]*utils.APIKeySetting{
+		{Key: "reader", Permission: "read"},
+	})
+	defer auth.Initialize(nil)
+
+	service := &DataService{}
+	service.Init()
+	server := httptest.NewServer(NewRestServer(service))
+	defer server.Close()
+
+	do := func(method, path, key string) int {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader("{}"))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	c.Assert(do("GET", "/v1/symbols", ""), Equals, http.StatusUnauthorized)
+	c.Assert(do("GET", "/v1/symbols", "reader"), Equals, http.StatusOK)
+	c.Assert(do("POST", "/v1/write", "reader"), Equals, http.StatusForbidden)
+
+	// RPC methods check the permission of the request key
+	req, _ := http.NewRequest("POST", "/rpc", nil)
+	req.Header.Set("X-API-Key", "reader")
+	err := service.Destroy(req, &MultiKeyRequest{
+		Requests: []KeyRequest{{Key: "EURUSD/1Min/OHLC"}},
+	}, &MultiServerResponse{})
+	c.Assert(err, NotNil)
+	c.Assert(auth.Status(err), Equals, http.StatusForbidden)
+}
+
+func (s *ServerTestSuite) TestBucketAccess(c *C) {
+	auth.Initialize([]*utils.APIKeySetting{
+		{Key: "analyst", Permission: "write", Buckets: []*utils.BucketAccessSetting{
+			{Pattern: "EURUSD/1Min/*", Permission: "write"},
+			{Pattern: "NZDUSD/*/*", Permission: "read"},
+		}},
+	})
+	defer auth.Initialize(nil)
+
+	service := &DataService{}
+	service.Init()
+	r, _ := http.NewRequest("POST", "/rpc", nil)
+	r.Header.Set("X-API-Key", "analyst")
+
+	query := func(destination string) (string, error) {
+		var response MultiQueryResponse
+		err := service.Query(r, &MultiQueryRequest{
+			Requests: []QueryRequest{
+				NewQueryRequestBuilder(destination).LimitRecordCount(1).Format("csv").End(),
+			},
+		}, &response)
+		if err != nil {
+			return "", err
+		}
+		return string(response.Responses[0].CSV), nil
+	}
+
+	// the symbols the key may not read are left out of a * query
+	csv, err := query("*/1Min/OHLC")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(csv, "EURUSD/1Min/OHLC"), Equals, true)
+	c.Assert(strings.Contains(csv, "NZDUSD/1Min/OHLC"), Equals, true)
+	c.Assert(strings.Contains(csv, "USDJPY/1Min/OHLC"), Equals, false)
+
+	_, err = query("EURUSD,USDJPY/1Min/OHLC")
+	c.Assert(auth.Status(err), Equals, http.StatusForbidden)
+
+	err = service.Query(r, &MultiQueryRequest{
+		Requests: []QueryRequest{{IsSQLStatement: true, SQLStatement: "SELECT * FROM `USDJPY/1Min/OHLC`;"}},
+	}, &MultiQueryResponse{})
+	c.Assert(auth.Status(err), Equals, http.StatusForbidden)
+
+	// writes are checked per bucket
+	var response MultiServerResponse
+	err = service.Create(r, &MultiCreateRequest{
+		Requests: []CreateRequest{
+			{Key: "NZDUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Open/float32", RowType: "fixed"},
+		},
+	}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(response.Responses[0].Error, "write permission on NZDUSD/1Min/OHLC"), Equals, true)
+}
@@ -0,0 +1,140 @@
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/gobwas/glob"
+)
+
+type GetSchemaArgs struct {
+	// Bucket keys such as "AAPL/1Min/OHLCV", or glob patterns of them such
+	// as "*/1Min/*", all the buckets if empty
+	Keys []string `msgpack:"keys"`
+}
+
+type GetSchemaResponse struct {
+	// Schemas of the buckets matching a key, sorted by key
+	Schemas []BucketSchema `msgpack:"schemas"`
+}
+
+// BucketSchema describes the columns of a bucket as they are written and
+// queried, without its hidden columns
+type BucketSchema struct {
+	Key        string         `msgpack:"key"`
+	Columns    []ColumnSchema `msgpack:"columns"`
+	RecordType string         `msgpack:"record_type"`
+	// Timeframe of the index of the records, such as "1Min"
+	Timeframe string `msgpack:"timeframe"`
+	// Set for a nanosecond bucket, whose Epoch is in nanoseconds
+	Nanoseconds bool `msgpack:"nanoseconds"`
+	// Set for a sequenced bucket, keyed by the time and the Sequence
+	Sequenced bool   `msgpack:"sequenced"`
+	Timezone  string `msgpack:"timezone"`
+	// User metadata of the bucket, see SetMetadata
+	Metadata map[string]string `msgpack:"metadata,omitempty"`
+}
+
+type ColumnSchema struct {
+	Name string `msgpack:"name"`
+	Type string `msgpack:"type"`
+	// Number of decimal places of a decimal column
+	Scale *int `msgpack:"scale,omitempty"`
+	// Set for a column which can miss values
+	Nullable bool `msgpack:"nullable"`
+}
+
+// GetSchema returns the schemas of the buckets matching the keys, without
+// querying their data, leaving out the buckets the API key may not read
+func (s *DataService) GetSchema(r *http.Request, args *GetSchemaArgs, response *GetSchemaResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	if atomic.LoadUint32(&Queryable) == 0 {
+		return queryableError
+	}
+	var patterns []glob.Glob
+	for _, key := range args.Keys {
+		pattern, err := glob.Compile(key, '/')
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %v", key, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matches := func(key string) bool {
+		for _, pattern := range patterns {
+			if pattern.Match(key) {
+				return true
+			}
+		}
+		return len(patterns) == 0
+	}
+
+	buckets := gatherBuckets()
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		if matches(key) && auth.AuthorizeBucket(r, auth.READ, key) == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		schema, err := newBucketSchema(key)
+		if err != nil {
+			return err
+		}
+		response.Schemas = append(response.Schemas, schema)
+	}
+	return nil
+}
+
+func newBucketSchema(key string) (BucketSchema, error) {
+	tbk := io.NewTimeBucketKey(key)
+	tbi, err := executor.ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(tbk)
+	if err != nil {
+		return BucketSchema{}, fmt.Errorf("unable to get the schema of %s: %v", key, err)
+	}
+	scales, err := executor.ThisInstance.CatalogDir.GetScales(tbk)
+	if err != nil {
+		return BucketSchema{}, fmt.Errorf("unable to get the scales of %s: %v", key, err)
+	}
+	metadata, err := executor.ThisInstance.CatalogDir.GetMetadata(tbk)
+	if err != nil {
+		return BucketSchema{}, fmt.Errorf("unable to get the metadata of %s: %v", key, err)
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	nullable := executor.NullableColumns(tbi)
+	schema := BucketSchema{
+		Key:         key,
+		RecordType:  strings.ToLower(tbi.GetRecordType().String()),
+		Timeframe:   tbk.GetItemInCategory("Timeframe"),
+		Nanoseconds: executor.NanosecondIndexed(*tbk),
+		Sequenced:   executor.Sequenced(*tbk),
+		Timezone:    executor.BucketTimezone(*tbk).String(),
+		Metadata:    metadata,
+	}
+	for _, shape := range tbi.GetDataShapesWithEpoch() {
+		if executor.HiddenColumn(shape.Name) {
+			continue
+		}
+		column := ColumnSchema{
+			Name:     shape.Name,
+			Type:     strings.ToLower(shape.Type.String()),
+			Nullable: nullable[shape.Name],
+		}
+		if shape.Type == io.DECIMAL {
+			scale := scales[shape.Name]
+			column.Scale = &scale
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	return schema, nil
+}
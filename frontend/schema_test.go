@@ -0,0 +1,47 @@
+package frontend
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestGetSchema(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var created MultiServerResponse
+	err := service.Create(nil, &MultiCreateRequest{
+		Requests: []CreateRequest{
+			{Key: "SCHEMA/1Min/TRADE:Symbol/Timeframe/AttributeGroup",
+				DataShapes: "Epoch/int64:Price/decimal:Size/int32:Nulls/uint64",
+				RowType:    "variable", Scales: map[string]int{"Price": 2}},
+		},
+	}, &created)
+	c.Assert(err, IsNil)
+	defer service.Destroy(nil, &MultiKeyRequest{Requests: []KeyRequest{{Key: "SCHEMA/1Min/TRADE"}}}, &MultiServerResponse{})
+	c.Assert(created.Responses[0].Error, Equals, "")
+
+	var response GetSchemaResponse
+	err = service.GetSchema(nil, &GetSchemaArgs{Keys: []string{"SCHEMA/*/*", "EURUSD/1Min/OHLC"}}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Schemas, HasLen, 2)
+
+	eurusd := response.Schemas[0]
+	c.Check(eurusd.Key, Equals, "EURUSD/1Min/OHLC")
+	c.Check(eurusd.RecordType, Equals, "fixed")
+	c.Check(eurusd.Timeframe, Equals, "1Min")
+	c.Check(eurusd.Columns[0], DeepEquals, ColumnSchema{Name: "Epoch", Type: "int64"})
+
+	// the hidden Nulls column is left out, the columns before it can miss
+	// values
+	trade := response.Schemas[1]
+	c.Check(trade.Key, Equals, "SCHEMA/1Min/TRADE")
+	c.Check(trade.RecordType, Equals, "variable")
+	scale := 2
+	c.Check(trade.Columns, DeepEquals, []ColumnSchema{
+		{Name: "Epoch", Type: "int64"},
+		{Name: "Price", Type: "decimal", Scale: &scale, Nullable: true},
+		{Name: "Size", Type: "int32", Nullable: true},
+	})
+
+	c.Check(service.GetSchema(nil, &GetSchemaArgs{Keys: []string{"[*/1Min/OHLC"}}, &response), NotNil)
+}
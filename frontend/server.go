@@ -3,7 +3,9 @@ package frontend
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/alpacahq/marketstore/frontend/auth"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/log"
 	"github.com/alpacahq/marketstore/utils/rpc/msgpack2"
@@ -26,6 +28,29 @@ type RpcServer struct {
 
 func (s *RpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("marketstore-version", utils.GitHash)
+	// reject requests without a valid key up front, the permission
+	// required for each method is checked by the method itself
+	if err := auth.Authorize(r, auth.READ); err == auth.UnauthenticatedError {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	version, err := negotiateVersion(r.Header.Get(APIVersionHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(APIVersionHeader, strconv.Itoa(version))
+	r = withAPIVersion(r, version)
+	if r.Method == http.MethodPost {
+		calls, ok := readBatch(w, r)
+		if !ok {
+			return
+		}
+		if calls != nil {
+			s.serveBatch(w, r, calls)
+			return
+		}
+	}
 	s.Server.ServeHTTP(w, r)
 }
 
@@ -0,0 +1,243 @@
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/rpc/msgpack2"
+)
+
+// partitionSymbols splits the symbols of a query between this instance and
+// the other shards owning them, by shard name.  The "*" symbol is queried
+// on every shard.
+func partitionSymbols(symbols []string) (local []string, remote map[string][]string) {
+	config := &utils.InstanceConfig
+	remote = map[string][]string{}
+	if len(symbols) == 1 && symbols[0] == "*" {
+		for _, shard := range config.Shards {
+			if shard.Name != config.ShardName {
+				remote[shard.Name] = symbols
+			}
+		}
+		return symbols, remote
+	}
+	for _, symbol := range symbols {
+		if config.OwnsSymbol(symbol) {
+			local = append(local, symbol)
+			continue
+		}
+		shard := config.ShardOf(symbol).Name
+		remote[shard] = append(remote[shard], symbol)
+	}
+	return local, remote
+}
+
+// queryShards runs the query on the symbols of the other shards at once,
+// returning their merged results.  The results of "*" are those of the
+// symbols owned by the shard which returned them.
+func queryShards(r *http.Request, req *QueryRequest, remote map[string][]string,
+	timeframe, recordFormat string) (io.ColumnSeriesMap, error) {
+
+	var queries []instanceQuery
+	for _, shard := range utils.InstanceConfig.Shards {
+		symbols, ok := remote[shard.Name]
+		if !ok {
+			continue
+		}
+		shard := shard
+		queries = append(queries, instanceQuery{
+			name:    "shard " + shard.Name,
+			url:     shard.URL,
+			apiKey:  shard.APIKey,
+			symbols: symbols,
+			keep: func(tbk io.TimeBucketKey) bool {
+				return symbols[0] != "*" || ownedBy(r, shard, tbk)
+			},
+		})
+	}
+	return queryInstances(req, queries, timeframe, recordFormat)
+}
+
+// instanceQuery is the query of symbols on another instance, whose results
+// are kept if keep returns true for their bucket
+type instanceQuery struct {
+	name, url, apiKey string
+	symbols           []string
+	keep              func(tbk io.TimeBucketKey) bool
+}
+
+// queryInstances runs the queries on their instances at once, returning
+// their merged results, an instance without any of the buckets having
+// nothing to merge
+func queryInstances(req *QueryRequest, queries []instanceQuery, timeframe, recordFormat string) (io.ColumnSeriesMap, error) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	csm := io.NewColumnSeriesMap()
+	for _, q := range queries {
+		wg.Add(1)
+		go func(q instanceQuery) {
+			defer wg.Done()
+			result, err := queryInstance(q.url, q.apiKey, shardRequest(req, q.symbols, timeframe, recordFormat))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("query of %s failed: %v", q.name, err))
+				return
+			}
+			for tbk, cs := range result {
+				if q.keep(tbk) {
+					csm[tbk] = cs
+				}
+			}
+		}(q)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if !strings.Contains(err.Error(), planner.ErrNoFiles.Error()) {
+			return nil, err
+		}
+	}
+	if len(csm) == 0 && len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return csm, nil
+}
+
+// ownedBy returns whether the shard owns the symbol of a bucket returned for
+// "*", leaving out the buckets the key may not read
+func ownedBy(r *http.Request, shard *utils.ShardSetting, tbk io.TimeBucketKey) bool {
+	return utils.InstanceConfig.ShardOf(tbk.GetItemInCategory("Symbol")) == shard &&
+		auth.AuthorizeBucket(r, auth.READ, tbk.GetItemKey()) == nil
+}
+
+// shardRequest is the query of the symbols on their shard, or remote, the adjustment,
+// session filter, stitching, functions, pivot and formatting being applied to the
+// merged results
+func shardRequest(req *QueryRequest, symbols []string, timeframe, recordFormat string) *QueryRequest {
+	sreq := *req
+	sreq.Destination = strings.Join(symbols, ",") + "/" + timeframe + "/" + recordFormat
+	sreq.Functions = nil
+	sreq.Pivot = nil
+	sreq.Format = nil
+	sreq.TimeFormat = nil
+	sreq.Adjust = nil
+	sreq.Session = nil
+	sreq.Stitch = nil
+	sreq.Local = true
+	return &sreq
+}
+
+// queryInstance calls the Query RPC of the instance at the URL
+func queryInstance(url, apiKey string, req *QueryRequest) (io.ColumnSeriesMap, error) {
+	var response MultiQueryResponse
+	err := callInstance(url, apiKey, "Query", &MultiQueryRequest{Requests: []QueryRequest{*req}}, &response)
+	if err != nil {
+		return nil, err
+	}
+	csm, err := response.ToColumnSeriesMap()
+	if err != nil || csm == nil {
+		return nil, err
+	}
+	return *csm, nil
+}
+
+// ShardListing tells how current the symbols of a shard listed by
+// ListSymbols are, its catalog being read at AsOf, or why they are missing
+type ShardListing struct {
+	Name string `msgpack:"name"`
+	// Unix epoch of the listing, the buckets created after it are missing
+	AsOf  int64  `msgpack:"as_of"`
+	Error string `msgpack:"error,omitempty"`
+}
+
+// listShards lists the symbols, or buckets, of the other shards at once,
+// those they own and the request may read.  A shard failing to answer is
+// reported in its listing, its symbols being left out.
+func listShards(r *http.Request, args *ListSymbolsArgs) (
+	symbols []string, buckets []BucketMetadata, listings []ShardListing) {
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	sargs := &ListSymbolsArgs{Metadata: args.Metadata, Pattern: args.Pattern, Local: true}
+	for _, shard := range utils.InstanceConfig.Shards {
+		if shard.Name == utils.InstanceConfig.ShardName {
+			continue
+		}
+		listings = append(listings, ShardListing{Name: shard.Name})
+		wg.Add(1)
+		go func(shard *utils.ShardSetting, listing *ShardListing) {
+			defer wg.Done()
+			var response ListSymbolsResponse
+			err := callShard(shard, "ListSymbols", sargs, &response)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				listing.Error = err.Error()
+				return
+			}
+			listing.AsOf = time.Now().Unix()
+			for _, symbol := range response.Results {
+				if utils.InstanceConfig.ShardOf(symbol) == shard {
+					symbols = append(symbols, symbol)
+				}
+			}
+			for _, md := range response.Buckets {
+				symbol := strings.SplitN(md.Key, "/", 2)[0]
+				if utils.InstanceConfig.ShardOf(symbol) == shard &&
+					auth.AuthorizeBucket(r, auth.READ, md.Key) == nil {
+					buckets = append(buckets, md)
+				}
+			}
+		}(shard, &listings[len(listings)-1])
+	}
+	wg.Wait()
+	return symbols, buckets, listings
+}
+
+// callShard calls the RPC method of the shard
+func callShard(shard *utils.ShardSetting, method string, args, reply interface{}) error {
+	return callInstance(shard.URL, shard.APIKey, method, args, reply)
+}
+
+// callInstance calls the RPC method of the instance at the URL, with the
+// API key if not empty
+func callInstance(url, apiKey, method string, args, reply interface{}) error {
+	message, err := msgpack2.EncodeClientRequest("DataService."+method, args)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequest("POST", strings.TrimSuffix(url, "/")+"/rpc", bytes.NewBuffer(message))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/x-msgpack")
+	hreq.Header.Set(APIVersionHeader, strconv.Itoa(CurrentAPIVersion))
+	if apiKey != "" {
+		hreq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := http.DefaultClient.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("response error (%d): %s", resp.StatusCode, string(body))
+	}
+	return msgpack2.DecodeClientResponse(resp.Body, reply)
+}
@@ -0,0 +1,110 @@
+package frontend
+
+import (
+	"math"
+	"net/http/httptest"
+	"sort"
+
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestQueryShards(c *C) {
+	// the other shard is this instance, reading its own buckets for the
+	// coordinator
+	serv, _ := NewServer()
+	server := httptest.NewServer(serv)
+	defer server.Close()
+
+	utils.InstanceConfig.ShardName = "a"
+	utils.InstanceConfig.Shards = []*utils.ShardSetting{
+		{Name: "a", Symbols: []string{"USDJPY"}},
+		{Name: "b", URL: server.URL, Symbols: []string{"EUR*"}},
+	}
+	defer func() { utils.InstanceConfig.ShardName, utils.InstanceConfig.Shards = "", nil }()
+
+	service := &DataService{}
+	service.Init()
+	query := func(destination string) []string {
+		args := &MultiQueryRequest{
+			Requests: []QueryRequest{
+				NewQueryRequestBuilder(destination).
+					EpochStart(0).
+					EpochEnd(math.MaxInt32).
+					LimitRecordCount(10).
+					End(),
+			},
+		}
+		var response MultiQueryResponse
+		c.Assert(service.Query(nil, args, &response), IsNil)
+		csm, err := response.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		var keys []string
+		for tbk, cs := range *csm {
+			c.Assert(cs.Len(), Equals, 10)
+			keys = append(keys, tbk.String())
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	c.Assert(query("USDJPY,EURUSD/1Min/OHLC"), DeepEquals, []string{
+		"EURUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+		"USDJPY/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+	})
+	// remote alone
+	c.Assert(query("EURUSD/1Min/OHLC"), DeepEquals, []string{
+		"EURUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+	})
+	// the unowned NZDUSD is read locally, EURUSD from its shard alone
+	c.Assert(query("*/1Min/OHLC"), DeepEquals, []string{
+		"EURUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+		"NZDUSD/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+		"USDJPY/1Min/OHLC:Symbol/Timeframe/AttributeGroup",
+	})
+
+	// an unreachable shard fails the query
+	utils.InstanceConfig.Shards[1].URL = "http://127.0.0.1:1"
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("USDJPY,EURUSD/1Min/OHLC").End()},
+	}
+	c.Assert(service.Query(nil, args, &MultiQueryResponse{}), NotNil)
+}
+
+func (s *ServerTestSuite) TestListSymbolsShards(c *C) {
+	serv, _ := NewServer()
+	server := httptest.NewServer(serv)
+	defer server.Close()
+
+	utils.InstanceConfig.ShardName = "a"
+	utils.InstanceConfig.Shards = []*utils.ShardSetting{
+		{Name: "a", Symbols: []string{"USDJPY"}},
+		{Name: "b", URL: server.URL, Symbols: []string{"EUR*"}},
+	}
+	defer func() { utils.InstanceConfig.ShardName, utils.InstanceConfig.Shards = "", nil }()
+
+	service := &DataService{}
+	service.Init()
+	var response ListSymbolsResponse
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{}, &response), IsNil)
+	c.Assert(response.Results, DeepEquals, []string{"EURUSD", "NZDUSD", "USDJPY"})
+	c.Assert(response.Shards, HasLen, 1)
+	c.Assert(response.Shards[0].Name, Equals, "b")
+	c.Assert(response.Shards[0].AsOf > 0, Equals, true)
+	c.Assert(response.Shards[0].Error, Equals, "")
+
+	response = ListSymbolsResponse{}
+	args := &ListSymbolsArgs{Metadata: true, Pattern: "*/1Min/OHLC", Offset: 1}
+	c.Assert(service.ListSymbols(nil, args, &response), IsNil)
+	c.Assert(response.Total, Equals, 3)
+	c.Assert(response.Buckets, HasLen, 2)
+	c.Assert(response.Buckets[0].Key, Equals, "NZDUSD/1Min/OHLC")
+	c.Assert(response.Buckets[1].Key, Equals, "USDJPY/1Min/OHLC")
+
+	// an unreachable shard is reported, its symbols left out
+	utils.InstanceConfig.Shards[1].URL = "http://127.0.0.1:1"
+	response = ListSymbolsResponse{}
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{}, &response), IsNil)
+	c.Assert(response.Results, DeepEquals, []string{"NZDUSD", "USDJPY"})
+	c.Assert(response.Shards[0].Error, Not(Equals), "")
+}
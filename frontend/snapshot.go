@@ -0,0 +1,149 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/frontend/limit"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+// This is the parameter interface for DataService.Snapshot method.
+type SnapshotRequest struct {
+	// Each destination is <symbol>/<timeframe>/<attributegroup>, the symbol
+	// may be a comma separated list of symbols
+	Destinations []string `msgpack:"destinations"`
+	// Symbols whose state is taken in each of the buckets, every bucket being
+	// <timeframe>/<attributegroup>, e.g. the latest bar, quote and
+	// fundamentals of the symbols with 1Min/OHLCV, TICK/QUOTE and
+	// 1D/FUNDAMENTALS.  Each bucket is a destination of all the symbols.
+	Symbols []string `msgpack:"symbols,omitempty"`
+	Buckets []string `msgpack:"buckets,omitempty"`
+	// This is not usually set, defaults to Symbol/Timeframe/AttributeGroup
+	KeyCategory string `msgpack:"key_category,omitempty"`
+	// Time of the snapshot (i.e. index <= as_of) in unix epoch second
+	AsOf int64 `msgpack:"as_of"`
+	// Lookback is the seconds before AsOf the latest record is looked for,
+	// bounding the reverse scan of the buckets without a recent record, 0
+	// for no bound
+	Lookback int64 `msgpack:"lookback,omitempty"`
+	// Array of column names to be returned
+	Columns []string `msgpack:"columns,omitempty"`
+}
+
+// Snapshot returns the most recent record at or before AsOf for every
+// requested bucket in a single call, with one response per destination.
+// Buckets that do not exist or have no record before AsOf are left out, as
+// are those without one within the Lookback.  Each bucket is scanned
+// backwards from AsOf until its latest record.
+func (s *DataService) Snapshot(r *http.Request, req *SnapshotRequest, response *MultiQueryResponse) (err error) {
+	if req == nil {
+		return argsNilError
+	}
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	release, err := limit.Acquire(r)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer observeDuration("snapshot", time.Now())
+	response.Version = utils.GitHash
+	response.Timezone = utils.InstanceConfig.Timezone.String()
+
+	if req.Lookback < 0 {
+		return fmt.Errorf("negative lookback %d", req.Lookback)
+	}
+	start := io.ToSystemTimezone(time.Unix(0, 0))
+	if req.Lookback > 0 && req.AsOf-req.Lookback > 0 {
+		start = io.ToSystemTimezone(time.Unix(req.AsOf-req.Lookback, 0))
+	}
+	stop := io.ToSystemTimezone(time.Unix(req.AsOf, 999999999))
+	columns := make([]string, 0)
+	if req.Columns != nil {
+		columns = req.Columns
+	}
+
+	destinations, err := snapshotDestinations(req)
+	if err != nil {
+		return err
+	}
+	for _, destination := range destinations {
+		dest := io.NewTimeBucketKey(destination, req.KeyCategory)
+		if len(dest.GetItemInCategory("Timeframe")) == 0 ||
+			len(dest.GetItemInCategory("AttributeGroup")) == 0 ||
+			len(dest.GetMultiItemInCategory("Symbol")) == 0 {
+			return fmt.Errorf("destinations must have a Symbol, Timeframe and AttributeGroup, have: %s",
+				dest.String())
+		}
+		for _, symbol := range dest.GetMultiItemInCategory("Symbol") {
+			itemKey := symbol + "/" + dest.GetItemInCategory("Timeframe") + "/" + dest.GetItemInCategory("AttributeGroup")
+			if err = auth.AuthorizeBucket(r, auth.READ, itemKey); err != nil {
+				return err
+			}
+		}
+
+		csm, err := executeQuery(dest, start, stop, 1, false, columns, 0,
+			planner.DefaultResourceLimits())
+		if err != nil {
+			if errors.Is(err, planner.ErrNoFiles) {
+				// No data for this destination, the others are still returned
+				continue
+			}
+			return err
+		}
+
+		/*
+			Symbols within a destination share a record format and are packed together
+		*/
+		var nmds *io.NumpyMultiDataset
+		for tbk, cs := range csm {
+			if cs == nil || cs.Len() == 0 {
+				continue
+			}
+			if nmds == nil {
+				nds, err := io.NewNumpyDataset(cs)
+				if err != nil {
+					return err
+				}
+				if nmds, err = io.NewNumpyMultiDataset(nds, tbk); err != nil {
+					return err
+				}
+			} else if err = nmds.Append(cs, tbk); err != nil {
+				return err
+			}
+		}
+		if nmds != nil {
+			response.Responses = append(response.Responses, QueryResponse{Result: nmds})
+		}
+	}
+	return response.shape(apiVersion(r))
+}
+
+// snapshotDestinations returns the destinations of the request, followed by
+// one for each of its buckets with all of its symbols
+func snapshotDestinations(req *SnapshotRequest) ([]string, error) {
+	if len(req.Symbols) > 0 && len(req.Buckets) == 0 ||
+		len(req.Buckets) > 0 && len(req.Symbols) == 0 {
+		return nil, fmt.Errorf("symbols and buckets must be requested together")
+	}
+	destinations := req.Destinations
+	if len(req.Buckets) > 0 {
+		destinations = append([]string{}, req.Destinations...)
+		symbols := strings.Join(req.Symbols, ",")
+		for _, bucket := range req.Buckets {
+			if strings.Count(bucket, "/") != 1 {
+				return nil, fmt.Errorf("buckets must be <timeframe>/<attributegroup>, have: %s", bucket)
+			}
+			destinations = append(destinations, symbols+"/"+bucket)
+		}
+	}
+	return destinations, nil
+}
@@ -0,0 +1,102 @@
+package frontend
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
+)
+
+func (s *ServerTestSuite) TestSnapshot(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	asOf := time.Date(2002, time.October, 1, 10, 5, 30, 0, time.UTC)
+	args := &SnapshotRequest{
+		Destinations: []string{
+			"USDJPY,EURUSD/1Min/OHLC",
+			"NZDUSD/1H/OHLC",
+			"XXXYYY/1Min/OHLC",
+		},
+		AsOf: asOf.Unix(),
+	}
+
+	var response MultiQueryResponse
+	if err := service.Snapshot(nil, args, &response); err != nil {
+		c.Fatalf("error returned: %s", err)
+	}
+	// The unknown symbol is left out of the result
+	c.Assert(len(response.Responses), Equals, 2)
+
+	csm, err := response.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Assert(len(*csm), Equals, 3)
+	for tbk, cs := range *csm {
+		c.Assert(cs.Len(), Equals, 1)
+		epoch := time.Unix(cs.GetEpoch()[0], 0).UTC()
+		switch tbk.GetItemInCategory("Timeframe") {
+		case "1Min":
+			c.Assert(epoch, Equals, time.Date(2002, time.October, 1, 10, 5, 0, 0, time.UTC))
+		case "1H":
+			c.Assert(epoch, Equals, time.Date(2002, time.October, 1, 10, 0, 0, 0, time.UTC))
+		}
+	}
+
+	// Nothing before the start of the data
+	args.AsOf = time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	response = MultiQueryResponse{}
+	c.Assert(service.Snapshot(nil, args, &response), IsNil)
+	c.Assert(len(response.Responses), Equals, 0)
+
+	args.Destinations = []string{"USDJPY"}
+	c.Assert(service.Snapshot(nil, args, &response) != nil, Equals, true)
+
+	// The errors of the scans are returned, not a partial snapshot
+	args.Destinations = []string{"USDJPY/1Min/OHLC", "XXXYYY/1Min/OHLC"}
+	args.AsOf = asOf.Unix()
+	utils.InstanceConfig.QueryMaxRowsScanned = 1
+	response = MultiQueryResponse{}
+	err = service.Snapshot(nil, args, &response)
+	utils.InstanceConfig.QueryMaxRowsScanned = 0
+	c.Assert(err, FitsTypeOf, executor.QueryLimitExceededError(""))
+
+	// The symbols in each of the buckets
+	args = &SnapshotRequest{
+		Symbols: []string{"USDJPY", "EURUSD"},
+		Buckets: []string{"1Min/OHLC", "1D/OHLC"},
+		AsOf:    asOf.Unix(),
+	}
+	response = MultiQueryResponse{}
+	c.Assert(service.Snapshot(nil, args, &response), IsNil)
+	c.Assert(len(response.Responses), Equals, 2)
+	csm, err = response.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Assert(len(*csm), Equals, 4)
+	for tbk, cs := range *csm {
+		c.Assert(cs.Len(), Equals, 1)
+		epoch := time.Unix(cs.GetEpoch()[0], 0).UTC()
+		if tbk.GetItemInCategory("Timeframe") == "1D" {
+			c.Assert(epoch, Equals, time.Date(2002, time.October, 1, 0, 0, 0, 0, time.UTC))
+		}
+	}
+
+	// Nothing within a lookback ending after the data
+	args.AsOf = time.Date(2003, time.June, 1, 0, 0, 0, 0, time.UTC).Unix()
+	args.Lookback = 24 * 60 * 60
+	response = MultiQueryResponse{}
+	c.Assert(service.Snapshot(nil, args, &response), IsNil)
+	c.Assert(len(response.Responses), Equals, 0)
+	args.Lookback = 365 * 24 * 60 * 60
+	c.Assert(service.Snapshot(nil, args, &response), IsNil)
+	c.Assert(len(response.Responses), Equals, 2)
+
+	args.Lookback = -1
+	c.Assert(service.Snapshot(nil, args, &response) != nil, Equals, true)
+	args.Lookback = 0
+	args.Buckets = []string{"OHLC"}
+	c.Assert(service.Snapshot(nil, args, &response) != nil, Equals, true)
+	args.Buckets = nil
+	c.Assert(service.Snapshot(nil, args, &response) != nil, Equals, true)
+}
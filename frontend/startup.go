@@ -0,0 +1,66 @@
+package frontend
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+)
+
+var startup struct {
+	sync.Mutex
+	begun   time.Time
+	done    bool
+	readyAt time.Time
+}
+
+func init() {
+	startup.begun = time.Now()
+}
+
+// StartupDone marks the startup of the server done, once the catalog is
+// loaded, the WAL replayed and the plugins started, for Startupz to succeed
+// after the delay
+func StartupDone(delay time.Duration) {
+	startup.Lock()
+	defer startup.Unlock()
+	startup.done = true
+	startup.readyAt = time.Now().Add(delay)
+}
+
+// Startupz is the startup probe, failing until the server has started and
+// the startup_probe_delay has elapsed, with the phase of the startup in
+// progress, such as the WAL replay.  The liveness and readiness probes only
+// report the phase meanwhile.
+func Startupz(rw http.ResponseWriter, r *http.Request) {
+	writeHealth(rw, map[string]HealthCheck{"startup": checkStartup()})
+}
+
+func checkStartup() HealthCheck {
+	startup.Lock()
+	defer startup.Unlock()
+	switch {
+	case startup.done && !time.Now().Before(startup.readyAt):
+		return HealthCheck{Healthy: true, Detail: fmt.Sprintf("started in %v",
+			startup.readyAt.Sub(startup.begun).Round(time.Millisecond))}
+	case startup.done:
+		return HealthCheck{Detail: "waiting for startup_probe_delay"}
+	}
+	if phase := executor.StartupPhase(); phase != "" {
+		return HealthCheck{Detail: phase}
+	}
+	return HealthCheck{Detail: "starting"}
+}
+
+// starting writes the phase of the setup of the instance in progress, if
+// any, in place of the checks reading it
+func starting(rw http.ResponseWriter) bool {
+	phase := executor.StartupPhase()
+	if phase == "" {
+		return false
+	}
+	writeHealth(rw, map[string]HealthCheck{"startup": {Detail: phase}})
+	return true
+}
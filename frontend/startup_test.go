@@ -0,0 +1,44 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type StartupTestSuite struct{}
+
+var _ = Suite(&StartupTestSuite{})
+
+func (s *StartupTestSuite) TearDownTest(c *C) {
+	startup.Lock()
+	startup.done = false
+	startup.Unlock()
+}
+
+func (s *StartupTestSuite) TestStartupz(c *C) {
+	probe := func() (int, HealthCheck) {
+		rw := httptest.NewRecorder()
+		Startupz(rw, httptest.NewRequest("GET", "/startupz", nil))
+		var msg HealthMessage
+		c.Assert(json.NewDecoder(rw.Body).Decode(&msg), IsNil)
+		return rw.Code, msg.Checks["startup"]
+	}
+
+	code, check := probe()
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(check.Detail, Equals, "starting")
+
+	StartupDone(time.Hour)
+	code, check = probe()
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(check.Detail, Equals, "waiting for startup_probe_delay")
+
+	StartupDone(0)
+	code, check = probe()
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(check.Detail, Matches, "started in .*")
+}
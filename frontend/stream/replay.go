@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/gobwas/glob"
+)
+
+// number of rows read from a bucket at once during a replay, doubled for
+// the seconds with more rows
+const replayBatch = 1000
+
+// replayCursor reads the rows of a bucket in order, a batch at a time
+type replayCursor struct {
+	tbk io.TimeBucketKey
+	// epoch of the next batch, and of the end of the replay, 0 for none
+	next, end int64
+	batch     int
+	cs        *io.ColumnSeries
+	// index of the next row of cs, and number of its rows replayed
+	i, n int
+	done bool
+}
+
+// head returns the time of the next row of the cursor, false once it has
+// no more
+func (c *replayCursor) head() (time.Time, bool, error) {
+	for !c.done && c.i >= c.n {
+		if err := c.fill(); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+	if c.done {
+		return time.Time{}, false, nil
+	}
+	return rowTime(c.cs, c.i), true, nil
+}
+
+// fill reads the next batch of rows.  A full batch ends before the rows of
+// its last second, read with the next batch, so that no row of a second is
+// left out between two batches.
+func (c *replayCursor) fill() error {
+	c.cs, c.i, c.n = nil, 0, 0
+	if c.end != 0 && c.next > c.end {
+		c.done = true
+		return nil
+	}
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	tbk := c.tbk
+	q.AddTargetKey(&tbk)
+	if c.end != 0 {
+		q.SetRange(c.next, c.end)
+	} else {
+		q.SetStart(c.next)
+	}
+	q.SetRowLimit(io.FIRST, c.batch)
+	parsed, err := q.Parse()
+	if err != nil {
+		// nothing stored from next on
+		c.done = true
+		return nil
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return err
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return err
+	}
+	cs := csm[c.tbk]
+	if cs == nil || cs.Len() == 0 {
+		c.done = true
+		return nil
+	}
+	epochs := cs.GetEpoch()
+	last := epochs[len(epochs)-1]
+	// the start of the fixed length buckets is rounded down to its interval
+	skip := 0
+	for skip < len(epochs) && epochs[skip] < c.next {
+		skip++
+	}
+	if skip == len(epochs) {
+		c.done = true
+		return nil
+	}
+	if cs.Len() < c.batch {
+		c.cs, c.i, c.n, c.next = cs, skip, cs.Len(), last+1
+		return nil
+	}
+	n := len(epochs)
+	for n > 0 && epochs[n-1] == last {
+		n--
+	}
+	if n <= skip {
+		// a whole batch of a single second
+		c.batch *= 2
+		return nil
+	}
+	c.cs, c.i, c.n, c.next = cs, skip, n, last
+	return nil
+}
+
+// rowTime returns the time of a row, to its nanosecond if it has them
+func rowTime(cs *io.ColumnSeries, i int) time.Time {
+	var nanos int64
+	if ns, ok := cs.GetColumn("Nanoseconds").([]int32); ok {
+		nanos = int64(ns[i])
+	}
+	return time.Unix(cs.GetEpoch()[i], nanos)
+}
+
+// Replay pushes the stored rows of the replay setting to the subscribers,
+// merged in time order across the buckets, waiting between the rows for
+// the time between their epochs divided by the speed, as if they were
+// written live.  The replay starts once the first subscriber connects, and
+// runs until the end of the setting, or until the last row stored when it
+// has none, or until the context is done.
+func Replay(ctx context.Context, setting *utils.ReplaySetting) error {
+	if catalog == nil || executor.ThisInstance == nil {
+		return fmt.Errorf("streaming is not available")
+	}
+	symbols := make([]glob.Glob, 0, len(setting.Symbols))
+	for _, pattern := range setting.Symbols {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		symbols = append(symbols, g)
+	}
+	streams := make([]glob.Glob, 0, len(setting.Streams))
+	for _, stream := range setting.Streams {
+		g, err := glob.Compile(stream, '/')
+		if err != nil {
+			return err
+		}
+		streams = append(streams, g)
+	}
+	match := func(itemKey string) bool {
+		if len(symbols) > 0 && !matchAny(symbols, io.NewTimeBucketKey(itemKey).GetItemInCategory("Symbol")) {
+			return false
+		}
+		return matchAny(streams, itemKey)
+	}
+
+	var end int64
+	if !setting.End.IsZero() {
+		end = setting.End.Unix()
+	}
+	var cursors []*replayCursor
+	for _, tbk := range storedKeys(match) {
+		cursors = append(cursors, &replayCursor{tbk: tbk, next: setting.Start.Unix(), end: end, batch: replayBatch})
+	}
+	log.Info("replaying %d buckets from %v once subscribed", len(cursors), setting.Start)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	for catalog.count() == 0 {
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			return nil
+		case <-ticker.C:
+		}
+	}
+	ticker.Stop()
+
+	origin := time.Now()
+	rows := 0
+	for {
+		// the cursor of the earliest next row, the first bucket in order
+		// among those of the same time
+		var earliest *replayCursor
+		var at time.Time
+		for _, c := range cursors {
+			t, ok, err := c.head()
+			if err != nil {
+				return err
+			}
+			if ok && (earliest == nil || t.Before(at)) {
+				earliest, at = c, t
+			}
+		}
+		if earliest == nil {
+			log.Info("replayed %d rows from %v", rows, setting.Start)
+			return nil
+		}
+		wait := time.Duration(float64(at.Sub(setting.Start))/setting.Speed) - time.Since(origin)
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+		Push(earliest.tbk, rowForPayload(earliest.cs, earliest.i))
+		earliest.i++
+		rows++
+	}
+}
+
+func matchAny(globs []glob.Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
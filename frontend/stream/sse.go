@@ -0,0 +1,157 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/gobwas/glob"
+)
+
+/*
+	Server-Sent Events: GET /events?streams=AAPL/1Min/OHLCV,NVDA/1D/OHLCV
+	subscribes to the streams, which may also be given as several streams
+	parameters, and receives every push as an event whose data is the
+	payload in JSON:
+
+	data: {"key":"AAPL/1Min/OHLCV","data":{"Epoch":1500000000,"Open":...}}
+*/
+
+// events buffered for a subscriber, which is dropped once it falls behind
+// by more so that a slow client can not hold up the others
+const eventBufferSize = 1024
+
+type eventSubscriber struct {
+	streams []glob.Glob
+	apiKey  string
+	events  chan []byte
+	// closed when the subscriber is dropped
+	dropped  chan struct{}
+	dropOnce sync.Once
+}
+
+func (s *eventSubscriber) subscribed(itemKey string) bool {
+	if auth.AuthorizeKey(s.apiKey, auth.READ, itemKey) != nil {
+		return false
+	}
+	for _, g := range s.streams {
+		if g.Match(itemKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *eventSubscriber) drop() {
+	s.dropOnce.Do(func() { close(s.dropped) })
+}
+
+// deliverEvents queues the payload to the event subscribers of its bucket.
+// Must be called with the catalog held.
+func deliverEvents(payload Payload) {
+	var buf []byte
+	for s := range catalog.events {
+		if !s.subscribed(payload.Key) {
+			continue
+		}
+		if buf == nil {
+			var err error
+			if buf, err = json.Marshal(payload); err != nil {
+				log.Error("failed to marshal outbound event payload (%v)", err)
+				return
+			}
+		}
+		select {
+		case s.events <- buf:
+		default:
+			s.drop()
+		}
+	}
+}
+
+// EventsHandler streams the pushes of the requested streams to the client
+// as Server-Sent Events until it disconnects
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := auth.Authorize(r, auth.READ); err != nil {
+		http.Error(w, err.Error(), auth.Status(err))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok || catalog == nil {
+		http.Error(w, "streaming is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	s := &eventSubscriber{
+		apiKey:  auth.KeyFromRequest(r),
+		events:  make(chan []byte, eventBufferSize),
+		dropped: make(chan struct{}),
+	}
+	for _, param := range r.URL.Query()["streams"] {
+		for _, stream := range strings.Split(param, ",") {
+			if !validStream(stream) {
+				http.Error(w, fmt.Sprintf("%s is an invalid stream", stream), http.StatusBadRequest)
+				return
+			}
+			g, err := glob.Compile(stream, '/')
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s is an invalid stream", stream), http.StatusBadRequest)
+				return
+			}
+			s.streams = append(s.streams, g)
+		}
+	}
+	if len(s.streams) == 0 {
+		http.Error(w, "streams parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	catalog.Lock()
+	catalog.events[s] = struct{}{}
+	catalog.Unlock()
+	defer func() {
+		catalog.Lock()
+		delete(catalog.events, s)
+		catalog.Unlock()
+	}()
+	log.Info("new event stream listener: %v", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keeps proxies such as nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case buf := <-s.events:
+			_, err = fmt.Fprintf(w, "data: %s\n\n", buf)
+		case <-ticker.C:
+			// a comment, which keeps idle connections open
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-s.dropped:
+			log.Error("dropped event stream listener %v falling behind", r.RemoteAddr)
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
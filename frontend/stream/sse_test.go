@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils/io"
+	. "gopkg.in/check.v1"
+)
+
+func (s *StreamTestSuite) TestEvents(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(EventsHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?streams=GOOG/1Min/OHLCV,*/1D/OHLCV")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "text/event-stream")
+
+	// wait for the subscription before pushing
+	for subscribed := false; !subscribed; {
+		catalog.RLock()
+		subscribed = len(catalog.events) > 0
+		catalog.RUnlock()
+		time.Sleep(time.Millisecond)
+	}
+	Push(*io.NewTimeBucketKey("GOOG/5Min/OHLCV"), genColumns())
+	Push(*io.NewTimeBucketKey("GOOG/1Min/OHLCV"), genColumns())
+	Push(*io.NewTimeBucketKey("AMZN/1D/OHLCV"), genColumns())
+
+	r := bufio.NewReader(resp.Body)
+	readEvent := func() map[string]interface{} {
+		line, err := r.ReadString('\n')
+		c.Assert(err, IsNil)
+		c.Assert(strings.HasPrefix(line, "data: "), Equals, true)
+		blank, err := r.ReadString('\n')
+		c.Assert(err, IsNil)
+		c.Assert(blank, Equals, "\n")
+		var event map[string]interface{}
+		c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event), IsNil)
+		return event
+	}
+	event := readEvent()
+	c.Assert(event["key"], Equals, "GOOG/1Min/OHLCV")
+	c.Assert(event["data"].(map[string]interface{})["Epoch"], Equals, float64(123456789))
+	c.Assert(readEvent()["key"], Equals, "AMZN/1D/OHLCV")
+}
+
+func (s *StreamTestSuite) TestEventsInvalidStreams(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(EventsHandler))
+	defer srv.Close()
+
+	for _, query := range []string{"", "?streams=AAPL", "?streams=AAPL/1Min/OHLCV,bad"} {
+		resp, err := http.Get(srv.URL + "/events" + query)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Assert(resp.StatusCode, Equals, http.StatusBadRequest)
+	}
+}
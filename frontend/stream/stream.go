@@ -14,14 +14,34 @@
 // enclosed by the structure with "key" (TimeBucketKey string) and "data" (opaque)
 // fields.
 //
+// A subscribe request may also carry "since" (epoch seconds) to first receive
+// every stored row of the subscribed buckets from that time on, one message per
+// row, before the live pushes.  Pushes arriving during the replay are held back
+// and delivered after it, without the rows the replay already covered.  The
+// replay is bounded by the query resource limits, and a subscriber holding
+// back more than maxPending pushes is disconnected.
+//
+// In the replay mode of the server, stored rows are pushed by Replay as if they
+// were live, at the pace they were recorded.
+//
+// The same pushes are served as Server-Sent Events in JSON by EventsHandler, for
+// clients such as browsers without a websocket and msgpack client.
+//
 package stream
 
 import (
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/planner"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
 	"github.com/eapache/channels"
@@ -36,6 +56,10 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 )
 
+// maxPending is the number of pushes held back during a replay past which
+// the subscriber is disconnected, changed by the tests
+var maxPending = 100000
+
 var catalog *Catalog
 var send *channels.InfiniteChannel
 var upgrader = websocket.Upgrader{
@@ -48,6 +72,8 @@ var upgrader = websocket.Upgrader{
 type Catalog struct {
 	sync.RWMutex
 	subs map[*Subscriber]struct{}
+	// the Server-Sent Events subscribers
+	events map[*eventSubscriber]struct{}
 }
 
 // Add a new subscriber to the catalog
@@ -66,10 +92,19 @@ func (sc *Catalog) Remove(sub *Subscriber) {
 	delete(sc.subs, sub)
 }
 
+// count returns the number of websocket and Server-Sent Events subscribers
+func (sc *Catalog) count() int {
+	sc.RLock()
+	defer sc.RUnlock()
+
+	return len(sc.subs) + len(sc.events)
+}
+
 // NewCatalog initializes the stream catalog
 func NewCatalog() *Catalog {
 	return &Catalog{
-		subs: map[*Subscriber]struct{}{},
+		subs:   map[*Subscriber]struct{}{},
+		events: map[*eventSubscriber]struct{}{},
 	}
 }
 
@@ -80,11 +115,23 @@ type Subscriber struct {
 	c       *websocket.Conn
 	done    chan struct{}
 	streams map[string]struct{}
+	// the API key the subscriber connected with, which
+	// limits the streams to the buckets it may read
+	apiKey string
+	// set while stored rows are being replayed, live payloads
+	// are held in pending until the replay is completed
+	replaying bool
+	pending   []Payload
+	// set once disconnected for holding back too many payloads
+	overflowed bool
 }
 
 // Subscribed matches the subscriber's subscribed streams
 // with the supplied timebucket key string.
 func (s *Subscriber) Subscribed(itemKey string) bool {
+	if auth.AuthorizeKey(s.apiKey, auth.READ, itemKey) != nil {
+		return false
+	}
 	s.RLock()
 	defer s.RUnlock()
 	for stream := range s.streams {
@@ -101,6 +148,8 @@ func (s *Subscriber) Subscribed(itemKey string) bool {
 // to subscribe to streams
 type SubscribeMessage struct {
 	Streams []string `msgpack:"streams"`
+	// Replay the stored rows from this epoch before the live data
+	Since *int64 `msgpack:"since,omitempty"`
 }
 
 // ErrorMessage is used to report errors when a client
@@ -116,6 +165,29 @@ func (s *Subscriber) handleOutbound(buf []byte) error {
 	return s.c.WriteMessage(websocket.BinaryMessage, buf)
 }
 
+// deliver sends a live payload to the subscriber, or holds it if the
+// subscriber is replaying stored data, disconnecting the subscriber which
+// holds too many
+func (s *Subscriber) deliver(payload Payload, buf []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.overflowed {
+		return nil
+	}
+	if s.replaying {
+		if len(s.pending) >= maxPending {
+			s.overflowed = true
+			s.pending = nil
+			s.c.Close()
+			return fmt.Errorf("disconnected %v, holding back over %d payloads during its replay",
+				s.c.RemoteAddr(), maxPending)
+		}
+		s.pending = append(s.pending, payload)
+		return nil
+	}
+	return s.c.WriteMessage(websocket.BinaryMessage, buf)
+}
+
 func (s *Subscriber) handleInbound(msg SubscribeMessage) error {
 	if len(msg.Streams) > 0 {
 		// prevents concurrent read/write of stream map
@@ -131,10 +203,154 @@ func (s *Subscriber) handleInbound(msg SubscribeMessage) error {
 			m[stream] = struct{}{}
 		}
 		s.streams = m
+		s.replaying = msg.Since != nil
+	}
+	return nil
+}
+
+// replay sends every stored row of the subscribed buckets from since on,
+// then the live payloads held back in the meantime
+func (s *Subscriber) replay(since int64) (err error) {
+	latest := map[string]time.Time{}
+	defer func() {
+		if flushErr := s.flush(latest); err == nil {
+			err = flushErr
+		}
+	}()
+
+	if executor.ThisInstance == nil {
+		return fmt.Errorf("no data to replay")
+	}
+	for _, tbk := range s.storedKeys() {
+		q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+		q.AddTargetKey(&tbk)
+		q.SetStart(since)
+		q.SetResourceLimits(planner.DefaultResourceLimits())
+		parsed, err := q.Parse()
+		if err != nil {
+			// nothing stored from since on
+			continue
+		}
+		scanner, err := executor.NewReader(parsed)
+		if err != nil {
+			return err
+		}
+		csm, err := scanner.Read()
+		if err != nil {
+			return err
+		}
+		cs := csm[tbk]
+		if cs == nil || cs.Len() == 0 {
+			continue
+		}
+		for i := 0; i < cs.Len(); i++ {
+			buf, err := msgpack.Marshal(Payload{Key: tbk.GetItemKey(), Data: rowForPayload(cs, i)})
+			if err != nil {
+				return err
+			}
+			if err = s.handleOutbound(buf); err != nil {
+				return err
+			}
+		}
+		latest[tbk.GetItemKey()] = rowTime(cs, cs.Len()-1)
+	}
+	return nil
+}
+
+// flush sends the live payloads held back during the replay, except the
+// ones not newer than the last replayed row of their bucket
+func (s *Subscriber) flush(latest map[string]time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	pending := s.pending
+	s.pending = nil
+	s.replaying = false
+
+	for _, payload := range pending {
+		if last, ok := latest[payload.Key]; ok {
+			if t, ok := payloadTime(payload.Data); ok && !t.After(last) {
+				continue
+			}
+		}
+		buf, err := msgpack.Marshal(payload)
+		if err != nil {
+			log.Error("failed to marshal outbound stream payload (%v)", err)
+			continue
+		}
+		if err = s.c.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// storedKeys returns the keys of all the stored buckets matching the
+// subscribed streams, in order
+func (s *Subscriber) storedKeys() []io.TimeBucketKey {
+	return storedKeys(s.Subscribed)
+}
+
+// storedKeys returns the keys of all the stored buckets matched, in order
+func storedKeys(match func(itemKey string) bool) (keys []io.TimeBucketKey) {
+	seen := map[string]struct{}{}
+	for _, info := range executor.ThisInstance.CatalogDir.GatherTimeBucketInfo() {
+		// <root>/<Symbol>/<Timeframe>/<AttributeGroup>/<Year>.bin
+		elements := strings.Split(filepath.ToSlash(filepath.Dir(info.Path)), "/")
+		if len(elements) < 3 {
+			continue
+		}
+		itemKey := strings.Join(elements[len(elements)-3:], "/")
+		if _, ok := seen[itemKey]; ok || !match(itemKey) {
+			continue
+		}
+		seen[itemKey] = struct{}{}
+		keys = append(keys, *io.NewTimeBucketKey(itemKey))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].GetItemKey() < keys[j].GetItemKey()
+	})
+	return keys
+}
+
+// rowForPayload extracts a single row of the column series, in
+// the same form as the payloads pushed by the stream trigger
+func rowForPayload(cs *io.ColumnSeries, i int) map[string]interface{} {
+	m := map[string]interface{}{}
+	for key, col := range cs.GetColumns() {
+		m[key] = reflect.ValueOf(col).Index(i).Interface()
+	}
+	return m
+}
+
+// payloadTime returns the time of the row pushed, to its nanosecond if it
+// has them
+func payloadTime(data interface{}) (time.Time, bool) {
+	var m map[string]interface{}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		m = d
+	case *map[string]interface{}:
+		if d == nil {
+			return time.Time{}, false
+		}
+		m = *d
+	default:
+		return time.Time{}, false
+	}
+	epoch, ok := m["Epoch"].(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+	var nanos int64
+	switch ns := m["Nanoseconds"].(type) {
+	case int32:
+		nanos = int64(ns)
+	case int64:
+		nanos = ns
+	}
+	return time.Unix(epoch, nanos), true
+}
+
 func validStream(stream string) bool {
 	g, err := glob.Compile("*/*/*", '/')
 	if err != nil {
@@ -173,12 +389,20 @@ func (s *Subscriber) consume() {
 				log.Error("failed to unmarshal inbound stream message (%v)", err)
 				continue
 			}
-			if err := s.handleInbound(m); err != nil {
+			err := s.handleInbound(m)
+			if err != nil {
 				buf, _ = msgpack.Marshal(ErrorMessage{Error: err.Error()})
 			}
 			if err := s.handleOutbound(buf); err != nil {
 				log.Error("failed to send stream message (%v)", err)
 			}
+			if err == nil && m.Since != nil {
+				if err := s.replay(*m.Since); err != nil {
+					log.Error("failed to replay stream (%v)", err)
+					buf, _ = msgpack.Marshal(ErrorMessage{Error: err.Error()})
+					s.handleOutbound(buf)
+				}
+			}
 		case websocket.CloseMessage:
 			return
 		}
@@ -216,11 +440,12 @@ func stream() {
 
 		for s := range catalog.subs {
 			if s.Subscribed(payload.Key) {
-				if err := s.handleOutbound(buf); err != nil {
+				if err := s.deliver(payload, buf); err != nil {
 					log.Error("failed to stream outbound (%s)", err)
 				}
 			}
 		}
+		deliverEvents(payload)
 
 		catalog.RUnlock()
 	}
@@ -228,8 +453,8 @@ func stream() {
 
 // Payload is used to send data over the websocket
 type Payload struct {
-	Key  string      `msgpack:"key"`
-	Data interface{} `msgpack:"data"`
+	Key  string      `msgpack:"key" json:"key"`
+	Data interface{} `msgpack:"data" json:"data"`
 }
 
 // Push sends data over the stream interface
@@ -250,6 +475,11 @@ func Initialize() {
 // Handler hooks into the HTTP interface and handles the incoming
 // streaming requests, and upgrades the connection
 func Handler(w http.ResponseWriter, r *http.Request) {
+	if err := auth.Authorize(r, auth.READ); err != nil {
+		http.Error(w, err.Error(), auth.Status(err))
+		return
+	}
+
 	// upgrade the socket
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -259,8 +489,9 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 
 	// build the subscriber
 	s := &Subscriber{
-		c:    ws,
-		done: make(chan struct{}),
+		c:      ws,
+		done:   make(chan struct{}),
+		apiKey: auth.KeyFromRequest(r),
 	}
 
 	if s.c != nil {
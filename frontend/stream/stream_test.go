@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
 	"github.com/gorilla/websocket"
@@ -145,3 +147,209 @@ func genColumns() map[string]interface{} {
 		"Epoch":  int64(123456789),
 	}
 }
+
+func (s *StreamTestSuite) TestStreamReplay(c *C) {
+	epochs := []int64{
+		time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC).Unix(),
+		time.Date(2018, 1, 2, 10, 1, 0, 0, time.UTC).Unix(),
+		time.Date(2018, 1, 2, 10, 2, 0, 0, time.UTC).Unix(),
+	}
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", epochs)
+	cs.AddColumn("Close", []float32{1.0, 2.0, 3.0})
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*io.NewTimeBucketKey("MSFT/1Min/OHLCV"), cs)
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	srv := httptest.NewServer(http.HandlerFunc(Handler))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/ws")
+	u.Scheme = "ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	since := epochs[1]
+	buf, err := msgpack.Marshal(SubscribeMessage{Streams: []string{"MSFT/*/*"}, Since: &since})
+	c.Assert(err, IsNil)
+	c.Assert(conn.WriteMessage(websocket.BinaryMessage, buf), IsNil)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, buf, err = conn.ReadMessage()
+	c.Assert(err, IsNil)
+	subRespMsg := &SubscribeMessage{}
+	c.Assert(msgpack.Unmarshal(buf, subRespMsg), IsNil)
+	c.Assert(subRespMsg.Streams, DeepEquals, []string{"MSFT/*/*"})
+
+	readPayload := func() map[string]interface{} {
+		_, buf, err := conn.ReadMessage()
+		c.Assert(err, IsNil)
+		var payload Payload
+		c.Assert(msgpack.Unmarshal(buf, &payload), IsNil)
+		c.Assert(payload.Key, Equals, "MSFT/1Min/OHLCV")
+		return payload.Data.(map[string]interface{})
+	}
+
+	// stored rows from since on
+	for _, epoch := range epochs[1:] {
+		data := readPayload()
+		c.Assert(data["Epoch"], Equals, epoch)
+	}
+
+	// then the live data
+	live := genColumns()
+	live["Epoch"] = epochs[2] + 60
+	Push(*io.NewTimeBucketKey("MSFT/1Min/OHLCV"), live)
+	c.Assert(readPayload()["Epoch"], Equals, epochs[2]+60)
+}
+
+func (s *StreamTestSuite) TestPayloadTime(c *C) {
+	m := genColumns()
+	t, ok := payloadTime(m)
+	c.Assert(ok, Equals, true)
+	c.Assert(t.Equal(time.Unix(123456789, 0)), Equals, true)
+
+	m["Nanoseconds"] = int32(500)
+	t, ok = payloadTime(&m)
+	c.Assert(ok, Equals, true)
+	c.Assert(t.Equal(time.Unix(123456789, 500)), Equals, true)
+
+	_, ok = payloadTime("opaque")
+	c.Assert(ok, Equals, false)
+}
+
+// subscriber returns a subscriber replaying to the connection returned
+func subscriber(c *C) (*Subscriber, *websocket.Conn) {
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		c.Assert(err, IsNil)
+		conns <- ws
+	}))
+	u, _ := url.Parse(srv.URL)
+	u.Scheme = "ws"
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c.Assert(err, IsNil)
+	srv.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return &Subscriber{c: <-conns, replaying: true}, conn
+}
+
+func (s *StreamTestSuite) TestFlushNanoseconds(c *C) {
+	sub, conn := subscriber(c)
+	defer conn.Close()
+
+	// the payloads of the second of the last replayed row are held back
+	// from its nanosecond on
+	for _, nanos := range []int32{100, 200, 300} {
+		data := genColumns()
+		data["Nanoseconds"] = nanos
+		c.Assert(sub.deliver(Payload{Key: "TICK/1Sec/TICK", Data: data}, nil), IsNil)
+	}
+	c.Assert(sub.flush(map[string]time.Time{"TICK/1Sec/TICK": time.Unix(123456789, 200)}), IsNil)
+
+	_, buf, err := conn.ReadMessage()
+	c.Assert(err, IsNil)
+	var payload Payload
+	c.Assert(msgpack.Unmarshal(buf, &payload), IsNil)
+	c.Assert(payload.Data.(map[string]interface{})["Nanoseconds"], Equals, int32(300))
+}
+
+func (s *StreamTestSuite) TestPendingOverflow(c *C) {
+	defer func(max int) { maxPending = max }(maxPending)
+	maxPending = 2
+
+	sub, conn := subscriber(c)
+	defer conn.Close()
+	payload := Payload{Key: "MSFT/1Min/OHLCV", Data: genColumns()}
+	c.Assert(sub.deliver(payload, nil), IsNil)
+	c.Assert(sub.deliver(payload, nil), IsNil)
+	c.Assert(sub.deliver(payload, nil), NotNil)
+	c.Assert(sub.pending, HasLen, 0)
+
+	// disconnected
+	_, _, err := conn.ReadMessage()
+	c.Assert(err, NotNil)
+	c.Assert(sub.deliver(payload, nil), IsNil)
+}
+
+func (s *StreamTestSuite) TestReplay(c *C) {
+	start := time.Date(2019, 3, 4, 9, 30, 0, 0, time.UTC)
+	csm := io.NewColumnSeriesMap()
+	for i, symbol := range []string{"RPLB", "RPLA", "RPLC"} {
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{
+			start.Add(time.Duration(i) * time.Minute).Unix(),
+			start.Add(2 * time.Minute).Unix(),
+		})
+		cs.AddColumn("Close", []float32{1.0, 2.0})
+		csm.AddColumnSeries(*io.NewTimeBucketKey(symbol + "/1Min/OHLCV"), cs)
+	}
+	c.Assert(executor.WriteCSM(csm, false), IsNil)
+
+	srv := httptest.NewServer(http.HandlerFunc(Handler))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/ws")
+	u.Scheme = "ws"
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	buf, err := msgpack.Marshal(SubscribeMessage{Streams: []string{"*/1Min/OHLCV"}})
+	c.Assert(err, IsNil)
+	c.Assert(conn.WriteMessage(websocket.BinaryMessage, buf), IsNil)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	c.Assert(err, IsNil)
+
+	setting := &utils.ReplaySetting{
+		Start:   start,
+		Speed:   1200,
+		Symbols: []string{"RPL[AB]"},
+		Streams: []string{"*/*/*"},
+	}
+	began := time.Now()
+	done := make(chan error)
+	go func() { done <- Replay(context.Background(), setting) }()
+
+	// in time order, the buckets of the same time in order
+	expected := []string{"RPLB", "RPLA", "RPLA", "RPLB"}
+	for _, symbol := range expected {
+		_, buf, err := conn.ReadMessage()
+		c.Assert(err, IsNil)
+		var payload Payload
+		c.Assert(msgpack.Unmarshal(buf, &payload), IsNil)
+		c.Assert(payload.Key, Equals, symbol+"/1Min/OHLCV")
+	}
+	c.Assert(<-done, IsNil)
+	// two minutes at 1200 times the speed
+	c.Assert(time.Since(began) >= 90*time.Millisecond, Equals, true)
+}
+
+func (s *StreamTestSuite) TestReplayCursor(c *C) {
+	second := time.Date(2019, 3, 4, 9, 30, 0, 0, time.UTC).Unix()
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{second, second, second, second + 1, second + 2})
+	cs.AddColumn("Nanoseconds", []int32{1, 2, 3, 0, 0})
+	cs.AddColumn("Price", []float32{1.0, 2.0, 3.0, 4.0, 5.0})
+	tbk := io.NewTimeBucketKey("RPLT/1Sec/TICK")
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	c.Assert(executor.WriteCSM(csm, true), IsNil)
+
+	// the rows of a second are not split across the batches
+	cursor := &replayCursor{tbk: *tbk, next: second, end: second + 1, batch: 2}
+	var prices []float32
+	for {
+		_, ok, err := cursor.head()
+		c.Assert(err, IsNil)
+		if !ok {
+			break
+		}
+		prices = append(prices, cursor.cs.GetColumn("Price").([]float32)[cursor.i])
+		cursor.i++
+	}
+	c.Assert(prices, DeepEquals, []float32{1.0, 2.0, 3.0, 4.0})
+}
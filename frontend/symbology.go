@@ -0,0 +1,271 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/executor/symbology"
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type SetIdentifiersArgs struct {
+	Identifiers []symbology.Identifiers `msgpack:"identifiers"`
+}
+
+type RemoveIdentifiersArgs struct {
+	Symbols []string `msgpack:"symbols"`
+}
+
+type IdentifiersResponse struct {
+	// Number of symbols whose identifiers were set or removed, the others
+	// being unchanged, or having none
+	Count int `msgpack:"count"`
+}
+
+type GetSymbologyArgs struct {
+	// Symbols, or their CUSIP, ISIN or FIGI, all the symbols with
+	// identifiers if empty
+	Symbols []string `msgpack:"symbols,omitempty"`
+}
+
+// SymbologyInfo is the identifiers and the former tickers of a symbol
+type SymbologyInfo struct {
+	Symbol      string                `msgpack:"symbol"`
+	Identifiers symbology.Identifiers `msgpack:"identifiers"`
+	History     []symbology.Segment   `msgpack:"history"`
+}
+
+type GetSymbologyResponse struct {
+	Symbols []SymbologyInfo `msgpack:"symbols"`
+}
+
+// SetIdentifiers records the CUSIP, ISIN and FIGI of the symbols, by which
+// they may be queried
+func (s *DataService) SetIdentifiers(r *http.Request, args *SetIdentifiersArgs, response *IdentifiersResponse) (err error) {
+	if err = auth.Authorize(r, auth.WRITE); err != nil {
+		return err
+	}
+	for _, ids := range args.Identifiers {
+		if err = authorizeSymbol(r, auth.WRITE, ids.Symbol); err != nil {
+			audit.Record(r, audit.IDS, "", 0, err)
+			return err
+		}
+	}
+	store, err := symbology.Instance()
+	if err != nil {
+		return err
+	}
+	response.Count, err = store.Set(args.Identifiers...)
+	audit.Record(r, audit.IDS, "", response.Count, err)
+	return err
+}
+
+// RemoveIdentifiers deletes the identifiers of the symbols
+func (s *DataService) RemoveIdentifiers(r *http.Request, args *RemoveIdentifiersArgs, response *IdentifiersResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
+	for _, symbol := range args.Symbols {
+		if err = authorizeSymbol(r, auth.ADMIN, symbol); err != nil {
+			audit.Record(r, audit.IDS, "", 0, err)
+			return err
+		}
+	}
+	store, err := symbology.Instance()
+	if err != nil {
+		return err
+	}
+	response.Count, err = store.Remove(args.Symbols...)
+	audit.Record(r, audit.IDS, "", response.Count, err)
+	return err
+}
+
+// GetSymbology returns the identifiers of the symbols and their former
+// tickers, from their symbol changes recorded by AddCorporateActions
+func (s *DataService) GetSymbology(r *http.Request, args *GetSymbologyArgs, response *GetSymbologyResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	store, err := symbology.Instance()
+	if err != nil {
+		return err
+	}
+	actions, err := corpaction.Instance()
+	if err != nil {
+		return err
+	}
+	changes := symbology.Changes(actions)
+	symbols := args.Symbols
+	if len(symbols) == 0 {
+		symbols = store.Symbols()
+	}
+	// the key of a namespace reads the symbols of its namespace alone
+	namespace := auth.Namespace(r)
+	response.Symbols = []SymbologyInfo{}
+	for _, symbol := range symbols {
+		if _, ok := store.Get(symbol); !ok {
+			if resolved, ok := store.Resolve(symbol); ok {
+				symbol = resolved
+			}
+		}
+		if !strings.HasPrefix(symbol, namespace) {
+			continue
+		}
+		info := SymbologyInfo{Symbol: symbol, History: symbology.History(changes, symbol)}
+		info.Identifiers, _ = store.Get(symbol)
+		info.Identifiers.Symbol = symbol
+		if info.History == nil {
+			info.History = []symbology.Segment{}
+		}
+		response.Symbols = append(response.Symbols, info)
+	}
+	return nil
+}
+
+// renameIdentifiers moves the identifiers of the renamed symbol to its new
+// name
+func renameIdentifiers(from, to string) error {
+	store, err := symbology.Instance()
+	if err != nil {
+		return err
+	}
+	return store.Rename(from, to)
+}
+
+// resolveIdentifiers returns the symbols with the CUSIP, ISIN and FIGI
+// replaced by their symbol, and the identifiers by symbol, as
+// resolveAliases does for the aliases.  The symbols of the catalog are
+// never identifiers.
+func resolveIdentifiers(symbols []string, aliasOf map[string]string) (resolved []string, _ map[string]string) {
+	store, err := symbology.Instance()
+	if err != nil || len(store.Symbols()) == 0 {
+		return symbols, aliasOf
+	}
+	var known map[string]int
+	resolved = make([]string, len(symbols))
+	for i, symbol := range symbols {
+		resolved[i] = symbol
+		to, ok := store.Resolve(symbol)
+		if !ok {
+			continue
+		}
+		if known == nil {
+			known = executor.ThisInstance.CatalogDir.GatherCategoriesAndItems()["Symbol"]
+		}
+		if _, exists := known[symbol]; exists {
+			continue
+		}
+		if aliasOf == nil {
+			aliasOf = map[string]string{}
+		}
+		resolved[i], aliasOf[to] = to, symbol
+	}
+	return resolved, aliasOf
+}
+
+// historyReader reads the records of a bucket between two times
+type historyReader func(tbk *io.TimeBucketKey, start, stop time.Time) (io.ColumnSeriesMap, error)
+
+// stitchHistory prepends to the records of the symbols those of their
+// former tickers, each within the period it was the ticker and before the
+// first record already stitched, leaving out the buckets the request may
+// not read.  limit is that of the query, the records kept being the first
+// of the stitched series if fromStart, or else the last.
+func stitchHistory(r *http.Request, csm io.ColumnSeriesMap, symbols []string, timeframe, recordFormat string,
+	start, stop time.Time, limit int, fromStart bool, read historyReader) error {
+	store, err := corpaction.Instance()
+	if err != nil {
+		return err
+	}
+	changes := symbology.Changes(store)
+	if len(changes) == 0 {
+		return nil
+	}
+	cd := utils.CandleDurationFromString(timeframe)
+	if limit > 0 {
+		limit = cd.QueryableNrecords(cd.QueryableTimeframe(), limit)
+	}
+	for _, symbol := range symbols {
+		history := symbology.History(changes, symbol)
+		if len(history) == 0 {
+			continue
+		}
+		var key *io.TimeBucketKey
+		var stitched *io.ColumnSeries
+		for tbk, cs := range csm {
+			if tbk.GetItemInCategory("Symbol") == symbol {
+				k := tbk
+				key, stitched = &k, cs
+			}
+		}
+		for _, segment := range history {
+			if limit > 0 && !fromStart && stitched != nil && stitched.Len() >= limit {
+				break
+			}
+			former := segment.Symbol + "/" + timeframe + "/" + recordFormat
+			if auth.AuthorizeBucket(r, auth.READ, former) != nil {
+				continue
+			}
+			end := segment.End
+			if stitched != nil && stitched.Len() > 0 && stitched.GetEpoch()[0] < end {
+				end = stitched.GetEpoch()[0]
+			}
+			segmentStart, segmentStop := start, stop
+			if segment.Start > start.Unix() {
+				segmentStart = io.ToSystemTimezone(time.Unix(segment.Start, 0))
+			}
+			// compared by epoch, the stop of an unbounded query being out of
+			// the range of time.Time
+			if segmentStop.Unix() >= end {
+				segmentStop = io.ToSystemTimezone(time.Unix(end, 0).Add(-time.Nanosecond))
+			}
+			if segmentStop.Before(segmentStart) {
+				continue
+			}
+			result, err := read(io.NewTimeBucketKey(former), segmentStart, segmentStop)
+			if err != nil {
+				// the former ticker has no bucket of the timeframe
+				if errors.Is(err, planner.ErrNoFiles) {
+					continue
+				}
+				return err
+			}
+			for tbk, cs := range result {
+				if cs.Len() == 0 {
+					continue
+				}
+				if stitched == nil {
+					tbk.SetItemInCategory("Symbol", symbol)
+					key, stitched = &tbk, cs
+					continue
+				}
+				if stitched, err = io.ColumnSeriesConcat(cs, stitched); err != nil {
+					return fmt.Errorf("failed to stitch %s to %s: %v", former, key.String(), err)
+				}
+			}
+		}
+		if stitched == nil {
+			continue
+		}
+		if limit > 0 && stitched.Len() > limit {
+			direction := io.LAST
+			if fromStart {
+				direction = io.FIRST
+			}
+			if err = stitched.RestrictLength(limit, direction); err != nil {
+				return err
+			}
+		}
+		csm[*key] = stitched
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package frontend
+
+import (
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/executor/corpaction"
+	"github.com/alpacahq/marketstore/executor/symbology"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+func (s *ServerTestSuite) TestSymbology(c *C) {
+	service := &DataService{}
+	service.Init()
+	query := func(builder *QueryRequestBuilder) (io.ColumnSeriesMap, error) {
+		var response MultiQueryResponse
+		err := service.Query(nil, &MultiQueryRequest{Requests: []QueryRequest{builder.End()}}, &response)
+		if err != nil {
+			return nil, err
+		}
+		csm, err := response.ToColumnSeriesMap()
+		c.Assert(err, IsNil)
+		return *csm, nil
+	}
+	csm, err := query(NewQueryRequestBuilder("EURUSD/1D/OHLC"))
+	c.Assert(err, IsNil)
+	epochs := csm[*io.NewTimeBucketKey("EURUSD/1D/OHLC")].GetEpoch()
+	c.Assert(len(epochs) > 10, Equals, true)
+
+	// queried by its ISIN
+	ids := &SetIdentifiersArgs{Identifiers: []symbology.Identifiers{{Symbol: "EURUSD", ISIN: "US0378331005"}}}
+	defer service.RemoveIdentifiers(nil, &RemoveIdentifiersArgs{Symbols: []string{"EURUSD"}}, &IdentifiersResponse{})
+	var response IdentifiersResponse
+	c.Assert(service.SetIdentifiers(nil, ids, &response), IsNil)
+	c.Assert(response.Count, Equals, 1)
+	csm, err = query(NewQueryRequestBuilder("US0378331005/1D/OHLC"))
+	c.Assert(err, IsNil)
+	c.Assert(csm[*io.NewTimeBucketKey("US0378331005/1D/OHLC")].Len(), Equals, len(epochs))
+
+	// the history of the former ticker is stitched to the new one
+	change := corpaction.Action{Symbol: "EURUSD", Kind: corpaction.SYMBOL_CHANGE, ExDate: epochs[10], NewSymbol: "EURO"}
+	actions := &CorporateActionsArgs{Actions: []corpaction.Action{change}}
+	defer service.RemoveCorporateActions(nil, actions, &CorporateActionsResponse{})
+	c.Assert(service.AddCorporateActions(nil, actions, &CorporateActionsResponse{}), IsNil)
+	csm, err = query(NewQueryRequestBuilder("EURO/1D/OHLC").Stitch(true))
+	c.Assert(err, IsNil)
+	c.Assert(csm[*io.NewTimeBucketKey("EURO/1D/OHLC")].GetEpoch(), DeepEquals, epochs[:10])
+	csm, err = query(NewQueryRequestBuilder("EURO/1D/OHLC").Stitch(true).LimitRecordCount(3))
+	c.Assert(err, IsNil)
+	c.Assert(csm[*io.NewTimeBucketKey("EURO/1D/OHLC")].GetEpoch(), DeepEquals, epochs[7:10])
+	_, err = query(NewQueryRequestBuilder("EURO/1D/OHLC"))
+	c.Assert(err, NotNil)
+
+	var symbologyResponse GetSymbologyResponse
+	c.Assert(service.GetSymbology(nil, &GetSymbologyArgs{Symbols: []string{"EURO", "US0378331005"}}, &symbologyResponse), IsNil)
+	c.Assert(symbologyResponse.Symbols, DeepEquals, []SymbologyInfo{
+		{
+			Symbol:      "EURO",
+			Identifiers: symbology.Identifiers{Symbol: "EURO"},
+			History:     []symbology.Segment{{Symbol: "EURUSD", End: epochs[10]}},
+		},
+		{
+			Symbol:      "EURUSD",
+			Identifiers: symbology.Identifiers{Symbol: "EURUSD", ISIN: "US0378331005"},
+			History:     []symbology.Segment{},
+		},
+	})
+
+	// the check digit is verified
+	c.Assert(service.SetIdentifiers(nil, &SetIdentifiersArgs{Identifiers: []symbology.Identifiers{
+		{Symbol: "USDJPY", ISIN: "US0378331006"},
+	}}, &response), NotNil)
+}
+
+func (s *ServerTestSuite) TestSymbologyNamespace(c *C) {
+	utils.InstanceConfig.Namespaces = []*utils.NamespaceSetting{{Name: "alpha"}}
+	c.Assert(auth.Initialize([]*utils.APIKeySetting{
+		{Key: "alpha", Permission: "write", Namespace: "alpha"},
+		{Key: "admin", Permission: "admin"},
+	}), IsNil)
+	defer func() {
+		utils.InstanceConfig.Namespaces = nil
+		auth.Initialize(nil)
+	}()
+	service := &DataService{}
+	service.Init()
+	defer service.RemoveIdentifiers(nil, &RemoveIdentifiersArgs{Symbols: []string{"alpha.AAPL", "AAPL"}},
+		&IdentifiersResponse{})
+
+	r, _ := http.NewRequest("POST", "/rpc", nil)
+	r.Header.Set("X-API-Key", "alpha")
+	var response IdentifiersResponse
+	c.Assert(service.SetIdentifiers(r, &SetIdentifiersArgs{Identifiers: []symbology.Identifiers{
+		{Symbol: "alpha.AAPL", ISIN: "US0378331005"},
+	}}, &response), IsNil)
+	c.Assert(response.Count, Equals, 1)
+	// the symbols of other namespaces, or of none, are not the key's
+	c.Assert(service.SetIdentifiers(r, &SetIdentifiersArgs{Identifiers: []symbology.Identifiers{
+		{Symbol: "AAPL", CUSIP: "037833100"},
+	}}, &response), NotNil)
+
+	r.Header.Set("X-API-Key", "admin")
+	c.Assert(service.SetIdentifiers(r, &SetIdentifiersArgs{Identifiers: []symbology.Identifiers{
+		{Symbol: "AAPL", CUSIP: "037833100"},
+	}}, &response), IsNil)
+	var listing GetSymbologyResponse
+	c.Assert(service.GetSymbology(r, &GetSymbologyArgs{}, &listing), IsNil)
+	c.Assert(listing.Symbols, HasLen, 2)
+
+	r.Header.Set("X-API-Key", "alpha")
+	listing = GetSymbologyResponse{}
+	c.Assert(service.GetSymbology(r, &GetSymbologyArgs{}, &listing), IsNil)
+	c.Assert(listing.Symbols, HasLen, 1)
+	c.Assert(listing.Symbols[0].Symbol, Equals, "alpha.AAPL")
+	// nor by their identifiers
+	listing = GetSymbologyResponse{}
+	c.Assert(service.GetSymbology(r, &GetSymbologyArgs{Symbols: []string{"037833100", "AAPL"}}, &listing), IsNil)
+	c.Assert(listing.Symbols, HasLen, 0)
+}
@@ -0,0 +1,276 @@
+package frontend
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/gobwas/glob"
+)
+
+type ListSymbolsArgs struct {
+	// Return the metadata of every bucket in Buckets instead of the symbols
+	Metadata bool `msgpack:"metadata,omitempty"`
+	// Only return the symbols, or with Metadata the bucket keys such
+	// as "*/1Min/OHLCV", matching this glob pattern
+	Pattern string `msgpack:"pattern,omitempty"`
+	// Skip the first Offset results and return at most Limit of them,
+	// all of them if 0.  Results are sorted.
+	Offset int `msgpack:"offset,omitempty"`
+	Limit  int `msgpack:"limit,omitempty"`
+	// Set by a coordinator listing a shard, for the shard to list its own
+	// catalog instead of listing the other shards in turn
+	Local bool `msgpack:"local,omitempty"`
+}
+
+type ListSymbolsResponse struct {
+	Results []string
+	Buckets []BucketMetadata `msgpack:",omitempty"`
+	// Number of results before pagination
+	Total int `msgpack:",omitempty"`
+	// With the shards setting, the results include the symbols of the
+	// other shards, as current as their listing
+	Shards []ShardListing `msgpack:",omitempty"`
+	// With the remotes setting, the results include the buckets they hold,
+	// or their symbols, as current as their listing
+	Remotes []ShardListing `msgpack:",omitempty"`
+}
+
+// shape leaves out the fields the clients of the version do not know
+func (response *ListSymbolsResponse) shape(version int) {
+	if version < APIVersion2 {
+		response.Buckets = nil
+		response.Total = 0
+		response.Shards = nil
+		response.Remotes = nil
+	}
+}
+
+// BucketMetadata describes the schema and the data coverage of a bucket
+type BucketMetadata struct {
+	Key         string   `msgpack:"key"`
+	ColumnNames []string `msgpack:"column_names"`
+	ColumnTypes []string `msgpack:"column_types"`
+	RecordType  string   `msgpack:"record_type"`
+	// Epochs of the first and last records, 0 if the bucket is empty
+	FirstEpoch int64 `msgpack:"first_epoch"`
+	LastEpoch  int64 `msgpack:"last_epoch"`
+	// Estimated from the disk space used by fixed length buckets,
+	// -1 for variable length buckets
+	ApproxRows int64 `msgpack:"approx_rows"`
+	// Timezone by which the records are split into days and aggregated
+	Timezone string `msgpack:"timezone"`
+	// User metadata of the bucket, see SetMetadata
+	Metadata map[string]string `msgpack:"metadata,omitempty"`
+}
+
+func (s *DataService) ListSymbols(r *http.Request, args *ListSymbolsArgs, response *ListSymbolsResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	if atomic.LoadUint32(&Queryable) == 0 {
+		return queryableError
+	}
+	if args == nil {
+		args = &ListSymbolsArgs{}
+	}
+	if args.Offset < 0 || args.Limit < 0 {
+		return fmt.Errorf("offset and limit must not be negative, have: %d and %d", args.Offset, args.Limit)
+	}
+	var pattern glob.Glob
+	if args.Pattern != "" {
+		if pattern, err = glob.Compile(args.Pattern, '/'); err != nil {
+			return fmt.Errorf("invalid pattern %s: %v", args.Pattern, err)
+		}
+	}
+
+	// the symbols of the other shards are listed by them
+	var remoteSymbols []string
+	var remoteBuckets []BucketMetadata
+	if len(utils.InstanceConfig.Shards) > 0 && !args.Local {
+		remoteSymbols, remoteBuckets, response.Shards = listShards(r, args)
+	}
+	if len(utils.InstanceConfig.Remotes) > 0 && !args.Local {
+		var symbols []string
+		var buckets []BucketMetadata
+		symbols, buckets, response.Remotes = listRemotes(r, args, pattern)
+		remoteSymbols = append(remoteSymbols, symbols...)
+		remoteBuckets = append(remoteBuckets, buckets...)
+	}
+	owned := func(symbol string) bool {
+		return args.Local || utils.InstanceConfig.OwnsSymbol(symbol)
+	}
+	// the key of a namespace lists the symbols of its namespace alone
+	namespace := auth.Namespace(r)
+
+	if !args.Metadata {
+		symbols := executor.ThisInstance.CatalogDir.GatherCategoriesAndItems()["Symbol"]
+		var local map[string]bool
+		if !args.Local && len(utils.InstanceConfig.Remotes) > 0 {
+			local = locallyHeldSymbols()
+		}
+		for symbol := range symbols {
+			if (pattern == nil || pattern.Match(symbol)) && owned(symbol) && strings.HasPrefix(symbol, namespace) &&
+				(local == nil || local[symbol]) {
+				response.Results = append(response.Results, symbol)
+			}
+		}
+		for _, symbol := range remoteSymbols {
+			if strings.HasPrefix(symbol, namespace) {
+				response.Results = append(response.Results, symbol)
+			}
+		}
+		sort.Strings(response.Results)
+		// a symbol may have buckets here and on the remotes
+		results := response.Results[:0]
+		for _, symbol := range response.Results {
+			if len(results) == 0 || symbol != results[len(results)-1] {
+				results = append(results, symbol)
+			}
+		}
+		response.Results = results
+		response.Total = len(response.Results)
+		low, high := paginate(len(response.Results), args.Offset, args.Limit)
+		response.Results = response.Results[low:high]
+		response.shape(apiVersion(r))
+		return nil
+	}
+
+	buckets := gatherBuckets()
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		// leave out the buckets the key may not read
+		if (pattern == nil || pattern.Match(key)) && auth.AuthorizeBucket(r, auth.READ, key) == nil &&
+			owned(strings.SplitN(key, "/", 2)[0]) && (args.Local || utils.InstanceConfig.RemoteOf(key) == nil) {
+			keys = append(keys, key)
+		}
+	}
+	remote := map[string]BucketMetadata{}
+	for _, md := range remoteBuckets {
+		keys = append(keys, md.Key)
+		remote[md.Key] = md
+	}
+	sort.Strings(keys)
+	response.Total = len(keys)
+	low, high := paginate(len(keys), args.Offset, args.Limit)
+	for _, key := range keys[low:high] {
+		if md, ok := remote[key]; ok {
+			response.Buckets = append(response.Buckets, md)
+			continue
+		}
+		response.Buckets = append(response.Buckets, newBucketMetadata(key, buckets[key]))
+	}
+	response.shape(apiVersion(r))
+	return nil
+}
+
+// paginate returns the range of the page of n sorted results
+func paginate(n, offset, limit int) (low, high int) {
+	low, high = n, n
+	if offset < n {
+		low = offset
+	}
+	if limit > 0 && low+limit < n {
+		high = low + limit
+	}
+	return low, high
+}
+
+// gatherBuckets returns the year files of every bucket by item key
+func gatherBuckets() map[string][]*io.TimeBucketInfo {
+	buckets := map[string][]*io.TimeBucketInfo{}
+	for _, info := range executor.ThisInstance.CatalogDir.GatherTimeBucketInfo() {
+		// <root>/<Symbol>/<Timeframe>/<AttributeGroup>/<Year>.bin
+		elements := strings.Split(filepath.ToSlash(filepath.Dir(info.Path)), "/")
+		if len(elements) < 3 {
+			continue
+		}
+		itemKey := strings.Join(elements[len(elements)-3:], "/")
+		buckets[itemKey] = append(buckets[itemKey], info)
+	}
+	return buckets
+}
+
+func newBucketMetadata(key string, infos []*io.TimeBucketInfo) BucketMetadata {
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Year < infos[j].Year })
+	latest := infos[len(infos)-1]
+	md := BucketMetadata{
+		Key:        key,
+		RecordType: strings.ToLower(latest.GetRecordType().String()),
+		ApproxRows: -1,
+		Timezone:   executor.BucketTimezone(*io.NewTimeBucketKey(key)).String(),
+	}
+	for _, ds := range latest.GetDataShapesWithEpoch() {
+		md.ColumnNames = append(md.ColumnNames, ds.Name)
+		md.ColumnTypes = append(md.ColumnTypes, strings.ToLower(ds.Type.String()))
+	}
+
+	if latest.GetRecordType() == io.FIXED {
+		md.ApproxRows = 0
+		for _, info := range infos {
+			md.ApproxRows += approxRows(info)
+		}
+	}
+	if metadata, err := executor.ThisInstance.CatalogDir.GetMetadata(io.NewTimeBucketKey(key)); err == nil && len(metadata) > 0 {
+		md.Metadata = metadata
+	}
+	md.FirstEpoch = boundaryEpoch(key, true)
+	md.LastEpoch = boundaryEpoch(key, false)
+	return md
+}
+
+// approxRows estimates the number of records of a fixed length year file
+// from its allocated disk space, since records are written to a sparse file
+func approxRows(info *io.TimeBucketInfo) int64 {
+	var st syscall.Stat_t
+	if err := syscall.Stat(info.Path, &st); err != nil || info.GetRecordLength() <= 0 {
+		return 0
+	}
+	allocated := st.Blocks*512 - io.Headersize
+	if allocated <= 0 {
+		return 0
+	}
+	// the allocation is rounded up to pages, which holds at most a page of
+	// records more than written, and never more than the file can hold
+	return int64(math.Min(float64(allocated/int64(info.GetRecordLength())), float64(info.GetIntervals())))
+}
+
+// boundaryEpoch returns the epoch of the first or the last record of the bucket
+func boundaryEpoch(key string, first bool) int64 {
+	q := planner.NewQuery(executor.ThisInstance.CatalogDir)
+	q.AddTargetKey(io.NewTimeBucketKey(key))
+	q.SetRange(0, math.MaxInt64)
+	if first {
+		q.SetRowLimit(io.FIRST, 1)
+	} else {
+		q.SetRowLimit(io.LAST, 1)
+	}
+	parsed, err := q.Parse()
+	if err != nil {
+		return 0
+	}
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return 0
+	}
+	csm, err := scanner.Read()
+	if err != nil {
+		return 0
+	}
+	for _, cs := range csm {
+		if epoch := cs.GetEpoch(); len(epoch) > 0 {
+			return epoch[0]
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package frontend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/alpacahq/marketstore/utils"
+)
+
+// NewTLSConfig builds the server TLS configuration of a listener. With a
+// client CA file, clients must present a certificate signed by that CA.
+func NewTLSConfig(setting *utils.TLSSetting) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(setting.CertFile, setting.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if setting.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(setting.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", setting.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+var (
+	serverMu sync.Mutex
+	// listener is the server of ListenAndServe, stopped by Shutdown
+	listener *http.Server
+)
+
+// ListenAndServe serves the handler on addr, over TLS if a setting is given.
+// A nil handler serves http.DefaultServeMux.
+func ListenAndServe(addr string, handler http.Handler, setting *utils.TLSSetting) error {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	serverMu.Lock()
+	listener = server
+	serverMu.Unlock()
+	if setting == nil {
+		return server.ListenAndServe()
+	}
+	config, err := NewTLSConfig(setting)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = config
+	// the certificate is already loaded in the configuration
+	return server.ListenAndServeTLS("", "")
+}
+
+// Shutdown stops the server of ListenAndServe from accepting connections and
+// waits for the requests being served, until the context is done.
+// ListenAndServe then returns http.ErrServerClosed.
+func Shutdown(ctx context.Context) error {
+	serverMu.Lock()
+	server := listener
+	serverMu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
@@ -0,0 +1,104 @@
+package frontend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+	. "gopkg.in/check.v1"
+)
+
+// writeCert creates a certificate signed by parent, or self-signed if
+// parent is nil, and writes it and its key in PEM files under dir
+func writeCert(c *C, dir, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, name+".crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600), IsNil)
+	return cert, key
+}
+
+func (s *ServerTestSuite) TestTLS(c *C) {
+	dir := c.MkDir()
+	ca, caKey := writeCert(c, dir, "ca", true, nil, nil)
+	writeCert(c, dir, "server", false, ca, caKey)
+	writeCert(c, dir, "client", false, ca, caKey)
+
+	setting := &utils.TLSSetting{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	config, err := NewTLSConfig(setting)
+	c.Assert(err, IsNil)
+	c.Assert(config.ClientAuth, Equals, tls.RequireAndVerifyClientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(heartbeat))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(config *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// a client certificate is required
+	c.Assert(get(&tls.Config{RootCAs: roots}), NotNil)
+
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	c.Assert(err, IsNil)
+	c.Assert(get(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}}), IsNil)
+
+	// without a client CA, any client is accepted
+	setting.ClientCAFile = ""
+	config, err = NewTLSConfig(setting)
+	c.Assert(err, IsNil)
+	c.Assert(config.ClientAuth, Equals, tls.NoClientCert)
+
+	setting.KeyFile = filepath.Join(dir, "missing.key")
+	_, err = NewTLSConfig(setting)
+	c.Assert(err, NotNil)
+}
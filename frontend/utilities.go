@@ -3,12 +3,12 @@ package frontend
 import (
 	"encoding/json"
 	"net/http"
-	"net/http/pprof"
 	"sync/atomic"
 	"time"
 
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
 )
 
 var Queryable uint32 // treated as bool
@@ -28,18 +28,12 @@ func Utilities(url string) {
 	// heartbeat
 	http.HandleFunc("/heartbeat", heartbeat)
 
-	// profiling
-	http.HandleFunc("/pprof/", pprof.Index)
-	http.HandleFunc("/pprof/cmdline", pprof.Cmdline)
-	http.HandleFunc("/pprof/profile", pprof.Profile)
-	http.HandleFunc("/pprof/symbol", pprof.Symbol)
-	http.HandleFunc("/pprof/trace", pprof.Trace)
-	http.Handle("/pprof/heap", pprof.Handler("heap"))
-	http.Handle("/pprof/goroutine", pprof.Handler("goroutine"))
-	http.Handle("/pprof/threadcreate", pprof.Handler("threadcreate"))
-	http.Handle("/pprof/block", pprof.Handler("block"))
+	// prometheus metrics
+	http.HandleFunc("/metrics", stats.Handler)
 
-	http.ListenAndServe(url, nil)
+	if err := ListenAndServe(url, nil, utils.InstanceConfig.UtilitiesTLS); err != nil {
+		log.Error("Failed to start utility service - Error: %v", err)
+	}
 }
 
 func heartbeat(rw http.ResponseWriter, r *http.Request) {
@@ -2,11 +2,15 @@ package frontend
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 
+	"github.com/alpacahq/marketstore/plugins/bgworker"
 	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/stats"
 	. "gopkg.in/check.v1"
 )
 
@@ -65,3 +69,62 @@ func (s *HeartbeatTestSuite) TestHandler(c *C) {
 		}
 	}
 }
+
+func (s *ServerTestSuite) TestMetrics(c *C) {
+	service := &DataService{}
+	service.Init()
+	args := &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("EURUSD/1Min/OHLC").LimitRecordCount(1).End()},
+	}
+	c.Assert(service.Query(nil, args, &MultiQueryResponse{}), IsNil)
+
+	w := httptest.NewRecorder()
+	stats.Handler(w, nil)
+	out := w.Body.String()
+	c.Assert(strings.Contains(out, `marketstore_query_duration_seconds_count{method="query"}`), Equals, true)
+	c.Assert(strings.Contains(out, "\nmarketstore_catalog_buckets "), Equals, true)
+	c.Assert(strings.Contains(out, "\nmarketstore_catalog_buckets 0\n"), Equals, false)
+}
+
+type stoppedWorker struct{}
+
+func (w stoppedWorker) Run() {}
+
+func (s *ServerTestSuite) TestHealth(c *C) {
+	get := func(handler http.HandlerFunc) (int, HealthMessage) {
+		w := httptest.NewRecorder()
+		handler(w, nil)
+		var msg HealthMessage
+		c.Assert(json.NewDecoder(w.Body).Decode(&msg), IsNil)
+		return w.Code, msg
+	}
+
+	code, msg := get(Healthz)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(msg.Status, Equals, "ok")
+	c.Assert(msg.Checks["wal"].Healthy, Equals, true)
+
+	code, msg = get(Readyz)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(msg.Checks["disk"].Healthy, Equals, true)
+
+	atomic.StoreUint32(&Queryable, uint32(0))
+	code, msg = get(Readyz)
+	atomic.StoreUint32(&Queryable, uint32(1))
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(msg.Checks["queryable"].Healthy, Equals, false)
+
+	utils.InstanceConfig.MinFreeDiskSpace = math.MaxInt64
+	code, msg = get(Readyz)
+	utils.InstanceConfig.MinFreeDiskSpace = 0
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(msg.Checks["disk"].Healthy, Equals, false)
+
+	// a background worker that returned is no longer ready
+	bgworker.Run(stoppedWorker{}, "stopped")
+	code, msg = get(Readyz)
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(msg.Checks["bgworkers"].Detail, Equals, "stopped: stopped")
+	code, _ = get(Healthz)
+	c.Assert(code, Equals, http.StatusOK)
+}
@@ -0,0 +1,104 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alpacahq/marketstore/frontend/auth"
+	"github.com/alpacahq/marketstore/utils"
+)
+
+/*
+	API versions: a client of the RPC API declares the version of the
+	protocol it speaks in the Marketstore-Api-Version header of its
+	requests, which is answered with the version the response is shaped
+	for.  The fields added to the responses by later versions are left out
+	for the clients of older ones, so that they keep decoding the responses
+	as before.  Clients which do not declare a version were written before
+	versioning, and speak version 1.  DataService.Version returns the
+	versions the server supports.
+*/
+
+const (
+	// The protocol of the releases before versioning
+	APIVersion1 = 1
+	// Adds Buckets and Total to ListSymbolsResponse
+	APIVersion2 = 2
+	// Sends the query results in io.NumpyFormat2, with string, bool and
+	// decimal columns and missing values
+	APIVersion3 = 3
+
+	MinAPIVersion     = APIVersion1
+	CurrentAPIVersion = APIVersion3
+
+	APIVersionHeader = "Marketstore-Api-Version"
+)
+
+// negotiateVersion returns the version to speak with a client declaring
+// the given one, the current version being spoken with newer clients
+func negotiateVersion(declared string) (version int, err error) {
+	if declared == "" {
+		return APIVersion1, nil
+	}
+	version, err = strconv.Atoi(declared)
+	if err != nil || version < MinAPIVersion {
+		return 0, fmt.Errorf("unsupported API version %s, the server supports versions %d to %d",
+			declared, MinAPIVersion, CurrentAPIVersion)
+	}
+	if version > CurrentAPIVersion {
+		version = CurrentAPIVersion
+	}
+	return version, nil
+}
+
+type versionKey struct{}
+
+// withAPIVersion returns the request carrying the version negotiated for it
+func withAPIVersion(r *http.Request, version int) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), versionKey{}, version))
+}
+
+// apiVersion returns the version the response to the request is shaped for,
+// the current one for the calls not made through the RPC API, such as those
+// of the REST API, which has a contract of its own
+func apiVersion(r *http.Request) int {
+	if r != nil {
+		if version, ok := r.Context().Value(versionKey{}).(int); ok {
+			return version
+		}
+	}
+	return CurrentAPIVersion
+}
+
+type VersionArgs struct {
+	// Highest version the client speaks, 1 if omitted
+	Version int `msgpack:"version,omitempty"`
+}
+
+type VersionResponse struct {
+	// Version to declare in the requests, the highest both sides speak
+	Version    int    `msgpack:"version"`
+	MinVersion int    `msgpack:"min_version"`
+	MaxVersion int    `msgpack:"max_version"`
+	GitHash    string `msgpack:"git_hash"`
+}
+
+// Version is the handshake of the clients learning which version to speak
+func (s *DataService) Version(r *http.Request, args *VersionArgs, response *VersionResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
+	declared := ""
+	if args != nil && args.Version != 0 {
+		declared = strconv.Itoa(args.Version)
+	}
+	if response.Version, err = negotiateVersion(declared); err != nil {
+		return err
+	}
+	response.MinVersion = MinAPIVersion
+	response.MaxVersion = CurrentAPIVersion
+	response.GitHash = utils.GitHash
+	return nil
+}
@@ -0,0 +1,96 @@
+package frontend
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/alpacahq/marketstore/utils/rpc/msgpack2"
+	. "gopkg.in/check.v1"
+)
+
+func (s *ServerTestSuite) TestVersion(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	for declared, expected := range map[int]int{
+		0:                     APIVersion1,
+		APIVersion1:           APIVersion1,
+		CurrentAPIVersion:     CurrentAPIVersion,
+		CurrentAPIVersion + 1: CurrentAPIVersion,
+	} {
+		var response VersionResponse
+		c.Assert(service.Version(nil, &VersionArgs{Version: declared}, &response), IsNil)
+		c.Assert(response.Version, Equals, expected)
+		c.Assert(response.MinVersion, Equals, MinAPIVersion)
+		c.Assert(response.MaxVersion, Equals, CurrentAPIVersion)
+	}
+	var response VersionResponse
+	c.Assert(service.Version(nil, &VersionArgs{Version: -1}, &response), NotNil)
+}
+
+func (s *ServerTestSuite) TestVersionShaping(c *C) {
+	serv, service := NewServer()
+	var expected ListSymbolsResponse
+	c.Assert(service.ListSymbols(nil, &ListSymbolsArgs{}, &expected), IsNil)
+
+	listSymbols := func(version string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		body, err := msgpack2.EncodeClientRequest("DataService.ListSymbols", &ListSymbolsArgs{})
+		c.Assert(err, IsNil)
+		req := httptest.NewRequest("POST", "/rpc", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-msgpack")
+		if version != "" {
+			req.Header.Set(APIVersionHeader, version)
+		}
+		w := httptest.NewRecorder()
+		serv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			return w, nil
+		}
+		var response map[string]interface{}
+		c.Assert(msgpack2.DecodeClientResponse(w.Body, &response), IsNil)
+		return w, response
+	}
+
+	// clients without a version get the responses of before versioning
+	w, response := listSymbols("")
+	c.Assert(w.Header().Get(APIVersionHeader), Equals, "1")
+	c.Assert(response["Results"], HasLen, len(expected.Results))
+	_, ok := response["Total"]
+	c.Assert(ok, Equals, false)
+
+	w, response = listSymbols(strconv.Itoa(APIVersion2))
+	c.Assert(w.Header().Get(APIVersionHeader), Equals, strconv.Itoa(APIVersion2))
+	c.Assert(response["Results"], HasLen, len(expected.Results))
+	c.Assert(response["Total"], DeepEquals, int64(expected.Total))
+
+	// newer clients are answered in the current version
+	w, _ = listSymbols(strconv.Itoa(CurrentAPIVersion + 1))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get(APIVersionHeader), Equals, strconv.Itoa(CurrentAPIVersion))
+
+	w, _ = listSymbols("0")
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	w, _ = listSymbols("latest")
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *ServerTestSuite) TestVersionDatasetFormat(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	query := func(version int) *MultiQueryResponse {
+		r := withAPIVersion(httptest.NewRequest("POST", "/rpc", nil), version)
+		var response MultiQueryResponse
+		err := service.Query(r, &MultiQueryRequest{
+			Requests: []QueryRequest{NewQueryRequestBuilder("EURUSD/1Min/OHLC").LimitRecordCount(1).End()},
+		}, &response)
+		c.Assert(err, IsNil)
+		return &response
+	}
+	// the clients before the dataset formats get the datasets of before
+	c.Assert(query(APIVersion2).Responses[0].Result.Format, Equals, 0)
+	c.Assert(query(APIVersion3).Responses[0].Result.Format, Equals, io.NumpyFormat2)
+}
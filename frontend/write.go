@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/frontend/auth"
 	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 )
@@ -34,13 +36,20 @@ type MultiServerResponse struct {
 }
 
 func (s *DataService) Write(r *http.Request, reqs *MultiWriteRequest, response *MultiServerResponse) (err error) {
+	if err = auth.Authorize(r, auth.WRITE); err != nil {
+		return err
+	}
 	for _, req := range reqs.Requests {
 		csm, err := req.Data.ToColumnSeriesMap()
 		if err != nil {
 			response.appendResponse(err)
 			continue
 		}
-		if err = executor.WriteCSM(csm, req.IsVariableLength); err != nil {
+		if err = authorizeWrite(r, csm); err == nil {
+			err = executor.WriteCSM(csm, req.IsVariableLength)
+		}
+		recordWrite(r, csm, err)
+		if err != nil {
 			response.appendResponse(err)
 			continue
 		}
@@ -50,17 +59,117 @@ func (s *DataService) Write(r *http.Request, reqs *MultiWriteRequest, response *
 	return nil
 }
 
+// BulkWriteRequest is a single bucket of a BulkWrite call, which writes
+// every bucket independently so that the failed ones can be retried
+type BulkWriteRequest struct {
+	// TimeBucketKey of the bucket, such as "TSLA/1Min/OHLCV"
+	Key              string           `msgpack:"key"`
+	Data             *io.NumpyDataset `msgpack:"dataset"`
+	IsVariableLength bool             `msgpack:"is_variable_length"`
+}
+
+type MultiBulkWriteRequest struct {
+	Requests []BulkWriteRequest `msgpack:"requests"`
+}
+
+type BulkWriteResult struct {
+	Key   string `msgpack:"key"`
+	Rows  int    `msgpack:"rows"`
+	Error string `msgpack:"error"`
+}
+
+type BulkWriteResponse struct {
+	// One result for every request, in the same order
+	Results []BulkWriteResult `msgpack:"results"`
+	// Number of requests which failed
+	Failed int `msgpack:"failed"`
+}
+
+func (s *DataService) BulkWrite(r *http.Request, reqs *MultiBulkWriteRequest, response *BulkWriteResponse) (err error) {
+	if err = auth.Authorize(r, auth.WRITE); err != nil {
+		return err
+	}
+	for _, req := range reqs.Requests {
+		rows, err := bulkWrite(r, req)
+		result := BulkWriteResult{Key: req.Key, Rows: rows}
+		if err != nil {
+			result.Error = err.Error()
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+	return nil
+}
+
+// bulkWrite writes the bucket of a single BulkWriteRequest
+func bulkWrite(r *http.Request, req BulkWriteRequest) (rows int, err error) {
+	tbk := io.NewTimeBucketKeyFromString(req.Key)
+	if tbk == nil || len(tbk.GetItemInCategory("Timeframe")) == 0 {
+		return 0, fmt.Errorf("key \"%s\" is not in proper format, should be like: TSLA/1Min/OHLCV", req.Key)
+	}
+	if req.Data == nil {
+		return 0, fmt.Errorf("no dataset to write to %s", req.Key)
+	}
+	cs, err := req.Data.ToColumnSeries()
+	if err != nil {
+		return 0, err
+	}
+	csm := io.NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, cs)
+	if err = authorizeWrite(r, csm); err == nil {
+		err = executor.WriteCSM(csm, req.IsVariableLength)
+	}
+	recordWrite(r, csm, err)
+	if err != nil {
+		return 0, err
+	}
+	return cs.Len(), nil
+}
+
+// recordWrite adds the write of every bucket in csm to the audit log
+func recordWrite(r *http.Request, csm io.ColumnSeriesMap, err error) {
+	for tbk, cs := range csm {
+		var rows int
+		if cs != nil {
+			rows = cs.Len()
+		}
+		audit.Record(r, audit.WRITE, tbk.GetItemKey(), rows, err)
+	}
+}
+
+// authorizeWrite checks that the request may write to every bucket in csm
+func authorizeWrite(r *http.Request, csm io.ColumnSeriesMap) error {
+	for tbk := range csm {
+		if err := auth.AuthorizeBucket(r, auth.WRITE, tbk.GetItemKey()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 /*
 	Create: Creates a new time bucket in the DB
 */
 type CreateRequest struct {
 	Key, DataShapes, RowType string
+	// Scales of the decimal columns by name, the number of decimal places
+	// of their values, 0 for those not in it
+	Scales map[string]int
+	// Set for a nanosecond bucket of variable length records, indexed by
+	// their Epoch in nanoseconds
+	Nanoseconds bool
+	// Set for a sequenced bucket of variable length records, keyed by their
+	// time and their int64 or uint64 Sequence column
+	Sequenced bool
 }
 type MultiCreateRequest struct {
 	Requests []CreateRequest
 }
 
 func (s *DataService) Create(r *http.Request, reqs *MultiCreateRequest, response *MultiServerResponse) (err error) {
+	if err = auth.Authorize(r, auth.WRITE); err != nil {
+		return err
+	}
 	for _, req := range reqs.Requests {
 		// Construct a time bucket key from the input string
 		parts := strings.Split(req.Key, ":")
@@ -77,6 +186,14 @@ func (s *DataService) Create(r *http.Request, reqs *MultiCreateRequest, response
 			response.appendResponse(err)
 			continue
 		}
+		if err = auth.AuthorizeBucket(r, auth.WRITE, tbk.GetItemKey()); err == nil {
+			err = executor.CheckOwnership(*tbk)
+		}
+		if err != nil {
+			audit.Record(r, audit.CREATE, tbk.GetItemKey(), 0, err)
+			response.appendResponse(err)
+			continue
+		}
 
 		dsv, err := io.DataShapesFromInputString(req.DataShapes)
 		if err != nil {
@@ -84,6 +201,11 @@ func (s *DataService) Create(r *http.Request, reqs *MultiCreateRequest, response
 			continue
 		}
 
+		if err = checkScales(dsv, req.Scales); err != nil {
+			response.appendResponse(err)
+			continue
+		}
+
 		rowType := req.RowType
 		switch rowType {
 		case "fixed", "variable":
@@ -92,6 +214,21 @@ func (s *DataService) Create(r *http.Request, reqs *MultiCreateRequest, response
 			response.appendResponse(err)
 			continue
 		}
+		if req.Nanoseconds {
+			if rowType != "variable" {
+				err = fmt.Errorf("nanosecond bucket %s must have variable records", req.Key)
+				response.appendResponse(err)
+				continue
+			}
+			dsv = append(dsv, io.DataShape{Name: executor.EpochNanosColumn, Type: io.INT32})
+		}
+		if req.Sequenced {
+			if err = checkSequence(rowType, dsv); err != nil {
+				err = fmt.Errorf("sequenced bucket %s %v", req.Key, err)
+				response.appendResponse(err)
+				continue
+			}
+		}
 
 		rootDir := executor.ThisInstance.RootDir
 		year := int16(time.Now().Year())
@@ -104,16 +241,53 @@ func (s *DataService) Create(r *http.Request, reqs *MultiCreateRequest, response
 		tbinfo := io.NewTimeBucketInfo(*tf, tbk.GetPathToYearFiles(rootDir), "Default", year, dsv, rt)
 
 		err = executor.ThisInstance.CatalogDir.AddTimeBucket(tbk, tbinfo)
+		audit.Record(r, audit.CREATE, tbk.GetItemKey(), 0, err)
 		if err != nil {
 			err = fmt.Errorf("creation of new catalog entry failed: %s", err.Error())
 			response.appendResponse(err)
 			continue
 		}
+		if len(req.Scales) > 0 {
+			err = executor.ThisInstance.CatalogDir.SetScales(tbk, req.Scales)
+		}
+		if err == nil && req.Sequenced {
+			err = executor.ThisInstance.CatalogDir.SetSequenced(tbk)
+		}
 		response.appendResponse(err)
 	}
 	return nil
 }
 
+// checkSequence checks that the records of a sequenced bucket are variable
+// length ones with a Sequence column of sequence numbers
+func checkSequence(rowType string, dsv []io.DataShape) error {
+	if rowType != "variable" {
+		return fmt.Errorf("must have variable records")
+	}
+	for _, shape := range dsv {
+		if shape.Name == executor.SequenceColumn && (shape.Type == io.INT64 || shape.Type == io.UINT64) {
+			return nil
+		}
+	}
+	return fmt.Errorf("must have an int64 or uint64 %s column", executor.SequenceColumn)
+}
+
+// checkScales checks that the scales are those of decimal columns
+func checkScales(dsv []io.DataShape, scales map[string]int) error {
+	for name := range scales {
+		found := false
+		for _, shape := range dsv {
+			if shape.Name == name && shape.Type == io.DECIMAL {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not a decimal column to have a scale", name)
+		}
+	}
+	return nil
+}
+
 type KeyRequest struct {
 	Key string `msgpack:"key"`
 }
@@ -134,6 +308,9 @@ type MultiGetInfoResponse struct {
 }
 
 func (s *DataService) GetInfo(r *http.Request, reqs *MultiKeyRequest, response *MultiGetInfoResponse) (err error) {
+	if err = auth.Authorize(r, auth.READ); err != nil {
+		return err
+	}
 	errorString := "key \"%s\" is not in proper format, should be like: TSLA/1Min/OHLCV"
 
 	for _, req := range reqs.Requests {
@@ -150,6 +327,10 @@ func (s *DataService) GetInfo(r *http.Request, reqs *MultiKeyRequest, response *
 			response.appendResponse(nil, err)
 			continue
 		}
+		if err = auth.AuthorizeBucket(r, auth.READ, tbk.GetItemKey()); err != nil {
+			response.appendResponse(nil, err)
+			continue
+		}
 
 		tbi, err := executor.ThisInstance.CatalogDir.GetLatestTimeBucketInfoFromKey(tbk)
 		if err != nil {
@@ -164,6 +345,9 @@ func (s *DataService) GetInfo(r *http.Request, reqs *MultiKeyRequest, response *
 }
 
 func (s *DataService) Destroy(r *http.Request, reqs *MultiKeyRequest, response *MultiServerResponse) (err error) {
+	if err = auth.Authorize(r, auth.ADMIN); err != nil {
+		return err
+	}
 	errorString := "key \"%s\" is not in proper format, should be like: TSLA/1Min/OHLCV"
 
 	for _, req := range reqs.Requests {
@@ -180,8 +364,14 @@ func (s *DataService) Destroy(r *http.Request, reqs *MultiKeyRequest, response *
 			response.appendResponse(err)
 			continue
 		}
+		if err = auth.AuthorizeBucket(r, auth.ADMIN, tbk.GetItemKey()); err != nil {
+			audit.Record(r, audit.DESTROY, tbk.GetItemKey(), 0, err)
+			response.appendResponse(err)
+			continue
+		}
 
 		err = executor.ThisInstance.CatalogDir.RemoveTimeBucket(tbk)
+		audit.Record(r, audit.DESTROY, tbk.GetItemKey(), 0, err)
 		if err != nil {
 			err = fmt.Errorf("removal of catalog entry failed: %s", err.Error())
 			response.appendResponse(err)
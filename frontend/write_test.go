@@ -1,10 +1,18 @@
 package frontend
 
 import (
+	"github.com/alpacahq/marketstore/frontend/audit"
+	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/io"
 
 	"fmt"
 
+	"io/ioutil"
+
+	"path/filepath"
+
+	"strings"
+
 	"strconv"
 
 	"time"
@@ -101,3 +109,160 @@ func (s *ServerTestSuite) TestWrite(c *C) {
 	}
 
 }
+
+func (s *ServerTestSuite) TestAuditLog(c *C) {
+	path := filepath.Join(c.MkDir(), "audit.log")
+	c.Assert(audit.Initialize(&utils.AuditLogSetting{File: path}), IsNil)
+	defer audit.Initialize(nil)
+
+	service := &DataService{}
+	service.Init()
+
+	var response MultiServerResponse
+	err := service.Create(nil, &MultiCreateRequest{
+		Requests: []CreateRequest{
+			{Key: "AUDIT/1Min/OHLC:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Open/float32", RowType: "fixed"},
+		},
+	}, &response)
+	c.Assert(err, IsNil)
+	err = service.Destroy(nil, &MultiKeyRequest{
+		Requests: []KeyRequest{{Key: "AUDIT/1Min/OHLC"}},
+	}, &response)
+	c.Assert(err, IsNil)
+
+	buf, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(strings.Contains(lines[0], `"operation":"create","source":"local","bucket":"AUDIT/1Min/OHLC"`), Equals, true)
+	c.Assert(strings.Contains(lines[1], `"operation":"destroy"`), Equals, true)
+	c.Assert(strings.Contains(lines[1], `"error"`), Equals, false)
+}
+
+func (s *ServerTestSuite) TestBulkWrite(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var qresponse MultiQueryResponse
+	err := service.Query(nil, &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("EURUSD/1Min/OHLC").LimitRecordCount(10).End()},
+	}, &qresponse)
+	c.Assert(err, IsNil)
+	csm, err := qresponse.Responses[0].Result.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	var nds *io.NumpyDataset
+	for _, cs := range csm {
+		nds, err = io.NewNumpyDataset(cs)
+		c.Assert(err, IsNil)
+	}
+
+	var response BulkWriteResponse
+	err = service.BulkWrite(nil, &MultiBulkWriteRequest{
+		Requests: []BulkWriteRequest{
+			{Key: "BULK0/1Min/OHLC", Data: nds},
+			{Key: "BULK1", Data: nds},
+			{Key: "BULK2/1Min/OHLC"},
+			{Key: "BULK3/1Min/OHLC:Symbol/Timeframe/AttributeGroup", Data: nds},
+		},
+	}, &response)
+	c.Assert(err, IsNil)
+	c.Assert(response.Results, HasLen, 4)
+	c.Assert(response.Failed, Equals, 2)
+	c.Assert(response.Results[0], Equals, BulkWriteResult{Key: "BULK0/1Min/OHLC", Rows: 10})
+	c.Assert(strings.Contains(response.Results[1].Error, "not in proper format"), Equals, true)
+	c.Assert(strings.Contains(response.Results[2].Error, "no dataset"), Equals, true)
+	c.Assert(response.Results[3].Error, Equals, "")
+	c.Assert(response.Results[3].Rows, Equals, 10)
+
+	qresponse = MultiQueryResponse{}
+	err = service.Query(nil, &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("BULK0,BULK3/1Min/OHLC").End()},
+	}, &qresponse)
+	c.Assert(err, IsNil)
+	csm, err = qresponse.Responses[0].Result.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Assert(csm, HasLen, 2)
+	for _, cs := range csm {
+		c.Assert(cs.Len(), Equals, 10)
+	}
+
+	var dresponse MultiServerResponse
+	err = service.Destroy(nil, &MultiKeyRequest{
+		Requests: []KeyRequest{{Key: "BULK0/1Min/OHLC"}, {Key: "BULK3/1Min/OHLC"}},
+	}, &dresponse)
+	c.Assert(err, IsNil)
+}
+
+func (s *ServerTestSuite) TestSequencedBucket(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var response MultiServerResponse
+	err := service.Create(nil, &MultiCreateRequest{
+		Requests: []CreateRequest{
+			{Key: "SEQ/1Min/TRADE:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Price/float32:Sequence/uint64",
+				RowType: "variable", Sequenced: true},
+			{Key: "SEQ/1Min/QUOTE:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Price/float32:Sequence/uint64",
+				RowType: "fixed", Sequenced: true},
+			{Key: "SEQ/1Min/BOOK:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Price/float32",
+				RowType: "variable", Sequenced: true},
+		},
+	}, &response)
+	c.Assert(err, IsNil)
+	defer service.Destroy(nil, &MultiKeyRequest{Requests: []KeyRequest{{Key: "SEQ/1Min/TRADE"}}}, &MultiServerResponse{})
+	c.Assert(response.Responses, HasLen, 3)
+	c.Assert(response.Responses[0].Error, Equals, "")
+	c.Assert(strings.Contains(response.Responses[1].Error, "must have variable records"), Equals, true)
+	c.Assert(strings.Contains(response.Responses[2].Error, "must have an int64 or uint64 Sequence column"), Equals, true)
+
+	var schemas GetSchemaResponse
+	c.Assert(service.GetSchema(nil, &GetSchemaArgs{Keys: []string{"SEQ/*/*"}}, &schemas), IsNil)
+	c.Assert(schemas.Schemas, HasLen, 1)
+	c.Assert(schemas.Schemas[0].Sequenced, Equals, true)
+}
+
+func (s *ServerTestSuite) TestNanosecondBucket(c *C) {
+	service := &DataService{}
+	service.Init()
+
+	var response MultiServerResponse
+	err := service.Create(nil, &MultiCreateRequest{
+		Requests: []CreateRequest{
+			{Key: "NANOS/1Sec/TRADE:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Price/float32",
+				RowType: "variable", Nanoseconds: true},
+			{Key: "NANOS/1Min/TRADE:Symbol/Timeframe/AttributeGroup", DataShapes: "Epoch/int64:Price/float32",
+				RowType: "fixed", Nanoseconds: true},
+		},
+	}, &response)
+	c.Assert(err, IsNil)
+	defer service.Destroy(nil, &MultiKeyRequest{Requests: []KeyRequest{{Key: "NANOS/1Sec/TRADE"}}}, &MultiServerResponse{})
+	c.Assert(response.Responses, HasLen, 2)
+	c.Assert(response.Responses[0].Error, Equals, "")
+	c.Assert(strings.Contains(response.Responses[1].Error, "must have variable records"), Equals, true)
+
+	second := int64(1500000000) * 1e9
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{second + 20, second + 10, second + 1e9 + 5})
+	cs.AddColumn("Price", []float32{2, 1, 3})
+	nds, err := io.NewNumpyDataset(cs)
+	c.Assert(err, IsNil)
+	var bulkResponse BulkWriteResponse
+	err = service.BulkWrite(nil, &MultiBulkWriteRequest{
+		Requests: []BulkWriteRequest{{Key: "NANOS/1Sec/TRADE", Data: nds, IsVariableLength: true}},
+	}, &bulkResponse)
+	c.Assert(err, IsNil)
+	c.Assert(bulkResponse.Failed, Equals, 0)
+
+	var qresponse MultiQueryResponse
+	err = service.Query(nil, &MultiQueryRequest{
+		Requests: []QueryRequest{NewQueryRequestBuilder("NANOS/1Sec/TRADE").
+			EpochStartNanos(second + 10).EpochEndNanos(second + 1e9).End()},
+	}, &qresponse)
+	c.Assert(err, IsNil)
+	csm, err := qresponse.Responses[0].Result.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	result := csm[*io.NewTimeBucketKey("NANOS/1Sec/TRADE")]
+	c.Assert(result.GetColumnNames(), DeepEquals, []string{"Epoch", "Price"})
+	c.Assert(result.GetEpoch(), DeepEquals, []int64{second + 10, second + 20})
+	c.Assert(result.GetByName("Price"), DeepEquals, []float32{1, 2})
+}
@@ -21,8 +21,9 @@ import (
 // Builds the command hierarchy and parses statements.
 func main() {
 	err := cmd.Execute()
-	// Errors are already handled by the framework.
+	// Errors are already printed by the framework, the exit status is
+	// left for the scripts running the commands.
 	if err != nil {
-		os.Exit(0)
+		os.Exit(1)
 	}
 }
@@ -1,6 +1,7 @@
 package planner
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/alpacahq/marketstore/utils"
 	. "github.com/alpacahq/marketstore/utils/io"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/memlimit"
 )
 
 type TimeQualFunc func(epoch int64) bool
@@ -33,8 +35,14 @@ func NewRestrictionList() RestrictionList {
 type DateRange struct {
 	Start, End         int64
 	StartYear, EndYear int16
+	// Nanoseconds of the Start and End seconds bounding the records with
+	// nanoseconds, the whole seconds by default
+	StartNanos, EndNanos int32
 }
 
+// ErrNoFiles is returned by Parse when no bucket matches the query
+var ErrNoFiles = errors.New("No files returned from query parse")
+
 var MaxEpoch = time.Unix(1<<63-62135596801, 999999999).Unix()
 var MinEpoch = int64(0)
 
@@ -44,6 +52,7 @@ func NewDateRange() *DateRange {
 	dr.StartYear = int16(ToSystemTimezone(time.Unix(dr.Start, 0)).Year())
 	dr.End = MaxEpoch
 	dr.EndYear = int16(ToSystemTimezone(time.Unix(dr.End, 0)).Year())
+	dr.EndNanos = 999999999
 	return dr
 }
 
@@ -58,6 +67,53 @@ func NewRowLimit() *RowLimit {
 	return &r
 }
 
+/*
+ResourceLimits caps the work done by a single query, a zero value for any
+of the limits disables it
+*/
+type ResourceLimits struct {
+	// Number of records read from data files, including empty slots
+	MaxRowsScanned int64
+	// Number of bytes read from data files
+	MaxBytesRead int64
+	// Number of bytes held in the result buffers
+	MaxMemory int64
+}
+
+// queryMemoryShare is the divisor of the memory limit giving the memory a
+// query may buffer when query_max_memory is not set
+const queryMemoryShare = 4
+
+// DefaultResourceLimits returns the limits configured for client queries
+func DefaultResourceLimits() ResourceLimits {
+	maxMemory := utils.InstanceConfig.QueryMaxMemory
+	if maxMemory == 0 {
+		maxMemory = memlimit.Share(queryMemoryShare)
+	}
+	return ResourceLimits{
+		MaxRowsScanned: utils.InstanceConfig.QueryMaxRowsScanned,
+		MaxBytesRead:   utils.InstanceConfig.QueryMaxBytesRead,
+		MaxMemory:      maxMemory,
+	}
+}
+
+/*
+Restrict lowers the limits to those supplied, a limit can only be made
+more strict this way, zero values leave the current limit alone
+*/
+func (rl ResourceLimits) Restrict(maxRowsScanned, maxBytesRead, maxMemory int64) ResourceLimits {
+	restrict := func(current, requested int64) int64 {
+		if requested > 0 && (current == 0 || requested < current) {
+			return requested
+		}
+		return current
+	}
+	rl.MaxRowsScanned = restrict(rl.MaxRowsScanned, maxRowsScanned)
+	rl.MaxBytesRead = restrict(rl.MaxBytesRead, maxBytesRead)
+	rl.MaxMemory = restrict(rl.MaxMemory, maxMemory)
+	return rl
+}
+
 type QualifiedFile struct {
 	Key  TimeBucketKey
 	File *TimeBucketInfo
@@ -70,6 +126,9 @@ type ParseResult struct {
 	IntervalsPerDay int64
 	RootDir         string
 	TimeQuals       []TimeQualFunc
+	// Retain only every Nth record read, zero or one reads all records
+	SampleInterval int
+	ResourceLimits ResourceLimits
 }
 
 func NewParseResult() *ParseResult {
@@ -170,6 +229,9 @@ type query struct {
 	Limit       *RowLimit
 	DataDir     *Directory
 	TimeQuals   []TimeQualFunc
+	// Retain only every Nth record read, zero or one reads all records
+	SampleInterval int
+	ResourceLimits ResourceLimits
 }
 
 func NewQuery(d *Directory) *query {
@@ -191,6 +253,14 @@ func (q *query) SetRowLimit(direction DirectionEnum, rowLimit int) {
 	q.Limit.Direction = direction
 }
 
+func (q *query) SetSampleInterval(interval int) {
+	q.SampleInterval = interval
+}
+
+func (q *query) SetResourceLimits(limits ResourceLimits) {
+	q.ResourceLimits = limits
+}
+
 func (q *query) SetRange(start, end int64) {
 	q.Range = new(DateRange)
 	q.SetStart(start)
@@ -203,6 +273,7 @@ func (q *query) SetStart(start int64) {
 	}
 	q.Range.Start = start
 	q.Range.StartYear = int16(ToSystemTimezone(time.Unix(start, 0)).Year())
+	q.Range.StartNanos = 0
 }
 
 func (q *query) SetEnd(end int64) {
@@ -211,6 +282,18 @@ func (q *query) SetEnd(end int64) {
 	}
 	q.Range.End = end
 	q.Range.EndYear = int16(ToSystemTimezone(time.Unix(end, 0)).Year())
+	q.Range.EndNanos = 999999999
+}
+
+// SetNanoseconds bounds the records with nanoseconds of the start and end
+// seconds of the range by the nanoseconds of their second, such as those of
+// a range of nanosecond epochs
+func (q *query) SetNanoseconds(start, end int32) {
+	if q.Range == nil {
+		q.Range = NewDateRange()
+	}
+	q.Range.StartNanos = start
+	q.Range.EndNanos = end
 }
 
 func (q *query) AddRestriction(category string, item string) {
@@ -298,7 +381,7 @@ func (q *query) Parse() (pr *ParseResult, err error) {
 	*/
 	getFileList(q.DataDir, &pr.QualifiedFiles, "", "")
 	if len(pr.QualifiedFiles) == 0 {
-		return pr, fmt.Errorf("No files returned from query parse")
+		return pr, ErrNoFiles
 	}
 
 	/*
@@ -318,6 +401,8 @@ func (q *query) Parse() (pr *ParseResult, err error) {
 	// Set the time ranges for the parsed result
 	pr.Range = q.Range
 	pr.Limit = q.Limit
+	pr.SampleInterval = q.SampleInterval
+	pr.ResourceLimits = q.ResourceLimits
 	// If the query expressed no time range, set the parsed result to include all years in the qualified files
 	//timeRange := (q.Range.Start != time.Time{} && q.Range.End != MaxTime)
 	timeRange := (q.Range.Start != MinEpoch || q.Range.End != MaxEpoch)
@@ -0,0 +1,21 @@
+// Package abi holds the version of the interface between the server and its
+// plugins, the trigger and bgworker interfaces and the packages of the server
+// the plugins use.  A plugin declares the version it is built against in its
+// main package,
+//
+// 	var MarketstoreABI = abi.Version
+//
+// for the server to refuse loading it with a clear error if the version
+// differs from its own, rather than failing at runtime.  The version is
+// increased on an incompatible change of the interface.
+//
+// A plugin is also refused by the Go runtime if it is built from another
+// version of any package it shares with the server, which the server reports
+// as a build mismatch.
+package abi
+
+// Version is the version of the plugin interface of the server
+const Version = 1
+
+// Symbol is the name of the variable declaring the version in a plugin
+const Symbol = "MarketstoreABI"
@@ -5,29 +5,80 @@
 // Background workers run under the marketstore server by implementing the
 // interface, started at the very beginning of the server lifecycle before the
 // query interface is started, but internal state shuold be fledged. The server
-// does not handle panics that happen within the plugin.  A plugin can recover
-// from panics, but be careful not to screw the server state if touching
-// internal API.  It is often better to just let it go.
+// recovers the panics of the plugin, and restarts it according to its restart
+// policy, see Supervise, but a panic may leave the server state inconsistent
+// if the plugin touches internal API.
 //
 // Configuration is as follows.
-//  bgworkers:
-//    - module: xxxWorker.so
-//      name: datafeed
-//      config: <according to the plulgin>
+//
+//	bgworkers:
+//	  - module: xxxWorker.so
+//	    name: datafeed
+//	    restart: on-failure
+//	    config: <according to the plulgin>
+//
+// The bgworkers are started again with their new setting when the
+// configuration is reloaded, if they implement Stopper.
 package bgworker
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+var (
+	runningWorkers = stats.NewGauge("marketstore_bgworkers_running",
+		"Number of running background worker plugins", "plugin")
+	mu      sync.Mutex
+	running = map[string]int{}
+)
 
 // BgWorker implements Run().  It will be running under a separate goroutine.
 type BgWorker interface {
 	Run()
 }
 
+// Stopper is implemented by the workers which can be stopped, for them to be
+// replaced when the configuration is reloaded.  Stop makes Run return, the
+// workers not implementing it running until the server exits.
+type Stopper interface {
+	Stop()
+}
+
 // SymbolLoader is an interface to retrieve symbol object from plugin
 type SymbolLoader interface {
 	LoadSymbol(symbolName string) (interface{}, error)
 }
 
+// Run runs the worker under the name, keeping track of whether it is still
+// running for the health checks and metrics.  It returns when the worker does.
+func Run(worker BgWorker, name string) {
+	setRunning(name, 1)
+	defer setRunning(name, -1)
+	worker.Run()
+}
+
+func setRunning(name string, delta int) {
+	mu.Lock()
+	defer mu.Unlock()
+	running[name] += delta
+	runningWorkers.Add(float64(delta), name)
+}
+
+// Running returns whether the workers started with Run are still
+// running, by name
+func Running() map[string]bool {
+	mu.Lock()
+	defer mu.Unlock()
+	m := make(map[string]bool, len(running))
+	for name, count := range running {
+		m[name] = count > 0
+	}
+	return m
+}
+
 // Load loads new BgWorker instance using loader, and initializes it with config.
 func Load(loader SymbolLoader, config map[string]interface{}) (BgWorker, error) {
 	symbolName := "NewBgWorker"
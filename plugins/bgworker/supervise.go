@@ -0,0 +1,153 @@
+package bgworker
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+var (
+	workerPanics = stats.NewCounter("marketstore_bgworker_panics_total",
+		"Number of background worker plugin panics", "plugin")
+	workerRestarts = stats.NewCounter("marketstore_bgworker_restarts_total",
+		"Number of background worker plugin restarts", "plugin")
+)
+
+// The restart policies of a worker, after its Run returns or panics
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// Policy is the restart policy of a supervised worker
+type Policy struct {
+	// Restart is RestartNo, RestartOnFailure for the panics alone, or
+	// RestartAlways
+	Restart string
+	// Delay before the first restart, doubled for each following one up
+	// to MaxDelay.  A worker running for MaxDelay is restarted after
+	// Delay again.
+	Delay, MaxDelay time.Duration
+	// MaxRestarts is the number of consecutive restarts after which the
+	// worker is left stopped, 0 for no limit
+	MaxRestarts int
+}
+
+// Supervisor runs a worker, recovering its panics for them not to crash the
+// server, and restarts it according to its policy until stopped
+type Supervisor struct {
+	name      string
+	policy    Policy
+	newWorker func() (BgWorker, error)
+
+	mu      sync.Mutex
+	worker  BgWorker
+	stopped bool
+	stop    chan struct{}
+}
+
+// Supervise runs the worker under the name in the background, as Run does,
+// the restarts running a new worker of newWorker
+func Supervise(name string, policy Policy, worker BgWorker, newWorker func() (BgWorker, error)) *Supervisor {
+	s := &Supervisor{
+		name:      name,
+		policy:    policy,
+		newWorker: newWorker,
+		worker:    worker,
+		stop:      make(chan struct{}),
+	}
+	go s.run(worker)
+	return s
+}
+
+// Worker returns the worker running, or last run
+func (s *Supervisor) Worker() BgWorker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.worker
+}
+
+// Stop stops the worker if it implements Stopper, and its restarts
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.stop)
+	if stopper, ok := s.worker.(Stopper); ok {
+		stopper.Stop()
+	}
+}
+
+func (s *Supervisor) run(worker BgWorker) {
+	delay := s.policy.Delay
+	restarts := 0
+	for {
+		started := time.Now()
+		failed := true
+		if worker != nil {
+			failed = s.runRecovered(worker)
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if s.policy.Restart != RestartAlways && (s.policy.Restart != RestartOnFailure || !failed) {
+			log.Warn("BgWorker %s stopped", s.name)
+			return
+		}
+		if time.Since(started) >= s.policy.MaxDelay {
+			delay, restarts = s.policy.Delay, 0
+		}
+		if s.policy.MaxRestarts > 0 && restarts >= s.policy.MaxRestarts {
+			log.Error("BgWorker %s stopped after %d restarts, restart the server or reload its setting",
+				s.name, restarts)
+			return
+		}
+		log.Warn("restarting BgWorker %s in %v...", s.name, delay)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > s.policy.MaxDelay {
+			delay = s.policy.MaxDelay
+		}
+		restarts++
+		workerRestarts.Inc(s.name)
+
+		var err error
+		if worker, err = s.newWorker(); err != nil {
+			log.Error("failed to restart BgWorker %s: %v", s.name, err)
+			worker = nil
+			continue
+		}
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		s.worker = worker
+		s.mu.Unlock()
+	}
+}
+
+// runRecovered runs the worker, returning whether it panicked
+func (s *Supervisor) runRecovered(worker BgWorker) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			workerPanics.Inc(s.name)
+			log.Error("BgWorker %s panicked: %v\n%s", s.name, r, string(debug.Stack()))
+			panicked = true
+		}
+	}()
+	Run(worker, s.name)
+	return false
+}
@@ -0,0 +1,107 @@
+package bgworker_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type SuperviseTestSuite struct{}
+
+var _ = Suite(&SuperviseTestSuite{})
+
+// countedWorker panics or returns from Run, counting its runs
+type countedWorker struct {
+	runs   *int32
+	panics bool
+}
+
+func (w *countedWorker) Run() {
+	atomic.AddInt32(w.runs, 1)
+	if w.panics {
+		panic("connection lost")
+	}
+}
+
+// blockingWorker runs until stopped
+type blockingWorker struct {
+	stop chan struct{}
+}
+
+func (w *blockingWorker) Run()  { <-w.stop }
+func (w *blockingWorker) Stop() { close(w.stop) }
+
+func supervise(name string, policy bgworker.Policy, newWorker func() bgworker.BgWorker) *bgworker.Supervisor {
+	return bgworker.Supervise(name, policy, newWorker(), func() (bgworker.BgWorker, error) {
+		return newWorker(), nil
+	})
+}
+
+func waitRuns(c *C, runs *int32, expected int32) {
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(runs) < expected; {
+		if time.Now().After(deadline) {
+			c.Fatalf("%d runs, expected %d", atomic.LoadInt32(runs), expected)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// no more
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(runs), Equals, expected)
+}
+
+func (s *SuperviseTestSuite) TestRestart(c *C) {
+	policy := bgworker.Policy{Restart: bgworker.RestartOnFailure, Delay: time.Millisecond, MaxDelay: time.Second, MaxRestarts: 3}
+
+	// the panics are recovered and restarted up to MaxRestarts
+	var panicked int32
+	supervise("panicking", policy, func() bgworker.BgWorker { return &countedWorker{runs: &panicked, panics: true} })
+	waitRuns(c, &panicked, 4)
+	c.Assert(bgworker.Running()["panicking"], Equals, false)
+
+	// a worker returning is not restarted on failure
+	var returned int32
+	supervise("returning", policy, func() bgworker.BgWorker { return &countedWorker{runs: &returned} })
+	waitRuns(c, &returned, 1)
+
+	// but always
+	var always int32
+	policy.Restart = bgworker.RestartAlways
+	supervise("always", policy, func() bgworker.BgWorker { return &countedWorker{runs: &always} })
+	waitRuns(c, &always, 4)
+
+	// nor without a policy
+	var never int32
+	supervise("never", bgworker.Policy{Restart: bgworker.RestartNo}, func() bgworker.BgWorker { return &countedWorker{runs: &never, panics: true} })
+	waitRuns(c, &never, 1)
+}
+
+func (s *SuperviseTestSuite) TestFailedRestart(c *C) {
+	var runs int32
+	policy := bgworker.Policy{Restart: bgworker.RestartAlways, Delay: time.Millisecond, MaxDelay: time.Second, MaxRestarts: 2}
+	bgworker.Supervise("unloadable", policy, &countedWorker{runs: &runs}, func() (bgworker.BgWorker, error) {
+		return nil, errors.New("not found")
+	})
+	waitRuns(c, &runs, 1)
+}
+
+func (s *SuperviseTestSuite) TestStop(c *C) {
+	policy := bgworker.Policy{Restart: bgworker.RestartAlways, Delay: time.Millisecond, MaxDelay: time.Second}
+	w := &blockingWorker{stop: make(chan struct{})}
+	supervisor := bgworker.Supervise("blocking", policy, w, func() (bgworker.BgWorker, error) {
+		c.Error("restarted after Stop")
+		return w, nil
+	})
+	c.Assert(supervisor.Worker(), Equals, w)
+	supervisor.Stop()
+	// twice
+	supervisor.Stop()
+	time.Sleep(50 * time.Millisecond)
+}
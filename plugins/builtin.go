@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+)
+
+var (
+	builtinsMu sync.RWMutex
+	builtins   = map[string]builtinModule{}
+)
+
+// builtinModule holds the symbols of a module compiled into the server
+type builtinModule map[string]interface{}
+
+func (m builtinModule) lookup(symbolName string) (interface{}, error) {
+	sym, ok := m[symbolName]
+	if !ok {
+		return nil, fmt.Errorf("symbol %s not found in built-in module", symbolName)
+	}
+	return sym, nil
+}
+
+// RegisterTrigger registers the trigger constructor of a module compiled
+// into the server, which the configuration selects by name in place of the
+// file of a plugin module, such as ondiskagg for ondiskagg.so.  It is meant
+// to be called from the init function of the package registering the module.
+func RegisterTrigger(name string, newTrigger func(config map[string]interface{}) (trigger.Trigger, error)) {
+	register(name, "NewTrigger", newTrigger)
+}
+
+// RegisterBgWorker registers the background worker constructor of a module
+// compiled into the server, as RegisterTrigger does for the triggers.
+func RegisterBgWorker(name string, newBgWorker func(config map[string]interface{}) (bgworker.BgWorker, error)) {
+	register(name, "NewBgWorker", newBgWorker)
+}
+
+func register(name, symbolName string, sym interface{}) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+	if _, ok := builtins[name][symbolName]; ok {
+		panic(fmt.Sprintf("plugins: %s of built-in module %s registered twice", symbolName, name))
+	}
+	if builtins[name] == nil {
+		builtins[name] = builtinModule{}
+	}
+	builtins[name][symbolName] = sym
+}
+
+// Builtins returns the names of the built-in modules, sorted
+func Builtins() []string {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func builtin(name string) (builtinModule, bool) {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+	m, ok := builtins[name]
+	return m, ok
+}
@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type BuiltinSuite struct{}
+
+var _ = Suite(&BuiltinSuite{})
+
+type stubWorker struct{}
+
+func (stubWorker) Run() {}
+
+func (s *BuiltinSuite) TearDownTest(c *C) {
+	builtinsMu.Lock()
+	builtins = map[string]builtinModule{}
+	builtinsMu.Unlock()
+}
+
+func (s *BuiltinSuite) TestBuiltin(c *C) {
+	var config map[string]interface{}
+	RegisterTrigger("stubtrigger", func(conf map[string]interface{}) (trigger.Trigger, error) {
+		config = conf
+		return nil, nil
+	})
+	RegisterBgWorker("stubworker", func(map[string]interface{}) (bgworker.BgWorker, error) {
+		return stubWorker{}, nil
+	})
+	c.Assert(Builtins(), DeepEquals, []string{"stubtrigger", "stubworker"})
+
+	loader, err := NewSymbolLoader("stubtrigger")
+	c.Assert(err, IsNil)
+	_, err = trigger.Load(loader, map[string]interface{}{"a": 1})
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]interface{}{"a": 1})
+	// a trigger is not a bgworker
+	_, err = bgworker.Load(loader, nil)
+	c.Assert(err, NotNil)
+
+	loader, err = NewSymbolLoader("stubworker")
+	c.Assert(err, IsNil)
+	w, err := bgworker.Load(loader, nil)
+	c.Assert(err, IsNil)
+	c.Assert(w, Equals, stubWorker{})
+
+	// the error of a missing module lists the built-in ones
+	_, err = NewSymbolLoader("missing.so")
+	c.Assert(err, ErrorMatches, ".*missing.so.*, the built-in modules are stubtrigger, stubworker")
+
+	c.Assert(func() { RegisterBgWorker("stubworker", nil) }, PanicMatches, ".*registered twice")
+}
@@ -2,30 +2,58 @@ package plugins
 
 import (
 	"fmt"
-	"github.com/pkg/errors"
 	"os"
 	"path/filepath"
-	"plugin"
 	"strings"
 
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/process"
+	"github.com/alpacahq/marketstore/plugins/trigger"
 	"github.com/alpacahq/marketstore/utils/log"
 )
 
 type SymbolLoader struct {
-	module *plugin.Plugin
+	lookup func(symbolName string) (interface{}, error)
 }
 
 // NewSymbolLoader creates a SymbolLoader that loads symbol from a particular module.
-// moduleName can be a file name under one of $GOPATH directories or current working
-// directory, or an absolute path to the file.
+// moduleName is the name of a built-in module, or a file name under one of
+// SearchPaths, $GOPATH directories or current working directory, or an
+// absolute path to the file.  A file without the .so extension is the
+// executable of a plugin process, see the process package.
 func NewSymbolLoader(moduleName string) (*SymbolLoader, error) {
-	pi, err := Load(moduleName)
+	if symbols, ok := builtin(moduleName); ok {
+		log.Info("Using built-in module %s", moduleName)
+		return &SymbolLoader{lookup: symbols.lookup}, nil
+	}
+	modulePath, err := findModule(moduleName)
 	if err != nil {
+		if names := Builtins(); len(names) > 0 {
+			return nil, fmt.Errorf("%v, the built-in modules are %s", err, strings.Join(names, ", "))
+		}
 		return nil, err
 	}
-	return &SymbolLoader{
-		module: pi,
-	}, nil
+	if filepath.Ext(modulePath) != ".so" {
+		return &SymbolLoader{lookup: processModule(modulePath).lookup}, nil
+	}
+	lookup, err := loadModule(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	return &SymbolLoader{lookup: lookup}, nil
+}
+
+// processModule returns the constructors of the plugin process of the
+// executable
+func processModule(path string) builtinModule {
+	return builtinModule{
+		"NewTrigger": func(config map[string]interface{}) (trigger.Trigger, error) {
+			return process.NewTrigger(path, config)
+		},
+		"NewBgWorker": func(config map[string]interface{}) (bgworker.BgWorker, error) {
+			return process.NewBgWorker(path, config)
+		},
+	}
 }
 
 // LoadSymbol looks up a symbol from the module.  Plugin packages can accept this
@@ -33,41 +61,43 @@ func NewSymbolLoader(moduleName string) (*SymbolLoader, error) {
 // to note that each plugin package cannot import this plugins package since
 // plugin module cannot import any packages that import built-in plugin package.
 func (l *SymbolLoader) LoadSymbol(symbolName string) (interface{}, error) {
-	return l.module.Lookup(symbolName)
+	return l.lookup(symbolName)
 }
 
-// Load loads plugin module.  If pluginName is relative path name, it is
-// loaded from one of the current GOPATH directories or current working directory.
-// If the path is an absolute path, it loads from the path. err is nil
-// if it succeeds.
-func Load(pluginName string) (pi *plugin.Plugin, err error) {
-	if filepath.IsAbs(pluginName) {
-		return plugin.Open(pluginName)
+// SearchPaths are the directories the relative plugin names are looked up
+// in first, in order, before the bin directories of GOPATH and the current
+// working directory.
+var SearchPaths []string
+
+// findModule returns the path of the module file, looked up in the
+// SearchPaths, the bin directories of GOPATH and the current working
+// directory unless absolute
+func findModule(moduleName string) (string, error) {
+	if filepath.IsAbs(moduleName) {
+		return moduleName, nil
 	}
-	envGOPATH := os.Getenv("GOPATH")
-	gopaths := strings.Split(envGOPATH, ":")
-	if len(gopaths) == 0 {
-		return nil, fmt.Errorf("GOPATH is not set\n")
+	for _, dir := range SearchPaths {
+		modulePath := filepath.Join(dir, moduleName)
+		if _, err := os.Stat(modulePath); err == nil {
+			log.Info("Loading module from plugin path: %s...", modulePath)
+			return modulePath, nil
+		}
 	}
-	for _, path := range gopaths {
-		pluginPath := filepath.Join(filepath.Join(path, "bin"), pluginName)
-		log.Info("Trying to load module from path: %s...\n", pluginPath)
-		pi, err = plugin.Open(pluginPath)
-		if err == nil {
-			log.Info("Success loading module %s.\n", pluginPath)
-			return pi, nil
+	envGOPATH := os.Getenv("GOPATH")
+	for _, path := range filepath.SplitList(envGOPATH) {
+		modulePath := filepath.Join(path, "bin", moduleName)
+		if _, err := os.Stat(modulePath); err == nil {
+			log.Info("Trying to load module from path: %s...", modulePath)
+			return modulePath, nil
 		}
 	}
-	log.Debug("failed to load module from GOPATHs. err="+ err.Error())
 	/*
 		Check the local directory - helpful for testing
 	*/
-	pluginPath := filepath.Join(".", pluginName)
-	pi, err = plugin.Open(pluginPath)
-	if err != nil {
-		return nil,
-			errors.Wrap(err, fmt.Sprintf("module %s not found in bin under any paths in GOPATH=%s or local directory\n",
-				pluginName, envGOPATH))
+	modulePath := filepath.Join(".", moduleName)
+	if _, err := os.Stat(modulePath); err != nil {
+		return "", fmt.Errorf("module %s not found in plugin_paths %v, in bin under any paths in GOPATH=%s or local directory",
+			moduleName, SearchPaths, envGOPATH)
 	}
-	return pi, err
+	return modulePath, nil
 }
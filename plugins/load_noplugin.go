@@ -0,0 +1,14 @@
+//go:build (!linux && !darwin && !freebsd) || !cgo || noplugin
+// +build !linux,!darwin,!freebsd !cgo noplugin
+
+package plugins
+
+import "fmt"
+
+// loadModule refuses the plugin modules, which cannot be loaded by a server
+// built without cgo, with the noplugin tag or for another system than Linux,
+// macOS and FreeBSD
+func loadModule(pluginPath string) (func(symbolName string) (interface{}, error), error) {
+	return nil, fmt.Errorf("module %s cannot be loaded, this server is built without plugin module support, "+
+		"use a built-in module or a plugin process", pluginPath)
+}
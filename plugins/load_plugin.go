@@ -0,0 +1,91 @@
+//go:build (linux || darwin || freebsd) && cgo && !noplugin
+// +build linux darwin freebsd
+// +build cgo
+// +build !noplugin
+
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+
+	"github.com/alpacahq/marketstore/plugins/abi"
+	"github.com/alpacahq/marketstore/utils"
+	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/pkg/errors"
+)
+
+// loadModule loads the plugin module of the path, as Load does
+func loadModule(pluginPath string) (func(symbolName string) (interface{}, error), error) {
+	pi, err := open(pluginPath)
+	if err != nil {
+		return nil, err
+	}
+	return func(symbolName string) (interface{}, error) {
+		return pi.Lookup(symbolName)
+	}, nil
+}
+
+// Load loads plugin module.  If pluginName is relative path name, it is
+// loaded from one of the SearchPaths, the current GOPATH directories or
+// current working directory.  If the path is an absolute path, it loads
+// from the path.  A module built against another version of the plugin
+// interface or of the packages of the server is refused.  err is nil if it
+// succeeds.
+func Load(pluginName string) (pi *plugin.Plugin, err error) {
+	pluginPath, err := findModule(pluginName)
+	if err != nil {
+		return nil, err
+	}
+	return open(pluginPath)
+}
+
+// open opens the module and checks the version of the plugin interface it
+// is built against
+func open(pluginPath string) (*plugin.Plugin, error) {
+	pi, err := plugin.Open(pluginPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "different version of package") {
+			return nil, errors.Wrap(err, fmt.Sprintf(
+				"module %s is built from another version of marketstore than this server (%s), rebuild it from the same source",
+				pluginPath, serverVersion()))
+		}
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to open module %s", pluginPath))
+	}
+	if err = checkABI(pluginPath, pi); err != nil {
+		return nil, err
+	}
+	return pi, nil
+}
+
+// checkABI returns an error if the module declares another version of the
+// plugin interface than that of the server.  The modules declaring none are
+// loaded with a warning.
+func checkABI(pluginPath string, pi *plugin.Plugin) error {
+	sym, err := pi.Lookup(abi.Symbol)
+	if err != nil {
+		log.Warn("module %s does not declare the version of the plugin interface it is built against, "+
+			"add `var %s = abi.Version` to its main package", pluginPath, abi.Symbol)
+		return nil
+	}
+	version, ok := sym.(*int)
+	if !ok {
+		return fmt.Errorf("module %s declares %s of type %T, expected int", pluginPath, abi.Symbol, sym)
+	}
+	if *version != abi.Version {
+		return fmt.Errorf("module %s is built against version %d of the plugin interface, this server (%s) supports version %d, rebuild it from the same source",
+			pluginPath, *version, serverVersion(), abi.Version)
+	}
+	return nil
+}
+
+func serverVersion() string {
+	if utils.Tag != "" {
+		return utils.Tag
+	}
+	if utils.GitHash != "" {
+		return utils.GitHash
+	}
+	return "unknown version"
+}
@@ -1,24 +1,28 @@
+//go:build (linux || darwin || freebsd) && cgo && !noplugin
+// +build linux darwin freebsd
+// +build cgo
+// +build !noplugin
+
 package plugins
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"plugin"
 	"runtime"
-	"testing"
 
+	"github.com/alpacahq/marketstore/plugins/abi"
 	. "gopkg.in/check.v1"
 )
 
-// Hook up gocheck into the "go test" runner.
-func Test(t *testing.T) { TestingT(t) }
-
 type TestSuite struct {
 	TestPluginLib    string
 	AbsTestPluginLib string
 	OldGoPath        string
+	PluginDir        string
 }
 
 var _ = Suite(&TestSuite{})
@@ -61,6 +65,18 @@ func main() {}
 	s.OldGoPath = goPath
 	s.AbsTestPluginLib = soFilePath
 	os.Setenv("GOPATH", newGoPath)
+
+	// plugins declaring the version of the plugin interface
+	s.PluginDir = c.MkDir()
+	for name, version := range map[string]int{"current.so": abi.Version, "future.so": abi.Version + 1} {
+		srcPath := filepath.Join(c.MkDir(), "plugin.go")
+		code := fmt.Sprintf("package main\nvar MarketstoreABI = %d\nfunc main() {}\n", version)
+		c.Assert(ioutil.WriteFile(srcPath, []byte(code), 0600), IsNil)
+		cmd := exec.Command("go", "build", "-buildmode=plugin", "-o", filepath.Join(s.PluginDir, name), srcPath)
+		if err := cmd.Run(); err != nil {
+			c.Skip("Unable to build test plugin")
+		}
+	}
 }
 
 func (s *TestSuite) TearDownSuite(c *C) {
@@ -85,3 +101,20 @@ func (s *TestSuite) TestLoadFromGOPATH(c *C) {
 	c.Check(pi, NotNil)
 	c.Check(err, IsNil)
 }
+
+func (s *TestSuite) TestLoadFromSearchPaths(c *C) {
+	SearchPaths = []string{c.MkDir(), s.PluginDir}
+	defer func() { SearchPaths = nil }()
+
+	pi, err := Load("current.so")
+	c.Assert(err, IsNil)
+	c.Assert(pi, NotNil)
+
+	_, err = Load("nonexistent.so")
+	c.Assert(err, ErrorMatches, "module nonexistent.so not found in plugin_paths .*")
+}
+
+func (s *TestSuite) TestLoadABIMismatch(c *C) {
+	_, err := Load(filepath.Join(s.PluginDir, "future.so"))
+	c.Assert(err, ErrorMatches, ".*future.so is built against version 2 of the plugin interface.*")
+}
@@ -0,0 +1,177 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/alpacahq/marketstore/plugins/abi"
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// stopTimeout is how long a plugin process is given to exit once its
+// standard input is closed, before it is killed
+var stopTimeout = 5 * time.Second
+
+// client is the connection of the server to a plugin process
+type client struct {
+	path   string
+	cmd    *exec.Cmd
+	rpc    *rpc.Client
+	exited chan struct{}
+}
+
+// start starts the plugin process of the executable, and constructs its
+// trigger or bgworker with the configuration
+func start(path, kind string, config map[string]interface{}) (*client, error) {
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), cookieKey+"="+cookieValue)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin process %s: %v", path, err)
+	}
+	c := &client{
+		path:   path,
+		cmd:    cmd,
+		rpc:    jsonrpc.NewClient(pipe{stdout, stdin}),
+		exited: make(chan struct{}),
+	}
+	go c.forwardLogs(stderr)
+
+	var reply InitReply
+	err = c.rpc.Call(serviceName+".Init", InitArgs{Kind: kind, Config: jsonConfig(config)}, &reply)
+	if err == nil && reply.ABI != abi.Version {
+		err = fmt.Errorf("built against version %d of the plugin interface, this server supports version %d",
+			reply.ABI, abi.Version)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("plugin process %s: %v", path, err)
+	}
+	log.Info("Started plugin process %s (pid %d)", path, cmd.Process.Pid)
+	return c, nil
+}
+
+// forwardLogs writes the lines of the standard error of the process to the
+// log, until the process exits
+func (c *client) forwardLogs(stderr io.Reader) {
+	name := filepath.Base(c.path)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Info("[%s] %s", name, scanner.Text())
+	}
+	err := c.cmd.Wait()
+	close(c.exited)
+	if err != nil {
+		log.Warn("plugin process %s exited: %v", c.path, err)
+	}
+}
+
+// Close closes the standard input of the process, which makes it exit, and
+// kills it if it does not in time
+func (c *client) Close() error {
+	c.rpc.Close()
+	select {
+	case <-c.exited:
+	case <-time.After(stopTimeout):
+		log.Warn("killing plugin process %s", c.path)
+		c.cmd.Process.Kill()
+		<-c.exited
+	}
+	return nil
+}
+
+// pipe is the connection to the process over its standard output and input
+type pipe struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (p pipe) Close() error {
+	p.WriteCloser.Close()
+	return p.ReadCloser.Close()
+}
+
+// NewTrigger starts the plugin process of the executable, serving a trigger
+// constructed with the configuration.  The trigger fires that of the
+// process, until closed.
+func NewTrigger(path string, config map[string]interface{}) (trigger.Trigger, error) {
+	c, err := start(path, kindTrigger, config)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteTrigger{client: c}, nil
+}
+
+// remoteTrigger is the trigger of a plugin process
+type remoteTrigger struct {
+	*client
+}
+
+func (t *remoteTrigger) Fire(keyPath string, records []trigger.Record) {
+	if err := t.TryFire(keyPath, records); err != nil {
+		log.Error("plugin process %s failed to fire on %s: %v", t.path, keyPath, err)
+	}
+}
+
+// TryFire fires the trigger of the process, returning the error it returns
+// or its failure to run it
+func (t *remoteTrigger) TryFire(keyPath string, records []trigger.Record) error {
+	args := FireArgs{KeyPath: keyPath, Records: make([][]byte, len(records))}
+	for i, r := range records {
+		args.Records[i] = r
+	}
+	return t.rpc.Call(serviceName+".Fire", args, &Empty{})
+}
+
+// NewBgWorker starts the plugin process of the executable, serving a
+// bgworker constructed with the configuration.  The bgworker runs that of
+// the process, until it returns or the process exits.
+func NewBgWorker(path string, config map[string]interface{}) (bgworker.BgWorker, error) {
+	c, err := start(path, kindBgWorker, config)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteWorker{client: c}, nil
+}
+
+// remoteWorker is the bgworker of a plugin process
+type remoteWorker struct {
+	*client
+}
+
+func (w *remoteWorker) Run() {
+	err := w.rpc.Call(serviceName+".Run", Empty{}, &Empty{})
+	if err != nil && err != rpc.ErrShutdown {
+		log.Error("plugin process %s stopped running: %v", w.path, err)
+	}
+}
+
+// Stop stops the bgworker of the process, then the process
+func (w *remoteWorker) Stop() {
+	call := w.rpc.Go(serviceName+".Stop", Empty{}, &Empty{}, nil)
+	select {
+	case <-call.Done:
+	case <-time.After(stopTimeout):
+	}
+	w.Close()
+}
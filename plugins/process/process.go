@@ -0,0 +1,97 @@
+// Package process runs triggers and bgworkers as plugin processes, apart
+// from the server, for the systems where the Go plugin package cannot load
+// their .so modules, such as Windows.  A plugin process is an executable
+// whose main function serves a trigger or a bgworker constructor:
+//
+//	func main() {
+//		process.ServeTrigger(webhooktrigger.NewTrigger)
+//	}
+//
+// The server starts the executable configured as the module of a trigger
+// or a bgworker, a file without the .so extension, once for each of them.
+// It calls the plugin through net/rpc with the JSON codec over the standard
+// input and output of the process, which writes its logs to its standard
+// error, forwarded to the log of the server.  The configuration of the
+// module is passed as JSON, so that its numbers are float64.
+//
+// A trigger process receives the records written and their key path, and
+// can read the data files but not write to the database, which it does
+// through the client API of the server instead, as the bgworker processes.
+package process
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// cookieKey and cookieValue are set in the environment of the plugin
+	// processes, which refuse to start without them
+	cookieKey   = "MARKETSTORE_PLUGIN"
+	cookieValue = "a2a56b1d0f09cb3e"
+
+	// serviceName is the net/rpc name of the service of the plugin processes
+	serviceName = "Plugin"
+
+	kindTrigger  = "trigger"
+	kindBgWorker = "bgworker"
+)
+
+// InitArgs are the arguments of Plugin.Init, constructing the trigger or
+// the bgworker of the process with the configuration
+type InitArgs struct {
+	Kind   string
+	Config map[string]interface{}
+}
+
+// InitReply is the reply of Plugin.Init, with the version of the plugin
+// interface the process is built against
+type InitReply struct {
+	ABI int
+}
+
+// FireArgs are the arguments of Plugin.Fire, those of Trigger.Fire
+type FireArgs struct {
+	KeyPath string
+	Records [][]byte
+}
+
+// Empty is the argument and reply of the calls without any
+type Empty struct{}
+
+// jsonConfig returns the configuration with the maps of its values keyed
+// by strings, as YAML decodes them keyed by interface{} values which JSON
+// cannot encode
+func jsonConfig(config map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		converted[k] = jsonValue(v)
+	}
+	return converted
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case map[string]interface{}:
+		return jsonConfig(v)
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = jsonValue(e)
+		}
+		return s
+	}
+	return v
+}
+
+// isPlugin returns whether the process is started by the server as a
+// plugin process
+func isPlugin() bool {
+	return os.Getenv(cookieKey) == cookieValue
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type ProcessTests struct {
+	binDir string
+}
+
+var _ = Suite(&ProcessTests{})
+
+func (s *ProcessTests) SetUpSuite(c *C) {
+	s.binDir = c.MkDir()
+	for _, name := range []string{"trigger", "worker"} {
+		cmd := exec.Command("go", "build", "-o", filepath.Join(s.binDir, name), "./testdata/"+name)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			c.Fatalf("failed to build the test plugin %s: %v\n%s", name, err, out)
+		}
+	}
+}
+
+func (s *ProcessTests) TestTrigger(c *C) {
+	out := filepath.Join(c.MkDir(), "fired")
+	trig, err := NewTrigger(filepath.Join(s.binDir, "trigger"), map[string]interface{}{
+		"path":   out,
+		"nested": map[interface{}]interface{}{"a": 1},
+	})
+	c.Assert(err, IsNil)
+	defer trig.(*remoteTrigger).Close()
+
+	record := trigger.Record(append(make([]byte, 8), "payload"...))
+	checked := trig.(trigger.CheckedTrigger)
+	c.Assert(checked.TryFire("AAPL/1Min/OHLCV/2020.bin", []trigger.Record{record}), IsNil)
+	c.Assert(checked.TryFire("fail", []trigger.Record{record}), ErrorMatches, "failed on fail")
+	data, err := ioutil.ReadFile(out)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "AAPL/1Min/OHLCV/2020.bin 1 payload\n")
+
+	// the configuration is checked by the process
+	_, err = NewTrigger(filepath.Join(s.binDir, "trigger"), nil)
+	c.Assert(err, ErrorMatches, ".*path is required")
+	// a process serves one kind of plugin
+	_, err = NewBgWorker(filepath.Join(s.binDir, "trigger"), nil)
+	c.Assert(err, ErrorMatches, ".*serves a trigger, not a bgworker")
+}
+
+func (s *ProcessTests) TestBgWorker(c *C) {
+	w, err := NewBgWorker(filepath.Join(s.binDir, "worker"), nil)
+	c.Assert(err, IsNil)
+
+	done := make(chan struct{})
+	go func() {
+		w.Run()
+		close(done)
+	}()
+	// the output of the worker does not break the calls
+	time.Sleep(100 * time.Millisecond)
+	w.(bgworker.Stopper).Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the worker did not stop")
+	}
+	select {
+	case <-w.(*remoteWorker).exited:
+	default:
+		c.Fatal("the process did not exit")
+	}
+}
+
+func (s *ProcessTests) TestNotStarted(c *C) {
+	_, err := NewTrigger(filepath.Join(s.binDir, "missing"), nil)
+	c.Assert(err, ErrorMatches, "failed to start plugin process .*")
+
+	// run directly, the process refuses to start
+	err = exec.Command(filepath.Join(s.binDir, "worker")).Run()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,137 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"github.com/alpacahq/marketstore/plugins/abi"
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+// ServeTrigger serves the trigger constructor as a plugin process, until
+// the server closes its standard input.  It exits if the process is not
+// started by the server.
+func ServeTrigger(newTrigger func(config map[string]interface{}) (trigger.Trigger, error)) {
+	serve(&service{kind: kindTrigger, newTrigger: newTrigger})
+}
+
+// ServeBgWorker serves the bgworker constructor as a plugin process, as
+// ServeTrigger does.
+func ServeBgWorker(newBgWorker func(config map[string]interface{}) (bgworker.BgWorker, error)) {
+	serve(&service{kind: kindBgWorker, newBgWorker: newBgWorker})
+}
+
+func serve(s *service) {
+	if !isPlugin() {
+		fmt.Fprintln(os.Stderr, "This is a marketstore plugin process, to be configured as the module of a "+
+			s.kind+" rather than run directly.")
+		os.Exit(1)
+	}
+	// the standard output carries the calls of the server, the logs
+	// written to it would break them
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	log.SetOutput(os.Stderr)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, s); err != nil {
+		log.Fatal("failed to register the plugin service: %v", err)
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(stdio{stdout}))
+}
+
+// stdio is the connection to the server over the standard input and output
+type stdio struct {
+	io.Writer
+}
+
+func (stdio) Read(p []byte) (int, error) { return os.Stdin.Read(p) }
+func (stdio) Close() error               { return os.Stdin.Close() }
+
+// service is the net/rpc service of a plugin process
+type service struct {
+	kind        string
+	newTrigger  func(config map[string]interface{}) (trigger.Trigger, error)
+	newBgWorker func(config map[string]interface{}) (bgworker.BgWorker, error)
+
+	mu      sync.Mutex
+	trigger trigger.Trigger
+	worker  bgworker.BgWorker
+}
+
+// Init constructs the trigger or the bgworker of the process
+func (s *service) Init(args InitArgs, reply *InitReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if args.Kind != s.kind {
+		return fmt.Errorf("the plugin process serves a %s, not a %s", s.kind, args.Kind)
+	}
+	var err error
+	if s.kind == kindTrigger {
+		s.trigger, err = s.newTrigger(args.Config)
+	} else {
+		s.worker, err = s.newBgWorker(args.Config)
+	}
+	if err != nil {
+		return err
+	}
+	reply.ABI = abi.Version
+	return nil
+}
+
+// Fire fires the trigger, returning the error of TryFire or the panic of
+// the trigger
+func (s *service) Fire(args FireArgs, _ *Empty) (err error) {
+	s.mu.Lock()
+	trig := s.trigger
+	s.mu.Unlock()
+	if trig == nil {
+		return fmt.Errorf("the plugin process has no trigger")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("recovering from %v\n%s", r, string(debug.Stack()))
+			err = fmt.Errorf("trigger panicked: %v", r)
+		}
+	}()
+	records := make([]trigger.Record, len(args.Records))
+	for i, r := range args.Records {
+		records[i] = trigger.Record(r)
+	}
+	if checked, ok := trig.(trigger.CheckedTrigger); ok {
+		return checked.TryFire(args.KeyPath, records)
+	}
+	trig.Fire(args.KeyPath, records)
+	return nil
+}
+
+// Run runs the bgworker, returning when it does
+func (s *service) Run(_ Empty, _ *Empty) error {
+	s.mu.Lock()
+	worker := s.worker
+	s.mu.Unlock()
+	if worker == nil {
+		return fmt.Errorf("the plugin process has no bgworker")
+	}
+	worker.Run()
+	return nil
+}
+
+// Stop stops the bgworker if it implements bgworker.Stopper, the process
+// being stopped by the server anyway
+func (s *service) Stop(_ Empty, _ *Empty) error {
+	s.mu.Lock()
+	worker := s.worker
+	s.mu.Unlock()
+	if stopper, ok := worker.(bgworker.Stopper); ok {
+		stopper.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// A trigger appending the key paths it is fired on to the file of its
+// "path" setting, and failing on the "fail" key path
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alpacahq/marketstore/plugins/process"
+	"github.com/alpacahq/marketstore/plugins/trigger"
+)
+
+type appendTrigger struct {
+	path string
+}
+
+func (t *appendTrigger) Fire(keyPath string, records []trigger.Record) {
+	t.TryFire(keyPath, records)
+}
+
+func (t *appendTrigger) TryFire(keyPath string, records []trigger.Record) error {
+	if keyPath == "fail" {
+		return fmt.Errorf("failed on %s", keyPath)
+	}
+	f, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s %d %s\n", keyPath, len(records), records[0].Payload())
+	return err
+}
+
+func main() {
+	process.ServeTrigger(func(config map[string]interface{}) (trigger.Trigger, error) {
+		path, ok := config["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("path is required")
+		}
+		return &appendTrigger{path: path}, nil
+	})
+}
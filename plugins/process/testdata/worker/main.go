@@ -0,0 +1,28 @@
+// A bgworker running until stopped, printing to its standard output
+package main
+
+import (
+	"fmt"
+
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/plugins/process"
+)
+
+type stoppableWorker struct {
+	done chan struct{}
+}
+
+func (w *stoppableWorker) Run() {
+	fmt.Println("running")
+	<-w.done
+}
+
+func (w *stoppableWorker) Stop() {
+	close(w.done)
+}
+
+func main() {
+	process.ServeBgWorker(func(config map[string]interface{}) (bgworker.BgWorker, error) {
+		return &stoppableWorker{done: make(chan struct{})}, nil
+	})
+}
@@ -0,0 +1,59 @@
+package trigger
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker is the circuit breaker of a trigger.  After Threshold consecutive
+// failed executions, the circuit opens and the trigger is not fired for
+// Cooldown, its writes being dead-lettered instead, so that a failing trigger
+// does not retry every write in vain.  A successful execution after the
+// cooldown closes the circuit, while a failed one opens it again.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewBreaker returns the breaker opening after threshold failures, nil if
+// the threshold is not positive
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// Allow returns false if the circuit is open at now
+func (b *Breaker) Allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// Report records the outcome of an execution at now, and returns true if
+// the failure opened the circuit
+func (b *Breaker) Report(err error, now time.Time) (opened bool) {
+	if b == nil {
+		return false
+	}
+	b.Lock()
+	defer b.Unlock()
+	if err == nil {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openUntil = now.Add(b.Cooldown)
+		return true
+	}
+	return false
+}
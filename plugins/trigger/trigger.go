@@ -15,6 +15,17 @@
 // 	    on: "*/1Min/OHLCV"
 // 	    config: <according to the plugin>
 //
+// The triggers matching a write are fired concurrently, unless ordered by
+// their names and after lists, such as a dedup trigger to fire before the
+// on-disk aggregates of the same writes.
+//
+// 	triggers:
+// 	  - module: dedup.so
+// 	    on: "*/1Min/OHLCV"
+// 	  - module: ondiskagg.so
+// 	    on: "*/1Min/OHLCV"
+// 	    after: [dedup.so]
+//
 // The "on" value is matched with the file path to decide whether the trigger
 // is fired or not.  It can contain wildcard character "*".
 // As of now, trigger fires only on the running state.  Trigger on WAL replay
@@ -39,6 +50,24 @@ type Trigger interface {
 	Fire(keyPath string, records []Record)
 }
 
+// CheckedTrigger is implemented by the triggers reporting the failures of
+// their executions, such as a failed write of derived data, for them to be
+// retried and dead-lettered like panics rather than dropped silently.  The
+// executor calls TryFire instead of Fire on these triggers.
+type CheckedTrigger interface {
+	Trigger
+	TryFire(keyPath string, records []Record) error
+}
+
+// Reconciler is implemented by the triggers which catch up with the writes
+// made while they were not running, e.g. by an offline bulk backfill or the
+// WAL replay, which do not fire the triggers.  Reconcile is called once in
+// the background on startup, with the paths of the files of the catalog
+// matching the On condition, relative from the catalog root directory.
+type Reconciler interface {
+	Reconcile(keyPaths []string)
+}
+
 // TriggerMatcher checks if the trigger should be fired or not.
 type TriggerMatcher struct {
 	Trigger Trigger
@@ -46,6 +75,25 @@ type TriggerMatcher struct {
 	// fire event.  It is the prefix of file path such as
 	// ""*/1Min/OHLC"
 	On string
+	// Name is the name of the plugin, e.g. ondiskagg.so, used in metrics
+	Name string
+	// After are the triggers whose Fire returns before that of this one
+	// on the writes matched by both, which are otherwise fired concurrently
+	After []*TriggerMatcher
+	// Retries of a failed execution, the first RetryDelay after it and
+	// each following one after twice the delay of the previous
+	Retries    int
+	RetryDelay time.Duration
+	// Breaker stops firing the trigger after consecutive failures
+	Breaker *Breaker
+}
+
+// PluginName returns the name of the plugin, or its On condition if unnamed
+func (tm *TriggerMatcher) PluginName() string {
+	if tm.Name != "" {
+		return tm.Name
+	}
+	return tm.On
 }
 
 // SymbolLoader is an interface to retrieve symbol object from plugin
@@ -81,7 +129,10 @@ func (r *Record) Payload() []byte {
 
 // RecordsToColumnSeries takes a slice of Record, along with the required
 // information for constructing a ColumnSeries, and builds it from the
-// slice of Record.
+// slice of Record.  The dictionary encoded STRING columns hold the []uint32
+// codes of their strings, the other string columns their strings.  The
+// missing values are the set bits of the Nulls column of the buckets with
+// one, bit i for the i-th column after the Epoch.
 func RecordsToColumnSeries(
 	tbk io.TimeBucketKey,
 	ds []io.DataShape,
@@ -1,6 +1,7 @@
 package trigger
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 	"time"
@@ -103,3 +104,30 @@ func (s *TestSuite) TestRecordsToColumnSeries(c *C) {
 		c.Check(cs.GetEpoch()[i], Equals, testCS.GetEpoch()[i])
 	}
 }
+
+func (s *TestSuite) TestBreaker(c *C) {
+	var b *Breaker
+	c.Assert(NewBreaker(0, time.Minute), IsNil)
+	// a nil breaker never opens
+	c.Assert(b.Report(errors.New("failed"), time.Now()), Equals, false)
+	c.Assert(b.Allow(time.Now()), Equals, true)
+
+	now := time.Now()
+	b = NewBreaker(2, time.Minute)
+	c.Assert(b.Report(errors.New("failed"), now), Equals, false)
+	c.Assert(b.Report(nil, now), Equals, false)
+	c.Assert(b.Report(errors.New("failed"), now), Equals, false)
+	c.Assert(b.Allow(now), Equals, true)
+	c.Assert(b.Report(errors.New("failed"), now), Equals, true)
+	c.Assert(b.Allow(now.Add(time.Second)), Equals, false)
+
+	// a failure after the cooldown opens it again, a success closes it
+	now = now.Add(time.Minute)
+	c.Assert(b.Allow(now), Equals, true)
+	c.Assert(b.Report(errors.New("failed"), now), Equals, true)
+	c.Assert(b.Allow(now), Equals, false)
+	now = now.Add(time.Minute)
+	c.Assert(b.Report(nil, now), Equals, false)
+	c.Assert(b.Report(errors.New("failed"), now), Equals, false)
+	c.Assert(b.Allow(now), Equals, true)
+}
@@ -193,6 +193,194 @@ func (s *TestSuite) TestExecutableStatement(c *C) {
 	c.Assert(err == nil, Equals, true)
 	c.Assert(count[0] == int64(0), Equals, true)
 }
+func (s *TestSuite) TestUnionAll(c *C) {
+	stmt := "SELECT Epoch, Open, Close from `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00'" +
+		" UNION ALL SELECT Epoch, Open, Close from `BBPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00';"
+	ast, err := NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err := NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	cs, err := es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 58)
+	c.Assert(cs.GetColumnNames(), DeepEquals, []string{"Epoch", "Open", "Close"})
+
+	// Three-way union with a limit on the combined result
+	stmt = "SELECT * from `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00'" +
+		" UNION ALL SELECT * from `BBPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00'" +
+		" UNION ALL SELECT * from `CCPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00' LIMIT 70;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	cs, err = es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 70)
+
+	// Mismatched select lists
+	stmt = "SELECT Epoch, Open from `AAPL/1Min/OHLCV` UNION ALL SELECT Epoch, Close from `BBPL/1Min/OHLCV`;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	_, err = es.Materialize()
+	evalAndPrint(c, err, true, stmt)
+
+	// Only UNION ALL is supported
+	stmt = "SELECT Epoch, Open from `AAPL/1Min/OHLCV` UNION SELECT Epoch, Open from `BBPL/1Min/OHLCV`;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	_, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, true, stmt)
+}
+
+func (s *TestSuite) TestGroupByHaving(c *C) {
+	// 29 rows cycling through 15 distinct Open values
+	stmt := "SELECT Open, count(*) from `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00' GROUP BY Open;"
+	ast, err := NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err := NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	cs, err := es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 15)
+	c.Assert(cs.GetColumnNames(), DeepEquals, []string{"Epoch", "Open", "Count"})
+	var total int64
+	for _, cnt := range cs.GetColumn("Count").([]int64) {
+		total += cnt
+	}
+	c.Assert(total, Equals, int64(29))
+
+	stmt = "SELECT Open, count(*) from `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00' GROUP BY Open HAVING Count > 1;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	cs, err = es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 14)
+
+	// HAVING on an aliased aggregate
+	stmt = "SELECT Open, max(Volume) AS MaxVol from `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00' GROUP BY Open HAVING MaxVol >= 0 AND Open < 0.35;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	cs, err = es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 3)
+	c.Assert(cs.Exists("MaxVol"), Equals, true)
+
+	// HAVING without GROUP BY filters the whole result
+	stmt = "SELECT count(*) from `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN '2000-01-05-12:30' AND '2000-01-05-13:00' HAVING Count > 100;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	cs, err = es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 0)
+
+	// Non aggregate column that is not grouped
+	stmt = "SELECT Open, Close, count(*) from `AAPL/1Min/OHLCV` GROUP BY Open;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	_, err = es.Materialize()
+	evalAndPrint(c, err, true, stmt)
+
+	// HAVING on a column not present in the output
+	stmt = "SELECT Open, count(*) from `AAPL/1Min/OHLCV` GROUP BY Open HAVING High > 1;"
+	ast, err = NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	es, err = NewExecutableStatement(ast.Mtree)
+	evalAndPrint(c, err, false, stmt)
+	_, err = es.Materialize()
+	evalAndPrint(c, err, true, stmt)
+}
+
+func (s *TestSuite) TestPreparedStatement(c *C) {
+	stmt := "SELECT Open, High FROM `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN ? AND ? AND Open > ?;"
+	ast, err := NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(ast.NumParameters, Equals, 3)
+
+	// The same parsed statement bound with different windows
+	es, err := NewPreparedExecutableStatement(ast, "2000-01-05-12:30", "2000-01-05-13:00", 0)
+	evalAndPrint(c, err, false, stmt)
+	cs, err := es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 29)
+
+	start := time.Date(2000, time.January, 5, 12, 30, 0, 0, time.UTC)
+	es, err = NewPreparedExecutableStatement(ast, start, start.Add(10*time.Minute).Unix(), 0.0)
+	evalAndPrint(c, err, false, stmt)
+	cs, err = es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 9)
+
+	// String values are bound as values, not spliced into the statement
+	_, err = NewPreparedExecutableStatement(ast, "2000-01-05' OR 1=1 --", "2000-01-06", 0)
+	evalAndPrint(c, err, true, stmt)
+
+	// Wrong number of values
+	_, err = NewPreparedExecutableStatement(ast, "2000-01-05-12:30")
+	evalAndPrint(c, err, true, stmt)
+
+	// Unbindable type
+	_, err = NewPreparedExecutableStatement(ast, "2000-01-05-12:30", "2000-01-05-13:00", []int{1})
+	evalAndPrint(c, err, true, stmt)
+
+	cache := NewStatementCache(2)
+	ast1, err := cache.Get(stmt)
+	evalAndPrint(c, err, false, stmt)
+	ast2, err := cache.Get(stmt)
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(ast1 == ast2, Equals, true)
+	cache.Get("SELECT Open FROM `AAPL/1Min/OHLCV`;")
+	cache.Get("SELECT High FROM `AAPL/1Min/OHLCV`;")
+	c.Assert(cache.Len(), Equals, 2)
+	ast3, err := cache.Get(stmt)
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(ast1 == ast3, Equals, false)
+}
+
+func (s *TestSuite) TestPositionalParameters(c *C) {
+	// $2 bound twice, and the $ of the strings and comments left as is
+	stmt := "SELECT Open, High FROM `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN $1 AND $2 /* $3 */ AND Epoch <= $2 AND Open > $3; -- $4"
+	ast, err := NewAstBuilder(stmt)
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(ast.NumParameters, Equals, 3)
+
+	es, err := NewPreparedExecutableStatement(ast, "2000-01-05-12:30", "2000-01-05-13:00", 0)
+	evalAndPrint(c, err, false, stmt)
+	cs, err := es.Materialize()
+	evalAndPrint(c, err, false, stmt)
+	c.Assert(cs.Len(), Equals, 29)
+
+	// Wrong number of values
+	_, err = NewPreparedExecutableStatement(ast, "2000-01-05-12:30", "2000-01-05-13:00")
+	evalAndPrint(c, err, true, stmt)
+	_, err = NewPreparedExecutableStatement(ast, "2000-01-05-12:30", "2000-01-05-13:00", 0, 1)
+	evalAndPrint(c, err, true, stmt)
+
+	source, ordinals, err := positionalParameters("SELECT 'it''s $1', \"$2\" FROM `$3` WHERE Epoch > $10;")
+	c.Assert(err, IsNil)
+	c.Assert(source, Equals, "SELECT 'it''s $1', \"$2\" FROM `$3` WHERE Epoch > ?  ;")
+	c.Assert(ordinals, DeepEquals, []int{9})
+
+	for _, stmt := range []string{
+		"SELECT Open FROM `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN $1 AND ?;",
+		"SELECT Open FROM `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN $1 AND $3;",
+		"SELECT Open FROM `AAPL/1Min/OHLCV` WHERE Epoch BETWEEN $0 AND $1;",
+		"SELECT Open FROM `AAPL/1Min/OHLCV` WHERE Epoch > $;",
+	} {
+		_, err = NewAstBuilder(stmt)
+		evalAndPrint(c, err, true, stmt)
+	}
+}
+
 func (s *TestSuite) TestStatementErrors(c *C) {
 	stmt := "select * from `fooble`;"
 	ast, err := NewAstBuilder(stmt)
@@ -215,6 +403,31 @@ func (s *TestSuite) TestInsertInto(c *C) {
 	c.Assert(cs.Len(), Equals, 1)
 }
 
+func (s *TestSuite) TestBuckets(c *C) {
+	buckets := func(stmt string) (reads, writes []string) {
+		ast, err := NewAstBuilder(stmt)
+		evalAndPrint(c, err, false, stmt)
+		es, err := NewExecutableStatement(ast.Mtree)
+		evalAndPrint(c, err, false, stmt)
+		return es.Buckets()
+	}
+
+	reads, writes := buckets("SELECT * FROM `AAPL/1Min/OHLCV`;")
+	c.Assert(reads, DeepEquals, []string{"AAPL/1Min/OHLCV"})
+	c.Assert(writes, IsNil)
+
+	reads, writes = buckets("SELECT Epoch, Open from `AAPL/1Min/OHLCV` UNION ALL SELECT Epoch, Open from `BBPL/1Min/OHLCV`;")
+	c.Assert(reads, DeepEquals, []string{"AAPL/1Min/OHLCV", "BBPL/1Min/OHLCV"})
+	c.Assert(writes, IsNil)
+
+	reads, writes = buckets("SELECT * FROM (SELECT * FROM `AAPL/1Min/OHLCV`);")
+	c.Assert(reads, DeepEquals, []string{"AAPL/1Min/OHLCV"})
+
+	reads, writes = buckets("INSERT INTO `AAPL/5Min/OHLCV` SELECT * from `AAPL/1Min/OHLCV`;")
+	c.Assert(reads, DeepEquals, []string{"AAPL/1Min/OHLCV"})
+	c.Assert(writes, DeepEquals, []string{"AAPL/5Min/OHLCV"})
+}
+
 func (s *TestSuite) TestAggregation(c *C) {
 	cs := makeTestCS()
 	epoch := cs.GetColumn("Epoch").([]int64)
@@ -15,6 +15,7 @@ type ExecutableStatement struct {
 	nodeCursor *ExecutableStatement
 	pendingSP  *StaticPredicate
 	IsExplain  bool
+	parameters []interface{} // Values bound to the placeholders, in order
 }
 
 func NewExecutableStatement(qtree ...IMSTree) (es *ExecutableStatement, err error) {
@@ -65,6 +66,9 @@ func (es *ExecutableStatement) Materialize() (cs *io.ColumnSeries, err error) {
 			//			fmt.Println("Materialize Select Relation Statement (no children)")
 			cs, err = ctx.Materialize()
 			return cs, err
+		case *UnionStatement:
+			cs, err = ctx.Materialize()
+			return cs, err
 		default:
 			//			fmt.Println("Materialize Default (nil)")
 			return nil, nil
@@ -72,6 +76,43 @@ func (es *ExecutableStatement) Materialize() (cs *io.ColumnSeries, err error) {
 	}
 }
 
+/*
+Buckets returns the item keys of the buckets the statement reads from and
+writes to, for authorization before it is materialized
+*/
+func (es *ExecutableStatement) Buckets() (reads, writes []string) {
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch ctx := node.(type) {
+		case *ExecutableStatement:
+			if ctx.GetChildCount() != 0 {
+				walk(ctx.GetChild(0))
+			} else if ctx.nodeCursor != nil {
+				walk(ctx.nodeCursor.payload)
+			}
+		case *SelectRelation:
+			if ctx == nil {
+				return
+			}
+			if len(ctx.PrimaryTargetName) != 0 {
+				reads = append(reads, ctx.PrimaryTargetName[0])
+			}
+			for _, child := range ctx.GetChildren() {
+				walk(child)
+			}
+			walk(ctx.Subquery)
+		case *UnionStatement:
+			walk(ctx.Left)
+			walk(ctx.Right)
+		case *InsertIntoStatement:
+			writes = append(writes, ctx.TableName)
+			walk(ctx.SelectRelation)
+		}
+	}
+	walk(es)
+	return reads, writes
+}
+
 func (es *ExecutableStatement) Visit(tree IMSTree) interface{} {
 	return tree.Accept(es)
 }
@@ -105,11 +146,15 @@ func (es *ExecutableStatement) VisitStatementParse(ctx *StatementParse) interfac
 		if err != nil {
 			return fmt.Errorf("Unable to create executable query")
 		}
+		es.nodeCursor.parameters = es.parameters
 		retval := QueryWalk(es.nodeCursor, ctx.query)
 		if err, ok := retval.(error); ok {
 			return err
 		}
-		sr := es.nodeCursor.payload.(*SelectRelation)
+		sr, ok := es.nodeCursor.payload.(*SelectRelation)
+		if !ok {
+			return fmt.Errorf("Unsupported statement type: %s", "INSERT INTO with a set operation")
+		}
 		es.nodeCursor = es
 
 		// Get Table Name
@@ -139,8 +184,10 @@ func QueryWalk(es *ExecutableStatement, i_ctx IMSTree) interface{} {
 	if ctx, ok = i_ctx.(*QueryParse); !ok {
 		return fmt.Errorf("Unable to get *QueryParse")
 	}
-	var retval interface{}
-	retval = es.nodeCursor.Visit(ctx)
+	return walkQueryTree(es, es.nodeCursor.Visit(ctx))
+}
+
+func walkQueryTree(es *ExecutableStatement, retval interface{}) interface{} {
 	if retval != nil {
 		for {
 			switch value := retval.(type) {
@@ -182,11 +229,48 @@ func (es *ExecutableStatement) VisitQueryNoWithParse(ctx *QueryNoWithParse) inte
 }
 func (es *ExecutableStatement) VisitQueryTermParse(ctx *QueryTermParse) interface{} {
 	if ctx.queryPrimary == nil {
-		// TODO: Support JOIN
-		return fmt.Errorf("Unsupported statement type: %s", "Join")
+		// TODO: Support INTERSECT, EXCEPT and UNION DISTINCT
+		if ctx.operator != UNION || ctx.quantifier != ALL_SET {
+			return fmt.Errorf("Unsupported statement type: %s", "set operation other than UNION ALL")
+		}
+		left, err := es.newSetOperand(ctx.left)
+		if err != nil {
+			return err
+		}
+		right, err := es.newSetOperand(ctx.right)
+		if err != nil {
+			return err
+		}
+		us := NewUnionStatement(left, right)
+		if sr, ok := es.nodeCursor.payload.(*SelectRelation); ok {
+			us.Limit = sr.Limit
+		}
+		es.nodeCursor.payload = us
+		return nil
 	}
 	return ctx.queryPrimary
 }
+
+/*
+newSetOperand builds an independent relation for one side of a set operation
+*/
+func (es *ExecutableStatement) newSetOperand(term IMSTree) (Relation, error) {
+	node, err := NewExecutableStatement()
+	if err != nil {
+		return nil, err
+	}
+	node.parameters = es.parameters
+	node.payload = NewSelectRelation()
+	retval := walkQueryTree(node, term)
+	if err, ok := retval.(error); ok {
+		return nil, err
+	}
+	relation, ok := node.payload.(Relation)
+	if !ok {
+		return nil, fmt.Errorf("Unable to build set operation input")
+	}
+	return relation, nil
+}
 func (es *ExecutableStatement) VisitQueryPrimaryParse(ctx *QueryPrimaryParse) interface{} {
 	if ctx.querySpec == nil {
 		// TODO: Support TABLE, INLINE TABLE and SUBQUERY
@@ -294,6 +378,43 @@ func (es *ExecutableStatement) VisitQuerySpecificationParse(ctx *QuerySpecificat
 			return err
 		}
 	}
+
+	/*
+		Gather the GROUP BY columns, only plain column references are supported
+	*/
+	if ctx.groupBy != nil {
+		for _, item := range ctx.groupBy.(*GroupByParse).groupingElements {
+			cctx := item.(*GroupingElementParse)
+			if cctx.groupingExp == nil {
+				return fmt.Errorf("Unsupported option: ROLLUP, CUBE or GROUPING SETS")
+			}
+			for _, expr := range cctx.groupingExp.(*GroupingExpressionsParse).expressions {
+				switch value := es.nodeCursor.Visit(expr).(type) {
+				case *ColumnReference:
+					sr.GroupBy = append(sr.GroupBy, value.GetName())
+				case error:
+					return value
+				default:
+					return fmt.Errorf("Only column references are supported in GROUP BY")
+				}
+			}
+		}
+	}
+
+	/*
+		HAVING predicates are conforming static predicates evaluated against
+		the output column names (including aggregate outputs and aliases),
+		they are collected separately from the WHERE predicates
+	*/
+	if ctx.having != nil {
+		wherePredicates := sr.StaticPredicates
+		sr.StaticPredicates = NewStaticPredicateGroup()
+		i_err := es.nodeCursor.Visit(ctx.having) // BooleanExpression
+		sr.HavingPredicates, sr.StaticPredicates = sr.StaticPredicates, wherePredicates
+		if err, ok := i_err.(error); ok {
+			return err
+		}
+	}
 	return nil
 }
 func (es *ExecutableStatement) VisitExpressionParse(ctx *ExpressionParse) interface{} {
@@ -322,6 +443,16 @@ func (es *ExecutableStatement) VisitPrimaryExpressionParse(ctx *PrimaryExpressio
 	switch ctx.primaryType {
 	case NULL_LITERAL, STRING_LITERAL, BINARY_LITERAL, DECIMAL_LITERAL, INTEGER_LITERAL, BOOLEAN_LITERAL:
 		return NewLiteral(ctx.payload, ctx.primaryType)
+	case PARAMETER:
+		ordinal := ctx.payload.(int)
+		if ordinal >= len(es.nodeCursor.parameters) {
+			return fmt.Errorf("No value bound for parameter %d", ordinal+1)
+		}
+		literal, err := NewParameterLiteral(es.nodeCursor.parameters[ordinal])
+		if err != nil {
+			return err
+		}
+		return literal
 	case COLUMN_REFERENCE:
 		retval := es.nodeCursor.Visit(ctx.GetChild(0))
 		switch value := retval.(type) {
@@ -463,6 +594,8 @@ func (es *ExecutableStatement) VisitBooleanExpressionParse(ctx *BooleanExpressio
 				node = value // Continue to descend left
 			case *BooleanExpressionParse:
 				node = value // Continue to descend left
+			case *FunctionCallReference:
+				return fmt.Errorf("Function calls are not supported in predicates, use the output column name or an alias")
 			case error:
 				return value
 			case nil:
@@ -0,0 +1,150 @@
+package sqlparser
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+/*
+materializeGroups partitions the input rows by the GROUP BY columns and
+evaluates each function in the select list once per partition. The output
+has one row per group, in order of first appearance in the input. When
+Epoch is not one of the grouping columns, the Epoch of each output row is
+that of the first row in the group.
+*/
+func (sr *SelectRelation) materializeGroups(input *io.ColumnSeries) (*io.ColumnSeries, error) {
+	groupSet := make(map[string]bool, len(sr.GroupBy))
+	groupCols := make([]reflect.Value, len(sr.GroupBy))
+	for i, name := range sr.GroupBy {
+		col := input.GetByName(name)
+		if col == nil {
+			return nil, fmt.Errorf("GROUP BY column %s not found in source table", name)
+		}
+		groupSet[name] = true
+		groupCols[i] = reflect.ValueOf(col)
+	}
+
+	/*
+		Non aggregate members of the select list must be grouping columns
+	*/
+	for _, sl := range sr.SelectList {
+		if !sl.IsFunctionCall && !groupSet[sl.PrimaryName] {
+			return nil, fmt.Errorf("Column %s must appear in the GROUP BY clause or be used in an aggregate function",
+				sl.PrimaryName)
+		}
+	}
+
+	/*
+		Partition the row indexes by the values of the grouping columns
+	*/
+	var groupKeys []string
+	groups := make(map[string][]int)
+	var buffer bytes.Buffer
+	for i := 0; i < input.Len(); i++ {
+		buffer.Reset()
+		for _, col := range groupCols {
+			fmt.Fprintf(&buffer, "%v\x00", col.Index(i).Interface())
+		}
+		key := buffer.String()
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	if input.Len() != 0 && input.GetEpoch() == nil {
+		return nil, fmt.Errorf("GROUP BY requires an Epoch column in the input")
+	}
+	out := newGroupOutput()
+	epoch := reflect.ValueOf(input.GetEpoch())
+	for _, key := range groupKeys {
+		rows := groups[key]
+		first := rows[0]
+		out.append("Epoch", epoch.Index(first))
+
+		groupSeries := selectRows(input, rows)
+		for _, sl := range sr.SelectList {
+			if !sl.IsFunctionCall {
+				if sl.PrimaryName == "Epoch" {
+					continue
+				}
+				outname := sl.PrimaryName
+				if sl.IsAliased {
+					outname = sl.Alias
+				}
+				col := reflect.ValueOf(input.GetByName(sl.PrimaryName))
+				out.append(outname, col.Index(first))
+				continue
+			}
+			functionResult, err := runSelectFunction(sl, groupSeries)
+			if err != nil {
+				return nil, err
+			}
+			if functionResult.Len() != 1 {
+				return nil, fmt.Errorf("Function %s does not return a single row and can not be used with GROUP BY",
+					sl.FunctionCall.Name)
+			}
+			for _, name := range functionResult.GetColumnNames() {
+				if name == "Epoch" {
+					continue
+				}
+				outname := name
+				if sl.IsAliased {
+					outname = sl.Alias
+				}
+				out.append(outname, reflect.ValueOf(functionResult.GetColumn(name)).Index(0))
+			}
+		}
+	}
+	return out.columnSeries(), nil
+}
+
+/*
+groupOutput accumulates output rows one value at a time per column,
+retaining the column order and element types of the first group
+*/
+type groupOutput struct {
+	names   []string
+	columns map[string]reflect.Value
+}
+
+func newGroupOutput() *groupOutput {
+	return &groupOutput{columns: make(map[string]reflect.Value)}
+}
+
+func (g *groupOutput) append(name string, value reflect.Value) {
+	col, ok := g.columns[name]
+	if !ok {
+		g.names = append(g.names, name)
+		col = reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1)
+	}
+	g.columns[name] = reflect.Append(col, value)
+}
+
+func (g *groupOutput) columnSeries() *io.ColumnSeries {
+	cs := io.NewColumnSeries()
+	for _, name := range g.names {
+		cs.AddColumn(name, g.columns[name].Interface())
+	}
+	return cs
+}
+
+/*
+selectRows returns a new column series containing only the rows at the
+supplied indexes
+*/
+func selectRows(cs *io.ColumnSeries, rows []int) *io.ColumnSeries {
+	out := io.NewColumnSeries()
+	for _, name := range cs.GetColumnNames() {
+		col := reflect.ValueOf(cs.GetByName(name))
+		slc := reflect.MakeSlice(col.Type(), 0, len(rows))
+		for _, i := range rows {
+			slc = reflect.Append(slc, col.Index(i))
+		}
+		out.AddColumn(name, slc.Interface())
+	}
+	return out
+}
@@ -2,6 +2,8 @@ package sqlparser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	. "github.com/alpacahq/marketstore/sqlparser/parser"
 	. "github.com/antlr/antlr4/runtime/Go/antlr"
@@ -16,10 +18,20 @@ type AstBuilder struct {
 	numberOfRelations int
 
 	Mtree IMSTree // The query tree, built from the parse tree
+
+	NumParameters int // The number of values bound to the statement
+
+	// Zero based positions of the values bound to the placeholders in order
+	// of appearance, for the $n placeholders, nil for the '?' ones
+	ordinals []int
 }
 
 func NewAstBuilder(sourceString string) (ast *AstBuilder, err error) {
-	ast = &AstBuilder{statementSource: sourceString}
+	sourceString, ordinals, err := positionalParameters(sourceString)
+	if err != nil {
+		return nil, err
+	}
+	ast = &AstBuilder{statementSource: sourceString, ordinals: ordinals}
 
 	input := NewInputStream(ast.statementSource)
 	lexer := NewSQLBaseLexer(input)
@@ -50,9 +62,95 @@ func NewAstBuilder(sourceString string) (ast *AstBuilder, err error) {
 		fmt.Println(parseErr.err.Error())
 		return nil, parseErr.err
 	}
+	for _, token := range tokens.GetAllTokens() {
+		if token.GetTokenType() == SQLBaseParserT__3 {
+			ast.NumParameters++
+		}
+	}
+	if ordinals != nil {
+		if ast.NumParameters != len(ordinals) {
+			return nil, fmt.Errorf("Statement mixes '?' and $n parameters")
+		}
+		if ast.NumParameters, err = countOrdinals(ordinals); err != nil {
+			return nil, err
+		}
+	}
 	return ast, nil
 }
 
+/*
+positionalParameters replaces the $n placeholders of the statement, outside of
+its strings, quoted identifiers and comments, with '?' placeholders padded to
+the same length, and returns the zero based positions of the values bound to
+them in order of appearance, nil if it has none
+*/
+func positionalParameters(statement string) (source string, ordinals []int, err error) {
+	src := []byte(statement)
+	for i := 0; i < len(src); {
+		switch {
+		case src[i] == '\'' || src[i] == '"' || src[i] == '`':
+			// up to the closing quote, escaped by doubling it
+			quote := src[i]
+			for i++; i < len(src); i++ {
+				if src[i] == quote {
+					if i+1 < len(src) && src[i+1] == quote {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case strings.HasPrefix(statement[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(statement[i:], "/*"):
+			if end := strings.Index(statement[i+2:], "*/"); end < 0 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+		case src[i] == '$':
+			j := i + 1
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(statement[i+1 : j])
+			if err != nil || n < 1 {
+				return "", nil, fmt.Errorf("Invalid parameter %s, must be $1, $2...", statement[i:j])
+			}
+			ordinals = append(ordinals, n-1)
+			src[i] = '?'
+			for k := i + 1; k < j; k++ {
+				src[k] = ' '
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return string(src), ordinals, nil
+}
+
+// countOrdinals returns the number of values bound to the $n placeholders,
+// every one of $1 to $n being used
+func countOrdinals(ordinals []int) (count int, err error) {
+	used := map[int]bool{}
+	for _, ordinal := range ordinals {
+		used[ordinal] = true
+		if ordinal >= count {
+			count = ordinal + 1
+		}
+	}
+	for ordinal := 0; ordinal < count; ordinal++ {
+		if !used[ordinal] {
+			return 0, fmt.Errorf("Parameter $%d is not used in the statement", ordinal+1)
+		}
+	}
+	return count, nil
+}
+
 /*
 func print_tree(input Tree, lev int) {
 	for i := 0; i < lev; i++ {
@@ -0,0 +1,119 @@
+package sqlparser
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+NewPreparedExecutableStatement builds an executable statement from a parsed
+statement, binding the supplied values to its '?' placeholders in order of
+appearance, or to its $n placeholders by position, $1 being the first value.
+The parsed statement is not modified and can be bound again.
+*/
+func NewPreparedExecutableStatement(ast *AstBuilder, parameters ...interface{}) (es *ExecutableStatement, err error) {
+	if len(parameters) != ast.NumParameters {
+		return nil, fmt.Errorf("Statement has %d parameters, %d values supplied",
+			ast.NumParameters, len(parameters))
+	}
+	es = new(ExecutableStatement)
+	es.nodeCursor = es
+	es.parameters = parameters
+	if ast.ordinals != nil {
+		// the values of the '?' placeholders the $n ones were replaced by
+		es.parameters = make([]interface{}, len(ast.ordinals))
+		for i, ordinal := range ast.ordinals {
+			es.parameters[i] = parameters[ordinal]
+		}
+	}
+	i_err := es.Visit(ast.Mtree)
+	if err, ok := i_err.(error); ok {
+		return nil, err
+	}
+	return es, nil
+}
+
+/*
+NewParameterLiteral converts a bound parameter value into a literal. Values
+are never re-parsed as SQL text, strings are treated the same as a quoted
+string literal would be.
+*/
+func NewParameterLiteral(value interface{}) (li *Literal, err error) {
+	switch v := value.(type) {
+	case nil:
+		return NewLiteral(nil, NULL_LITERAL), nil
+	case string:
+		return NewLiteral("'"+v+"'", STRING_LITERAL), nil
+	case bool:
+		return NewLiteral(v, BOOLEAN_LITERAL), nil
+	case time.Time:
+		return NewLiteral(v.Unix(), INTEGER_LITERAL), nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewLiteral(rv.Int(), INTEGER_LITERAL), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return NewLiteral(int64(rv.Uint()), INTEGER_LITERAL), nil
+	case reflect.Float32, reflect.Float64:
+		return NewLiteral(rv.Float(), DECIMAL_LITERAL), nil
+	}
+	return nil, fmt.Errorf("Unsupported parameter type: %T", value)
+}
+
+/*
+StatementCache retains parsed statements by their text so that callers
+issuing the same statement with different parameters only parse it once.
+When full, the oldest statement is evicted.
+*/
+type StatementCache struct {
+	sync.Mutex
+	capacity   int
+	statements map[string]*AstBuilder
+	order      []string
+}
+
+func NewStatementCache(capacity int) (sc *StatementCache) {
+	sc = new(StatementCache)
+	sc.capacity = capacity
+	sc.statements = make(map[string]*AstBuilder, capacity)
+	return sc
+}
+
+/*
+Get returns the parsed form of the statement, parsing and caching it on
+first use
+*/
+func (sc *StatementCache) Get(statement string) (ast *AstBuilder, err error) {
+	sc.Lock()
+	ast, ok := sc.statements[statement]
+	sc.Unlock()
+	if ok {
+		return ast, nil
+	}
+
+	ast, err = NewAstBuilder(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.Lock()
+	defer sc.Unlock()
+	if _, ok := sc.statements[statement]; !ok {
+		if sc.capacity > 0 && len(sc.order) >= sc.capacity {
+			delete(sc.statements, sc.order[0])
+			sc.order = sc.order[1:]
+		}
+		sc.statements[statement] = ast
+		sc.order = append(sc.order, statement)
+	}
+	return ast, nil
+}
+
+func (sc *StatementCache) Len() int {
+	sc.Lock()
+	defer sc.Unlock()
+	return len(sc.statements)
+}
@@ -23,6 +23,8 @@ type SelectRelation struct {
 	WherePredicate         IMSTree // Runtime predicates
 	SetQuantifier          SetQuantifierEnum
 	StaticPredicates       StaticPredicateGroup
+	GroupBy                []string             // GROUP BY column names
+	HavingPredicates       StaticPredicateGroup // Evaluated against the output columns
 }
 
 func NewSelectRelation() (sr *SelectRelation) {
@@ -96,6 +98,9 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 	*/
 	var valid bool
 	var keepList, missing []string // List of all columns needed in the output result
+	if sr.IsSelectAll && len(sr.GroupBy) != 0 {
+		return nil, fmt.Errorf("Unsupported option: GROUP BY along with an asterisk for all")
+	}
 	if !sr.IsSelectAll {
 		/*
 			Set up a validator via a map of the primary data columns to the
@@ -131,6 +136,7 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 	} else {
 		q := planner.NewQuery(executor.ThisInstance.CatalogDir)
 		q.AddTargetKey(key)
+		q.SetResourceLimits(planner.DefaultResourceLimits())
 
 		/*
 			Search for time/Epoch predicates and push them down to the IO query
@@ -161,7 +167,10 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 		// TODO: push down range predicates on Epoch column
 		checkForPredicatesAndFunctions := func() bool {
 			// First check for predicates - we don't push these down (even though we can for Epoch predicates)
-			if len(sr.StaticPredicates) != 0 {
+			if len(sr.StaticPredicates) != 0 || len(sr.HavingPredicates) != 0 {
+				return true
+			}
+			if len(sr.GroupBy) != 0 {
 				return true
 			}
 			// Check for functions on the relation
@@ -204,201 +213,7 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 		/*
 			Evaluate all predicates on final results set
 		*/
-		totalLength := outputColumnSeries.Len()
-		removalBitmap := make([]bool, totalLength, totalLength) // true means we ditch the value, default is keep
-		for _, name := range outputColumnSeries.GetColumnNames() {
-			if sp, ok := sr.StaticPredicates[name]; ok {
-				i_col := outputColumnSeries.GetColumn(name)
-				switch col := i_col.(type) {
-				case []float32:
-					if sp.ContentsEnum.IsSet(EQUALITY) {
-						eqval, _ := io.GetValueAsFloat64(sp.equal)
-						for i, val := range col {
-							if val != float32(eqval) {
-								removalBitmap[i] = true // remove
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MINBOUND) {
-						minval, _ := io.GetValueAsFloat64(sp.min)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
-								if val < float32(minval) {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val <= float32(minval) {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MAXBOUND) {
-						maxval, _ := io.GetValueAsFloat64(sp.max)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
-								if val > float32(maxval) {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val >= float32(maxval) {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-				case []float64:
-					if sp.ContentsEnum.IsSet(EQUALITY) {
-						eqval, _ := io.GetValueAsFloat64(sp.equal)
-						for i, val := range col {
-							if val != eqval {
-								removalBitmap[i] = true // remove
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MINBOUND) {
-						minval, _ := io.GetValueAsFloat64(sp.min)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
-								if val < minval {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val <= minval {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MAXBOUND) {
-						maxval, _ := io.GetValueAsFloat64(sp.max)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
-								if val > maxval {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val >= maxval {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-				case []int:
-					if sp.ContentsEnum.IsSet(EQUALITY) {
-						eqval, _ := io.GetValueAsInt64(sp.equal)
-						for i, val := range col {
-							if val != int(eqval) {
-								removalBitmap[i] = true // remove
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MINBOUND) {
-						minval, _ := io.GetValueAsInt64(sp.min)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
-								if val < int(minval) {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val <= int(minval) {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MAXBOUND) {
-						maxval, _ := io.GetValueAsInt64(sp.max)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
-								if val > int(maxval) {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val >= int(maxval) {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-				case []int32:
-					if sp.ContentsEnum.IsSet(EQUALITY) {
-						eqval, _ := io.GetValueAsInt64(sp.equal)
-						for i, val := range col {
-							if val != int32(eqval) {
-								removalBitmap[i] = true // remove
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MINBOUND) {
-						minval, _ := io.GetValueAsInt64(sp.min)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
-								if val < int32(minval) {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val <= int32(minval) {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MAXBOUND) {
-						maxval, _ := io.GetValueAsInt64(sp.max)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
-								if val > int32(maxval) {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val >= int32(maxval) {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-				case []int64:
-					if sp.ContentsEnum.IsSet(EQUALITY) {
-						eqval, _ := io.GetValueAsInt64(sp.equal)
-						for i, val := range col {
-							if val != eqval {
-								removalBitmap[i] = true // remove
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MINBOUND) {
-						minval, _ := io.GetValueAsInt64(sp.min)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
-								if val < minval {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val <= minval {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-					if sp.ContentsEnum.IsSet(MAXBOUND) {
-						maxval, _ := io.GetValueAsInt64(sp.max)
-						for i, val := range col {
-							if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
-								if val > maxval {
-									removalBitmap[i] = true // remove
-								}
-							} else {
-								if val >= maxval {
-									removalBitmap[i] = true // remove
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-		outputColumnSeries.RestrictViaBitmap(removalBitmap)
+		applyStaticPredicates(outputColumnSeries, sr.StaticPredicates)
 	}
 
 	/*
@@ -406,7 +221,13 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 	*/
 	var selectListOutput *io.ColumnSeries
 	var skipProjection bool // TODO: Only skip for SRF
-	if !sr.IsSelectAll {
+	if len(sr.GroupBy) != 0 {
+		outputColumnSeries, err = sr.materializeGroups(outputColumnSeries)
+		if err != nil {
+			return nil, err
+		}
+		skipProjection = true
+	} else if !sr.IsSelectAll {
 		for _, sl := range sr.SelectList {
 			if sl.IsFunctionCall {
 				if selectListOutput == nil {
@@ -414,70 +235,10 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 				}
 				// TODO: This only handles SRF
 				skipProjection = true
-				aggName := sl.FunctionCall.Name
-				agg := AggRegistry[strings.ToLower(aggName)]
-				if agg == nil {
-					return nil, fmt.Errorf("No function in the UDA Registry named \"%s\"", aggName)
-				}
-				aggfunc, argMap := agg.New()
-
-				if sl.FunctionCall.IsAsterisk {
-					/*
-						If an asterisk is provided, use Epoch as the mapped input column
-					*/
-					argMap.MapRequiredColumn("*", io.DataShape{
-						Name: "Epoch", Type: io.INT64,
-					})
-				} else {
-					idList := sl.FunctionCall.GetIDs()
-					err = argMap.PrepareArguments(idList)
-					if err != nil {
-						return nil, fmt.Errorf("Argument mapping error for %s: %s", aggName, err.Error())
-					}
-				}
-
-				/*
-					Initialize the Aggregate
-						An agg may have init parameters, which are used only to initialize it
-						These are single value literals (like '1Min')
-				*/
-				requiredInitDSV := aggfunc.GetInitArgs()
-				requiredInitNames := io.GetNamesFromDSV(requiredInitDSV)
-
-				initList := sl.FunctionCall.GetLiterals()
-				if len(requiredInitNames) > len(initList) {
-					return nil, fmt.Errorf(
-						"Not enough init arguments for %s, need %d have %d",
-						aggName,
-						len(requiredInitNames),
-						len(initList),
-					)
-				}
-				// TODO: Handle different argument types from string
-				var initArgList []string
-				for _, lit := range initList {
-					value := lit.Value.(string)
-					value = value[1 : len(value)-1] // Strip the quotes
-					initArgList = append(
-						initArgList,
-						value,
-					)
-				}
-				aggfunc.Init(initArgList)
-
-				/*
-					Execute the aggregate function
-				*/
-				err := aggfunc.Accum(outputColumnSeries)
+				functionResult, err := runSelectFunction(sl, outputColumnSeries)
 				if err != nil {
 					return nil, err
 				}
-				functionResult := aggfunc.Output()
-				if functionResult == nil {
-					return nil, fmt.Errorf(
-						"No result from aggregate %s",
-						aggName)
-				}
 
 				for _, name := range functionResult.GetColumnNames() {
 					outname := name
@@ -532,6 +293,18 @@ func (sr *SelectRelation) Materialize() (outputColumnSeries *io.ColumnSeries, er
 		}
 	}
 
+	/*
+		Evaluate HAVING predicates against the output columns
+	*/
+	if len(sr.HavingPredicates) != 0 {
+		for name := range sr.HavingPredicates {
+			if !outputColumnSeries.Exists(name) {
+				return nil, fmt.Errorf("HAVING column %s not found in the query output", name)
+			}
+		}
+		applyStaticPredicates(outputColumnSeries, sr.HavingPredicates)
+	}
+
 	/*
 		Enforce LIMIT on the final results
 	*/
@@ -861,3 +634,277 @@ func SourceValidator(sourceDSV []io.DataShape, selectList []*AliasedIdentifier)
 /*
 Utility functions
 */
+
+/*
+runSelectFunction executes the aggregate named by a select list function call
+over the input column series and returns the aggregate's output
+*/
+func runSelectFunction(sl *AliasedIdentifier, input *io.ColumnSeries) (*io.ColumnSeries, error) {
+	aggName := sl.FunctionCall.Name
+	agg := AggRegistry[strings.ToLower(aggName)]
+	if agg == nil {
+		return nil, fmt.Errorf("No function in the UDA Registry named \"%s\"", aggName)
+	}
+	aggfunc, argMap := agg.New()
+
+	if sl.FunctionCall.IsAsterisk {
+		/*
+			If an asterisk is provided, use Epoch as the mapped input column
+		*/
+		argMap.MapRequiredColumn("*", io.DataShape{
+			Name: "Epoch", Type: io.INT64,
+		})
+	} else {
+		idList := sl.FunctionCall.GetIDs()
+		err := argMap.PrepareArguments(idList)
+		if err != nil {
+			return nil, fmt.Errorf("Argument mapping error for %s: %s", aggName, err.Error())
+		}
+	}
+
+	/*
+		Initialize the Aggregate
+			An agg may have init parameters, which are used only to initialize it
+			These are single value literals (like '1Min')
+	*/
+	requiredInitDSV := aggfunc.GetInitArgs()
+	requiredInitNames := io.GetNamesFromDSV(requiredInitDSV)
+
+	initList := sl.FunctionCall.GetLiterals()
+	if len(requiredInitNames) > len(initList) {
+		return nil, fmt.Errorf(
+			"Not enough init arguments for %s, need %d have %d",
+			aggName,
+			len(requiredInitNames),
+			len(initList),
+		)
+	}
+	// TODO: Handle different argument types from string
+	var initArgList []string
+	for _, lit := range initList {
+		value := lit.Value.(string)
+		value = value[1 : len(value)-1] // Strip the quotes
+		initArgList = append(
+			initArgList,
+			value,
+		)
+	}
+	aggfunc.Init(initArgList)
+
+	/*
+		Execute the aggregate function
+	*/
+	err := aggfunc.Accum(input)
+	if err != nil {
+		return nil, err
+	}
+	functionResult := aggfunc.Output()
+	if functionResult == nil {
+		return nil, fmt.Errorf(
+			"No result from aggregate %s",
+			aggName)
+	}
+	return functionResult, nil
+}
+
+/*
+applyStaticPredicates removes all rows of the column series that do not
+satisfy the static predicates for the columns present in the series
+*/
+func applyStaticPredicates(cs *io.ColumnSeries, spg StaticPredicateGroup) {
+	totalLength := cs.Len()
+	removalBitmap := make([]bool, totalLength, totalLength) // true means we ditch the value, default is keep
+	for _, name := range cs.GetColumnNames() {
+		if sp, ok := spg[name]; ok {
+			i_col := cs.GetColumn(name)
+			switch col := i_col.(type) {
+			case []float32:
+				if sp.ContentsEnum.IsSet(EQUALITY) {
+					eqval, _ := io.GetValueAsFloat64(sp.equal)
+					for i, val := range col {
+						if val != float32(eqval) {
+							removalBitmap[i] = true // remove
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MINBOUND) {
+					minval, _ := io.GetValueAsFloat64(sp.min)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
+							if val < float32(minval) {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val <= float32(minval) {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MAXBOUND) {
+					maxval, _ := io.GetValueAsFloat64(sp.max)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
+							if val > float32(maxval) {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val >= float32(maxval) {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+			case []float64:
+				if sp.ContentsEnum.IsSet(EQUALITY) {
+					eqval, _ := io.GetValueAsFloat64(sp.equal)
+					for i, val := range col {
+						if val != eqval {
+							removalBitmap[i] = true // remove
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MINBOUND) {
+					minval, _ := io.GetValueAsFloat64(sp.min)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
+							if val < minval {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val <= minval {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MAXBOUND) {
+					maxval, _ := io.GetValueAsFloat64(sp.max)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
+							if val > maxval {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val >= maxval {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+			case []int:
+				if sp.ContentsEnum.IsSet(EQUALITY) {
+					eqval, _ := io.GetValueAsInt64(sp.equal)
+					for i, val := range col {
+						if val != int(eqval) {
+							removalBitmap[i] = true // remove
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MINBOUND) {
+					minval, _ := io.GetValueAsInt64(sp.min)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
+							if val < int(minval) {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val <= int(minval) {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MAXBOUND) {
+					maxval, _ := io.GetValueAsInt64(sp.max)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
+							if val > int(maxval) {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val >= int(maxval) {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+			case []int32:
+				if sp.ContentsEnum.IsSet(EQUALITY) {
+					eqval, _ := io.GetValueAsInt64(sp.equal)
+					for i, val := range col {
+						if val != int32(eqval) {
+							removalBitmap[i] = true // remove
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MINBOUND) {
+					minval, _ := io.GetValueAsInt64(sp.min)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
+							if val < int32(minval) {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val <= int32(minval) {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MAXBOUND) {
+					maxval, _ := io.GetValueAsInt64(sp.max)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
+							if val > int32(maxval) {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val >= int32(maxval) {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+			case []int64:
+				if sp.ContentsEnum.IsSet(EQUALITY) {
+					eqval, _ := io.GetValueAsInt64(sp.equal)
+					for i, val := range col {
+						if val != eqval {
+							removalBitmap[i] = true // remove
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MINBOUND) {
+					minval, _ := io.GetValueAsInt64(sp.min)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMIN) {
+							if val < minval {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val <= minval {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+				if sp.ContentsEnum.IsSet(MAXBOUND) {
+					maxval, _ := io.GetValueAsInt64(sp.max)
+					for i, val := range col {
+						if sp.ContentsEnum.IsSet(INCLUSIVEMAX) {
+							if val > maxval {
+								removalBitmap[i] = true // remove
+							}
+						} else {
+							if val >= maxval {
+								removalBitmap[i] = true // remove
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	cs.RestrictViaBitmap(removalBitmap)
+}
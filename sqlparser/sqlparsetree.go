@@ -670,9 +670,8 @@ type GroupingElementParse struct {
 }
 
 func NewGroupingElementParse(node antlr.Tree) (term *GroupingElementParse) {
-	ictx := node.GetChild(0)
 	term = new(GroupingElementParse)
-	switch ctx := ictx.(type) {
+	switch ctx := node.(type) {
 	case *parser.SingleGroupingSetContext:
 		term.groupingExp = NewGroupingExpressionsParse(ctx.GroupingExpressions())
 	case *parser.RollupContext:
@@ -1409,6 +1408,7 @@ func NewPrimaryExpressionParse(node antlr.Tree) (term *PrimaryExpressionParse) {
 		term.primaryType = NULL_LITERAL
 	case *parser.ParameterContext:
 		term.primaryType = PARAMETER
+		term.payload = parameterOrdinal(ctx)
 	case *parser.StringLiteralContext:
 		term.primaryType = STRING_LITERAL
 		term.payload = ctx.STRING().GetText()
@@ -1510,6 +1510,20 @@ func (sp *PrimaryExpressionParse) String(level int) (out []string) {
 	return append(out, PrependLevel(GetStructString(sp), level))
 }
 
+/*
+parameterOrdinal returns the zero based position of a '?' placeholder among
+all of the placeholders in the statement text
+*/
+func parameterOrdinal(ctx *parser.ParameterContext) (ordinal int) {
+	stream := ctx.GetParser().GetTokenStream()
+	for i := 0; i < ctx.GetStart().GetTokenIndex(); i++ {
+		if stream.Get(i).GetTokenType() == parser.SQLBaseParserT__3 {
+			ordinal++
+		}
+	}
+	return ordinal
+}
+
 type FunctionCallParse struct {
 	MSTree
 	hasAsterisk, hasFilter, hasSetQuantifier bool
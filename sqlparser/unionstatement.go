@@ -0,0 +1,69 @@
+package sqlparser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/alpacahq/marketstore/utils/io"
+)
+
+type UnionStatement struct {
+	ExecutableStatement
+	Left, Right Relation
+	Limit       int
+}
+
+func NewUnionStatement(left, right Relation) (us *UnionStatement) {
+	us = new(UnionStatement)
+	us.Left = left
+	us.Right = right
+	return us
+}
+
+func (us *UnionStatement) Materialize() (outputColumnSeries *io.ColumnSeries, err error) {
+	/*
+		UNION ALL - both sides are materialized independently and the
+		right results are appended to the left, duplicates are retained
+	*/
+	left, err := us.Left.Materialize()
+	if err != nil {
+		return nil, err
+	}
+	right, err := us.Right.Materialize()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case left == nil || left.GetNumColumns() == 0:
+		outputColumnSeries = right
+	case right == nil || right.GetNumColumns() == 0:
+		outputColumnSeries = left
+	default:
+		outputColumnSeries, err = io.ColumnSeriesConcat(left, right)
+		if err != nil {
+			return nil, fmt.Errorf("UNION ALL requires matching columns on both sides: %s", err.Error())
+		}
+	}
+	if outputColumnSeries == nil {
+		return io.NewColumnSeries(), nil
+	}
+
+	/*
+		Enforce LIMIT on the final results
+	*/
+	if us.Limit != 0 {
+		outputColumnSeries.RestrictLength(us.Limit, io.FIRST)
+	}
+
+	return outputColumnSeries, nil
+}
+
+func (us *UnionStatement) Explain() string {
+	if us != nil {
+		jsonStruct, _ := json.Marshal(*us)
+		return string(jsonStruct)
+	} else {
+		return "{}"
+	}
+}
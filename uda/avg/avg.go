@@ -48,7 +48,7 @@ func (av *Avg) Accum(cols io.ColumnInterface) error {
 	}
 	inputColDSV := av.ArgMap.GetMappedColumns(requiredColumns[0].Name)
 	inputColName := inputColDSV[0].Name
-	inputCol, err := uda.ColumnToFloat32(cols, inputColName)
+	inputCol, err := uda.PresentFloat32(cols, inputColName)
 	if err != nil {
 		fmt.Println("COLS: ", cols)
 		return err
@@ -93,6 +93,10 @@ func (av *Avg) Output() *io.ColumnSeries {
 	cs := io.NewColumnSeries()
 	cs.AddColumn("Epoch", []int64{time.Now().UTC().Unix()})
 	cs.AddColumn("Avg", []float64{av.Avg / float64(av.Count)})
+	if av.Count == 0 {
+		// all the values are missing
+		cs.SetValidity("Avg", []bool{false})
+	}
 	return cs
 }
 
@@ -48,10 +48,13 @@ func (ma *Max) Accum(cols io.ColumnInterface) error {
 	}
 	inputColDSV := ma.ArgMap.GetMappedColumns(requiredColumns[0].Name)
 	inputColName := inputColDSV[0].Name
-	inputCol, err := uda.ColumnToFloat32(cols, inputColName)
+	inputCol, err := uda.PresentFloat32(cols, inputColName)
 	if err != nil {
 		return err
 	}
+	if len(inputCol) == 0 {
+		return nil
+	}
 
 	if !ma.IsInitialized {
 		ma.Max = inputCol[0]
@@ -97,6 +100,10 @@ func (ma *Max) Output() *io.ColumnSeries {
 	cs := io.NewColumnSeries()
 	cs.AddColumn("Epoch", []int64{time.Now().UTC().Unix()})
 	cs.AddColumn("Max", []float32{ma.Max})
+	if !ma.IsInitialized {
+		// all the values are missing
+		cs.SetValidity("Max", []bool{false})
+	}
 	return cs
 }
 
@@ -48,10 +48,13 @@ func (mn *Min) Accum(cols io.ColumnInterface) error {
 	}
 	inputColDSV := mn.ArgMap.GetMappedColumns(requiredColumns[0].Name)
 	inputColName := inputColDSV[0].Name
-	inputCol, err := uda.ColumnToFloat32(cols, inputColName)
+	inputCol, err := uda.PresentFloat32(cols, inputColName)
 	if err != nil {
 		return err
 	}
+	if len(inputCol) == 0 {
+		return nil
+	}
 
 	if !mn.IsInitialized {
 		mn.Min = inputCol[0]
@@ -97,6 +100,10 @@ func (mn *Min) Output() *io.ColumnSeries {
 	cs := io.NewColumnSeries()
 	cs.AddColumn("Epoch", []int64{time.Now().UTC().Unix()})
 	cs.AddColumn("Min", []float32{mn.Min})
+	if !mn.IsInitialized {
+		// all the values are missing
+		cs.SetValidity("Min", []bool{false})
+	}
 	return cs
 }
 
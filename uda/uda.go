@@ -25,6 +25,13 @@ func ColumnToFloat32(cols io.ColumnInterface, name string) (outCol []float32, er
 			outCol[i] = float32(cc[i])
 		}
 	case []int64:
+		if scale, ok := decimalScale(cols, name); ok {
+			outCol = make([]float32, len(cc))
+			for i, f := range io.DecimalsToFloats(cc, scale) {
+				outCol[i] = float32(f)
+			}
+			break
+		}
 		outCol = make([]float32, len(cc))
 		for i := range cc {
 			outCol[i] = float32(cc[i])
@@ -38,6 +45,15 @@ func ColumnToFloat32(cols io.ColumnInterface, name string) (outCol []float32, er
 	return outCol, nil
 }
 
+// decimalScale returns the scale of the column if it is a DECIMAL column,
+// whose values are converted to the floats they stand for
+func decimalScale(cols io.ColumnInterface, name string) (int, bool) {
+	if cs, ok := cols.(*io.ColumnSeries); ok {
+		return cs.GetScale(name)
+	}
+	return 0, false
+}
+
 func ColumnToFloat64(cols io.ColumnInterface, name string) (outCol []float64, err error) {
 	ccol := cols.GetColumn(name)
 	if ccol == nil {
@@ -57,6 +73,10 @@ func ColumnToFloat64(cols io.ColumnInterface, name string) (outCol []float64, er
 			outCol[i] = float64(cc[i])
 		}
 	case []int64:
+		if scale, ok := decimalScale(cols, name); ok {
+			outCol = io.DecimalsToFloats(cc, scale)
+			break
+		}
 		outCol = make([]float64, len(cc))
 		for i := range cc {
 			outCol[i] = float64(cc[i])
@@ -69,3 +89,23 @@ func ColumnToFloat64(cols io.ColumnInterface, name string) (outCol []float64, er
 	}
 	return outCol, nil
 }
+
+// PresentFloat32 returns the values of the column converted to float32 but
+// the missing ones of a column series
+func PresentFloat32(cols io.ColumnInterface, name string) (outCol []float32, err error) {
+	col, err := ColumnToFloat32(cols, name)
+	if err != nil {
+		return nil, err
+	}
+	cs, ok := cols.(*io.ColumnSeries)
+	if !ok || cs.GetValidity(name) == nil {
+		return col, nil
+	}
+	outCol = make([]float32, 0, len(col))
+	for i, value := range col {
+		if cs.IsValid(name, i) {
+			outCol = append(outCol, value)
+		}
+	}
+	return outCol, nil
+}
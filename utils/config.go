@@ -3,11 +3,14 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/alpacahq/marketstore/contrib/calendar"
 	"github.com/alpacahq/marketstore/utils/log"
+	"github.com/gobwas/glob"
 	"gopkg.in/yaml.v2"
 )
 
@@ -18,24 +21,202 @@ func init() {
 }
 
 type TriggerSetting struct {
+	// Name of the trigger in the After of the others, its module if omitted
+	Name   string
 	Module string
 	On     string
-	Config map[string]interface{}
+	// Names of the triggers to fire before this one on the same writes
+	After []string
+	// Retries of a failed execution, RetryDelay after it and doubling
+	Retries    int
+	RetryDelay time.Duration
+	// Consecutive failed executions after which the trigger is not fired
+	// for BreakerCooldown, never if zero
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	Config           map[string]interface{}
 }
 
 type BgWorkerSetting struct {
 	Module string
 	Name   string
 	Config map[string]interface{}
+	// Restart policy after the worker returns or panics: no, on-failure
+	// for the panics alone, or always, the first restart RestartDelay
+	// after it, each following one after twice the delay of the previous
+	// up to RestartMaxDelay, and at most MaxRestarts in a row if positive
+	Restart         string
+	RestartDelay    time.Duration
+	RestartMaxDelay time.Duration
+	MaxRestarts     int
+}
+
+type APIKeySetting struct {
+	Name       string                 `yaml:"name"`
+	Key        string                 `yaml:"key"`
+	Permission string                 `yaml:"permission"`
+	Buckets    []*BucketAccessSetting `yaml:"buckets"`
+	// Namespace confines the key to the buckets of the namespace
+	Namespace string `yaml:"namespace"`
+}
+
+// NamespaceSeparator separates the name of a namespace from the symbols of
+// its buckets, e.g. "alpha.AAPL" of the namespace alpha
+const NamespaceSeparator = "."
+
+// NamespaceSetting isolates the buckets whose symbol is prefixed by Name and
+// the NamespaceSeparator, for the keys of the namespace not to see the
+// others, limited to MaxBuckets buckets and MaxDiskBytes of data files, 0
+// for no limit
+type NamespaceSetting struct {
+	Name         string `yaml:"name"`
+	MaxBuckets   int    `yaml:"max_buckets"`
+	MaxDiskBytes int64  `yaml:"max_disk_bytes"`
+}
+
+// Prefix returns the prefix of the symbols of the namespace
+func (ns *NamespaceSetting) Prefix() string {
+	return ns.Name + NamespaceSeparator
+}
+
+// BucketAccessSetting grants a permission on the buckets whose item key
+// matches the pattern, e.g. "*/1Min/OHLCV"
+type BucketAccessSetting struct {
+	Pattern    string `yaml:"pattern"`
+	Permission string `yaml:"permission"`
+}
+
+// BucketTimezoneSetting overrides the timezone of the instance for the
+// buckets whose item key matches the pattern, e.g. "*.T/*/*"
+type BucketTimezoneSetting struct {
+	Pattern  string `yaml:"pattern"`
+	Timezone string `yaml:"timezone"`
+	location *time.Location
+}
+
+// AuditLogSetting selects the sinks of the audit log of mutating
+// operations, a file with one JSON record per line and/or syslog
+type AuditLogSetting struct {
+	File   string `yaml:"file"`
+	Syslog bool   `yaml:"syslog"`
+}
+
+// LogFileSetting writes the server log to a file instead of the standard
+// output, rotated once it exceeds MaxSize bytes or every RotateInterval, and
+// removing the rotated files beyond the MaxBackups most recent ones or older
+// than MaxAge.  Zero disables a limit.
+type LogFileSetting struct {
+	Path           string        `yaml:"path"`
+	MaxSize        int64         `yaml:"max_size"`
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	MaxBackups     int           `yaml:"max_backups"`
+	MaxAge         time.Duration `yaml:"max_age"`
+}
+
+// FeedHealthSetting watches the live feeds, alerting on the buckets of a
+// feed not written to for its MaxAge during the sessions of its market
+// calendar, every CheckInterval.  The alerts are logged, counted in the
+// metrics and POSTed to the Webhooks.
+type FeedHealthSetting struct {
+	CheckInterval time.Duration  `yaml:"check_interval"`
+	Webhooks      []string       `yaml:"webhooks"`
+	Feeds         []*FeedSetting `yaml:"feeds"`
+}
+
+// FeedSetting is a live feed, writing to the buckets matching Pattern, e.g.
+// */1Min/OHLCV, at least every MaxAge while the market of Calendar is open,
+// or all the time without a calendar
+type FeedSetting struct {
+	Name     string        `yaml:"name"`
+	Pattern  string        `yaml:"pattern"`
+	MaxAge   time.Duration `yaml:"max_age"`
+	Calendar string        `yaml:"calendar"`
+}
+
+// QualitySetting analyzes the quality of the buckets matching the patterns
+// of the Checks every Interval, each run analyzing the interval before it
+// from a multiple of Interval since the Unix epoch
+type QualitySetting struct {
+	Interval time.Duration          `yaml:"interval"`
+	Checks   []*QualityCheckSetting `yaml:"checks"`
+}
+
+// QualityCheckSetting are the rules the buckets matching Pattern, e.g.
+// */1Min/OHLCV, are checked against: their gaps of MaxGap or longer, their
+// timeframe by default, within the market hours of Calendar, or all the
+// time without one, and the relative changes of their prices beyond
+// MaxJump, 0 for no limit
+type QualityCheckSetting struct {
+	Pattern  string        `yaml:"pattern"`
+	Calendar string        `yaml:"calendar"`
+	MaxGap   time.Duration `yaml:"max_gap"`
+	MaxJump  float64       `yaml:"max_jump"`
+}
+
+// ReplaySetting replays the stored rows of the buckets matching Streams, of
+// the symbols matching Symbols, from Start until End over the stream
+// endpoints as if they were live, Speed times as fast as they were recorded
+type ReplaySetting struct {
+	Start   time.Time `yaml:"start"`
+	End     time.Time `yaml:"end"`
+	Speed   float64   `yaml:"speed"`
+	Symbols []string  `yaml:"symbols"`
+	Streams []string  `yaml:"streams"`
+}
+
+// TLSSetting enables TLS on a listener. Setting a client CA file
+// additionally requires clients to present a certificate it signed.
+type TLSSetting struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// ShardSetting is an instance of a symbol partitioned cluster, which alone
+// writes the symbols matching its patterns, e.g. "A*", and is queried at its
+// URL, with the API key if the instance requires one
+type ShardSetting struct {
+	Name    string   `yaml:"name"`
+	URL     string   `yaml:"url"`
+	APIKey  string   `yaml:"api_key"`
+	Symbols []string `yaml:"symbols"`
+}
+
+// RemoteSetting is a remote instance holding the buckets matching its
+// patterns, e.g. "*/*/CRYPTO", queried at its URL, with the API key if the
+// instance requires one, for the queries of this instance to federate them
+type RemoteSetting struct {
+	Name    string   `yaml:"name"`
+	URL     string   `yaml:"url"`
+	APIKey  string   `yaml:"api_key"`
+	Buckets []string `yaml:"buckets"`
+	globs   []glob.Glob
+}
+
+// Holds returns whether the remote holds the bucket with the item key
+func (rs *RemoteSetting) Holds(itemKey string) bool {
+	for _, g := range rs.globs {
+		if g.Match(itemKey) {
+			return true
+		}
+	}
+	return false
 }
 
 type MktsConfig struct {
 	RootDirectory              string
 	ListenURL                  string
+	ListenTLS                  *TLSSetting
 	UtilitiesURL               string
+	UtilitiesTLS               *TLSSetting
+	PGWireURL                  string
+	Diagnostics                bool
 	Timezone                   *time.Location
 	Queryable                  bool
+	LogFile                    *LogFileSetting
 	StopGracePeriod            time.Duration
+	ShutdownTimeout            time.Duration
+	StartupProbeDelay          time.Duration
 	WALRotateInterval          int
 	EnableAdd                  bool
 	EnableRemove               bool
@@ -46,7 +227,32 @@ type MktsConfig struct {
 	BackgroundSync             bool
 	WALBypass                  bool
 	ClusterMode                bool
+	QueryMaxRowsScanned        int64
+	QueryMaxBytesRead          int64
+	QueryMaxMemory             int64
+	MemoryLimit                int64
+	ClientRateLimit            float64
+	ClientRateBurst            int
+	ClientMaxQueries           int
+	FrontendWorkers            int
+	FrontendQueueDepth         int
+	MinFreeDiskSpace           int64
+	ReadOnlyFreeDiskSpace      int64
+	Deduplicate                []string
+	deduplicate                []glob.Glob // compiled Deduplicate, see SetDeduplicate
+	BucketTimezones            []*BucketTimezoneSetting
+	Calendars                  map[string]string
+	FeedHealth                 *FeedHealthSetting
+	Replay                     *ReplaySetting
+	Quality                    *QualitySetting
+	Namespaces                 []*NamespaceSetting
+	APIKeys                    []*APIKeySetting
+	AuditLog                   *AuditLogSetting
+	ShardName                  string // this instance among the Shards
+	Shards                     []*ShardSetting
+	Remotes                    []*RemoteSetting
 	StartTime                  time.Time
+	PluginPaths                []string
 	Triggers                   []*TriggerSetting
 	BgWorkers                  []*BgWorkerSetting
 }
@@ -55,37 +261,65 @@ func (m *MktsConfig) Parse(data []byte) error {
 	var (
 		err error
 		aux struct {
-			RootDirectory              string `yaml:"root_directory"`
-			ListenHost                 string `yaml:"listen_host"`
-			ListenPort                 string `yaml:"listen_port"`
-			UtilitiesURL               string `yaml:"utilities_url"`
-			Timezone                   string `yaml:"timezone"`
-			LogLevel                   string `yaml:"log_level"`
-			Queryable                  string `yaml:"queryable"`
-			StopGracePeriod            int    `yaml:"stop_grace_period"`
-			WALRotateInterval          int    `yaml:"wal_rotate_interval"`
-			EnableAdd                  string `yaml:"enable_add"`
-			EnableRemove               string `yaml:"enable_remove"`
-			EnableLastKnown            string `yaml:"enable_last_known"`
-			DisableVariableCompression string `yaml:"disable_variable_compression"`
-			InitCatalog                string `yaml:"init_catalog"`
-			InitWALCache               string `yaml:"init_wal_cache"`
-			BackgroundSync             string `yaml:"background_sync"`
-			WALBypass                  string `yaml:"wal_bypass"`
-			ClusterMode                string `yaml:"cluster_mode"`
-			Triggers                   []struct {
-				Module string                 `yaml:"module"`
-				On     string                 `yaml:"on"`
-				Config map[string]interface{} `yaml:"config"`
-			} `yaml:"triggers"`
-			BgWorkers []struct {
-				Module string                 `yaml:"module"`
-				Name   string                 `yaml:"name"`
-				Config map[string]interface{} `yaml:"config"`
-			} `yaml:"bgworkers"`
+			RootDirectory              string                   `yaml:"root_directory"`
+			ListenHost                 string                   `yaml:"listen_host"`
+			ListenPort                 string                   `yaml:"listen_port"`
+			ListenTLS                  *TLSSetting              `yaml:"listen_tls"`
+			UtilitiesURL               string                   `yaml:"utilities_url"`
+			UtilitiesTLS               *TLSSetting              `yaml:"utilities_tls"`
+			PGWireURL                  string                   `yaml:"pgwire_url"`
+			Diagnostics                bool                     `yaml:"diagnostics"`
+			Timezone                   string                   `yaml:"timezone"`
+			LogLevel                   string                   `yaml:"log_level"`
+			LogFormat                  string                   `yaml:"log_format"`
+			LogLevels                  map[string]string        `yaml:"log_levels"`
+			LogFile                    *LogFileSetting          `yaml:"log_file"`
+			Queryable                  string                   `yaml:"queryable"`
+			StopGracePeriod            int                      `yaml:"stop_grace_period"`
+			ShutdownTimeout            int                      `yaml:"shutdown_timeout"`
+			StartupProbeDelay          int                      `yaml:"startup_probe_delay"`
+			WALRotateInterval          int                      `yaml:"wal_rotate_interval"`
+			EnableAdd                  string                   `yaml:"enable_add"`
+			EnableRemove               string                   `yaml:"enable_remove"`
+			EnableLastKnown            string                   `yaml:"enable_last_known"`
+			DisableVariableCompression string                   `yaml:"disable_variable_compression"`
+			InitCatalog                string                   `yaml:"init_catalog"`
+			InitWALCache               string                   `yaml:"init_wal_cache"`
+			BackgroundSync             string                   `yaml:"background_sync"`
+			WALBypass                  string                   `yaml:"wal_bypass"`
+			ClusterMode                string                   `yaml:"cluster_mode"`
+			QueryMaxRowsScanned        int64                    `yaml:"query_max_rows_scanned"`
+			QueryMaxBytesRead          int64                    `yaml:"query_max_bytes_read"`
+			QueryMaxMemory             int64                    `yaml:"query_max_memory"`
+			MemoryLimit                int64                    `yaml:"memory_limit"`
+			ClientRateLimit            float64                  `yaml:"client_rate_limit"`
+			ClientRateBurst            int                      `yaml:"client_rate_burst"`
+			ClientMaxQueries           int                      `yaml:"client_max_queries"`
+			FrontendWorkers            int                      `yaml:"frontend_workers"`
+			FrontendQueueDepth         int                      `yaml:"frontend_queue_depth"`
+			MinFreeDiskSpace           int64                    `yaml:"min_free_disk_space"`
+			ReadOnlyFreeDiskSpace      int64                    `yaml:"read_only_free_disk_space"`
+			Deduplicate                []string                 `yaml:"deduplicate"`
+			BucketTimezones            []*BucketTimezoneSetting `yaml:"bucket_timezones"`
+			Calendars                  map[string]string        `yaml:"calendars"`
+			FeedHealth                 *FeedHealthSetting       `yaml:"feed_health"`
+			Replay                     *ReplaySetting           `yaml:"replay"`
+			Quality                    *QualitySetting          `yaml:"quality"`
+			Namespaces                 []*NamespaceSetting      `yaml:"namespaces"`
+			APIKeys                    []*APIKeySetting         `yaml:"api_keys"`
+			APIKeysFile                string                   `yaml:"api_keys_file"`
+			AuditLog                   *AuditLogSetting         `yaml:"audit_log"`
+			ShardName                  string                   `yaml:"shard_name"`
+			Shards                     []*ShardSetting          `yaml:"shards"`
+			Remotes                    []*RemoteSetting         `yaml:"remotes"`
+			PluginPaths                []string                 `yaml:"plugin_paths"`
+			pluginSections             `yaml:",inline"`
 		}
 	)
 
+	if data, err = Interpolate(data); err != nil {
+		return err
+	}
 	if err := yaml.Unmarshal(data, &aux); err != nil {
 		return err
 	}
@@ -123,26 +357,36 @@ func (m *MktsConfig) Parse(data []byte) error {
 	}
 
 	if aux.LogLevel != "" {
-		switch strings.ToLower(aux.LogLevel) {
-		case "fatal":
-			log.SetLevel(log.FATAL)
-		case "error":
-			log.SetLevel(log.ERROR)
-		case "warning":
-			log.SetLevel(log.WARNING)
-		case "debug":
-			log.SetLevel(log.DEBUG)
-		case "info":
-			fallthrough
-		default:
-			log.SetLevel(log.INFO)
+		log.SetLevel(parseLogLevel(aux.LogLevel))
+	}
+	log.SetComponentLevels(parseLogLevels(aux.LogLevels))
+	if aux.LogFormat != "" {
+		if err = log.SetFormat(aux.LogFormat); err != nil {
+			log.Fatal("Invalid log format.")
+			return err
 		}
 	}
+	if aux.LogFile != nil {
+		if err = openLogFile(aux.LogFile); err != nil {
+			log.Fatal("Invalid log file: %v", err)
+			return err
+		}
+		m.LogFile = aux.LogFile
+	}
 
 	if aux.StopGracePeriod > 0 {
 		m.StopGracePeriod = time.Duration(aux.StopGracePeriod) * time.Second
 	}
 
+	m.ShutdownTimeout = 30 * time.Second
+	if aux.ShutdownTimeout > 0 {
+		m.ShutdownTimeout = time.Duration(aux.ShutdownTimeout) * time.Second
+	}
+
+	if aux.StartupProbeDelay > 0 {
+		m.StartupProbeDelay = time.Duration(aux.StartupProbeDelay) * time.Second
+	}
+
 	if aux.EnableAdd != "" {
 		enableAdd, err := strconv.ParseBool(aux.EnableAdd)
 		if err != nil {
@@ -221,27 +465,700 @@ func (m *MktsConfig) Parse(data []byte) error {
 		}
 	}
 
+	if aux.QueryMaxRowsScanned < 0 || aux.QueryMaxBytesRead < 0 || aux.QueryMaxMemory < 0 {
+		log.Error("Invalid negative query limit, query limits must be zero (unlimited) or positive")
+	} else {
+		m.QueryMaxRowsScanned = aux.QueryMaxRowsScanned
+		m.QueryMaxBytesRead = aux.QueryMaxBytesRead
+		m.QueryMaxMemory = aux.QueryMaxMemory
+	}
+	if aux.MemoryLimit < 0 {
+		log.Error("Invalid negative memory_limit, must be zero (the limit of the cgroup) or positive")
+	} else {
+		m.MemoryLimit = aux.MemoryLimit
+	}
+
+	if aux.ClientRateLimit < 0 || aux.ClientRateBurst < 0 || aux.ClientMaxQueries < 0 {
+		log.Error("Invalid negative client limit, client limits must be zero (unlimited) or positive")
+	} else {
+		m.ClientRateLimit = aux.ClientRateLimit
+		m.ClientRateBurst = aux.ClientRateBurst
+		m.ClientMaxQueries = aux.ClientMaxQueries
+	}
+
+	if aux.FrontendWorkers < 0 || aux.FrontendQueueDepth < 0 {
+		log.Error("Invalid negative worker pool size, frontend_workers and frontend_queue_depth must be zero or positive")
+	} else {
+		m.FrontendWorkers = aux.FrontendWorkers
+		m.FrontendQueueDepth = aux.FrontendQueueDepth
+	}
+
+	m.APIKeys = aux.APIKeys
+	if aux.APIKeysFile != "" {
+		// The keys file holds a list of keys in the same format as api_keys
+		var fileKeys []*APIKeySetting
+		data, err := ioutil.ReadFile(aux.APIKeysFile)
+		if err == nil {
+			data, err = Interpolate(data)
+		}
+		if err == nil {
+			err = yaml.Unmarshal(data, &fileKeys)
+		}
+		if err != nil {
+			log.Fatal("Invalid api keys file.")
+			return fmt.Errorf("Invalid api keys file %v: %v", aux.APIKeysFile, err)
+		}
+		m.APIKeys = append(m.APIKeys, fileKeys...)
+	}
+
+	for _, setting := range []*TLSSetting{aux.ListenTLS, aux.UtilitiesTLS} {
+		if setting != nil && (setting.CertFile == "" || setting.KeyFile == "") {
+			log.Fatal("Invalid TLS setting, cert_file and key_file are required.")
+			return errors.New("Invalid TLS setting, cert_file and key_file are required.")
+		}
+	}
+	if aux.MinFreeDiskSpace < 0 {
+		log.Error("Invalid negative min_free_disk_space, must be zero (no minimum) or positive")
+	} else {
+		m.MinFreeDiskSpace = aux.MinFreeDiskSpace
+	}
+	if aux.ReadOnlyFreeDiskSpace < 0 {
+		log.Error("Invalid negative read_only_free_disk_space, must be zero (no write protection) or positive")
+	} else {
+		m.ReadOnlyFreeDiskSpace = aux.ReadOnlyFreeDiskSpace
+	}
+
+	// patterns of the variable length buckets whose writes are deduplicated
+	if err = m.SetDeduplicate(aux.Deduplicate); err != nil {
+		log.Fatal("Invalid deduplicate pattern.")
+		return err
+	}
+
+	if err = checkBucketTimezones(aux.BucketTimezones); err != nil {
+		log.Fatal("Invalid bucket_timezones setting.")
+		return err
+	}
+	m.BucketTimezones = aux.BucketTimezones
+
+	if err = loadCalendars(aux.Calendars); err != nil {
+		log.Fatal("Invalid calendars setting.")
+		return err
+	}
+	m.Calendars = aux.Calendars
+
+	if err = checkFeedHealth(aux.FeedHealth); err != nil {
+		log.Fatal("Invalid feed_health setting.")
+		return err
+	}
+	m.FeedHealth = aux.FeedHealth
+
+	if err = checkReplay(aux.Replay); err != nil {
+		log.Fatal("Invalid replay setting.")
+		return err
+	}
+	m.Replay = aux.Replay
+
+	if err = checkQuality(aux.Quality); err != nil {
+		log.Fatal("Invalid quality setting.")
+		return err
+	}
+	m.Quality = aux.Quality
+
+	if err = checkNamespaces(aux.Namespaces, m.APIKeys); err != nil {
+		log.Fatal("Invalid namespaces setting.")
+		return err
+	}
+	m.Namespaces = aux.Namespaces
+
+	if err = checkShards(aux.ShardName, aux.Shards); err != nil {
+		log.Fatal("Invalid shards setting.")
+		return err
+	}
+	m.ShardName = aux.ShardName
+	m.Shards = aux.Shards
+
+	if err = checkRemotes(aux.Remotes); err != nil {
+		log.Fatal("Invalid remotes setting.")
+		return err
+	}
+	m.Remotes = aux.Remotes
+	m.PluginPaths = aux.PluginPaths
+
+	m.AuditLog = aux.AuditLog
+	m.ListenTLS = aux.ListenTLS
+	m.UtilitiesTLS = aux.UtilitiesTLS
+
 	m.RootDirectory = aux.RootDirectory
 	m.ListenURL = fmt.Sprintf("%v:%v", aux.ListenHost, aux.ListenPort)
 	m.UtilitiesURL = fmt.Sprintf("%v", aux.UtilitiesURL)
+	m.PGWireURL = aux.PGWireURL
+	m.Diagnostics = aux.Diagnostics
 
-	for _, trig := range aux.Triggers {
+	m.Triggers, m.BgWorkers, err = aux.pluginSections.settings()
+	return err
+}
+
+// parseLogLevel returns the level of the log_level setting, info if unknown
+func parseLogLevel(value string) log.Level {
+	switch strings.ToLower(value) {
+	case "fatal":
+		return log.FATAL
+	case "error":
+		return log.ERROR
+	case "warning":
+		return log.WARNING
+	case "debug":
+		return log.DEBUG
+	}
+	return log.INFO
+}
+
+// openLogFile directs the log entries to the rotated file of the setting
+func openLogFile(setting *LogFileSetting) error {
+	switch {
+	case setting.Path == "":
+		return errors.New("log_file requires a path")
+	case setting.MaxSize < 0 || setting.RotateInterval < 0 || setting.MaxBackups < 0 || setting.MaxAge < 0:
+		return errors.New("log_file limits must not be negative")
+	}
+	f, err := log.OpenRotatingFile(setting.Path, setting.MaxSize,
+		setting.RotateInterval, setting.MaxBackups, setting.MaxAge)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(f)
+	return nil
+}
+
+// parseLogLevels returns the levels of the log_levels setting by component
+func parseLogLevels(values map[string]string) map[string]log.Level {
+	levels := make(map[string]log.Level, len(values))
+	for component, value := range values {
+		levels[component] = parseLogLevel(value)
+	}
+	return levels
+}
+
+// ReloadableSettings are the settings of the configuration file which are
+// applied while the server is running, see MktsConfig for their meaning
+type ReloadableSettings struct {
+	// nil if the log level is omitted, for the current one to be kept
+	LogLevel              *log.Level
+	LogLevels             map[string]log.Level
+	QueryMaxRowsScanned   int64
+	QueryMaxBytesRead     int64
+	QueryMaxMemory        int64
+	ClientRateLimit       float64
+	ClientRateBurst       int
+	ClientMaxQueries      int
+	MinFreeDiskSpace      int64
+	ReadOnlyFreeDiskSpace int64
+	Triggers              []*TriggerSetting
+	BgWorkers             []*BgWorkerSetting
+}
+
+// ParseReloadable parses the reloadable settings of the configuration file,
+// leaving the others to Parse.  Unlike Parse, an invalid setting is an error
+// rather than ignored or fatal, for the running server to keep its settings.
+func ParseReloadable(data []byte) (*ReloadableSettings, error) {
+	var aux struct {
+		LogLevel              string            `yaml:"log_level"`
+		LogLevels             map[string]string `yaml:"log_levels"`
+		QueryMaxRowsScanned   int64             `yaml:"query_max_rows_scanned"`
+		QueryMaxBytesRead     int64             `yaml:"query_max_bytes_read"`
+		QueryMaxMemory        int64             `yaml:"query_max_memory"`
+		ClientRateLimit       float64           `yaml:"client_rate_limit"`
+		ClientRateBurst       int               `yaml:"client_rate_burst"`
+		ClientMaxQueries      int               `yaml:"client_max_queries"`
+		MinFreeDiskSpace      int64             `yaml:"min_free_disk_space"`
+		ReadOnlyFreeDiskSpace int64             `yaml:"read_only_free_disk_space"`
+		pluginSections        `yaml:",inline"`
+	}
+	data, err := Interpolate(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &aux); err != nil {
+		return nil, err
+	}
+	if aux.QueryMaxRowsScanned < 0 || aux.QueryMaxBytesRead < 0 || aux.QueryMaxMemory < 0 {
+		return nil, errors.New("invalid negative query limit, query limits must be zero (unlimited) or positive")
+	}
+	if aux.ClientRateLimit < 0 || aux.ClientRateBurst < 0 || aux.ClientMaxQueries < 0 {
+		return nil, errors.New("invalid negative client limit, client limits must be zero (unlimited) or positive")
+	}
+	if aux.MinFreeDiskSpace < 0 {
+		return nil, errors.New("invalid negative min_free_disk_space, must be zero (no minimum) or positive")
+	}
+	if aux.ReadOnlyFreeDiskSpace < 0 {
+		return nil, errors.New("invalid negative read_only_free_disk_space, must be zero (no write protection) or positive")
+	}
+	settings := &ReloadableSettings{
+		LogLevels:             parseLogLevels(aux.LogLevels),
+		QueryMaxRowsScanned:   aux.QueryMaxRowsScanned,
+		QueryMaxBytesRead:     aux.QueryMaxBytesRead,
+		QueryMaxMemory:        aux.QueryMaxMemory,
+		ClientRateLimit:       aux.ClientRateLimit,
+		ClientRateBurst:       aux.ClientRateBurst,
+		ClientMaxQueries:      aux.ClientMaxQueries,
+		MinFreeDiskSpace:      aux.MinFreeDiskSpace,
+		ReadOnlyFreeDiskSpace: aux.ReadOnlyFreeDiskSpace,
+	}
+	if aux.LogLevel != "" {
+		level := parseLogLevel(aux.LogLevel)
+		settings.LogLevel = &level
+	}
+	settings.Triggers, settings.BgWorkers, err = aux.pluginSections.settings()
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// pluginSections are the triggers and bgworkers sections of the
+// configuration file
+type pluginSections struct {
+	Triggers []struct {
+		Name   string                 `yaml:"name"`
+		Module string                 `yaml:"module"`
+		On     string                 `yaml:"on"`
+		After  []string               `yaml:"after"`
+		Config map[string]interface{} `yaml:"config"`
+		// see TriggerSetting
+		Retries          int    `yaml:"retries"`
+		RetryDelay       string `yaml:"retry_delay"`
+		BreakerThreshold int    `yaml:"breaker_threshold"`
+		BreakerCooldown  string `yaml:"breaker_cooldown"`
+	} `yaml:"triggers"`
+	BgWorkers []struct {
+		Module string                 `yaml:"module"`
+		Name   string                 `yaml:"name"`
+		Config map[string]interface{} `yaml:"config"`
+		// see BgWorkerSetting
+		Restart         string `yaml:"restart"`
+		RestartDelay    string `yaml:"restart_delay"`
+		RestartMaxDelay string `yaml:"restart_max_delay"`
+		MaxRestarts     int    `yaml:"max_restarts"`
+	} `yaml:"bgworkers"`
+}
+
+// ParsePlugins parses the trigger and bgworker settings of the
+// configuration file alone, leaving the other sections to Parse, for them to
+// be reloaded while the server is running.
+func ParsePlugins(data []byte) ([]*TriggerSetting, []*BgWorkerSetting, error) {
+	var sections pluginSections
+	data, err := Interpolate(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return nil, nil, err
+	}
+	return sections.settings()
+}
+
+func (p *pluginSections) settings() (triggers []*TriggerSetting, bgWorkers []*BgWorkerSetting, err error) {
+	for _, trig := range p.Triggers {
 		triggerSetting := &TriggerSetting{
-			Module: trig.Module,
-			On:     trig.On,
-			Config: trig.Config,
+			Name:             trig.Name,
+			Module:           trig.Module,
+			On:               trig.On,
+			After:            trig.After,
+			Retries:          trig.Retries,
+			RetryDelay:       time.Second,
+			BreakerThreshold: trig.BreakerThreshold,
+			BreakerCooldown:  time.Minute,
+			Config:           trig.Config,
+		}
+		if triggerSetting.Name == "" {
+			triggerSetting.Name = trig.Module
 		}
-		m.Triggers = append(m.Triggers, triggerSetting)
+		if trig.RetryDelay != "" {
+			if triggerSetting.RetryDelay, err = time.ParseDuration(trig.RetryDelay); err != nil {
+				return nil, nil, fmt.Errorf("invalid retry_delay of trigger %s: %v", triggerSetting.Name, err)
+			}
+		}
+		if trig.BreakerCooldown != "" {
+			if triggerSetting.BreakerCooldown, err = time.ParseDuration(trig.BreakerCooldown); err != nil {
+				return nil, nil, fmt.Errorf("invalid breaker_cooldown of trigger %s: %v", triggerSetting.Name, err)
+			}
+		}
+		triggers = append(triggers, triggerSetting)
+	}
+	if err = checkTriggerOrder(triggers); err != nil {
+		return nil, nil, err
 	}
 
-	for _, bg := range aux.BgWorkers {
+	for _, bg := range p.BgWorkers {
 		bgWorkerSetting := &BgWorkerSetting{
-			Module: bg.Module,
-			Name:   bg.Name,
-			Config: bg.Config,
+			Module:          bg.Module,
+			Name:            bg.Name,
+			Config:          bg.Config,
+			Restart:         "no",
+			RestartDelay:    time.Second,
+			RestartMaxDelay: 5 * time.Minute,
+			MaxRestarts:     bg.MaxRestarts,
+		}
+		switch bg.Restart {
+		case "":
+		case "no", "on-failure", "always":
+			bgWorkerSetting.Restart = bg.Restart
+		default:
+			return nil, nil, fmt.Errorf("invalid restart of bgworker %s: %s, must be no, on-failure or always",
+				bg.Name, bg.Restart)
 		}
-		m.BgWorkers = append(m.BgWorkers, bgWorkerSetting)
+		if bg.RestartDelay != "" {
+			if bgWorkerSetting.RestartDelay, err = time.ParseDuration(bg.RestartDelay); err != nil {
+				return nil, nil, fmt.Errorf("invalid restart_delay of bgworker %s: %v", bg.Name, err)
+			}
+		}
+		if bg.RestartMaxDelay != "" {
+			if bgWorkerSetting.RestartMaxDelay, err = time.ParseDuration(bg.RestartMaxDelay); err != nil {
+				return nil, nil, fmt.Errorf("invalid restart_max_delay of bgworker %s: %v", bg.Name, err)
+			}
+		}
+		if bgWorkerSetting.RestartMaxDelay < bgWorkerSetting.RestartDelay {
+			bgWorkerSetting.RestartMaxDelay = bgWorkerSetting.RestartDelay
+		}
+		bgWorkers = append(bgWorkers, bgWorkerSetting)
 	}
+	return triggers, bgWorkers, nil
+}
 
-	return err
+// checkShards verifies that the shards are named uniquely, this instance
+// being one of them, with valid symbol patterns and the URL of the others
+func checkShards(self string, shards []*ShardSetting) error {
+	if len(shards) == 0 {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, shard := range shards {
+		if shard.Name == "" || names[shard.Name] {
+			return fmt.Errorf("shards must have unique names, have: %q", shard.Name)
+		}
+		names[shard.Name] = true
+		if shard.Name != self && shard.URL == "" {
+			return fmt.Errorf("shard %s has no url", shard.Name)
+		}
+		for _, pattern := range shard.Symbols {
+			if _, err := glob.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid symbol pattern %v of shard %s: %v", pattern, shard.Name, err)
+			}
+		}
+	}
+	if !names[self] {
+		return fmt.Errorf("shard_name %q is not one of the shards", self)
+	}
+	return nil
+}
+
+// ShardOf returns the shard owning the symbol, the first one with a pattern
+// matching it, or nil if no shard owns it
+func (m *MktsConfig) ShardOf(symbol string) *ShardSetting {
+	for _, shard := range m.Shards {
+		for _, pattern := range shard.Symbols {
+			g, err := glob.Compile(pattern)
+			if err == nil && g.Match(symbol) {
+				return shard
+			}
+		}
+	}
+	return nil
+}
+
+// checkRemotes verifies that the remotes are named uniquely, and compiles
+// the patterns of their buckets
+func checkRemotes(remotes []*RemoteSetting) error {
+	names := map[string]bool{}
+	for _, remote := range remotes {
+		if remote.Name == "" || names[remote.Name] {
+			return fmt.Errorf("remotes must have unique names, have: %q", remote.Name)
+		}
+		names[remote.Name] = true
+		if remote.URL == "" {
+			return fmt.Errorf("remote %s has no url", remote.Name)
+		}
+		if len(remote.Buckets) == 0 {
+			return fmt.Errorf("remote %s has no buckets", remote.Name)
+		}
+		remote.globs = remote.globs[:0]
+		for _, pattern := range remote.Buckets {
+			g, err := glob.Compile(pattern, '/')
+			if err != nil || strings.Count(pattern, "/") != 2 {
+				return fmt.Errorf("invalid bucket pattern %v of remote %s", pattern, remote.Name)
+			}
+			remote.globs = append(remote.globs, g)
+		}
+	}
+	return nil
+}
+
+// RemoteOf returns the remote holding the bucket with the item key, the
+// first one with a pattern matching it, or nil if it is held locally
+func (m *MktsConfig) RemoteOf(itemKey string) *RemoteSetting {
+	for _, remote := range m.Remotes {
+		if remote.Holds(itemKey) {
+			return remote
+		}
+	}
+	return nil
+}
+
+// checkBucketTimezones verifies the patterns and loads the timezones of the
+// bucket_timezones settings
+func checkBucketTimezones(settings []*BucketTimezoneSetting) (err error) {
+	for _, bt := range settings {
+		if _, err = glob.Compile(bt.Pattern, '/'); err != nil {
+			return fmt.Errorf("invalid bucket_timezones pattern %v: %v", bt.Pattern, err)
+		}
+		if bt.location, err = time.LoadLocation(bt.Timezone); err != nil || bt.Timezone == "" {
+			return fmt.Errorf("invalid timezone %q of bucket_timezones pattern %v", bt.Timezone, bt.Pattern)
+		}
+	}
+	return nil
+}
+
+// loadCalendars loads the market calendars of the calendars setting, by
+// name the paths of their JSON or YAML files, and registers them for the
+// aggregations and the session queries to find them by name
+func loadCalendars(paths map[string]string) error {
+	for name, path := range paths {
+		if name == "" {
+			return fmt.Errorf("calendar without a name at %v", path)
+		}
+		cal, err := calendar.Load(path)
+		if err != nil {
+			return fmt.Errorf("invalid calendar %v: %v", name, err)
+		}
+		calendar.Register(name, cal)
+	}
+	return nil
+}
+
+// checkNamespaces verifies that the namespaces are named uniquely, without
+// the separator, and that the API keys are of known namespaces
+func checkNamespaces(namespaces []*NamespaceSetting, keys []*APIKeySetting) error {
+	names := map[string]bool{}
+	for _, ns := range namespaces {
+		if ns.Name == "" || strings.ContainsAny(ns.Name, NamespaceSeparator+"/,*") {
+			return fmt.Errorf("invalid namespace name %q", ns.Name)
+		}
+		if names[ns.Name] {
+			return fmt.Errorf("namespace %s defined twice", ns.Name)
+		}
+		names[ns.Name] = true
+		if ns.MaxBuckets < 0 || ns.MaxDiskBytes < 0 {
+			return fmt.Errorf("namespace %s with a negative max_buckets or max_disk_bytes", ns.Name)
+		}
+	}
+	for _, key := range keys {
+		if key != nil && key.Namespace != "" && !names[key.Namespace] {
+			return fmt.Errorf("API key %s of unknown namespace %s", key.Name, key.Namespace)
+		}
+	}
+	return nil
+}
+
+// NamespaceOf returns the namespace of the symbol, nil if it is of none
+func (m *MktsConfig) NamespaceOf(symbol string) *NamespaceSetting {
+	for _, ns := range m.Namespaces {
+		if strings.HasPrefix(symbol, ns.Prefix()) {
+			return ns
+		}
+	}
+	return nil
+}
+
+// checkFeedHealth verifies the feeds of the feed_health setting, naming
+// them after their pattern if unnamed, and defaults its check_interval to
+// 30 seconds
+func checkFeedHealth(setting *FeedHealthSetting) error {
+	if setting == nil {
+		return nil
+	}
+	if setting.CheckInterval < 0 {
+		return fmt.Errorf("invalid negative feed_health check_interval")
+	} else if setting.CheckInterval == 0 {
+		setting.CheckInterval = 30 * time.Second
+	}
+	names := map[string]bool{}
+	for _, feed := range setting.Feeds {
+		if _, err := glob.Compile(feed.Pattern, '/'); err != nil || feed.Pattern == "" {
+			return fmt.Errorf("invalid feed_health pattern %q", feed.Pattern)
+		}
+		if feed.MaxAge <= 0 {
+			return fmt.Errorf("feed_health pattern %v without a positive max_age", feed.Pattern)
+		}
+		if feed.Calendar != "" {
+			if _, err := calendar.Load(feed.Calendar); err != nil {
+				return fmt.Errorf("invalid calendar of feed_health pattern %v: %v", feed.Pattern, err)
+			}
+		}
+		if feed.Name == "" {
+			feed.Name = feed.Pattern
+		}
+		if names[feed.Name] {
+			return fmt.Errorf("duplicate feed_health feed %v", feed.Name)
+		}
+		names[feed.Name] = true
+	}
+	return nil
+}
+
+// checkQuality verifies the checks of the quality setting, the interval
+// defaulting to a day
+func checkQuality(setting *QualitySetting) error {
+	if setting == nil {
+		return nil
+	}
+	if setting.Interval < 0 {
+		return fmt.Errorf("invalid negative quality interval")
+	} else if setting.Interval == 0 {
+		setting.Interval = 24 * time.Hour
+	}
+	for _, check := range setting.Checks {
+		if _, err := glob.Compile(check.Pattern, '/'); err != nil || check.Pattern == "" {
+			return fmt.Errorf("invalid quality pattern %q", check.Pattern)
+		}
+		if check.MaxGap < 0 || check.MaxJump < 0 {
+			return fmt.Errorf("quality pattern %v with a negative max_gap or max_jump", check.Pattern)
+		}
+		if check.Calendar != "" {
+			if _, err := calendar.Load(check.Calendar); err != nil {
+				return fmt.Errorf("invalid calendar of quality pattern %v: %v", check.Pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkReplay verifies the replay setting, the speed defaulting to 1 and the
+// streams to all the buckets
+func checkReplay(setting *ReplaySetting) error {
+	if setting == nil {
+		return nil
+	}
+	if setting.Start.IsZero() {
+		return fmt.Errorf("replay without a start")
+	}
+	if !setting.End.IsZero() && setting.End.Before(setting.Start) {
+		return fmt.Errorf("replay end %v before its start %v", setting.End, setting.Start)
+	}
+	if setting.Speed < 0 {
+		return fmt.Errorf("invalid negative replay speed %v", setting.Speed)
+	} else if setting.Speed == 0 {
+		setting.Speed = 1
+	}
+	for _, pattern := range setting.Symbols {
+		if _, err := glob.Compile(pattern); err != nil || pattern == "" {
+			return fmt.Errorf("invalid replay symbol pattern %q", pattern)
+		}
+	}
+	if len(setting.Streams) == 0 {
+		setting.Streams = []string{"*/*/*"}
+	}
+	for _, stream := range setting.Streams {
+		if _, err := glob.Compile(stream, '/'); err != nil || strings.Count(stream, "/") != 2 {
+			return fmt.Errorf("invalid replay stream %q", stream)
+		}
+	}
+	return nil
+}
+
+// BucketTimezoneOf returns the timezone of the first bucket_timezones
+// setting whose pattern matches the item key, or nil if none does
+func (m *MktsConfig) BucketTimezoneOf(itemKey string) *time.Location {
+	for _, bt := range m.BucketTimezones {
+		g, err := glob.Compile(bt.Pattern, '/')
+		if err == nil && g.Match(itemKey) {
+			return bt.location
+		}
+	}
+	return nil
+}
+
+// SetDeduplicate sets the patterns of the variable length buckets whose
+// writes are deduplicated, compiled once for every write to match them
+func (m *MktsConfig) SetDeduplicate(patterns []string) error {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return fmt.Errorf("Invalid deduplicate pattern %v: %v", pattern, err)
+		}
+		globs = append(globs, g)
+	}
+	m.Deduplicate, m.deduplicate = patterns, globs
+	return nil
+}
+
+// Deduplicated returns true if the writes to the bucket with the item key
+// are deduplicated, the key matching a pattern of the deduplicate setting
+func (m *MktsConfig) Deduplicated(itemKey string) bool {
+	for _, g := range m.deduplicate {
+		if g.Match(itemKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnsSymbol returns true unless another shard owns the symbol, the symbols
+// no shard owns being written by any instance
+func (m *MktsConfig) OwnsSymbol(symbol string) bool {
+	shard := m.ShardOf(symbol)
+	return shard == nil || shard.Name == m.ShardName
+}
+
+// checkTriggerOrder verifies that the triggers in the After of the others
+// exist, are named uniquely and do not depend on each other in a cycle
+func checkTriggerOrder(triggers []*TriggerSetting) error {
+	counts := map[string]int{}
+	byName := map[string]*TriggerSetting{}
+	for _, ts := range triggers {
+		counts[ts.Name]++
+		byName[ts.Name] = ts
+	}
+	for _, ts := range triggers {
+		for _, name := range ts.After {
+			switch counts[name] {
+			case 0:
+				return fmt.Errorf("trigger %s is after unknown trigger %s", ts.Name, name)
+			case 1:
+			default:
+				return fmt.Errorf("trigger %s is after %s, which names %d triggers", ts.Name, name, counts[name])
+			}
+		}
+	}
+
+	// depth first search of the cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[*TriggerSetting]int{}
+	var visit func(ts *TriggerSetting, path []string) error
+	visit = func(ts *TriggerSetting, path []string) error {
+		path = append(path, ts.Name)
+		switch state[ts] {
+		case visiting:
+			return fmt.Errorf("triggers depend on each other in a cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[ts] = visiting
+		for _, name := range ts.After {
+			if err := visit(byName[name], path); err != nil {
+				return err
+			}
+		}
+		state[ts] = visited
+		return nil
+	}
+	for _, ts := range triggers {
+		if err := visit(ts, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,406 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alpacahq/marketstore/contrib/calendar"
+	"github.com/alpacahq/marketstore/utils/log"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *UtilsTestSuite) TestCheckTriggerOrder(c *C) {
+	trig := func(name string, after ...string) *TriggerSetting {
+		return &TriggerSetting{Name: name, After: after}
+	}
+
+	c.Assert(checkTriggerOrder([]*TriggerSetting{
+		trig("dedup.so"),
+		trig("agg", "dedup.so"),
+		trig("indicator.so", "dedup.so", "agg"),
+		// not in an after list, so not named uniquely
+		trig("stream.so"),
+		trig("stream.so"),
+	}), IsNil)
+
+	for _, triggers := range [][]*TriggerSetting{
+		// unknown
+		{trig("agg", "dedup.so")},
+		// not named uniquely
+		{trig("dedup.so"), trig("dedup.so"), trig("agg", "dedup.so")},
+		// cycles
+		{trig("a.so", "c.so"), trig("b.so", "a.so"), trig("c.so", "b.so")},
+		{trig("a.so", "a.so")},
+	} {
+		c.Assert(checkTriggerOrder(triggers), NotNil)
+	}
+}
+
+func (s *UtilsTestSuite) TestParsePlugins(c *C) {
+	data := []byte(`
+root_directory: /data
+listen_port: 5993
+triggers:
+  - module: ondiskagg.so
+    on: "*/1Min/OHLCV"
+    retry_delay: 5s
+    config:
+      destinations: [5Min]
+bgworkers:
+  - module: gdaxfeeder.so
+    name: GDAXFetcher
+    restart: on-failure
+    restart_delay: 2s
+    max_restarts: 5
+    config:
+      symbols: [BTC]
+`)
+	triggers, bgWorkers, err := ParsePlugins(data)
+	c.Assert(err, IsNil)
+	c.Assert(triggers, HasLen, 1)
+	c.Assert(triggers[0].Name, Equals, "ondiskagg.so")
+	c.Assert(triggers[0].On, Equals, "*/1Min/OHLCV")
+	c.Assert(triggers[0].RetryDelay, Equals, 5*time.Second)
+	c.Assert(triggers[0].BreakerCooldown, Equals, time.Minute)
+	c.Assert(bgWorkers, HasLen, 1)
+	c.Assert(bgWorkers[0].Name, Equals, "GDAXFetcher")
+	c.Assert(bgWorkers[0].Config["symbols"], DeepEquals, []interface{}{"BTC"})
+	c.Assert(bgWorkers[0].Restart, Equals, "on-failure")
+	c.Assert(bgWorkers[0].RestartDelay, Equals, 2*time.Second)
+	c.Assert(bgWorkers[0].RestartMaxDelay, Equals, 5*time.Minute)
+	c.Assert(bgWorkers[0].MaxRestarts, Equals, 5)
+
+	var config MktsConfig
+	c.Assert(config.Parse(data), IsNil)
+	c.Assert(config.Triggers, DeepEquals, triggers)
+	c.Assert(config.BgWorkers, DeepEquals, bgWorkers)
+
+	_, _, err = ParsePlugins([]byte(`
+triggers:
+  - module: ondiskagg.so
+    retry_delay: soon
+`))
+	c.Assert(err, NotNil)
+
+	_, _, err = ParsePlugins([]byte(`
+bgworkers:
+  - module: gdaxfeeder.so
+    restart: sometimes
+`))
+	c.Assert(err, ErrorMatches, "invalid restart .*")
+}
+
+func (s *UtilsTestSuite) TestParseReloadable(c *C) {
+	settings, err := ParseReloadable([]byte(`
+root_directory: /data
+listen_port: 5993
+log_level: error
+log_levels:
+  executor: debug
+  plugins/polygon: error
+query_max_bytes_read: 1024
+client_rate_limit: 2.5
+min_free_disk_space: 4096
+read_only_free_disk_space: 1024
+triggers:
+  - module: ondiskagg.so
+    on: "*/1Min/OHLCV"
+`))
+	c.Assert(err, IsNil)
+	c.Assert(*settings.LogLevel, Equals, log.ERROR)
+	c.Assert(settings.LogLevels, DeepEquals, map[string]log.Level{
+		"executor":        log.DEBUG,
+		"plugins/polygon": log.ERROR,
+	})
+	c.Assert(settings.QueryMaxBytesRead, Equals, int64(1024))
+	c.Assert(settings.ClientRateLimit, Equals, 2.5)
+	c.Assert(settings.MinFreeDiskSpace, Equals, int64(4096))
+	c.Assert(settings.ReadOnlyFreeDiskSpace, Equals, int64(1024))
+	c.Assert(settings.Triggers, HasLen, 1)
+
+	// the log level is kept if omitted
+	settings, err = ParseReloadable([]byte(`query_max_memory: 1`))
+	c.Assert(err, IsNil)
+	c.Assert(settings.LogLevel, IsNil)
+
+	for _, invalid := range []string{
+		"client_max_queries: -1",
+		"min_free_disk_space: -1",
+		"query_max_rows_scanned: many",
+	} {
+		_, err = ParseReloadable([]byte(invalid))
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *UtilsTestSuite) TestInterpolate(c *C) {
+	os.Setenv("MKTS_TEST_KEY", "s3cret")
+	os.Setenv("MKTS_TEST_EMPTY", "")
+	defer os.Unsetenv("MKTS_TEST_KEY")
+	defer os.Unsetenv("MKTS_TEST_EMPTY")
+	secret := filepath.Join(c.MkDir(), "secret")
+	c.Assert(ioutil.WriteFile(secret, []byte("from file\n"), 0600), IsNil)
+
+	data, err := Interpolate([]byte("key: ${MKTS_TEST_KEY}\n" +
+		"port: ${MKTS_TEST_UNSET:-5993}\n" +
+		"empty: ${MKTS_TEST_EMPTY:-default}\n" +
+		"password: ${file:" + secret + "}\n" +
+		"literal: $${MKTS_TEST_KEY} $5\n"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "key: s3cret\n"+
+		"port: 5993\n"+
+		"empty: default\n"+
+		"password: from file\n"+
+		"literal: ${MKTS_TEST_KEY} $5\n")
+
+	for _, invalid := range []string{"${MKTS_TEST_UNSET}", "${file:/nonexistent}", "${1ABC}"} {
+		_, err = Interpolate([]byte(invalid))
+		c.Assert(err, NotNil, Commentf(invalid))
+	}
+
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: ${MKTS_TEST_UNSET:-5993}
+api_keys:
+  - key: ${MKTS_TEST_KEY}
+    permission: admin
+`)), IsNil)
+	c.Assert(config.ListenURL, Equals, ":5993")
+	c.Assert(config.APIKeys[0].Key, Equals, "s3cret")
+}
+
+func (s *UtilsTestSuite) TestShards(c *C) {
+	shards := []*ShardSetting{
+		{Name: "a", URL: "http://a:5993/", Symbols: []string{"A*", "B*"}},
+		{Name: "b", URL: "http://b:5993/", Symbols: []string{"[C-Z]*", "AAPL"}},
+	}
+	c.Assert(checkShards("a", shards), IsNil)
+	c.Assert(checkShards("c", shards), NotNil)
+	c.Assert(checkShards("", nil), IsNil)
+	c.Assert(checkShards("a", []*ShardSetting{{Name: "a"}, {Name: "a"}}), NotNil)
+	c.Assert(checkShards("a", []*ShardSetting{{Name: "a"}, {Name: "b"}}), NotNil)
+	c.Assert(checkShards("a", []*ShardSetting{{Name: "a", Symbols: []string{"[A"}}}), NotNil)
+
+	config := MktsConfig{ShardName: "a", Shards: shards}
+	// the first matching shard owns the symbol
+	c.Assert(config.ShardOf("AAPL").Name, Equals, "a")
+	c.Assert(config.ShardOf("TSLA").Name, Equals, "b")
+	c.Assert(config.ShardOf("1INCH"), IsNil)
+	c.Assert(config.OwnsSymbol("BTC"), Equals, true)
+	c.Assert(config.OwnsSymbol("TSLA"), Equals, false)
+	c.Assert(config.OwnsSymbol("1INCH"), Equals, true)
+}
+
+func (s *UtilsTestSuite) TestDeduplicate(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+deduplicate:
+  - "*/1Min/TRADE"
+  - "BTC/*/QUOTE"
+`)), IsNil)
+	c.Assert(config.Deduplicate, DeepEquals, []string{"*/1Min/TRADE", "BTC/*/QUOTE"})
+	c.Assert(config.Deduplicated("AAPL/1Min/TRADE"), Equals, true)
+	c.Assert(config.Deduplicated("BTC/1Sec/QUOTE"), Equals, true)
+	c.Assert(config.Deduplicated("AAPL/1Sec/QUOTE"), Equals, false)
+	c.Assert((&MktsConfig{}).Deduplicated("AAPL/1Min/TRADE"), Equals, false)
+
+	c.Assert(config.SetDeduplicate([]string{"*/1Min/["}), NotNil)
+	c.Assert(config.SetDeduplicate(nil), IsNil)
+	c.Assert(config.Deduplicated("AAPL/1Min/TRADE"), Equals, false)
+}
+
+func (s *UtilsTestSuite) TestBucketTimezones(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+timezone: America/New_York
+bucket_timezones:
+  - pattern: "*.T/*/*"
+    timezone: Asia/Tokyo
+  - pattern: "*/*/*"
+    timezone: Europe/London
+`)), IsNil)
+	c.Assert(config.BucketTimezoneOf("7203.T/1D/OHLCV").String(), Equals, "Asia/Tokyo")
+	c.Assert(config.BucketTimezoneOf("BARC/1D/OHLCV").String(), Equals, "Europe/London")
+	c.Assert((&MktsConfig{}).BucketTimezoneOf("BARC/1D/OHLCV"), IsNil)
+
+	for _, bt := range []*BucketTimezoneSetting{
+		{Pattern: "*/1D/[", Timezone: "Asia/Tokyo"},
+		{Pattern: "*/1D/*", Timezone: "Asia/Nowhere"},
+		{Pattern: "*/1D/*"},
+	} {
+		c.Assert(checkBucketTimezones([]*BucketTimezoneSetting{bt}), NotNil)
+	}
+}
+
+func (s *UtilsTestSuite) TestCalendars(c *C) {
+	path := filepath.Join(c.MkDir(), "lse.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(`
+timezone: Europe/London
+open_time: "08:00"
+close_time: "16:30"
+`), 0644), IsNil)
+	c.Assert(loadCalendars(map[string]string{"lse": path}), IsNil)
+	defer calendar.Register("lse", nil)
+	cal, err := calendar.Load("lse")
+	c.Assert(err, IsNil)
+	c.Assert(cal.Tz().String(), Equals, "Europe/London")
+
+	c.Assert(loadCalendars(map[string]string{"tse": "/no/such/calendar.yaml"}), NotNil)
+}
+
+func (s *UtilsTestSuite) TestFeedHealth(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+feed_health:
+  feeds:
+    - pattern: "*/1Min/OHLCV"
+      max_age: 5m
+      calendar: nyse
+`)), IsNil)
+	c.Assert(config.FeedHealth.CheckInterval, Equals, 30*time.Second)
+	feed := config.FeedHealth.Feeds[0]
+	c.Assert(feed.Name, Equals, "*/1Min/OHLCV")
+	c.Assert(feed.MaxAge, Equals, 5*time.Minute)
+
+	for _, setting := range []*FeedHealthSetting{
+		{CheckInterval: -time.Second},
+		{Feeds: []*FeedSetting{{Pattern: "[", MaxAge: time.Minute}}},
+		{Feeds: []*FeedSetting{{MaxAge: time.Minute}}},
+		{Feeds: []*FeedSetting{{Pattern: "*/1Min/*"}}},
+		{Feeds: []*FeedSetting{{Pattern: "*/1Min/*", MaxAge: time.Minute, Calendar: "nowhere"}}},
+		{Feeds: []*FeedSetting{{Name: "a", Pattern: "*/1Min/*", MaxAge: time.Minute}, {Name: "a", Pattern: "*/1D/*", MaxAge: time.Hour}}},
+	} {
+		c.Assert(checkFeedHealth(setting), NotNil)
+	}
+}
+
+func (s *UtilsTestSuite) TestReplay(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+replay:
+  start: 2024-03-04T09:30:00-05:00
+  symbols: [AAPL, "MS*"]
+`)), IsNil)
+	c.Assert(config.Replay.Start.Unix(), Equals, time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC).Unix())
+	c.Assert(config.Replay.Speed, Equals, 1.0)
+	c.Assert(config.Replay.Streams, DeepEquals, []string{"*/*/*"})
+
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	for _, setting := range []*ReplaySetting{
+		{},
+		{Start: start, End: start.Add(-time.Hour)},
+		{Start: start, Speed: -1},
+		{Start: start, Symbols: []string{"["}},
+		{Start: start, Streams: []string{"AAPL/1Min"}},
+	} {
+		c.Assert(checkReplay(setting), NotNil)
+	}
+}
+
+func (s *UtilsTestSuite) TestQuality(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+quality:
+  checks:
+    - pattern: "*/1Min/OHLCV"
+      calendar: nyse
+      max_gap: 5m
+      max_jump: 0.2
+`)), IsNil)
+	c.Assert(config.Quality.Interval, Equals, 24*time.Hour)
+	check := config.Quality.Checks[0]
+	c.Assert(check.MaxGap, Equals, 5*time.Minute)
+	c.Assert(check.MaxJump, Equals, 0.2)
+
+	for _, setting := range []*QualitySetting{
+		{Interval: -time.Hour},
+		{Checks: []*QualityCheckSetting{{}}},
+		{Checks: []*QualityCheckSetting{{Pattern: "["}}},
+		{Checks: []*QualityCheckSetting{{Pattern: "*/1Min/*", MaxGap: -time.Minute}}},
+		{Checks: []*QualityCheckSetting{{Pattern: "*/1Min/*", MaxJump: -1}}},
+		{Checks: []*QualityCheckSetting{{Pattern: "*/1Min/*", Calendar: "nowhere"}}},
+	} {
+		c.Assert(checkQuality(setting), NotNil)
+	}
+}
+
+func (s *UtilsTestSuite) TestNamespaces(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+namespaces:
+  - name: alpha
+    max_buckets: 100
+    max_disk_bytes: 1000000
+  - name: beta
+api_keys:
+  - key: a
+    permission: write
+    namespace: alpha
+`)), IsNil)
+	c.Assert(config.Namespaces, HasLen, 2)
+	c.Assert(config.APIKeys[0].Namespace, Equals, "alpha")
+	c.Assert(config.NamespaceOf("alpha.AAPL").Name, Equals, "alpha")
+	c.Assert(config.NamespaceOf("beta.AAPL").Name, Equals, "beta")
+	c.Assert(config.NamespaceOf("alphabet"), IsNil)
+	c.Assert(config.NamespaceOf("AAPL"), IsNil)
+
+	for _, namespaces := range [][]*NamespaceSetting{
+		{{}},
+		{{Name: "a.b"}},
+		{{Name: "a/b"}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", MaxBuckets: -1}},
+		{{Name: "a", MaxDiskBytes: -1}},
+	} {
+		c.Assert(checkNamespaces(namespaces, nil), NotNil)
+	}
+	c.Assert(checkNamespaces(nil, []*APIKeySetting{{Key: "a", Namespace: "alpha"}}), NotNil)
+}
+
+func (s *UtilsTestSuite) TestRemotes(c *C) {
+	var config MktsConfig
+	c.Assert(config.Parse([]byte(`
+root_directory: /data
+listen_port: 5993
+remotes:
+  - name: crypto
+    url: http://crypto:5993
+    buckets: ["*/*/CRYPTO", "BTC*/*/*"]
+  - name: equities
+    url: http://equities:5993
+    api_key: secret
+    buckets: ["*/*/*"]
+`)), IsNil)
+	c.Assert(config.Remotes, HasLen, 2)
+	c.Assert(config.RemoteOf("ETH/1Min/CRYPTO").Name, Equals, "crypto")
+	c.Assert(config.RemoteOf("BTC/1Min/OHLCV").Name, Equals, "crypto")
+	c.Assert(config.RemoteOf("AAPL/1Min/OHLCV").Name, Equals, "equities")
+	c.Assert(config.RemoteOf("AAPL/1Min"), IsNil)
+
+	for _, remotes := range [][]*RemoteSetting{
+		{{URL: "http://a", Buckets: []string{"*/*/*"}}},
+		{{Name: "a", Buckets: []string{"*/*/*"}}},
+		{{Name: "a", URL: "http://a"}},
+		{{Name: "a", URL: "http://a", Buckets: []string{"*/*"}}},
+		{{Name: "a", URL: "http://a", Buckets: []string{"[/*/*"}}},
+		{{Name: "a", URL: "http://a", Buckets: []string{"*/*/*"}}, {Name: "a", URL: "http://b", Buckets: []string{"*/*/*"}}},
+	} {
+		c.Assert(checkRemotes(remotes), NotNil)
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// a reference, or an escaped one
+	reference    = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Interpolate replaces the references of the configuration file by their
+// value, so that the credentials are kept out of it:
+//
+//	${VAR}              the environment variable VAR, which must be set
+//	${VAR:-default}     VAR, or default if it is unset or empty
+//	${file:/run/secret} the content of the file, without its trailing newline
+//	$${                 a literal ${
+//
+// The references are replaced in the text of the file, comments included,
+// so a value which is not a plain YAML scalar must be in quotes.
+func Interpolate(data []byte) ([]byte, error) {
+	var err error
+	out := reference.ReplaceAllFunc(data, func(match []byte) []byte {
+		if string(match) == "$${" {
+			return []byte("${")
+		}
+		value, e := resolveReference(string(match[2 : len(match)-1]))
+		if e != nil && err == nil {
+			err = e
+		}
+		return []byte(value)
+	})
+	return out, err
+}
+
+func resolveReference(ref string) (string, error) {
+	if strings.HasPrefix(ref, "file:") {
+		data, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	name, fallback := ref, ""
+	hasDefault := false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, fallback, hasDefault = ref[:i], ref[i+2:], true
+	}
+	if !variableName.MatchString(name) {
+		return "", fmt.Errorf("invalid reference ${%s}", ref)
+	}
+	value, ok := os.LookupEnv(name)
+	switch {
+	case hasDefault && value == "":
+		return fallback, nil
+	case !ok:
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
@@ -1,10 +1,12 @@
 package io
 
 import (
+	"bytes"
 	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
@@ -484,6 +486,80 @@ func (s *TestSuite) TestUnion(c *C) {
 	c.Assert(cs.GetEpoch()[5], Equals, csC.GetEpoch()[2])
 }
 
+func (s *TestSuite) TestToWideColumnSeries(c *C) {
+	aapl := NewColumnSeries()
+	aapl.AddColumn("Epoch", []int64{1, 2, 3})
+	aapl.AddColumn("Close", []float32{10, 11, 12})
+	aapl.AddColumn("Volume", []int32{100, 110, 120})
+	msft := NewColumnSeries()
+	msft.AddColumn("Epoch", []int64{2, 4})
+	msft.AddColumn("Close", []float32{20, 21})
+	msft.AddColumn("Volume", []int32{200, 210})
+
+	csm := NewColumnSeriesMap()
+	csm[*NewTimeBucketKey("MSFT/1Min/OHLCV")] = msft
+	csm[*NewTimeBucketKey("AAPL/1Min/OHLCV")] = aapl
+
+	wide, err := csm.ToWideColumnSeries("Symbol")
+	c.Assert(err, IsNil)
+	c.Assert(wide.GetColumnNames(), DeepEquals,
+		[]string{"Epoch", "Close_AAPL", "Close_MSFT", "Volume_AAPL", "Volume_MSFT"})
+	c.Assert(wide.GetEpoch(), DeepEquals, []int64{1, 2, 3, 4})
+	closeMSFT := wide.GetByName("Close_MSFT").([]float32)
+	c.Assert(math.IsNaN(float64(closeMSFT[0])), Equals, true)
+	c.Assert(closeMSFT[1], Equals, float32(20))
+	c.Assert(math.IsNaN(float64(closeMSFT[2])), Equals, true)
+	c.Assert(closeMSFT[3], Equals, float32(21))
+	c.Assert(wide.GetByName("Volume_AAPL"), DeepEquals, []int32{100, 110, 120, 0})
+
+	_, err = csm.ToWideColumnSeries("Market")
+	c.Assert(err, NotNil)
+
+	// the rows of the same epoch of a member would overwrite each other
+	tick := NewColumnSeries()
+	tick.AddColumn("Epoch", []int64{5, 5})
+	tick.AddColumn("Close", []float32{30, 31})
+	tick.AddColumn("Volume", []int32{300, 310})
+	csm[*NewTimeBucketKey("TSLA/1Min/OHLCV")] = tick
+	_, err = csm.ToWideColumnSeries("Symbol")
+	c.Assert(err, ErrorMatches, "Symbol TSLA has more than one row at epoch 5")
+}
+
+func (s *TestSuite) TestWriteCSV(c *C) {
+	tz := utils.InstanceConfig.Timezone
+	utils.InstanceConfig.Timezone = time.UTC
+	defer func() { utils.InstanceConfig.Timezone = tz }()
+
+	aapl := NewColumnSeries()
+	aapl.AddColumn("Epoch", []int64{0, 60})
+	aapl.AddColumn("Close", []float32{10.5, 11})
+	aapl.AddColumn("Volume", []int32{100, 110})
+	msft := NewColumnSeries()
+	msft.AddColumn("Epoch", []int64{0})
+	msft.AddColumn("Close", []float32{20})
+	msft.AddColumn("Volume", []int32{200})
+
+	csm := NewColumnSeriesMap()
+	csm[*NewTimeBucketKey("MSFT/1Min/OHLCV")] = msft
+	csm[*NewTimeBucketKey("AAPL/1Min/OHLCV")] = aapl
+
+	buf := new(bytes.Buffer)
+	c.Assert(csm.WriteCSV(buf, ""), IsNil)
+	c.Assert(buf.String(), Equals, "Key,Epoch,Close,Volume\n"+
+		"AAPL/1Min/OHLCV,0,10.5,100\n"+
+		"AAPL/1Min/OHLCV,60,11,110\n"+
+		"MSFT/1Min/OHLCV,0,20,200\n")
+
+	buf.Reset()
+	c.Assert(csm.WriteCSV(buf, "2006-01-02 15:04"), IsNil)
+	c.Assert(strings.Split(buf.String(), "\n")[2], Equals, "AAPL/1Min/OHLCV,1970-01-01 00:01,11,110")
+
+	c.Assert(FormatEpoch(60, 500, "rfc3339"), Equals, "1970-01-01T00:01:00.0000005Z")
+
+	msft.Remove("Volume")
+	c.Assert(csm.WriteCSV(new(bytes.Buffer), ""), NotNil)
+}
+
 func (s *TestSuite) TestSliceByEpoch(c *C) {
 	cs := makeTestCS()
 
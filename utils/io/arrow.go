@@ -0,0 +1,313 @@
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ArrowKeyMetadata is the schema metadata of the record batches of a
+// ColumnSeriesMap holding the TimeBucketKey of their column series
+const ArrowKeyMetadata = "marketstore.key"
+
+// ArrowField is a field of the schema of an ArrowRecordBatch, its type given
+// by its format string of the Arrow C data interface, such as "l" for int64,
+// "tss:UTC" for the Epoch seconds or "d:19,2" for a decimal128 of scale 2
+type ArrowField struct {
+	Name     string
+	Format   string
+	Nullable bool
+}
+
+// ArrowArray is a column of an ArrowRecordBatch in the Arrow columnar format,
+// its buffers being the validity bitmap, nil without nulls, then the int32
+// offsets of a utf8 array, then the values
+type ArrowArray struct {
+	Length    int
+	NullCount int
+	Buffers   [][]byte
+}
+
+// ArrowRecordBatch is a column series in the Arrow columnar format, to be
+// shared with the Arrow libraries and IPC writers.  The values buffers of the
+// fixed width numeric columns are those of the column series, not copies, so
+// that neither may be modified while the other is in use.
+type ArrowRecordBatch struct {
+	Fields   []ArrowField
+	Columns  []ArrowArray
+	Metadata map[string]string
+	NumRows  int
+}
+
+// arrowFormats are the Arrow formats of the fixed width numeric types, whose
+// values buffers are the memory of their columns
+var arrowFormats = map[EnumElementType]string{
+	FLOAT32: "f",
+	FLOAT64: "g",
+	INT16:   "s",
+	INT32:   "i",
+	INT64:   "l",
+	BYTE:    "C",
+	UINT8:   "C",
+	UINT16:  "S",
+	UINT32:  "I",
+	UINT64:  "L",
+}
+
+// arrowEpochFormat is the format of the Epoch column, a timestamp in seconds
+const arrowEpochFormat = "tss:UTC"
+
+// ColumnSeriesToArrow returns the record batch of the column series, its
+// byte columns being uint8 arrays, its bool and bit columns bool arrays, its
+// string columns utf8 arrays and its decimals decimal128 arrays
+func ColumnSeriesToArrow(cs *ColumnSeries) (*ArrowRecordBatch, error) {
+	rb := &ArrowRecordBatch{
+		Metadata: map[string]string{},
+		NumRows:  cs.Len(),
+	}
+	for _, shape := range cs.GetDataShapes() {
+		col := cs.GetByName(shape.Name)
+		valid := cs.GetValidity(shape.Name)
+		field := ArrowField{Name: shape.Name, Nullable: valid != nil}
+		var values [][]byte
+		switch {
+		case shape.Name == "Epoch" && shape.Type == INT64:
+			field.Format = arrowEpochFormat
+			values = [][]byte{CastToByteSlice(col)}
+		case shape.Type == DECIMAL:
+			scale, _ := cs.GetScale(shape.Name)
+			field.Format = fmt.Sprintf("d:19,%d", scale)
+			values = [][]byte{toDecimal128(col.([]int64))}
+		case shape.Type == BOOL || shape.Type == BIT:
+			field.Format = "b"
+			values = [][]byte{toBitmap(col.([]bool))}
+		case shape.Type.IsString():
+			field.Format = "u"
+			values = toUTF8(col.([]string))
+		default:
+			format, ok := arrowFormats[shape.Type]
+			if !ok {
+				return nil, fmt.Errorf("no Arrow type for column %s", shape.String())
+			}
+			field.Format = format
+			values = [][]byte{CastToByteSlice(col)}
+		}
+		array := ArrowArray{Length: rb.NumRows}
+		if valid != nil {
+			for _, v := range valid {
+				if !v {
+					array.NullCount++
+				}
+			}
+			array.Buffers = append(array.Buffers, toBitmap(valid))
+		} else {
+			array.Buffers = append(array.Buffers, nil)
+		}
+		array.Buffers = append(array.Buffers, values...)
+		rb.Fields = append(rb.Fields, field)
+		rb.Columns = append(rb.Columns, array)
+	}
+	return rb, nil
+}
+
+// ArrowToColumnSeries returns the column series of the record batch, whose
+// fixed width numeric columns are its values buffers, not copies
+func ArrowToColumnSeries(rb *ArrowRecordBatch) (*ColumnSeries, error) {
+	if len(rb.Fields) != len(rb.Columns) {
+		return nil, fmt.Errorf("%d fields for %d columns", len(rb.Fields), len(rb.Columns))
+	}
+	cs := NewColumnSeries()
+	for i, field := range rb.Fields {
+		array := rb.Columns[i]
+		if array.Length != rb.NumRows || len(array.Buffers) < 2 {
+			return nil, fmt.Errorf("column %s is not an array of %d rows", field.Name, rb.NumRows)
+		}
+		col, scale, err := fromArrow(field.Format, array)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read column %s (%v)", field.Name, err)
+		}
+		cs.AddColumn(field.Name, col)
+		if scale >= 0 {
+			cs.SetScale(field.Name, scale)
+		}
+		if array.Buffers[0] != nil {
+			if len(array.Buffers[0])*8 < array.Length {
+				return nil, fmt.Errorf("short validity bitmap of column %s", field.Name)
+			}
+			cs.SetValidity(field.Name, fromBitmap(array.Buffers[0], array.Length))
+		}
+	}
+	return cs, nil
+}
+
+// fromArrow returns the column of the array of the Arrow format, and the
+// scale of its decimals or -1
+func fromArrow(format string, array ArrowArray) (col interface{}, scale int, err error) {
+	values := array.Buffers[len(array.Buffers)-1]
+	switch {
+	case format == "b":
+		if len(values)*8 < array.Length {
+			return nil, -1, fmt.Errorf("short values buffer")
+		}
+		return fromBitmap(values, array.Length), -1, nil
+	case format == "u":
+		if len(array.Buffers) != 3 {
+			return nil, -1, fmt.Errorf("no offsets buffer")
+		}
+		col, err := fromUTF8(array.Buffers[1], values, array.Length)
+		return col, -1, err
+	case strings.HasPrefix(format, "d:"):
+		if scale, err = decimal128Scale(format); err != nil {
+			return nil, -1, err
+		}
+		if len(values) < 16*array.Length {
+			return nil, -1, fmt.Errorf("short values buffer")
+		}
+		col, err := fromDecimal128(values[:16*array.Length])
+		return col, scale, err
+	case strings.HasPrefix(format, "tss:"):
+		format = arrowFormats[INT64]
+	}
+	for _, typ := range []EnumElementType{FLOAT32, FLOAT64, INT16, INT32, INT64, UINT8, UINT16, UINT32, UINT64} {
+		if arrowFormats[typ] != format {
+			continue
+		}
+		if len(values) < typ.Size()*array.Length {
+			return nil, -1, fmt.Errorf("short values buffer")
+		}
+		return SwapSliceByte(values[:typ.Size()*array.Length], reflect.Zero(typ.TypeOf()).Interface()), -1, nil
+	}
+	return nil, -1, fmt.Errorf("unsupported Arrow format %q", format)
+}
+
+// ToArrow returns the record batches of the column series of the map, in the
+// order of their keys, held by their ArrowKeyMetadata
+func (csm ColumnSeriesMap) ToArrow() ([]*ArrowRecordBatch, error) {
+	keys := make([]TimeBucketKey, 0, len(csm))
+	for key := range csm {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	batches := make([]*ArrowRecordBatch, 0, len(keys))
+	for _, key := range keys {
+		rb, err := ColumnSeriesToArrow(csm[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s (%v)", key.String(), err)
+		}
+		rb.Metadata[ArrowKeyMetadata] = key.String()
+		batches = append(batches, rb)
+	}
+	return batches, nil
+}
+
+// ArrowToColumnSeriesMap returns the map of the column series of the record
+// batches by their ArrowKeyMetadata, the batches of the same key being
+// concatenated in their order
+func ArrowToColumnSeriesMap(batches []*ArrowRecordBatch) (ColumnSeriesMap, error) {
+	csm := NewColumnSeriesMap()
+	for _, rb := range batches {
+		keyString, ok := rb.Metadata[ArrowKeyMetadata]
+		if !ok {
+			return nil, fmt.Errorf("no %s metadata in the record batch", ArrowKeyMetadata)
+		}
+		key := NewTimeBucketKeyFromString(keyString)
+		if key == nil {
+			return nil, fmt.Errorf("bad key %q in the record batch", keyString)
+		}
+		cs, err := ArrowToColumnSeries(rb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s (%v)", keyString, err)
+		}
+		if previous, ok := csm[*key]; ok {
+			if cs, err = ColumnSeriesConcat(previous, cs); err != nil {
+				return nil, fmt.Errorf("failed to concatenate %s (%v)", keyString, err)
+			}
+		}
+		csm[*key] = cs
+	}
+	return csm, nil
+}
+
+// toBitmap returns the bitmap of the values, least significant bit first
+func toBitmap(values []bool) []byte {
+	bitmap := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return bitmap
+}
+
+func fromBitmap(bitmap []byte, length int) []bool {
+	values := make([]bool, length)
+	for i := range values {
+		values[i] = bitmap[i/8]&(1<<uint(i%8)) != 0
+	}
+	return values
+}
+
+// toUTF8 returns the int32 offsets and the data buffers of the strings
+func toUTF8(values []string) [][]byte {
+	offsets := make([]int32, len(values)+1)
+	var data []byte
+	for i, s := range values {
+		data = append(data, s...)
+		offsets[i+1] = int32(len(data))
+	}
+	return [][]byte{CastToByteSlice(offsets), data}
+}
+
+func fromUTF8(offsetBytes, data []byte, length int) ([]string, error) {
+	if len(offsetBytes) < 4*(length+1) {
+		return nil, fmt.Errorf("short offsets buffer")
+	}
+	offsets := SwapSliceByte(offsetBytes[:4*(length+1)], int32(0)).([]int32)
+	values := make([]string, length)
+	for i := range values {
+		start, end := offsets[i], offsets[i+1]
+		if start < 0 || end < start || int(end) > len(data) {
+			return nil, fmt.Errorf("bad offsets %d to %d", start, end)
+		}
+		values[i] = string(data[start:end])
+	}
+	return values, nil
+}
+
+// toDecimal128 returns the little endian decimal128 values of the decimals
+func toDecimal128(values []int64) []byte {
+	buf := make([]byte, 16*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(buf[16*i:], uint64(v))
+		binary.LittleEndian.PutUint64(buf[16*i+8:], uint64(v>>63))
+	}
+	return buf
+}
+
+func fromDecimal128(buf []byte) ([]int64, error) {
+	values := make([]int64, len(buf)/16)
+	for i := range values {
+		v := int64(binary.LittleEndian.Uint64(buf[16*i:]))
+		if int64(binary.LittleEndian.Uint64(buf[16*i+8:])) != v>>63 {
+			return nil, fmt.Errorf("decimal out of the int64 range at row %d", i)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// decimal128Scale returns the scale of the "d:precision,scale[,128]" format
+func decimal128Scale(format string) (int, error) {
+	params := strings.Split(strings.TrimPrefix(format, "d:"), ",")
+	if len(params) < 2 || len(params) > 3 || (len(params) == 3 && params[2] != "128") {
+		return 0, fmt.Errorf("unsupported Arrow format %q", format)
+	}
+	scale, err := strconv.Atoi(params[1])
+	if err != nil || ValidScale(scale) != nil {
+		return 0, fmt.Errorf("bad decimal scale in Arrow format %q", format)
+	}
+	return scale, nil
+}
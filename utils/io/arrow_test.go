@@ -0,0 +1,80 @@
+package io
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ArrowTestSuite struct{}
+
+var _ = Suite(&ArrowTestSuite{})
+
+func (s *ArrowTestSuite) TestRoundTrip(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{60, 120, 180})
+	cs.AddColumn("Price", []int64{12345, -5, 7})
+	cs.SetScale("Price", 2)
+	cs.AddColumn("Size", []float32{1, 2, 3})
+	cs.SetValidity("Size", []bool{true, false, true})
+	cs.AddColumn("Exchange", []string{"Q", "", "NYSE"})
+	cs.AddColumn("Odd", []bool{false, true, false})
+
+	rb, err := ColumnSeriesToArrow(cs)
+	c.Assert(err, IsNil)
+	c.Check(rb.NumRows, Equals, 3)
+	formats := []string{}
+	for _, field := range rb.Fields {
+		formats = append(formats, field.Format)
+	}
+	c.Check(formats, DeepEquals, []string{"tss:UTC", "d:19,2", "f", "u", "b"})
+	c.Check(rb.Fields[2].Nullable, Equals, true)
+	c.Check(rb.Columns[2].NullCount, Equals, 1)
+	c.Check(rb.Columns[2].Buffers[0], DeepEquals, []byte{5})
+	c.Check(rb.Columns[3].Buffers[2], DeepEquals, []byte("QNYSE"))
+
+	// the numeric columns are not copied
+	rb.Columns[0].Buffers[1][0] = 61
+	c.Check(cs.GetEpoch()[0], Equals, int64(61))
+
+	out, err := ArrowToColumnSeries(rb)
+	c.Assert(err, IsNil)
+	c.Check(out.GetColumnNames(), DeepEquals, cs.GetColumnNames())
+	c.Check(out.GetEpoch(), DeepEquals, []int64{61, 120, 180})
+	c.Check(out.GetByName("Price"), DeepEquals, []int64{12345, -5, 7})
+	scale, ok := out.GetScale("Price")
+	c.Check(ok, Equals, true)
+	c.Check(scale, Equals, 2)
+	c.Check(out.GetValidity("Size"), DeepEquals, []bool{true, false, true})
+	c.Check(out.GetByName("Exchange"), DeepEquals, []string{"Q", "", "NYSE"})
+	c.Check(out.GetByName("Odd"), DeepEquals, []bool{false, true, false})
+
+	rb.Fields[1].Format = "d:19,2,256"
+	_, err = ArrowToColumnSeries(rb)
+	c.Check(err, NotNil)
+}
+
+func (s *ArrowTestSuite) TestColumnSeriesMap(c *C) {
+	newSeries := func(epochs ...int64) *ColumnSeries {
+		cs := NewColumnSeries()
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Close", make([]float64, len(epochs)))
+		return cs
+	}
+	csm := NewColumnSeriesMap()
+	csm.AddColumnSeries(*NewTimeBucketKey("MSFT/1Min/OHLCV"), newSeries(60))
+	csm.AddColumnSeries(*NewTimeBucketKey("AAPL/1Min/OHLCV"), newSeries(60, 120))
+
+	batches, err := csm.ToArrow()
+	c.Assert(err, IsNil)
+	c.Assert(batches, HasLen, 2)
+	c.Check(batches[0].Metadata[ArrowKeyMetadata], Equals, "AAPL/1Min/OHLCV:Symbol/Timeframe/AttributeGroup")
+
+	// the batches of the same key are concatenated
+	out, err := ArrowToColumnSeriesMap(append(batches, batches[0]))
+	c.Assert(err, IsNil)
+	c.Check(out, HasLen, 2)
+	c.Check(out[*NewTimeBucketKey("AAPL/1Min/OHLCV")].GetEpoch(), DeepEquals, []int64{60, 120, 60, 120})
+
+	delete(batches[1].Metadata, ArrowKeyMetadata)
+	_, err = ArrowToColumnSeriesMap(batches)
+	c.Check(err, NotNil)
+}
@@ -2,7 +2,9 @@ package io
 
 import (
 	"fmt"
+	"github.com/alpacahq/marketstore/utils"
 	"github.com/alpacahq/marketstore/utils/log"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
@@ -34,6 +36,13 @@ type ColumnSeries struct {
 	orderedNames     []string
 	candleAttributes *CandleAttributes
 	nameIncrement    map[string]int
+	// timezone of the times of the records, that of the system if nil
+	location *time.Location
+	// validity of the values of the columns with missing values, false for
+	// a missing one, the columns without an entry having none missing
+	valid map[string][]bool
+	// decimal places of the DECIMAL columns, see decimal.go
+	scales map[string]int
 }
 
 func NewColumnSeries() *ColumnSeries {
@@ -52,6 +61,10 @@ func (cs *ColumnSeries) GetDataShapes() (ds []DataShape) {
 	var et []EnumElementType
 	for _, name := range cs.orderedNames {
 		// fmt.Printf("name %v, type %v\n", name, GetElementType(cs.columns[name]))
+		if _, ok := cs.scales[name]; ok {
+			et = append(et, DECIMAL)
+			continue
+		}
 		et = append(et, GetElementType(cs.columns[name]))
 	}
 	return NewDataShapeVector(cs.orderedNames, et)
@@ -71,17 +84,85 @@ func (cs *ColumnSeries) GetTime() []time.Time {
 	nsi := cs.GetColumn("Nanoseconds")
 	if nsi == nil {
 		for i, secs := range ep {
-			ts[i] = ToSystemTimezone(time.Unix(secs, 0))
+			ts[i] = time.Unix(secs, 0).In(cs.GetLocation())
 		}
 	} else {
 		ns := nsi.([]int32)
 		for i, secs := range ep {
-			ts[i] = ToSystemTimezone(time.Unix(secs, int64(ns[i])))
+			ts[i] = time.Unix(secs, int64(ns[i])).In(cs.GetLocation())
 		}
 	}
 	return ts
 }
 
+// GetLocation returns the timezone of the times of the records, by which
+// they are grouped into days, the system timezone unless set
+func (cs *ColumnSeries) GetLocation() *time.Location {
+	if cs.location == nil {
+		return utils.InstanceConfig.Timezone
+	}
+	return cs.location
+}
+
+// SetLocation sets the timezone of the times of the records, such as that of
+// their bucket
+func (cs *ColumnSeries) SetLocation(loc *time.Location) {
+	cs.location = loc
+}
+
+// GetValidity returns the validity of the values of the column, false for
+// a missing one, or nil if none is missing
+func (cs *ColumnSeries) GetValidity(name string) []bool {
+	return cs.valid[name]
+}
+
+// SetValidity sets the validity of the values of the column, false for a
+// missing one, nil for none
+func (cs *ColumnSeries) SetValidity(name string, valid []bool) {
+	if valid == nil {
+		delete(cs.valid, name)
+		return
+	}
+	if cs.valid == nil {
+		cs.valid = map[string][]bool{}
+	}
+	cs.valid[name] = valid
+}
+
+// IsValid returns whether the value at the index of the column is present
+func (cs *ColumnSeries) IsValid(name string, index int) bool {
+	valid, ok := cs.valid[name]
+	return !ok || valid[index]
+}
+
+// HasValidity returns whether a column has missing values
+func (cs *ColumnSeries) HasValidity() bool {
+	return len(cs.valid) > 0
+}
+
+// GetScale returns the number of decimal places of the int64 values of the
+// DECIMAL column, and whether the column is one
+func (cs *ColumnSeries) GetScale(name string) (int, bool) {
+	scale, ok := cs.scales[name]
+	return scale, ok
+}
+
+// SetScale makes the []int64 column a DECIMAL column of values with the
+// number of decimal places
+func (cs *ColumnSeries) SetScale(name string, scale int) {
+	if cs.scales == nil {
+		cs.scales = map[string]int{}
+	}
+	cs.scales[name] = scale
+}
+
+// copyScales sets the scales of the DECIMAL columns of the column series
+func (cs *ColumnSeries) copyScales(from *ColumnSeries) {
+	for name, scale := range from.scales {
+		cs.SetScale(name, scale)
+	}
+}
+
 func (cs *ColumnSeries) GetColumnNames() (columnNames []string) {
 	return cs.orderedNames
 }
@@ -149,17 +230,30 @@ func (cs *ColumnSeries) Rename(newName, oldName string) error {
 		}
 	}
 
+	valid := cs.GetValidity(oldName)
+	scale, decimal := cs.GetScale(oldName)
 	cs.AddColumn(newName, oldColumn)
 	cs.Remove(oldName)
+	cs.SetValidity(newName, valid)
+	if decimal {
+		cs.SetScale(newName, scale)
+	}
 	cs.orderedNames = newNames
 	return nil
 }
 
+// Replace replaces the values of the column, which keep their validity, and
+// their scale if they are the int64 values of a DECIMAL column
+// Replace replaces the values of the column in its place, the layout of the
+// records written from the column series following the order of its columns
 func (cs *ColumnSeries) Replace(targetName string, col interface{}) error {
-	if err := cs.Remove(targetName); err != nil {
-		return err
+	if !cs.Exists(targetName) {
+		return fmt.Errorf("Error: Source column named %s does not exist\n", targetName)
+	}
+	cs.columns[targetName] = col
+	if _, ok := col.([]int64); !ok {
+		delete(cs.scales, targetName)
 	}
-	cs.AddColumn(targetName, col)
 	return nil
 }
 func (cs *ColumnSeries) Remove(targetName string) error {
@@ -174,11 +268,14 @@ func (cs *ColumnSeries) Remove(targetName string) error {
 	}
 	cs.orderedNames = newNames
 	delete(cs.columns, targetName)
+	delete(cs.valid, targetName)
+	delete(cs.scales, targetName)
 	return nil
 }
 func (cs *ColumnSeries) Project(keepList []string) error {
 	newCols := make(map[string]interface{})
 	var newNames []string
+	var newValid map[string][]bool
 	for _, name := range keepList {
 		col := cs.GetByName(name)
 		if col == nil {
@@ -186,9 +283,23 @@ func (cs *ColumnSeries) Project(keepList []string) error {
 		}
 		newCols[name] = col
 		newNames = append(newNames, name)
+		if valid, ok := cs.valid[name]; ok {
+			if newValid == nil {
+				newValid = map[string][]bool{}
+			}
+			newValid[name] = valid
+		}
 	}
+	scales := cs.scales
 	cs.columns = newCols
 	cs.orderedNames = newNames
+	cs.valid = newValid
+	cs.scales = nil
+	for _, name := range newNames {
+		if scale, ok := scales[name]; ok {
+			cs.SetScale(name, scale)
+		}
+	}
 	return nil
 }
 
@@ -202,6 +313,10 @@ func (cs *ColumnSeries) RestrictLength(newLen int, direction DirectionEnum) (err
 			return err
 		}
 	}
+	for key, valid := range cs.valid {
+		v, _ := DownSizeSlice(valid, newLen, direction)
+		cs.valid[key] = v.([]bool)
+	}
 	return nil
 }
 
@@ -251,6 +366,7 @@ func (cs *ColumnSeries) ApplyTimeQual(tq func(epoch int64) bool) *ColumnSeries {
 		candleAttributes: cs.candleAttributes,
 		nameIncrement:    cs.nameIncrement,
 		columns:          map[string]interface{}{},
+		location:         cs.location,
 	}
 
 	for i, epoch := range cs.GetEpoch() {
@@ -270,6 +386,15 @@ func (cs *ColumnSeries) ApplyTimeQual(tq func(epoch int64) bool) *ColumnSeries {
 		out.columns[name] = slc.Interface()
 	}
 
+	for name, valid := range cs.valid {
+		outValid := make([]bool, len(indexes))
+		for i, index := range indexes {
+			outValid[i] = valid[index]
+		}
+		out.SetValidity(name, outValid)
+	}
+	out.copyScales(cs)
+
 	return out
 }
 
@@ -284,11 +409,16 @@ func SliceColumnSeriesByEpoch(cs ColumnSeries, start, end *int64) (slc ColumnSer
 		candleAttributes: cs.candleAttributes,
 		nameIncrement:    cs.nameIncrement,
 		columns:          map[string]interface{}{},
+		location:         cs.location,
 	}
 
 	for name, col := range cs.columns {
 		slc.columns[name] = col
 	}
+	for name, valid := range cs.valid {
+		slc.SetValidity(name, valid)
+	}
+	slc.copyScales(&cs)
 
 	epochs := slc.GetEpoch()
 
@@ -333,9 +463,17 @@ func max(x, y int) int {
 // epochs are duplicated.
 func ColumnSeriesUnion(left, right *ColumnSeries) *ColumnSeries {
 	out := NewColumnSeries()
+	if rescaled, err := right.withScales(left.scales); err != nil {
+		log.Error("failed to rescale the decimals of the union (%v)", err)
+	} else {
+		right = rescaled
+	}
+	out.copyScales(right)
+	out.copyScales(left)
 
 	out.candleAttributes = left.candleAttributes
 	out.orderedNames = left.orderedNames
+	out.location = left.location
 	out.nameIncrement = make(map[string]int, len(left.nameIncrement))
 	for k, v := range left.nameIncrement {
 		out.nameIncrement[k] = v
@@ -384,9 +522,185 @@ func ColumnSeriesUnion(left, right *ColumnSeries) *ColumnSeries {
 		}
 	}
 
+	for name := range unionValidity(left, right) {
+		valid := make([]bool, len(entries))
+		for i, entry := range entries {
+			valid[i] = entry.refSeries.IsValid(name, entry.index)
+		}
+		out.SetValidity(name, valid)
+	}
+
 	return out
 }
 
+// withScales returns the column series with its DECIMAL columns rescaled to
+// the scales, itself if none needs to be
+func (cs *ColumnSeries) withScales(scales map[string]int) (*ColumnSeries, error) {
+	out := cs
+	for name, scale := range cs.scales {
+		to, ok := scales[name]
+		if !ok || to == scale {
+			continue
+		}
+		values, err := Rescale(cs.columns[name].([]int64), scale, to)
+		if err != nil {
+			return nil, err
+		}
+		if out == cs {
+			out = &ColumnSeries{
+				columns:          map[string]interface{}{},
+				orderedNames:     cs.orderedNames,
+				candleAttributes: cs.candleAttributes,
+				nameIncrement:    cs.nameIncrement,
+				location:         cs.location,
+				valid:            cs.valid,
+			}
+			for n, col := range cs.columns {
+				out.columns[n] = col
+			}
+			out.copyScales(cs)
+		}
+		out.columns[name] = values
+		out.scales[name] = to
+	}
+	return out, nil
+}
+
+// unionValidity returns the names of the columns with missing values in
+// either column series
+func unionValidity(left, right *ColumnSeries) map[string]bool {
+	names := map[string]bool{}
+	for _, cs := range []*ColumnSeries{left, right} {
+		for name := range cs.valid {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// validityOf returns the validity of the values of the column, all true if
+// none is missing
+func (cs *ColumnSeries) validityOf(name string) []bool {
+	if valid, ok := cs.valid[name]; ok {
+		return valid
+	}
+	valid := make([]bool, cs.Len())
+	for i := range valid {
+		valid[i] = true
+	}
+	return valid
+}
+
+// ColumnSeriesConcat appends the rows of right after the rows of left
+// and returns the result as a new column series. Both inputs must have
+// the same column names and element types. Unlike ColumnSeriesUnion,
+// duplicated epochs are retained and the input ordering is preserved.
+func ColumnSeriesConcat(left, right *ColumnSeries) (*ColumnSeries, error) {
+	leftDSV, rightDSV := left.GetDataShapes(), right.GetDataShapes()
+	if len(leftDSV) != len(rightDSV) {
+		return nil, fmt.Errorf("column count mismatch: %d vs %d", len(leftDSV), len(rightDSV))
+	}
+	for i := range leftDSV {
+		if !leftDSV[i].Equal(rightDSV[i]) {
+			return nil, fmt.Errorf("column mismatch at position %d: %s vs %s",
+				i, leftDSV[i].String(), rightDSV[i].String())
+		}
+	}
+
+	right, err := right.withScales(left.scales)
+	if err != nil {
+		return nil, err
+	}
+
+	out := NewColumnSeries()
+	out.candleAttributes = left.candleAttributes
+	out.location = left.location
+	out.copyScales(left)
+	for _, name := range left.orderedNames {
+		lv := reflect.ValueOf(left.columns[name])
+		rv := reflect.ValueOf(right.columns[name])
+		slc := reflect.MakeSlice(lv.Type(), 0, lv.Len()+rv.Len())
+		slc = reflect.AppendSlice(slc, lv)
+		slc = reflect.AppendSlice(slc, rv)
+		out.AddColumn(name, slc.Interface())
+	}
+	for name := range unionValidity(left, right) {
+		valid := append([]bool{}, left.validityOf(name)...)
+		out.SetValidity(name, append(valid, right.validityOf(name)...))
+	}
+	return out, nil
+}
+
+// MergePolicy selects the row kept by ColumnSeriesMerge for an epoch in both
+// column series
+type MergePolicy int
+
+const (
+	// PreferLeft keeps the row of the left column series
+	PreferLeft MergePolicy = iota
+	// PreferRight keeps the row of the right column series, as
+	// ColumnSeriesUnion does
+	PreferRight
+	// ErrorOnConflict fails the merge
+	ErrorOnConflict
+)
+
+// ColumnSeriesMerge merges the rows of two column series with the same
+// columns by Epoch into a new column series, sorted by Epoch with a single
+// row per epoch, the row of an epoch in both being chosen by the policy.
+// The decimals of right are rescaled to the scales of left.
+func ColumnSeriesMerge(left, right *ColumnSeries, policy MergePolicy) (*ColumnSeries, error) {
+	if err := sameColumns(left, right); err != nil {
+		return nil, err
+	}
+	if left.GetEpoch() == nil {
+		return nil, fmt.Errorf("no Epoch column to merge by")
+	}
+	right, err := right.withScales(left.scales)
+	if err != nil {
+		return nil, err
+	}
+	switch policy {
+	case PreferRight:
+	case PreferLeft, ErrorOnConflict:
+		inLeft := map[int64]bool{}
+		for _, epoch := range left.GetEpoch() {
+			inLeft[epoch] = true
+		}
+		if policy == ErrorOnConflict {
+			for _, epoch := range right.GetEpoch() {
+				if inLeft[epoch] {
+					return nil, fmt.Errorf("conflicting rows at epoch %d", epoch)
+				}
+			}
+			break
+		}
+		right = right.ApplyTimeQual(func(epoch int64) bool { return !inLeft[epoch] })
+	default:
+		return nil, fmt.Errorf("unknown merge policy %d", policy)
+	}
+	return ColumnSeriesUnion(left, right), nil
+}
+
+// sameColumns returns an error unless the column series have the same column
+// names and element types, in any order
+func sameColumns(left, right *ColumnSeries) error {
+	types := map[string]EnumElementType{}
+	for _, shape := range left.GetDataShapes() {
+		types[shape.Name] = shape.Type
+	}
+	rightDSV := right.GetDataShapes()
+	if len(rightDSV) != len(types) {
+		return fmt.Errorf("column count mismatch: %d vs %d", len(types), len(rightDSV))
+	}
+	for _, shape := range rightDSV {
+		if typ, ok := types[shape.Name]; !ok || typ != shape.Type {
+			return fmt.Errorf("column mismatch: %s", shape.String())
+		}
+	}
+	return nil
+}
+
 type ColumnSeriesMap map[TimeBucketKey]*ColumnSeries
 
 func NewColumnSeriesMap() ColumnSeriesMap {
@@ -407,8 +721,33 @@ func (csm ColumnSeriesMap) GetMetadataKeys() (keys []TimeBucketKey) {
 func (csm ColumnSeriesMap) AddColumnSeries(key TimeBucketKey, cs *ColumnSeries) {
 	for _, name := range cs.orderedNames {
 		csm.AddColumn(key, name, cs.columns[name])
+		if valid, ok := cs.valid[name]; ok {
+			csm[key].SetValidity(name, valid)
+		}
+		if scale, ok := cs.scales[name]; ok {
+			csm[key].SetScale(name, scale)
+		}
 	}
 }
+
+// Merge merges the column series of other into those of the same key of the
+// map by ColumnSeriesMerge, other being the right one, and adds the others
+func (csm ColumnSeriesMap) Merge(other ColumnSeriesMap, policy MergePolicy) error {
+	for key, cs := range other {
+		existing, ok := csm[key]
+		if !ok {
+			csm[key] = cs
+			continue
+		}
+		merged, err := ColumnSeriesMerge(existing, cs, policy)
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %v", key.String(), err)
+		}
+		csm[key] = merged
+	}
+	return nil
+}
+
 func (csm ColumnSeriesMap) AddColumn(key TimeBucketKey, name string, columnData interface{}) {
 	if _, ok := csm[key]; !ok {
 		csm[key] = NewColumnSeries()
@@ -433,17 +772,123 @@ func (csm *ColumnSeriesMap) FilterColumns(columns []string) {
 	// index columns (=Epoch and Nanoseconds) are always necessary and Epoch should be the first column
 	keepColumns := []string{"Epoch"}
 	keepColumns = append(keepColumns, columns...)
-	keepColumns = append(keepColumns, "Nanoseconds")
 
 	for _, cs := range *csm {
 		// filter out unnecessary columns
-		err := cs.Project(keepColumns)
+		keep := keepColumns
+		if cs.Exists("Nanoseconds") {
+			keep = append(keep[:len(keep):len(keep)], "Nanoseconds")
+		}
+		err := cs.Project(keep)
 		if err != nil {
-			log.Error("failed to filter out columns", keepColumns)
+			log.Error("failed to filter out columns", keep)
 		}
 	}
 }
 
+/*
+ToWideColumnSeries pivots the map into a single column series indexed by the
+union of the Epoch values of all members. Each column is named
+<column>_<item>, where item is the key's value in the given category, e.g.
+Close_AAPL for the "Symbol" category. Rows where a member has no value are
+missing, and filled with NaN for floating point columns and zero otherwise.
+A member with more than one row at the same Epoch, such as the ticks of a
+variable length bucket, can not be pivoted and returns an error.
+*/
+func (csm ColumnSeriesMap) ToWideColumnSeries(category string) (*ColumnSeries, error) {
+	type member struct {
+		item string
+		cs   *ColumnSeries
+	}
+	members := make([]member, 0, len(csm))
+	seen := make(map[string]bool, len(csm))
+	for key, cs := range csm {
+		item := key.GetItemInCategory(category)
+		if item == "" {
+			return nil, fmt.Errorf("key %s has no %s", key.String(), category)
+		}
+		if seen[item] {
+			return nil, fmt.Errorf("more than one key with %s %s", category, item)
+		}
+		seen[item] = true
+		members = append(members, member{item, cs})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].item < members[j].item })
+
+	/*
+		The output index is the sorted union of all indexes
+	*/
+	rowIndex := make(map[int64]int)
+	var epochs []int64
+	for _, m := range members {
+		memberEpochs := make(map[int64]bool, m.cs.Len())
+		for _, epoch := range m.cs.GetEpoch() {
+			if memberEpochs[epoch] {
+				return nil, fmt.Errorf("%s %s has more than one row at epoch %d", category, m.item, epoch)
+			}
+			memberEpochs[epoch] = true
+			if _, ok := rowIndex[epoch]; !ok {
+				rowIndex[epoch] = 0
+				epochs = append(epochs, epoch)
+			}
+		}
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	for i, epoch := range epochs {
+		rowIndex[epoch] = i
+	}
+
+	/*
+		Output columns are grouped by column name, then by item
+	*/
+	var names []string
+	nameSeen := map[string]bool{"Epoch": true}
+	for _, m := range members {
+		for _, name := range m.cs.GetColumnNames() {
+			if !nameSeen[name] {
+				nameSeen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	wide := NewColumnSeries()
+	if epochs == nil {
+		epochs = []int64{}
+	}
+	wide.AddColumn("Epoch", epochs)
+	for _, name := range names {
+		for _, m := range members {
+			col := m.cs.GetByName(name)
+			if col == nil {
+				continue
+			}
+			src := reflect.ValueOf(col)
+			dst := reflect.MakeSlice(src.Type(), len(epochs), len(epochs))
+			switch src.Type().Elem().Kind() {
+			case reflect.Float32, reflect.Float64:
+				nan := reflect.ValueOf(math.NaN()).Convert(src.Type().Elem())
+				for i := 0; i < dst.Len(); i++ {
+					dst.Index(i).Set(nan)
+				}
+			}
+			valid := make([]bool, len(epochs))
+			for i, epoch := range m.cs.GetEpoch() {
+				dst.Index(rowIndex[epoch]).Set(src.Index(i))
+				valid[rowIndex[epoch]] = m.cs.IsValid(name, i)
+			}
+			wideName := wide.AddColumn(name+"_"+m.item, dst.Interface())
+			if m.cs.HasValidity() || m.cs.Len() < len(epochs) {
+				wide.SetValidity(wideName, valid)
+			}
+			if scale, ok := m.cs.GetScale(name); ok {
+				wide.SetScale(wideName, scale)
+			}
+		}
+	}
+	return wide, nil
+}
+
 func GetNamesFromDSV(dataShapes []DataShape) (out []string) {
 	for _, shape := range dataShapes {
 		out = append(out, shape.Name)
@@ -556,7 +1001,13 @@ func SerializeColumnsToRows(cs *ColumnSeries, dataShapes []DataShape, align64 bo
 		}
 		columnData := cs.columns[colName]
 		columnList = append(columnList, columnData)
-		colInBytes := SwapSliceData(columnData, byte(0)).([]byte)
+		var colInBytes []byte
+		if strs, ok := columnData.([]string); ok {
+			// the dictionary encoded columns are given as their codes
+			colInBytes = EncodeFixedStrings(strs, shape.Type.Size())
+		} else {
+			colInBytes = SwapSliceData(columnData, byte(0)).([]byte)
+		}
 		colInBytesList = append(colInBytesList, colInBytes)
 	}
 	if !shapesContainsEpoch {
@@ -564,35 +1015,34 @@ func SerializeColumnsToRows(cs *ColumnSeries, dataShapes []DataShape, align64 bo
 	}
 
 	/*
-		Calculate the resulting recordLen
+		Calculate the layout of the records, the Epoch first
 	*/
-	for _, shape := range dataShapes {
-		recordLen += shape.Type.Size()
+	recordShapes := []DataShape{{Name: "Epoch", Type: INT64}}
+	recordColumns := [][]byte{SwapSliceData(cs.columns["Epoch"], byte(0)).([]byte)}
+	for j, shape := range dataShapes {
+		if !strings.EqualFold(shape.Name, "Epoch") {
+			recordShapes = append(recordShapes, shape)
+			recordColumns = append(recordColumns, colInBytesList[j])
+		}
 	}
-	var padbuf []byte
+	layout, recordLen := recordLayout(recordShapes)
 	if align64 {
-		alignedRecLen := AlignedSize(recordLen)
-		padding := alignedRecLen - recordLen
-		recordLen = alignedRecLen
-		padbuf = make([]byte, padding)
-	}
-
-	epochCol := cs.columns["Epoch"].([]int64)
-	data = make([]byte, 0, recordLen*len(epochCol))
-	for i, epoch := range epochCol {
-		data, _ = Serialize(data, epoch)
-		for j, shape := range dataShapes {
-			if strings.EqualFold(shape.Name, "Epoch") {
-				continue
-			}
-			word := shape.Type.SliceInBytesAt(colInBytesList[j], i)
-			data = append(data, word...)
-		}
+		recordLen = AlignedSize(recordLen)
+	}
 
-		if align64 {
-			if len(padbuf) > 0 {
-				data = append(data, padbuf...)
+	// the padding and the unset bits are zero
+	numRecords := len(cs.columns["Epoch"].([]int64))
+	data = make([]byte, recordLen*numRecords)
+	for i := 0; i < numRecords; i++ {
+		record := data[i*recordLen : (i+1)*recordLen]
+		for j, shape := range recordShapes {
+			if shape.Type == BIT {
+				if recordColumns[j][i] != 0 {
+					record[layout[j].offset] |= 1 << uint(layout[j].bit)
+				}
+				continue
 			}
+			copy(record[layout[j].offset:], shape.Type.SliceInBytesAt(recordColumns[j], i))
 		}
 	}
 
@@ -0,0 +1,134 @@
+package io
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ColumnSeriesTestSuite struct{}
+
+var _ = Suite(&ColumnSeriesTestSuite{})
+
+func (s *ColumnSeriesTestSuite) TestValidity(c *C) {
+	newSeries := func(epochs []int64, valid []bool) *ColumnSeries {
+		cs := NewColumnSeries()
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Size", make([]int64, len(epochs)))
+		cs.SetValidity("Size", valid)
+		return cs
+	}
+	cs := newSeries([]int64{1, 2, 3, 4}, []bool{true, false, true, false})
+
+	c.Check(cs.Rename("Qty", "Size"), IsNil)
+	c.Check(cs.GetValidity("Size"), IsNil)
+	c.Check(cs.IsValid("Qty", 1), Equals, false)
+	c.Check(cs.Replace("Qty", []int64{5, 6, 7, 8}), IsNil)
+	c.Check(cs.GetValidity("Qty"), DeepEquals, []bool{true, false, true, false})
+
+	odd := cs.ApplyTimeQual(func(epoch int64) bool { return epoch%2 == 0 })
+	c.Check(odd.GetValidity("Qty"), DeepEquals, []bool{false, false})
+
+	start, end := int64(2), int64(4)
+	slc, err := SliceColumnSeriesByEpoch(*cs, &start, &end)
+	c.Assert(err, IsNil)
+	c.Check(slc.GetValidity("Qty"), DeepEquals, []bool{false, true})
+	c.Check(cs.GetValidity("Qty"), HasLen, 4)
+
+	c.Check(cs.RestrictLength(3, LAST), IsNil)
+	c.Check(cs.GetValidity("Qty"), DeepEquals, []bool{false, true, false})
+
+	c.Check(cs.Project([]string{"Epoch"}), IsNil)
+	c.Check(cs.HasValidity(), Equals, false)
+
+	left := newSeries([]int64{1, 2}, []bool{false, true})
+	right := newSeries([]int64{2, 3}, nil)
+	c.Check(ColumnSeriesUnion(left, right).GetValidity("Size"), DeepEquals, []bool{false, true, true})
+	concat, err := ColumnSeriesConcat(left, right)
+	c.Assert(err, IsNil)
+	c.Check(concat.GetValidity("Size"), DeepEquals, []bool{false, true, true, true})
+
+	// the rows a member has no value for are missing in the wide series
+	csm := NewColumnSeriesMap()
+	csm.AddColumnSeries(*NewTimeBucketKey("AAPL/1Min/OHLCV"), left)
+	csm.AddColumnSeries(*NewTimeBucketKey("MSFT/1Min/OHLCV"), right)
+	wide, err := csm.ToWideColumnSeries("Symbol")
+	c.Assert(err, IsNil)
+	c.Check(wide.GetValidity("Size_AAPL"), DeepEquals, []bool{false, true, false})
+	c.Check(wide.GetValidity("Size_MSFT"), DeepEquals, []bool{false, true, true})
+}
+
+func (s *ColumnSeriesTestSuite) TestBitColumns(c *C) {
+	dsv := []DataShape{
+		{Name: "Epoch", Type: INT64},
+		{Name: "Halted", Type: BIT},
+		{Name: "OddLot", Type: BIT},
+		{Name: "Price", Type: FLOAT32},
+	}
+	for i := 0; i < 9; i++ {
+		dsv = append(dsv, DataShape{Name: "Flag" + string(rune('A'+i)), Type: BIT})
+	}
+	layout, recordLen := recordLayout(dsv)
+	// the two flags share a byte, and the nine others two
+	c.Check(recordLen, Equals, 8+1+4+2)
+	c.Check(layout[2], Equals, elementLayout{offset: 8, bit: 1})
+	c.Check(layout[3], Equals, elementLayout{offset: 9})
+	c.Check(layout[11], Equals, elementLayout{offset: 13, bit: 7})
+	c.Check(layout[12], Equals, elementLayout{offset: 14})
+
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{1, 2, 3})
+	cs.AddColumn("Halted", []bool{true, false, true})
+	cs.AddColumn("OddLot", []bool{false, false, true})
+	cs.AddColumn("Price", []float32{1, 2, 3})
+	c.Check(cs.GetDataShapes()[1].Type, Equals, BIT)
+
+	tbk := NewTimeBucketKey("AAPL/1Min/TRADE")
+	rs := cs.ToRowSeries(*tbk, false)
+	c.Check(rs.GetRowLen(), Equals, 8+1+4)
+	_, out := rs.ToColumnSeries()
+	c.Check(out.GetByName("Halted"), DeepEquals, []bool{true, false, true})
+	c.Check(out.GetByName("OddLot"), DeepEquals, []bool{false, false, true})
+	c.Check(out.GetByName("Price"), DeepEquals, []float32{1, 2, 3})
+}
+
+func (s *ColumnSeriesTestSuite) TestMerge(c *C) {
+	newSeries := func(epochs []int64, prices []float32) *ColumnSeries {
+		cs := NewColumnSeries()
+		cs.AddColumn("Epoch", epochs)
+		cs.AddColumn("Price", prices)
+		return cs
+	}
+	left := newSeries([]int64{1, 3, 5}, []float32{1, 3, 5})
+	right := newSeries([]int64{4, 2, 3}, []float32{40, 20, 30})
+
+	cs, err := ColumnSeriesMerge(left, right, PreferLeft)
+	c.Assert(err, IsNil)
+	c.Check(cs.GetEpoch(), DeepEquals, []int64{1, 2, 3, 4, 5})
+	c.Check(cs.GetByName("Price"), DeepEquals, []float32{1, 20, 3, 40, 5})
+
+	cs, err = ColumnSeriesMerge(left, right, PreferRight)
+	c.Assert(err, IsNil)
+	c.Check(cs.GetByName("Price"), DeepEquals, []float32{1, 20, 30, 40, 5})
+
+	_, err = ColumnSeriesMerge(left, right, ErrorOnConflict)
+	c.Check(err, ErrorMatches, "conflicting rows at epoch 3")
+	cs, err = ColumnSeriesMerge(left, newSeries([]int64{2}, []float32{20}), ErrorOnConflict)
+	c.Assert(err, IsNil)
+	c.Check(cs.GetEpoch(), DeepEquals, []int64{1, 2, 3, 5})
+
+	other := NewColumnSeries()
+	other.AddColumn("Epoch", []int64{2})
+	other.AddColumn("Price", []float64{20})
+	_, err = ColumnSeriesMerge(left, other, PreferLeft)
+	c.Check(err, NotNil)
+
+	tbk := NewTimeBucketKey("AAPL/1Min/TRADE")
+	csm := NewColumnSeriesMap()
+	csm.AddColumnSeries(*tbk, left)
+	more := NewColumnSeriesMap()
+	more.AddColumnSeries(*tbk, right)
+	more.AddColumnSeries(*NewTimeBucketKey("MSFT/1Min/TRADE"), right)
+	c.Assert(csm.Merge(more, PreferRight), IsNil)
+	c.Check(csm, HasLen, 2)
+	c.Check(csm[*tbk].GetByName("Price"), DeepEquals, []float32{1, 20, 30, 40, 5})
+	c.Check(csm.Merge(more, ErrorOnConflict), ErrorMatches, "failed to merge .*: conflicting rows at epoch .*")
+}
@@ -0,0 +1,124 @@
+package io
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/marketstore/utils"
+)
+
+/*
+WriteCSV writes the map as CSV with a header line, one row per record and the
+item key of the bucket in the first column, e.g.
+
+	Key,Epoch,Open,High,Low,Close
+	AAPL/1Min/OHLCV,2018-01-02T09:30:00Z,170.16,170.2,170.03,170.1
+
+Buckets are written in key order and must all have the same columns. The
+missing values are written as empty fields. The Epoch column is formatted according to timeFormat, see FormatEpoch, in the
+timezone of the column series of the bucket.
+*/
+func (csm ColumnSeriesMap) WriteCSV(w io.Writer, timeFormat string) error {
+	keys := make([]TimeBucketKey, 0, len(csm))
+	for tbk := range csm {
+		keys = append(keys, tbk)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].GetItemKey() < keys[j].GetItemKey()
+	})
+
+	writer := csv.NewWriter(w)
+	var names []string
+	for _, tbk := range keys {
+		cs := csm[tbk]
+		if cs == nil {
+			continue
+		}
+		if names == nil {
+			names = cs.GetColumnNames()
+			if err := writer.Write(append([]string{"Key"}, names...)); err != nil {
+				return err
+			}
+		} else if strings.Join(cs.GetColumnNames(), ",") != strings.Join(names, ",") {
+			return fmt.Errorf("buckets with different columns can not be written to the same CSV, %s has %v, expected %v",
+				tbk.GetItemKey(), cs.GetColumnNames(), names)
+		}
+
+		epoch := cs.GetEpoch()
+		var nanos []int32
+		if ns, ok := cs.GetByName("Nanoseconds").([]int32); ok {
+			nanos = ns
+		}
+		columns := make([]reflect.Value, len(names))
+		for j, name := range names {
+			columns[j] = reflect.ValueOf(cs.GetByName(name))
+		}
+
+		row := make([]string, len(names)+1)
+		row[0] = tbk.GetItemKey()
+		for i := 0; i < cs.Len(); i++ {
+			for j, name := range names {
+				if name == "Epoch" && epoch != nil {
+					var ns int32
+					if nanos != nil {
+						ns = nanos[i]
+					}
+					row[j+1] = formatEpochIn(epoch[i], ns, timeFormat, cs.GetLocation())
+				} else if !cs.IsValid(name, i) {
+					row[j+1] = ""
+				} else if scale, ok := cs.GetScale(name); ok {
+					row[j+1] = FormatDecimal(columns[j].Index(i).Int(), scale)
+				} else {
+					row[j+1] = formatCSVValue(columns[j].Index(i))
+				}
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+/*
+FormatEpoch formats an epoch in seconds and its nanoseconds as "unix" (or
+empty) for the plain integer epoch, "rfc3339" for RFC 3339 with a fractional
+part when there are nanoseconds, or otherwise a Go reference time layout
+such as "2006-01-02 15:04:05". Times are in the system timezone.
+*/
+func FormatEpoch(epoch int64, nanos int32, timeFormat string) string {
+	return formatEpochIn(epoch, nanos, timeFormat, utils.InstanceConfig.Timezone)
+}
+
+func formatEpochIn(epoch int64, nanos int32, timeFormat string, loc *time.Location) string {
+	switch strings.ToLower(timeFormat) {
+	case "", "unix":
+		return strconv.FormatInt(epoch, 10)
+	case "rfc3339":
+		return time.Unix(epoch, int64(nanos)).In(loc).Format(time.RFC3339Nano)
+	}
+	return time.Unix(epoch, int64(nanos)).In(loc).Format(timeFormat)
+}
+
+func formatCSVValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -35,6 +35,23 @@ func (ds *DataShape) Equal(shape DataShape) bool {
 	return ds.Name == shape.Name && ds.Type == shape.Type
 }
 
+// ColumnShapes returns the data shapes of the columns of a ColumnSeries
+// holding the data of the shapes, the columns of every string type being
+// STRING columns of strings, and those of BOOL BIT columns of bools
+func ColumnShapes(dsv []DataShape) []DataShape {
+	out := make([]DataShape, len(dsv))
+	for i, shape := range dsv {
+		switch {
+		case shape.Type.IsString():
+			shape.Type = STRING
+		case shape.Type == BOOL:
+			shape.Type = BIT
+		}
+		out[i] = shape
+	}
+	return out
+}
+
 func DataShapesFromInputString(inputStr string) (dsa []DataShape, err error) {
 	splitString := strings.Split(inputStr, ":")
 	dsa = make([]DataShape, 0)
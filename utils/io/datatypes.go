@@ -59,6 +59,11 @@ const (
 	UINT16
 	UINT32
 	UINT64
+	STRING16
+	STRING64
+	STRING256
+	BIT
+	DECIMAL
 )
 
 var (
@@ -74,14 +79,25 @@ var (
 		INT64:   {reflect.Int64, "int64", 8, reflect.TypeOf(int64(0))},
 		EPOCH:   {reflect.Int64, "epoch", 8, reflect.TypeOf(int64(0))},
 		BYTE:    {reflect.Int8, "byte", 1, reflect.TypeOf(byte(0))},
-		BOOL:    {reflect.Bool, "bool", 1, reflect.TypeOf(bool(false))},
+		BOOL:    {reflect.Bool, "bool", 1, reflect.TypeOf(bool(false))}, // a byte per value on disk, see BIT
 		NONE:    {reflect.Invalid, "none", 0, reflect.TypeOf(byte(0))},
-		STRING:  {reflect.String, "string", 0, reflect.TypeOf("")},
-		INT16:   {reflect.Int16, "int16", 2, reflect.TypeOf(int16(0))},
-		UINT8:   {reflect.Uint8, "uint8", 1, reflect.TypeOf(uint8(0))},
-		UINT16:  {reflect.Uint16, "uint16", 2, reflect.TypeOf(uint16(0))},
-		UINT32:  {reflect.Uint32, "uint32", 4, reflect.TypeOf(uint32(0))},
-		UINT64:  {reflect.Uint64, "uint64", 8, reflect.TypeOf(uint64(0))},
+		// the string columns are []string, STRING being stored as the 4-byte
+		// codes of the dictionary of the bucket and the others in slots of
+		// their size
+		STRING:    {reflect.String, "string", 4, reflect.TypeOf("")},
+		INT16:     {reflect.Int16, "int16", 2, reflect.TypeOf(int16(0))},
+		UINT8:     {reflect.Uint8, "uint8", 1, reflect.TypeOf(uint8(0))},
+		UINT16:    {reflect.Uint16, "uint16", 2, reflect.TypeOf(uint16(0))},
+		UINT32:    {reflect.Uint32, "uint32", 4, reflect.TypeOf(uint32(0))},
+		UINT64:    {reflect.Uint64, "uint64", 8, reflect.TypeOf(uint64(0))},
+		STRING16:  {reflect.String, "string16", 16, reflect.TypeOf("")},
+		STRING64:  {reflect.String, "string64", 64, reflect.TypeOf("")},
+		STRING256: {reflect.String, "string256", 256, reflect.TypeOf("")},
+		// the bool columns are []bool of a byte per value in memory, and a
+		// bit per value in the records, see recordLayout
+		BIT: {reflect.Bool, "bit", 1, reflect.TypeOf(bool(false))},
+		// the int64 values of a scale recorded by the bucket, see decimal.go
+		DECIMAL: {reflect.Int64, "decimal", 8, reflect.TypeOf(int64(0))},
 	}
 )
 
@@ -107,6 +123,12 @@ func (e EnumElementType) Size() int {
 	return attributeMap[e].size
 }
 
+// IsString returns whether the columns of the type are string columns,
+// dictionary encoded or in fixed slots
+func (e EnumElementType) IsString() bool {
+	return attributeMap[e].typ == reflect.String
+}
+
 // SliceInBytesAt returns a byte representation of the element at
 // index position of the original type slice, but takes byte representation
 // of the original slice.  The caller can use this over ByteSliceAt() to
@@ -136,14 +158,19 @@ func (e EnumElementType) ConvertByteSliceInto(data []byte) interface{} {
 		return SwapSliceByte(data, int32(0)).([]int32)
 	case FLOAT64:
 		return SwapSliceByte(data, float64(0)).([]float64)
-	case INT64, EPOCH:
+	case INT64, EPOCH, DECIMAL:
 		return SwapSliceByte(data, int64(0)).([]int64)
 	case BYTE, BOOL:
 		return SwapSliceByte(data, int8(0)).([]int8)
+	case BIT:
+		return bytesToBools(data)
 	case INT16:
 		return SwapSliceByte(data, int16(0)).([]int16)
 	case STRING:
-		return SwapSliceByte(data, string(0)).([]string)
+		// the codes, decoded by the dictionary of the bucket
+		return SwapSliceByte(data, uint32(0)).([]uint32)
+	case STRING16, STRING64, STRING256:
+		return DecodeFixedStrings(data, e.Size())
 	case UINT8:
 		return SwapSliceByte(data, uint8(0)).([]uint8)
 	case UINT16:
@@ -167,6 +194,10 @@ func GetElementType(datum interface{}) EnumElementType {
 	switch kind {
 	case reflect.Struct, reflect.Func, reflect.Interface, reflect.UnsafePointer:
 		return NONE
+	case reflect.Bool:
+		// the bool columns are stored bit-packed, BOOL being the type of
+		// the buckets storing them a byte per value before BIT
+		return BIT
 	default:
 		/*
 			We need to iterate over this map in order of the Enum
@@ -357,6 +388,63 @@ func getByteColumn(offset, reclen, nrecs int, data []byte) (col []byte) {
 	return col
 }
 
+func getBitColumn(offset, bit, reclen, nrecs int, data []byte) (col []bool) {
+	col = make([]bool, nrecs)
+	for i := 0; i < nrecs; i++ {
+		col[i] = data[i*reclen+offset]&(1<<uint(bit)) != 0
+	}
+	return col
+}
+
+func bytesToBools(data []byte) []bool {
+	col := make([]bool, len(data))
+	for i, b := range data {
+		col[i] = b != 0
+	}
+	return col
+}
+
+// elementLayout is the position of an element in a record, its offset and
+// for BIT the bit of the byte at the offset
+type elementLayout struct {
+	offset, bit int
+}
+
+// recordLayout returns the positions of the elements of the data shapes in
+// a record, and its length.  The consecutive BIT elements share their bytes,
+// eight per byte from the least significant bit.
+func recordLayout(dataShapes []DataShape) (layout []elementLayout, recordLen int) {
+	layout = make([]elementLayout, len(dataShapes))
+	// bits used of the last byte of the run of BIT elements, 0 for none
+	bits := 0
+	for i, shape := range dataShapes {
+		if shape.Type != BIT {
+			layout[i].offset = recordLen
+			recordLen += shape.Type.Size()
+			bits = 0
+			continue
+		}
+		if bits == 0 || bits == 8 {
+			recordLen++
+			bits = 0
+		}
+		layout[i] = elementLayout{offset: recordLen - 1, bit: bits}
+		bits++
+	}
+	return layout, recordLen
+}
+
+// ElementsLength returns the length of the elements of the types in a
+// record, the consecutive BIT elements sharing their bytes
+func ElementsLength(types []EnumElementType) int {
+	dataShapes := make([]DataShape, len(types))
+	for i, typ := range types {
+		dataShapes[i].Type = typ
+	}
+	_, length := recordLayout(dataShapes)
+	return length
+}
+
 func CreateSliceFromSliceOfInterface(input []interface{}, typ EnumElementType) (i_output interface{}, err error) {
 	switch typ {
 	case FLOAT32:
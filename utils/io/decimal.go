@@ -0,0 +1,152 @@
+package io
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+The DECIMAL columns hold exact fixed-point numbers, such as prices, as int64
+values in units of 10^-scale, the scale being the number of decimal places
+of the column: 12345 is 123.45 at scale 2.  The scale of a column is kept by
+the ColumnSeries and recorded by the bucket of the column.
+*/
+
+// MaxDecimalScale is the largest number of decimal places of a DECIMAL column
+const MaxDecimalScale = 18
+
+var pow10 = func() (p [MaxDecimalScale + 1]int64) {
+	p[0] = 1
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 10
+	}
+	return p
+}()
+
+// ValidScale returns an error if the scale is not a number of decimal places
+// of a DECIMAL column
+func ValidScale(scale int) error {
+	if scale < 0 || scale > MaxDecimalScale {
+		return fmt.Errorf("decimal scale %d is not between 0 and %d", scale, MaxDecimalScale)
+	}
+	return nil
+}
+
+// FormatDecimal formats the value of a DECIMAL column, such as 123.45 for
+// 12345 at scale 2
+func FormatDecimal(value int64, scale int) string {
+	s := strconv.FormatInt(value, 10)
+	if scale <= 0 {
+		return s
+	}
+	sign := ""
+	if value < 0 {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-scale] + "." + s[len(s)-scale:]
+}
+
+// ParseDecimal parses a decimal number into its value at the scale, exactly
+// for up to scale decimal places, the others being rounded half away from
+// zero
+func ParseDecimal(s string, scale int) (int64, error) {
+	invalid := fmt.Errorf("invalid decimal %q", s)
+	text := strings.TrimSpace(s)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "-"), "+")
+	intPart, fracPart := text, ""
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		intPart, fracPart = text[:i], text[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, invalid
+	}
+	roundUp := false
+	if len(fracPart) > scale {
+		if strings.Trim(fracPart, "0123456789") != "" {
+			return 0, invalid
+		}
+		roundUp = fracPart[scale] >= '5'
+		fracPart = fracPart[:scale]
+	}
+	digits := intPart + fracPart + strings.Repeat("0", scale-len(fracPart))
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return 0, invalid
+	}
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("decimal %q is out of range at scale %d", s, scale)
+	}
+	if roundUp {
+		if value == math.MaxInt64 {
+			return 0, fmt.Errorf("decimal %q is out of range at scale %d", s, scale)
+		}
+		value++
+	}
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// Rescale returns the values of a DECIMAL column at another scale, rounded
+// half away from zero to fewer decimal places
+func Rescale(values []int64, from, to int) ([]int64, error) {
+	out := make([]int64, len(values))
+	switch {
+	case to > from:
+		factor := pow10[to-from]
+		for i, v := range values {
+			if v > math.MaxInt64/factor || v < math.MinInt64/factor {
+				return nil, fmt.Errorf("decimal %s is out of range at scale %d", FormatDecimal(v, from), to)
+			}
+			out[i] = v * factor
+		}
+	case to < from:
+		factor := pow10[from-to]
+		for i, v := range values {
+			q, r := v/factor, v%factor
+			switch {
+			case r*2 >= factor:
+				q++
+			case r*2 <= -factor:
+				q--
+			}
+			out[i] = q
+		}
+	default:
+		copy(out, values)
+	}
+	return out, nil
+}
+
+// FloatsToDecimals returns the values of a DECIMAL column of the scale
+// nearest to the floats
+func FloatsToDecimals(values []float64, scale int) ([]int64, error) {
+	out := make([]int64, len(values))
+	factor := float64(pow10[scale])
+	for i, f := range values {
+		scaled := math.Round(f * factor)
+		if math.IsNaN(scaled) || scaled >= math.MaxInt64 || scaled < math.MinInt64 {
+			return nil, fmt.Errorf("%v cannot be a decimal at scale %d", f, scale)
+		}
+		out[i] = int64(scaled)
+	}
+	return out, nil
+}
+
+// DecimalsToFloats returns the nearest floats to the values of a DECIMAL
+// column of the scale
+func DecimalsToFloats(values []int64, scale int) []float64 {
+	out := make([]float64, len(values))
+	factor := float64(pow10[scale])
+	for i, v := range values {
+		out[i] = float64(v) / factor
+	}
+	return out
+}
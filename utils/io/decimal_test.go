@@ -0,0 +1,81 @@
+package io
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type DecimalTestSuite struct{}
+
+var _ = Suite(&DecimalTestSuite{})
+
+func (s *DecimalTestSuite) TestFormatParse(c *C) {
+	c.Check(FormatDecimal(12345, 2), Equals, "123.45")
+	c.Check(FormatDecimal(-5, 3), Equals, "-0.005")
+	c.Check(FormatDecimal(7, 0), Equals, "7")
+
+	for text, value := range map[string]int64{
+		"123.45":  12345,
+		"-0.005":  -1, // rounded half away from zero
+		"0.004":   0,
+		"+12":     1200,
+		".5":      50,
+		"99.9999": 10000,
+	} {
+		v, err := ParseDecimal(text, 2)
+		c.Assert(err, IsNil)
+		c.Check(v, Equals, value, Commentf("%s", text))
+	}
+	for _, text := range []string{"", "-", "1.2.3", "1e3", "abc", "92233720368547758.08"} {
+		_, err := ParseDecimal(text, 2)
+		c.Check(err, NotNil, Commentf("%s", text))
+	}
+}
+
+func (s *DecimalTestSuite) TestRescale(c *C) {
+	values, err := Rescale([]int64{12345, -12355, 5}, 3, 1)
+	c.Assert(err, IsNil)
+	c.Check(values, DeepEquals, []int64{123, -124, 0})
+	values, err = Rescale([]int64{123}, 1, 4)
+	c.Assert(err, IsNil)
+	c.Check(values, DeepEquals, []int64{123000})
+	_, err = Rescale([]int64{1 << 62}, 0, 2)
+	c.Check(err, NotNil)
+
+	values, err = FloatsToDecimals([]float64{0.1 + 0.2, 1.005}, 2)
+	c.Assert(err, IsNil)
+	c.Check(values, DeepEquals, []int64{30, 100})
+	c.Check(DecimalsToFloats([]int64{30}, 2), DeepEquals, []float64{0.3})
+}
+
+func (s *DecimalTestSuite) TestColumnSeriesScales(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{10, 11})
+	cs.AddColumn("Price", []int64{12345, 12350})
+	cs.SetScale("Price", 2)
+	c.Check(cs.GetDataShapes()[1], Equals, DataShape{Name: "Price", Type: DECIMAL})
+
+	other := NewColumnSeries()
+	other.AddColumn("Epoch", []int64{12})
+	other.AddColumn("Price", []int64{1234567})
+	other.SetScale("Price", 4)
+	concat, err := ColumnSeriesConcat(cs, other)
+	c.Assert(err, IsNil)
+	c.Check(concat.GetByName("Price"), DeepEquals, []int64{12345, 12350, 12346})
+
+	// the decimals are sent as int64 with their scales
+	nds, err := NewNumpyDataset(cs)
+	c.Assert(err, IsNil)
+	c.Check(nds.ColumnTypes[1], Equals, "i8")
+	c.Check(nds.Scales, DeepEquals, map[string]int{"Price": 2})
+	tbk := NewTimeBucketKey("TSLA/1Min/OHLCV")
+	nmds, err := NewNumpyMultiDataset(nds, *tbk)
+	c.Assert(err, IsNil)
+	c.Assert(nmds.Append(other, *NewTimeBucketKey("AAPL/1Min/OHLCV")), IsNil)
+	c.Check(nmds.Scales, DeepEquals, map[string]int{"Price": 4})
+	csm, err := nmds.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Check(csm[*tbk].GetByName("Price"), DeepEquals, []int64{1234500, 1235000})
+	scale, ok := csm[*tbk].GetScale("Price")
+	c.Check(ok, Equals, true)
+	c.Check(scale, Equals, 4)
+}
@@ -7,7 +7,11 @@ import (
 
 func (cs *ColumnSeries) CoerceColumnType(ds DataShape) (err error) {
 	//TODO: Make this generic and maintainable
-	if ds.Type == BOOL || ds.Type == STRING {
+	if _, ok := cs.GetByName(ds.Name).([]string); ok && ds.Type.IsString() {
+		// the string types only differ on disk
+		return nil
+	}
+	if ds.Type == BOOL || ds.Type.IsString() {
 		return fmt.Errorf("Can not cast to boolean or string")
 	}
 	i_col := cs.GetByName(ds.Name)
@@ -72,18 +72,20 @@ func (mk *TimeBucketKey) GetItems() (items []string) {
 }
 
 func (mk *TimeBucketKey) GetItemInCategory(catName string) (item string) {
+	items := mk.GetItems()
 	for i, name := range mk.GetCategories() {
-		if name == catName {
-			return mk.GetItems()[i]
+		if name == catName && i < len(items) {
+			return items[i]
 		}
 	}
 	return ""
 }
 
 func (mk *TimeBucketKey) GetMultiItemInCategory(catName string) (items []string) {
+	itemList := mk.GetItems()
 	for i, name := range mk.GetCategories() {
-		if name == catName {
-			presplit := mk.GetItems()[i]
+		if name == catName && i < len(itemList) {
+			presplit := itemList[i]
 			items = strings.Split(presplit, ",")
 			return items
 		}
@@ -121,10 +121,7 @@ func (f *TimeBucketInfo) GetDataShapesWithEpoch() (out []DataShape) {
 }
 
 func (f *TimeBucketInfo) getFieldRecordLength() (fieldRecordLength int) {
-	for _, elType := range f.GetElementTypes() {
-		fieldRecordLength += elType.Size()
-	}
-	return fieldRecordLength
+	return ElementsLength(f.GetElementTypes())
 }
 
 // GetDeepCopy returns a copy of this TimeBucketInfo.
@@ -245,6 +242,31 @@ func (f *TimeBucketInfo) SetElementTypes(newTypes []EnumElementType) error {
 	return nil
 }
 
+// SetElementName renames the i-th field of the file described by the given
+// TimeBucketInfo, in the header of the file as well as in memory
+func (f *TimeBucketInfo) SetElementName(i int, name string) error {
+	names := f.GetElementNames()
+	if i < 0 || i >= len(names) {
+		return fmt.Errorf("Element %d out of range", i)
+	}
+	if name == "" || len(name) > 32 {
+		return fmt.Errorf("Element name %q must be 1 to 32 bytes long", name)
+	}
+	file, err := os.OpenFile(f.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var slot [32]byte
+	copy(slot[:], name)
+	if _, err = file.WriteAt(slot[:], int64(312+32*i)); err != nil {
+		return err
+	}
+	// as loaded from the header
+	names[i] = strings.Title(name)
+	return nil
+}
+
 func (f *TimeBucketInfo) readHeader(path string) (err error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -2,8 +2,13 @@ package io
 
 // TODO: this is no longer numpy.  rename later.
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/alpacahq/marketstore/utils/log"
 )
@@ -20,6 +25,7 @@ var (
 		UINT64:  "u8",
 		FLOAT32: "f4",
 		FLOAT64: "f8",
+		BIT:     "b1",
 	}
 )
 
@@ -31,7 +37,31 @@ var typeStrMap = func() map[string]EnumElementType {
 	return m
 }()
 
+// Dataset formats: the serialization of the datasets is versioned by its
+// format field, for the clients to refuse the datasets of a format newer
+// than they decode rather than misreading them, and for the servers to
+// downgrade the datasets sent to the older clients.
+const (
+	// The datasets before versioning, of numeric columns only, without
+	// the format field
+	NumpyFormat1 = 1
+	// Adds the unicode string and b1 bool columns, the validity bitmaps and
+	// the scales of the decimal columns
+	NumpyFormat2 = 2
+	// Adds the contiguous layout of the columns in a single buffer, see
+	// NumpyDataset.Pack
+	NumpyFormat3 = 3
+
+	CurrentNumpyFormat = NumpyFormat3
+)
+
+// NumpyAlignment is the alignment of the columns of a packed dataset in its
+// buffer, that of the Arrow buffers, which suits any numpy dtype
+const NumpyAlignment = 64
+
 type NumpyDataset struct {
+	// format of the serialization, NumpyFormat1 if omitted
+	Format int `msgpack:"format,omitempty"`
 	// a list of type strings such as i4 and f8
 	ColumnTypes []string `msgpack:"types"`
 	// a list of column names
@@ -39,19 +69,51 @@ type NumpyDataset struct {
 	// two dimentional byte arrays holding the column data
 	ColumnData [][]byte `msgpack:"data"`
 	Length     int      `msgpack:"length"`
+	// validity bitmaps of the columns with missing values, the bit of each
+	// value set if present, least significant bit first, and empty for the
+	// columns without any missing
+	Validity [][]byte `msgpack:"valid,omitempty"`
+	// decimal places of the i8 values of the DECIMAL columns by name
+	Scales map[string]int `msgpack:"scales,omitempty"`
+	// with NumpyFormat3, the data of the columns laid out in a single
+	// buffer instead of data, each starting at its offset, a multiple of
+	// NumpyAlignment, with their numpy dtypes of explicit byte order such
+	// as <i8 and |b1
+	Buffer  []byte   `msgpack:"buffer,omitempty"`
+	Offsets []int    `msgpack:"offsets,omitempty"`
+	DTypes  []string `msgpack:"dtypes,omitempty"`
 	// hidden
 	dataShapes []DataShape
 }
 
 func NewNumpyDataset(cs *ColumnSeries) (nds *NumpyDataset, err error) {
 	nds = new(NumpyDataset)
+	nds.Format = NumpyFormat2
 	nds.Length = cs.Len()
 	nds.dataShapes = cs.GetDataShapes()
+	if cs.HasValidity() {
+		nds.Validity = make([][]byte, cs.GetNumColumns())
+	}
 	for i, name := range cs.GetColumnNames() {
 		nds.ColumnNames = append(nds.ColumnNames, name)
+		if nds.Validity != nil {
+			nds.Validity[i] = appendValidity(nil, 0, cs.Len(), cs.GetValidity(name))
+		}
+		if strs, ok := cs.GetColumn(name).([]string); ok {
+			width := unicodeWidth(strs)
+			nds.ColumnData = append(nds.ColumnData, encodeUnicode(strs, width))
+			nds.ColumnTypes = append(nds.ColumnTypes, unicodeTypeStr(width))
+			continue
+		}
 		colBytes := CastToByteSlice(cs.GetColumn(name))
 		nds.ColumnData = append(nds.ColumnData, colBytes)
-		if typeStr, ok := typeMap[nds.dataShapes[i].Type]; !ok {
+		if scale, ok := cs.GetScale(name); ok {
+			if nds.Scales == nil {
+				nds.Scales = map[string]int{}
+			}
+			nds.Scales[name] = scale
+			nds.ColumnTypes = append(nds.ColumnTypes, typeMap[INT64])
+		} else if typeStr, ok := typeMap[nds.dataShapes[i].Type]; !ok {
 			log.Error("unsupported type %v", nds.dataShapes[i].String())
 			return nil, fmt.Errorf("unsupported type")
 		} else {
@@ -65,10 +127,166 @@ func (nds *NumpyDataset) Len() int {
 	return nds.Length
 }
 
+// FormatVersion returns the format of the serialization of the dataset
+func (nds *NumpyDataset) FormatVersion() int {
+	if nds.Format == 0 {
+		return NumpyFormat1
+	}
+	return nds.Format
+}
+
+// Downgrade returns the dataset in the older format, for the clients which
+// do not decode the format of the dataset.  Its decimal columns are sent as
+// f8 floats, its bool columns as u1 bytes, and its missing float values as
+// NaN, or 0 for the other types.  The string columns cannot be downgraded.
+func (nds *NumpyDataset) Downgrade(format int) (*NumpyDataset, error) {
+	if format >= nds.FormatVersion() {
+		return nds, nil
+	}
+	if nds.Buffer != nil {
+		unpacked := *nds
+		if err := unpacked.Unpack(); err != nil {
+			return nil, err
+		}
+		return unpacked.Downgrade(format)
+	}
+	out := &NumpyDataset{
+		ColumnNames: nds.ColumnNames,
+		Length:      nds.Length,
+	}
+	if format > NumpyFormat1 {
+		out.Format = format
+	}
+	for i, name := range nds.ColumnNames {
+		typeStr, data := nds.ColumnTypes[i], nds.ColumnData[i]
+		if _, ok := unicodeWidthOf(typeStr); ok {
+			return nil, fmt.Errorf("string column %s is not in dataset format %d, the client should be upgraded",
+				name, format)
+		}
+		var valid []bool
+		if i < len(nds.Validity) {
+			valid = readValidity(nds.Validity[i], 0, nds.Length)
+		}
+		scale, decimal := nds.Scales[name]
+		switch {
+		case decimal && typeStr == typeMap[INT64]:
+			floats := DecimalsToFloats(SwapSliceByte(data, int64(0)).([]int64), scale)
+			setNaN(floats, valid)
+			typeStr, data = typeMap[FLOAT64], CastToByteSlice(floats)
+		case typeStr == typeMap[BIT]:
+			typeStr = typeMap[UINT8]
+		case valid != nil && typeStr == typeMap[FLOAT64]:
+			floats := append([]float64{}, SwapSliceByte(data, float64(0)).([]float64)...)
+			setNaN(floats, valid)
+			data = CastToByteSlice(floats)
+		case valid != nil && typeStr == typeMap[FLOAT32]:
+			floats := append([]float32{}, SwapSliceByte(data, float32(0)).([]float32)...)
+			for j, v := range valid {
+				if !v {
+					floats[j] = float32(math.NaN())
+				}
+			}
+			data = CastToByteSlice(floats)
+		}
+		out.ColumnTypes = append(out.ColumnTypes, typeStr)
+		out.ColumnData = append(out.ColumnData, data)
+	}
+	return out, nil
+}
+
+// Pack lays the data of the columns of the dataset out in a single buffer,
+// each column at an offset aligned to NumpyAlignment bytes, for the clients
+// to wrap the columns as arrays of the buffer without copying them
+func (nds *NumpyDataset) Pack() {
+	if nds.Buffer != nil {
+		return
+	}
+	size := 0
+	for _, data := range nds.ColumnData {
+		size += alignedSize(len(data))
+	}
+	nds.Buffer = make([]byte, 0, size)
+	nds.Offsets = make([]int, len(nds.ColumnData))
+	nds.DTypes = make([]string, len(nds.ColumnData))
+	for i, data := range nds.ColumnData {
+		nds.Offsets[i] = len(nds.Buffer)
+		nds.Buffer = append(nds.Buffer, data...)
+		nds.Buffer = nds.Buffer[:alignedSize(len(nds.Buffer))]
+		nds.DTypes[i] = numpyDType(nds.ColumnTypes[i])
+	}
+	nds.ColumnData = nil
+	nds.Format = NumpyFormat3
+}
+
+// Unpack sets the data of the columns of a packed dataset from its buffer
+func (nds *NumpyDataset) Unpack() error {
+	if nds.Buffer == nil {
+		return nil
+	}
+	if len(nds.Offsets) != len(nds.ColumnTypes) {
+		return fmt.Errorf("%d offsets for %d columns", len(nds.Offsets), len(nds.ColumnTypes))
+	}
+	columnData := make([][]byte, len(nds.Offsets))
+	for i, offset := range nds.Offsets {
+		size, err := columnSize(nds.ColumnTypes[i], nds.Length)
+		if err != nil {
+			return err
+		}
+		if offset < 0 || offset+size > len(nds.Buffer) {
+			return fmt.Errorf("column %d of %d bytes at %d is out of the buffer of %d bytes",
+				i, size, offset, len(nds.Buffer))
+		}
+		columnData[i] = nds.Buffer[offset : offset+size]
+	}
+	nds.ColumnData = columnData
+	nds.Buffer, nds.Offsets, nds.DTypes = nil, nil, nil
+	nds.Format = NumpyFormat2
+	return nil
+}
+
+// alignedSize rounds the size up to a multiple of NumpyAlignment
+func alignedSize(size int) int {
+	return (size + NumpyAlignment - 1) / NumpyAlignment * NumpyAlignment
+}
+
+// columnSize returns the size of the data of length values of the type
+func columnSize(typeStr string, length int) (int, error) {
+	if width, ok := unicodeWidthOf(typeStr); ok {
+		return 4 * width * length, nil
+	}
+	typ, ok := typeStrMap[typeStr]
+	if !ok {
+		return 0, fmt.Errorf("unsupported type string %s", typeStr)
+	}
+	return typ.Size() * length, nil
+}
+
+// numpyDType returns the numpy dtype of the type with an explicit byte
+// order, little endian, or none for single bytes
+func numpyDType(typeStr string) string {
+	if width, ok := unicodeWidthOf(typeStr); ok {
+		return "<" + unicodeTypeStr(width)
+	}
+	if typ, ok := typeStrMap[typeStr]; ok && typ.Size() == 1 {
+		return "|" + typeStr
+	}
+	return "<" + typeStr
+}
+
+func setNaN(values []float64, valid []bool) {
+	for i, v := range valid {
+		if !v {
+			values[i] = math.NaN()
+		}
+	}
+}
+
 func (nds *NumpyDataset) buildDataShapes() ([]DataShape, error) {
 	etypes := []EnumElementType{}
 	for _, typeStr := range nds.ColumnTypes {
-		if typ, ok := typeStrMap[typeStr]; !ok {
+		if _, ok := unicodeWidthOf(typeStr); ok {
+			etypes = append(etypes, STRING)
+		} else if typ, ok := typeStrMap[typeStr]; !ok {
 			return nil, fmt.Errorf("unsupported type string %s", typeStr)
 		} else {
 			etypes = append(etypes, typ)
@@ -88,6 +306,14 @@ func (nds *NumpyDataset) ToColumnSeries(options ...int) (cs *ColumnSeries, err e
 		startIndex, length = 0, nds.Len()
 	}
 
+	if nds.FormatVersion() > CurrentNumpyFormat {
+		return nil, fmt.Errorf("dataset of format %d, newer than format %d, the client should be upgraded",
+			nds.FormatVersion(), CurrentNumpyFormat)
+	}
+	if err = nds.Unpack(); err != nil {
+		return nil, err
+	}
+
 	cs = NewColumnSeries()
 	if len(nds.ColumnData[0]) == 0 {
 		return cs, nil
@@ -102,11 +328,23 @@ func (nds *NumpyDataset) ToColumnSeries(options ...int) (cs *ColumnSeries, err e
 		}
 	}
 	for i, shape := range nds.dataShapes {
-		size := shape.Type.Size()
-		start := startIndex * size
-		end := start + length*size
-		newColData := shape.Type.ConvertByteSliceInto(nds.ColumnData[i][start:end])
-		cs.AddColumn(shape.Name, newColData)
+		if width, ok := unicodeWidthOf(nds.ColumnTypes[i]); ok {
+			start := startIndex * 4 * width
+			end := start + length*4*width
+			cs.AddColumn(shape.Name, decodeUnicode(nds.ColumnData[i][start:end], width))
+		} else {
+			size := shape.Type.Size()
+			start := startIndex * size
+			end := start + length*size
+			newColData := shape.Type.ConvertByteSliceInto(nds.ColumnData[i][start:end])
+			cs.AddColumn(shape.Name, newColData)
+			if scale, ok := nds.Scales[shape.Name]; ok && (shape.Type == INT64 || shape.Type == DECIMAL) {
+				cs.SetScale(shape.Name, scale)
+			}
+		}
+		if i < len(nds.Validity) {
+			cs.SetValidity(shape.Name, readValidity(nds.Validity[i], startIndex, length))
+		}
 	}
 	return cs, nil
 }
@@ -120,10 +358,13 @@ type NumpyMultiDataset struct {
 func NewNumpyMultiDataset(nds *NumpyDataset, tbk TimeBucketKey) (nmds *NumpyMultiDataset, err error) {
 	nmds = &NumpyMultiDataset{
 		NumpyDataset: NumpyDataset{
+			Format:      nds.Format,
 			ColumnTypes: nds.ColumnTypes,
 			ColumnNames: nds.ColumnNames,
 			ColumnData:  nds.ColumnData,
 			Length:      nds.Length,
+			Validity:    nds.Validity,
+			Scales:      nds.Scales,
 			dataShapes:  nds.dataShapes,
 		},
 	}
@@ -134,6 +375,20 @@ func NewNumpyMultiDataset(nds *NumpyDataset, tbk TimeBucketKey) (nmds *NumpyMult
 	return nmds, nil
 }
 
+// Downgrade returns the multi dataset in the older format, see
+// NumpyDataset.Downgrade
+func (nmds *NumpyMultiDataset) Downgrade(format int) (*NumpyMultiDataset, error) {
+	nds, err := nmds.NumpyDataset.Downgrade(format)
+	if err != nil || nds == &nmds.NumpyDataset {
+		return nmds, err
+	}
+	return &NumpyMultiDataset{
+		NumpyDataset: *nds,
+		StartIndex:   nmds.StartIndex,
+		Lengths:      nmds.Lengths,
+	}, nil
+}
+
 func (nmds *NumpyMultiDataset) ToColumnSeriesMap() (csm ColumnSeriesMap, err error) {
 	csm = NewColumnSeriesMap()
 	for tbkStr, idx := range nmds.StartIndex {
@@ -165,12 +420,195 @@ func (nmds *NumpyMultiDataset) Append(cs *ColumnSeries, tbk TimeBucketKey) (err
 			return
 		}
 	}
+	if cs.HasValidity() && nmds.Validity == nil {
+		nmds.Validity = make([][]byte, len(nmds.ColumnData))
+	}
+	for idx, col := range colSeriesNames {
+		if nmds.Validity != nil {
+			nmds.Validity[idx] = appendValidity(nmds.Validity[idx], nmds.Length, cs.Len(), cs.GetValidity(col))
+		}
+	}
 	nmds.StartIndex[tbk.String()] = nmds.Length
 	nmds.Lengths[tbk.String()] = cs.Len()
 	nmds.Length += cs.Len()
 	for idx, col := range colSeriesNames {
+		if strs, ok := cs.GetColumn(col).([]string); ok {
+			// the slots of the column fit the longest string of every bucket
+			width, _ := unicodeWidthOf(nmds.ColumnTypes[idx])
+			if w := unicodeWidth(strs); w > width {
+				nmds.ColumnData[idx] = widenUnicode(nmds.ColumnData[idx], width, w)
+				nmds.ColumnTypes[idx] = unicodeTypeStr(w)
+				width = w
+			}
+			nmds.ColumnData[idx] = append(nmds.ColumnData[idx], encodeUnicode(strs, width)...)
+			continue
+		}
+		scale, decimal := cs.GetScale(col)
+		values, isInt64 := cs.GetColumn(col).([]int64)
+		if _, ok := nmds.Scales[col]; decimal || ok && isInt64 {
+			// the values of every bucket at the largest scale, the int64
+			// columns being decimals of no decimal places
+			if err = nmds.rescale(idx, scale); err != nil {
+				return err
+			}
+			if values, err = Rescale(values, scale, nmds.Scales[col]); err != nil {
+				return err
+			}
+			nmds.ColumnData[idx] = append(nmds.ColumnData[idx], CastToByteSlice(values)...)
+			continue
+		}
 		newBuffer := CastToByteSlice(cs.GetColumn(col))
 		nmds.ColumnData[idx] = append(nmds.ColumnData[idx], newBuffer...)
 	}
 	return nil
 }
+
+// rescale rescales the values of the DECIMAL column to the scale if larger
+// than theirs
+func (nmds *NumpyMultiDataset) rescale(idx, scale int) error {
+	name := nmds.ColumnNames[idx]
+	current, ok := nmds.Scales[name]
+	if ok && current >= scale {
+		return nil
+	}
+	if nmds.Scales == nil {
+		nmds.Scales = map[string]int{}
+	}
+	nmds.Scales[name] = scale
+	if len(nmds.ColumnData[idx]) == 0 {
+		return nil
+	}
+	values, err := Rescale(SwapSliceByte(nmds.ColumnData[idx], int64(0)).([]int64), current, scale)
+	if err != nil {
+		return err
+	}
+	nmds.ColumnData[idx] = CastToByteSlice(values)
+	return nil
+}
+
+/*
+The string columns are sent as numpy unicode columns, such as U16, each
+string in UTF-32 in a slot of the number of characters of the longest one.
+*/
+
+func unicodeTypeStr(width int) string {
+	return "U" + strconv.Itoa(width)
+}
+
+// unicodeWidthOf returns the number of characters of the slots of the
+// unicode type, such as 16 for U16 or <U16
+func unicodeWidthOf(typeStr string) (int, bool) {
+	typeStr = strings.TrimPrefix(typeStr, "<")
+	if !strings.HasPrefix(typeStr, "U") {
+		return 0, false
+	}
+	width, err := strconv.Atoi(typeStr[1:])
+	if err != nil || width < 1 {
+		return 0, false
+	}
+	return width, true
+}
+
+// unicodeWidth returns the number of characters of the longest string, at
+// least 1 as numpy has no empty unicode type
+func unicodeWidth(values []string) int {
+	width := 1
+	for _, s := range values {
+		if n := utf8.RuneCountInString(s); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+func encodeUnicode(values []string, width int) []byte {
+	data := make([]byte, len(values)*4*width)
+	for i, s := range values {
+		offset := i * 4 * width
+		for _, r := range s {
+			binary.LittleEndian.PutUint32(data[offset:], uint32(r))
+			offset += 4
+		}
+	}
+	return data
+}
+
+func decodeUnicode(data []byte, width int) []string {
+	values := make([]string, len(data)/(4*width))
+	runes := make([]rune, 0, width)
+	for i := range values {
+		runes = runes[:0]
+		for j := 0; j < width; j++ {
+			r := rune(binary.LittleEndian.Uint32(data[(i*width+j)*4:]))
+			if r == 0 {
+				break
+			}
+			runes = append(runes, r)
+		}
+		values[i] = string(runes)
+	}
+	return values
+}
+
+// widenUnicode returns the data of the column in slots of more characters
+func widenUnicode(data []byte, from, to int) []byte {
+	if from == 0 {
+		return data
+	}
+	n := len(data) / (4 * from)
+	out := make([]byte, n*4*to)
+	for i := 0; i < n; i++ {
+		copy(out[i*4*to:], data[i*4*from:(i+1)*4*from])
+	}
+	return out
+}
+
+// appendValidity returns the validity bitmap of n values with that of count
+// values appended, nil meaning none missing, the bitmap being left empty
+// until one is
+func appendValidity(bitmap []byte, n, count int, valid []bool) []byte {
+	if len(bitmap) == 0 {
+		missing := false
+		for _, v := range valid {
+			missing = missing || !v
+		}
+		if !missing {
+			return bitmap
+		}
+		bitmap = setValidity(nil, 0, n, nil)
+	}
+	return setValidity(bitmap, n, count, valid)
+}
+
+// setValidity returns the bitmap holding count more values from the n-th,
+// valid unless their validity is given
+func setValidity(bitmap []byte, n, count int, valid []bool) []byte {
+	for len(bitmap) < (n+count+7)/8 {
+		bitmap = append(bitmap, 0)
+	}
+	for i := 0; i < count; i++ {
+		if valid == nil || valid[i] {
+			bitmap[(n+i)/8] |= 1 << uint((n+i)%8)
+		}
+	}
+	return bitmap
+}
+
+// readValidity returns the validity of length values of the bitmap from the
+// start, nil if none is missing
+func readValidity(bitmap []byte, start, length int) []bool {
+	if len(bitmap) == 0 {
+		return nil
+	}
+	valid := make([]bool, length)
+	missing := false
+	for i := range valid {
+		j := start + i
+		valid[i] = j/8 < len(bitmap) && bitmap[j/8]&(1<<uint(j%8)) != 0
+		missing = missing || !valid[i]
+	}
+	if !missing {
+		return nil
+	}
+	return valid
+}
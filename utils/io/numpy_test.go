@@ -99,3 +99,122 @@ func (s *TestSuite3) TestToColumnSeries(c *C) {
 	c.Check(err, Equals, nil)
 	c.Check(reflect.DeepEqual(csReturned, cs), Equals, true)
 }
+
+func (s *TestSuite3) TestValidity(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{10, 11, 12})
+	cs.AddColumn("Size", []int32{1, 0, 3})
+	cs.SetValidity("Size", []bool{true, false, true})
+	nds, err := NewNumpyDataset(cs)
+	c.Assert(err, IsNil)
+	c.Check(nds.Validity, DeepEquals, [][]byte{nil, {0x05}})
+
+	tbk := NewTimeBucketKey("TSLA/1Min/OHLCV")
+	nmds, err := NewNumpyMultiDataset(nds, *tbk)
+	c.Assert(err, IsNil)
+	// the bitmaps are extended for the next bucket across their bytes
+	for _, symbol := range []string{"AAPL", "MSFT", "NVDA"} {
+		next := NewColumnSeries()
+		next.AddColumn("Epoch", []int64{10, 11, 12})
+		next.AddColumn("Size", []int32{4, 5, 6})
+		if symbol == "NVDA" {
+			next.SetValidity("Epoch", []bool{true, true, false})
+		}
+		c.Assert(nmds.Append(next, *NewTimeBucketKey(symbol + "/1Min/OHLCV")), IsNil)
+	}
+	c.Check(nmds.Validity, DeepEquals, [][]byte{{0xff, 0x07}, {0xfd, 0x0f}})
+
+	csm, err := nmds.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Check(csm[*tbk].GetValidity("Size"), DeepEquals, []bool{true, false, true})
+	c.Check(csm[*tbk].GetValidity("Epoch"), IsNil)
+	nvda := csm[*NewTimeBucketKey("NVDA/1Min/OHLCV")]
+	c.Check(nvda.GetValidity("Epoch"), DeepEquals, []bool{true, true, false})
+	c.Check(nvda.GetValidity("Size"), IsNil)
+}
+
+func (s *TestSuite3) TestFormat(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{10, 11, 12})
+	cs.AddColumn("Price", []int64{150, -25, 0})
+	cs.SetScale("Price", 2)
+	cs.AddColumn("Close", []float32{1, 2, 3})
+	cs.SetValidity("Close", []bool{true, false, true})
+	cs.AddColumn("Odd", []bool{false, true, false})
+	nds, err := NewNumpyDataset(cs)
+	c.Assert(err, IsNil)
+	c.Check(nds.FormatVersion(), Equals, NumpyFormat2)
+
+	// the datasets of the clients before the format field are format 1
+	old, err := nds.Downgrade(NumpyFormat1)
+	c.Assert(err, IsNil)
+	c.Check(old.Format, Equals, 0)
+	c.Check(old.FormatVersion(), Equals, NumpyFormat1)
+	c.Check(old.ColumnTypes, DeepEquals, []string{"i8", "f8", "f4", "u1"})
+	c.Check(old.Validity, IsNil)
+	c.Check(old.Scales, IsNil)
+	out, err := old.ToColumnSeries()
+	c.Assert(err, IsNil)
+	c.Check(out.GetByName("Price"), DeepEquals, []float64{1.5, -0.25, 0})
+	closes := out.GetByName("Close").([]float32)
+	c.Check(closes[0], Equals, float32(1))
+	c.Check(closes[1] != closes[1], Equals, true)
+	c.Check(out.GetByName("Odd"), DeepEquals, []uint8{0, 1, 0})
+	// the column series is not changed
+	c.Check(cs.GetByName("Close"), DeepEquals, []float32{1, 2, 3})
+
+	same, err := nds.Downgrade(CurrentNumpyFormat)
+	c.Assert(err, IsNil)
+	c.Check(same, Equals, nds)
+
+	strs := NewColumnSeries()
+	strs.AddColumn("Epoch", []int64{10})
+	strs.AddColumn("Exchange", []string{"Q"})
+	nds, err = NewNumpyDataset(strs)
+	c.Assert(err, IsNil)
+	_, err = nds.Downgrade(NumpyFormat1)
+	c.Check(err, NotNil)
+
+	nds.Format = CurrentNumpyFormat + 1
+	_, err = nds.ToColumnSeries()
+	c.Check(err, ErrorMatches, ".*should be upgraded")
+}
+
+func (s *TestSuite3) TestPack(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{10, 11, 12})
+	cs.AddColumn("Odd", []bool{false, true, false})
+	cs.AddColumn("Exchange", []string{"Q", "NYSE", ""})
+	cs.AddColumn("Close", []float32{1, 2, 3})
+	nds, err := NewNumpyDataset(cs)
+	c.Assert(err, IsNil)
+	nmds, err := NewNumpyMultiDataset(nds, *NewTimeBucketKey("TSLA/1Min/OHLCV"))
+	c.Assert(err, IsNil)
+
+	nmds.Pack()
+	c.Check(nmds.FormatVersion(), Equals, NumpyFormat3)
+	c.Check(nmds.ColumnData, IsNil)
+	c.Check(nmds.Offsets, DeepEquals, []int{0, 64, 128, 192})
+	c.Check(nmds.DTypes, DeepEquals, []string{"<i8", "|b1", "<U4", "<f4"})
+	c.Check(nmds.Buffer, HasLen, 256)
+	c.Check(nmds.Buffer[64:67], DeepEquals, []byte{0, 1, 0})
+
+	csm, err := nmds.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	out := csm[*NewTimeBucketKey("TSLA/1Min/OHLCV")]
+	c.Check(out.GetEpoch(), DeepEquals, []int64{10, 11, 12})
+	c.Check(out.GetByName("Exchange"), DeepEquals, []string{"Q", "NYSE", ""})
+	c.Check(out.GetByName("Close"), DeepEquals, []float32{1, 2, 3})
+
+	// the older clients get the columns apart
+	nmds.Pack()
+	old, err := nmds.Downgrade(NumpyFormat2)
+	c.Assert(err, IsNil)
+	c.Check(old.Buffer, IsNil)
+	c.Check(old.ColumnData[3], HasLen, 12)
+	c.Check(nmds.Buffer, NotNil)
+
+	nmds.Offsets[3] = 250
+	_, err = nmds.ToColumnSeriesMap()
+	c.Check(err, NotNil)
+}
@@ -33,8 +33,9 @@ func NewRows(dataShape []DataShape, data []byte) *Rows {
 }
 
 func (rows *Rows) GetColumn(colname string) (col interface{}) {
-	var offset int
-	for _, ds := range rows.GetDataShapes() {
+	layout, _ := recordLayout(rows.GetDataShapes())
+	for i, ds := range rows.GetDataShapes() {
+		offset := layout[i].offset
 		if ds.Name == colname {
 			switch ds.Type {
 			case FLOAT32:
@@ -45,23 +46,26 @@ func (rows *Rows) GetColumn(colname string) (col interface{}) {
 				return getInt16Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
 			case INT32:
 				return getInt32Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
-			case EPOCH, INT64:
+			case EPOCH, INT64, DECIMAL:
 				return getInt64Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
 			case UINT8:
 				return getUInt8Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
 			case UINT16:
 				return getUInt16Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
-			case UINT32:
+			case UINT32, STRING:
+				// the codes of STRING, decoded by the dictionary of the bucket
 				return getUInt32Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
 			case UINT64:
 				return getUInt64Column(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
 			case BOOL:
-				fallthrough
+				return bytesToBools(getByteColumn(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData()))
+			case BIT:
+				return getBitColumn(offset, layout[i].bit, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
 			case BYTE:
 				return getByteColumn(offset, int(rows.GetRowLen()), rows.GetNumRows(), rows.GetData())
+			case STRING16, STRING64, STRING256:
+				return getFixedStringColumn(offset, int(rows.GetRowLen()), rows.GetNumRows(), ds.Type.Size(), rows.GetData())
 			}
-		} else {
-			offset += ds.Type.Size()
 		}
 	}
 	return nil
@@ -112,9 +116,7 @@ func (rows *Rows) GetRowLen() (len int) {
 		rowLen can be set directly to allow for alignment, etc, or this will set it based on sum of DataShape
 	*/
 	if rows.rowLen == 0 {
-		for _, shape := range rows.dataShape {
-			rows.rowLen += shape.Type.Size()
-		}
+		_, rows.rowLen = recordLayout(rows.dataShape)
 	}
 	return rows.rowLen
 }
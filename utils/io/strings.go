@@ -0,0 +1,184 @@
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// EncodeFixedStrings returns the slots of width bytes of the strings of a
+// fixed-slot string column, in UTF-8 padded with zeros.  The strings longer
+// than a slot are cut after the last whole character fitting in it.
+func EncodeFixedStrings(values []string, width int) []byte {
+	data := make([]byte, len(values)*width)
+	for i, s := range values {
+		if len(s) > width {
+			s = s[:width]
+			for len(s) > 0 && !utf8.ValidString(s) {
+				s = s[:len(s)-1]
+			}
+		}
+		copy(data[i*width:], s)
+	}
+	return data
+}
+
+// DecodeFixedStrings returns the strings of the slots of width bytes
+func DecodeFixedStrings(data []byte, width int) []string {
+	values := make([]string, len(data)/width)
+	for i := range values {
+		values[i] = trimSlot(data[i*width : (i+1)*width])
+	}
+	return values
+}
+
+func getFixedStringColumn(offset, reclen, nrecs, width int, data []byte) (col []string) {
+	col = make([]string, nrecs)
+	for i := range col {
+		start := i*reclen + offset
+		col[i] = trimSlot(data[start : start+width])
+	}
+	return col
+}
+
+func trimSlot(slot []byte) string {
+	end := len(slot)
+	for end > 0 && slot[end-1] == 0 {
+		end--
+	}
+	return string(slot[:end])
+}
+
+/*
+StringDictionary maps the strings of the dictionary encoded string columns
+of a bucket to the codes stored in its records, 0 being the code of the
+empty string.  It is kept in a file along with the year files of the bucket,
+appending each new string as its 4-byte length followed by its bytes, the
+code of a string being its position in the file.
+*/
+type StringDictionary struct {
+	sync.RWMutex
+	path    string
+	size    int64             // of the entries of the file, without a partially written one
+	strings []string          // by code
+	codes   map[string]uint32 // by string
+}
+
+// OpenStringDictionary loads the dictionary of the file, empty if the file
+// does not exist yet
+func OpenStringDictionary(path string) (*StringDictionary, error) {
+	sd := &StringDictionary{
+		path:    path,
+		strings: []string{""},
+		codes:   map[string]uint32{"": 0},
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sd, nil
+		}
+		return nil, err
+	}
+	for len(data) >= 4 {
+		length := int(binary.LittleEndian.Uint32(data))
+		if len(data) < 4+length {
+			// left partially written by a crash, overwritten by the next entry
+			break
+		}
+		sd.add(string(data[4 : 4+length]))
+		data = data[4+length:]
+		sd.size += int64(4 + length)
+	}
+	return sd, nil
+}
+
+func (sd *StringDictionary) add(s string) uint32 {
+	code := uint32(len(sd.strings))
+	sd.strings = append(sd.strings, s)
+	sd.codes[s] = code
+	return code
+}
+
+// Len returns the number of strings of the dictionary, the empty string
+// included
+func (sd *StringDictionary) Len() int {
+	sd.RLock()
+	defer sd.RUnlock()
+	return len(sd.strings)
+}
+
+// Encode returns the codes of the strings, adding the new ones to the
+// dictionary.  They are synced to its file before returning, for the records
+// holding their codes never to be written without them.
+func (sd *StringDictionary) Encode(values []string) ([]uint32, error) {
+	codes := make([]uint32, len(values))
+	sd.RLock()
+	missing := false
+	for i, s := range values {
+		code, ok := sd.codes[s]
+		codes[i], missing = code, missing || !ok
+	}
+	sd.RUnlock()
+	if !missing {
+		return codes, nil
+	}
+
+	sd.Lock()
+	defer sd.Unlock()
+	var entries []byte
+	added := len(sd.strings)
+	for i, s := range values {
+		code, ok := sd.codes[s]
+		if !ok {
+			code = sd.add(s)
+			var length [4]byte
+			binary.LittleEndian.PutUint32(length[:], uint32(len(s)))
+			entries = append(append(entries, length[:]...), s...)
+		}
+		codes[i] = code
+	}
+	if len(entries) == 0 {
+		return codes, nil
+	}
+	if err := sd.append(entries); err != nil {
+		for _, s := range sd.strings[added:] {
+			delete(sd.codes, s)
+		}
+		sd.strings = sd.strings[:added]
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (sd *StringDictionary) append(entries []byte) error {
+	fp, err := os.OpenFile(sd.path, os.O_WRONLY|os.O_CREATE, 0770)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if _, err = fp.WriteAt(entries, sd.size); err != nil {
+		return err
+	}
+	if err = fp.Sync(); err != nil {
+		return err
+	}
+	sd.size += int64(len(entries))
+	return nil
+}
+
+// Decode returns the strings of the codes
+func (sd *StringDictionary) Decode(codes []uint32) ([]string, error) {
+	sd.RLock()
+	defer sd.RUnlock()
+	values := make([]string, len(codes))
+	for i, code := range codes {
+		if int(code) >= len(sd.strings) {
+			return nil, fmt.Errorf("string code %d missing from the dictionary %s", code, sd.path)
+		}
+		values[i] = sd.strings[code]
+	}
+	return values, nil
+}
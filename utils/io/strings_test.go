@@ -0,0 +1,73 @@
+package io
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type StringsTestSuite struct{}
+
+var _ = Suite(&StringsTestSuite{})
+
+func (s *StringsTestSuite) TestFixedStrings(c *C) {
+	data := EncodeFixedStrings([]string{"", "NYSE", "ÆØÅ", "NASDAQ"}, 4)
+	c.Assert(data, HasLen, 16)
+	// cut after the last whole character
+	c.Assert(DecodeFixedStrings(data, 4), DeepEquals, []string{"", "NYSE", "ÆØ", "NASD"})
+}
+
+func (s *StringsTestSuite) TestStringDictionary(c *C) {
+	path := filepath.Join(c.MkDir(), "strings")
+	sd, err := OpenStringDictionary(path)
+	c.Assert(err, IsNil)
+	codes, err := sd.Encode([]string{"NYSE", "", "ARCA", "NYSE"})
+	c.Assert(err, IsNil)
+	c.Assert(codes, DeepEquals, []uint32{1, 0, 2, 1})
+	_, err = sd.Decode([]uint32{3})
+	c.Assert(err, NotNil)
+
+	// a partially written entry is overwritten
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, IsNil)
+	fp.Write([]byte{10, 0, 0, 0, 'B'})
+	fp.Close()
+	sd, err = OpenStringDictionary(path)
+	c.Assert(err, IsNil)
+	codes, err = sd.Encode([]string{"ARCA", "BATS"})
+	c.Assert(err, IsNil)
+	c.Assert(codes, DeepEquals, []uint32{2, 3})
+
+	sd, err = OpenStringDictionary(path)
+	c.Assert(err, IsNil)
+	values, err := sd.Decode([]uint32{3, 2, 1, 0})
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, []string{"BATS", "ARCA", "NYSE", ""})
+	data, _ := ioutil.ReadFile(path)
+	c.Assert(data, HasLen, 3*(4+4))
+}
+
+func (s *StringsTestSuite) TestNumpyStrings(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{1, 2})
+	cs.AddColumn("Exchange", []string{"ARCA", "Ñ"})
+	nds, err := NewNumpyDataset(cs)
+	c.Assert(err, IsNil)
+	c.Assert(nds.ColumnTypes, DeepEquals, []string{"i8", "U4"})
+	nmds, err := NewNumpyMultiDataset(nds, *NewTimeBucketKey("AAPL/1Min/TRADE"))
+	c.Assert(err, IsNil)
+
+	// widened to the longest string of the buckets
+	cs = NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{3})
+	cs.AddColumn("Exchange", []string{"NASDAQ"})
+	c.Assert(nmds.Append(cs, *NewTimeBucketKey("MSFT/1Min/TRADE")), IsNil)
+	c.Assert(nmds.ColumnTypes[1], Equals, "U6")
+
+	csm, err := nmds.ToColumnSeriesMap()
+	c.Assert(err, IsNil)
+	c.Assert(csm[*NewTimeBucketKey("AAPL/1Min/TRADE")].GetByName("Exchange"), DeepEquals, []string{"ARCA", "Ñ"})
+	c.Assert(csm[*NewTimeBucketKey("MSFT/1Min/TRADE")].GetByName("Exchange"), DeepEquals, []string{"NASDAQ"})
+}
@@ -0,0 +1,143 @@
+package io
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Window is the rows from Start to End, exclusive, of a rolling window ending
+// at the row End-1 of a column series
+type Window struct {
+	Start, End int
+}
+
+// Len returns the number of rows in the window
+func (w Window) Len() int {
+	return w.End - w.Start
+}
+
+// CountWindows returns the windows of the count rows ending at every row of
+// the column series, the windows of its first count-1 rows holding fewer rows
+func CountWindows(cs *ColumnSeries, count int) ([]Window, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("window of %d rows", count)
+	}
+	windows := make([]Window, cs.Len())
+	for i := range windows {
+		windows[i] = Window{Start: i + 1 - count, End: i + 1}
+		if windows[i].Start < 0 {
+			windows[i].Start = 0
+		}
+	}
+	return windows, nil
+}
+
+// TimeWindows returns the windows of the rows in the period ending at every
+// row of the column series, whose Epoch is after the Epoch of the row minus
+// the period.  The rows must be in the order of their Epoch.
+func TimeWindows(cs *ColumnSeries, period time.Duration) ([]Window, error) {
+	seconds := int64(period / time.Second)
+	if seconds < 1 {
+		return nil, fmt.Errorf("window of %v is shorter than a second", period)
+	}
+	epochs := cs.GetEpoch()
+	if epochs == nil {
+		return nil, fmt.Errorf("no Epoch column")
+	}
+	windows := make([]Window, len(epochs))
+	start := 0
+	for i, epoch := range epochs {
+		if i > 0 && epoch < epochs[i-1] {
+			return nil, fmt.Errorf("epoch %d after %d is out of order", epoch, epochs[i-1])
+		}
+		for epochs[start] <= epoch-seconds {
+			start++
+		}
+		windows[i] = Window{Start: start, End: i + 1}
+	}
+	return windows, nil
+}
+
+// RollingApply returns the result of the function on the values of every
+// window, for the aggregates without a rolling helper
+func RollingApply(values []float64, windows []Window, f func(window []float64) float64) []float64 {
+	out := make([]float64, len(windows))
+	for i, w := range windows {
+		out[i] = f(values[w.Start:w.End])
+	}
+	return out
+}
+
+// RollingSum returns the sums of the values of every window
+func RollingSum(values []float64, windows []Window) []float64 {
+	// the prefix sums, compensated so that the differences of the long
+	// series keep their precision
+	sums := make([]float64, len(values)+1)
+	var sum, compensation float64
+	for i, v := range values {
+		y := v - compensation
+		t := sum + y
+		compensation = (t - sum) - y
+		sum = t
+		sums[i+1] = sum
+	}
+	out := make([]float64, len(windows))
+	for i, w := range windows {
+		out[i] = sums[w.End] - sums[w.Start]
+	}
+	return out
+}
+
+// RollingMean returns the means of the values of every window, NaN for an
+// empty window
+func RollingMean(values []float64, windows []Window) []float64 {
+	out := RollingSum(values, windows)
+	for i, w := range windows {
+		out[i] /= float64(w.Len())
+	}
+	return out
+}
+
+// RollingMin returns the minimums of the values of every window, NaN for an
+// empty window
+func RollingMin(values []float64, windows []Window) []float64 {
+	return rollingExtreme(values, windows, func(a, b float64) bool { return a <= b })
+}
+
+// RollingMax returns the maximums of the values of every window, NaN for an
+// empty window
+func RollingMax(values []float64, windows []Window) []float64 {
+	return rollingExtreme(values, windows, func(a, b float64) bool { return a >= b })
+}
+
+// rollingExtreme returns the extremes of the values of every window, keeping
+// the indexes of the candidates of the window in a monotonic queue, which is
+// rebuilt for a window which does not follow the previous one
+func rollingExtreme(values []float64, windows []Window, keeps func(a, b float64) bool) []float64 {
+	out := make([]float64, len(windows))
+	var queue []int
+	var last Window
+	for i, w := range windows {
+		if w.Start < last.Start || w.End < last.End || w.Start >= last.End {
+			queue = queue[:0]
+			last = Window{Start: w.Start, End: w.Start}
+		}
+		for j := last.End; j < w.End; j++ {
+			for len(queue) > 0 && keeps(values[j], values[queue[len(queue)-1]]) {
+				queue = queue[:len(queue)-1]
+			}
+			queue = append(queue, j)
+		}
+		for len(queue) > 0 && queue[0] < w.Start {
+			queue = queue[1:]
+		}
+		last = w
+		if len(queue) == 0 {
+			out[i] = math.NaN()
+			continue
+		}
+		out[i] = values[queue[0]]
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package io
+
+import (
+	"math"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type WindowTestSuite struct{}
+
+var _ = Suite(&WindowTestSuite{})
+
+func (s *WindowTestSuite) TestWindows(c *C) {
+	cs := NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{0, 60, 120, 300, 360})
+	values := []float64{3, 1, 4, 1, 5}
+
+	windows, err := CountWindows(cs, 3)
+	c.Assert(err, IsNil)
+	c.Check(windows, DeepEquals, []Window{{0, 1}, {0, 2}, {0, 3}, {1, 4}, {2, 5}})
+	c.Check(RollingSum(values, windows), DeepEquals, []float64{3, 4, 8, 6, 10})
+	c.Check(RollingMin(values, windows), DeepEquals, []float64{3, 1, 1, 1, 1})
+	c.Check(RollingMax(values, windows), DeepEquals, []float64{3, 3, 4, 4, 5})
+	_, err = CountWindows(cs, 0)
+	c.Check(err, NotNil)
+
+	// the windows of the rows of the last 2 minutes, the gap leaving the
+	// row at 300 alone
+	windows, err = TimeWindows(cs, 2*time.Minute)
+	c.Assert(err, IsNil)
+	c.Check(windows, DeepEquals, []Window{{0, 1}, {0, 2}, {1, 3}, {3, 4}, {3, 5}})
+	c.Check(RollingMean(values, windows), DeepEquals, []float64{3, 2, 2.5, 1, 3})
+	c.Check(RollingMax(values, windows), DeepEquals, []float64{3, 3, 4, 1, 5})
+	c.Check(RollingApply(values, windows, func(w []float64) float64 { return float64(len(w)) }),
+		DeepEquals, []float64{1, 2, 2, 1, 2})
+
+	// any windows, the empty ones having no extreme
+	windows = []Window{{2, 5}, {0, 2}, {1, 1}}
+	c.Check(RollingMin(values, windows)[:2], DeepEquals, []float64{1, 1})
+	c.Check(math.IsNaN(RollingMax(values, windows)[2]), Equals, true)
+
+	cs.Replace("Epoch", []int64{0, 60, 30, 300, 360})
+	_, err = TimeWindows(cs, time.Minute)
+	c.Check(err, NotNil)
+}
@@ -1,68 +1,106 @@
 package log
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// modulePath is the import path of the packages of the server, whose
+// component is the first element of their path below it
+const modulePath = "github.com/alpacahq/marketstore/"
+
+var (
+	outputMu sync.Mutex
+	format                       = "json"
+	output   zapcore.WriteSyncer = zapcore.Lock(os.Stdout)
+)
+
 func init() {
-	atom := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	build()
+}
 
+// SetFormat sets the encoding of the log entries, json with one object per
+// line, or text for a human reader
+func SetFormat(f string) error {
+	if f != "json" && f != "text" {
+		return fmt.Errorf("unknown log format %s, must be json or text", f)
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	format = f
+	build()
+	return nil
+}
+
+// SetOutput sets the destination of the log entries, the standard output by
+// default, such as a RotatingFile
+func SetOutput(w io.Writer) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	output = zapcore.Lock(zapcore.AddSync(w))
+	build()
+}
+
+func build() {
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = "timestamp"
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 
+	var encoder zapcore.Encoder
+	if format == "text" {
+		encoderCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	}
+	// the levels are filtered before the entries reach zap
 	logger := zap.New(zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderCfg),
-		zapcore.Lock(os.Stdout),
-		atom,
+		encoder,
+		output,
+		zap.NewAtomicLevelAt(zapcore.DebugLevel),
 	))
-
 	zap.ReplaceGlobals(logger)
 }
 
-func Debug(msg string, args ...interface{}) {
-	if logLevel <= DEBUG {
-		if len(args) > 0 {
-			zap.S().Debugf(msg, args...)
-		} else {
-			zap.S().Debug(msg)
-		}
-	}
+// Logger logs its entries with fields, such as the bucket or the request id
+// they are about
+type Logger struct {
+	fields []interface{}
 }
 
-func Info(msg string, args ...interface{}) {
-	if logLevel <= INFO {
-		if len(args) > 0 {
-			zap.S().Infof(msg, args...)
-		} else {
-			zap.S().Info(msg)
-		}
-	}
-}
+// root is the logger of the package functions, without fields
+var root = &Logger{}
 
-func Warn(msg string, args ...interface{}) {
-	if logLevel <= WARNING {
-		if len(args) > 0 {
-			zap.S().Warnf(msg, args...)
-		} else {
-			zap.S().Warn(msg)
-		}
-	}
+// With returns a logger adding the fields to its entries, given as key and
+// value pairs
+func With(keysAndValues ...interface{}) *Logger {
+	return root.With(keysAndValues...)
 }
 
-func Error(msg string, args ...interface{}) {
-	if logLevel <= ERROR {
-		if len(args) > 0 {
-			zap.S().Errorf(msg, args...)
-		} else {
-			zap.S().Error(msg)
-		}
-	}
+// With returns a logger adding the fields to those of the logger
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	return &Logger{fields: append(fields, keysAndValues...)}
 }
 
+func Debug(msg string, args ...interface{})             { root.log(DEBUG, msg, args) }
+func Info(msg string, args ...interface{})              { root.log(INFO, msg, args) }
+func Warn(msg string, args ...interface{})              { root.log(WARNING, msg, args) }
+func Error(msg string, args ...interface{})             { root.log(ERROR, msg, args) }
+func (l *Logger) Debug(msg string, args ...interface{}) { l.log(DEBUG, msg, args) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.log(INFO, msg, args) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.log(WARNING, msg, args) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.log(ERROR, msg, args) }
+
 func Fatal(msg string, args ...interface{}) {
 	if len(args) > 0 {
 		zap.S().Fatalf(msg, args...)
@@ -71,10 +109,127 @@ func Fatal(msg string, args ...interface{}) {
 	}
 }
 
+// log writes the entry if its level is enabled for the component of the
+// caller of the logging function
+func (l *Logger) log(level Level, msg string, args []interface{}) {
+	levels, _ := componentLevels.Load().(map[string]Level)
+	if len(levels) == 0 && level < logLevel {
+		return
+	}
+	// the caller of Info and the others
+	pc, _, _, _ := runtime.Caller(2)
+	c := componentOf(pc)
+	if level < levelOf(c, levels) {
+		return
+	}
+	s := zap.S().With("component", c)
+	if len(l.fields) > 0 {
+		s = s.With(l.fields...)
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	switch level {
+	case DEBUG:
+		s.Debug(msg)
+	case INFO:
+		s.Info(msg)
+	case WARNING:
+		s.Warn(msg)
+	default:
+		s.Error(msg)
+	}
+}
+
 func SetLevel(level Level) {
 	logLevel = level
 }
 
+func GetLevel() Level {
+	return logLevel
+}
+
+// SetComponentLevels sets the levels of components, replacing the level of
+// SetLevel for their entries.  A component is a top-level package of the
+// server, such as executor or frontend, or plugins for the plugins, and
+// plugins/<name> for the plugin of the contrib/<name> package.  The level
+// of plugins/<name> falls back to that of plugins.
+func SetComponentLevels(levels map[string]Level) {
+	copied := make(map[string]Level, len(levels))
+	for c, level := range levels {
+		copied[c] = level
+	}
+	componentLevels.Store(copied)
+}
+
+// GetComponentLevels returns the levels set by SetComponentLevels
+func GetComponentLevels() map[string]Level {
+	levels, _ := componentLevels.Load().(map[string]Level)
+	copied := make(map[string]Level, len(levels))
+	for c, level := range levels {
+		copied[c] = level
+	}
+	return copied
+}
+
+func levelOf(component string, levels map[string]Level) Level {
+	for c := component; c != ""; {
+		if level, ok := levels[c]; ok {
+			return level
+		}
+		i := strings.LastIndex(c, "/")
+		if i < 0 {
+			break
+		}
+		c = c[:i]
+	}
+	return logLevel
+}
+
+var (
+	componentLevels atomic.Value
+	// component by program counter
+	components sync.Map
+)
+
+// componentOf returns the component of the function of the program counter
+func componentOf(pc uintptr) string {
+	if c, ok := components.Load(pc); ok {
+		return c.(string)
+	}
+	c := "plugins"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		c = packageComponent(fn.Name())
+	}
+	components.Store(pc, c)
+	return c
+}
+
+// packageComponent returns the component of the fully qualified function
+// name, such as github.com/alpacahq/marketstore/executor.(*Writer).Write
+func packageComponent(function string) string {
+	pkg := function
+	slash := strings.LastIndex(pkg, "/")
+	if dot := strings.Index(pkg[slash+1:], "."); dot >= 0 {
+		pkg = pkg[:slash+1+dot]
+	}
+	if pkg == "main" {
+		return "cmd"
+	}
+	if !strings.HasPrefix(pkg, modulePath) {
+		// the plugins built apart, and the main packages of plugins
+		return "plugins"
+	}
+	parts := strings.Split(strings.TrimPrefix(pkg, modulePath), "/")
+	switch {
+	case parts[0] == "contrib" && len(parts) > 1:
+		return "plugins/" + parts[1]
+	case parts[0] == "contrib":
+		return "plugins"
+	}
+	return parts[0]
+}
+
 type Level int
 
 const (
@@ -86,3 +241,17 @@ const (
 )
 
 var logLevel Level
+
+func (l Level) String() string {
+	switch l {
+	case DEBUG:
+		return "debug"
+	case INFO:
+		return "info"
+	case WARNING:
+		return "warning"
+	case ERROR:
+		return "error"
+	}
+	return "fatal"
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&LogTestSuite{})
+
+type LogTestSuite struct{}
+
+func (s *LogTestSuite) TestComponent(c *C) {
+	for function, component := range map[string]string{
+		"github.com/alpacahq/marketstore/executor.(*Writer).Write":                    "executor",
+		"github.com/alpacahq/marketstore/frontend/stream.Initialize":                  "frontend",
+		"github.com/alpacahq/marketstore/plugins/trigger.Load":                        "plugins",
+		"github.com/alpacahq/marketstore/contrib/ondiskagg/aggtrigger.NewTrigger":     "plugins/ondiskagg",
+		"github.com/alpacahq/marketstore/contrib/gdaxfeeder.(*GdaxFetcher).Run.func1": "plugins/gdaxfeeder",
+		"plugin/unnamed-4d1f5e.NewBgWorker":                                           "plugins",
+		"main.main":                                                                   "cmd",
+	} {
+		c.Assert(packageComponent(function), Equals, component, Commentf(function))
+	}
+}
+
+func (s *LogTestSuite) TestLevels(c *C) {
+	defer func(level Level) {
+		SetLevel(level)
+		SetComponentLevels(nil)
+	}(GetLevel())
+	SetLevel(INFO)
+	SetComponentLevels(map[string]Level{"executor": ERROR, "plugins": WARNING, "plugins/ondiskagg": DEBUG})
+	levels := GetComponentLevels()
+	c.Assert(levelOf("executor", levels), Equals, ERROR)
+	c.Assert(levelOf("frontend", levels), Equals, INFO)
+	c.Assert(levelOf("plugins/gdaxfeeder", levels), Equals, WARNING)
+	c.Assert(levelOf("plugins/ondiskagg", levels), Equals, DEBUG)
+}
+
+func (s *LogTestSuite) TestFields(c *C) {
+	var buf bytes.Buffer
+	defer zap.ReplaceGlobals(zap.L())
+	zap.ReplaceGlobals(zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	)))
+	defer func(level Level) {
+		SetLevel(level)
+		SetComponentLevels(nil)
+	}(GetLevel())
+	SetLevel(INFO)
+
+	With("bucket", "AAPL/1Min/OHLCV").With("request_id", "abc").Info("read %d rows", 3)
+	entry := map[string]interface{}{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &entry), IsNil)
+	c.Assert(entry["msg"], Equals, "read 3 rows")
+	c.Assert(entry["component"], Equals, "utils")
+	c.Assert(entry["bucket"], Equals, "AAPL/1Min/OHLCV")
+	c.Assert(entry["request_id"], Equals, "abc")
+
+	// silenced by the level of the component of the caller
+	buf.Reset()
+	SetComponentLevels(map[string]Level{"utils": ERROR})
+	Warn("dropped")
+	c.Assert(buf.Len(), Equals, 0)
+	Error("kept")
+	c.Assert(buf.Len(), Not(Equals), 0)
+}
@@ -0,0 +1,176 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names the rotated files after the time of their rotation,
+// so that they sort in the order of their rotation
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+var now = time.Now
+
+// RotatingFile is a log file which is renamed after the time of its rotation
+// and replaced by a new one once it exceeds its maximum size or age, keeping
+// a bounded number of the rotated files.  A zero maximum disables the limit.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// OpenRotatingFile opens the log file at the path, appending to it if it
+// exists, which is rotated when it exceeds maxSize bytes or when the
+// interval elapsed since it was opened.  The rotated files beyond the
+// maxBackups most recent ones, or older than maxAge, are removed.
+func OpenRotatingFile(path string, maxSize int64, interval time.Duration,
+	maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		maxAge:     maxAge,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), now()
+	return nil
+}
+
+// Write appends the entry to the file, rotating it first if the entry would
+// exceed its maximum size or its interval elapsed.  An entry is never split
+// across files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	full := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	expired := f.interval > 0 && now().Sub(f.opened) >= f.interval
+	if full || expired {
+		if err := f.rotate(); err != nil {
+			// keep logging to the current file rather than losing entries
+			fmt.Fprintf(os.Stderr, "failed to rotate log file: %v\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Sync commits the file to disk
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file, after which the entries are dropped
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Rotate rotates the file right away
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+func (f *RotatingFile) rotate() error {
+	backup := f.path + "." + now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	f.file.Close()
+	if err := f.open(); err != nil {
+		// reopen the rotated file to keep logging
+		f.file, _ = os.OpenFile(backup, os.O_APPEND|os.O_WRONLY, 0644)
+		return err
+	}
+	return f.removeBackups()
+}
+
+// removeBackups removes the rotated files beyond maxBackups or maxAge
+func (f *RotatingFile) removeBackups() error {
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	for i, backup := range backups {
+		// most recent first
+		n := len(backups) - 1 - i
+		old := false
+		if f.maxAge > 0 {
+			info, err := os.Stat(backup)
+			old = err == nil && now().Sub(info.ModTime()) > f.maxAge
+		}
+		if (f.maxBackups > 0 && n >= f.maxBackups) || old {
+			if err := os.Remove(backup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Backups returns the paths of the rotated files, oldest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	backups := matches[:0]
+	for _, match := range matches {
+		suffix := match[len(f.path)+1:]
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
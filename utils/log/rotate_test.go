@@ -0,0 +1,64 @@
+package log
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *LogTestSuite) TestRotatingFile(c *C) {
+	clock := time.Unix(1500000000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	path := filepath.Join(c.MkDir(), "logs", "mkts.log")
+	f, err := OpenRotatingFile(path, 10, time.Hour, 2, 0)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	write := func(entry string) {
+		_, err := f.Write([]byte(entry))
+		c.Assert(err, IsNil)
+		clock = clock.Add(time.Second)
+	}
+	content := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		c.Assert(err, IsNil)
+		return string(data)
+	}
+
+	// rotated before exceeding the size
+	write("12345\n")
+	write("123\n")
+	write("12\n")
+	c.Assert(content(path), Equals, "12\n")
+	backups, err := f.Backups()
+	c.Assert(err, IsNil)
+	c.Assert(backups, HasLen, 1)
+	c.Assert(content(backups[0]), Equals, "12345\n123\n")
+
+	// an entry larger than the size is not split
+	write("0123456789ab\n")
+	c.Assert(content(path), Equals, "0123456789ab\n")
+
+	// and after the interval
+	clock = clock.Add(time.Hour)
+	write("1\n")
+	c.Assert(content(path), Equals, "1\n")
+
+	// keeping the most recent backups
+	backups, err = f.Backups()
+	c.Assert(err, IsNil)
+	c.Assert(backups, HasLen, 2)
+	c.Assert(content(backups[0]), Equals, "12\n")
+	c.Assert(content(backups[1]), Equals, "0123456789ab\n")
+
+	// appended to when reopened
+	c.Assert(f.Close(), IsNil)
+	f, err = OpenRotatingFile(path, 10, 0, 0, 0)
+	c.Assert(err, IsNil)
+	write("2\n")
+	c.Assert(content(path), Equals, "1\n2\n")
+}
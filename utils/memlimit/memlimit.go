@@ -0,0 +1,134 @@
+// Package memlimit sizes the memory used by the server to the limit of its
+// container, detected from its cgroup, or to the memory_limit setting, for
+// a big query not to get the server killed by the kernel.
+package memlimit
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alpacahq/marketstore/utils/stats"
+)
+
+// unlimited is the lowest limit taken for none, cgroup v1 reporting a
+// page-aligned maximum int64 without a limit
+const unlimited = 1 << 62
+
+var (
+	// root of the /proc and /sys file systems, changed by the tests
+	root = "/"
+
+	limit int64
+
+	limitGauge = stats.NewGauge("marketstore_memory_limit_bytes",
+		"Memory limit the buffers are sized to, from the cgroup or memory_limit, 0 if none")
+)
+
+// CgroupLimit returns the memory limit of the cgroup of the process, and of
+// its parents for cgroup v2, or 0 if it has none
+func CgroupLimit() (int64, error) {
+	f, err := os.Open(filepath.Join(root, "proc/self/cgroup"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	var v1, v2 string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			v2 = fields[2]
+		case hasController(fields[1], "memory"):
+			v1 = fields[2]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	switch {
+	case v1 != "":
+		return lowestLimit(filepath.Join(root, "sys/fs/cgroup/memory"), v1, "memory.limit_in_bytes")
+	case v2 != "":
+		return lowestLimit(filepath.Join(root, "sys/fs/cgroup"), v2, "memory.max")
+	}
+	return 0, nil
+}
+
+func hasController(controllers, name string) bool {
+	for _, c := range strings.Split(controllers, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lowestLimit returns the lowest limit of the cgroup and its parents.  The
+// path of the cgroup is that of the host, so its directory is missing when
+// the cgroup file system of a container is mounted at its own cgroup, whose
+// limit is then that of the root directory.
+func lowestLimit(mount, cgroupPath, fileName string) (int64, error) {
+	var lowest int64
+	for p := path.Clean(cgroupPath); ; p = path.Dir(p) {
+		data, err := ioutil.ReadFile(filepath.Join(mount, p, fileName))
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return 0, err
+		default:
+			value := strings.TrimSpace(string(data))
+			if value == "max" {
+				break
+			}
+			l, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			if l < unlimited && (lowest == 0 || l < lowest) {
+				lowest = l
+			}
+		}
+		if p == "/" {
+			return lowest, nil
+		}
+	}
+}
+
+// Init sets the memory limit of the server to the limit of its cgroup, or
+// to the hard cap if lower and not 0, for the buffers to be sized to it
+// rather than the kernel killing the server.  It returns the limit, 0 if none.
+func Init(hardCap int64) (int64, error) {
+	l, err := CgroupLimit()
+	if hardCap > 0 && (l == 0 || hardCap < l) {
+		l = hardCap
+	}
+	atomic.StoreInt64(&limit, l)
+	limitGauge.Set(float64(l))
+	return l, err
+}
+
+// Limit returns the memory limit set by Init, 0 if none
+func Limit() int64 {
+	return atomic.LoadInt64(&limit)
+}
+
+// Share returns the part of the memory limit a buffer is sized to, one
+// divisor-th of it, or 0 without a limit
+func Share(divisor int64) int64 {
+	return Limit() / divisor
+}
@@ -0,0 +1,85 @@
+package memlimit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type MemlimitTestSuite struct{}
+
+var _ = Suite(&MemlimitTestSuite{})
+
+func (s *MemlimitTestSuite) TearDownTest(c *C) {
+	root = "/"
+}
+
+func write(c *C, relPath, content string) {
+	p := filepath.Join(root, relPath)
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, []byte(content), 0644), IsNil)
+}
+
+func (s *MemlimitTestSuite) TestCgroupV2(c *C) {
+	root = c.MkDir()
+	l, err := CgroupLimit()
+	c.Assert(err, IsNil)
+	c.Assert(l, Equals, int64(0))
+
+	write(c, "proc/self/cgroup", "0::/system.slice/marketstore.service\n")
+	write(c, "sys/fs/cgroup/memory.max", "max\n")
+	write(c, "sys/fs/cgroup/system.slice/memory.max", "4294967296\n")
+	write(c, "sys/fs/cgroup/system.slice/marketstore.service/memory.max", "max\n")
+	l, err = CgroupLimit()
+	c.Assert(err, IsNil)
+	c.Assert(l, Equals, int64(4294967296))
+
+	// the lowest of the cgroup and its parents
+	write(c, "sys/fs/cgroup/system.slice/marketstore.service/memory.max", "1073741824\n")
+	l, err = CgroupLimit()
+	c.Assert(err, IsNil)
+	c.Assert(l, Equals, int64(1073741824))
+}
+
+func (s *MemlimitTestSuite) TestCgroupV1(c *C) {
+	root = c.MkDir()
+	// the cgroup of a container, mounted at its own cgroup
+	write(c, "proc/self/cgroup", "12:cpu,cpuacct:/docker/0123\n11:memory:/docker/0123\n")
+	write(c, "sys/fs/cgroup/memory/memory.limit_in_bytes", "9223372036854771712\n")
+	l, err := CgroupLimit()
+	c.Assert(err, IsNil)
+	c.Assert(l, Equals, int64(0))
+
+	write(c, "sys/fs/cgroup/memory/memory.limit_in_bytes", "536870912\n")
+	l, err = CgroupLimit()
+	c.Assert(err, IsNil)
+	c.Assert(l, Equals, int64(536870912))
+}
+
+func (s *MemlimitTestSuite) TestInit(c *C) {
+	root = c.MkDir()
+	defer Init(0)
+	l, err := Init(0)
+	c.Assert(err, IsNil)
+	c.Assert(l, Equals, int64(0))
+	c.Assert(Share(4), Equals, int64(0))
+
+	write(c, "proc/self/cgroup", "0::/\n")
+	write(c, "sys/fs/cgroup/memory.max", "1073741824\n")
+	l, _ = Init(0)
+	c.Assert(l, Equals, int64(1073741824))
+	c.Assert(Share(4), Equals, int64(268435456))
+
+	// the hard cap only lowers the limit
+	l, _ = Init(1 << 31)
+	c.Assert(l, Equals, int64(1073741824))
+	l, _ = Init(1 << 29)
+	c.Assert(l, Equals, int64(1<<29))
+	c.Assert(Limit(), Equals, int64(1<<29))
+}
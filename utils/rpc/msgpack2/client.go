@@ -8,6 +8,7 @@
 package msgpack2
 
 import (
+	"fmt"
 	"io"
 	"math/rand"
 
@@ -52,6 +53,42 @@ func EncodeClientRequest(method string, args interface{}) ([]byte, error) {
 	return msgpack.Marshal(c)
 }
 
+// EncodeClientBatchRequest encodes a batch of JSON-RPC client requests, one
+// per method with the parameters of the same index.
+func EncodeClientBatchRequest(methods []string, args []interface{}) ([]byte, error) {
+	if len(methods) != len(args) {
+		return nil, fmt.Errorf("%d methods for %d parameters", len(methods), len(args))
+	}
+	batch := make([]*clientRequest, len(methods))
+	for i, method := range methods {
+		batch[i] = &clientRequest{
+			Version: "2.0",
+			Method:  method,
+			Params:  args[i],
+			Id:      uint64(rand.Int63()),
+		}
+	}
+	return msgpack.Marshal(batch)
+}
+
+// DecodeClientBatchResponse splits the response body of a batch into the
+// response of each request, each to be decoded by DecodeClientResponse.
+func DecodeClientBatchResponse(r io.Reader) ([][]byte, error) {
+	var batch []interface{}
+	if err := msgpack.NewDecoder(r).Decode(&batch); err != nil {
+		return nil, err
+	}
+	responses := make([][]byte, len(batch))
+	for i, response := range batch {
+		encoded, err := msgpack.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		responses[i] = encoded
+	}
+	return responses, nil
+}
+
 // DecodeClientResponse decodes the response body of a client request into
 // the interface reply.
 func DecodeClientResponse(r io.Reader, reply interface{}) error {
@@ -0,0 +1,255 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alpacahq/marketstore/utils/log"
+)
+
+/*
+The metrics below are exposed in the Prometheus text format by Handler.
+Metrics are registered when they are created and their names must be
+unique, so they are meant to be package level variables.
+*/
+
+// DefaultBuckets are the upper bounds of the histogram buckets in seconds
+// for latencies, from 1ms to 10s
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var registry = struct {
+	sync.Mutex
+	families map[string]*family
+}{families: map[string]*family{}}
+
+type family struct {
+	sync.Mutex
+	name, help, kind string
+	labels           []string
+	buckets          []float64 // histograms only
+	fn               func() float64
+	series           map[string]*series
+}
+
+// series holds the values of a metric for one set of label values
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // per bucket, histograms only
+	count       uint64
+}
+
+func register(name, help, kind string, labels []string) *family {
+	f := &family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: map[string]*series{},
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.families[name]; ok {
+		panic(fmt.Sprintf("metric %s is already registered", name))
+	}
+	registry.families[name] = f
+	return f
+}
+
+// get returns the series of the label values.  Must be called with f held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		log.Error("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues))
+		labelValues = make([]string, len(f.labels))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up, such as a number of requests
+type Counter struct {
+	f *family
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{f: register(name, help, "counter", labels)}
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.Lock()
+	defer c.f.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge is a value that can go up and down, such as a number of workers
+type Gauge struct {
+	f *family
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: register(name, help, "gauge", labels)}
+}
+
+// NewGaugeFunc registers a gauge without labels whose value
+// is returned by fn each time the metrics are collected
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(name, help, "gauge", nil).fn = fn
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	g.f.get(labelValues).value = v
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	g.f.get(labelValues).value += v
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations, such as latencies, in buckets
+type Histogram struct {
+	f *family
+}
+
+// NewHistogram registers a histogram with the bucket upper bounds,
+// which must be sorted, or DefaultBuckets if nil
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	f := register(name, help, "histogram", labels)
+	f.buckets = buckets
+	return &Histogram{f: f}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.Lock()
+	defer h.f.Unlock()
+	s := h.f.get(labelValues)
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// Handler serves all the metrics in the Prometheus text format
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WriteMetrics(w); err != nil {
+		log.Error("Failed to write metrics - Error: %v", err)
+	}
+}
+
+// WriteMetrics writes all the metrics in the Prometheus text format
+func WriteMetrics(w io.Writer) error {
+	registry.Lock()
+	families := make([]*family, 0, len(registry.families))
+	for _, f := range registry.families {
+		families = append(families, f)
+	}
+	registry.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, strings.Replace(f.help, "\n", " ", -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	if f.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatValue(f.fn()))
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.formatLabels(s.labelValues, ""), formatValue(s.value))
+			continue
+		}
+		for i, upper := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.formatLabels(s.labelValues, formatValue(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.formatLabels(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.formatLabels(s.labelValues, ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.formatLabels(s.labelValues, ""), s.count)
+	}
+}
+
+// formatLabels returns the labels of a series, with the le label of
+// a histogram bucket if not empty, e.g. {method="query",le="0.5"}
+func (f *family) formatLabels(labelValues []string, le string) string {
+	pairs := make([]string, 0, len(f.labels)+1)
+	for i, label := range f.labels {
+		pairs = append(pairs, label+`="`+labelEscaper.Replace(labelValues[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
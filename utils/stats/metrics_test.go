@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MetricsTestSuite struct{}
+
+var _ = Suite(&MetricsTestSuite{})
+
+var (
+	testCounter   = NewCounter("test_requests_total", "Number of test requests", "method")
+	testGauge     = NewGauge("test_workers", "Number of test workers")
+	testHistogram = NewHistogram("test_duration_seconds", "Duration of the tests", []float64{0.1, 1})
+)
+
+func init() {
+	NewGaugeFunc("test_answer", "The answer", func() float64 { return 42 })
+}
+
+func (s *MetricsTestSuite) TestWriteMetrics(c *C) {
+	testCounter.Inc("query")
+	testCounter.Add(2, "query")
+	testCounter.Add(-1, "query")
+	testCounter.Inc(`a"b\c`)
+	testGauge.Inc()
+	testGauge.Inc()
+	testGauge.Dec()
+	testHistogram.Observe(0.05)
+	testHistogram.Observe(0.5)
+	testHistogram.Observe(5)
+
+	var buf bytes.Buffer
+	c.Assert(WriteMetrics(&buf), IsNil)
+	out := buf.String()
+	for _, line := range []string{
+		"# HELP test_requests_total Number of test requests",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{method="query"} 3`,
+		`test_requests_total{method="a\"b\\c"} 1`,
+		"# TYPE test_workers gauge",
+		"test_workers 1",
+		"test_answer 42",
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{le="0.1"} 1`,
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="+Inf"} 3`,
+		"test_duration_seconds_sum 5.55",
+		"test_duration_seconds_count 3",
+	} {
+		c.Assert(strings.Contains(out, line+"\n"), Equals, true, Commentf("missing %s in\n%s", line, out))
+	}
+	// metrics are sorted by name
+	c.Assert(strings.Index(out, "test_answer") < strings.Index(out, "test_workers"), Equals, true)
+
+	w := httptest.NewRecorder()
+	Handler(w, nil)
+	c.Assert(strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"), Equals, true)
+
+	c.Assert(func() { NewCounter("test_workers", "") }, PanicMatches, "metric test_workers is already registered")
+}
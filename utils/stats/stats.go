@@ -1,3 +1,32 @@
 package stats
 
 var TotalQueries uint64
+
+var (
+	QueryDuration = NewHistogram("marketstore_query_duration_seconds",
+		"Duration of the query calls", nil, "method")
+	WrittenRows = NewCounter("marketstore_written_rows_total",
+		"Number of rows written")
+	DeduplicatedRows = NewCounter("marketstore_deduplicated_rows_total",
+		"Number of duplicate variable length rows dropped from the writes")
+	Writes = NewCounter("marketstore_writes_total",
+		"Number of write calls, by bucket timeframe", "timeframe")
+	WALSyncDuration = NewHistogram("marketstore_wal_fsync_duration_seconds",
+		"Duration of the WAL file syncs", nil)
+	TriggerFires = NewCounter("marketstore_trigger_fires_total",
+		"Number of times the trigger plugins were fired", "plugin")
+	TriggerRows = NewCounter("marketstore_trigger_rows_total",
+		"Number of records the trigger plugins were fired with", "plugin")
+	TriggerDuration = NewHistogram("marketstore_trigger_duration_seconds",
+		"Duration of the trigger plugin executions", nil, "plugin")
+	TriggerLag = NewHistogram("marketstore_trigger_lag_seconds",
+		"Time from the writes to the trigger plugin executions", nil, "plugin")
+	TriggerBacklog = NewGauge("marketstore_trigger_backlog",
+		"Number of trigger plugin executions pending or running", "plugin")
+	TriggerPanics = NewCounter("marketstore_trigger_panics_total",
+		"Number of trigger plugin panics recovered from", "plugin")
+	TriggerFailures = NewCounter("marketstore_trigger_failures_total",
+		"Number of trigger executions failed after their retries", "plugin")
+	TriggerDeadLetters = NewCounter("marketstore_trigger_dead_letters_total",
+		"Number of writes dead-lettered by the trigger plugins", "plugin")
+)
@@ -0,0 +1,60 @@
+// Package systemd notifies the service manager of the state of the server,
+// when it runs as a systemd service of Type=notify, following sd_notify(3).
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Ready tells that the server has started and serves the clients
+	Ready = "READY=1"
+	// Stopping tells that the server is shutting down
+	Stopping = "STOPPING=1"
+	// Watchdog keeps the watchdog of the service from restarting it
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns the state describing the server, shown by systemctl status
+func Status(status string) string {
+	return "STATUS=" + status
+}
+
+// Notify sends the states, one per line, to the service manager.  It
+// returns false without an error when the server is not run by one.
+func Notify(states ...string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var msg []byte
+	for _, state := range states {
+		msg = append(append(msg, state...), '\n')
+	}
+	if _, err = conn.Write(msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the WatchdogSec of the service, within which
+// Watchdog must be sent again for the service not to be restarted, or 0
+// when the watchdog is disabled
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,56 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type SystemdTestSuite struct{}
+
+var _ = Suite(&SystemdTestSuite{})
+
+func (s *SystemdTestSuite) TearDownTest(c *C) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	os.Unsetenv("WATCHDOG_USEC")
+	os.Unsetenv("WATCHDOG_PID")
+}
+
+func (s *SystemdTestSuite) TestNotify(c *C) {
+	sent, err := Notify(Ready)
+	c.Assert(err, IsNil)
+	c.Assert(sent, Equals, false)
+
+	socket := filepath.Join(c.MkDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	sent, err = Notify(Ready, Status("serving"))
+	c.Assert(err, IsNil)
+	c.Assert(sent, Equals, true)
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "READY=1\nSTATUS=serving\n")
+}
+
+func (s *SystemdTestSuite) TestWatchdogInterval(c *C) {
+	c.Assert(WatchdogInterval(), Equals, time.Duration(0))
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	c.Assert(WatchdogInterval(), Equals, 30*time.Second)
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	c.Assert(WatchdogInterval(), Equals, 30*time.Second)
+	// the watchdog of another process
+	os.Setenv("WATCHDOG_PID", "1")
+	c.Assert(WatchdogInterval(), Equals, time.Duration(0))
+}